@@ -0,0 +1,93 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+func init() {
+	RootCmd.AddCommand(appCmd)
+	appCmd.AddCommand(appStatusCmd)
+	appStatusCmd.PersistentFlags().StringP(flagFormat, "o", kubecfg.AppStatusFormatText, "Output format.  Supported values are: text, json")
+}
+
+var appCmd = &cobra.Command{
+	Use:   "app",
+	Short: "Inspect a ksonnet application",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("Command 'app' requires a subcommand\n\n%s", cmd.UsageString())
+	},
+}
+
+var appStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report mismatches between an application's configuration and its files",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("'app status' takes zero arguments")
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manager, err := metadata.Find(metadata.AbsPath(cwd))
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewAppStatusCmd(manager)
+		if err != nil {
+			return err
+		}
+		c.KsVersion = Version
+
+		c.Format, err = cmd.Flags().GetString(flagFormat)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `Report mismatches between the configuration of a ksonnet application and
+what is actually on disk, e.g.:
+
+  * 'app.yaml' that this version of ks cannot use (see 'minKsVersion' and
+    'requires'), configures components that do not exist, or lists library
+    paths that do not exist
+  * environments missing their overrides or generated ksonnet-lib, inheriting
+    from environments that do not exist, or selecting no clusters
+  * directories in 'environments/' that look like environments, but have no
+    'spec.json'
+  * stages of 'pipeline.yaml' that use environments that do not exist
+  * files that differ from the checksums recorded in 'ks.lock'
+
+'app status' only reads the application, and runs even when 'app.yaml' is not
+usable by this version of ks, so it is the first thing to run when an
+application looks wrong.`,
+	Example: `  # Check the application in the current directory.
+  ks app status
+
+  # Check the application, writing the problems as JSON.
+  ks app status -o json`,
+}
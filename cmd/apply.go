@@ -18,11 +18,19 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 
 	"github.com/ksonnet/ksonnet/metadata"
 	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+	"github.com/ksonnet/ksonnet/utils"
 )
 
 const (
@@ -31,6 +39,22 @@ const (
 	flagGcTag  = "gc-tag"
 	flagDryRun = "dry-run"
 
+	flagChangedSince = "changed-since"
+
+	flagConcurrency = "concurrency"
+	flagWaveTimeout = "wave-timeout"
+
+	flagChecksumVerify = "checksum-verify"
+
+	flagAutoRollback    = "auto-rollback"
+	flagRollbackTimeout = "rollback-timeout"
+
+	flagViaAgent            = "via-agent"
+	flagAgentNamespace      = "agent-namespace"
+	flagAgentServiceAccount = "agent-service-account"
+	flagAgentImage          = "agent-image"
+	flagAgentTimeout        = "agent-timeout"
+
 	// AnnotationGcTag annotation that triggers
 	// garbage collection. Objects with value equal to
 	// command-line flag that are *not* in config will be deleted.
@@ -57,12 +81,24 @@ func init() {
 	applyCmd.PersistentFlags().Bool(flagSkipGc, false, "Don't perform garbage collection, even with --"+flagGcTag)
 	applyCmd.PersistentFlags().String(flagGcTag, "", "Add this tag to updated objects, and garbage collect existing objects with this tag and not in config")
 	applyCmd.PersistentFlags().Bool(flagDryRun, false, "Perform only read-only operations")
+	applyCmd.PersistentFlags().String(flagChangedSince, "", "Only apply the components affected by the changes since this git revision (e.g., 'origin/master')")
+	applyCmd.PersistentFlags().Bool(flagConfirm, false, "Apply to a protected environment without asking for confirmation")
+	applyCmd.PersistentFlags().Int(flagConcurrency, 1, "Number of independent objects to update at once")
+	applyCmd.PersistentFlags().Duration(flagWaveTimeout, kubecfg.DefaultWaveTimeout, "How long to wait for the objects of each wave to become ready before applying the next wave")
+	applyCmd.PersistentFlags().Bool(flagAutoRollback, false, "Roll the objects back to their previous state if the apply fails, or they do not become ready within --"+flagRollbackTimeout)
+	applyCmd.PersistentFlags().Duration(flagRollbackTimeout, 5*time.Minute, "How long the applied objects have to become ready (with --"+flagAutoRollback+")")
+	applyCmd.PersistentFlags().Bool(flagChecksumVerify, false, "Refuse to apply if components, 'lib/', or 'vendor/' differ from the checksums in 'ks.lock'")
+	applyCmd.PersistentFlags().Bool(flagViaAgent, false, "Render locally, but have an in-cluster Job perform the apply with its own credentials")
+	applyCmd.PersistentFlags().String(flagAgentNamespace, kubecfg.DefaultAgentNamespace, "Namespace the apply agent runs in (with --"+flagViaAgent+")")
+	applyCmd.PersistentFlags().String(flagAgentServiceAccount, kubecfg.DefaultAgentServiceAccount, "Service account the apply agent runs as (with --"+flagViaAgent+")")
+	applyCmd.PersistentFlags().String(flagAgentImage, kubecfg.DefaultAgentImage, "Image of the apply agent; must contain the 'ks' binary (with --"+flagViaAgent+")")
+	applyCmd.PersistentFlags().Duration(flagAgentTimeout, 10*time.Minute, "How long to wait for the apply agent to finish; 0 waits forever (with --"+flagViaAgent+")")
 }
 
 var applyCmd = &cobra.Command{
 	Use:   "apply [env-name] [-f <file-or-dir>]",
 	Short: `Apply local configuration to remote cluster`,
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: forEachEnvironment(true, func(cmd *cobra.Command, args []string) error {
 		if len(args) > 1 {
 			return fmt.Errorf("'apply' takes at most a single argument, that is the name of the environment")
 		}
@@ -70,7 +106,7 @@ var applyCmd = &cobra.Command{
 		flags := cmd.Flags()
 		var err error
 
-		c := kubecfg.ApplyCmd{}
+		c := kubecfg.ApplyCmd{Out: cmd.OutOrStdout()}
 
 		c.Create, err = flags.GetBool(flagCreate)
 		if err != nil {
@@ -92,6 +128,30 @@ var applyCmd = &cobra.Command{
 			return err
 		}
 
+		c.Concurrency, err = flags.GetInt(flagConcurrency)
+		if err != nil {
+			return err
+		}
+
+		c.WaveTimeout, err = flags.GetDuration(flagWaveTimeout)
+		if err != nil {
+			return err
+		}
+
+		autoRollback, err := flags.GetBool(flagAutoRollback)
+		if err != nil {
+			return err
+		}
+		if autoRollback {
+			c.RollbackTimeout, err = flags.GetDuration(flagRollbackTimeout)
+			if err != nil {
+				return err
+			}
+			if c.RollbackTimeout <= 0 {
+				return fmt.Errorf("'--%s' must be positive", flagRollbackTimeout)
+			}
+		}
+
 		cwd, err := os.Getwd()
 		if err != nil {
 			return err
@@ -103,29 +163,183 @@ var applyCmd = &cobra.Command{
 			return err
 		}
 
-		c.ClientPool, c.Discovery, err = restClientPool(cmd, envSpec.env)
+		envSpec.changedSince, err = flags.GetString(flagChangedSince)
 		if err != nil {
 			return err
 		}
 
-		c.Namespace, err = namespace()
+		if !c.DryRun {
+			if err := checkProtected(cmd, envSpec.env, "apply to"); err != nil {
+				return err
+			}
+		}
+
+		if envSpec.selector != "" && c.GcTag != "" && !c.SkipGc {
+			// Objects of the components that were not selected would look like
+			// garbage.
+			log.Infof("Skipping garbage collection, as only components matching '%s' are applied", envSpec.selector)
+			c.SkipGc = true
+		}
+		if envSpec.changedSince != "" && c.GcTag != "" && !c.SkipGc {
+			log.Infof("Skipping garbage collection, as only components changed since '%s' are applied", envSpec.changedSince)
+			c.SkipGc = true
+		}
+		if envSpec.labelSelector != "" && c.GcTag != "" && !c.SkipGc {
+			log.Infof("Skipping garbage collection, as only objects matching '%s' are applied", envSpec.labelSelector)
+			c.SkipGc = true
+		}
+
+		checksumVerify, err := flags.GetBool(flagChecksumVerify)
 		if err != nil {
 			return err
 		}
+		if checksumVerify {
+			manager, err := metadata.Find(wd)
+			if err != nil {
+				return err
+			}
+			if err := manager.VerifyChecksums(); err != nil {
+				return err
+			}
+		}
 
-		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+		viaAgent, err := flags.GetBool(flagViaAgent)
 		if err != nil {
 			return err
 		}
+		if viaAgent {
+			if autoRollback {
+				return fmt.Errorf("'--%s' cannot be used with '--%s'", flagAutoRollback, flagViaAgent)
+			}
+			return applyViaAgent(cmd, c, envSpec, wd)
+		}
 
-		return c.Run(objs, wd)
-	},
+		return runApply(cmd, c, envSpec, wd)
+	}),
 	Long: `Update (or optionally create) Kubernetes resources on the cluster using the
 local configuration. Use the '--create' flag to control whether we create them
 if they do not exist (default: true).
 
 ksonnet applications are accepted, as well as normal JSON, YAML, and Jsonnet
-files.`,
+files.
+
+If the cluster rejects the client's credentials partway through (e.g., because
+a short-lived OIDC token expired), the credentials are refreshed and the update
+is retried with backoff, rather than leaving the environment half-applied.
+
+If the environment has a cluster selector (see 'ks env set --cluster-selector'),
+the configuration is applied to every cluster in the cluster inventory,
+'clusters.yaml', whose labels match the selector. Each cluster is located in
+kubeconfig by its URI, exactly as an environment's own URI would be. A failure
+on one cluster does not stop the others; the results are reported per cluster.
+
+With '--via-agent', the configuration is still rendered locally, but the
+rendered objects are handed to a Job in the '--agent-namespace' namespace, which
+runs 'ks apply' with the credentials of the '--agent-service-account' service
+account. The user then only needs permission to create ConfigMaps and Jobs in
+that namespace, rather than direct access to everything being deployed.
+
+Hooks declared in the environment's 'spec.json' run around the apply: its
+'preApply' hooks (e.g., schema migrations) before any object is updated, and its
+'postApply' hooks (e.g., smoke tests) after every object has been. A hook either
+runs a command on the local machine, from the application root, or recreates
+the objects described by a file (typically a Job) in the environment's cluster,
+and waits for its Jobs to complete. Hooks are skipped with '--dry-run'.
+
+Objects are applied in order of their dependencies: namespaces and custom
+resource definitions first, one at a time; then RBAC objects and service
+accounts; then everything else; and finally workloads (e.g., Deployments and
+Jobs). With '--concurrency', up to that many objects within each of these
+classes are updated at once, which can shorten the apply of large environments
+considerably.
+
+Where the built-in ordering is not enough (e.g., a custom resource can only be
+created once the operator that serves it is running), objects can be ordered
+explicitly with the 'ksonnet.io/apply-wave' annotation. Objects are applied in
+waves, in ascending order of the (integer) annotation value; objects without it
+are in wave 0. Before each wave is applied, 'ks' waits (for up to
+'--wave-timeout') for the objects of the previous wave to become ready. Waves
+are deleted in the reverse order by 'ks delete'.
+
+Once everything has been applied, the readiness of each component is
+summarized, e.g., how many of a Deployment's replicas are ready, whether a Job
+has completed, or whether an Ingress has been assigned an address. Objects are
+grouped into components by their 'ksonnet.io/component' label, which 'ks'
+sets on every object it renders from an environment.
+
+For kinds whose readiness 'ks' cannot infer (e.g., custom resources), a
+component can declare health policies in 'app.yaml': Jsonnet expressions over
+the live object, bound to 'object', e.g.:
+
+  components:
+    redis:
+      health:
+      - kind: RedisCluster
+        ready: object.status.phase == "Running"
+        message: '"phase " + object.status.phase'
+
+The same policies are used by the 'wait' stages of 'ks pipeline run'.
+
+Most fields of Jobs (and some of CronJobs) cannot be changed once they are
+created, so re-applying a changed Job normally fails. What happens to the
+existing Jobs and CronJobs of a component is set by 'jobRerun' in 'app.yaml',
+or for a single object by its 'ksonnet.io/job-rerun' annotation:
+
+  components:
+    migrate:
+      jobRerun: recreate
+
+  fail            the apply fails if the update is rejected (the default)
+  skip-if-exists  existing Jobs and CronJobs are left unchanged
+  recreate        a new run of an existing Job is created alongside it, named
+                  after it (e.g., 'migrate-x7k2p'), and the previous runs are
+                  garbage collected (see '--gc-tag'); existing CronJobs are
+                  deleted and created again
+
+Each successful apply to an environment records a snapshot of the objects
+applied; see 'ks snapshot'.
+
+With '--auto-rollback', the live state of the objects to apply is captured
+first. Once everything has been applied, 'ks' waits (for up to
+'--rollback-timeout') for every object to become ready, judged as in the
+readiness summary. If the apply fails, or some objects are not ready in time,
+the objects are restored to their captured state, the objects that the apply
+created are deleted, and the components that were not ready are reported.
+Garbage collection, the 'postApply' hooks, and the snapshot only follow an
+apply that became ready. Where an environment spans several clusters, each
+cluster is rolled back on its own.
+
+With '--selector', only the environment's components whose labels match the
+selector are applied. Components are labeled in 'app.yaml', e.g.:
+
+  components:
+    redis:
+      labels:
+        tier: backend
+        stateful: "true"
+
+With '--changed-since', only the components whose rendering may have changed
+since the given git revision are applied, which shortens the deploys of large
+applications considerably. A component is affected if it was changed itself,
+or if it imports (directly or not) a file that was changed, e.g., in 'lib/' or
+'vendor/'. If 'app.yaml', 'environments/base.libsonnet', or the files of the
+environment (or of an environment it inherits from) were changed, every
+component is applied. Uncommitted and untracked files count as changed.
+
+Garbage collection is skipped, and no snapshot is recorded, when only some of
+an environment's components (or, with '--label-selector', its objects) are
+applied.
+
+With '--checksum-verify', nothing is applied unless every file in
+'components/', 'environments/', 'lib/', and 'vendor/' matches the checksums
+recorded by 'ks lock', so that what is deployed is exactly what was reviewed.
+
+Several environments can be applied at once, by naming each of them, or with
+glob patterns over environment names, e.g., 'dev-*' or 'us-west/*' ('*' does
+not match '/'; quote patterns so that the shell leaves them alone). The
+environments are applied one after another, each as if by its own 'ks apply';
+a failure in one does not stop the others. The outcome for each environment is
+reported at the end, and the command fails if any of them failed.`,
 	Example: `  # Create or update all resources described in a ksonnet application, and
   # running in the 'dev' environment. Can be used in any subdirectory of the
   # application.
@@ -144,5 +358,495 @@ files.`,
   ks apply --kubeconfig=./kubeconfig -f ./pod.yaml
 
   # Display set of actions we will execute when we run 'apply'.
-  ks apply dev --dry-run`,
+  ks apply dev --dry-run
+
+  # Update the resources of the 'prod' environment, and undo the update unless
+  # everything is ready within 10 minutes.
+  ks apply prod --auto-rollback --rollback-timeout 10m
+
+  # Update the resources of the 'prod' environment, up to 8 at a time.
+  ks apply prod --concurrency=8
+
+  # Update only the components of the 'prod' environment labeled
+  # 'tier: frontend' in 'app.yaml'.
+  ks apply prod --selector tier=frontend
+
+  # Update only the rendered objects of the 'prod' environment labeled
+  # 'app: guestbook'.
+  ks apply prod -l app=guestbook
+
+  # In CI, update only the components of 'prod' that the commits since
+  # 'origin/master' affect.
+  ks apply prod --changed-since origin/master
+
+  # Render the 'prod' environment locally, and have the in-cluster agent apply
+  # it as the 'ksonnet-agent' service account.
+  ks apply prod --via-agent
+
+  # Apply every environment under 'us-west/', and the 'staging' environment.
+  ks apply 'us-west/*' staging`,
+}
+
+// runApply applies the objects described by `envSpec`, using the settings in
+// `c`, to the environment's cluster (or clusters), and records a snapshot of
+// the environment.
+func runApply(cmd *cobra.Command, c kubecfg.ApplyCmd, envSpec *envSpec, wd metadata.AbsPath) error {
+	clusters, err := envClusters(envSpec.env, wd)
+	if err != nil {
+		return err
+	}
+
+	c.HealthPolicies, err = healthPolicies(wd)
+	if err != nil {
+		return err
+	}
+	c.Components, err = componentSpecs(wd)
+	if err != nil {
+		return err
+	}
+	if clusters != nil {
+		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+		if err != nil {
+			return err
+		}
+		if servers, err := componentServers(envSpec.env, wd); err != nil {
+			return err
+		} else if len(servers) > 0 {
+			return fmt.Errorf("Environment '%s' maps components to clusters, which is not supported with a cluster selector", *envSpec.env)
+		}
+		// Job hooks need a single cluster, so only commands can be run here.
+		hooks := kubecfg.HookCmd{}
+		if err := runHooks(cmd, hooks, envSpec.env, metadata.HookPreApply, c.DryRun, wd); err != nil {
+			return err
+		}
+		if err := applyToClusters(cmd, &c, *envSpec.env, clusters, objs, wd); err != nil {
+			return err
+		}
+		if recordsSnapshot(envSpec, c.DryRun) {
+			recordSnapshot(*envSpec.env, objs, wd)
+		}
+		return runHooks(cmd, hooks, envSpec.env, metadata.HookPostApply, c.DryRun, wd)
+	}
+
+	c.ClientPool, c.Discovery, err = restClientPool(cmd, envSpec.env)
+	if err != nil {
+		return err
+	}
+	c.Reconnect = func() (dynamic.ClientPool, discovery.DiscoveryInterface, error) {
+		// The cluster and namespace overrides for the environment were
+		// already applied above, but its credentials may need refreshing.
+		if err := refreshCredentials(*envSpec.env, wd); err != nil {
+			return nil, nil, err
+		}
+		reloadClientConfig()
+		return restClientPool(cmd, nil)
+	}
+
+	c.Namespace, err = namespace()
+	if err != nil {
+		return err
+	}
+
+	envSpec.discovery = c.Discovery
+	objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+	if err != nil {
+		return err
+	}
+
+	hooks := kubecfg.HookCmd{ClientPool: c.ClientPool, Discovery: c.Discovery, Namespace: c.Namespace}
+	if err := runHooks(cmd, hooks, envSpec.env, metadata.HookPreApply, c.DryRun, wd); err != nil {
+		return err
+	}
+
+	groups, err := groupByComponentServer(envSpec.env, objs, wd)
+	if err != nil {
+		return err
+	}
+	if err := c.Run(groups[""], wd); err != nil {
+		return err
+	}
+	if envSpec.env != nil {
+		if err := applyToComponentServers(cmd, c, *envSpec.env, groups, wd); err != nil {
+			return err
+		}
+	}
+
+	if recordsSnapshot(envSpec, c.DryRun) {
+		recordSnapshot(*envSpec.env, objs, wd)
+	}
+	return runHooks(cmd, hooks, envSpec.env, metadata.HookPostApply, c.DryRun, wd)
+}
+
+// runHooks runs the `phase` hooks of the environment `env`, if it is set,
+// using the cluster settings of `c`. Hooks have side effects, so they are
+// skipped in dry runs.
+func runHooks(cmd *cobra.Command, c kubecfg.HookCmd, env *string, phase string, dryRun bool, wd metadata.AbsPath) error {
+	if env == nil {
+		return nil
+	}
+
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return err
+	}
+	e, err := manager.GetEnvironment(*env)
+	if err != nil {
+		return err
+	}
+	hooks := e.Hooks.Phase(phase)
+	if len(hooks) == 0 {
+		return nil
+	}
+	if dryRun {
+		log.Infof("Skipping %d %s hook(s) of environment '%s' (dry-run)", len(hooks), phase, e.Name)
+		return nil
+	}
+
+	c.Env = e.Name
+	c.AppDir = string(manager.Root())
+	c.Out = cmd.OutOrStderr()
+	c.RenderJob = func(path string) ([]*unstructured.Unstructured, error) {
+		return expandEnvCmdObjs(cmd, &envSpec{env: env, files: []string{path}}, wd)
+	}
+	return c.Run(phase, hooks)
+}
+
+// applyViaAgent renders the objects to apply locally, and submits them to an
+// in-cluster apply agent, using the settings in `c`.
+func applyViaAgent(cmd *cobra.Command, c kubecfg.ApplyCmd, envSpec *envSpec, wd metadata.AbsPath) error {
+	flags := cmd.Flags()
+
+	clusters, err := envClusters(envSpec.env, wd)
+	if err != nil {
+		return err
+	}
+	if clusters != nil {
+		return fmt.Errorf("'--%s' cannot be used with environments that select clusters from the cluster inventory", flagViaAgent)
+	}
+
+	a := kubecfg.AgentApplyCmd{Create: c.Create, GcTag: c.GcTag, SkipGc: c.SkipGc, DryRun: c.DryRun}
+
+	a.AgentNamespace, err = flags.GetString(flagAgentNamespace)
+	if err != nil {
+		return err
+	}
+	a.AgentServiceAccount, err = flags.GetString(flagAgentServiceAccount)
+	if err != nil {
+		return err
+	}
+	a.AgentImage, err = flags.GetString(flagAgentImage)
+	if err != nil {
+		return err
+	}
+	a.Timeout, err = flags.GetDuration(flagAgentTimeout)
+	if err != nil {
+		return err
+	}
+
+	a.ClientPool, a.Discovery, err = restClientPool(cmd, envSpec.env)
+	if err != nil {
+		return err
+	}
+
+	a.Namespace, err = namespace()
+	if err != nil {
+		return err
+	}
+
+	envSpec.discovery = a.Discovery
+	objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Run(objs); err != nil {
+		return err
+	}
+
+	if recordsSnapshot(envSpec, a.DryRun) {
+		recordSnapshot(*envSpec.env, objs, wd)
+	}
+	return nil
+}
+
+// envClusters returns the clusters selected from the cluster inventory by the
+// environment `env`'s cluster selector, or nil if `env` is not set or has no
+// cluster selector.
+func envClusters(env *string, wd metadata.AbsPath) ([]*metadata.Cluster, error) {
+	if env == nil {
+		return nil, nil
+	}
+
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := manager.GetEnvironment(*env)
+	if err != nil {
+		return nil, err
+	}
+	if e.ClusterSelector == "" {
+		return nil, nil
+	}
+
+	clusters, err := manager.SelectClusters(e.ClusterSelector)
+	if err != nil {
+		return nil, err
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("No clusters in the cluster inventory match the selector '%s' of environment '%s'", e.ClusterSelector, *env)
+	}
+
+	log.Infof("Environment '%s' selects %d cluster(s) with '%s'", *env, len(clusters), e.ClusterSelector)
+	return clusters, nil
+}
+
+// applyToClusters applies `objs` to each of `clusters` in turn, using the
+// settings in `c`. Every cluster is attempted even if an earlier one fails.
+func applyToClusters(cmd *cobra.Command, c *kubecfg.ApplyCmd, env string, clusters []*metadata.Cluster, objs []*unstructured.Unstructured, wd metadata.AbsPath) error {
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return err
+	}
+	e, err := manager.GetEnvironment(env)
+	if err != nil {
+		return err
+	}
+	_, namespace, err := manager.ExpandDestination(e)
+	if err != nil {
+		return err
+	}
+
+	failed := []string{}
+	for _, cluster := range clusters {
+		log.Infof("Applying environment '%s' to cluster '%s' at %s", env, cluster.Name, cluster.URI)
+		if err := applyToCluster(cmd, *c, e.Name, cluster, namespace, objs, wd); err != nil {
+			log.Errorf("Failed to apply environment '%s' to cluster '%s':\n%v", env, cluster.Name, err)
+			failed = append(failed, cluster.Name)
+			continue
+		}
+		log.Infof("Applied environment '%s' to cluster '%s'", env, cluster.Name)
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to apply environment '%s' to %d of %d cluster(s): %s", env, len(failed), len(clusters), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func applyToCluster(cmd *cobra.Command, c kubecfg.ApplyCmd, env string, cluster *metadata.Cluster, namespaceName string, objs []*unstructured.Unstructured, wd metadata.AbsPath) error {
+	var err error
+	c.ClientPool, c.Discovery, c.Namespace, err = clusterClients(cmd, env, cluster.URI, namespaceName, wd)
+	if err != nil {
+		return err
+	}
+	c.Reconnect = func() (dynamic.ClientPool, discovery.DiscoveryInterface, error) {
+		if err := refreshCredentials(env, wd); err != nil {
+			return nil, nil, err
+		}
+		reloadClientConfig()
+		return restClientPool(cmd, nil)
+	}
+
+	return c.Run(objs, wd)
+}
+
+// clusterClients points the client configuration at the cluster at `uri` and
+// the namespace `namespaceName`, with the credentials of the environment
+// `env`, and returns the clients and default namespace for it.
+func clusterClients(cmd *cobra.Command, env, uri, namespaceName string, wd metadata.AbsPath) (dynamic.ClientPool, discovery.DiscoveryInterface, string, error) {
+	if err := overrideClusterURI(uri, namespaceName); err != nil {
+		return nil, nil, "", err
+	}
+	if err := refreshCredentials(env, wd); err != nil {
+		return nil, nil, "", err
+	}
+	reloadClientConfig()
+
+	pool, disco, err := restClientPool(cmd, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	ns, err := namespace()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return pool, disco, ns, nil
+}
+
+// componentServers returns the component cluster mappings of the environment
+// `env`, or nil if `env` is not set.
+func componentServers(env *string, wd metadata.AbsPath) (map[string]string, error) {
+	if env == nil {
+		return nil, nil
+	}
+
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return nil, err
+	}
+	return manager.ComponentServers(*env)
+}
+
+// groupByComponentServer splits `objs` by the cluster that their component is
+// deployed to in the environment `env`. The objects deployed to the
+// environment's own cluster are grouped under the empty string.
+func groupByComponentServer(env *string, objs []*unstructured.Unstructured, wd metadata.AbsPath) (map[string][]*unstructured.Unstructured, error) {
+	servers, err := componentServers(env, wd)
+	if err != nil {
+		return nil, err
+	}
+	return utils.GroupByComponentServer(objs, servers), nil
+}
+
+// componentServerURIs returns the URIs of the clusters other than the
+// environment's own in `groups`, in order.
+func componentServerURIs(groups map[string][]*unstructured.Unstructured) []string {
+	uris := []string{}
+	for uri := range groups {
+		if uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+// applyToComponentServers applies the objects in `groups` of the components
+// that the environment `env` deploys to clusters other than its own, to those
+// clusters, using the settings in `c`.
+func applyToComponentServers(cmd *cobra.Command, c kubecfg.ApplyCmd, env string, groups map[string][]*unstructured.Unstructured, wd metadata.AbsPath) error {
+	uris := componentServerURIs(groups)
+	if len(uris) == 0 {
+		return nil
+	}
+
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return err
+	}
+	e, err := manager.GetEnvironment(env)
+	if err != nil {
+		return err
+	}
+	_, namespace, err := manager.ExpandDestination(e)
+	if err != nil {
+		return err
+	}
+
+	for _, uri := range uris {
+		log.Infof("Applying %d object(s) of environment '%s' to the cluster at %s", len(groups[uri]), env, uri)
+		if err := applyToComponentServer(cmd, c, uri, namespace, groups[uri], wd); err != nil {
+			return fmt.Errorf("Failed to apply environment '%s' to the cluster at %s:\n%v", env, uri, err)
+		}
+	}
+	return nil
+}
+
+func applyToComponentServer(cmd *cobra.Command, c kubecfg.ApplyCmd, uri, namespaceName string, objs []*unstructured.Unstructured, wd metadata.AbsPath) error {
+	var restore func()
+	var err error
+	c.ClientPool, c.Discovery, c.Namespace, restore, err = componentServerClients(cmd, uri, namespaceName)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	c.Reconnect = func() (dynamic.ClientPool, discovery.DiscoveryInterface, error) {
+		// The credentials are kubeconfig's, which the client refreshes itself.
+		reloadClientConfig()
+		return restClientPool(cmd, nil)
+	}
+
+	return c.Run(objs, wd)
+}
+
+// componentServerClients points the client configuration at the cluster at
+// `uri` and the namespace `namespaceName`, with the credentials kubeconfig has
+// for it (see `overrideServerCredentials`), and returns the clients and default
+// namespace for it. The returned function restores the credentials of the
+// environment.
+func componentServerClients(cmd *cobra.Command, uri, namespaceName string) (dynamic.ClientPool, discovery.DiscoveryInterface, string, func(), error) {
+	if err := overrideClusterURI(uri, namespaceName); err != nil {
+		return nil, nil, "", nil, err
+	}
+	restore, err := overrideServerCredentials(uri)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	reloadClientConfig()
+
+	pool, disco, err := restClientPool(cmd, nil)
+	if err != nil {
+		restore()
+		return nil, nil, "", nil, err
+	}
+	ns, err := namespace()
+	if err != nil {
+		restore()
+		return nil, nil, "", nil, err
+	}
+	return pool, disco, ns, restore, nil
+}
+
+// refreshCredentials obtains a fresh token for the environment `env` of the
+// application at `wd`, if 'app.yaml' configures a credential provider for it.
+func refreshCredentials(env string, wd metadata.AbsPath) error {
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return err
+	}
+	return overrideCredentials(manager, env)
+}
+
+// healthPolicies returns the health policies declared in the 'app.yaml' of the
+// application at `wd`, if any.
+func healthPolicies(wd metadata.AbsPath) (kubecfg.HealthPolicies, error) {
+	components, err := componentSpecs(wd)
+	if err != nil {
+		return nil, err
+	}
+	return kubecfg.NewHealthPolicies(components), nil
+}
+
+// componentSpecs returns the settings of the components of the application
+// containing `wd`, as described in 'app.yaml'.
+func componentSpecs(wd metadata.AbsPath) (map[string]*metadata.ComponentSpec, error) {
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		// Not in an application (e.g., 'ks apply -f'), so there are none.
+		return nil, nil
+	}
+
+	appSpec, err := manager.AppSpec()
+	if err != nil {
+		return nil, err
+	}
+	return appSpec.Components, nil
+}
+
+// recordsSnapshot returns true if applying `envSpec` should record a snapshot
+// of the environment. A snapshot describes the whole environment, so nothing
+// is recorded when only some of its components or objects are applied.
+func recordsSnapshot(envSpec *envSpec, dryRun bool) bool {
+	return envSpec.env != nil && envSpec.selector == "" && envSpec.labelSelector == "" && envSpec.changedSince == "" && !dryRun
+}
+
+// recordSnapshot saves a snapshot of the objects applied to the environment
+// `env`. The objects have already been applied, so failing to record the
+// snapshot is only worth a warning.
+func recordSnapshot(env string, objs []*unstructured.Unstructured, wd metadata.AbsPath) {
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		log.Warnf("Failed to record snapshot of environment '%s': %v", env, err)
+		return
+	}
+
+	snapshot, err := kubecfg.NewSnapshot(env, objs, time.Now())
+	if err == nil {
+		err = manager.SaveSnapshot(snapshot)
+	}
+	if err != nil {
+		log.Warnf("Failed to record snapshot of environment '%s': %v", env, err)
+	}
 }
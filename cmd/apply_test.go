@@ -0,0 +1,42 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestRecordsSnapshot(t *testing.T) {
+	env := "default"
+	tests := []struct {
+		name     string
+		envSpec  *envSpec
+		dryRun   bool
+		expected bool
+	}{
+		{name: "whole environment", envSpec: &envSpec{env: &env}, expected: true},
+		{name: "files", envSpec: &envSpec{files: []string{"app.jsonnet"}}, expected: false},
+		{name: "dry run", envSpec: &envSpec{env: &env}, dryRun: true, expected: false},
+		{name: "component selector", envSpec: &envSpec{env: &env, selector: "tier=frontend"}, expected: false},
+		{name: "label selector", envSpec: &envSpec{env: &env, labelSelector: "app=web"}, expected: false},
+		{name: "changed since", envSpec: &envSpec{env: &env, changedSince: "HEAD~1"}, expected: false},
+	}
+	for _, test := range tests {
+		if actual := recordsSnapshot(test.envSpec, test.dryRun); actual != test.expected {
+			t.Errorf("%s: expected recordsSnapshot to return %t, got %t", test.name, test.expected, actual)
+		}
+	}
+}
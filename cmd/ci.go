@@ -0,0 +1,147 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/ci"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+const (
+	flagCIProvider  = "provider"
+	flagCIBranch    = "branch"
+	flagCIOutputDir = "output-dir"
+	flagCIEnv       = "env"
+	flagCIApplyEnv  = "apply-env"
+	flagCIForce     = "force"
+)
+
+func init() {
+	RootCmd.AddCommand(ciCmd)
+	ciCmd.AddCommand(ciInitCmd)
+
+	ciInitCmd.PersistentFlags().String(flagCIProvider, "",
+		"CI provider to generate a pipeline for. Supported values are: "+strings.Join(ci.Providers, ", "))
+	ciInitCmd.PersistentFlags().String(flagCIBranch, "master",
+		"Branch whose changes are applied once merged")
+	ciInitCmd.PersistentFlags().String(flagCIOutputDir, "",
+		"Directory to write the pipeline definition under, usually the root of the repository (default: the application's root)")
+	ciInitCmd.PersistentFlags().StringSlice(flagCIEnv, nil,
+		"Environment to check proposed changes against; may be repeated (default: every environment)")
+	ciInitCmd.PersistentFlags().StringSlice(flagCIApplyEnv, nil,
+		"Environment to apply when changes are merged, in order; may be repeated (default: the checked environments)")
+	ciInitCmd.PersistentFlags().Bool(flagCIForce, false,
+		"Overwrite an existing pipeline definition")
+}
+
+var ciCmd = &cobra.Command{
+	Use:   "ci",
+	Short: "Manage continuous integration pipelines for the application",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("Command 'ci' requires a subcommand\n\n%s", cmd.UsageString())
+	},
+}
+
+var ciInitCmd = &cobra.Command{
+	Use:   "init --provider <provider>",
+	Short: "Generate a CI pipeline that checks and applies the application",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if len(args) != 0 {
+			return fmt.Errorf("'ci init' takes zero arguments")
+		}
+
+		provider, err := flags.GetString(flagCIProvider)
+		if err != nil {
+			return err
+		} else if provider == "" {
+			return fmt.Errorf("'ci init' requires '--%s'; supported values are: %s", flagCIProvider, strings.Join(ci.Providers, ", "))
+		}
+
+		branch, err := flags.GetString(flagCIBranch)
+		if err != nil {
+			return err
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manager, err := metadata.Find(metadata.AbsPath(cwd))
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewCIInitCmd(provider, branch, manager)
+		if err != nil {
+			return err
+		}
+
+		c.OutputDir, err = flags.GetString(flagCIOutputDir)
+		if err != nil {
+			return err
+		}
+		c.Envs, err = flags.GetStringSlice(flagCIEnv)
+		if err != nil {
+			return err
+		}
+		c.ApplyEnvs, err = flags.GetStringSlice(flagCIApplyEnv)
+		if err != nil {
+			return err
+		}
+		c.Force, err = flags.GetBool(flagCIForce)
+		if err != nil {
+			return err
+		}
+
+		return c.Run()
+	},
+	Long: `Generate a pipeline definition for a CI provider. For every proposed change
+(a pull or merge request), the pipeline reports problems with the application
+('ks app status'), and validates and diffs each environment against its
+cluster ('ks validate' and 'ks diff'). When a change is merged into '--branch',
+it applies each environment in turn ('ks apply').
+
+The definition is written to the provider's conventional location under
+'--output-dir':
+
+  github-actions   .github/workflows/ksonnet.yml
+  gitlab           .gitlab-ci.yml
+  jenkins          Jenkinsfile
+
+If the application is not at the root of its repository, set '--output-dir'
+to the repository's root; the pipeline then runs 'ks' in the application's
+directory. The pipeline expects 'ks' to be available to the CI jobs, and
+reads the kubeconfig used to reach the clusters from the provider's secret
+store, as described in the generated file.`,
+	Example: `  # Generate a GitHub Actions workflow at the root of the repository that
+  # contains the application in 'deploy/'.
+  ks ci init --provider github-actions --output-dir ..
+
+  # Check every environment on merge requests, but only apply 'staging' and
+  # then 'prod' when changes are merged into 'main'.
+  ks ci init --provider gitlab --branch main --apply-env staging --apply-env prod
+
+  # Regenerate an existing Jenkinsfile.
+  ks ci init --provider jenkins --force`,
+}
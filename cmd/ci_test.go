@@ -0,0 +1,55 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ksonnet/ksonnet/pkg/ci"
+)
+
+// ksCommand matches the ks commands run by a generated pipeline, up to their
+// first argument that is not a plain word (e.g., a quoted environment name).
+var ksCommand = regexp.MustCompile(`\bks ((?:[a-z][a-z-]*)(?: [a-z][a-z-]*)*)`)
+
+func TestCIPipelineCommands(t *testing.T) {
+	config := &ci.Config{
+		AppDir:    "deploy",
+		Branch:    "main",
+		CheckEnvs: []string{"dev"},
+		ApplyEnvs: []string{"prod"},
+	}
+
+	for _, provider := range ci.Providers {
+		file, err := ci.Generate(provider, config)
+		if err != nil {
+			t.Fatalf("Failed to generate %s pipeline:\n%v", provider, err)
+		}
+
+		matches := ksCommand.FindAllStringSubmatch(string(file.Data), -1)
+		if len(matches) == 0 {
+			t.Errorf("Expected the %s pipeline to run ks commands", provider)
+		}
+		for _, match := range matches {
+			c, _, err := RootCmd.Find(strings.Fields(match[1]))
+			if err != nil || c == RootCmd {
+				t.Errorf("Expected 'ks %s' in the %s pipeline to be a ks command, got error: %v", match[1], provider, err)
+			}
+		}
+	}
+}
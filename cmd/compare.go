@@ -0,0 +1,106 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+const (
+	flagField = "field"
+	flagKind  = "kind"
+)
+
+func init() {
+	RootCmd.AddCommand(compareCmd)
+	addEnvCmdFlags(compareCmd)
+	bindJsonnetFlags(compareCmd)
+	compareCmd.PersistentFlags().StringArray(flagField, nil, "Path of a field to compare, e.g., 'spec.replicas' (may be repeated)")
+	compareCmd.PersistentFlags().String(flagKind, "", "Only compare objects of this kind, e.g., 'Deployment'")
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <env-name> [<env-name>...] --field <path>",
+	Short: "Compare fields of the objects rendered for several environments",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("'compare' requires the names of one or more environments")
+		}
+
+		flags := cmd.Flags()
+		var err error
+
+		c := kubecfg.CompareCmd{}
+
+		c.Fields, err = flags.GetStringArray(flagField)
+		if err != nil {
+			return err
+		}
+		if len(c.Fields) == 0 {
+			return fmt.Errorf("'compare' requires at least one '--%s'", flagField)
+		}
+
+		c.Kind, err = flags.GetString(flagKind)
+		if err != nil {
+			return err
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		wd := metadata.AbsPath(cwd)
+
+		rendered := [][]*unstructured.Unstructured{}
+		for _, arg := range args {
+			envSpec, err := parseEnvCmd(cmd, []string{arg})
+			if err != nil {
+				return err
+			}
+			objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+			if err != nil {
+				return err
+			}
+			rendered = append(rendered, objs)
+			c.Envs = append(c.Envs, *envSpec.env)
+		}
+
+		return c.Run(rendered, cmd.OutOrStdout())
+	},
+	Long: `Render each of the given environments locally, without contacting any
+cluster, and print a table of the values of the '--field' fields of the objects
+rendered, with a row for each object and field, and a column for each
+environment. This makes auditing the configuration of many environments a
+single command.
+
+Objects are matched across environments by their component, kind, and name.
+A field that an object does not set is shown as '<none>', and an object that an
+environment does not render as '<absent>'. Lists and maps are shown as JSON.`,
+	Example: `  # Compare the replica counts of the Deployments of three environments.
+  ks compare prod staging dev --field spec.replicas --kind Deployment
+
+  # Compare the images and replica counts of the components labeled
+  # 'tier: frontend' in 'app.yaml'.
+  ks compare prod staging --selector tier=frontend \
+    --field spec.replicas --field 'spec.template.spec.containers[0].image'`,
+}
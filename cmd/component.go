@@ -0,0 +1,120 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+func init() {
+	RootCmd.AddCommand(componentCmd)
+
+	componentCmd.AddCommand(componentCpCmd)
+	componentCmd.AddCommand(componentSplitCmd)
+}
+
+var componentCmd = &cobra.Command{
+	Use:   "component",
+	Short: "Manage ksonnet components",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("Command 'component' requires a subcommand\n\n%s", cmd.UsageString())
+	},
+	Long: `Manage the components of a ksonnet application. Components are the
+Jsonnet, JSON, and YAML files in the 'components/' directory, each of which
+describes some set of Kubernetes objects.`,
+}
+
+var componentCpCmd = &cobra.Command{
+	Use:   "cp <component-name> <new-component-name>",
+	Short: "Copy a component under a new name",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("'component cp' takes two arguments, the name of the component to copy and the name of the copy, respectively")
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manager, err := metadata.Find(metadata.AbsPath(cwd))
+		if err != nil {
+			return err
+		}
+
+		return manager.CopyComponent(args[0], args[1])
+	},
+	Long: `Copy the file that defines a component to a new file in the 'components/'
+directory, keeping its file type. This is useful when creating a variant of an
+existing component, such as a canary. Note that the contents are copied
+verbatim, so object names inside the new component will likely need to be
+changed before it is applied alongside the original.`,
+	Example: `  # Copy 'components/guestbook.jsonnet' to
+  # 'components/guestbook-canary.jsonnet'.
+  ks component cp guestbook guestbook-canary`,
+}
+
+var componentSplitCmd = &cobra.Command{
+	Use:   "split <component-name> <env-name>",
+	Short: "Split a component into one component per object",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("'component split' takes two arguments, the name of the component to split and the name of the environment to render it in, respectively")
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manager, err := metadata.Find(metadata.AbsPath(cwd))
+		if err != nil {
+			return err
+		}
+
+		c := kubecfg.ComponentSplitCmd{Component: args[0], Env: resolveEnvName(manager, args[1]), Manager: manager}
+		return c.Run()
+	},
+	Long: `Split a component that describes many Kubernetes objects into one component
+per object, replacing the original. This helps break up large, monolithic
+components into pieces that can be reviewed and changed independently.
+
+The component must be Jsonnet (or JSON) that evaluates to an array or object
+literal, optionally after some 'local' definitions. Each element of the array,
+or field of the object, becomes a component of its own, named
+'<component>-<kind>-<object-name>' after the object it renders to in the
+environment 'env-name' (or '<component>-<field>' if it renders to several).
+The source of each element is kept as it is. The locals are moved to
+'lib/<component>.libsonnet', which every new component imports, so values
+shared between objects stay shared.
+
+Splitting is refused if the pieces do not render the same objects as the
+component does in 'env-name' (e.g., because a piece refers to 'self'), or if
+the component is overridden in an environment's '.jsonnet' file or in
+'environments/base.libsonnet', or mapped to a namespace or cluster, or targeted
+by an environment, since those settings would no longer apply. Settings of the
+component in 'app.yaml' do not carry over either; a warning is printed.
+
+YAML components must be converted to Jsonnet with 'ks convert' first.`,
+	Example: `  # Replace 'components/guestbook.jsonnet' with a component for each of the
+  # objects it describes, e.g.,
+  # 'components/guestbook-service-guestbook-ui.jsonnet', named after the
+  # objects rendered in the 'dev' environment.
+  ks component split guestbook dev`,
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+const flagComponent = "component"
+
+func init() {
+	RootCmd.AddCommand(convertCmd)
+	convertCmd.PersistentFlags().String(flagComponent, "", "Write the Jsonnet to 'components/<name>.jsonnet' instead of stdout")
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert <file>",
+	Short: "Convert YAML or JSON manifests to Jsonnet",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("'convert' takes a single argument, that is the file to convert")
+		}
+
+		var err error
+		c := kubecfg.ConvertCmd{}
+
+		c.Component, err = cmd.Flags().GetString(flagComponent)
+		if err != nil {
+			return err
+		}
+
+		if c.Component != "" {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			c.Manager, err = metadata.Find(metadata.AbsPath(cwd))
+			if err != nil {
+				return fmt.Errorf("'convert --%s' can only be run in a ksonnet application directory:\n\n%v", flagComponent, err)
+			}
+		}
+
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		return c.Run(data, cmd.OutOrStdout())
+	},
+	Long: `Convert Kubernetes objects described in a YAML or JSON file (which may
+contain several YAML documents) to Jsonnet, to ease moving existing manifests
+into a ksonnet application.
+
+Objects of well-known kinds (e.g., 'Deployment' or 'Service') are converted to
+an object literal, with the name, namespace, and labels set through the
+ksonnet-lib mixins for their kind. Objects of other kinds are converted to plain
+object literals.`,
+	Example: `  # Print the Jsonnet equivalent of 'deployment.yaml'.
+  ks convert deployment.yaml
+
+  # Convert 'deployment.yaml', and write the result to the component
+  # 'components/nginx.jsonnet'.
+  ks convert deployment.yaml --component=nginx`,
+}
@@ -18,8 +18,13 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/ksonnet/ksonnet/metadata"
 	"github.com/ksonnet/ksonnet/pkg/kubecfg"
@@ -35,6 +40,8 @@ func init() {
 	bindClientGoFlags(deleteCmd)
 	bindJsonnetFlags(deleteCmd)
 	deleteCmd.PersistentFlags().Int64(flagGracePeriod, -1, "Number of seconds given to resources to terminate gracefully. A negative value is ignored")
+	deleteCmd.PersistentFlags().Bool(flagConfirm, false, "Delete from a protected environment without asking for confirmation")
+	deleteCmd.PersistentFlags().BoolP(flagYes, flagYesShort, false, "Do not list the objects to be deleted and ask for confirmation")
 }
 
 var deleteCmd = &cobra.Command{
@@ -66,6 +73,35 @@ var deleteCmd = &cobra.Command{
 			return err
 		}
 
+		if err := checkProtected(cmd, envSpec.env, "delete objects from"); err != nil {
+			return err
+		}
+
+		yes, err := flags.GetBool(flagYes)
+		if err != nil {
+			return err
+		}
+		if !yes {
+			c.Confirm = func(live []*unstructured.Unstructured) (bool, error) {
+				if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+					return false, fmt.Errorf("Refusing to delete %d objects without confirmation; pass --%s to delete them", len(live), flagYes)
+				}
+				out := cmd.OutOrStderr()
+				fmt.Fprintln(out, "The following objects will be deleted:")
+				if err := kubecfg.WriteDeletePreview(out, live, time.Now()); err != nil {
+					return false, err
+				}
+				return confirm(os.Stdin, out, fmt.Sprintf("Delete %d objects?", len(live)))
+			}
+		}
+
+		clusters, err := envClusters(envSpec.env, wd)
+		if err != nil {
+			return err
+		} else if clusters != nil {
+			return deleteFromClusters(cmd, c, *envSpec.env, clusters, envSpec, wd)
+		}
+
 		c.ClientPool, c.Discovery, err = restClientPool(cmd, envSpec.env)
 		if err != nil {
 			return err
@@ -76,22 +112,64 @@ var deleteCmd = &cobra.Command{
 			return err
 		}
 
+		envSpec.discovery = c.Discovery
 		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
 		if err != nil {
 			return err
 		}
 
-		return c.Run(objs)
+		hooks := kubecfg.HookCmd{ClientPool: c.ClientPool, Discovery: c.Discovery, Namespace: c.Namespace}
+		hooksRun := false
+		c.BeforeDelete = func() error {
+			// The hooks run once, even if objects are deleted from several
+			// clusters.
+			if hooksRun {
+				return nil
+			}
+			hooksRun = true
+			return runHooks(cmd, hooks, envSpec.env, metadata.HookPreDelete, false, wd)
+		}
+
+		groups, err := groupByComponentServer(envSpec.env, objs, wd)
+		if err != nil {
+			return err
+		}
+		if err := c.Run(groups[""]); err != nil {
+			return err
+		}
+		return deleteFromComponentServers(cmd, c, envSpec.env, groups, wd)
 	},
 	Long: `Delete Kubernetes resources from a cluster, as described in the local
 configuration.
 
 ksonnet applications are accepted, as well as normal JSON, YAML, and Jsonnet
-files.`,
+files.
+
+Only the objects that exist in the cluster are deleted. Objects rendered from a
+component are only deleted if the live object carries the same
+'ksonnet.io/component' label, i.e., if ksonnet created it; others that happen
+to have the same name are left alone, with a warning.
+
+Before anything is deleted, the live objects that are about to be deleted are
+listed, with their kind, namespace, and age, and confirmation is asked for.
+Pass '--yes' to skip this, e.g., in scripts, where 'delete' otherwise refuses
+to delete anything.
+
+The environment's 'preDelete' hooks (see 'ks apply --help') run once the
+deletion is confirmed, before any object is deleted.
+
+The objects of components that the environment deploys to other clusters (see
+'ks env set --help') are deleted from those clusters, after those of the
+environment's own cluster; confirmation is asked for each cluster. Likewise, the
+objects of an environment that selects its clusters from the cluster inventory
+are deleted from each of them in turn.`,
 	Example: `  # Delete all resources described in a ksonnet application, from the 'dev'
   # environment. Can be used in any subdirectory of the application.
   ks delete dev
 
+  # Delete all resources of the 'dev' environment without asking, e.g., in CI.
+  ks delete dev --yes
+
   # Delete resources described in a YAML file. Automatically picks up the
   # cluster's location from '$KUBECONFIG'.
   ks delete -f ./pod.yaml
@@ -100,7 +178,106 @@ files.`,
   # be used in any subdirectory of the application.
   ks delete dev -f ./pod.json
 
+  # Delete only the objects of the 'dev' environment labeled 'app: guestbook'.
+  ks delete dev -l app=guestbook
+
   # Delete resources described in a YAML file, and running in the cluster
   # specified by the current context in specified kubeconfig file.
   ks delete --kubeconfig=./kubeconfig -f ./pod.yaml`,
 }
+
+// deleteFromClusters deletes the objects described by `envSpec` from each of
+// `clusters`, which the environment `env` selects from the cluster inventory,
+// using the settings in `c`. Every cluster is attempted even if an earlier one
+// fails.
+func deleteFromClusters(cmd *cobra.Command, c kubecfg.DeleteCmd, env string, clusters []*metadata.Cluster, envSpec *envSpec, wd metadata.AbsPath) error {
+	objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+	if err != nil {
+		return err
+	}
+	if servers, err := componentServers(&env, wd); err != nil {
+		return err
+	} else if len(servers) > 0 {
+		return fmt.Errorf("Environment '%s' maps components to clusters, which is not supported with a cluster selector", env)
+	}
+
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return err
+	}
+	e, err := manager.GetEnvironment(env)
+	if err != nil {
+		return err
+	}
+	_, namespace, err := manager.ExpandDestination(e)
+	if err != nil {
+		return err
+	}
+
+	// Job hooks need a single cluster, so only commands can be run here, and
+	// they run once, before the first deletion.
+	hooksRun := false
+	c.BeforeDelete = func() error {
+		if hooksRun {
+			return nil
+		}
+		hooksRun = true
+		return runHooks(cmd, kubecfg.HookCmd{}, &env, metadata.HookPreDelete, false, wd)
+	}
+
+	failed := []string{}
+	for _, cluster := range clusters {
+		log.Infof("Deleting environment '%s' from cluster '%s' at %s", env, cluster.Name, cluster.URI)
+		c.ClientPool, c.Discovery, c.Namespace, err = clusterClients(cmd, e.Name, cluster.URI, namespace, wd)
+		if err == nil {
+			err = c.Run(objs)
+		}
+		if err != nil {
+			log.Errorf("Failed to delete environment '%s' from cluster '%s':\n%v", env, cluster.Name, err)
+			failed = append(failed, cluster.Name)
+		}
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to delete environment '%s' from %d of %d cluster(s): %s", env, len(failed), len(clusters), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// deleteFromComponentServers deletes the objects in `groups` of the components
+// that the environment `env` deploys to clusters other than its own, from
+// those clusters, using the settings in `c`.
+func deleteFromComponentServers(cmd *cobra.Command, c kubecfg.DeleteCmd, env *string, groups map[string][]*unstructured.Unstructured, wd metadata.AbsPath) error {
+	uris := componentServerURIs(groups)
+	if len(uris) == 0 {
+		return nil
+	}
+
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return err
+	}
+	e, err := manager.GetEnvironment(*env)
+	if err != nil {
+		return err
+	}
+	_, namespace, err := manager.ExpandDestination(e)
+	if err != nil {
+		return err
+	}
+
+	for _, uri := range uris {
+		log.Infof("Deleting %d object(s) of environment '%s' from the cluster at %s", len(groups[uri]), e.Name, uri)
+		var restore func()
+		c.ClientPool, c.Discovery, c.Namespace, restore, err = componentServerClients(cmd, uri, namespace)
+		if err != nil {
+			return err
+		}
+		err = c.Run(groups[uri])
+		restore()
+		if err != nil {
+			return fmt.Errorf("Failed to delete objects of environment '%s' from the cluster at %s:\n%v", e.Name, uri, err)
+		}
+	}
+	return nil
+}
@@ -19,28 +19,36 @@ import (
 	"fmt"
 	"os"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/ksonnet/ksonnet/metadata"
 	"github.com/ksonnet/ksonnet/pkg/kubecfg"
 )
 
-const flagDiffStrategy = "diff-strategy"
+const (
+	flagDiffStrategy = "diff-strategy"
+	flagColor        = "color"
+	flagDiffTheme    = "diff-theme"
+)
 
 func init() {
 	addEnvCmdFlags(diffCmd)
 	bindClientGoFlags(diffCmd)
 	bindJsonnetFlags(diffCmd)
 	diffCmd.PersistentFlags().String(flagDiffStrategy, "all", "Diff strategy, all or subset.")
+	diffCmd.PersistentFlags().String(flagColor, kubecfg.ColorAuto, "When to color the diff: auto, always, or never")
+	diffCmd.PersistentFlags().String(flagDiffTheme, kubecfg.DefaultDiffTheme, "Colors of the diff: dark, light, or a list of '<role>=<color>' pairs")
 	RootCmd.AddCommand(diffCmd)
 }
 
 var diffCmd = &cobra.Command{
-	Use:   "diff [env-name] [-f <file-or-dir>]",
+	Use:   "diff [env-name [other-env-name]] [-f <file-or-dir>]",
 	Short: "Display differences between server and local config",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
-			return fmt.Errorf("'diff' takes at most a single argument, that is the name of the environment")
+	RunE: forEachEnvironment(false, func(cmd *cobra.Command, args []string) error {
+		if len(args) > 2 {
+			return fmt.Errorf("'diff' takes at most two arguments, that are the names of the environments")
 		}
 
 		flags := cmd.Flags()
@@ -53,12 +61,35 @@ var diffCmd = &cobra.Command{
 			return err
 		}
 
+		colorMode, err := flags.GetString(flagColor)
+		if err != nil {
+			return err
+		}
+		color, err := kubecfg.UseColor(colorMode, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+		if color {
+			themeSpec, err := flags.GetString(flagDiffTheme)
+			if err != nil {
+				return err
+			}
+			c.Theme, err = kubecfg.ParseDiffTheme(themeSpec)
+			if err != nil {
+				return err
+			}
+		}
+
 		cwd, err := os.Getwd()
 		if err != nil {
 			return err
 		}
 		wd := metadata.AbsPath(cwd)
 
+		if len(args) == 2 {
+			return diffEnvs(cmd, args, c.Theme, wd)
+		}
+
 		envSpec, err := parseEnvCmd(cmd, args)
 		if err != nil {
 			return err
@@ -74,17 +105,54 @@ var diffCmd = &cobra.Command{
 			return err
 		}
 
+		envSpec.discovery = c.Discovery
 		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
 		if err != nil {
 			return err
 		}
 
-		return c.Run(objs, cmd.OutOrStdout())
-	},
+		c.Components, err = componentSpecs(wd)
+		if err != nil {
+			return err
+		}
+
+		groups, err := groupByComponentServer(envSpec.env, objs, wd)
+		if err != nil {
+			return err
+		}
+		return diffComponentServers(cmd, c, envSpec.env, groups, wd)
+	}),
 	Long: `Display differences between server and local configuration.
 
 ksonnet applications are accepted, as well as normal JSON, YAML, and Jsonnet
-files.`,
+files.
+
+Given two environments, the objects rendered for each are compared instead,
+without contacting any cluster. Objects are matched by their API group, kind,
+namespace, and name, and listed in that order; objects that set no namespace
+are matched with each other, even if the environments' default namespaces
+differ.
+
+Objects annotated with 'ksonnet.io/skip-diff: "true"', and the objects of
+components with 'skipDiff: true' in 'app.yaml', are not compared; the objects
+skipped are listed at the end.
+
+By default the diff is colored only when written to a terminal, and never when
+the 'NO_COLOR' environment variable is set; use '--color' to override this.
+Within a modified line, the words that changed are highlighted.
+
+The colors are chosen with '--diff-theme': 'dark' (the default) suits terminals
+with a dark background, and 'light' those with a light one. A custom palette is
+a comma-separated list of '<role>=<color>' pairs overriding the dark theme,
+where each role is one of 'header', 'added', 'deleted', 'added-word', or
+'deleted-word', and each color is an ANSI SGR code such as '34' (blue text) or
+'1;97;44' (bold white text on blue).
+
+Given a glob pattern of environment names instead (e.g., 'dev-*'), each
+matching environment is compared with its cluster in turn. The outcome for
+each environment is reported at the end; the exit status is that of a failure
+if any comparison failed, or else that of a difference if any environment
+differs.`,
 	Example: `  # Show diff between resources described in a local ksonnet application and
   # the cluster referenced by the 'dev' environment. Can be used in any
   # subdirectory of the application.
@@ -98,7 +166,113 @@ files.`,
   # referenced by the environment 'dev'.
   ks diff dev -f ./pod.json
 
+  # Show diff between the components of the 'dev' environment that are not
+  # labeled 'stateful' in 'app.yaml', and the cluster.
+  ks diff dev --selector '!stateful'
+
+  # Show diff between the rendered objects of the 'dev' environment labeled
+  # 'app: guestbook', and the cluster.
+  ks diff dev -l app=guestbook
+
   # Show diff between resources described in a YAML file and the cluster
   # referred to by './kubeconfig'.
-  ks diff --kubeconfig=./kubeconfig -f ./pod.yaml`,
+  ks diff --kubeconfig=./kubeconfig -f ./pod.yaml
+
+  # Show how the objects rendered for 'staging' differ from those rendered for
+  # 'dev'.
+  ks diff dev staging
+
+  # Show a diff colored for a light terminal background.
+  ks diff dev --diff-theme=light
+
+  # Show a diff with blue additions and yellow deletions.
+  ks diff dev --diff-theme=added=34,deleted=33
+
+  # Show diff between every 'us-west' environment and its cluster.
+  ks diff 'us-west/*'`,
+}
+
+// diffComponentServers compares the objects in `groups` with the clusters
+// they are deployed to: those under the empty string with the cluster that
+// `c` is connected to, and the rest with the clusters that the environment
+// `env` deploys their components to. Every cluster is compared, even if an
+// earlier one differs.
+func diffComponentServers(cmd *cobra.Command, c kubecfg.DiffCmd, env *string, groups map[string][]*unstructured.Unstructured, wd metadata.AbsPath) error {
+	out := cmd.OutOrStdout()
+	diffFound := false
+	if err := c.Run(groups[""], out); err == kubecfg.ErrDiffFound {
+		diffFound = true
+	} else if err != nil {
+		return err
+	}
+
+	uris := componentServerURIs(groups)
+	if len(uris) > 0 {
+		manager, err := metadata.Find(wd)
+		if err != nil {
+			return err
+		}
+		e, err := manager.GetEnvironment(*env)
+		if err != nil {
+			return err
+		}
+		_, namespace, err := manager.ExpandDestination(e)
+		if err != nil {
+			return err
+		}
+
+		for _, uri := range uris {
+			log.Infof("Comparing %d object(s) of environment '%s' with the cluster at %s", len(groups[uri]), e.Name, uri)
+			var restore func()
+			c.ClientPool, c.Discovery, c.Namespace, restore, err = componentServerClients(cmd, uri, namespace)
+			if err != nil {
+				return err
+			}
+			err = c.Run(groups[uri], out)
+			restore()
+			if err == kubecfg.ErrDiffFound {
+				diffFound = true
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	if diffFound {
+		return kubecfg.ErrDiffFound
+	}
+	return nil
+}
+
+// diffEnvs renders the two environments named by `args`, and compares the
+// results.
+func diffEnvs(cmd *cobra.Command, args []string, theme *kubecfg.DiffTheme, wd metadata.AbsPath) error {
+	if files, err := cmd.Flags().GetStringArray(flagFile); err != nil {
+		return err
+	} else if len(files) > 0 {
+		return fmt.Errorf("'diff' compares either two environments, or objects with a cluster; '--%s' cannot be used with two environments", flagFile)
+	}
+
+	rendered := [][]*unstructured.Unstructured{}
+	names := []string{}
+	for _, arg := range args {
+		envSpec, err := parseEnvCmd(cmd, []string{arg})
+		if err != nil {
+			return err
+		}
+		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+		if err != nil {
+			return err
+		}
+		rendered = append(rendered, objs)
+		names = append(names, *envSpec.env)
+	}
+
+	components, err := componentSpecs(wd)
+	if err != nil {
+		return err
+	}
+
+	c := kubecfg.DiffEnvsCmd{From: names[0], To: names[1], Theme: theme, Components: components}
+	return c.Run(rendered[0], rendered[1], cmd.OutOrStdout())
 }
@@ -0,0 +1,147 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+const (
+	flagWatch       = "watch"
+	flagInterval    = "interval"
+	flagWebhook     = "webhook"
+	flagMetricsAddr = "metrics-addr"
+)
+
+func init() {
+	addEnvCmdFlags(driftCmd)
+	bindClientGoFlags(driftCmd)
+	bindJsonnetFlags(driftCmd)
+	driftCmd.PersistentFlags().String(flagDiffStrategy, "subset", "Diff strategy, all or subset.")
+	driftCmd.PersistentFlags().Bool(flagWatch, false, "Keep checking for drift until interrupted")
+	driftCmd.PersistentFlags().Duration(flagInterval, 5*time.Minute, "Time between checks, with --"+flagWatch)
+	driftCmd.PersistentFlags().String(flagWebhook, "", "POST drift events as JSON to this URL")
+	driftCmd.PersistentFlags().String(flagMetricsAddr, "", "Serve Prometheus metrics at this address (e.g., ':9102'), with --"+flagWatch)
+	RootCmd.AddCommand(driftCmd)
+}
+
+var driftCmd = &cobra.Command{
+	Use:   "drift [env-name] [-f <file-or-dir>]",
+	Short: "Detect when live cluster state drifts from local config",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return fmt.Errorf("'drift' takes at most a single argument, that is the name of the environment")
+		}
+
+		flags := cmd.Flags()
+		var err error
+
+		c := kubecfg.DriftCmd{}
+
+		c.DiffStrategy, err = flags.GetString(flagDiffStrategy)
+		if err != nil {
+			return err
+		}
+
+		watch, err := flags.GetBool(flagWatch)
+		if err != nil {
+			return err
+		}
+		if watch {
+			c.Interval, err = flags.GetDuration(flagInterval)
+			if err != nil {
+				return err
+			} else if c.Interval <= 0 {
+				return fmt.Errorf("Flag '--%s' must be positive", flagInterval)
+			}
+
+			c.MetricsAddr, err = flags.GetString(flagMetricsAddr)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.Webhook, err = flags.GetString(flagWebhook)
+		if err != nil {
+			return err
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		wd := metadata.AbsPath(cwd)
+
+		envSpec, err := parseEnvCmd(cmd, args)
+		if err != nil {
+			return err
+		}
+		if envSpec.env != nil {
+			c.Env = *envSpec.env
+		}
+
+		c.ClientPool, c.Discovery, err = restClientPool(cmd, envSpec.env)
+		if err != nil {
+			return err
+		}
+
+		c.Namespace, err = namespace()
+		if err != nil {
+			return err
+		}
+
+		envSpec.discovery = c.Discovery
+		c.Render = func() ([]*unstructured.Unstructured, error) {
+			return expandEnvCmdObjs(cmd, envSpec, wd)
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		return c.Run(ctx, cmd.OutOrStdout())
+	},
+	Long: `Compare local configuration to the live state of the cluster, and report
+each object that is missing from the cluster or differs from the config as a
+JSON event on standard output. Unlike 'diff', 'drift' only reports which
+objects have drifted, and by default ignores fields that are set by the server
+but absent from the config (i.e., '--diff-strategy=subset').
+
+With '--watch', 'drift' keeps running, re-rendering the config and checking the
+cluster every '--interval'. Events are only emitted when an object's status
+changes: when it first drifts ('missing' or 'modified'), and when it matches
+the config again ('resolved'). Events can also be POSTed to a '--webhook', and
+the number of drifted objects served as a Prometheus metric at
+'--metrics-addr'.
+
+Without '--watch', 'drift' exits with status 10 if any object has drifted.`,
+	Example: `  # Check once whether the cluster referenced by the 'dev' environment has
+  # drifted from the local ksonnet application.
+  ks drift dev
+
+  # Check every 10 minutes, reporting drift to a webhook and serving metrics
+  # on port 9102.
+  ks drift dev --watch --interval=10m \
+    --webhook=https://example.com/hooks/drift \
+    --metrics-addr=:9102`,
+}
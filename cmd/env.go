@@ -18,17 +18,48 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/ksonnet/ksonnet/metadata"
 	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+	"github.com/ksonnet/ksonnet/utils"
 )
 
 const (
 	flagEnvName      = "name"
 	flagEnvURI       = "uri"
 	flagEnvNamespace = "namespace"
+	flagEnvSelector  = "cluster-selector"
+	flagEnvContext   = "kube-context"
+	flagEnvInherits  = "inherits"
+	flagPinLibrary   = "pin-library"
+	flagEnvLibPath   = "lib-path"
+	flagCompNs       = "component-namespace"
+	flagCompServer   = "component-server"
+	flagEnvLabel     = "label"
+	flagEnvAnnot     = "annotation"
+	flagEnvValidate  = "validate"
+	flagK8sVersion   = "k8s-version"
+
+	flagFromKubeconfig = "from-kubeconfig"
+	flagAllContexts    = "all"
+
+	flagDeleteObjects = "delete-objects"
+	flagClearTargets  = "clear"
+	flagClearAliases  = "clear"
+	flagUnprotect     = "off"
+	flagRestore       = "restore"
+	flagTree          = "tree"
+	flagArchived      = "archived"
+
+	flagFromTerraform            = "from-terraform"
+	flagTerraformOutput          = "output"
+	flagTerraformNamespaceOutput = "namespace-output"
+	flagTerraformVersionOutput   = "version-output"
 )
 
 func init() {
@@ -36,22 +67,122 @@ func init() {
 	bindClientGoFlags(envCmd)
 
 	envCmd.AddCommand(envAddCmd)
+	envCmd.AddCommand(envApplyCmd)
 	envCmd.AddCommand(envRmCmd)
+	envCmd.AddCommand(envCpCmd)
+	envCmd.AddCommand(envUpdateCmd)
+	envCmd.AddCommand(envTargetsCmd)
+	envCmd.AddCommand(envAliasCmd)
+	envCmd.AddCommand(envProtectCmd)
+	envCmd.AddCommand(envArchiveCmd)
+	envCmd.AddCommand(envImportCmd)
 	envCmd.AddCommand(envListCmd)
 	envCmd.AddCommand(envSetCmd)
+	envCmd.AddCommand(envSyncCmd)
 
 	// TODO: We need to make this default to checking the `kubeconfig` file.
 	envAddCmd.PersistentFlags().String(flagAPISpec, "version:v1.7.0",
 		"Manually specify API version from OpenAPI schema, cluster, or Kubernetes version")
 	envAddCmd.PersistentFlags().String(flagEnvNamespace, "",
 		"Specify namespace that the environment cluster should use")
+	envAddCmd.PersistentFlags().String(flagEnvInherits, "",
+		"Specify an existing environment whose overrides the new environment extends")
+	envAddCmd.PersistentFlags().String(flagEnvContext, "",
+		"Deploy the environment with this kubeconfig context, rather than by its URI; <env-uri> then defaults to the server of the context's cluster")
+	envAddCmd.PersistentFlags().Bool(flagDryRun, false,
+		"Print the files that would be created, without retrieving the API specification or writing anything")
+	envAddCmd.PersistentFlags().Bool(flagEnvValidate, false,
+		"Check that the cluster is reachable with the credentials in kubeconfig, and runs the Kubernetes version of --"+flagAPISpec+", before adding the environment")
+	envAddCmd.PersistentFlags().String(flagFromTerraform, "",
+		"Read the environment URI (and optionally namespace and Kubernetes version) from this Terraform state or 'terraform output -json' file")
+	envAddCmd.PersistentFlags().String(flagTerraformOutput, "cluster_endpoint",
+		"With --"+flagFromTerraform+", the Terraform output holding the cluster URI")
+	envAddCmd.PersistentFlags().String(flagTerraformNamespaceOutput, "",
+		"With --"+flagFromTerraform+", the Terraform output holding the namespace")
+	envAddCmd.PersistentFlags().String(flagTerraformVersionOutput, "",
+		"With --"+flagFromTerraform+", the Terraform output holding the Kubernetes version (e.g., '1.7.1'), used as the API spec")
+
+	envApplyCmd.PersistentFlags().StringP(flagFile, flagFileShort, "",
+		"The manifest (YAML or JSON) declaring the environments")
+	envApplyCmd.PersistentFlags().Bool(flagDryRun, false,
+		"Print the plan of the changes, without making them")
+	envApplyCmd.PersistentFlags().Bool(flagConfirm, false,
+		"Update protected environments without asking for confirmation")
+
+	envRmCmd.PersistentFlags().Bool(flagDeleteObjects, false,
+		"Delete the objects last applied to the environment from its cluster, before removing the environment")
+	envRmCmd.PersistentFlags().BoolP(flagYes, flagYesShort, false,
+		"With --"+flagDeleteObjects+", do not ask for confirmation before deleting objects")
+	envRmCmd.PersistentFlags().Bool(flagConfirm, false,
+		"Remove a protected environment without asking for confirmation")
+	envRmCmd.PersistentFlags().Int64(flagGracePeriod, -1,
+		"With --"+flagDeleteObjects+", the number of seconds given to objects to terminate gracefully. A negative value is ignored")
+
+	envCpCmd.PersistentFlags().String(flagEnvURI, "",
+		"Specify URI to point the copy at a different cluster")
+	envCpCmd.PersistentFlags().String(flagEnvNamespace, "",
+		"Specify namespace that the copy should use")
+
+	bindJsonnetFlags(envUpdateCmd)
+	envUpdateCmd.PersistentFlags().String(flagK8sVersion, "",
+		"Kubernetes version to generate ksonnet-lib for (e.g., 'v1.9.7'), or an API spec as in --"+flagAPISpec)
+
+	envImportCmd.PersistentFlags().Bool(flagFromKubeconfig, false,
+		"Import environments from the contexts of the kubeconfig file")
+	envImportCmd.PersistentFlags().Bool(flagAllContexts, false,
+		"Import every context of the kubeconfig file")
+	envImportCmd.PersistentFlags().String(flagAPISpec, "version:v1.7.0",
+		"API spec to use for clusters whose Kubernetes version cannot be discovered")
+
+	envTargetsCmd.PersistentFlags().Bool(flagClearTargets, false,
+		"Remove the environment's targets, so that it renders every component")
+
+	envAliasCmd.PersistentFlags().Bool(flagClearAliases, false,
+		"Remove every alias of the environment")
+
+	envProtectCmd.PersistentFlags().Bool(flagUnprotect, false,
+		"Remove the environment's protection")
+
+	envArchiveCmd.PersistentFlags().Bool(flagRestore, false,
+		"Restore the environment from the archive")
+	envArchiveCmd.PersistentFlags().Bool(flagConfirm, false,
+		"Archive a protected environment without asking for confirmation")
+
+	envListCmd.PersistentFlags().Bool(flagTree, false,
+		"Group nested environments (e.g., 'us-west/dev' and 'us-west/prod') under their common path")
+	envListCmd.PersistentFlags().StringP(flagLabelSel, flagLabelSelShort, "",
+		"Only list environments whose labels match this label selector (e.g., 'tier=prod')")
+	envListCmd.PersistentFlags().Bool(flagArchived, false,
+		"List the archived environments instead")
 
 	envSetCmd.PersistentFlags().String(flagEnvName, "",
 		"Specify name to rename environment to. Name must not already exist")
 	envSetCmd.PersistentFlags().String(flagEnvURI, "",
 		"Specify URI to point environment cluster to a new location")
 	envSetCmd.PersistentFlags().String(flagEnvNamespace, "",
-		"Specify namespace that the environment cluster should use")
+		"Specify namespace that the environment cluster should use. '--"+flagEnvNamespace+"=' removes it, so that the namespace of the kubeconfig context is used")
+	envSetCmd.PersistentFlags().String(flagEnvSelector, "",
+		"Specify a label selector over the cluster inventory ('clusters.yaml'); the environment is then applied to every matching cluster. '--"+flagEnvSelector+"=' removes it")
+	envSetCmd.PersistentFlags().String(flagEnvContext, "",
+		"Specify a kubeconfig context to deploy the environment with, instead of the kubeconfig cluster whose server is its URI. '--"+flagEnvContext+"=' removes it")
+	envSetCmd.PersistentFlags().StringSlice(flagPinLibrary, nil,
+		"Pin a vendored library to a directory, as <library>=<dir>; an empty <dir> removes the pin")
+	envSetCmd.PersistentFlags().StringArray(flagEnvLibPath, nil,
+		"Set the environment's extra Jsonnet library search paths (may be repeated); '--"+flagEnvLibPath+"=' removes them")
+	envSetCmd.PersistentFlags().StringSlice(flagCompNs, nil,
+		"Deploy a component to a namespace other than the environment's, as <component>=<namespace>; an empty <namespace> removes the mapping")
+	envSetCmd.PersistentFlags().StringSlice(flagCompServer, nil,
+		"Deploy a component to a cluster other than the environment's, as <component>=<uri>; an empty <uri> removes the mapping")
+	envSetCmd.PersistentFlags().StringSlice(flagExtVar, nil,
+		"Set an external variable of the environment's Jsonnet evaluations, as <name>=<value>; an empty <value> removes it")
+	envSetCmd.PersistentFlags().StringSlice(flagTlaVar, nil,
+		"Set a top-level argument of the environment's Jsonnet evaluations, as <name>=<value>; an empty <value> removes it")
+	envSetCmd.PersistentFlags().StringSlice(flagEnvLabel, nil,
+		"Label the environment, as <key>=<value>; an empty <value> removes the label")
+	envSetCmd.PersistentFlags().StringSlice(flagEnvAnnot, nil,
+		"Annotate the environment, as <key>=<value>; an empty <value> removes the annotation")
+	envSetCmd.PersistentFlags().Bool(flagConfirm, false,
+		"Change a protected environment without asking for confirmation")
 }
 
 var envCmd = &cobra.Command{
@@ -84,29 +215,68 @@ environments/
       k.libsonnet
       k8s.libsonnet
       swagger.json
-      spec.json      [This will contain the uri of the environment]`,
+      spec.json      [This will contain the uri of the environment]
+
+The URI and namespace of an environment may refer to variables as '${VAR}',
+e.g., 'https://${CLUSTER_HOST}'. They are expanded whenever the environment is
+deployed, from the process environment or, failing that, from the 'vars.yaml'
+file at the root of the application, so that cluster addresses need not be
+committed.
+
+Likewise, the token used to authenticate to an environment's cluster can come
+from a credential provider configured in 'app.yaml', instead of kubeconfig.
+Providers can be mixed across environments, and environments without an entry
+use the provider of the environment they inherit from:
+
+  credentials:
+    prod:
+      provider: exec       # Prints the token, or a client-go ExecCredential.
+      command: [vault, read, -field=token, secret/k8s/prod]
+    staging:
+      provider: keychain   # macOS keychain, or the Secret Service elsewhere.
+      service: k8s-staging
+    dev:
+      provider: env
+      variable: DEV_CLUSTER_TOKEN
+    gke:
+      provider: gcloud     # 'gcloud auth print-access-token'
+    eks:
+      provider: aws        # 'aws eks get-token'
+      cluster: prod
+      region: us-east-1
+
+A token given with '--token' takes precedence.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Command 'env' requires a subcommand\n\n%s", cmd.UsageString())
 	},
 }
 
 var envAddCmd = &cobra.Command{
-	Use:   "add <env-name> <env-uri>",
+	Use:   "add <env-name> [<env-uri>]",
 	Short: "Add a new environment to a ksonnet project",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		flags := cmd.Flags()
-		if len(args) != 2 {
-			return fmt.Errorf("'env add' takes two arguments, the name and the uri of the environment, respectively")
-		}
 
-		envName := args[0]
-		envURI := args[1]
+		tfPath, err := flags.GetString(flagFromTerraform)
+		if err != nil {
+			return err
+		}
 
-		envNamespace, err := flags.GetString(flagEnvNamespace)
+		kubeContext, err := flags.GetString(flagEnvContext)
 		if err != nil {
 			return err
 		}
 
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("'env add' takes two arguments, the name and the uri of the environment, respectively")
+		} else if tfPath != "" && len(args) != 1 {
+			return fmt.Errorf("'env add --%s' takes a single argument, that is the name of the environment", flagFromTerraform)
+		} else if tfPath != "" && kubeContext != "" {
+			return fmt.Errorf("'--%s' and '--%s' cannot be used together", flagFromTerraform, flagEnvContext)
+		}
+
+		envName := args[0]
+
 		appDir, err := os.Getwd()
 		if err != nil {
 			return err
@@ -118,17 +288,89 @@ var envAddCmd = &cobra.Command{
 			return err
 		}
 
+		defaults, err := manager.EnvironmentDefaults(envName)
+		if err != nil {
+			return err
+		}
+
+		envNamespace, err := flags.GetString(flagEnvNamespace)
+		if err != nil {
+			return err
+		}
+		if !flags.Changed(flagEnvNamespace) && defaults.Namespace != "" {
+			envNamespace = defaults.Namespace
+		}
+
 		specFlag, err := flags.GetString(flagAPISpec)
 		if err != nil {
 			return err
 		}
+		if !flags.Changed(flagAPISpec) && defaults.KubernetesVersion != "" {
+			specFlag = metadata.KubernetesVersionSpec(defaults.KubernetesVersion)
+		}
+
+		var envURI string
+		if tfPath != "" {
+			envURI, envNamespace, specFlag, err = envFromTerraform(flags, tfPath, envNamespace, specFlag)
+			if err != nil {
+				return err
+			}
+		} else if len(args) == 2 {
+			envURI = args[1]
+		} else if kubeContext != "" {
+			envURI, err = contextServer(kubeContext)
+			if err != nil {
+				return err
+			}
+		} else if defaults.Server != "" {
+			envURI = defaults.Server
+		} else {
+			return fmt.Errorf("'env add' takes two arguments, the name and the uri of the environment, respectively, unless '--%s' is given or 'app.yaml' sets a default server", flagEnvContext)
+		}
 
-		c, err := kubecfg.NewEnvAddCmd(envName, envURI, envNamespace, specFlag, manager)
+		dryRun, err := flags.GetBool(flagDryRun)
 		if err != nil {
 			return err
 		}
 
-		return c.Run()
+		inherits, err := flags.GetString(flagEnvInherits)
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewEnvAddCmd(envName, envURI, envNamespace, inherits, specFlag, dryRun, manager)
+		if err != nil {
+			return err
+		}
+		c.Context = kubeContext
+
+		validate, err := flags.GetBool(flagEnvValidate)
+		if err != nil {
+			return err
+		}
+		if validate {
+			uri, namespace, err := manager.ExpandDestination(&metadata.Environment{URI: envURI, Namespace: envNamespace})
+			if err != nil {
+				return err
+			}
+			if kubeContext != "" {
+				err = overrideClusterContext(kubeContext, namespace)
+			} else {
+				err = overrideClusterURI(uri, namespace)
+			}
+			if err != nil {
+				return err
+			}
+			c.ClientPool, c.Discovery, err = restClientPool(cmd, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		return c.Run(ctx, cmd.OutOrStdout())
 	},
 
 	Long: `Add a new environment to a ksonnet project. Names are restricted to not
@@ -155,7 +397,84 @@ environments/
       k.libsonnet
       k8s.libsonnet
       swagger.json
-      spec.json      [This will contain the uri of the environment]`,
+      spec.json      [This will contain the uri of the environment]
+
+With '--kube-context', the environment is deployed with a kubeconfig context,
+as with 'ks env set --kube-context', and '<env-uri>' defaults to the server of
+the context's cluster. Unless '--namespace' is given, the context's namespace
+is used.
+
+Clusters provisioned with Terraform can be added without copying their
+endpoints by hand: with '--from-terraform', the URI is read from a Terraform
+output (by default 'cluster_endpoint'), and only the environment name is given
+as an argument.
+
+Each environment has a '<env-name>.jsonnet' file, in which environment-specific
+overrides of the components are written. With '--inherits', the new environment
+extends an existing one instead: its '.jsonnet' file applies its overrides on
+top of those of the parent, so that (e.g.) 'us-east/prod' can inherit from
+'default' and only override what differs. Chains of any length are allowed;
+an environment cannot be removed while another inherits from it.
+
+The '.jsonnet' files of new environments can follow the conventions of the
+application (e.g., extra imports, or standard mixins): if
+'environments/.templates/override.jsonnet' exists (or the 'overrideTemplate'
+of 'environmentDefaults' in 'app.yaml' names another file), they are generated
+from it. The template is a Go template, in which '{{.Name}}' is the name of
+the new environment, '{{.Inherits}}' that of the environment it inherits from,
+and '{{.Base}}' the path of the file whose overrides it extends:
+
+  local base = import "{{.Base}}";
+  local mixins = import "mixins.libsonnet";
+
+  base + mixins.standard("{{.Name}}") + {
+  }
+
+Values that are not given are taken from the 'environmentDefaults' of
+'app.yaml', if any, so that environments created by different people are
+consistent. '{env}' stands for the name of the new environment, with slashes
+replaced by dashes:
+
+  environmentDefaults:
+    server: https://{env}.clusters.example.com   [Used when <env-uri> is omitted]
+    namespace: web                               [Used without '--namespace']
+    kubernetesVersion: v1.7.0                    [Used without '--api-spec']
+    overrideTemplate: templates/env.jsonnet      [See above]
+
+The API specification of a Kubernetes version (e.g., '--api-spec=version:v1.7.0')
+is retrieved from GitHub, retrying network and server errors. 'specSources' in
+'app.yaml' lists mirrors (e.g., an artifact store) to try first, in order, and
+the checksums the specifications must match; '{version}' stands for the
+Kubernetes version:
+
+  specSources:
+    mirrors:
+    - https://artifacts.example.com/kubernetes/{version}/swagger.json
+    retries: 3                                   [Per URL; defaults to 2]
+    checksums:
+      v1.7.0: <hex-encoded SHA-256 hash>
+    platforms:
+      openshift:
+      - https://artifacts.example.com/openshift/{version}/openapi.json
+
+Versions of Kubernetes platforms are mapped to the upstream release they are
+based on, e.g., 'version:1.27-gke.400' and 'version:v1.27.3-eks-a5565ad' to
+'v1.27.0' and 'v1.27.3', and the OpenShift release 'version:openshift-4.12' to
+'v1.25.0'. The specifications of a platform's own API groups (e.g., OpenShift's
+routes), listed in 'specSources.platforms', are merged into that of the
+upstream release; there, '{version}' stands for the platform's release (e.g.,
+'4.12'). Their checksums, if any, are keyed by URL.
+
+With '--dry-run', nothing is written; instead, the files that would be created
+are printed, so that automation creating environments can be reviewed. The API
+specification is not retrieved, so the generated ksonnet-lib files are listed
+without their contents.
+
+With '--validate', the cluster is probed before anything is written: 'env add'
+fails if no kubeconfig cluster has the environment's URI, if the cluster cannot
+be reached or rejects the credentials, or if it runs a different minor version
+of Kubernetes than the one given by '--api-spec' (e.g., 'version:v1.7.0' for a
+1.9 cluster). A namespace that does not exist yet is only reported.`,
 	Example: `  # Initialize a new staging environment at 'us-west'. Using the
 	# namespace 'my-namespace'. The directory structure rooted at 'us-west' in the
 	# documentation above will be generated.
@@ -167,7 +486,163 @@ environments/
 
   # Initialize a new development environment locally. This will overwrite the
   # default 'default' directory structure generated by 'ksonnet-init'.
-  ks env add default localhost:8000`,
+  ks env add default localhost:8000
+
+  # Initialize a production environment deployed with the kubeconfig context
+  # 'prod-admin', in the context's namespace.
+  ks env add prod --kube-context=prod-admin
+
+  # Initialize a new production environment from the 'cluster_endpoint' and
+  # 'k8s_version' outputs of a Terraform-provisioned cluster.
+  ks env add prod --from-terraform=./terraform.tfstate --version-output=k8s_version
+
+  # Initialize a production environment whose overrides are applied on top of
+  # those of the 'default' environment.
+  ks env add us-east/prod https://ksonnet-1.us-east.elb.amazonaws.com --inherits=default
+
+  # Initialize the environment 'qa' from the 'environmentDefaults' of
+  # 'app.yaml', e.g., at the URI 'https://qa.clusters.example.com'.
+  ks env add qa
+
+  # Print the files that adding the environment 'us-west/staging' would
+  # create, without creating them.
+  ks env add us-west/staging https://ksonnet-1.us-west.elb.amazonaws.com --dry-run
+
+  # Initialize the environment 'ocp' for an OpenShift 4.12 cluster, with the
+  # OpenShift API groups listed in 'specSources.platforms' of 'app.yaml'.
+  ks env add ocp https://api.ocp.example.com:6443 --api-spec=version:openshift-4.12
+
+  # Add the environment 'prod' only if its cluster is reachable and runs
+  # Kubernetes 1.9.
+  ks env add prod https://ksonnet-1.us-east.elb.amazonaws.com --api-spec=version:v1.9.7 --validate`,
+}
+
+var envApplyCmd = &cobra.Command{
+	Use:   "apply -f <manifest>",
+	Short: "Create or update many environments from a manifest",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if len(args) != 0 {
+			return fmt.Errorf("'env apply' takes no arguments; the environments are read from '--%s'", flagFile)
+		}
+
+		manifestPath, err := flags.GetString(flagFile)
+		if err != nil {
+			return err
+		}
+		if manifestPath == "" {
+			return fmt.Errorf("'env apply' requires a manifest, given with '--%s'", flagFile)
+		}
+
+		dryRun, err := flags.GetBool(flagDryRun)
+		if err != nil {
+			return err
+		}
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manager, err := metadata.Find(metadata.AbsPath(appDir))
+		if err != nil {
+			return err
+		}
+
+		manifest, err := kubecfg.ReadEnvManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewEnvApplyCmd(manifest, dryRun, manager)
+		if err != nil {
+			return err
+		}
+		c.Confirm = func(envName string) error {
+			return checkProtected(cmd, &envName, "update")
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		return c.Run(ctx, cmd.OutOrStdout())
+	},
+	Long: `Create or update many environments in one pass, from a manifest that
+declares them, so that (e.g.) the environments of every region are set up
+consistently:
+
+  environments:
+  - name: us-west/prod
+    server: https://prod.us-west.example.com
+    namespace: web
+    kubernetesVersion: v1.7.0
+    targets: [frontend, redis]
+  - name: us-west/canary
+    server: https://prod.us-west.example.com
+    namespace: web-canary
+    inherits: us-west/prod
+
+The plan of the changes is printed first: environments that do not exist are
+created, and those that do have their server, namespace, Kubernetes version
+(which regenerates their ksonnet-lib), and targets updated. Fields that are not
+set are left as they are or, for new environments, are taken from the
+'environmentDefaults' of 'app.yaml' (see 'ks env add'). Environments are
+created in the order of the manifest, so an environment must come after the one
+it inherits from. With '--dry-run', only the plan is printed. Updating a
+protected environment (see 'ks env protect') must be confirmed, before any
+environment is changed.`,
+	Example: `  # Print what applying 'envs.yaml' would change.
+  ks env apply -f envs.yaml --dry-run
+
+  # Create and update the environments declared in 'envs.yaml'.
+  ks env apply -f envs.yaml`,
+}
+
+// envFromTerraform reads the URI of a new environment, and optionally its
+// namespace and API spec, from the outputs in the Terraform state file at
+// `tfPath`. Values given explicitly by flags take precedence over the
+// corresponding Terraform outputs.
+func envFromTerraform(flags *pflag.FlagSet, tfPath, namespace, specFlag string) (uri, ns, spec string, err error) {
+	outputs, err := kubecfg.ReadTerraformOutputs(tfPath)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	uriOutput, err := flags.GetString(flagTerraformOutput)
+	if err != nil {
+		return "", "", "", err
+	}
+	uri, err = kubecfg.TerraformOutputString(outputs, uriOutput)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	namespaceOutput, err := flags.GetString(flagTerraformNamespaceOutput)
+	if err != nil {
+		return "", "", "", err
+	}
+	if namespaceOutput != "" && !flags.Changed(flagEnvNamespace) {
+		namespace, err = kubecfg.TerraformOutputString(outputs, namespaceOutput)
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+
+	versionOutput, err := flags.GetString(flagTerraformVersionOutput)
+	if err != nil {
+		return "", "", "", err
+	}
+	if versionOutput != "" && !flags.Changed(flagAPISpec) {
+		version, err := kubecfg.TerraformOutputString(outputs, versionOutput)
+		if err != nil {
+			return "", "", "", err
+		}
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+		specFlag = "version:" + version
+	}
+
+	return uri, namespace, specFlag, nil
 }
 
 var envRmCmd = &cobra.Command{
@@ -191,11 +666,42 @@ var envRmCmd = &cobra.Command{
 			return err
 		}
 
+		envName = resolveEnvName(manager, envName)
+		if err := checkProtected(cmd, &envName, "remove"); err != nil {
+			return err
+		}
+
 		c, err := kubecfg.NewEnvRmCmd(envName, manager)
 		if err != nil {
 			return err
 		}
 
+		flags := cmd.Flags()
+		deleteObjects, err := flags.GetBool(flagDeleteObjects)
+		if err != nil {
+			return err
+		}
+		if deleteObjects {
+			if c.Delete, err = envRmDeleteCmd(cmd, envName); err != nil {
+				return err
+			}
+
+			yes, err := flags.GetBool(flagYes)
+			if err != nil {
+				return err
+			}
+			if !yes {
+				c.Confirm = func(objs []*unstructured.Unstructured) (bool, error) {
+					out := cmd.OutOrStderr()
+					fmt.Fprintf(out, "The following objects will be deleted from the cluster of environment '%s':\n", envName)
+					for _, obj := range objs {
+						fmt.Fprintf(out, "  %s %s\n", obj.GetKind(), utils.FqName(obj))
+					}
+					return confirm(os.Stdin, out, fmt.Sprintf("Delete %d objects, and remove environment '%s'?", len(objs), envName))
+				}
+			}
+		}
+
 		return c.Run()
 	},
 	Long: `Delete an environment from a ksonnet project. This is the same
@@ -203,11 +709,399 @@ as removing the <env-name> environment directory and all files contained. If the
 project exists in a hierarchy (e.g., 'us-east/staging') and deleting the
 environment results in an empty environments directory (e.g., if deleting
 'us-east/staging' resulted in an empty 'us-east/' directory), then all empty
-parent directories are subsequently deleted.`,
+parent directories are subsequently deleted.
+
+By default, the objects running in the environment's cluster are left alone.
+With '--delete-objects', the objects recorded in the environment's most recent
+snapshot (i.e., those applied by the last 'ks apply') are first deleted from the
+cluster, so that removing an environment does not leave orphaned workloads
+running. 'env rm' lists the objects and asks for confirmation before deleting
+them, unless '--yes' is given.
+
+A protected environment (see 'ks env protect') is only removed after
+confirmation, or with '--confirm'.`,
 	Example: `  # Remove the directory 'us-west/staging' and all contents
   #	in the 'environments' directory. This will also remove the parent directory
   # 'us-west' if it is empty.
-  ks env rm us-west/staging`,
+  ks env rm us-west/staging
+
+  # Delete the objects last applied to 'us-west/staging' from its cluster
+  # (after asking for confirmation), then remove the environment.
+  ks env rm us-west/staging --delete-objects`,
+}
+
+// envRmDeleteCmd returns a command that deletes objects from the cluster of
+// the environment `envName`.
+func envRmDeleteCmd(cmd *cobra.Command, envName string) (*kubecfg.DeleteCmd, error) {
+	c := &kubecfg.DeleteCmd{}
+
+	var err error
+	c.GracePeriod, err = cmd.Flags().GetInt64(flagGracePeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ClientPool, c.Discovery, err = restClientPool(cmd, &envName)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Namespace, err = namespace()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+var envCpCmd = &cobra.Command{
+	Use:   "cp <env-name> <new-env-name>",
+	Short: "Copy an existing environment, including its overrides",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if len(args) != 2 {
+			return fmt.Errorf("'env cp' takes two arguments, the name of the environment to copy, and the name of the copy")
+		}
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		appRoot := metadata.AbsPath(appDir)
+
+		manager, err := metadata.Find(appRoot)
+		if err != nil {
+			return err
+		}
+
+		uri, err := flags.GetString(flagEnvURI)
+		if err != nil {
+			return err
+		}
+
+		namespace, err := flags.GetString(flagEnvNamespace)
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewEnvCpCmd(resolveEnvName(manager, args[0]), args[1], uri, namespace, manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run()
+	},
+	Long: `Create a new environment as a copy of an existing one. The copy gets the
+original's overrides (and any other files in its directory, such as
+'params.libsonnet'), its generated ksonnet-lib, and its 'spec.json', so it
+renders exactly like the original until either is changed. The copy inherits
+from the same environment as the original, if any.
+
+The cluster URI and namespace of the copy can be changed as it is made.
+Environments nested under the original (e.g., 'prod/canary' under 'prod') are
+not copied.`,
+	Example: `  # Create 'staging' as a copy of 'prod', deployed to the 'staging' namespace
+  # of the same cluster.
+  ks env cp prod staging --namespace=staging
+
+  # Copy 'us-west/prod' to a new cluster.
+  ks env cp us-west/prod us-east/prod --uri=https://us-east.example.com`,
+}
+
+var envUpdateCmd = &cobra.Command{
+	Use:   "update <env-name> --k8s-version <version>",
+	Short: "Upgrade the Kubernetes version of an environment",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if len(args) != 1 {
+			return fmt.Errorf("'env update' takes a single argument, the name of the environment")
+		}
+
+		version, err := flags.GetString(flagK8sVersion)
+		if err != nil {
+			return err
+		}
+		if version == "" {
+			return fmt.Errorf("'env update' requires '--%s'", flagK8sVersion)
+		}
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		wd := metadata.AbsPath(appDir)
+
+		manager, err := metadata.Find(wd)
+		if err != nil {
+			return err
+		}
+		envName := resolveEnvName(manager, args[0])
+
+		c, err := kubecfg.NewEnvUpdateCmd(envName, metadata.KubernetesVersionSpec(version), manager)
+		if err != nil {
+			return err
+		}
+		c.Render = func() ([]*unstructured.Unstructured, error) {
+			return expandEnvCmdObjs(cmd, &envSpec{env: &envName}, wd)
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		return c.Run(ctx, cmd.OutOrStdout())
+	},
+	Long: `Regenerate the ksonnet-lib of an environment for another version of
+Kubernetes, typically after its cluster has been upgraded, and record the
+version in the environment's 'spec.json'. The environment's overrides, and
+everything else in 'spec.json', are left alone.
+
+Once updated, the environment is rendered, and the objects that use APIs the
+new version deprecates (e.g., 'extensions/v1beta1' Deployments), or no longer
+serves, are listed, so that they can be migrated before the next apply.
+Objects of API groups that the new version's API specification does not
+describe, such as custom resources, are not checked.`,
+	Example: `  # Upgrade the 'prod' environment to Kubernetes 1.9.7, and list the objects
+  # using deprecated APIs.
+  ks env update prod --k8s-version=v1.9.7
+
+  # Regenerate the ksonnet-lib of 'dev' from the OpenAPI spec of a local file.
+  ks env update dev --k8s-version=file:swagger.json`,
+}
+
+var envImportCmd = &cobra.Command{
+	Use:   "import --from-kubeconfig [<context>[=<env-name>]...]",
+	Short: "Create environments from kubeconfig contexts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+
+		fromKubeconfig, err := flags.GetBool(flagFromKubeconfig)
+		if err != nil {
+			return err
+		} else if !fromKubeconfig {
+			return fmt.Errorf("'env import' requires a source of environments, e.g., '--%s'", flagFromKubeconfig)
+		}
+
+		all, err := flags.GetBool(flagAllContexts)
+		if err != nil {
+			return err
+		}
+
+		specFlag, err := flags.GetString(flagAPISpec)
+		if err != nil {
+			return err
+		}
+
+		rawConfig, err := clientConfig.RawConfig()
+		if err != nil {
+			return err
+		}
+
+		envs, err := kubecfg.KubeconfigEnvironments(&rawConfig, args, all)
+		if err != nil {
+			return err
+		}
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		appRoot := metadata.AbsPath(appDir)
+
+		manager, err := metadata.Find(appRoot)
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewEnvImportCmd(envs, manager)
+		if err != nil {
+			return err
+		}
+		c.DefaultSpec = specFlag
+		if !flags.Changed(flagAPISpec) {
+			c.DiscoverSpec = func(contextName string) (string, error) {
+				return kubecfg.ServerAPISpec(&rawConfig, contextName)
+			}
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		return c.Run(ctx)
+	},
+	Long: `Create an environment for each of the selected contexts of the kubeconfig
+file, pointing at the context's cluster and namespace. Each cluster is asked
+for its Kubernetes version, which determines the API specification used to
+generate the environment's ksonnet-lib; if a cluster cannot be reached, the
+'--api-spec' is used instead. Giving '--api-spec' explicitly skips discovery.
+
+Environments are named after their context, with characters that are not
+allowed in environment names (e.g., the ':' in EKS context names) replaced by
+'-'. Use '<context>=<env-name>' to choose a different name.`,
+	Example: `  # Create environments for the 'staging' and 'prod' contexts.
+  ks env import --from-kubeconfig staging prod
+
+  # Create the environment 'us-west/prod' from an EKS context.
+  ks env import --from-kubeconfig arn:aws:eks:us-west-2:123456789012:cluster/prod=us-west/prod
+
+  # Create an environment for every context in a team's kubeconfig file.
+  ks env import --from-kubeconfig --all --kubeconfig=./team-kubeconfig`,
+}
+
+var envTargetsCmd = &cobra.Command{
+	Use:   "targets <env-name> [<component>...]",
+	Short: "List or set the components an environment renders",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if len(args) < 1 {
+			return fmt.Errorf("'env targets' requires the name of an environment, optionally followed by the components to target")
+		}
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		appRoot := metadata.AbsPath(appDir)
+
+		manager, err := metadata.Find(appRoot)
+		if err != nil {
+			return err
+		}
+
+		clear, err := flags.GetBool(flagClearTargets)
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewEnvTargetsCmd(resolveEnvName(manager, args[0]), args[1:], clear, manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `Scope an environment to a subset of the application's components. Commands
+that render the environment (e.g., 'show', 'apply', 'diff', and 'delete') then
+only render the targeted components.
+
+A target is either the name of a component (e.g., 'redis'), or a directory in
+'components/' (e.g., 'backend'), which targets every component in it. Every
+target must match at least one component; a typo is reported, with a
+suggestion, rather than silently rendering nothing.
+
+With only an environment name, the environment's current targets are listed.
+Targets are stored in the environment's 'spec.json'.`,
+	Example: `  # Only deploy the frontend components, and redis, to 'dev'.
+  ks env targets dev frontend redis
+
+  # List the targets of 'dev'.
+  ks env targets dev
+
+  # Deploy every component to 'dev' again.
+  ks env targets dev --clear`,
+}
+
+var envAliasCmd = &cobra.Command{
+	Use:   "alias <env-name> [<alias>...]",
+	Short: "List or set the aliases of an environment",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if len(args) < 1 {
+			return fmt.Errorf("'env alias' requires the name of an environment, optionally followed by its aliases")
+		}
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		appRoot := metadata.AbsPath(appDir)
+
+		manager, err := metadata.Find(appRoot)
+		if err != nil {
+			return err
+		}
+
+		clear, err := flags.GetBool(flagClearAliases)
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewEnvAliasCmd(args[0], args[1:], clear, manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `Give an environment short alternative names. Any command that takes the name
+of an environment (e.g., 'show', 'apply', 'diff', and the 'env' subcommands)
+also accepts its aliases, which saves typing long hierarchical names on the
+command line and in CI scripts.
+
+An alias may be neither the name of another environment, nor an alias of one.
+Setting aliases replaces the environment's current aliases; with only an
+environment name, they are listed. Aliases are stored in the environment's
+'spec.json'.`,
+	Example: `  # Let 'prod' stand for 'us-east-1/production'.
+  ks env alias us-east-1/production prod
+
+  # Apply 'us-east-1/production'.
+  ks apply prod
+
+  # List the aliases of 'us-east-1/production'.
+  ks env alias prod
+
+  # Remove every alias of 'us-east-1/production'.
+  ks env alias us-east-1/production --clear`,
+}
+
+var envProtectCmd = &cobra.Command{
+	Use:   "protect <env-name>",
+	Short: "Require confirmation before changing or deleting what runs in an environment",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if len(args) != 1 {
+			return fmt.Errorf("'env protect' takes a single argument, that is the name of the environment")
+		}
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		appRoot := metadata.AbsPath(appDir)
+
+		manager, err := metadata.Find(appRoot)
+		if err != nil {
+			return err
+		}
+
+		off, err := flags.GetBool(flagUnprotect)
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewEnvProtectCmd(args[0], !off, manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run()
+	},
+	Long: `Protect an environment, such as production, against accidental changes. The
+destructive commands 'apply', 'delete', and 'env rm' refuse to operate on a
+protected environment unless '--confirm' is given or, when run on a terminal,
+the user confirms at a prompt. 'apply --dry-run' is not affected.
+
+Protection is stored in the environment's 'spec.json' as '"protected": true',
+so that it applies to everyone working on the application, not only to CI.`,
+	Example: `  # Require confirmation before applying to, deleting from, or removing
+  # 'us-east-1/production'.
+  ks env protect us-east-1/production
+
+  # Apply to it from a script.
+  ks apply us-east-1/production --confirm
+
+  # Remove the protection.
+  ks env protect us-east-1/production --off`,
 }
 
 var envListCmd = &cobra.Command{
@@ -234,9 +1128,101 @@ var envListCmd = &cobra.Command{
 			return err
 		}
 
+		c.Tree, err = cmd.Flags().GetBool(flagTree)
+		if err != nil {
+			return err
+		}
+
+		c.Selector, err = cmd.Flags().GetString(flagLabelSel)
+		if err != nil {
+			return err
+		}
+
+		c.Archived, err = cmd.Flags().GetBool(flagArchived)
+		if err != nil {
+			return err
+		}
+
 		return c.Run(cmd.OutOrStdout())
 	}, Long: `List all environments in a ksonnet project. This will
-display the name, URI, and namespace of each environment within the ksonnet project.`,
+display the name, URI, and namespace of each environment within the ksonnet project.
+
+With '--tree', nested environments are grouped under their common path, e.g.,
+'us-west/dev' and 'us-west/prod' are listed as 'dev' and 'prod' below
+'us-west/', which keeps applications with many environments navigable.
+
+With '--label-selector', only the environments whose labels (see 'ks env set
+--label') match the selector are listed.
+
+With '--archived', the names of the environments archived with 'ks env archive'
+are listed instead.`,
+	Example: `  # List every environment by its full name.
+  ks env list
+
+  # List environments grouped by path.
+  ks env list --tree
+
+  # List the production environments.
+  ks env list -l tier=prod
+
+  # List the archived environments.
+  ks env list --archived`,
+}
+
+var envArchiveCmd = &cobra.Command{
+	Use:   "archive <env-name>",
+	Short: "Set an environment aside, keeping its files so that it can be restored",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if len(args) != 1 {
+			return fmt.Errorf("'env archive' takes a single argument, that is the name of the environment")
+		}
+		envName := args[0]
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		appRoot := metadata.AbsPath(appDir)
+
+		manager, err := metadata.Find(appRoot)
+		if err != nil {
+			return err
+		}
+
+		restore, err := flags.GetBool(flagRestore)
+		if err != nil {
+			return err
+		}
+		if !restore {
+			if err := checkProtected(cmd, &envName, "archive"); err != nil {
+				return err
+			}
+		}
+
+		c, err := kubecfg.NewEnvArchiveCmd(envName, restore, manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run()
+	},
+	Long: `Archive an environment that is no longer in use, without losing its
+configuration. The environment's directory is moved, as it is, to
+'environments/.archive/<env-name>'. An archived environment is not listed by
+'ks env list', and commands such as 'show' and 'apply' refuse to use it. Nothing
+is deleted from the cluster.
+
+Use '--restore' to move it back, once no other environment has taken its name.
+'ks env list --archived' lists the archived environments.
+
+An environment that other environments inherit from, or that contains nested
+environments, cannot be archived on its own.`,
+	Example: `  # Archive 'us-west/staging'.
+  ks env archive us-west/staging
+
+  # Bring it back.
+  ks env archive us-west/staging --restore`,
 }
 
 var envSetCmd = &cobra.Command{
@@ -249,6 +1235,9 @@ var envSetCmd = &cobra.Command{
 		}
 
 		envName := args[0]
+		if err := checkProtected(cmd, &envName, "change"); err != nil {
+			return err
+		}
 
 		appDir, err := os.Getwd()
 		if err != nil {
@@ -276,16 +1265,145 @@ var envSetCmd = &cobra.Command{
 			return err
 		}
 
-		c, err := kubecfg.NewEnvSetCmd(envName, desiredEnvName, desiredEnvURI, desiredEnvNamespace, manager)
+		desiredEnvSelector, err := flags.GetString(flagEnvSelector)
+		if err != nil {
+			return err
+		}
+
+		desiredEnvContext, err := flags.GetString(flagEnvContext)
+		if err != nil {
+			return err
+		}
+
+		pins, err := flags.GetStringSlice(flagPinLibrary)
+		if err != nil {
+			return err
+		}
+
+		componentNamespaces, err := flags.GetStringSlice(flagCompNs)
+		if err != nil {
+			return err
+		}
+
+		componentServers, err := flags.GetStringSlice(flagCompServer)
+		if err != nil {
+			return err
+		}
+
+		extVars, err := flags.GetStringSlice(flagExtVar)
+		if err != nil {
+			return err
+		}
+
+		tlaVars, err := flags.GetStringSlice(flagTlaVar)
+		if err != nil {
+			return err
+		}
+
+		envLabels, err := flags.GetStringSlice(flagEnvLabel)
+		if err != nil {
+			return err
+		}
+
+		libPaths, err := flags.GetStringArray(flagEnvLibPath)
+		if err != nil {
+			return err
+		}
+
+		annotations, err := flags.GetStringSlice(flagEnvAnnot)
 		if err != nil {
 			return err
 		}
 
+		c, err := kubecfg.NewEnvSetCmd(envName, desiredEnvName, desiredEnvURI, desiredEnvNamespace, desiredEnvSelector, manager)
+		if err != nil {
+			return err
+		}
+
+		c.Context = desiredEnvContext
+		c.ClearNamespace = flags.Changed(flagEnvNamespace) && desiredEnvNamespace == ""
+		c.ClearClusterSelector = flags.Changed(flagEnvSelector) && desiredEnvSelector == ""
+		c.ClearContext = flags.Changed(flagEnvContext) && desiredEnvContext == ""
+		if c.LibraryPins, err = parseEnvSettings(flagPinLibrary, "<library>=<dir>", pins); err != nil {
+			return err
+		}
+		if flags.Changed(flagEnvLibPath) {
+			c.LibPaths = libPaths
+		}
+		if c.ComponentNamespaces, err = parseEnvSettings(flagCompNs, "<component>=<namespace>", componentNamespaces); err != nil {
+			return err
+		}
+		if c.ComponentServers, err = parseEnvSettings(flagCompServer, "<component>=<uri>", componentServers); err != nil {
+			return err
+		}
+		if c.ExtVars, err = parseEnvSettings(flagExtVar, "<name>=<value>", extVars); err != nil {
+			return err
+		}
+		if c.TlaVars, err = parseEnvSettings(flagTlaVar, "<name>=<value>", tlaVars); err != nil {
+			return err
+		}
+		if c.Labels, err = parseEnvSettings(flagEnvLabel, "<key>=<value>", envLabels); err != nil {
+			return err
+		}
+		if c.Annotations, err = parseEnvSettings(flagEnvAnnot, "<key>=<value>", annotations); err != nil {
+			return err
+		}
+
 		return c.Run()
 	},
 	Long: `Set environment fields such as the name, and cluster URI. Changing
 the name of an environment will also update the directory structure in
-'environments'.`,
+'environments'.
+
+Instead of by URI, an environment can refer to its cluster by the name of a
+kubeconfig context, as kubectl does. The context is looked up each time a
+command runs, so the server address and credentials stay in each user's
+kubeconfig, rather than in the application. The context's namespace is used
+unless the environment sets its own; '--namespace=' removes the environment's
+namespace, and '--kube-context=' the context. An environment cannot have both
+a context and a cluster selector, since the clusters it selects are reached at
+their own URIs.
+
+Vendored libraries can be pinned per environment, so that a library upgrade
+can be rolled out one environment at a time. An environment with the pin
+'mylib=vendor/mylib@1.2' resolves every import of 'mylib/...' in the
+directory 'vendor/mylib@1.2' (relative to the application root), rather than
+in the library search paths. Environments inherit the pins of the
+environments they inherit from.
+
+Environments can also have their own Jsonnet library search paths (absolute,
+or relative to the application root), such as 'environments/prod/lib', for
+libraries that only some environments use. They take precedence over 'lib/'
+and the 'libPaths' of 'app.yaml', and are inherited as well.
+
+Components can also be deployed to namespaces other than the environment's,
+so that an application spread over several namespaces of the same cluster
+needs only one environment. After 'ks env set prod
+--component-namespace=redis=cache', the objects of the component 'redis' that
+do not set their own namespace are deployed to 'cache', rather than to the
+environment's namespace. Objects of cluster-scoped kinds (e.g., ClusterRoles)
+are left without a namespace. Like pins, these mappings are inherited.
+
+Similarly, components can be deployed to other clusters, e.g., monitoring
+agents that must run in a shared operations cluster. After 'ks env set prod
+--component-server=prometheus=https://ops.example.com', 'apply', 'diff', and
+'delete' send the objects of 'prometheus' to that cluster (in the component's
+namespace, or else the environment's), using the credentials kubeconfig has for
+it rather than the environment's, and the rest of the objects to the
+environment's cluster. This is not supported for environments with a cluster
+selector.
+
+Per-environment tunables, such as the region or the name of the cluster, can be
+given to every Jsonnet evaluation for the environment as external variables
+('std.extVar') or top-level arguments, rather than being repeated in each
+component. After 'ks env set prod --ext-str=region=us-west-2', 'show', 'diff',
+and 'apply' of 'prod' evaluate 'std.extVar("region")' to 'us-west-2'. Values
+given on the command line with '--ext-str' and '--tla-str' take precedence.
+Like pins, these are inherited.
+
+Labels and annotations describe an environment, e.g., its tier or its owning
+team. Labels can be selected on, e.g., with 'ks env list -l tier=prod'. Unlike
+pins, they are not inherited.`,
 	Example: `  # Updates the URI of the environment 'us-west/staging'.
   ks env set us-west/staging --uri=http://example.com
 
@@ -294,5 +1412,100 @@ the name of an environment will also update the directory structure in
 
   # Updates both the name and the URI of the environment 'us-west/staging'.
   # Updating the name will update the directory structure in 'environments'
-  ks env set us-west/staging --uri=http://example.com --name=us-east/staging`,
+  ks env set us-west/staging --uri=http://example.com --name=us-east/staging
+
+  # Deploy the environment 'prod' with the kubeconfig context 'prod-admin',
+  # in the context's namespace.
+  ks env set prod --kube-context=prod-admin --namespace=
+
+  # Deploy the environment 'edge' to every cluster in 'clusters.yaml' labeled
+  # with 'tier=edge'.
+  ks env set edge --cluster-selector=tier=edge
+
+  # Deploy the environment 'edge' to the cluster at its URI again.
+  ks env set edge --cluster-selector=
+
+  # Keep 'prod' on version 1.2 of 'mylib', while other environments use the
+  # version in the library search paths.
+  ks env set prod --pin-library=mylib=vendor/mylib@1.2
+
+  # Let the components of 'prod' import libraries from 'environments/prod/lib'.
+  ks env set prod --lib-path=environments/prod/lib
+
+  # Deploy the components 'redis' and 'prometheus' of 'prod' to their own
+  # namespaces.
+  ks env set prod --component-namespace=redis=cache \
+    --component-namespace=prometheus=monitoring
+
+  # Run the component 'prometheus' of 'prod' in the operations cluster.
+  ks env set prod --component-server=prometheus=https://ops.example.com
+
+  # Set the external variable 'region' of every evaluation for 'prod'.
+  ks env set prod --ext-str=region=us-west-2
+
+  # Label 'prod' as a production environment, and record its owner.
+  ks env set prod --label=tier=prod --annotation=owner=team-payments`,
+}
+
+// parseEnvSettings parses the values of the 'env set' flag `flag`, each of the
+// form `expected` (e.g., '<library>=<dir>'), into a map. It returns nil if
+// there are no values.
+func parseEnvSettings(flag, expected string, values []string) (map[string]string, error) {
+	var settings map[string]string
+	for _, value := range values {
+		kv := strings.SplitN(value, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Failed to parse '--%s': expected %s, got '%s'", flag, expected, value)
+		}
+		if settings == nil {
+			settings = map[string]string{}
+		}
+		settings[kv[0]] = kv[1]
+	}
+	return settings, nil
+}
+
+var envSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Update environments from the app's environment registry",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("'env sync' takes zero arguments")
+		}
+
+		appDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		appRoot := metadata.AbsPath(appDir)
+
+		manager, err := metadata.Find(appRoot)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		return manager.SyncEnvironments(ctx)
+	},
+	Long: `Pull environment definitions from the environment registry configured in
+'app.yaml'. A registry is a git repository, laid out like the 'environments'
+directory of a ksonnet application, that lets a platform team manage cluster
+endpoints and API versions for many applications in one place.
+
+Each environment in the registry has its 'spec.json' and generated ksonnet-lib
+copied into the application, replacing any local copy. The environment's
+override file (e.g., 'us-west/staging/staging.jsonnet') belongs to the
+application, and is only generated if it does not already exist. Environments
+that are not in the registry are left untouched.
+
+The registry is configured in 'app.yaml' at the root of the application:
+
+  environmentRegistry:
+    uri: https://github.com/example/environments.git
+    ref: master          # Optional; the branch or tag to use.
+    path: environments   # Optional; the directory holding the environments.`,
+	Example: `  # Update all environments defined in the registry.
+  ks env sync`,
 }
@@ -0,0 +1,149 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+const (
+	flagImpactFile = "file"
+	flagAgainst    = "against"
+)
+
+func init() {
+	RootCmd.AddCommand(impactCmd)
+	bindJsonnetFlags(impactCmd)
+	impactCmd.PersistentFlags().StringArray(flagImpactFile, nil, "A changed file of the application, e.g., 'components/params.libsonnet' (may be repeated)")
+	impactCmd.PersistentFlags().String(flagAgainst, "HEAD", "The git revision holding the files as they were before the change")
+}
+
+var impactCmd = &cobra.Command{
+	Use:   "impact [<env-name>...] --file <path>",
+	Short: "List the components and environments that a change to some files affects",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+
+		files, err := flags.GetStringArray(flagImpactFile)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("'impact' requires at least one '--%s'", flagImpactFile)
+		}
+
+		against, err := flags.GetString(flagAgainst)
+		if err != nil {
+			return err
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		wd := metadata.AbsPath(cwd)
+
+		manager, err := metadata.Find(wd)
+		if err != nil {
+			return err
+		}
+
+		c := kubecfg.ImpactCmd{}
+		if len(args) == 0 {
+			envs, err := manager.GetEnvironments()
+			if err != nil {
+				return err
+			}
+			for _, env := range envs {
+				c.Envs = append(c.Envs, env.Name)
+			}
+			sort.Strings(c.Envs)
+		} else {
+			for _, arg := range args {
+				c.Envs = append(c.Envs, resolveEnvName(manager, arg))
+			}
+		}
+
+		paths := []metadata.AbsPath{}
+		for _, file := range files {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, metadata.AbsPath(abs))
+		}
+
+		baselineRoot, err := ioutil.TempDir("", "ksonnet-impact")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(baselineRoot)
+		if err := manager.CopyAppAtRevision(metadata.AbsPath(baselineRoot), against, paths); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(string(manager.Root()), cwd)
+		if err != nil {
+			return err
+		}
+		baselineWd := metadata.AbsPath(filepath.Join(baselineRoot, rel))
+
+		current := [][]*unstructured.Unstructured{}
+		baseline := [][]*unstructured.Unstructured{}
+		for _, env := range c.Envs {
+			name := env
+			objs, err := expandEnvCmdObjs(cmd, &envSpec{env: &name}, wd)
+			if err != nil {
+				return err
+			}
+			current = append(current, objs)
+
+			objs, err = expandEnvCmdObjs(cmd, &envSpec{env: &name}, baselineWd)
+			if err != nil {
+				return fmt.Errorf("Could not render environment '%s' as of '%s':\n%v", env, against, err)
+			}
+			baseline = append(baseline, objs)
+		}
+
+		return c.Run(current, baseline, cmd.OutOrStdout())
+	},
+	Long: `Determine which components of which environments render differently
+because of changes to the '--file' files, so that (e.g.) CI only deploys or
+tests what a change actually affects. Nothing is sent to any cluster.
+
+Each environment (by default, every environment of the application) is
+rendered twice: as the application is now, and with the '--file' files as they
+were in the git revision '--against' (by default, 'HEAD'). The objects of each
+component are then compared, and each component that differs is listed as
+'changed', 'added' (rendered only with the change), or 'removed' (rendered only
+without it). Files that did not exist in the revision are left out of the
+second rendering.`,
+	Example: `  # List what the uncommitted changes to a shared library affect.
+  ks impact --file lib/defaults.libsonnet
+
+  # In CI, list the components of 'prod' and 'staging' that a branch changes
+  # by editing a component.
+  ks impact prod staging --file components/redis.jsonnet --against origin/master`,
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+const (
+	flagEnv             = "env"
+	flagTillerNamespace = "tiller-namespace"
+)
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importHelmReleaseCmd)
+
+	importHelmReleaseCmd.PersistentFlags().String(flagEnv, "", "Name of the environment whose cluster the release is deployed to")
+	importHelmReleaseCmd.PersistentFlags().String(flagTillerNamespace, kubecfg.DefaultTillerNamespace, "Namespace in which Tiller stores its releases")
+	importHelmReleaseCmd.PersistentFlags().String(flagComponent, "", "Name of the component to write (defaults to the name of the release)")
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import objects managed by other tools into components",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("Command 'import' requires a subcommand\n\n%s", cmd.UsageString())
+	},
+}
+
+var importHelmReleaseCmd = &cobra.Command{
+	Use:   "helm-release <release-name> --env <env-name>",
+	Short: "Import the manifests of a deployed Helm release as a component",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("'import helm-release' takes a single argument, that is the name of the release")
+		}
+		flags := cmd.Flags()
+
+		env, err := flags.GetString(flagEnv)
+		if err != nil {
+			return err
+		}
+		if env == "" {
+			return fmt.Errorf("'import helm-release' requires the environment the release is deployed to; use '--%s'", flagEnv)
+		}
+
+		c := kubecfg.HelmImportCmd{Release: args[0]}
+
+		c.TillerNamespace, err = flags.GetString(flagTillerNamespace)
+		if err != nil {
+			return err
+		}
+
+		c.Component, err = flags.GetString(flagComponent)
+		if err != nil {
+			return err
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		c.Manager, err = metadata.Find(metadata.AbsPath(cwd))
+		if err != nil {
+			return err
+		}
+
+		c.ClientPool, _, err = restClientPool(cmd, &env)
+		if err != nil {
+			return err
+		}
+
+		return c.Run()
+	},
+	Long: `Import the manifests of a release deployed by Helm (via Tiller) to the
+cluster of an environment, and write them to a new component, to ease migrating
+an application from Helm to ksonnet.
+
+The rendered manifests of the most recent deployed revision of the release are
+read from the records Tiller keeps in '--tiller-namespace' (whether Tiller
+stores them in ConfigMaps or Secrets), and converted to Jsonnet as with
+'ks convert'. The release itself is left untouched; once the component has
+been applied with 'ks apply', the release can be removed from Tiller (e.g.,
+with 'kubectl delete configmap -n kube-system -l OWNER=TILLER,NAME=<release-name>')
+so that Helm no longer manages the objects.`,
+	Example: `  # Import the release 'redis' deployed to the cluster of the 'prod'
+  # environment as the component 'components/redis.jsonnet'.
+  ks import helm-release redis --env=prod
+
+  # Import the release 'redis' as the component 'cache', from a Tiller
+  # installed in the 'tiller' namespace.
+  ks import helm-release redis --env=prod --tiller-namespace=tiller --component=cache`,
+}
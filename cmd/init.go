@@ -87,7 +87,10 @@ var initCmd = &cobra.Command{
 			return err
 		}
 
-		return c.Run()
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		return c.Run(ctx)
 	},
 	Long: `Initialize a ksonnet project in a new directory, 'app-name'. This process
 consists of two steps:
@@ -0,0 +1,84 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+func init() {
+	RootCmd.AddCommand(introspectCmd)
+}
+
+var introspectCmd = &cobra.Command{
+	Use:   "introspect",
+	Short: "Describe the whole application as a single JSON document",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("'introspect' takes zero arguments")
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manager, err := metadata.Find(metadata.AbsPath(cwd))
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewIntrospectCmd(manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `Write a JSON document describing the whole application: its environments
+(and the clusters each deploys to), its components (and their labels in
+'app.yaml'), its vendored libraries, and the prototypes available to it.
+Tools such as web consoles can render an application from this one document,
+rather than running many commands and parsing their output.
+
+Fields of 'app.yaml' whose names start with 'x-', at the top level or in the
+entry of a component, belong to other tools: ks ignores them, rather than
+rejecting them as fields it does not understand, and includes them as they are
+under 'extensions' of the application or the component. For example:
+
+  components:
+    redis:
+      labels:
+        tier: backend
+      x-argo:
+        syncWave: 2
+
+The document's 'schemaVersion' only changes when a field is removed or changes
+meaning; fields may be added without changing it.`,
+	Example: `  # Describe the application in the current directory.
+  ks introspect
+
+  # List the names of the application's environments.
+  ks introspect | jq -r '.environments[].name'
+
+  # Show the 'x-argo' settings of every component.
+  ks introspect | jq '.components[] | {name, argo: .extensions["x-argo"]}'`,
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+func init() {
+	RootCmd.AddCommand(lockCmd)
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Record checksums of components, environments and libraries in 'ks.lock'",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("'lock' takes zero arguments")
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manager, err := metadata.Find(metadata.AbsPath(cwd))
+		if err != nil {
+			return err
+		}
+
+		return manager.WriteChecksums()
+	},
+	Long: `Record the SHA-256 hash of every file in 'components/', 'environments/'
+(except archived environments, which are not deployed), 'lib/', and 'vendor/'
+in 'ks.lock' at the root of the application. Commit 'ks.lock' along with the
+files it describes; 'ks apply --checksum-verify' then refuses to deploy if any
+of them differ from the reviewed state.`,
+	Example: `  # Update 'ks.lock' after changing a component.
+  ks lock`,
+}
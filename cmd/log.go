@@ -0,0 +1,158 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagQuiet = "quiet"
+
+	// flagSubsystemVerbosityPrefix prefixes the flags that set the log level
+	// of a single subsystem, e.g., `--v-render=debug`.
+	flagSubsystemVerbosityPrefix = "v-"
+)
+
+// logSubsystems maps the name of each subsystem whose log level can be set
+// independently to the package prefix of the code that belongs to it.
+var logSubsystems = map[string][]string{
+	// Expanding Jsonnet, YAML, and JSON into objects.
+	"render": {"github.com/ksonnet/ksonnet/template.", "github.com/ksonnet/ksonnet/utils."},
+	// Talking to the cluster (e.g., 'apply', 'diff', 'delete').
+	"apply": {"github.com/ksonnet/ksonnet/pkg/kubecfg."},
+	// Managing the application and its environments.
+	"metadata": {"github.com/ksonnet/ksonnet/metadata."},
+	// Finding and expanding prototypes.
+	"prototype": {"github.com/ksonnet/ksonnet/prototype."},
+}
+
+func bindLogFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().CountP(flagVerbose, "v", "Increase verbosity. May be given multiple times.")
+	cmd.PersistentFlags().BoolP(flagQuiet, "q", false, "Suppress all log output except errors. Command output on stdout is unaffected")
+	for subsystem := range logSubsystems {
+		cmd.PersistentFlags().String(flagSubsystemVerbosityPrefix+subsystem, "",
+			fmt.Sprintf("Log level of the %s subsystem (one of: debug, info, warn, error); overrides --%s and --%s", subsystem, flagVerbose, flagQuiet))
+	}
+}
+
+// configureLogLevels sets the log level from the verbosity flags, and wraps
+// `formatter` so that each subsystem is logged at its own level.
+func configureLogLevels(cmd *cobra.Command, formatter log.Formatter) error {
+	flags := cmd.Flags()
+
+	verbosity, err := flags.GetCount(flagVerbose)
+	if err != nil {
+		return err
+	}
+	quiet, err := flags.GetBool(flagQuiet)
+	if err != nil {
+		return err
+	}
+
+	defaultLevel := logLevel(verbosity)
+	if quiet {
+		defaultLevel = log.ErrorLevel
+	}
+
+	levels := map[string]log.Level{}
+	for subsystem := range logSubsystems {
+		levelFlag, err := flags.GetString(flagSubsystemVerbosityPrefix + subsystem)
+		if err != nil {
+			return err
+		} else if levelFlag == "" {
+			continue
+		}
+
+		level, err := log.ParseLevel(levelFlag)
+		if err != nil {
+			return fmt.Errorf("Invalid log level '%s' for flag '--%s%s'", levelFlag, flagSubsystemVerbosityPrefix, subsystem)
+		}
+		levels[subsystem] = level
+	}
+
+	// Entries are filtered by the formatter, so let through everything that
+	// any subsystem might want.
+	maxLevel := defaultLevel
+	for _, level := range levels {
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+	log.SetLevel(maxLevel)
+
+	if len(levels) == 0 {
+		log.SetFormatter(formatter)
+	} else {
+		log.SetFormatter(&subsystemFormatter{next: formatter, defaultLevel: defaultLevel, levels: levels})
+	}
+	return nil
+}
+
+// subsystemFormatter drops log entries that are more verbose than the level
+// set for the subsystem that logged them, and formats the rest with `next`.
+type subsystemFormatter struct {
+	next         log.Formatter
+	defaultLevel log.Level
+	levels       map[string]log.Level
+}
+
+func (f *subsystemFormatter) Format(e *log.Entry) ([]byte, error) {
+	level := f.defaultLevel
+	if l, ok := f.levels[callerSubsystem()]; ok {
+		level = l
+	}
+
+	if e.Level > level {
+		return nil, nil
+	}
+	return f.next.Format(e)
+}
+
+// callerSubsystem returns the subsystem of the code that made the current
+// logging call, or the empty string if it belongs to no subsystem.
+func callerSubsystem() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	// The caller is the first frame after the logging package's own frames.
+	inLogrus := false
+	for {
+		frame, more := frames.Next()
+		isLogrus := strings.Contains(frame.Function, "github.com/sirupsen/logrus.")
+		if inLogrus && !isLogrus {
+			for subsystem, prefixes := range logSubsystems {
+				for _, prefix := range prefixes {
+					if strings.HasPrefix(frame.Function, prefix) {
+						return subsystem
+					}
+				}
+			}
+			return ""
+		}
+		inLogrus = inLogrus || isLogrus
+
+		if !more {
+			return ""
+		}
+	}
+}
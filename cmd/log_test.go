@@ -0,0 +1,65 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type recordingFormatter struct {
+	messages []string
+}
+
+func (f *recordingFormatter) Format(e *log.Entry) ([]byte, error) {
+	f.messages = append(f.messages, e.Message)
+	return []byte(e.Message), nil
+}
+
+func TestSubsystemFormatter(t *testing.T) {
+	next := &recordingFormatter{}
+	f := &subsystemFormatter{
+		next:         next,
+		defaultLevel: log.WarnLevel,
+		levels:       map[string]log.Level{"render": log.DebugLevel},
+	}
+
+	// Entries logged from this package belong to no subsystem, so the default
+	// level applies.
+	logger := log.New()
+	logger.Formatter = f
+	logger.Level = log.DebugLevel
+	logger.Out = &discard{}
+
+	logger.Debug("dropped")
+	logger.Info("dropped")
+	logger.Warn("kept")
+	logger.Error("kept")
+
+	if len(next.messages) != 2 {
+		t.Fatalf("Expected 2 entries to be formatted, got %d", len(next.messages))
+	}
+	for _, msg := range next.messages {
+		if msg != "kept" {
+			t.Errorf("Expected entry '%s' to be dropped", msg)
+		}
+	}
+}
+
+type discard struct{}
+
+func (*discard) Write(p []byte) (int, error) { return len(p), nil }
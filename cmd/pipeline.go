@@ -0,0 +1,236 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+func init() {
+	RootCmd.AddCommand(pipelineCmd)
+	pipelineCmd.AddCommand(pipelineRunCmd)
+
+	bindClientGoFlags(pipelineRunCmd)
+	bindJsonnetFlags(pipelineRunCmd)
+	pipelineRunCmd.PersistentFlags().StringP(flagFormat, "o", kubecfg.PipelineFormatText, "Output format for the stage results.  Supported values are: text, json")
+	pipelineRunCmd.PersistentFlags().Bool(flagConfirm, false, "Run apply stages of protected environments without asking for confirmation")
+}
+
+var pipelineCmd = &cobra.Command{
+	Use:   "pipeline",
+	Short: "Run the application's promotion pipeline",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("Command 'pipeline' requires a subcommand\n\n%s", cmd.UsageString())
+	},
+	Long: `A pipeline is an ordered list of stages, described in 'pipeline.yaml' at the
+root of the application, that promotes the application through its
+environments, e.g.:
+
+    stages:
+    - name: validate-staging
+      action: validate
+      env: staging
+    - name: apply-staging
+      action: apply
+      env: staging
+    - name: wait-staging
+      action: wait
+      env: staging
+      timeout: 5m
+    - name: diff-prod
+      action: diff
+      env: prod
+    - name: apply-prod
+      action: apply
+      env: prod
+
+The actions are:
+
+  validate  Validate the environment, as with 'ks validate'.
+  diff      Show the environment's differences, as with 'ks diff'. Differences
+            alone do not fail the stage.
+  apply     Apply the environment, as with 'ks apply'.
+  wait      Wait up to 'timeout' for the environment's objects to become ready,
+            or, if no 'env' is given, simply wait for 'timeout'.
+
+By default a stage only runs if every stage before it succeeded. Set 'when' to
+'failure' to run a stage only if an earlier stage failed, or to 'always' to run
+it regardless.`,
+}
+
+var pipelineRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the stages of 'pipeline.yaml' in order",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("'pipeline run' takes no arguments")
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		wd := metadata.AbsPath(cwd)
+
+		manager, err := metadata.Find(wd)
+		if err != nil {
+			return err
+		}
+
+		c := kubecfg.PipelineRunCmd{}
+
+		c.Pipeline, err = manager.Pipeline()
+		if err != nil {
+			return err
+		}
+
+		c.Format, err = cmd.Flags().GetString(flagFormat)
+		if err != nil {
+			return err
+		}
+
+		// Keep standard output clean for the JSON results.
+		stageOut := cmd.OutOrStdout()
+		if c.Format == kubecfg.PipelineFormatJSON {
+			stageOut = cmd.OutOrStderr()
+		}
+
+		// Each stage's environment overrides the cluster and namespace; every
+		// stage starts again from those given on the command line.
+		initialOverrides := overrides
+		c.RunStage = func(stage *metadata.PipelineStage) error {
+			overrides = initialOverrides
+			reloadClientConfig()
+			return runPipelineStage(cmd, stage, wd, stageOut)
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `Run the stages of the pipeline described in 'pipeline.yaml' in order (see
+'ks pipeline --help'), and report the result of each stage.
+
+With '--format=json', the results are written to standard output as a JSON
+object, and the output of the stages themselves is written to standard error.
+'pipeline run' fails if any stage fails.`,
+	Example: `  # Run the application's pipeline.
+  ks pipeline run
+
+  # Run the application's pipeline, and write the result of each stage as JSON.
+  ks pipeline run --format=json > results.json`,
+}
+
+// runPipelineStage performs the action of a single pipeline stage, writing
+// any output to `out`.
+func runPipelineStage(cmd *cobra.Command, stage *metadata.PipelineStage, wd metadata.AbsPath, out io.Writer) error {
+	env := stage.Env
+	envSpec := &envSpec{env: &env}
+
+	switch stage.Action {
+	case metadata.PipelineActionValidate:
+		c := kubecfg.ValidateCmd{Format: kubecfg.ValidateFormatText}
+
+		var err error
+		_, c.Discovery, err = restClientPool(cmd, envSpec.env)
+		if err != nil {
+			return err
+		}
+
+		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+		if err != nil {
+			return err
+		}
+
+		c.Components, err = componentSpecs(wd)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(objs, out)
+	case metadata.PipelineActionDiff:
+		c := kubecfg.DiffCmd{DiffStrategy: "all"}
+
+		var err error
+		c.ClientPool, c.Discovery, err = restClientPool(cmd, envSpec.env)
+		if err != nil {
+			return err
+		}
+
+		c.Components, err = componentSpecs(wd)
+		if err != nil {
+			return err
+		}
+
+		c.Namespace, err = namespace()
+		if err != nil {
+			return err
+		}
+
+		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+		if err != nil {
+			return err
+		}
+
+		if err := c.Run(objs, out); err != nil && err != kubecfg.ErrDiffFound {
+			return err
+		}
+		return nil
+	case metadata.PipelineActionApply:
+		if err := checkProtected(cmd, envSpec.env, "apply to"); err != nil {
+			return err
+		}
+		return runApply(cmd, kubecfg.ApplyCmd{Create: true, Out: out}, envSpec, wd)
+	case metadata.PipelineActionWait:
+		if env == "" {
+			time.Sleep(stage.TimeoutDuration())
+			return nil
+		}
+
+		c := kubecfg.WaitCmd{Timeout: stage.TimeoutDuration()}
+
+		var err error
+		c.HealthPolicies, err = healthPolicies(wd)
+		if err != nil {
+			return err
+		}
+
+		c.ClientPool, c.Discovery, err = restClientPool(cmd, envSpec.env)
+		if err != nil {
+			return err
+		}
+
+		c.Namespace, err = namespace()
+		if err != nil {
+			return err
+		}
+
+		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(objs)
+	}
+
+	return fmt.Errorf("Stage '%s' has unknown action '%s'", stage.Name, stage.Action)
+}
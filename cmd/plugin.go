@@ -0,0 +1,191 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+func init() {
+	RootCmd.AddCommand(pluginCmd)
+
+	pluginCmd.AddCommand(pluginListCmd)
+	pluginCmd.AddCommand(pluginRunCmd)
+	// Flags are only parsed up to the name of the plugin; everything after it
+	// is the plugin's own.
+	pluginRunCmd.Flags().SetInterspersed(false)
+	pluginRunCmd.PersistentFlags().String(flagEnv, "", "Environment whose rendered objects are written to the plugin's standard input")
+	bindJsonnetFlags(pluginRunCmd)
+}
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage and run the plugins that extend ks with subcommands",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("Command 'plugin' requires a subcommand\n\n%s", cmd.UsageString())
+	},
+	Long: `Plugins extend ks with subcommands of their own (e.g., organization-specific
+checks or reports), without changes to ks itself. A plugin is any executable
+named 'ks-<name>', e.g., 'ks-cost' for the plugin 'cost'. Plugins are looked up
+in the application's 'pluginsDir', if 'app.yaml' has one, and then on the
+'PATH':
+
+  pluginsDir: tools/plugins
+
+A plugin can be run as 'ks plugin run <name>', or simply as 'ks <name>', unless
+ks has a command of the same name. Its arguments are passed to it untouched,
+and it is run with:
+
+  KS_APP_ROOT   the root of the application, when run inside one
+  KS_BINARY     the path of the running ks binary, to call back into ks
+  KS_ENV        the selected environment (with 'ks plugin run --env')
+
+With 'ks plugin run --env <env-name>', the objects of the environment are
+rendered, as by 'ks show', and written to the plugin's standard input as a YAML
+stream.`,
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available plugins",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("'plugin list' takes no arguments")
+		}
+
+		c := kubecfg.PluginListCmd{Dirs: pluginDirs()}
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `List the available plugins, and where each is found. Where several
+directories have a plugin of the same name, only the one that is run is
+listed.`,
+}
+
+var pluginRunCmd = &cobra.Command{
+	Use:   "run [--env <env-name>] <plugin-name> [<args>...]",
+	Short: "Run a plugin",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		envName, err := cmd.Flags().GetString(flagEnv)
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("'plugin run' requires the name of the plugin to run")
+		}
+
+		plugin, err := kubecfg.FindPlugin(args[0], pluginDirs())
+		if err != nil {
+			return err
+		} else if plugin == nil {
+			return fmt.Errorf("No plugin '%s' found; it must be an executable named '%s%s' in the application's 'pluginsDir' or on the PATH", args[0], kubecfg.PluginPrefix, args[0])
+		}
+
+		c := kubecfg.PluginCmd{
+			Plugin: plugin,
+			In:     os.Stdin,
+			Out:    cmd.OutOrStdout(),
+			ErrOut: cmd.OutOrStderr(),
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		wd := metadata.AbsPath(cwd)
+		manager, findErr := metadata.Find(wd)
+		if findErr == nil {
+			c.AppRoot = string(manager.Root())
+		}
+
+		if envName != "" {
+			if findErr != nil {
+				return findErr
+			}
+			env, err := manager.GetEnvironment(envName)
+			if err != nil {
+				return err
+			}
+			c.Env = env.Name
+			c.Render = func() ([]*unstructured.Unstructured, error) {
+				return expandEnvCmdObjs(cmd, &envSpec{env: &env.Name}, wd)
+			}
+		}
+
+		return c.Run(args[1:])
+	},
+	Long: `Run the plugin '<plugin-name>' with the given arguments. See 'ks plugin' for
+how plugins are found, and what they are given.
+
+The flags of 'plugin run' (e.g., '--env', or the Jsonnet flags used to render the
+environment) must come before the name of the plugin; everything after it is
+passed to the plugin untouched.`,
+	Example: `  # Run the plugin 'ks-cost' with the rendered objects of the 'prod'
+  # environment on its standard input.
+  ks plugin run --env prod cost --currency EUR
+
+  # The same, rendering the environment with an extra Jsonnet search path.
+  ks plugin run --env prod -J vendor/lib cost
+
+  # The same plugin, without an environment.
+  ks cost --help`,
+}
+
+// pluginDirs returns the directories that plugins are looked up in, in order:
+// the 'pluginsDir' of the application containing the working directory, if
+// any, and then the PATH.
+func pluginDirs() []string {
+	dirs := []string{}
+	if cwd, err := os.Getwd(); err == nil {
+		if manager, err := metadata.Find(metadata.AbsPath(cwd)); err == nil {
+			dir, err := manager.PluginsPath()
+			if err != nil {
+				log.Warnf("Ignoring the application's plugins: %v", err)
+			} else if dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+}
+
+// PluginArgs rewrites the command line `args` of 'ks <plugin-name> ...' as
+// that of 'ks plugin run <plugin-name> ...', if the first argument names a
+// plugin rather than a command of ks. Other command lines are returned
+// unchanged.
+func PluginArgs(args []string) []string {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return args
+	}
+	if c, _, err := RootCmd.Find(args); err == nil && c != RootCmd {
+		return args
+	}
+
+	plugin, err := kubecfg.FindPlugin(args[0], pluginDirs())
+	if err != nil || plugin == nil {
+		return args
+	}
+	return append([]string{"plugin", "run", args[0]}, args[1:]...)
+}
@@ -16,8 +16,12 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"strings"
 
 	"github.com/spf13/pflag"
@@ -35,8 +39,22 @@ func init() {
 	prototypeCmd.AddCommand(prototypeSearchCmd)
 	prototypeCmd.AddCommand(prototypeUseCmd)
 	prototypeCmd.AddCommand(prototypePreviewCmd)
+	prototypeCmd.AddCommand(prototypeLintCmd)
+	prototypeLintCmd.PersistentFlags().StringP(flagFormat, "o", "text", "Output format.  Supported values are: text, json")
+
+	for _, cmd := range []*cobra.Command{prototypeUseCmd, prototypePreviewCmd} {
+		cmd.PersistentFlags().Bool(flagCommentParams, false,
+			"Begin the component with a comment listing every parameter of the prototype and its value")
+		cmd.PersistentFlags().Bool(flagWriteDefaults, false,
+			"Write every parameter of the prototype, including those left at their defaults, to a 'params' object at the top of a Jsonnet component, which the component refers to")
+	}
 }
 
+const (
+	flagCommentParams = "comment-params"
+	flagWriteDefaults = "write-defaults"
+)
+
 var prototypeCmd = &cobra.Command{
 	Use:   "prototype",
 	Short: `Instantiate, inspect, and get examples for ksonnet prototypes`,
@@ -54,7 +72,8 @@ Commands:
   use      Instantiate prototype, filling in parameters from flags, and
            emitting the generated code to stdout.
   describe Display documentation and details about a prototype
-  search   Search for a prototype`,
+  search   Search for a prototype
+  lint     Check prototype specifications for common mistakes`,
 
 	Example: `  # Display documentation about prototype
   # 'io.ksonnet.pkg.prototype.simple-deployment', including:
@@ -234,7 +253,12 @@ var prototypePreviewCmd = &cobra.Command{
 			return err
 		}
 
-		fmt.Println(text)
+		header, err := prototypeParamsComment(proto, flags, templateType)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(header + text)
 		return nil
 	},
 	Long: `Expand prototype uniquely identified by (possibly partial)
@@ -244,7 +268,15 @@ code to stdout.
 Note also that 'prototype-name' need only contain enough of the suffix of a name
 to uniquely disambiguate it among known names. For example, 'deployment' may
 resolve ambiguously, in which case 'use' will fail, while 'deployment' might be
-unique enough to resolve to 'io.ksonnet.pkg.single-port-deployment'.`,
+unique enough to resolve to 'io.ksonnet.pkg.single-port-deployment'.
+
+With '--comment-params', Jsonnet and YAML components begin with a comment
+listing every parameter of the prototype and the value it was given, including
+the optional parameters that were left at their defaults, so that it is easy to
+see which knobs the prototype has. With '--write-defaults', a Jsonnet component
+begins with a 'params' object holding the value of every parameter (again
+including the defaults), and refers to it wherever the prototype uses a
+parameter, so that the knobs can be tuned in one place.`,
 
 	Example: `  # Preview prototype 'io.ksonnet.pkg.single-port-deployment', using the
   # 'nginx' image, and port 80 exposed.
@@ -325,7 +357,12 @@ var prototypeUseCmd = &cobra.Command{
 			return err
 		}
 
-		return manager.CreateComponent(componentName, text, templateType)
+		header, err := prototypeParamsComment(proto, flags, templateType)
+		if err != nil {
+			return err
+		}
+
+		return manager.CreateComponent(componentName, header+text, templateType)
 	},
 	Long: `Expand prototype uniquely identified by (possibly partial) 'prototype-name',
 filling in parameters from flags, and placing it into the file
@@ -345,7 +382,15 @@ below for an example of how to do this.
 Note also that 'prototype-name' need only contain enough of the suffix of a name
 to uniquely disambiguate it among known names. For example, 'deployment' may
 resolve ambiguously, in which case 'use' will fail, while 'deployment' might be
-unique enough to resolve to 'io.ksonnet.pkg.single-port-deployment'.`,
+unique enough to resolve to 'io.ksonnet.pkg.single-port-deployment'.
+
+With '--comment-params', Jsonnet and YAML components begin with a comment
+listing every parameter of the prototype and the value it was given, including
+the optional parameters that were left at their defaults. With
+'--write-defaults', a Jsonnet component begins with a 'params' object holding
+the value of every parameter (again including the defaults), and refers to it
+wherever the prototype uses a parameter, so that the knobs can be tuned in one
+place.`,
 
 	Example: `  # Instantiate prototype 'io.ksonnet.pkg.single-port-deployment', using the
   # 'nginx' image. The expanded prototype is placed in
@@ -368,7 +413,147 @@ unique enough to resolve to 'io.ksonnet.pkg.single-port-deployment'.`,
   # do not have a YAML or JSON versions.
   ks prototype use deployment nginx-depl yaml \
     --name=nginx                              \
-    --image=nginx`,
+    --image=nginx
+
+  # Parameter values may be templates, with access to the environment
+  # variables prefixed with 'KS_PARAM_' (e.g., '.env.REGION' for
+  # 'KS_PARAM_REGION'), the current git commit and branch ('.git.sha',
+  # '.git.branch'; ks must run in a git repository with at least one commit),
+  # and the functions 'upper', 'lower', 'trunc', 'sha256', and 'b64enc'. Here
+  # the deployment is named after the first 7 characters of the commit SHA.
+  ks prototype use deployment nginx-depl \
+    --name='nginx-{{ .git.sha | trunc 7 }}' \
+    --image=nginx
+
+  # Write every parameter of the prototype, including those left at their
+  # defaults, to a 'params' object at the top of the component.
+  ks prototype use deployment nginx-depl \
+    --name=nginx                              \
+    --image=nginx                             \
+    --write-defaults`,
+}
+
+var prototypeLintCmd = &cobra.Command{
+	Use:   "lint [<spec-file>...]",
+	Short: `Check prototype specifications for common mistakes`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := cmd.Flags().GetString(flagFormat)
+		if err != nil {
+			return err
+		} else if format != "text" && format != "json" {
+			return fmt.Errorf("Unknown output format '%s'; supported values are: text, json", format)
+		}
+
+		protos := prototype.SpecificationSchemas{}
+		if len(args) == 0 {
+			protos, err = prototype.NewIndex([]*prototype.SpecificationSchema{}).List()
+			if err != nil {
+				return err
+			}
+		}
+		for _, path := range args {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			proto := &prototype.SpecificationSchema{}
+			if err := json.Unmarshal(data, proto); err != nil {
+				return fmt.Errorf("Could not parse prototype specification '%s':\n%v", path, err)
+			}
+			protos = append(protos, proto)
+		}
+
+		issues := prototype.LintIssues{}
+		for _, proto := range protos {
+			issues = append(issues, prototype.Lint(proto)...)
+		}
+
+		out := cmd.OutOrStdout()
+		if format == "json" {
+			data, err := json.MarshalIndent(issues, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, string(data))
+		} else {
+			for _, issue := range issues {
+				fmt.Fprintln(out, issue)
+			}
+		}
+
+		if n := issues.Errors(); n > 0 {
+			return fmt.Errorf("Found %d error(s) in %d prototype(s)", n, len(protos))
+		}
+		return nil
+	},
+	Long: `Check prototype specifications for common mistakes, so that they can be fixed
+before the prototypes are published. Each 'spec-file' is a JSON prototype
+specification; if none are given, the prototypes built into ksonnet are checked.
+
+The following problems are reported as errors:
+
+  * Parameters used in a template body that are not declared
+  * Parameters that are declared more than once, or have an unknown type
+  * Default values that are not valid for the parameter's type
+  * Jsonnet (or JSON) template bodies that do not parse, once their
+    parameters are filled in
+
+The following problems are reported as warnings:
+
+  * Parameters that are declared, but not used in any template body
+  * Missing descriptions for the prototype or its parameters
+
+'lint' exits with a non-zero status if any errors are found. With
+'--format=json', the problems are written to standard output as a JSON array,
+which (e.g.) a registry's CI can use to check contributions.`,
+	Example: `  # Check a prototype specification.
+  ks prototype lint ./nginx-deployment.json
+
+  # Check every prototype in a registry, writing the results as JSON.
+  ks prototype lint prototypes/*.json --format=json`,
+}
+
+// prototypeParamsComment generates a comment listing the value of every
+// parameter used to instantiate `proto`, including those left at their
+// defaults, if `--comment-params` is set. JSON has no comments, so for JSON
+// templates it returns the empty string.
+func prototypeParamsComment(proto *prototype.SpecificationSchema, flags *pflag.FlagSet, templateType prototype.TemplateType) (string, error) {
+	if comment, err := flags.GetBool(flagCommentParams); err != nil || !comment {
+		return "", err
+	}
+
+	var prefix string
+	switch templateType {
+	case prototype.Jsonnet:
+		prefix = "//"
+	case prototype.YAML:
+		prefix = "#"
+	default:
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s Generated from prototype '%s' with parameters:\n", prefix, proto.Name)
+	for _, param := range append(proto.RequiredParams(), proto.OptionalParams()...) {
+		val, err := flags.GetString(param.Name)
+		if err != nil {
+			return "", err
+		}
+
+		note := ""
+		if param.Default != nil && !flags.Changed(param.Name) {
+			note = " (default)"
+		}
+		// Object and array values are Jsonnet code, and may span lines.
+		if param.Type == prototype.Object || param.Type == prototype.Array {
+			val = strings.Join(strings.Fields(val), " ")
+		}
+		fmt.Fprintf(&buf, "%s   --%s=%s%s\n", prefix, param.Name, val, note)
+	}
+	buf.WriteString("\n")
+
+	return buf.String(), nil
 }
 
 func bindPrototypeFlags(cmd *cobra.Command, proto *prototype.SpecificationSchema) {
@@ -382,10 +567,15 @@ func bindPrototypeFlags(cmd *cobra.Command, proto *prototype.SpecificationSchema
 }
 
 func expandPrototype(proto *prototype.SpecificationSchema, flags *pflag.FlagSet, templateType prototype.TemplateType) (string, error) {
+	templateData, err := paramTemplateData(proto, flags)
+	if err != nil {
+		return "", err
+	}
+
 	missingReqd := prototype.ParamSchemas{}
 	values := map[string]string{}
 	for _, param := range proto.RequiredParams() {
-		val, err := flags.GetString(param.Name)
+		val, err := getPrototypeParam(flags, param, templateData)
 		if err != nil {
 			return "", err
 		} else if val == "" {
@@ -406,7 +596,7 @@ func expandPrototype(proto *prototype.SpecificationSchema, flags *pflag.FlagSet,
 	}
 
 	for _, param := range proto.OptionalParams() {
-		val, err := flags.GetString(param.Name)
+		val, err := getPrototypeParam(flags, param, templateData)
 		if err != nil {
 			return "", err
 		} else if _, ok := values[param.Name]; ok {
@@ -420,6 +610,31 @@ func expandPrototype(proto *prototype.SpecificationSchema, flags *pflag.FlagSet,
 		values[param.Name] = quoted
 	}
 
+	writeDefaults, err := flags.GetBool(flagWriteDefaults)
+	if err != nil {
+		return "", err
+	}
+	var params bytes.Buffer
+	if writeDefaults {
+		if templateType != prototype.Jsonnet {
+			return "", fmt.Errorf("'--%s' writes the parameters as Jsonnet, and cannot be used with %s templates", flagWriteDefaults, templateType)
+		}
+
+		// The template refers to the 'params' object, rather than to the
+		// values themselves.
+		params.WriteString("local params = {\n")
+		for _, param := range append(proto.RequiredParams(), proto.OptionalParams()...) {
+			field := metadata.JsonnetField(param.Name)
+			fmt.Fprintf(&params, "  %s: %s,\n", field, values[param.Name])
+			if field == param.Name {
+				values[param.Name] = "params." + field
+			} else {
+				values[param.Name] = fmt.Sprintf("params[%s]", field)
+			}
+		}
+		params.WriteString("};\n\n")
+	}
+
 	template, err := proto.Template.Body(templateType)
 	if err != nil {
 		return "", err
@@ -431,7 +646,88 @@ func expandPrototype(proto *prototype.SpecificationSchema, flags *pflag.FlagSet,
 		return "", err
 	}
 
-	return text, nil
+	return params.String() + text, nil
+}
+
+// getPrototypeParam retrieves the value of a prototype parameter from the flags,
+// and evaluates it as a parameter template (e.g., `svc-{{ .git.sha | trunc 7 }}`).
+// Object and array parameters are Jsonnet code, and are passed through as-is.
+func getPrototypeParam(flags *pflag.FlagSet, param *prototype.ParamSchema, data map[string]interface{}) (string, error) {
+	val, err := flags.GetString(param.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if param.Type == prototype.Object || param.Type == prototype.Array {
+		return val, nil
+	}
+
+	return prototype.EvaluateParamTemplate(val, data)
+}
+
+// paramTemplateEnvPrefix is the prefix of the environment variables that
+// parameter templates can read, as `.env.<name without the prefix>`. Other
+// variables (e.g., credentials) are not exposed.
+const paramTemplateEnvPrefix = "KS_PARAM_"
+
+// paramTemplateData collects the values available to the parameter templates
+// of `proto` given in `flags`: the environment variables prefixed with
+// `paramTemplateEnvPrefix` (`.env`), and, when a template refers to them, the
+// current commit and branch of the git repository ks runs in (`.git.sha` and
+// `.git.branch`). It is an error for a template to refer to them if git cannot
+// resolve the current commit (e.g., outside a git repository), as the values
+// would otherwise silently be the same for every build.
+func paramTemplateData(proto *prototype.SpecificationSchema, flags *pflag.FlagSet) (map[string]interface{}, error) {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		split := strings.SplitN(kv, "=", 2)
+		if len(split) == 2 && strings.HasPrefix(split[0], paramTemplateEnvPrefix) {
+			env[strings.TrimPrefix(split[0], paramTemplateEnvPrefix)] = split[1]
+		}
+	}
+	data := map[string]interface{}{"env": env}
+
+	needsGit := false
+	for _, param := range append(proto.RequiredParams(), proto.OptionalParams()...) {
+		val, err := flags.GetString(param.Name)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(val, "{{") && strings.Contains(val, ".git") {
+			needsGit = true
+		}
+	}
+	if !needsGit {
+		return data, nil
+	}
+
+	sha, err := gitRevParse("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	branch, err := gitRevParse("--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	data["git"] = map[string]string{"sha": sha, "branch": branch}
+	return data, nil
+}
+
+// gitRevParse returns the output of 'git rev-parse' with the arguments `args`,
+// run in the current directory, or an error with git's own message if it
+// fails.
+func gitRevParse(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	git := exec.Command("git", append([]string{"rev-parse"}, args...)...)
+	git.Stdout = &stdout
+	git.Stderr = &stderr
+	if err := git.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("Could not resolve the git values of the parameter templates with 'git rev-parse %s':\n%s", strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("Could not resolve the git values of the parameter templates with 'git rev-parse %s':\n%v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
 }
 
 func fundUniquePrototype(query string) (*prototype.SpecificationSchema, error) {
@@ -0,0 +1,179 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	"github.com/ksonnet/ksonnet/prototype"
+)
+
+func TestParamTemplateData(t *testing.T) {
+	for name, value := range map[string]string{"KS_PARAM_REGION": "us-west", "KS_TEST_SECRET": "hunter2"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	proto := &prototype.SpecificationSchema{
+		Params: prototype.ParamSchemas{
+			prototype.RequiredParam("name", "name", "Name", prototype.String),
+			prototype.OptionalParam("image", "image", "Image", "nginx", prototype.String),
+		},
+	}
+
+	tests := []struct {
+		name    string
+		usesGit bool
+	}{
+		{"web-{{ .env.REGION }}", false},
+		{"web-{{ .git.sha | trunc 7 }}", true},
+	}
+	for _, test := range tests {
+		flags := pflag.NewFlagSet("prototype", pflag.ContinueOnError)
+		flags.String("name", "", "")
+		flags.String("image", "nginx", "")
+		if err := flags.Set("name", test.name); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := paramTemplateData(proto, flags)
+		if err != nil {
+			t.Fatalf("Failed to collect template data for '%s':\n%v", test.name, err)
+		}
+		env := data["env"].(map[string]string)
+		if env["REGION"] != "us-west" {
+			t.Errorf("Expected '.env.REGION' to be read from KS_PARAM_REGION, got %v", env)
+		}
+		for name := range env {
+			if name != "REGION" {
+				t.Errorf("Expected only variables prefixed with %s to be exposed, got '%s'", paramTemplateEnvPrefix, name)
+			}
+		}
+		if _, ok := data["git"]; ok != test.usesGit {
+			t.Errorf("Expected git data to be collected=%t for '%s'", test.usesGit, test.name)
+		}
+	}
+}
+
+func TestParamTemplateDataOutsideGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "ks-param-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	// Keep git from finding a repository above the temporary directory.
+	defer os.Setenv("GIT_CEILING_DIRECTORIES", os.Getenv("GIT_CEILING_DIRECTORIES"))
+	os.Setenv("GIT_CEILING_DIRECTORIES", dir)
+
+	proto := &prototype.SpecificationSchema{
+		Params: prototype.ParamSchemas{
+			prototype.RequiredParam("name", "name", "Name", prototype.String),
+		},
+	}
+	newFlags := func(name string) *pflag.FlagSet {
+		flags := pflag.NewFlagSet("prototype", pflag.ContinueOnError)
+		flags.String("name", "", "")
+		if err := flags.Set("name", name); err != nil {
+			t.Fatal(err)
+		}
+		return flags
+	}
+
+	if _, err := paramTemplateData(proto, newFlags("web-{{ .env.REGION }}")); err != nil {
+		t.Errorf("Expected templates not referring to git to work outside a git repository, got error:\n%v", err)
+	}
+
+	_, err = paramTemplateData(proto, newFlags("svc-{{ sha256 .git.sha | trunc 7 }}"))
+	if err == nil {
+		t.Fatalf("Expected templates referring to git to fail outside a git repository")
+	}
+	if !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("Expected the error to include git's message, got:\n%v", err)
+	}
+}
+
+func TestExpandPrototypeFlags(t *testing.T) {
+	proto := &prototype.SpecificationSchema{
+		Name: "io.ksonnet.pkg.test",
+		Params: prototype.ParamSchemas{
+			prototype.RequiredParam("name", "name", "Name", prototype.String),
+			prototype.OptionalParam("image-tag", "imageTag", "Image tag", "latest", prototype.String),
+		},
+		Template: prototype.SnippetSchema{
+			JsonnetBody: []string{`{name: ${name}, tag: ${image-tag}}`},
+			YAMLBody:    []string{`name: ${name}`},
+		},
+	}
+
+	tests := []struct {
+		templateType  prototype.TemplateType
+		commentParams bool
+		writeDefaults bool
+		expected      string
+		err           bool
+	}{
+		{prototype.Jsonnet, false, false, `{name: "web", tag: "latest"}`, false},
+		{prototype.Jsonnet, true, false, "// Generated from prototype 'io.ksonnet.pkg.test' with parameters:\n//   --name=web\n//   --image-tag=latest (default)\n\n{name: \"web\", tag: \"latest\"}", false},
+		{prototype.Jsonnet, false, true, "local params = {\n  name: \"web\",\n  \"image-tag\": \"latest\",\n};\n\n{name: params.name, tag: params[\"image-tag\"]}", false},
+		{prototype.YAML, false, true, "", true},
+	}
+	for _, test := range tests {
+		flags := pflag.NewFlagSet("prototype", pflag.ContinueOnError)
+		flags.String("name", "", "")
+		flags.String("image-tag", "latest", "")
+		flags.Bool(flagCommentParams, test.commentParams, "")
+		flags.Bool(flagWriteDefaults, test.writeDefaults, "")
+		if err := flags.Set("name", "web"); err != nil {
+			t.Fatal(err)
+		}
+
+		text, err := expandPrototype(proto, flags, test.templateType)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected '--%s' to be rejected for %s templates", flagWriteDefaults, test.templateType)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("Failed to expand %s template:\n%v", test.templateType, err)
+		}
+		header, err := prototypeParamsComment(proto, flags, test.templateType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := header + text; actual != test.expected {
+			t.Errorf("Expected component\n%s\nbut got\n%s", test.expected, actual)
+		}
+	}
+}
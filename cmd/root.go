@@ -16,18 +16,22 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	goflag "flag"
 	"fmt"
 	"io"
 	"os"
-	"path"
+	"os/signal"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -37,6 +41,8 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/credentials"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
 	"github.com/ksonnet/ksonnet/template"
 	"github.com/ksonnet/ksonnet/utils"
 
@@ -53,12 +59,27 @@ const (
 	flagTlaVarFile = "tla-str-file"
 	flagResolver   = "resolve-images"
 	flagResolvFail = "resolve-images-error"
+	flagMaxStack   = "max-stack"
+	flagEvalTmout  = "eval-timeout"
 	flagAPISpec    = "api-spec"
+	flagApp        = "app"
 
 	// For use in the commands (e.g., diff, apply, delete) that require either an
 	// environment or the -f flag.
-	flagFile      = "file"
-	flagFileShort = "f"
+	flagFile          = "file"
+	flagFileShort     = "f"
+	flagSelector      = "selector"
+	flagLabelSel      = "label-selector"
+	flagLabelSelShort = "l"
+
+	// For use in commands that ask for confirmation before doing something
+	// destructive.
+	flagYes      = "yes"
+	flagYesShort = "y"
+
+	// For use in commands that change or delete what runs in an environment,
+	// which must be confirmed if the environment is protected.
+	flagConfirm = "confirm"
 )
 
 var clientConfig clientcmd.ClientConfig
@@ -66,7 +87,8 @@ var overrides clientcmd.ConfigOverrides
 var loadingRules clientcmd.ClientConfigLoadingRules
 
 func init() {
-	RootCmd.PersistentFlags().CountP(flagVerbose, "v", "Increase verbosity. May be given multiple times.")
+	bindLogFlags(RootCmd)
+	RootCmd.PersistentFlags().String(flagApp, "", "Run the command in the named app of the enclosing workspace (see 'ks-workspace.yaml')")
 
 	// The "usual" clientcmd/kubectl flags
 	loadingRules = *clientcmd.NewDefaultClientConfigLoadingRules()
@@ -84,6 +106,8 @@ func bindJsonnetFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringSlice(flagTlaVarFile, nil, "Read top level argument from a file")
 	cmd.PersistentFlags().String(flagResolver, "noop", "Change implementation of resolveImage native function. One of: noop, registry")
 	cmd.PersistentFlags().String(flagResolvFail, "warn", "Action when resolveImage fails. One of ignore,warn,error")
+	cmd.PersistentFlags().Uint(flagMaxStack, 0, "Maximum depth of jsonnet recursion (overrides 'jsonnet.maxStack' in app.yaml)")
+	cmd.PersistentFlags().Duration(flagEvalTmout, 0, "Abandon jsonnet evaluations that take longer than this, e.g. 30s (overrides 'jsonnet.timeout' in app.yaml)")
 }
 
 func bindClientGoFlags(cmd *cobra.Command) {
@@ -106,18 +130,96 @@ var RootCmd = &cobra.Command{
 		log.SetOutput(out)
 
 		logFmt := NewLogFormatter(out)
-		log.SetFormatter(logFmt)
+		if err := configureLogLevels(cmd, logFmt); err != nil {
+			return err
+		}
 
-		verbosity, err := flags.GetCount(flagVerbose)
+		appName, err := flags.GetString(flagApp)
 		if err != nil {
 			return err
 		}
-		log.SetLevel(logLevel(verbosity))
+		if appName != "" {
+			if err := chdirToApp(appName); err != nil {
+				return err
+			}
+		}
 
-		return nil
+		return checkAppVersion(cmd)
 	},
 }
 
+// checkAppVersion fails if the working directory is inside a ksonnet
+// application that this version of ks cannot safely operate on (see
+// `metadata.Manager.CheckVersion`). 'ks version' always works, so that users
+// can find out which version they have, as does 'ks app status', which reports
+// the problem among others.
+func checkAppVersion(cmd *cobra.Command) error {
+	if cmd == versionCmd || cmd == appStatusCmd {
+		return nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	manager, err := metadata.Find(metadata.AbsPath(cwd))
+	if err != nil {
+		// Not in an application; commands that need one report that
+		// themselves.
+		return nil
+	}
+
+	return manager.CheckVersion(Version)
+}
+
+// chdirToApp changes the working directory to the root of the app `name` in
+// the workspace enclosing the current working directory, so that commands
+// operate on that app as if they had been run from inside it.
+func chdirToApp(name string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	ws, err := metadata.FindWorkspace(metadata.AbsPath(cwd))
+	if err != nil {
+		return err
+	} else if ws == nil {
+		return fmt.Errorf("Flag '--%s' can only be used inside a workspace; could not find a 'ks-workspace.yaml' in '%s' or its parents", flagApp, cwd)
+	}
+
+	appPath, err := ws.AppPath(name)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Using app '%s' at '%s'", name, appPath)
+	return os.Chdir(string(appPath))
+}
+
+// interruptContext returns a context that is cancelled the first time the user
+// interrupts the process (e.g., with Ctrl-C). This gives long-running commands
+// a chance to clean up partially-written files; a second interrupt kills the
+// process as usual.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case <-sigs:
+			log.Warn("Interrupted; cleaning up. Interrupt again to exit immediately")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
 // clientConfig.Namespace() is broken in client-go 3.0:
 // namespace in config erroneously overrides explicit --namespace
 func namespace() (string, error) {
@@ -184,7 +286,7 @@ func newExpander(cmd *cobra.Command) (*template.Expander, error) {
 	spec := template.Expander{}
 	var err error
 
-	spec.EnvJPath = filepath.SplitList(os.Getenv("KUBECFG_JPATH"))
+	spec.EnvJPath = append(filepath.SplitList(os.Getenv("KUBECFG_JPATH")), filepath.SplitList(os.Getenv(metadata.JPathEnvVar))...)
 
 	spec.FlagJpath, err = flags.GetStringSlice(flagJpath)
 	if err != nil {
@@ -220,6 +322,17 @@ func newExpander(cmd *cobra.Command) (*template.Expander, error) {
 		return nil, err
 	}
 
+	spec.Limits.MaxStack, err = flags.GetUint(flagMaxStack)
+	if err != nil {
+		return nil, err
+	}
+	spec.Limits.Timeout, err = flags.GetDuration(flagEvalTmout)
+	if err != nil {
+		return nil, err
+	} else if spec.Limits.Timeout < 0 {
+		return nil, fmt.Errorf("'--%s' must not be negative", flagEvalTmout)
+	}
+
 	return &spec, nil
 }
 
@@ -234,6 +347,12 @@ func dumpJSON(v interface{}) string {
 	return string(buf.Bytes())
 }
 
+// reloadClientConfig discards the cached kubeconfig, so that the next client
+// built picks up any credentials refreshed (and persisted) since it was read.
+func reloadClientConfig() {
+	clientConfig = clientcmd.NewInteractiveDeferredLoadingClientConfig(&loadingRules, &overrides, os.Stdin)
+}
+
 func restClientPool(cmd *cobra.Command, envName *string) (dynamic.ClientPool, discovery.DiscoveryInterface, error) {
 	if envName != nil {
 		err := overrideCluster(*envName)
@@ -263,12 +382,28 @@ func restClientPool(cmd *cobra.Command, envName *string) (dynamic.ClientPool, di
 type envSpec struct {
 	env   *string
 	files []string
+	// selector, if set, restricts the environment's components to those
+	// whose labels (in 'app.yaml') match it.
+	selector string
+	// labelSelector, if set, restricts the rendered objects to those whose
+	// own labels match it.
+	labelSelector string
+	// changedSince, if set, restricts the environment's components to those
+	// affected by the changes since this git revision.
+	changedSince string
+	// discovery, if set, is a client of the environment's cluster, from which
+	// the capabilities exposed to components are read; otherwise (or if the
+	// cluster cannot be reached), they are read from the environment's cached
+	// API specification.
+	discovery discovery.ServerResourcesInterface
 }
 
 // addEnvCmdFlags adds the flags that are common to the family of commands
 // whose form is `[<env>|-f <file-name>]`, e.g., `apply` and `delete`.
 func addEnvCmdFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringArrayP(flagFile, flagFileShort, nil, "Filename or directory that contains the configuration to apply (accepts YAML, JSON, and Jsonnet)")
+	cmd.PersistentFlags().String(flagSelector, "", "Only use the environment's components whose labels in 'app.yaml' match this selector (e.g., 'tier=frontend' or '!stateful')")
+	cmd.PersistentFlags().StringP(flagLabelSel, flagLabelSelShort, "", "Only use the rendered objects whose labels match this selector (e.g., 'app=guestbook')")
 }
 
 // parseEnvCmd parses the family of commands that come in the form `[<env>|-f
@@ -281,12 +416,103 @@ func parseEnvCmd(cmd *cobra.Command, args []string) (*envSpec, error) {
 		return nil, err
 	}
 
+	selector, err := flags.GetString(flagSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	labelSelector, err := flags.GetString(flagLabelSel)
+	if err != nil {
+		return nil, err
+	}
+
 	var env *string
 	if len(args) == 1 {
-		env = &args[0]
+		name := args[0]
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		if manager, err := metadata.Find(metadata.AbsPath(cwd)); err == nil {
+			name = resolveEnvName(manager, name)
+		}
+		env = &name
 	}
 
-	return &envSpec{env: env, files: files}, nil
+	return &envSpec{env: env, files: files, selector: selector, labelSelector: labelSelector}, nil
+}
+
+// resolveEnvName returns the name of the environment `name` refers to, which
+// may be one of its aliases. Names that refer to no environment are returned
+// unchanged, so that the command using them reports the error.
+func resolveEnvName(manager metadata.Manager, name string) string {
+	env, err := manager.GetEnvironment(name)
+	if err != nil {
+		return name
+	}
+	if env.Name != name {
+		log.Debugf("Resolved environment alias '%s' to '%s'", name, env.Name)
+	}
+	return env.Name
+}
+
+// forEachEnvironment wraps `run`, the RunE of a command of the form `[<env>|-f
+// <file-name>]`, so that it accepts glob patterns of environments (e.g.,
+// 'dev-*') and, if `several` is set, the names of several environments. `run`
+// is then called for each environment in turn, even if it fails for an
+// earlier one, and the outcome for each is reported.
+func forEachEnvironment(several bool, run func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		multiple := several && len(args) > 1
+		for _, arg := range args {
+			multiple = multiple || metadata.IsEnvironmentPattern(arg)
+		}
+		if !multiple {
+			return run(cmd, args)
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		manager, err := metadata.Find(metadata.AbsPath(cwd))
+		if err != nil {
+			return err
+		}
+		names, err := manager.MatchEnvironments(args)
+		if err != nil {
+			return err
+		}
+		log.Infof("Running '%s' for %d environment(s): %s", cmd.Name(), len(names), strings.Join(names, ", "))
+
+		failed, differ := []string{}, []string{}
+		results := make([]string, len(names))
+		for i, name := range names {
+			log.Infof("Running '%s' for environment '%s'", cmd.Name(), name)
+			switch err := run(cmd, []string{name}); err {
+			case nil:
+				results[i] = "succeeded"
+			case kubecfg.ErrDiffFound:
+				results[i] = "differs"
+				differ = append(differ, name)
+			default:
+				log.Errorf("'%s' failed for environment '%s':\n%v", cmd.Name(), name, err)
+				results[i] = "failed"
+				failed = append(failed, name)
+			}
+		}
+
+		for i, name := range names {
+			log.Infof("%s: %s", name, results[i])
+		}
+		if len(failed) != 0 {
+			return fmt.Errorf("'%s' failed for %d of %d environment(s): %s", cmd.Name(), len(failed), len(names), strings.Join(failed, ", "))
+		}
+		if len(differ) != 0 {
+			return kubecfg.ErrDiffFound
+		}
+		return nil
+	}
 }
 
 // overrideCluster ensures that the cluster URI specified in the environment is
@@ -309,39 +535,270 @@ func overrideCluster(envName string) error {
 		return err
 	}
 
+	//
+	// check to ensure that the environment we are trying to deploy to is
+	// created, and that the environment URI is located in kubeconfig.
+	//
+
+	env, err := metadataManager.GetEnvironment(envName)
+	if err != nil {
+		return err
+	}
+	if env.ClusterSelector != "" {
+		return fmt.Errorf("Environment '%s' is deployed to every cluster its selector '%s' matches in the cluster inventory; only 'apply' and 'delete' support such environments", env.Name, env.ClusterSelector)
+	}
+
+	uri, namespace, err := metadataManager.ExpandDestination(env)
+	if err != nil {
+		return err
+	}
+
+	if env.Context != "" {
+		if err := overrideClusterContext(env.Context, namespace); err != nil {
+			return fmt.Errorf("Attempting to deploy to environment '%s' with kubeconfig context '%s': %v", envName, env.Context, err)
+		}
+	} else if err := overrideClusterURI(uri, namespace); err != nil {
+		return fmt.Errorf("Attempting to deploy to environment '%s' at %s, but there are no clusters with that URI", envName, uri)
+	}
+	return overrideCredentials(metadataManager, env.Name)
+}
+
+// providedToken is the token `overrideCredentials` last obtained from a
+// credential provider, as opposed to one given with '--token'.
+var providedToken string
+
+// overrideCredentials authenticates to the cluster of the environment
+// `envName` with a token from the credential provider that 'app.yaml'
+// configures for it, if any, rather than with the credentials of kubeconfig.
+// The provider is asked each time, so calling it again (e.g., before
+// reconnecting) refreshes the token. A token given with '--token' takes
+// precedence.
+func overrideCredentials(manager metadata.Manager, envName string) error {
+	if overrides.AuthInfo.Token != "" && overrides.AuthInfo.Token != providedToken {
+		return nil
+	}
+
+	// Commands can operate on several environments; don't let the token of
+	// one leak into the next.
+	overrides.AuthInfo.Token = ""
+	providedToken = ""
+
+	spec, err := manager.EnvironmentCredentials(envName)
+	if err != nil || spec == nil {
+		return err
+	}
+
+	provider, err := credentials.New(spec)
+	if err != nil {
+		return fmt.Errorf("Invalid credentials for environment '%s': %v", envName, err)
+	}
+	token, err := provider.Token()
+	if err != nil {
+		return fmt.Errorf("Could not obtain credentials for environment '%s': %v", envName, err)
+	}
+
+	log.Debugf("Using credentials from provider '%s' for environment '%s'", spec.Provider, envName)
+	overrides.AuthInfo.Token = token
+	providedToken = token
+	return nil
+}
+
+// checkProtected returns an error if the environment `envName` is protected
+// (see 'ks env protect'), unless `--confirm` was given, or the user confirms
+// that they want to `action` it when asked on a terminal. A nil `envName`
+// (i.e., the command operates on files) is never protected.
+func checkProtected(cmd *cobra.Command, envName *string, action string) error {
+	if envName == nil {
+		return nil
+	}
+
+	confirmed, err := cmd.Flags().GetBool(flagConfirm)
+	if err != nil {
+		return err
+	}
+	if confirmed {
+		return nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	manager, err := metadata.Find(metadata.AbsPath(cwd))
+	if err != nil {
+		return err
+	}
+	env, err := manager.GetEnvironment(*envName)
+	if err != nil {
+		return err
+	}
+	if !env.Protected {
+		return nil
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("Environment '%s' is protected; pass --%s to %s it", env.Name, flagConfirm, action)
+	}
+	ok, err := confirm(os.Stdin, cmd.OutOrStderr(), fmt.Sprintf("Environment '%s' is protected. Really %s it?", env.Name, action))
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("Aborted; protected environment '%s' was left alone", env.Name)
+	}
+	return nil
+}
+
+// confirm writes `prompt` to `out`, and reads a yes/no answer from `in`.
+// Anything other than 'y' or 'yes' counts as no.
+func confirm(in io.Reader, out io.Writer, prompt string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", prompt)
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// flagContext is the --context given on the command line, saved the first time
+// the kubeconfig context of an environment overrides it.
+var flagContext *string
+
+// overrideClusterContext overrides the client-go --context flag with the
+// kubeconfig context `name` and, if `namespace` is non-empty, the --namespace
+// flag with `namespace`. The --cluster flag is cleared, so that the cluster
+// and user of the context are used.
+func overrideClusterContext(name, namespace string) error {
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := rawConfig.Contexts[name]; !ok {
+		return fmt.Errorf("There is no context '%s' in kubeconfig", name)
+	}
+
+	if flagContext == nil {
+		current := overrides.CurrentContext
+		flagContext = &current
+	}
+
+	log.Debugf("Overwriting --context flag with '%s'", name)
+	overrides.CurrentContext = name
+	overrides.Context.Cluster = ""
+	if len(namespace) != 0 {
+		log.Debugf("Overwriting --namespace flag with '%s'", namespace)
+		overrides.Context.Namespace = namespace
+	}
+	return nil
+}
+
+// contextServer returns the server of the cluster of the kubeconfig context
+// `name`.
+func contextServer(name string) (string, error) {
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return "", err
+	}
+	kubeContext, ok := rawConfig.Contexts[name]
+	if !ok {
+		return "", fmt.Errorf("There is no context '%s' in kubeconfig", name)
+	}
+	cluster, ok := rawConfig.Clusters[kubeContext.Cluster]
+	if !ok {
+		return "", fmt.Errorf("Context '%s' refers to cluster '%s', which does not exist in kubeconfig", name, kubeContext.Cluster)
+	}
+	return cluster.Server, nil
+}
+
+// overrideClusterURI overrides the client-go --cluster flag with the
+// kubeconfig cluster whose server is `uri` and, if `namespace` is non-empty,
+// the --namespace flag with `namespace`.
+func overrideClusterURI(uri, namespace string) error {
 	rawConfig, err := clientConfig.RawConfig()
 	if err != nil {
 		return err
 	}
 
+	// An earlier environment may have selected its own context.
+	if flagContext != nil {
+		overrides.CurrentContext = *flagContext
+	}
+
 	var clusterURIs = make(map[string]string)
 	for name, cluster := range rawConfig.Clusters {
 		clusterURIs[cluster.Server] = name
 	}
 
-	//
-	// check to ensure that the environment we are trying to deploy to is
-	// created, and that the environment URI is located in kubeconfig.
-	//
+	log.Debugf("Validating deployment at '%s' with cluster URIs '%v'", uri, reflect.ValueOf(clusterURIs).MapKeys())
+	clusterName, ok := clusterURIs[uri]
+	if !ok {
+		return fmt.Errorf("There are no clusters in kubeconfig with URI '%s'", uri)
+	}
 
-	log.Debugf("Validating deployment at '%s' with cluster URIs '%v'", envName, reflect.ValueOf(clusterURIs).MapKeys())
-	env, err := metadataManager.GetEnvironment(envName)
+	log.Debugf("Overwriting --cluster flag with '%s'", clusterName)
+	overrides.Context.Cluster = clusterName
+	if len(namespace) != 0 {
+		log.Debugf("Overwriting --namespace flag with '%s'", namespace)
+		overrides.Context.Namespace = namespace
+	}
+	return nil
+}
+
+// overrideServerCredentials authenticates to the cluster at `uri` with the
+// credentials kubeconfig has for it, i.e., those of the user of a context for
+// that cluster, if there is one, rather than with the token of an
+// environment's credential provider or '--token', which are meant for the
+// environment's own cluster. The returned function restores the credentials
+// in use before.
+func overrideServerCredentials(uri string) (func(), error) {
+	rawConfig, err := clientConfig.RawConfig()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if _, ok := clusterURIs[env.URI]; ok {
-		clusterName := clusterURIs[env.URI]
-		log.Debugf("Overwriting --cluster flag with '%s'", clusterName)
-		overrides.Context.Cluster = clusterName
-		if len(env.Namespace) != 0 {
-			log.Debugf("Overwriting --namespace flag with '%s'", env.Namespace)
-			overrides.Context.Namespace = env.Namespace
+	token, user, provided := overrides.AuthInfo.Token, overrides.Context.AuthInfo, providedToken
+	restore := func() {
+		overrides.AuthInfo.Token, overrides.Context.AuthInfo, providedToken = token, user, provided
+	}
+	overrides.AuthInfo.Token = ""
+	providedToken = ""
+
+	contexts := []string{}
+	for name, context := range rawConfig.Contexts {
+		if cluster, ok := rawConfig.Clusters[context.Cluster]; ok && cluster.Server == uri {
+			contexts = append(contexts, name)
 		}
-		return nil
+	}
+	sort.Strings(contexts)
+	if len(contexts) == 0 {
+		log.Debugf("No kubeconfig context for the cluster at %s; using the user of the current context", uri)
+		return restore, nil
 	}
 
-	return fmt.Errorf("Attempting to deploy to environment '%s' at %s, but there are no clusters with that URI", envName, env.URI)
+	authInfo := rawConfig.Contexts[contexts[0]].AuthInfo
+	log.Debugf("Overwriting --user flag with '%s' of context '%s'", authInfo, contexts[0])
+	overrides.Context.AuthInfo = authInfo
+	return restore, nil
+}
+
+// clusterCapabilities returns the capabilities of the cluster of `envSpec`,
+// or nil if it has no client of the cluster, or the cluster cannot be reached.
+func clusterCapabilities(envSpec *envSpec) *metadata.Capabilities {
+	if envSpec.discovery == nil {
+		return nil
+	}
+	capabilities, err := metadata.DiscoverCapabilities(envSpec.discovery)
+	if err != nil {
+		log.Debugf("Using the cached API specification for the capabilities of environment '%s':\n%v", *envSpec.env, err)
+		return nil
+	}
+	return capabilities
 }
 
 // expandEnvCmdObjs finds and expands templates for the family of commands of
@@ -355,6 +812,14 @@ func expandEnvCmdObjs(cmd *cobra.Command, envSpec *envSpec, cwd metadata.AbsPath
 		return nil, err
 	}
 
+	labelSelector := labels.Everything()
+	if envSpec.labelSelector != "" {
+		labelSelector, err = labels.Parse(envSpec.labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse label selector '%s':\n%v", envSpec.labelSelector, err)
+		}
+	}
+
 	//
 	// Get all filenames that contain templates to expand. Importantly, we need to
 	// enforce the form `[<env-name>|-f <file-name>]`; that is, we need to make
@@ -368,24 +833,62 @@ func expandEnvCmdObjs(cmd *cobra.Command, envSpec *envSpec, cwd metadata.AbsPath
 		return nil, fmt.Errorf("Must specify either an environment or a file list, or both")
 	}
 
+	if envSpec.selector != "" && (!envPresent || filesPresent) {
+		return nil, fmt.Errorf("'--%s' selects among the components of an environment, and cannot be used with '--%s'", flagSelector, flagFile)
+	}
+	if envSpec.changedSince != "" && (!envPresent || filesPresent) {
+		return nil, fmt.Errorf("'--%s' selects among the components of an environment, and cannot be used with '--%s'", flagChangedSince, flagFile)
+	}
+
 	fileNames := envSpec.files
+	var manager metadata.Manager
 	if envPresent {
-		manager, err := metadata.Find(cwd)
+		manager, err = metadata.Find(cwd)
 		if err != nil {
 			return nil, err
 		}
 
-		libPath, envLibPath, envComponentPath := manager.LibPaths(*envSpec.env)
-		expander.FlagJpath = append([]string{string(libPath), string(envLibPath)}, expander.FlagJpath...)
+		// Settings given on the command line take precedence over the app's
+		// and the environment's.
+		expander, err = manager.Expander(*envSpec.env, *expander, clusterCapabilities(envSpec))
+		if err != nil {
+			return nil, err
+		}
 
 		if !filesPresent {
-			componentPaths, err := manager.ComponentPaths()
+			componentPaths, err := manager.EnvironmentComponentPaths(*envSpec.env, envSpec.selector)
+			if err != nil {
+				return nil, err
+			}
+			if envSpec.changedSince != "" {
+				componentPaths, err = manager.ComponentsChangedSince(*envSpec.env, envSpec.changedSince, componentPaths, expander.FlagJpath)
+				if err != nil {
+					return nil, err
+				}
+			}
+			mixins, err := manager.ComponentMixins()
 			if err != nil {
 				return nil, err
 			}
-			baseObjExtCode := fmt.Sprintf("%s=%s", metadata.ComponentsExtCodeKey, constructBaseObj(componentPaths))
+			baseObjExtCode := fmt.Sprintf("%s=%s", metadata.ComponentsExtCodeKey, metadata.ComponentsObj(componentPaths, mixins))
 			expander.ExtCodes = append([]string{baseObjExtCode}, expander.ExtCodes...)
-			fileNames = []string{string(envComponentPath)}
+
+			// Expanding the environment's components (rather than files named by
+			// the user) lets us label each object with its component.
+			_, _, envComponentPath := manager.LibPaths(*envSpec.env)
+			objs, err := expander.ExpandComponents(string(envComponentPath))
+			if err != nil {
+				return nil, err
+			}
+			namespaces, err := manager.ComponentNamespaces(*envSpec.env)
+			if err != nil {
+				return nil, err
+			}
+			utils.SetComponentNamespaces(objs, namespaces)
+			if err := manager.CheckBudgets(*envSpec.env, objs); err != nil {
+				return nil, err
+			}
+			return metadata.SelectObjects(objs, labelSelector), nil
 		}
 	}
 
@@ -393,27 +896,14 @@ func expandEnvCmdObjs(cmd *cobra.Command, envSpec *envSpec, cwd metadata.AbsPath
 	// Expand templates.
 	//
 
-	return expander.Expand(fileNames)
-}
-
-// constructBaseObj constructs the base Jsonnet object that represents k-v
-// pairs of component name -> component imports. For example,
-//
-//   {
-//      foo: import "components/foo.jsonnet"
-//   }
-func constructBaseObj(paths []string) string {
-	var obj bytes.Buffer
-	obj.WriteString("{\n")
-	for _, p := range paths {
-		ext := path.Ext(p)
-		if path.Ext(p) != ".jsonnet" {
-			continue
+	objs, err := expander.Expand(fileNames)
+	if err != nil {
+		return nil, err
+	}
+	if envPresent {
+		if err := manager.CheckBudgets(*envSpec.env, objs); err != nil {
+			return nil, err
 		}
-
-		name := strings.TrimSuffix(path.Base(p), ext)
-		fmt.Fprintf(&obj, "  %s: import \"%s\",\n", name, p)
 	}
-	obj.WriteString("}\n")
-	return obj.String()
+	return metadata.SelectObjects(objs, labelSelector), nil
 }
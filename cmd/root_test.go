@@ -16,60 +16,105 @@
 package cmd
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
-func TestConstructBaseObj(t *testing.T) {
+func TestConfirm(t *testing.T) {
 	tests := []struct {
-		inputPaths []string
-		expected   string
+		input    string
+		expected bool
 	}{
-		// test simple case with 1 .jsonnet path
-		{
-			[]string{
-				"some/fake/path/foo.jsonnet",
-			},
-			`{
-  foo: import "some/fake/path/foo.jsonnet",
-}
-`,
-		},
-		// test multiple .jsonnet path case
-		{
-			[]string{
-				"some/fake/path/foo.jsonnet",
-				"another/fake/path/bar.jsonnet",
-			},
-			`{
-  foo: import "some/fake/path/foo.jsonnet",
-  bar: import "another/fake/path/bar.jsonnet",
-}
-`,
-		},
-		// test zero path case
-		{
-			[]string{},
-			`{
-}
-`,
-		},
-		// test non-jsonnet extension case
-		{
-			[]string{
-				"some/fake/path/foo.libsonnet",
-				"another/fake/path/bar.jsonnet",
-			},
-			`{
-  bar: import "another/fake/path/bar.jsonnet",
-}
-`,
-		},
+		{"y\n", true},
+		{"YES\n", true},
+		{" yes ", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+		{"yep\n", false},
 	}
 
-	for _, s := range tests {
-		res := constructBaseObj(s.inputPaths)
-		if res != s.expected {
-			t.Errorf("Wrong object constructed\n  expected: %v\n  got: %v", s.expected, res)
+	for _, test := range tests {
+		var out bytes.Buffer
+		ok, err := confirm(strings.NewReader(test.input), &out, "Proceed?")
+		if err != nil {
+			t.Fatalf("Unexpected error for input %q: %v", test.input, err)
+		}
+		if ok != test.expected {
+			t.Errorf("Expected input %q to be confirmed=%v, got %v", test.input, test.expected, ok)
+		}
+		if out.String() != "Proceed? [y/N] " {
+			t.Errorf("Unexpected prompt %q", out.String())
 		}
 	}
 }
+
+func TestOverrideServerCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ks-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	err = ioutil.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster: {server: "https://prod.example.com"}
+- name: ops
+  cluster: {server: "https://ops.example.com"}
+contexts:
+- name: prod
+  context: {cluster: prod, user: prod-admin}
+- name: ops
+  context: {cluster: ops, user: ops-admin}
+users:
+- name: prod-admin
+  user: {token: prod-token}
+- name: ops-admin
+  user: {token: ops-token}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedRules, savedOverrides, savedProvided := loadingRules, overrides, providedToken
+	defer func() {
+		loadingRules, overrides, providedToken = savedRules, savedOverrides, savedProvided
+		reloadClientConfig()
+	}()
+	loadingRules.ExplicitPath = kubeconfig
+	reloadClientConfig()
+
+	// The environment's credential provider issued a token for its cluster.
+	overrides.AuthInfo.Token = "provided-token"
+	providedToken = "provided-token"
+
+	if err := overrideClusterURI("https://ops.example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	restore, err := overrideServerCredentials("https://ops.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadClientConfig()
+
+	conf, err := clientConfig.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Host != "https://ops.example.com" || conf.BearerToken != "ops-token" {
+		t.Errorf("Expected the cluster at https://ops.example.com with token 'ops-token', got %s with token '%s'", conf.Host, conf.BearerToken)
+	}
+
+	restore()
+	if overrides.AuthInfo.Token != "provided-token" || providedToken != "provided-token" || overrides.Context.AuthInfo != "" {
+		t.Errorf("Expected the environment's credentials to be restored, got token '%s' and user '%s'", overrides.AuthInfo.Token, overrides.Context.AuthInfo)
+	}
+}
@@ -39,7 +39,7 @@ func init() {
 var showCmd = &cobra.Command{
 	Use:   "show [<env>|-f <file-or-dir>]",
 	Short: "Show expanded resource definitions",
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: forEachEnvironment(true, func(cmd *cobra.Command, args []string) error {
 		if len(args) > 1 {
 			return fmt.Errorf("'show' takes at most a single argument, that is the name of the environment")
 		}
@@ -71,5 +71,16 @@ var showCmd = &cobra.Command{
 		}
 
 		return c.Run(objs, cmd.OutOrStdout())
-	},
+	}),
+	Long: `Show the resource definitions of an environment, or of files, expanded as
+they would be applied.
+
+Several environments can be shown at once, by naming each of them, or with glob
+patterns over environment names, e.g., 'dev-*' or 'us-west/*'. Their
+definitions are written one environment after another.`,
+	Example: `  # Show the resource definitions of the 'dev' environment.
+  ks show dev
+
+  # Show the resource definitions of every environment under 'us-west/'.
+  ks show 'us-west/*'`,
 }
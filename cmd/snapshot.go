@@ -0,0 +1,144 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+)
+
+func init() {
+	RootCmd.AddCommand(snapshotCmd)
+
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotShowCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Inspect the snapshots recorded by 'apply'",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("Command 'snapshot' requires a subcommand\n\n%s", cmd.UsageString())
+	},
+	Long: `Inspect the snapshots recorded each time 'ks apply <env-name>' succeeds. A
+snapshot identifies every object applied to the environment, along with a hash
+of its contents, and the time it was applied. Snapshots are kept in
+'.ksonnet/snapshots/<env-name>/'.
+
+All subcommands write JSON, so that external tools (e.g., dashboards tracking
+deployment frequency and change size) can consume them directly.`,
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list <env-name>",
+	Short: "List the snapshots of an environment",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("'snapshot list' takes a single argument, that is the name of the environment")
+		}
+
+		manager, err := snapshotManager()
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewSnapshotListCmd(resolveEnvName(manager, args[0]), manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `List the ID, time, and object count of each snapshot of an environment,
+oldest first.`,
+	Example: `  # List the snapshots of the 'us-west/staging' environment.
+  ks snapshot list us-west/staging`,
+}
+
+var snapshotShowCmd = &cobra.Command{
+	Use:   "show <env-name> <snapshot-id>",
+	Short: "Display a snapshot of an environment",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("'snapshot show' takes two arguments, the name of the environment and the ID of the snapshot, respectively")
+		}
+
+		manager, err := snapshotManager()
+		if err != nil {
+			return err
+		}
+
+		c, err := kubecfg.NewSnapshotShowCmd(resolveEnvName(manager, args[0]), args[1], manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `Display every object in a snapshot, along with the hash of its contents.`,
+	Example: `  # Display a snapshot of the 'us-west/staging' environment.
+  ks snapshot show us-west/staging 20171001T120000.000Z`,
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff <env-name> [<from-snapshot-id> <to-snapshot-id>]",
+	Short: "Compare two snapshots of an environment",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 && len(args) != 3 {
+			return fmt.Errorf("'snapshot diff' takes either the name of the environment, or the name of the environment and the IDs of two snapshots")
+		}
+
+		manager, err := snapshotManager()
+		if err != nil {
+			return err
+		}
+
+		var fromID, toID string
+		if len(args) == 3 {
+			fromID, toID = args[1], args[2]
+		}
+
+		c, err := kubecfg.NewSnapshotDiffCmd(resolveEnvName(manager, args[0]), fromID, toID, manager)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+	Long: `Compare two snapshots of an environment, listing the objects that were
+added, removed, and changed between them, and the time elapsed. If no snapshot
+IDs are given, the two most recent snapshots are compared.`,
+	Example: `  # Compare the two most recent snapshots of 'us-west/staging'.
+  ks snapshot diff us-west/staging
+
+  # Compare two specific snapshots of 'us-west/staging'.
+  ks snapshot diff us-west/staging 20171001T120000.000Z 20171002T090000.000Z`,
+}
+
+func snapshotManager() (metadata.Manager, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata.Find(metadata.AbsPath(cwd))
+}
@@ -35,6 +35,7 @@ func init() {
 	updateCmd.PersistentFlags().Bool(flagSkipGc, false, "Don't perform garbage collection, even with --"+flagGcTag)
 	updateCmd.PersistentFlags().String(flagGcTag, "", "Add this tag to updated objects, and garbage collect existing objects with this tag and not in config")
 	updateCmd.PersistentFlags().Bool(flagDryRun, false, "Perform only read-only operations")
+	updateCmd.PersistentFlags().Bool(flagConfirm, false, "Update a protected environment without asking for confirmation")
 }
 
 var updateCmd = &cobra.Command{
@@ -79,21 +80,27 @@ local configuration. Accepts JSON, YAML, or Jsonnet.`,
 		}
 		wd := metadata.AbsPath(cwd)
 
-		c.ClientPool, c.Discovery, err = restClientPool(cmd, nil)
+		envSpec, err := parseEnvCmd(cmd, args)
 		if err != nil {
 			return err
 		}
+		if !c.DryRun {
+			if err := checkProtected(cmd, envSpec.env, "update"); err != nil {
+				return err
+			}
+		}
 
-		c.Namespace, err = namespace()
+		c.ClientPool, c.Discovery, err = restClientPool(cmd, nil)
 		if err != nil {
 			return err
 		}
 
-		envSpec, err := parseEnvCmd(cmd, args)
+		c.Namespace, err = namespace()
 		if err != nil {
 			return err
 		}
 
+		envSpec.discovery = c.Discovery
 		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
 		if err != nil {
 			return err
@@ -18,11 +18,14 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/ksonnet/ksonnet/metadata"
 	"github.com/ksonnet/ksonnet/pkg/kubecfg"
+	"github.com/ksonnet/ksonnet/utils"
 )
 
 func init() {
@@ -30,6 +33,7 @@ func init() {
 	addEnvCmdFlags(validateCmd)
 	bindJsonnetFlags(validateCmd)
 	bindClientGoFlags(validateCmd)
+	validateCmd.PersistentFlags().StringP(flagFormat, "o", kubecfg.ValidateFormatText, "Output format.  Supported values are: text, sarif")
 }
 
 var validateCmd = &cobra.Command{
@@ -44,6 +48,11 @@ var validateCmd = &cobra.Command{
 
 		c := kubecfg.ValidateCmd{}
 
+		c.Format, err = cmd.Flags().GetString(flagFormat)
+		if err != nil {
+			return err
+		}
+
 		cwd, err := os.Getwd()
 		if err != nil {
 			return err
@@ -60,18 +69,57 @@ var validateCmd = &cobra.Command{
 			return err
 		}
 
+		envSpec.discovery = c.Discovery
 		objs, err := expandEnvCmdObjs(cmd, envSpec, wd)
 		if err != nil {
 			return err
 		}
 
+		c.Source, err = validateSource(envSpec, wd)
+		if err != nil {
+			return err
+		}
+
+		c.ComponentSources, err = componentSources(envSpec, wd)
+		if err != nil {
+			return err
+		}
+
+		c.CRDs, err = vendoredCRDs(wd)
+		if err != nil {
+			return err
+		}
+
+		c.Components, err = componentSpecs(wd)
+		if err != nil {
+			return err
+		}
+
 		return c.Run(objs, cmd.OutOrStdout())
 	},
 	Long: `Validate that an application or file is compliant with the Kubernetes
 specification.
 
 ksonnet applications are accepted, as well as normal JSON, YAML, and Jsonnet
-files.`,
+files.
+
+'validate' exits with status 11 if any object does not conform to the
+specification, and with status 12 if every object it could check is valid, but
+the specification of some other object could not be retrieved from the cluster.
+
+Custom resources whose CustomResourceDefinition is bundled with a vendored
+library (in the library's 'crds/' directory) are validated against that
+definition's schema, so they can be checked even if the cluster is unreachable,
+or the CRD has not been installed in it yet.
+
+Objects annotated with 'ksonnet.io/skip-validate: "true"' (e.g., because they
+rely on server-side defaulting), and the objects of components with
+'skipValidate: true' in 'app.yaml', are not validated; the objects skipped are
+listed at the end.
+
+With '--format=sarif', the problems found are also written to standard output
+as a SARIF log, which code scanning tools can use to annotate the component or
+file the objects came from.`,
 	Example: `  # Validate all resources described in a ksonnet application, expanding
   # ksonnet code with 'dev' environment where necessary (i.e., not YAML, JSON,
   # or non-ksonnet Jsonnet code).
@@ -86,5 +134,86 @@ files.`,
 
   # Validate resources described in a Jsonnet file. Does not expand using
   # environment bindings.
-  ksonnet validate -f ./pod.jsonnet`,
+  ksonnet validate -f ./pod.jsonnet
+
+  # Validate the 'dev' environment, and write the results as a SARIF log.
+  ksonnet validate dev --format=sarif > validate.sarif`,
+}
+
+// validateSource returns the file that the objects being validated were
+// expanded from, relative to the working directory, or the empty string if
+// there is no single such file.
+func validateSource(envSpec *envSpec, wd metadata.AbsPath) (string, error) {
+	var source string
+	switch {
+	case len(envSpec.files) == 1:
+		source = envSpec.files[0]
+	case len(envSpec.files) == 0 && envSpec.env != nil:
+		manager, err := metadata.Find(wd)
+		if err != nil {
+			return "", err
+		}
+		_, _, envComponentPath := manager.LibPaths(*envSpec.env)
+		source = string(envComponentPath)
+	default:
+		return "", nil
+	}
+
+	if !filepath.IsAbs(source) {
+		return filepath.ToSlash(source), nil
+	}
+	rel, err := filepath.Rel(string(wd), source)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// componentSources returns the files of the components of the application at
+// `wd` (relative to `wd`), by component name, so that problems can be located
+// in the component that produced the object. It returns nil when validating
+// files, rather than an environment.
+func componentSources(envSpec *envSpec, wd metadata.AbsPath) (map[string]string, error) {
+	if len(envSpec.files) != 0 || envSpec.env == nil {
+		return nil, nil
+	}
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := manager.ComponentPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]string{}
+	for _, p := range paths {
+		if filepath.Ext(p) != ".jsonnet" {
+			continue
+		}
+		rel, err := filepath.Rel(string(wd), p)
+		if err != nil {
+			return nil, err
+		}
+		sources[strings.TrimSuffix(filepath.Base(p), ".jsonnet")] = filepath.ToSlash(rel)
+	}
+	return sources, nil
+}
+
+// vendoredCRDs loads the CustomResourceDefinitions bundled with the libraries
+// vendored by the application at `wd`. It returns nil if `wd` is not in a
+// ksonnet application.
+func vendoredCRDs(wd metadata.AbsPath) (*utils.CRDSchemas, error) {
+	manager, err := metadata.Find(wd)
+	if err != nil {
+		// Not in an application (e.g., 'ks validate -f'), so there are none.
+		return nil, nil
+	}
+
+	paths, err := manager.CRDPaths()
+	if err != nil {
+		return nil, err
+	}
+	return utils.LoadCRDSchemas(paths)
 }
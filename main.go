@@ -30,7 +30,13 @@ var version = "(dev build)"
 func main() {
 	cmd.Version = version
 
+	cmd.RootCmd.SetArgs(cmd.PluginArgs(os.Args[1:]))
 	if err := cmd.RootCmd.Execute(); err != nil {
+		if exitErr, ok := err.(*kubecfg.PluginExitError); ok {
+			// The plugin has reported its own errors.
+			os.Exit(exitErr.Code)
+		}
+
 		// PersistentPreRunE may not have been run for early
 		// errors, like invalid command line flags.
 		logFmt := cmd.NewLogFormatter(log.StandardLogger().Out)
@@ -40,6 +46,10 @@ func main() {
 		switch err {
 		case kubecfg.ErrDiffFound:
 			os.Exit(10)
+		case kubecfg.ErrValidationFailed:
+			os.Exit(11)
+		case kubecfg.ErrSchemaUnavailable:
+			os.Exit(12)
 		default:
 			os.Exit(1)
 		}
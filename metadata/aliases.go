@@ -0,0 +1,108 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// SetEnvironmentAliases replaces the aliases of the environment `name` with
+// `aliases`, e.g., so that 'prod' can be used in place of
+// 'us-east-1/production'. An empty list removes every alias.
+//
+// An alias must be a valid environment name, and may be neither the name of
+// an environment, nor an alias of another environment.
+func (m *manager) SetEnvironmentAliases(name string, aliases []string) error {
+	env, err := m.GetEnvironment(name)
+	if err != nil {
+		return err
+	}
+	name = env.Name
+
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return err
+	}
+
+	cleaned := []string{}
+	seen := map[string]bool{}
+	for _, alias := range aliases {
+		if alias == "" || seen[alias] {
+			continue
+		}
+		seen[alias] = true
+
+		if !isValidName(alias) {
+			return fmt.Errorf("Alias '%s' is not valid; must not contain punctuation, spaces, or begin or end with a slash", alias)
+		}
+		for _, other := range envs {
+			if other.Name == alias {
+				return fmt.Errorf("Alias '%s' is already the name of an environment", alias)
+			}
+		}
+		if owner := aliasedEnvironment(envs, alias); owner != nil && owner.Name != name {
+			return fmt.Errorf("Alias '%s' is already an alias of environment '%s'", alias, owner.Name)
+		}
+		cleaned = append(cleaned, alias)
+	}
+
+	env.Aliases = cleaned
+	specData, err := json.MarshalIndent(environmentSpec(env), "", "  ")
+	if err != nil {
+		return err
+	}
+	specPath := appendToAbsPath(m.environmentsPath, name, specFilename)
+	if err := afero.WriteFile(m.appFS, string(specPath), specData, defaultFilePermissions); err != nil {
+		return err
+	}
+
+	if len(cleaned) == 0 {
+		log.Infof("Environment '%s' now has no aliases", name)
+	} else {
+		log.Infof("Environment '%s' now has aliases %s", name, quoteNames(cleaned))
+	}
+	return nil
+}
+
+// aliasedEnvironment returns the environment among `envs` that has the alias
+// `alias`, or nil if there is none.
+func aliasedEnvironment(envs []*Environment, alias string) *Environment {
+	for _, env := range envs {
+		for _, a := range env.Aliases {
+			if a == alias {
+				return env
+			}
+		}
+	}
+	return nil
+}
+
+// checkAliasAvailable returns an error if `name`, which is about to become the
+// name of an environment, is an alias of some existing environment.
+func (m *manager) checkAliasAvailable(name string) error {
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return err
+	}
+	if owner := aliasedEnvironment(envs, name); owner != nil {
+		return fmt.Errorf("Environment name '%s' is already an alias of environment '%s'", name, owner.Name)
+	}
+	return nil
+}
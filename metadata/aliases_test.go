@@ -0,0 +1,84 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvironmentAliases(t *testing.T) {
+	m := mockEnvironments(t, "test-env-aliases")
+
+	if err := m.SetEnvironmentAliases(mockEnvName2, []string{"prod", "p", "prod"}); err != nil {
+		t.Fatalf("Failed to set aliases:\n%v", err)
+	}
+
+	env, err := m.GetEnvironment("prod")
+	if err != nil {
+		t.Fatalf("Failed to get environment by alias:\n%v", err)
+	}
+	if env.Name != mockEnvName2 {
+		t.Errorf("Expected alias 'prod' to resolve to '%s', got '%s'", mockEnvName2, env.Name)
+	}
+	if expected := []string{"prod", "p"}; !reflect.DeepEqual(env.Aliases, expected) {
+		t.Errorf("Expected aliases %v, got %v", expected, env.Aliases)
+	}
+
+	chain, err := m.EnvironmentChain("p")
+	if err != nil {
+		t.Fatalf("Failed to get environment chain by alias:\n%v", err)
+	}
+	if len(chain) == 0 || chain[0].Name != mockEnvName2 {
+		t.Errorf("Expected chain of alias 'p' to start at '%s', got %v", mockEnvName2, chain)
+	}
+
+	// Setting fields through an alias updates the aliased environment, and
+	// keeps its aliases.
+	if err := m.SetEnvironment("prod", &Environment{Namespace: "production"}); err != nil {
+		t.Fatalf("Failed to set environment by alias:\n%v", err)
+	}
+	env, err = m.GetEnvironment(mockEnvName2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Namespace != "production" || len(env.Aliases) != 2 {
+		t.Errorf("Expected namespace 'production' and 2 aliases, got '%s' and %v", env.Namespace, env.Aliases)
+	}
+
+	invalid := map[string]string{
+		"prod":       "Alias 'prod' is already an alias of environment 'us-west/prod'",
+		mockEnvName3: "Alias 'us-east/test' is already the name of an environment",
+		"bad alias":  "Alias 'bad alias' is not valid; must not contain punctuation, spaces, or begin or end with a slash",
+	}
+	for alias, expected := range invalid {
+		err := m.SetEnvironmentAliases(mockEnvName, []string{alias})
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected setting alias '%s' to fail with '%s', got %v", alias, expected, err)
+		}
+	}
+
+	if err := m.SetEnvironment(mockEnvName, &Environment{Name: "prod"}); err == nil {
+		t.Errorf("Expected renaming an environment to an alias to fail")
+	}
+
+	if err := m.SetEnvironmentAliases("prod", nil); err != nil {
+		t.Fatalf("Failed to clear aliases:\n%v", err)
+	}
+	if _, err := m.GetEnvironment("prod"); err == nil {
+		t.Errorf("Expected cleared alias to no longer resolve")
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/template"
+)
+
+const appYAMLFile = "app.yaml"
+
+// JPathEnvVar names the environment variable that lists extra Jsonnet library
+// search paths for every application, separated as in `$PATH`.
+const JPathEnvVar = "KS_JPATH"
+
+// AppSpec represents the contents of the optional `app.yaml` file at the root
+// of a ksonnet application, which holds application-wide configuration.
+type AppSpec struct {
+	// MinKsVersion, if set, is the oldest version of ks that may operate on
+	// the application, e.g., `0.9.0`.
+	MinKsVersion string `json:"minKsVersion,omitempty"`
+	// Requires lists the features (see `AppFeatures`) the application relies
+	// on, so that versions of ks that lack them refuse to operate on it.
+	Requires []string `json:"requires,omitempty"`
+	// EnvironmentRegistry, if set, points at a git repository holding
+	// environment definitions that are shared by many applications.
+	EnvironmentRegistry *EnvironmentRegistrySpec `json:"environmentRegistry,omitempty"`
+	// LibPaths are extra Jsonnet library search paths (absolute, or relative
+	// to the application root), e.g., a directory of libsonnet utilities
+	// shared by the applications of a monorepo.
+	LibPaths []string `json:"libPaths,omitempty"`
+	// Components maps the names of components to their settings.
+	Components map[string]*ComponentSpec `json:"components,omitempty"`
+	// Jsonnet holds the default resource limits of Jsonnet evaluations.
+	Jsonnet *JsonnetSpec `json:"jsonnet,omitempty"`
+	// Budgets limit the number and size of the objects an environment
+	// renders.
+	Budgets *BudgetSpec `json:"budgets,omitempty"`
+	// Credentials maps the names of environments to where the credentials
+	// for their clusters come from. Environments without an entry use those
+	// of the environment they inherit from, if any, or else kubeconfig's.
+	Credentials map[string]*CredentialSpec `json:"credentials,omitempty"`
+	// EnvironmentDefaults holds the values `ks env add` uses when they are
+	// not given on the command line.
+	EnvironmentDefaults *EnvironmentDefaultsSpec `json:"environmentDefaults,omitempty"`
+	// SpecSources configures where the OpenAPI specifications that
+	// ksonnet-lib is generated from are retrieved from.
+	SpecSources *SpecSourcesSpec `json:"specSources,omitempty"`
+	// PluginsDir is a directory (absolute, or relative to the application
+	// root) of the application's own `ks` plugins, which take precedence
+	// over those on the `PATH`.
+	PluginsDir string `json:"pluginsDir,omitempty"`
+	// Extensions are the top-level fields that belong to other tools (see
+	// `extensionPrefix`).
+	Extensions Extensions `json:"-"`
+}
+
+// JsonnetSpec holds the default resource limits of the application's Jsonnet
+// evaluations, which may be overridden on the command line. For example:
+//
+//	jsonnet:
+//	  maxStack: 200
+//	  timeout: 30s
+type JsonnetSpec struct {
+	// MaxStack is the maximum number of Jsonnet stack frames (roughly, the
+	// maximum depth of recursion).
+	MaxStack uint `json:"maxStack,omitempty"`
+	// Timeout is the longest a single evaluation may run, as a duration
+	// (e.g., `30s`, or `2m`).
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Limits returns the limits described by `js`. A nil spec sets no limits.
+func (js *JsonnetSpec) Limits() (template.Limits, error) {
+	limits := template.Limits{}
+	if js == nil {
+		return limits, nil
+	}
+
+	limits.MaxStack = js.MaxStack
+	if js.Timeout != "" {
+		timeout, err := time.ParseDuration(js.Timeout)
+		if err != nil {
+			return limits, fmt.Errorf("Invalid 'jsonnet.timeout' in '%s': %v", appYAMLFile, err)
+		} else if timeout < 0 {
+			return limits, fmt.Errorf("Invalid 'jsonnet.timeout' in '%s': must not be negative", appYAMLFile)
+		}
+		limits.Timeout = timeout
+	}
+	return limits, nil
+}
+
+// ComponentSpec holds the settings of a single component in `app.yaml`. For
+// example:
+//
+//	components:
+//	  redis:
+//	    labels:
+//	      tier: backend
+//	      stateful: "true"
+//	    health:
+//	    - kind: RedisCluster
+//	      ready: object.status.phase == "Running"
+//	    mixins:
+//	    - lib/ha.libsonnet
+type ComponentSpec struct {
+	// Labels tag the component, so that commands can select the components
+	// they operate on with a label selector (e.g., `tier=frontend`, or
+	// `!stateful`).
+	Labels map[string]string `json:"labels,omitempty"`
+	// Health lists custom readiness criteria for objects of the component,
+	// for kinds (e.g., custom resources) whose readiness `ks` cannot infer.
+	Health []*HealthPolicy `json:"health,omitempty"`
+	// SkipValidate and SkipDiff exclude every object of the component from
+	// 'ks validate' and 'ks diff', like the `ksonnet.io/skip-validate` and
+	// `ksonnet.io/skip-diff` annotations do for single objects.
+	SkipValidate bool `json:"skipValidate,omitempty"`
+	SkipDiff     bool `json:"skipDiff,omitempty"`
+	// JobRerun decides what 'ks apply' does with the Jobs and CronJobs of the
+	// component that already exist, since most of their fields cannot be
+	// changed: one of `JobRerunFail` (the default), `JobRerunSkip` or
+	// `JobRerunRecreate`.
+	JobRerun string `json:"jobRerun,omitempty"`
+	// Mixins are Jsonnet files (absolute, or relative to the application
+	// root) evaluating to objects that are merged, in order, onto each object
+	// of the component, e.g., to turn on cross-cutting behavior (high
+	// availability, sidecars) without editing the component.
+	Mixins []string `json:"mixins,omitempty"`
+	// Extensions are the fields of the component's entry that belong to other
+	// tools (see `extensionPrefix`).
+	Extensions Extensions `json:"-"`
+}
+
+const (
+	// JobRerunFail fails the apply when the server rejects the update of an
+	// existing Job or CronJob.
+	JobRerunFail = "fail"
+	// JobRerunSkip leaves existing Jobs and CronJobs as they are.
+	JobRerunSkip = "skip-if-exists"
+	// JobRerunRecreate starts a new run of existing Jobs, as a new Job named
+	// after the original (using `generateName`), and deletes and recreates
+	// existing CronJobs.
+	JobRerunRecreate = "recreate"
+)
+
+// HealthPolicy decides whether the live objects of some kind are ready.
+type HealthPolicy struct {
+	// Kind, and optionally APIVersion, select the objects the policy applies
+	// to.
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	// Ready is a Jsonnet expression that is true when the object (bound to
+	// `object`) is ready.
+	Ready string `json:"ready"`
+	// Message, if set, is a Jsonnet expression describing the object's
+	// state, e.g., `"phase " + object.status.phase`.
+	Message string `json:"message,omitempty"`
+}
+
+// EnvironmentRegistrySpec describes where to find a shared set of environment
+// definitions. The registry is laid out like the `environments/` directory of
+// a ksonnet application: each environment is a directory containing a
+// `spec.json`, and a `.metadata/` directory with its generated ksonnet-lib.
+type EnvironmentRegistrySpec struct {
+	// URI is the git repository to clone, e.g.,
+	// `https://github.com/example/environments.git`.
+	URI string `json:"uri"`
+	// Ref is the branch or tag to check out. Defaults to the repository's
+	// default branch.
+	Ref string `json:"ref,omitempty"`
+	// Path is the directory in the repository that holds the environments.
+	// Defaults to the repository root.
+	Path string `json:"path,omitempty"`
+}
+
+// AppSpec returns the contents of `app.yaml`. If the application has no
+// `app.yaml`, an empty spec is returned.
+func (m *manager) AppSpec() (*AppSpec, error) {
+	data, err := m.readAppYAML()
+	if err != nil {
+		return nil, err
+	} else if data == nil {
+		return &AppSpec{}, nil
+	}
+
+	return parseAppSpec(data)
+}
+
+// readAppYAML returns the contents of `app.yaml`, or nil if the application
+// has no `app.yaml`.
+func (m *manager) readAppYAML() ([]byte, error) {
+	exists, err := afero.Exists(m.appFS, string(m.appYAMLPath))
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	return afero.ReadFile(m.appFS, string(m.appYAMLPath))
+}
+
+// SharedLibPaths returns the absolute paths of the extra Jsonnet library search
+// paths listed in `app.yaml`.
+func (m *manager) SharedLibPaths() ([]string, error) {
+	spec, err := m.AppSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(spec.LibPaths))
+	for _, p := range spec.LibPaths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(string(m.rootPath), p)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// PluginsPath returns the absolute path of the `pluginsDir` of `app.yaml`, or
+// the empty string if there is none.
+func (m *manager) PluginsPath() (string, error) {
+	spec, err := m.AppSpec()
+	if err != nil || spec.PluginsDir == "" {
+		return "", err
+	}
+	if filepath.IsAbs(spec.PluginsDir) {
+		return spec.PluginsDir, nil
+	}
+	return filepath.Join(string(m.rootPath), spec.PluginsDir), nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package apptest builds ksonnet applications in memory, so that tests (ours,
+// and those of tools built on ksonnet) can construct app fixtures
+// programmatically rather than copying golden directory trees. For example:
+//
+//	m, err := apptest.New().
+//	  WithEnv("prod", metadata.EnvironmentSpec{URI: "https://prod", Namespace: "web"}).
+//	  WithComponent("guestbook", `{ apiVersion: "v1", kind: "Service" }`).
+//	  Build()
+//
+// The application is generated by the same code as `ks init` and `ks env add`
+// (against an empty v1.7.0 API specification), so it has the layout of a real
+// application.
+package apptest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/spf13/afero"
+)
+
+const (
+	// DefaultRoot is the root of applications built by `New`.
+	DefaultRoot = "/app"
+
+	specPath = "/.apptest/swagger.json"
+	specData = `{
+  "swagger": "2.0",
+  "info": {
+   "title": "Kubernetes",
+   "version": "v1.7.0"
+  },
+  "paths": {
+  },
+  "definitions": {
+  }
+}`
+)
+
+type env struct {
+	name      string
+	spec      metadata.EnvironmentSpec
+	overrides *string
+}
+
+type file struct {
+	path string
+	text string
+}
+
+// App describes a ksonnet application to be built in memory. Its methods
+// return the receiver, so calls can be chained.
+type App struct {
+	fs   afero.Fs
+	root metadata.AbsPath
+
+	envs  []*env
+	files []file
+
+	// err records a misuse of the builder, reported by `Build`.
+	err error
+}
+
+// New returns an empty application rooted at `DefaultRoot` in a new in-memory
+// filesystem.
+func New() *App {
+	return &App{fs: afero.NewMemMapFs(), root: DefaultRoot}
+}
+
+// WithFs builds the application in `fs` rather than in a new in-memory
+// filesystem.
+func (a *App) WithFs(fs afero.Fs) *App {
+	a.fs = fs
+	return a
+}
+
+// WithRoot builds the application at `root` rather than at `DefaultRoot`.
+func (a *App) WithRoot(root string) *App {
+	a.root = metadata.AbsPath(root)
+	return a
+}
+
+// WithEnv adds the environment `name`, with the `spec.json` `spec`.
+// Environments are created in the order they are added, so an environment
+// must be added after the environment it inherits from.
+func (a *App) WithEnv(name string, spec metadata.EnvironmentSpec) *App {
+	a.envs = append(a.envs, &env{name: name, spec: spec})
+	return a
+}
+
+// WithEnvOverrides replaces the generated override file (e.g.,
+// `environments/prod/prod.jsonnet`) of the environment `name` with `text`.
+// The environment must already have been added with `WithEnv`.
+func (a *App) WithEnvOverrides(name, text string) *App {
+	for _, e := range a.envs {
+		if e.name == name {
+			e.overrides = &text
+			return a
+		}
+	}
+	if a.err == nil {
+		a.err = fmt.Errorf("Can't set overrides of environment '%s'; it has not been added", name)
+	}
+	return a
+}
+
+// WithComponent adds the Jsonnet component `name`, with the program text
+// `text`.
+func (a *App) WithComponent(name, text string) *App {
+	return a.WithFile(path.Join("components", name+".jsonnet"), text)
+}
+
+// WithLib adds the file `name`, with the contents `text`, to the
+// application's `lib` directory.
+func (a *App) WithLib(name, text string) *App {
+	return a.WithFile(path.Join("lib", name), text)
+}
+
+// WithAppYAML sets the contents of the application's `app.yaml`.
+func (a *App) WithAppYAML(text string) *App {
+	return a.WithFile("app.yaml", text)
+}
+
+// WithFile adds the file at `name` (relative to the application root), with
+// the contents `text`. Parent directories are created as needed.
+func (a *App) WithFile(name, text string) *App {
+	a.files = append(a.files, file{path: name, text: text})
+	return a
+}
+
+// Fs returns the filesystem the application is built in.
+func (a *App) Fs() afero.Fs {
+	return a.fs
+}
+
+// Root returns the root directory of the application.
+func (a *App) Root() metadata.AbsPath {
+	return a.root
+}
+
+// Build generates the application in its filesystem, and returns its
+// metadata manager.
+func (a *App) Build() (metadata.Manager, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	ctx := context.Background()
+
+	if err := afero.WriteFile(a.fs, specPath, []byte(specData), 0644); err != nil {
+		return nil, err
+	}
+	defer a.fs.RemoveAll(path.Dir(specPath))
+
+	spec, err := metadata.ParseClusterSpecFs("file:"+specPath, a.fs)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := metadata.InitFs(ctx, a.root, spec, nil, nil, a.fs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range a.envs {
+		if err := m.CreateEnvironment(ctx, e.name, e.spec.URI, e.spec.Namespace, e.spec.Inherits, spec); err != nil {
+			return nil, err
+		}
+
+		envPath := path.Join(string(a.root), "environments", e.name)
+		data, err := json.MarshalIndent(e.spec, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := afero.WriteFile(a.fs, path.Join(envPath, "spec.json"), data, 0644); err != nil {
+			return nil, err
+		}
+
+		if e.overrides != nil {
+			_, _, overridesPath := m.LibPaths(e.name)
+			if err := afero.WriteFile(a.fs, string(overridesPath), []byte(*e.overrides), 0644); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, f := range a.files {
+		p := path.Join(string(a.root), f.path)
+		if err := a.fs.MkdirAll(path.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+		if err := afero.WriteFile(a.fs, p, []byte(f.text), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return metadata.FindFs(a.root, a.fs)
+}
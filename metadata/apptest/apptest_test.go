@@ -0,0 +1,78 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package apptest
+
+import (
+	"testing"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/spf13/afero"
+)
+
+func TestBuild(t *testing.T) {
+	app := New().
+		WithEnv("base", metadata.EnvironmentSpec{URI: "https://base", Namespace: "web"}).
+		WithEnv("prod", metadata.EnvironmentSpec{URI: "https://prod", Namespace: "web", Inherits: "base", Targets: []string{"guestbook"}}).
+		WithEnvOverrides("prod", "{}\n").
+		WithComponent("guestbook", "{}\n").
+		WithLib("util.libsonnet", "{}\n")
+	m, err := app.Build()
+	if err != nil {
+		t.Fatalf("Failed to build app: %v", err)
+	}
+
+	if m.Root() != DefaultRoot {
+		t.Errorf("Expected root '%s', got '%s'", DefaultRoot, m.Root())
+	}
+
+	env, err := m.GetEnvironment("prod")
+	if err != nil {
+		t.Fatalf("Failed to get environment: %v", err)
+	}
+	if env.URI != "https://prod" || env.Inherits != "base" || len(env.Targets) != 1 || env.Targets[0] != "guestbook" {
+		t.Errorf("Unexpected environment %#v", env)
+	}
+
+	paths, err := m.ComponentPaths()
+	if err != nil {
+		t.Fatalf("Failed to list components: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/app/components/guestbook.jsonnet" {
+		t.Errorf("Unexpected component paths %v", paths)
+	}
+
+	_, _, overridesPath := m.LibPaths("prod")
+	for _, p := range []string{string(overridesPath), "/app/lib/util.libsonnet"} {
+		data, err := afero.ReadFile(app.Fs(), p)
+		if err != nil {
+			t.Fatalf("Failed to read '%s': %v", p, err)
+		}
+		if string(data) != "{}\n" {
+			t.Errorf("Unexpected contents of '%s': %q", p, data)
+		}
+	}
+
+	if exists, _ := afero.Exists(app.Fs(), specPath); exists {
+		t.Errorf("Expected API spec '%s' to be removed", specPath)
+	}
+}
+
+func TestBuildUnknownEnvOverrides(t *testing.T) {
+	_, err := New().WithEnvOverrides("prod", "{}").Build()
+	if err == nil {
+		t.Errorf("Expected overrides of an unknown environment to fail")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// archiveDir is the directory of `environments/` that archived environments
+// are kept in. Like every directory whose name begins with a dot, it is not
+// searched for environments.
+const archiveDir = ".archive"
+
+// ArchiveEnvironment moves the environment `name` to `environments/.archive`,
+// so that it is no longer listed, and can no longer be rendered or applied,
+// but can be restored with `RestoreEnvironment`.
+func (m *manager) ArchiveEnvironment(name string) error {
+	env, err := m.GetEnvironment(name)
+	if err != nil {
+		return err
+	}
+	name = env.Name
+
+	if err := m.checkMovable(name); err != nil {
+		return err
+	}
+
+	archivePath := appendToAbsPath(m.environmentsPath, archiveDir, name)
+	if exists, err := afero.Exists(m.appFS, string(archivePath)); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("An archived environment named '%s' already exists; restore or remove it first", name)
+	}
+
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
+	log.Infof("Archiving environment '%s'", name)
+	if err := tx.move(appendToAbsPath(m.environmentsPath, name), archivePath); err != nil {
+		return err
+	}
+	if err := m.removeEmptyParents(tx, name); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// RestoreEnvironment moves the archived environment `name` back to
+// `environments/`.
+func (m *manager) RestoreEnvironment(name string) error {
+	archived, err := m.isArchived(name)
+	if err != nil {
+		return err
+	} else if !archived {
+		return fmt.Errorf("There is no archived environment named '%s'", name)
+	}
+
+	if exists, err := m.environmentExists(name); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("Can not restore '%s', an environment with that name already exists", name)
+	}
+	if err := m.checkAliasAvailable(name); err != nil {
+		return err
+	}
+
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
+	log.Infof("Restoring environment '%s'", name)
+	if err := tx.move(appendToAbsPath(m.environmentsPath, archiveDir, name), appendToAbsPath(m.environmentsPath, name)); err != nil {
+		return err
+	}
+	if err := m.removeEmptyParents(tx, filepath.Join(archiveDir, name)); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// ArchivedEnvironments returns the names of the archived environments, in
+// order.
+func (m *manager) ArchivedEnvironments() ([]string, error) {
+	root := string(appendToAbsPath(m.environmentsPath, archiveDir))
+	if exists, err := afero.DirExists(m.appFS, root); err != nil || !exists {
+		return []string{}, err
+	}
+
+	names := []string{}
+	err := afero.Walk(m.appFS, root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == metadataDirName {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && info.Name() == specFilename {
+			names = append(names, strings.TrimPrefix(filepath.Dir(p), root+"/"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// environmentNotFound returns the error for the environment `name` not being
+// found, which tells archived environments apart from missing ones.
+func (m *manager) environmentNotFound(name string) error {
+	if archived, err := m.isArchived(name); err == nil && archived {
+		return fmt.Errorf("Environment '%s' is archived, and must be restored before it is used", name)
+	}
+	return &environmentNotFoundError{name: name}
+}
+
+// environmentNotFoundError reports that an environment does not exist (and is
+// not archived).
+type environmentNotFoundError struct {
+	name string
+}
+
+func (e *environmentNotFoundError) Error() string {
+	return fmt.Sprintf("Environment '%s' does not exist", e.name)
+}
+
+// IsEnvironmentNotFound returns true if `err` reports that an environment does
+// not exist, rather than (e.g.) that it could not be read.
+func IsEnvironmentNotFound(err error) bool {
+	_, ok := err.(*environmentNotFoundError)
+	return ok
+}
+
+// isArchived returns true if `name` is the name of an archived environment.
+func (m *manager) isArchived(name string) (bool, error) {
+	names, err := m.ArchivedEnvironments()
+	if err != nil {
+		return false, err
+	}
+	for _, archived := range names {
+		if archived == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkMovable returns an error if the environment `name` cannot be moved
+// out of `environments/` on its own: if other environments inherit from it,
+// or are nested in its directory.
+func (m *manager) checkMovable(name string) error {
+	children, err := m.inheritingEnvironments(name)
+	if err != nil {
+		return err
+	} else if len(children) > 0 {
+		return fmt.Errorf("Environment '%s' is inherited by %s; remove them, or change what they inherit from, first", name, quoteNames(children))
+	}
+
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return err
+	}
+	nested := []string{}
+	for _, env := range envs {
+		if strings.HasPrefix(env.Name, name+"/") {
+			nested = append(nested, env.Name)
+		}
+	}
+	if len(nested) > 0 {
+		return fmt.Errorf("Environment '%s' contains the environments %s; move them first", name, quoteNames(nested))
+	}
+	return nil
+}
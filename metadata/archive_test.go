@@ -0,0 +1,108 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArchiveEnvironment(t *testing.T) {
+	m := mockEnvironments(t, "test-archive-env")
+
+	if err := m.ArchiveEnvironment(mockEnvName); err != nil {
+		t.Fatalf("Failed to archive environment:\n%v", err)
+	}
+	testDirNotExists(t, string(appendToAbsPath(m.environmentsPath, mockEnvName)))
+	testDirExists(t, string(appendToAbsPath(m.environmentsPath, archiveDir, mockEnvName)))
+
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range envs {
+		if env.Name == mockEnvName || strings.HasPrefix(env.Name, archiveDir) {
+			t.Errorf("Expected archived environment not to be listed, got '%s'", env.Name)
+		}
+	}
+
+	_, err = m.GetEnvironment(mockEnvName)
+	if err == nil || !strings.Contains(err.Error(), "archived") || IsEnvironmentNotFound(err) {
+		t.Errorf("Expected archived environment to be refused, got %v", err)
+	}
+	if _, err := m.GetEnvironment("missing"); !IsEnvironmentNotFound(err) {
+		t.Errorf("Expected a missing environment not to be found, got %v", err)
+	}
+
+	names, err := m.ArchivedEnvironments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{mockEnvName}) {
+		t.Errorf("Expected archived environments %v, got %v", []string{mockEnvName}, names)
+	}
+
+	// Archiving the remaining environment of 'us-west' removes the directory.
+	if err := m.ArchiveEnvironment(mockEnvName2); err != nil {
+		t.Fatalf("Failed to archive environment:\n%v", err)
+	}
+	testDirNotExists(t, string(appendToAbsPath(m.environmentsPath, "us-west")))
+
+	if err := m.RestoreEnvironment(mockEnvName); err != nil {
+		t.Fatalf("Failed to restore environment:\n%v", err)
+	}
+	if _, err := m.GetEnvironment(mockEnvName); err != nil {
+		t.Errorf("Expected restored environment, got %v", err)
+	}
+	names, err = m.ArchivedEnvironments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{mockEnvName2}) {
+		t.Errorf("Expected archived environments %v, got %v", []string{mockEnvName2}, names)
+	}
+
+	if err := m.RestoreEnvironment(mockEnvName); err == nil {
+		t.Errorf("Expected restoring an environment that is not archived to fail")
+	}
+	if err := m.ArchiveEnvironment("missing"); err == nil {
+		t.Errorf("Expected archiving a missing environment to fail")
+	}
+}
+
+func TestArchiveEnvironmentInherited(t *testing.T) {
+	m := mockEnvironments(t, "test-archive-env-inherited")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	if err := m.CreateEnvironment(context.Background(), "us-east/canary", mockAPIServerURI, mockNamespace, defaultEnvName, spec); err != nil {
+		t.Fatalf("Failed to create inheriting environment:\n%v", err)
+	}
+	if err := m.ArchiveEnvironment(defaultEnvName); err == nil {
+		t.Errorf("Expected archiving an inherited environment to fail")
+	}
+	testDirExists(t, string(appendToAbsPath(m.environmentsPath, defaultEnvName)))
+
+	// The inheriting environment itself can be archived.
+	if err := m.ArchiveEnvironment("us-east/canary"); err != nil {
+		t.Fatalf("Failed to archive environment:\n%v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// maxBudgetViolations is the most oversized objects a budget error lists.
+const maxBudgetViolations = 10
+
+// BudgetSpec limits what rendering an environment may produce, so that an
+// accidental blowup (e.g., a Jsonnet comprehension over the wrong list) is
+// caught before it reaches the API server. For example:
+//
+//	budgets:
+//	  maxObjects: 500
+//	  maxObjectSize: 256Ki
+//	  maxTotalSize: 5Mi
+//
+// Sizes are those of the JSON-encoded objects, and are written as Kubernetes
+// quantities. Unset limits are not enforced.
+type BudgetSpec struct {
+	// MaxObjects is the most objects an environment may render.
+	MaxObjects int `json:"maxObjects,omitempty"`
+	// MaxObjectSize is the largest any single object may be.
+	MaxObjectSize string `json:"maxObjectSize,omitempty"`
+	// MaxTotalSize is the largest all of an environment's objects may be,
+	// together.
+	MaxTotalSize string `json:"maxTotalSize,omitempty"`
+}
+
+// parseSizes returns the size limits of `bs`, in bytes; 0 means no limit.
+func (bs *BudgetSpec) parseSizes() (maxObjectSize, maxTotalSize int64, err error) {
+	parse := func(field, value string) (int64, error) {
+		if value == "" {
+			return 0, nil
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid 'budgets.%s' in '%s': %v", field, appYAMLFile, err)
+		} else if q.Sign() <= 0 {
+			return 0, fmt.Errorf("Invalid 'budgets.%s' in '%s': must be positive", field, appYAMLFile)
+		}
+		return q.Value(), nil
+	}
+
+	if maxObjectSize, err = parse("maxObjectSize", bs.MaxObjectSize); err != nil {
+		return 0, 0, err
+	}
+	if maxTotalSize, err = parse("maxTotalSize", bs.MaxTotalSize); err != nil {
+		return 0, 0, err
+	}
+	return maxObjectSize, maxTotalSize, nil
+}
+
+// Check returns an error listing every way in which `objs` exceed the budget.
+// A nil budget is never exceeded.
+func (bs *BudgetSpec) Check(objs []*unstructured.Unstructured) error {
+	if bs == nil {
+		return nil
+	}
+	if bs.MaxObjects < 0 {
+		return fmt.Errorf("Invalid 'budgets.maxObjects' in '%s': must not be negative", appYAMLFile)
+	}
+	maxObjectSize, maxTotalSize, err := bs.parseSizes()
+	if err != nil {
+		return err
+	}
+
+	type sized struct {
+		obj  *unstructured.Unstructured
+		size int64
+	}
+	oversized := []sized{}
+	var total int64
+	for _, obj := range objs {
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+		size := int64(len(data))
+		total += size
+		if maxObjectSize > 0 && size > maxObjectSize {
+			oversized = append(oversized, sized{obj, size})
+		}
+	}
+
+	violations := []string{}
+	if bs.MaxObjects > 0 && len(objs) > bs.MaxObjects {
+		violations = append(violations, fmt.Sprintf("%d objects were rendered, more than 'maxObjects' (%d)", len(objs), bs.MaxObjects))
+	}
+	if maxTotalSize > 0 && total > maxTotalSize {
+		violations = append(violations, fmt.Sprintf("The objects total %d bytes, more than 'maxTotalSize' (%s)", total, bs.MaxTotalSize))
+	}
+
+	sort.SliceStable(oversized, func(i, j int) bool { return oversized[i].size > oversized[j].size })
+	for i, o := range oversized {
+		if i == maxBudgetViolations {
+			violations = append(violations, fmt.Sprintf("... and %d more objects larger than 'maxObjectSize'", len(oversized)-i))
+			break
+		}
+		name := o.obj.GetName()
+		if ns := o.obj.GetNamespace(); ns != "" {
+			name = ns + "/" + name
+		}
+		violations = append(violations, fmt.Sprintf("%s '%s' is %d bytes, more than 'maxObjectSize' (%s)", o.obj.GetKind(), name, o.size, bs.MaxObjectSize))
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Rendered objects exceed the budgets in '%s':\n  - %s", appYAMLFile, strings.Join(violations, "\n  - "))
+}
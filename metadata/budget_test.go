@@ -0,0 +1,84 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func budgetObject(name string, dataLen int) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"data":       map[string]interface{}{"blob": strings.Repeat("x", dataLen)},
+	}}
+}
+
+func TestBudgetCheck(t *testing.T) {
+	objs := []*unstructured.Unstructured{
+		budgetObject("small", 10),
+		budgetObject("big", 2000),
+		budgetObject("bigger", 3000),
+	}
+
+	var none *BudgetSpec
+	if err := none.Check(objs); err != nil {
+		t.Errorf("Expected no budget to allow anything, got:\n%v", err)
+	}
+
+	tests := []struct {
+		budget  BudgetSpec
+		substrs []string
+	}{
+		{BudgetSpec{MaxObjects: 3, MaxObjectSize: "4Ki", MaxTotalSize: "1Mi"}, nil},
+		{BudgetSpec{MaxObjects: 2}, []string{"3 objects were rendered, more than 'maxObjects' (2)"}},
+		{BudgetSpec{MaxTotalSize: "4k"}, []string{"more than 'maxTotalSize' (4k)"}},
+		{
+			BudgetSpec{MaxObjectSize: "1Ki"},
+			[]string{"ConfigMap 'default/bigger' is 3", "ConfigMap 'default/big' is 2"},
+		},
+		{BudgetSpec{MaxObjectSize: "lots"}, []string{"Invalid 'budgets.maxObjectSize'"}},
+		{BudgetSpec{MaxTotalSize: "-1Mi"}, []string{"Invalid 'budgets.maxTotalSize'", "must be positive"}},
+	}
+	for _, test := range tests {
+		err := test.budget.Check(objs)
+		if len(test.substrs) == 0 {
+			if err != nil {
+				t.Errorf("Expected budget %#v to be met, got:\n%v", test.budget, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Expected budget %#v to be exceeded", test.budget)
+			continue
+		}
+		for _, substr := range test.substrs {
+			if !strings.Contains(err.Error(), substr) {
+				t.Errorf("Expected error for budget %#v to contain %q, got:\n%v", test.budget, substr, err)
+			}
+		}
+	}
+
+	// The largest objects are listed first.
+	err := (&BudgetSpec{MaxObjectSize: "1Ki"}).Check(objs)
+	if err == nil || strings.Index(err.Error(), "'default/bigger'") > strings.Index(err.Error(), "'default/big'") {
+		t.Errorf("Expected oversized objects to be listed largest first, got:\n%v", err)
+	}
+}
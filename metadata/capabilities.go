@@ -0,0 +1,173 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// CapabilitiesExtCodeKey is the external variable through which the
+// capabilities of an environment's cluster are exposed to Jsonnet.
+const CapabilitiesExtCodeKey = "__ksonnet/capabilities"
+
+// Capabilities describes the APIs served by the cluster an environment points
+// at, so that components can emit different objects depending on (e.g.) which
+// API versions the cluster supports.
+type Capabilities struct {
+	// APIs is the sorted list of kinds the cluster serves, each of the form
+	// `<group>/<version>/<kind>`, or `<version>/<kind>` for the core group.
+	// For example, `networking.k8s.io/v1/NetworkPolicy`, or `v1/Pod`.
+	APIs []string
+	// Deprecated maps the APIs the cluster still serves, but has deprecated,
+	// to the deprecation notice of their API specification, e.g.,
+	// `DEPRECATED - This group version of Deployment is deprecated by
+	// apps/v1beta2/Deployment.`
+	Deprecated map[string]string
+}
+
+// HasAPI returns true if the cluster serves `api`, which has the same form as
+// the entries in `APIs`.
+func (c *Capabilities) HasAPI(api string) bool {
+	i := sort.SearchStrings(c.APIs, api)
+	return i < len(c.APIs) && c.APIs[i] == api
+}
+
+// ExtCode returns the `--ext-code` binding (`<key>=<jsonnet>`) that exposes
+// the capabilities to components. For example,
+//
+//	local capabilities = std.extVar("__ksonnet/capabilities");
+//	if capabilities.hasAPI("apps/v1beta2/Deployment") then ...
+func (c *Capabilities) ExtCode() string {
+	var obj bytes.Buffer
+	obj.WriteString("{\n")
+	obj.WriteString("  apis: {\n")
+	for _, api := range c.APIs {
+		fmt.Fprintf(&obj, "    %q: true,\n", api)
+	}
+	obj.WriteString("  },\n")
+	obj.WriteString("  hasAPI(api):: std.objectHas(self.apis, api),\n")
+	obj.WriteString("  hasPodSecurityPolicy:: self.hasAPI(\"extensions/v1beta1/PodSecurityPolicy\") || self.hasAPI(\"policy/v1beta1/PodSecurityPolicy\"),\n")
+	obj.WriteString("}\n")
+	return fmt.Sprintf("%s=%s", CapabilitiesExtCodeKey, obj.String())
+}
+
+func (m *manager) Capabilities(envName string) (*Capabilities, error) {
+	_, envLibPath, _ := m.LibPaths(envName)
+	schemaPath := appendToAbsPath(envLibPath, schemaFilename)
+
+	text, err := afero.ReadFile(m.appFS, string(schemaPath))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read API specification for environment '%s':\n%v", envName, err)
+	}
+
+	return parseCapabilities(text)
+}
+
+// DiscoverCapabilities computes the capabilities of a cluster from the API
+// resources it serves. Unlike the cached API specification, discovery reflects
+// the API groups enabled on the cluster (including those of custom resources
+// and aggregated API servers), but it does not mark deprecated APIs, so
+// `Deprecated` is empty.
+func DiscoverCapabilities(disco discovery.ServerResourcesInterface) (*Capabilities, error) {
+	resources, err := disco.ServerResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("Could not discover the APIs served by the cluster:\n%v", err)
+	}
+	// Some API groups (e.g., of an unavailable aggregated API server) could
+	// not be discovered; the cluster does not serve them.
+
+	seen := map[string]bool{}
+	for _, list := range resources {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				// Subresources, e.g., 'deployments/scale', are not kinds the
+				// cluster serves in their own right.
+				continue
+			}
+			seen[gv.String()+"/"+resource.Kind] = true
+		}
+	}
+
+	caps := &Capabilities{APIs: []string{}, Deprecated: map[string]string{}}
+	for api := range seen {
+		caps.APIs = append(caps.APIs, api)
+	}
+	sort.Strings(caps.APIs)
+	return caps, nil
+}
+
+// parseCapabilities computes the capabilities of a cluster from its OpenAPI
+// specification, using the group/version/kind annotations that the API server
+// attaches to each object definition.
+func parseCapabilities(text []byte) (*Capabilities, error) {
+	var spec struct {
+		Definitions map[string]struct {
+			Description string `json:"description"`
+			GVKs        []struct {
+				Group   string `json:"group"`
+				Version string `json:"version"`
+				Kind    string `json:"kind"`
+			} `json:"x-kubernetes-group-version-kind"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(text, &spec); err != nil {
+		return nil, fmt.Errorf("Could not parse API specification:\n%v", err)
+	}
+
+	seen := map[string]bool{}
+	deprecated := map[string]string{}
+	for _, def := range spec.Definitions {
+		for _, gvk := range def.GVKs {
+			api := gvk.Version + "/" + gvk.Kind
+			if gvk.Group != "" {
+				api = gvk.Group + "/" + api
+			}
+			seen[api] = true
+			if strings.HasPrefix(def.Description, "DEPRECATED") {
+				deprecated[api] = deprecationNotice(def.Description)
+			}
+		}
+	}
+
+	caps := &Capabilities{APIs: []string{}, Deprecated: deprecated}
+	for api := range seen {
+		caps.APIs = append(caps.APIs, api)
+	}
+	sort.Strings(caps.APIs)
+	return caps, nil
+}
+
+// deprecationNotice returns the first sentence of the description of a
+// deprecated definition, which names its replacement; the rest is usually a
+// description of the kind itself.
+func deprecationNotice(description string) string {
+	if i := strings.Index(description, ". "); i >= 0 {
+		return description[:i+1]
+	}
+	return description
+}
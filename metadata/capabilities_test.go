@@ -0,0 +1,153 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	text := []byte(`{
+  "definitions": {
+    "io.k8s.api.core.v1.Pod": {
+      "x-kubernetes-group-version-kind": [{"group": "", "version": "v1", "kind": "Pod"}]
+    },
+    "io.k8s.api.networking.v1.NetworkPolicy": {
+      "x-kubernetes-group-version-kind": [{"group": "networking.k8s.io", "version": "v1", "kind": "NetworkPolicy"}]
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.DeleteOptions": {
+      "x-kubernetes-group-version-kind": [
+        {"group": "", "version": "v1", "kind": "DeleteOptions"},
+        {"group": "apps", "version": "v1beta1", "kind": "DeleteOptions"}
+      ]
+    },
+    "io.k8s.api.core.v1.PodSpec": {},
+    "io.k8s.api.extensions.v1beta1.Deployment": {
+      "description": "DEPRECATED - This group version of Deployment is deprecated by apps/v1beta2/Deployment. See the release notes for more information. Deployment enables declarative updates for Pods and ReplicaSets.",
+      "x-kubernetes-group-version-kind": [{"group": "extensions", "version": "v1beta1", "kind": "Deployment"}]
+    }
+  }
+}`)
+
+	caps, err := parseCapabilities(text)
+	if err != nil {
+		t.Fatalf("Failed to parse capabilities:\n%v", err)
+	}
+
+	expected := []string{
+		"apps/v1beta1/DeleteOptions",
+		"extensions/v1beta1/Deployment",
+		"networking.k8s.io/v1/NetworkPolicy",
+		"v1/DeleteOptions",
+		"v1/Pod",
+	}
+	if !reflect.DeepEqual(caps.APIs, expected) {
+		t.Errorf("Expected APIs %v, got %v", expected, caps.APIs)
+	}
+
+	if !caps.HasAPI("networking.k8s.io/v1/NetworkPolicy") {
+		t.Errorf("Expected cluster to serve 'networking.k8s.io/v1/NetworkPolicy'")
+	}
+	if caps.HasAPI("networking.k8s.io/v1/Ingress") {
+		t.Errorf("Expected cluster not to serve 'networking.k8s.io/v1/Ingress'")
+	}
+
+	expectedDeprecated := map[string]string{
+		"extensions/v1beta1/Deployment": "DEPRECATED - This group version of Deployment is deprecated by apps/v1beta2/Deployment.",
+	}
+	if !reflect.DeepEqual(caps.Deprecated, expectedDeprecated) {
+		t.Errorf("Expected deprecated APIs %v, got %v", expectedDeprecated, caps.Deprecated)
+	}
+
+	if _, err := parseCapabilities([]byte("not json")); err == nil {
+		t.Errorf("Expected parsing invalid API specification to fail")
+	}
+}
+
+func TestCapabilitiesExtCode(t *testing.T) {
+	capabilities := &Capabilities{APIs: []string{"apps/v1beta1/Deployment", "v1/Pod"}}
+	expected := `__ksonnet/capabilities={
+  apis: {
+    "apps/v1beta1/Deployment": true,
+    "v1/Pod": true,
+  },
+  hasAPI(api):: std.objectHas(self.apis, api),
+  hasPodSecurityPolicy:: self.hasAPI("extensions/v1beta1/PodSecurityPolicy") || self.hasAPI("policy/v1beta1/PodSecurityPolicy"),
+}
+`
+
+	res := capabilities.ExtCode()
+	if res != expected {
+		t.Errorf("Wrong object constructed\n  expected: %v\n  got: %v", expected, res)
+	}
+}
+
+type fakeResources struct {
+	discovery.ServerResourcesInterface
+	resources []*metav1.APIResourceList
+	err       error
+}
+
+func (f *fakeResources) ServerResources() ([]*metav1.APIResourceList, error) {
+	return f.resources, f.err
+}
+
+func TestDiscoverCapabilities(t *testing.T) {
+	resources := []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod"},
+				{Name: "pods/log", Kind: "Pod"},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment"},
+				{Name: "deployments/scale", Kind: "Scale"},
+			},
+		},
+	}
+
+	caps, err := DiscoverCapabilities(&fakeResources{resources: resources})
+	if err != nil {
+		t.Fatalf("Failed to discover capabilities:\n%v", err)
+	}
+	expected := []string{"apps/v1/Deployment", "v1/Pod"}
+	if !reflect.DeepEqual(caps.APIs, expected) {
+		t.Errorf("Expected APIs %v, got %v", expected, caps.APIs)
+	}
+
+	// Groups that could not be discovered are left out.
+	failed := &discovery.ErrGroupDiscoveryFailed{Groups: map[schema.GroupVersion]error{{Group: "metrics.k8s.io", Version: "v1beta1"}: fmt.Errorf("unavailable")}}
+	caps, err = DiscoverCapabilities(&fakeResources{resources: resources, err: failed})
+	if err != nil {
+		t.Fatalf("Failed to discover capabilities of a partly available cluster:\n%v", err)
+	} else if !reflect.DeepEqual(caps.APIs, expected) {
+		t.Errorf("Expected APIs %v, got %v", expected, caps.APIs)
+	}
+
+	if _, err := DiscoverCapabilities(&fakeResources{err: fmt.Errorf("connection refused")}); err == nil {
+		t.Errorf("Expected an unreachable cluster to be reported")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+const lockFile = "ks.lock"
+
+// lockFileSpec represents the contents of `ks.lock`, which records the hash of
+// every file that determines what an application deploys.
+type lockFileSpec struct {
+	// Files maps the path of each file, relative to the application root, to
+	// the hex-encoded SHA-256 hash of its contents.
+	Files map[string]string `json:"files"`
+}
+
+// checksummedDirs returns the directories whose files are recorded in the
+// lockfile. Environments are included, since their overrides, parameters and
+// generated libraries change what is deployed just as components do.
+func (m *manager) checksummedDirs() []AbsPath {
+	return []AbsPath{m.componentsPath, m.environmentsPath, m.libPath, m.vendorDir}
+}
+
+func (m *manager) computeChecksums() (map[string]string, error) {
+	sums := map[string]string{}
+	for _, dir := range m.checksummedDirs() {
+		exists, err := afero.DirExists(m.appFS, string(dir))
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			continue
+		}
+
+		err = afero.Walk(m.appFS, string(dir), func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			} else if info.IsDir() {
+				// Archived environments are not deployed.
+				if p == string(appendToAbsPath(m.environmentsPath, archiveDir)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			data, err := afero.ReadFile(m.appFS, p)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+
+			rel := strings.TrimPrefix(p, string(m.rootPath)+"/")
+			sums[filepath.ToSlash(rel)] = hex.EncodeToString(sum[:])
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sums, nil
+}
+
+func (m *manager) WriteChecksums() error {
+	sums, err := m.computeChecksums()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(lockFileSpec{Files: sums}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	lockPath := appendToAbsPath(m.rootPath, lockFile)
+	log.Infof("Writing checksums of %d files to '%s'", len(sums), lockPath)
+	return afero.WriteFile(m.appFS, string(lockPath), append(data, '\n'), defaultFilePermissions)
+}
+
+func (m *manager) VerifyChecksums() error {
+	lockPath := appendToAbsPath(m.rootPath, lockFile)
+	data, err := afero.ReadFile(m.appFS, string(lockPath))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Could not verify checksums; '%s' does not exist. Run 'ks lock' to create it", lockFile)
+	} else if err != nil {
+		return err
+	}
+
+	var locked lockFileSpec
+	if err := json.Unmarshal(data, &locked); err != nil {
+		return fmt.Errorf("Failed to parse '%s':\n%v", lockFile, err)
+	}
+
+	sums, err := m.computeChecksums()
+	if err != nil {
+		return err
+	}
+
+	changes := map[string]string{}
+	for p, sum := range sums {
+		if lockedSum, ok := locked.Files[p]; !ok {
+			changes[p] = "added"
+		} else if lockedSum != sum {
+			changes[p] = "modified"
+		}
+	}
+	for p := range locked.Files {
+		if _, ok := sums[p]; !ok {
+			changes[p] = "removed"
+		}
+	}
+
+	if len(changes) > 0 {
+		paths := []string{}
+		for p := range changes {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+
+		lines := []string{}
+		for _, p := range paths {
+			lines = append(lines, fmt.Sprintf("  %-9s %s", changes[p]+":", p))
+		}
+		return fmt.Errorf("Files differ from the checksums recorded in '%s':\n%s", lockFile, strings.Join(lines, "\n"))
+	}
+
+	log.Infof("Verified checksums of %d files against '%s'", len(sums), lockFile)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestChecksums(t *testing.T) {
+	m := mockEnvironments(t, "/checksums")
+
+	write := func(p, data string) {
+		if err := afero.WriteFile(testFS, string(appendToAbsPath(m.rootPath, p)), []byte(data), os.ModePerm); err != nil {
+			t.Fatalf("Failed to write '%s':\n%v", p, err)
+		}
+	}
+	write("components/foo.jsonnet", "{}")
+	write("lib/util.libsonnet", "{}")
+	write("vendor/pkg/pkg.libsonnet", "{}")
+	write("environments/us-west/params.libsonnet", "{}")
+
+	if err := m.VerifyChecksums(); err == nil {
+		t.Fatalf("Expected verification without a lockfile to fail")
+	}
+
+	if err := m.WriteChecksums(); err != nil {
+		t.Fatalf("Failed to write checksums:\n%v", err)
+	}
+	if err := m.VerifyChecksums(); err != nil {
+		t.Fatalf("Expected checksums to verify:\n%v", err)
+	}
+
+	// Archived environments are not deployed, so are not recorded.
+	write("environments/.archive/old/params.libsonnet", "{}")
+	if err := m.VerifyChecksums(); err != nil {
+		t.Fatalf("Expected checksums to ignore archived environments:\n%v", err)
+	}
+
+	write("components/foo.jsonnet", "{foo: 1}")
+	write("environments/us-west/params.libsonnet", "{replicas: 2}")
+	write("lib/new.libsonnet", "{}")
+	if err := testFS.Remove(string(appendToAbsPath(m.rootPath, "vendor/pkg/pkg.libsonnet"))); err != nil {
+		t.Fatalf("Failed to remove vendored file:\n%v", err)
+	}
+
+	err := m.VerifyChecksums()
+	if err == nil {
+		t.Fatalf("Expected checksums of changed files to fail verification")
+	}
+	for _, expected := range []string{
+		"modified: components/foo.jsonnet",
+		"modified: environments/us-west/params.libsonnet",
+		"added:    lib/new.libsonnet",
+		"removed:  vendor/pkg/pkg.libsonnet",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected verification error to contain '%s', got:\n%v", expected, err)
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package metadata
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
 )
 
@@ -22,7 +25,11 @@ func parseClusterSpec(specFlag string, fs afero.Fs) (ClusterSpec, error) {
 
 	switch split[0] {
 	case "version":
-		return &clusterSpecVersion{k8sVersion: split[1]}, nil
+		v, err := parsePlatformVersion(split[1])
+		if err != nil {
+			return nil, err
+		}
+		return &clusterSpecVersion{k8sVersion: v.base, platform: v.platform, platformRelease: v.release}, nil
 	case "file":
 		abs, err := filepath.Abs(split[1])
 		if err != nil {
@@ -42,7 +49,7 @@ type clusterSpecFile struct {
 	fs       afero.Fs
 }
 
-func (cs *clusterSpecFile) data() ([]byte, error) {
+func (cs *clusterSpecFile) data(ctx context.Context) ([]byte, error) {
 	return afero.ReadFile(cs.fs, string(cs.specPath))
 }
 
@@ -54,7 +61,7 @@ type clusterSpecLive struct {
 	apiServerURL string
 }
 
-func (cs *clusterSpecLive) data() ([]byte, error) {
+func (cs *clusterSpecLive) data(ctx context.Context) ([]byte, error) {
 	return nil, fmt.Errorf("Initializing from OpenAPI spec in live cluster is not implemented")
 }
 
@@ -62,27 +69,125 @@ func (cs *clusterSpecLive) resource() string {
 	return string(cs.apiServerURL)
 }
 
+// specRetryDelay is how long to wait before the first retry of a URL; the
+// wait doubles with each further retry.
+var specRetryDelay = time.Second
+
 type clusterSpecVersion struct {
 	k8sVersion string
+	// platform, if set, is the platform (e.g., `openshift`) whose release
+	// `platformRelease` is based on `k8sVersion`.
+	platform        string
+	platformRelease string
+	// sources, if set, are the mirrors, retries, and checksums configured in
+	// `app.yaml`.
+	sources *SpecSourcesSpec
+}
+
+// data retrieves the specification of `cs.k8sVersion`, and merges into it the
+// specifications of the platform's API groups configured in `cs.sources`, if
+// any.
+func (cs *clusterSpecVersion) data(ctx context.Context) ([]byte, error) {
+	data, err := cs.retrieve(ctx, cs.k8sVersion, cs.sources.urls(cs.k8sVersion))
+	if err != nil || cs.platform == "" {
+		return data, err
+	}
+
+	platformURLs := cs.sources.platformURLs(cs.platform, cs.platformRelease)
+	if len(platformURLs) == 0 {
+		if cs.platform == platformOpenShift {
+			log.Warnf("No specifications of the OpenShift API groups are listed in 'specSources.platforms.%s' of app.yaml; only the Kubernetes %s API is generated", cs.platform, cs.k8sVersion)
+		}
+		return data, nil
+	}
+	for _, platformURL := range platformURLs {
+		extra, err := cs.retrieve(ctx, platformURL, []string{platformURL})
+		if err != nil {
+			return nil, err
+		}
+		data, err = mergePlatformSpec(data, extra, cs.platform)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to merge OpenAPI schema from '%s': %v", platformURL, err)
+		}
+	}
+	return data, nil
+}
+
+// retrieve retrieves a specification from each of `urls` in turn, retrying
+// those that fail with network or server errors, until one returns a
+// specification with the checksum recorded for `key`.
+func (cs *clusterSpecVersion) retrieve(ctx context.Context, key string, urls []string) ([]byte, error) {
+	retries := cs.sources.retries()
+
+	failures := []string{}
+	for _, versionURL := range urls {
+		delay := specRetryDelay
+		for attempt := 0; ; attempt++ {
+			data, retry, err := cs.fetch(ctx, versionURL)
+			if err == nil {
+				err = cs.sources.verify(key, data)
+				retry = false
+			}
+			if err == nil {
+				return data, nil
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			if !retry || attempt >= retries {
+				log.Warnf("Failed to retrieve OpenAPI schema from '%s': %v", versionURL, err)
+				failures = append(failures, err.Error())
+				break
+			}
+			log.Warnf("Failed to retrieve OpenAPI schema from '%s', retrying in %s: %v", versionURL, delay, err)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+
+	if len(failures) == 1 {
+		return nil, fmt.Errorf("%s", failures[0])
+	}
+	return nil, fmt.Errorf("Failed to retrieve OpenAPI schema for cluster version '%s' from any of %d URLs:\n%s", key, len(urls), strings.Join(failures, "\n"))
 }
 
-func (cs *clusterSpecVersion) data() ([]byte, error) {
-	versionURL := fmt.Sprintf(k8sVersionURLTemplate, cs.k8sVersion)
-	resp, err := http.Get(versionURL)
+// fetch retrieves the specification at `versionURL`. It also returns whether
+// a failure is worth retrying.
+func (cs *clusterSpecVersion) fetch(ctx context.Context, versionURL string) ([]byte, bool, error) {
+	req, err := http.NewRequest("GET", versionURL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, true, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf(
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf(
 			"Recieved status code '%d' when trying to retrieve OpenAPI schema for cluster version '%s' from URL '%s'",
 			resp.StatusCode, cs.k8sVersion, versionURL)
 	}
 
-	return ioutil.ReadAll(resp.Body)
+	body := newProgressReader(resp.Body, "OpenAPI schema "+cs.k8sVersion, resp.ContentLength)
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, true, err
+	}
+	return data, false, nil
 }
 
 func (cs *clusterSpecVersion) resource() string {
+	if cs.platform != "" {
+		return fmt.Sprintf("%s %s (Kubernetes %s)", cs.platform, cs.platformRelease, cs.k8sVersion)
+	}
 	return string(cs.k8sVersion)
 }
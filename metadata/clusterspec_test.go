@@ -1,8 +1,18 @@
 package metadata
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type parseSuccess struct {
@@ -11,7 +21,9 @@ type parseSuccess struct {
 }
 
 var successTests = []parseSuccess{
-	{"version:v1.7.1", &clusterSpecVersion{"v1.7.1"}},
+	{"version:v1.7.1", &clusterSpecVersion{k8sVersion: "v1.7.1"}},
+	{"version:1.27-gke.400", &clusterSpecVersion{k8sVersion: "v1.27.0", platform: "gke", platformRelease: "v1.27-gke.400"}},
+	{"version:openshift-4.12", &clusterSpecVersion{k8sVersion: "v1.25.0", platform: "openshift", platformRelease: "4.12"}},
 	{"file:swagger.json", &clusterSpecFile{"swagger.json", testFS}},
 	{"url:file:///some_file", &clusterSpecLive{"file:///some_file"}},
 }
@@ -62,6 +74,7 @@ var failureTests = []parseFailure{
 	{"version:", "Invalid API specification 'version:'"},
 	{"file:", "Invalid API specification 'file:'"},
 	{"url:", "Invalid API specification 'url:'"},
+	{"version:openshift-4.0", "Unknown OpenShift release '4.0'; pass the Kubernetes version it is based on instead, e.g., 'version:v1.25.0'"},
 }
 
 func TestClusterSpecParsingFailure(t *testing.T) {
@@ -74,3 +87,124 @@ func TestClusterSpecParsingFailure(t *testing.T) {
 		}
 	}
 }
+
+func TestClusterSpecVersionSources(t *testing.T) {
+	defer func(delay time.Duration) { specRetryDelay = delay }(specRetryDelay)
+	specRetryDelay = time.Millisecond
+
+	spec := []byte(`{"swagger": "2.0"}`)
+	sum := sha256.Sum256(spec)
+	checksum := hex.EncodeToString(sum[:])
+
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/flaky/") && requests[r.URL.Path] < 3:
+			w.WriteHeader(http.StatusBadGateway)
+		case strings.HasPrefix(r.URL.Path, "/missing/"):
+			w.WriteHeader(http.StatusNotFound)
+		case strings.HasPrefix(r.URL.Path, "/corrupt/"):
+			w.Write([]byte(`{}`))
+		default:
+			w.Write(spec)
+		}
+	}))
+	defer server.Close()
+
+	retries := 2
+	tests := []struct {
+		mirrors  []string
+		expected map[string]int
+	}{
+		// Server errors are retried.
+		{
+			mirrors:  []string{"/flaky/{version}.json"},
+			expected: map[string]int{"/flaky/v1.7.0.json": 3},
+		},
+		// Missing and corrupt specifications are not retried, but the next
+		// mirror is tried.
+		{
+			mirrors:  []string{"/missing/{version}.json", "/corrupt/{version}.json", "/ok/{version}.json"},
+			expected: map[string]int{"/missing/v1.7.0.json": 1, "/corrupt/v1.7.0.json": 1, "/ok/v1.7.0.json": 1},
+		},
+	}
+
+	for _, test := range tests {
+		requests = map[string]int{}
+		mirrors := []string{}
+		for _, mirror := range test.mirrors {
+			mirrors = append(mirrors, server.URL+mirror)
+		}
+		cs := &clusterSpecVersion{k8sVersion: "v1.7.0", sources: &SpecSourcesSpec{
+			Mirrors:   mirrors,
+			Retries:   &retries,
+			Checksums: map[string]string{"v1.7.0": checksum},
+		}}
+
+		data, err := cs.data(context.Background())
+		if err != nil {
+			t.Errorf("Failed to retrieve spec from %v:\n%v", test.mirrors, err)
+			continue
+		}
+		if string(data) != string(spec) {
+			t.Errorf("Expected spec '%s', got '%s'", spec, data)
+		}
+		if !reflect.DeepEqual(requests, test.expected) {
+			t.Errorf("Expected requests %v, got %v", test.expected, requests)
+		}
+	}
+}
+
+func TestSpecSourcesURLs(t *testing.T) {
+	var ss *SpecSourcesSpec
+	upstream := fmt.Sprintf(k8sVersionURLTemplate, "v1.8.0")
+	if urls := ss.urls("v1.8.0"); !reflect.DeepEqual(urls, []string{upstream}) {
+		t.Errorf("Expected only the upstream URL, got %v", urls)
+	}
+
+	ss = &SpecSourcesSpec{Mirrors: []string{"https://artifacts.example.com/k8s/{version}/swagger.json"}}
+	expected := []string{"https://artifacts.example.com/k8s/v1.8.0/swagger.json", upstream}
+	if urls := ss.urls("v1.8.0"); !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected URLs %v, got %v", expected, urls)
+	}
+}
+
+func TestClusterSpecVersionPlatform(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/kubernetes/v1.25.0.json":
+			w.Write([]byte(`{"info": {"version": "v1.25.0"}, "definitions": {"io.k8s.api.core.v1.Pod": {}}}`))
+		case "/openshift/4.12.json":
+			w.Write([]byte(`{"definitions": {"com.github.openshift.api.route.v1.Route": {}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cs := &clusterSpecVersion{k8sVersion: "v1.25.0", platform: "openshift", platformRelease: "4.12", sources: &SpecSourcesSpec{
+		Mirrors:   []string{server.URL + "/kubernetes/{version}.json"},
+		Platforms: map[string][]string{"openshift": {server.URL + "/openshift/{version}.json"}},
+	}}
+	data, err := cs.data(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to retrieve spec:\n%v", err)
+	}
+
+	var spec struct {
+		Info        map[string]string      `json:"info"`
+		Definitions map[string]interface{} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("Failed to parse merged spec:\n%v", err)
+	}
+	if spec.Info["version"] != "v1.25.0" {
+		t.Errorf("Expected the Kubernetes version to be kept, got '%s'", spec.Info["version"])
+	}
+	for _, name := range []string{"io.k8s.api.core.v1.Pod", "io.k8s.openshift.pkg.apis.route.v1.Route"} {
+		if _, ok := spec.Definitions[name]; !ok {
+			t.Errorf("Expected definition '%s' in merged spec, got %v", name, spec.Definitions)
+		}
+	}
+}
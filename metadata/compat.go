@@ -0,0 +1,188 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+)
+
+// AppFeatures lists the `app.yaml` features that this version of ks
+// understands. Applications that rely on a feature older versions of ks would
+// ignore (or misinterpret) should list it in `requires`, so that those
+// versions refuse to operate on the application instead.
+var AppFeatures = []string{
+	"environmentRegistry",
+	"libPaths",
+	"componentLabels",
+	"healthPolicies",
+	"jsonnetLimits",
+	"budgets",
+	"credentials",
+	"environmentDefaults",
+	"specSources",
+	"pluginsDir",
+	"skipValidate",
+	"skipDiff",
+	"jobRerun",
+	"mixins",
+}
+
+// CheckVersion returns an error if the application cannot safely be used with
+// version `ksVersion` of ks, i.e., if `ksVersion` is older than the
+// `minKsVersion` in `app.yaml`, or if `app.yaml` uses features `ksVersion`
+// does not understand. Development builds (whose version does not parse) are
+// not checked against `minKsVersion`.
+func (m *manager) CheckVersion(ksVersion string) error {
+	data, err := m.readAppYAML()
+	if err != nil || data == nil {
+		return err
+	}
+
+	// Check the version before anything else: if it's too old, the rest of
+	// `app.yaml` may well not parse, and an upgrade is the fix either way.
+	var header struct {
+		MinKsVersion string   `json:"minKsVersion"`
+		Requires     []string `json:"requires"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("Failed to parse '%s':\n%v", appYAMLFile, err)
+	}
+
+	if header.MinKsVersion != "" {
+		min, err := parseKsVersion(header.MinKsVersion)
+		if err != nil {
+			return fmt.Errorf("Invalid 'minKsVersion' in '%s': %v", appYAMLFile, err)
+		}
+
+		curr, err := parseKsVersion(ksVersion)
+		if err != nil {
+			log.Debugf("Not checking ks version '%s' against minimum version '%s' required by application", ksVersion, header.MinKsVersion)
+		} else if curr.less(min) {
+			return fmt.Errorf("This application requires ks version %s or later, but this is version %s; please upgrade ks", header.MinKsVersion, ksVersion)
+		}
+	}
+
+	supported := map[string]bool{}
+	for _, feature := range AppFeatures {
+		supported[feature] = true
+	}
+	missing := []string{}
+	for _, feature := range header.Requires {
+		if !supported[feature] {
+			missing = append(missing, feature)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("This application requires features that ks version %s does not support: %s; please upgrade ks", ksVersion, strings.Join(missing, ", "))
+	}
+
+	_, err = parseAppSpec(data)
+	return err
+}
+
+// parseAppSpec parses the contents of `app.yaml`. Unlike a plain unmarshal, it
+// fails on fields that `AppSpec` does not have, since these are usually
+// features of a newer version of ks, which would otherwise silently be
+// ignored.
+func parseAppSpec(data []byte) (*AppSpec, error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse '%s':\n%v", appYAMLFile, err)
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(jsonData, &fields); err != nil {
+		return nil, fmt.Errorf("Failed to parse '%s':\n%v", appYAMLFile, err)
+	}
+
+	known := map[string]bool{}
+	specType := reflect.TypeOf(AppSpec{})
+	for i := 0; i < specType.NumField(); i++ {
+		name := strings.Split(specType.Field(i).Tag.Get("json"), ",")[0]
+		known[name] = true
+	}
+
+	unknown := []string{}
+	for name := range fields {
+		if !known[name] && !isExtension(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("'%s' has fields this version of ks does not understand: %s; the application may require a newer version of ks", appYAMLFile, strings.Join(unknown, ", "))
+	}
+
+	spec := &AppSpec{}
+	if err := json.Unmarshal(jsonData, spec); err != nil {
+		return nil, fmt.Errorf("Failed to parse '%s':\n%v", appYAMLFile, err)
+	}
+	spec.Extensions = extensions(fields)
+	return spec, nil
+}
+
+// ksVersion is a parsed ks release version, e.g., `v0.9.0-rc.1`.
+type ksVersion struct {
+	parts      [3]int
+	prerelease string
+}
+
+// parseKsVersion parses a version of the form `[v]MAJOR[.MINOR[.PATCH]][-PRE]`.
+func parseKsVersion(s string) (*ksVersion, error) {
+	v := &ksVersion{}
+
+	trimmed := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(trimmed, "-"); i >= 0 {
+		trimmed, v.prerelease = trimmed[:i], trimmed[i+1:]
+	}
+
+	split := strings.Split(trimmed, ".")
+	if len(split) > 3 {
+		return nil, fmt.Errorf("Could not parse version '%s'", s)
+	}
+	for i, part := range split {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Could not parse version '%s'", s)
+		}
+		v.parts[i] = n
+	}
+
+	return v, nil
+}
+
+// less reports whether `v` is an earlier version than `other`. A prerelease
+// comes before the release it precedes.
+func (v *ksVersion) less(other *ksVersion) bool {
+	for i := range v.parts {
+		if v.parts[i] != other.parts[i] {
+			return v.parts[i] < other.parts[i]
+		}
+	}
+
+	if v.prerelease == "" || other.prerelease == "" {
+		return v.prerelease != "" && other.prerelease == ""
+	}
+	return v.prerelease < other.prerelease
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestCheckVersion(t *testing.T) {
+	m := mockEnvironments(t, "test-check-version")
+
+	if err := m.CheckVersion("0.1.0"); err != nil {
+		t.Errorf("Expected an application without 'app.yaml' to be compatible, got:\n%v", err)
+	}
+
+	tests := []struct {
+		appYAML   string
+		ksVersion string
+		errSubstr string
+	}{
+		{"minKsVersion: 0.9.0\n", "v0.9.0", ""},
+		{"minKsVersion: 0.9.0\n", "v0.10.1", ""},
+		{"minKsVersion: 0.9.0\n", "(dev build)", ""},
+		{"minKsVersion: 0.9.0\n", "v0.8.2", "requires ks version 0.9.0 or later"},
+		{"minKsVersion: 0.9.0\n", "v0.9.0-rc.1", "requires ks version 0.9.0 or later"},
+		{"minKsVersion: 0.9\n", "v0.9.0-rc.1", "requires ks version 0.9 or later"},
+		{"minKsVersion: latest\n", "v0.9.0", "Invalid 'minKsVersion'"},
+		{"requires: [libPaths, healthPolicies]\n", "v0.9.0", ""},
+		{"requires: [jsonnetLimits]\njsonnet: {maxStack: 200, timeout: 30s}\n", "v0.9.0", ""},
+		{"requires: [skipValidate, skipDiff, jobRerun]\ncomponents: {jobs: {skipDiff: true, jobRerun: recreate}}\n", "v0.9.0", ""},
+		{"requires: [libPaths, teleportation]\n", "v0.9.0", "does not support: teleportation"},
+		{"libPaths: [lib]\nfancyNewField: true\n", "v0.9.0", "does not understand: fancyNewField"},
+		// Fields of other tools are not ks's to understand.
+		{"libPaths: [lib]\nx-argo: {project: web}\n", "v0.9.0", ""},
+		// A too-old version is reported even if newer fields don't parse.
+		{"minKsVersion: 1.0.0\nfancyNewField: true\n", "v0.9.0", "requires ks version 1.0.0"},
+	}
+
+	appYAMLPath := string(appendToAbsPath(m.rootPath, appYAMLFile))
+	for _, test := range tests {
+		if err := afero.WriteFile(testFS, appYAMLPath, []byte(test.appYAML), defaultFilePermissions); err != nil {
+			t.Fatalf("Failed to write app.yaml:\n%v", err)
+		}
+
+		err := m.CheckVersion(test.ksVersion)
+		if test.errSubstr == "" && err != nil {
+			t.Errorf("Expected app.yaml %q to be compatible with ks %s, got:\n%v", test.appYAML, test.ksVersion, err)
+		} else if test.errSubstr != "" && (err == nil || !strings.Contains(err.Error(), test.errSubstr)) {
+			t.Errorf("Expected app.yaml %q with ks %s to fail with '%s', got: %v", test.appYAML, test.ksVersion, test.errSubstr, err)
+		}
+	}
+
+	if _, err := m.AppSpec(); err == nil || !strings.Contains(err.Error(), "fancyNewField") {
+		t.Errorf("Expected AppSpec to reject unknown fields, got: %v", err)
+	}
+}
+
+func TestJsonnetSpecLimits(t *testing.T) {
+	var none *JsonnetSpec
+	if limits, err := none.Limits(); err != nil || limits.MaxStack != 0 || limits.Timeout != 0 {
+		t.Errorf("Expected no limits for a nil spec, got %#v, %v", limits, err)
+	}
+
+	limits, err := (&JsonnetSpec{MaxStack: 200, Timeout: "1m30s"}).Limits()
+	if err != nil {
+		t.Fatalf("Unexpected error:\n%v", err)
+	}
+	if limits.MaxStack != 200 || limits.Timeout != 90*time.Second {
+		t.Errorf("Expected a stack of 200 and a timeout of 1m30s, got %#v", limits)
+	}
+
+	for _, timeout := range []string{"30", "-1s"} {
+		if _, err := (&JsonnetSpec{Timeout: timeout}).Limits(); err == nil || !strings.Contains(err.Error(), "Invalid 'jsonnet.timeout'") {
+			t.Errorf("Expected timeout '%s' to be rejected, got %v", timeout, err)
+		}
+	}
+}
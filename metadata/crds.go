@@ -0,0 +1,80 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// crdsDir is the directory, at the root of a vendored library, in which the
+// library ships the CustomResourceDefinitions its prototypes rely on.
+const crdsDir = "crds"
+
+// CRDPaths returns the YAML and JSON files in the `crds/` directory of every
+// vendored library, including the libraries vendored by the workspace (if
+// any). `ks validate` uses the CustomResourceDefinitions in these files to
+// check custom resources without consulting the cluster.
+func (m *manager) CRDPaths() (AbsPaths, error) {
+	dirs := []string{string(m.vendorDir)}
+	ws, err := findWorkspace(m.rootPath, m.appFS)
+	if err != nil {
+		return nil, err
+	} else if ws != nil && ws.VendorPath() != "" {
+		dirs = append(dirs, string(ws.VendorPath()))
+	}
+
+	paths := AbsPaths{}
+	for _, dir := range dirs {
+		libs, err := m.vendoredLibraries(dir, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, lib := range libs {
+			libCRDs := []string{}
+			crdPath := filepath.Join(dir, lib.Name, crdsDir)
+			exists, err := afero.DirExists(m.appFS, crdPath)
+			if err != nil {
+				return nil, err
+			} else if !exists {
+				continue
+			}
+
+			err = afero.Walk(m.appFS, crdPath, func(p string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				switch strings.ToLower(filepath.Ext(p)) {
+				case ".yaml", ".yml", ".json":
+					if !info.IsDir() {
+						libCRDs = append(libCRDs, p)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(libCRDs)
+			paths = append(paths, libCRDs...)
+		}
+	}
+	return paths, nil
+}
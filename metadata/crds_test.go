@@ -0,0 +1,53 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCRDPaths(t *testing.T) {
+	m := mockEnvironments(t, "test-crd-paths")
+
+	files := []string{
+		"vendor/operator/crds/widgets.yaml",
+		"vendor/operator/crds/nested/crontabs.json",
+		"vendor/operator/crds/README.md",
+		"vendor/operator/operator.libsonnet",
+		"vendor/plainlib/plainlib.libsonnet",
+	}
+	for _, name := range files {
+		if err := afero.WriteFile(testFS, string(appendToAbsPath(m.rootPath, name)), []byte("{}"), defaultFilePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := m.CRDPaths()
+	if err != nil {
+		t.Fatalf("Failed to find CRD paths:\n%v", err)
+	}
+
+	expected := AbsPaths{
+		string(appendToAbsPath(m.rootPath, "vendor/operator/crds/nested/crontabs.json")),
+		string(appendToAbsPath(m.rootPath, "vendor/operator/crds/widgets.yaml")),
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected CRD paths %v, got %v", expected, paths)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+// CredentialSpec describes where the credentials used to authenticate to the
+// cluster of an environment come from, so that they never need to be written
+// into the application (or kubeconfig). For example, in `app.yaml`:
+//
+//	credentials:
+//	  prod:
+//	    provider: exec
+//	    command: [vault, read, -field=token, secret/k8s/prod]
+//	  dev:
+//	    provider: env
+//	    variable: DEV_CLUSTER_TOKEN
+//
+// Which fields are used depends on the provider.
+type CredentialSpec struct {
+	// Provider names the credential provider, e.g., `env`, `exec`,
+	// `keychain`, `gcloud`, or `aws`.
+	Provider string `json:"provider"`
+	// Variable is the environment variable holding the token (`env`).
+	Variable string `json:"variable,omitempty"`
+	// Command is the command (and its arguments) that prints the token
+	// (`exec`).
+	Command []string `json:"command,omitempty"`
+	// Service and Account locate the token in the system keychain
+	// (`keychain`). Account also selects the account of cloud SDKs.
+	Service string `json:"service,omitempty"`
+	Account string `json:"account,omitempty"`
+	// Cluster, Region, and Profile select the cluster a cloud SDK issues a
+	// token for (`aws`).
+	Cluster string `json:"cluster,omitempty"`
+	Region  string `json:"region,omitempty"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// EnvironmentCredentials returns the credentials `app.yaml` configures for
+// the environment `name`, or for the nearest environment it inherits from
+// that has any. It returns nil if none are configured, in which case the
+// credentials of kubeconfig are used.
+func (m *manager) EnvironmentCredentials(name string) (*CredentialSpec, error) {
+	appSpec, err := m.AppSpec()
+	if err != nil {
+		return nil, err
+	}
+	if len(appSpec.Credentials) == 0 {
+		return nil, nil
+	}
+
+	chain, err := m.EnvironmentChain(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range chain {
+		if spec, ok := appSpec.Credentials[env.Name]; ok && spec != nil {
+			return spec, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestEnvironmentCredentials(t *testing.T) {
+	m := mockEnvironments(t, "test-environment-credentials")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	if err := m.CreateEnvironment(context.Background(), "us-west/canary", mockAPIServerURI, mockNamespace, mockEnvName2, spec); err != nil {
+		t.Fatalf("Failed to create inheriting environment:\n%v", err)
+	}
+
+	if creds, err := m.EnvironmentCredentials(mockEnvName2); err != nil || creds != nil {
+		t.Errorf("Expected no credentials without app.yaml, got %v, %v", creds, err)
+	}
+
+	appYAML := `credentials:
+  us-west/prod:
+    provider: exec
+    command: [vault, read, -field=token, secret/k8s/prod]
+  us-west/test:
+    provider: env
+    variable: TEST_CLUSTER_TOKEN
+`
+	if err := afero.WriteFile(testFS, string(m.appYAMLPath), []byte(appYAML), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+
+	for _, tc := range []struct {
+		env      string
+		provider string
+	}{
+		{mockEnvName, "env"},
+		{mockEnvName2, "exec"},
+		// Inherited from 'us-west/prod'.
+		{"us-west/canary", "exec"},
+		{mockEnvName3, ""},
+	} {
+		creds, err := m.EnvironmentCredentials(tc.env)
+		if err != nil {
+			t.Fatalf("Failed to get credentials of '%s':\n%v", tc.env, err)
+		}
+		if tc.provider == "" && creds != nil {
+			t.Errorf("Expected no credentials for '%s', got %#v", tc.env, creds)
+		} else if tc.provider != "" && (creds == nil || creds.Provider != tc.provider) {
+			t.Errorf("Expected credentials from '%s' for '%s', got %#v", tc.provider, tc.env, creds)
+		}
+	}
+
+	if _, err := m.EnvironmentCredentials("us-west/missing"); err == nil {
+		t.Errorf("Expected getting the credentials of a missing environment to fail")
+	}
+}
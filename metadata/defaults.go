@@ -0,0 +1,69 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import "strings"
+
+// envNameRef is replaced by the name of the environment in the values of
+// `EnvironmentDefaultsSpec`.
+const envNameRef = "{env}"
+
+// EnvironmentDefaultsSpec holds the values `ks env add` uses for the
+// environments of the application when they are not given on the command
+// line, so that environments created by different people are consistent. In
+// the values, `{env}` stands for the name of the new environment, with
+// slashes replaced by dashes (e.g., `us-west-qa` for `us-west/qa`), so that it
+// can be used in host names and namespaces. For example, in `app.yaml`:
+//
+//	environmentDefaults:
+//	  server: https://{env}.clusters.example.com
+//	  namespace: web
+//	  kubernetesVersion: v1.7.0
+type EnvironmentDefaultsSpec struct {
+	// Server is the URI of the cluster of new environments.
+	Server string `json:"server,omitempty"`
+	// Namespace is the namespace of new environments.
+	Namespace string `json:"namespace,omitempty"`
+	// KubernetesVersion is the Kubernetes version (e.g., `v1.7.0`) whose API
+	// specification the ksonnet-lib of new environments is generated from.
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// OverrideTemplate is the path (absolute, or relative to the application
+	// root) of the Go template that the `.jsonnet` files of new environments
+	// are generated from, rather than `environments/.templates/override.jsonnet`.
+	OverrideTemplate string `json:"overrideTemplate,omitempty"`
+}
+
+// EnvironmentDefaults returns the defaults `app.yaml` configures for the new
+// environment `name`, with `{env}` replaced by (the dashed form of) `name`.
+// It returns an empty spec if there are none.
+func (m *manager) EnvironmentDefaults(name string) (*EnvironmentDefaultsSpec, error) {
+	appSpec, err := m.AppSpec()
+	if err != nil {
+		return nil, err
+	}
+	if appSpec.EnvironmentDefaults == nil {
+		return &EnvironmentDefaultsSpec{}, nil
+	}
+
+	defaults := appSpec.EnvironmentDefaults
+	name = strings.Replace(name, "/", "-", -1)
+	return &EnvironmentDefaultsSpec{
+		Server:            strings.Replace(defaults.Server, envNameRef, name, -1),
+		Namespace:         strings.Replace(defaults.Namespace, envNameRef, name, -1),
+		KubernetesVersion: defaults.KubernetesVersion,
+		OverrideTemplate:  defaults.OverrideTemplate,
+	}, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestEnvironmentDefaults(t *testing.T) {
+	m := mockEnvironments(t, "test-environment-defaults")
+
+	defaults, err := m.EnvironmentDefaults("qa")
+	if err != nil {
+		t.Fatalf("Failed to get defaults without app.yaml:\n%v", err)
+	}
+	if *defaults != (EnvironmentDefaultsSpec{}) {
+		t.Errorf("Expected no defaults without app.yaml, got %#v", defaults)
+	}
+
+	appYAML := `environmentDefaults:
+  server: https://{env}.clusters.example.com
+  namespace: web-{env}
+  kubernetesVersion: v1.7.0
+`
+	if err := afero.WriteFile(testFS, string(m.appYAMLPath), []byte(appYAML), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+
+	defaults, err = m.EnvironmentDefaults("us-west/qa")
+	if err != nil {
+		t.Fatalf("Failed to get defaults:\n%v", err)
+	}
+	expected := EnvironmentDefaultsSpec{
+		Server:            "https://us-west-qa.clusters.example.com",
+		Namespace:         "web-us-west-qa",
+		KubernetesVersion: "v1.7.0",
+	}
+	if *defaults != expected {
+		t.Errorf("Expected defaults %#v, got %#v", expected, defaults)
+	}
+}
@@ -17,11 +17,13 @@ package metadata
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -29,6 +31,7 @@ import (
 
 	"github.com/ksonnet/ksonnet-lib/ksonnet-gen/ksonnet"
 	"github.com/ksonnet/ksonnet-lib/ksonnet-gen/kubespec"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 const (
@@ -47,104 +50,269 @@ type Environment struct {
 	Name      string
 	URI       string
 	Namespace string
+	// KubernetesVersion is the Kubernetes release (e.g., `v1.7.0`) whose API
+	// specification the environment's ksonnet-lib was generated from, if
+	// known (see `UpdateEnvironmentKubernetesVersion`).
+	KubernetesVersion string
+	// ClusterSelector, if set, is a label selector over the cluster inventory;
+	// the environment is applied to every matching cluster, rather than to
+	// `URI`.
+	ClusterSelector string
+	// Context, if set, is the name of the kubeconfig context the environment
+	// is deployed with, rather than the kubeconfig cluster whose server is
+	// `URI`. The context is resolved when a command runs, so neither the
+	// cluster's address nor its credentials are written into the application.
+	Context string
+	// Inherits, if set, is the name of the environment this environment
+	// extends: its overrides are applied on top of those of the parent, rather
+	// than directly on top of the components.
+	Inherits string
+	// Targets, if set, scopes the environment to the components they name
+	// (see `SetEnvironmentTargets`).
+	Targets []string
+	// LibraryPins maps the names of vendored libraries to the directories
+	// (absolute, or relative to the application root) that the environment
+	// imports them from, e.g., `{"mylib": "vendor/mylib@1.2"}`. Pins are
+	// inherited from parent environments.
+	LibraryPins map[string]string
+	// LibPaths are extra Jsonnet library search paths (absolute, or relative
+	// to the application root) for the environment, e.g.,
+	// `environments/prod/lib`. They take precedence over the application's
+	// `lib/` and the library paths of `app.yaml`, and are inherited from
+	// parent environments.
+	LibPaths []string
+	// ComponentNamespaces maps the names of components to the namespaces
+	// their objects are deployed to, for components that do not belong in
+	// `Namespace`. Objects that set their own namespace are left alone.
+	// Mappings are inherited from parent environments.
+	ComponentNamespaces map[string]string
+	// ComponentServers maps the names of components to the URIs of the
+	// clusters their objects are deployed to, for components that do not
+	// run in the environment's cluster (e.g., monitoring agents that run in a
+	// shared operations cluster). Mappings are inherited from parent
+	// environments.
+	ComponentServers map[string]string
+	// ExtVars and TlaVars are the external variables and top-level arguments
+	// (as strings) of every Jsonnet evaluation for the environment, e.g., its
+	// region or cluster name. Those given on the command line take
+	// precedence. They are inherited from parent environments.
+	ExtVars map[string]string
+	TlaVars map[string]string
+	// Aliases are alternative (typically shorter) names for the environment,
+	// which `GetEnvironment` and commands that take an environment name
+	// accept in place of `Name`.
+	Aliases []string
+	// Protected environments (e.g., production) require explicit
+	// confirmation before destructive commands, such as 'apply', 'delete', and
+	// 'env rm', operate on them.
+	Protected bool
+	// Labels and Annotations describe the environment, e.g., its tier or its
+	// owning team. Labels can be selected on (see `SelectEnvironments`), to
+	// operate on every environment sharing them. Neither is inherited.
+	Labels      map[string]string
+	Annotations map[string]string
+	// Hooks, if set, are run around applying the environment and deleting
+	// its objects.
+	Hooks *EnvironmentHooks
+}
+
+// EnvironmentFile is a file that creating an environment writes.
+type EnvironmentFile struct {
+	Path AbsPath
+	// Data is the contents of the file. When previewing an environment, the
+	// cluster's API specification is not retrieved, so the files generated
+	// from it (the schema and ksonnet-lib) have no data.
+	Data []byte
 }
 
 // EnvironmentSpec represents the contents in spec.json.
 type EnvironmentSpec struct {
-	URI       string `json:"uri"`
-	Namespace string `json:"namespace"`
+	URI                 string            `json:"uri"`
+	Namespace           string            `json:"namespace"`
+	KubernetesVersion   string            `json:"kubernetesVersion,omitempty"`
+	ClusterSelector     string            `json:"clusterSelector,omitempty"`
+	Context             string            `json:"context,omitempty"`
+	Inherits            string            `json:"inherits,omitempty"`
+	Targets             []string          `json:"targets,omitempty"`
+	LibraryPins         map[string]string `json:"libraryPins,omitempty"`
+	LibPaths            []string          `json:"libPaths,omitempty"`
+	ComponentNamespaces map[string]string `json:"componentNamespaces,omitempty"`
+	ComponentServers    map[string]string `json:"componentServers,omitempty"`
+	ExtVars             map[string]string `json:"extVars,omitempty"`
+	TlaVars             map[string]string `json:"tlaVars,omitempty"`
+	Aliases             []string          `json:"aliases,omitempty"`
+	Protected           bool              `json:"protected,omitempty"`
+	Labels              map[string]string `json:"labels,omitempty"`
+	Annotations         map[string]string `json:"annotations,omitempty"`
+	Hooks               *EnvironmentHooks `json:"hooks,omitempty"`
+}
+
+// environmentSpec returns the `spec.json` contents describing `env`.
+func environmentSpec(env *Environment) EnvironmentSpec {
+	return EnvironmentSpec{
+		URI:                 env.URI,
+		Namespace:           env.Namespace,
+		KubernetesVersion:   env.KubernetesVersion,
+		ClusterSelector:     env.ClusterSelector,
+		Context:             env.Context,
+		Inherits:            env.Inherits,
+		Targets:             env.Targets,
+		LibraryPins:         env.LibraryPins,
+		LibPaths:            env.LibPaths,
+		ComponentNamespaces: env.ComponentNamespaces,
+		ComponentServers:    env.ComponentServers,
+		ExtVars:             env.ExtVars,
+		TlaVars:             env.TlaVars,
+		Aliases:             env.Aliases,
+		Protected:           env.Protected,
+		Labels:              env.Labels,
+		Annotations:         env.Annotations,
+		Hooks:               env.Hooks,
+	}
 }
 
-func (m *manager) CreateEnvironment(name, uri, namespace string, spec ClusterSpec) error {
-	extensionsLibData, k8sLibData, specData, err := m.generateKsonnetLibData(spec)
+// newEnvironment returns the environment `name`, whose directory is at `path`,
+// described by the `spec.json` contents `spec`.
+func newEnvironment(name, path string, spec *EnvironmentSpec) *Environment {
+	return &Environment{
+		Name:                name,
+		Path:                path,
+		URI:                 spec.URI,
+		Namespace:           spec.Namespace,
+		KubernetesVersion:   spec.KubernetesVersion,
+		ClusterSelector:     spec.ClusterSelector,
+		Context:             spec.Context,
+		Inherits:            spec.Inherits,
+		Targets:             spec.Targets,
+		LibraryPins:         spec.LibraryPins,
+		LibPaths:            spec.LibPaths,
+		ComponentNamespaces: spec.ComponentNamespaces,
+		ComponentServers:    spec.ComponentServers,
+		ExtVars:             spec.ExtVars,
+		TlaVars:             spec.TlaVars,
+		Aliases:             spec.Aliases,
+		Protected:           spec.Protected,
+		Labels:              spec.Labels,
+		Annotations:         spec.Annotations,
+		Hooks:               spec.Hooks,
+	}
+}
+
+func (m *manager) CreateEnvironment(ctx context.Context, name, uri, namespace, inherits string, spec ClusterSpec) error {
+	// Check the environment can be created before doing the expensive work of
+	// generating ksonnet-lib.
+	if _, err := m.environmentFiles(name, uri, namespace, inherits, nil, nil, nil); err != nil {
+		return err
+	}
+
+	p := newProgress(ctx, 3)
+
+	extensionsLibData, k8sLibData, specData, err := m.generateKsonnetLibData(p, spec)
 	if err != nil {
 		log.Debugf("Failed to write '%s'", specFilename)
 		return err
 	}
 
-	err = m.createEnvironment(name, uri, namespace, extensionsLibData, k8sLibData, specData)
-	if err == nil {
-		log.Infof("Environment '%s' pointing to namespace '%s' and cluster at URI '%s' successfully created", name, namespace, uri)
+	if err := p.phase("Writing environment '%s'", name); err != nil {
+		return err
 	}
-	return err
-}
 
-func (m *manager) createEnvironment(name, uri, namespace string, extensionsLibData, k8sLibData, specData []byte) error {
-	exists, err := m.environmentExists(name)
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
+	err = m.createEnvironment(tx, name, uri, namespace, inherits, extensionsLibData, k8sLibData, specData)
 	if err != nil {
-		log.Debug("Failed to check whether environment exists")
 		return err
 	}
-	if exists {
-		return fmt.Errorf("Environment '%s' already exists", name)
-	}
 
-	// ensure environment name does not contain punctuation
-	if !isValidName(name) {
-		return fmt.Errorf("Environment name '%s' is not valid; must not contain punctuation, spaces, or begin or end with a slash", name)
+	if err := tx.commit(); err != nil {
+		return err
 	}
 
-	log.Infof("Creating environment '%s' with namespace '%s', pointing at cluster located at uri '%s'", name, namespace, uri)
+	log.Infof("Environment '%s' pointing to namespace '%s' and cluster at URI '%s' successfully created", name, namespace, uri)
+	return nil
+}
 
-	envPath := appendToAbsPath(m.environmentsPath, name)
-	err = m.appFS.MkdirAll(string(envPath), defaultFolderPermissions)
+func (m *manager) createEnvironment(tx *transaction, name, uri, namespace, inherits string, extensionsLibData, k8sLibData, specData []byte) error {
+	files, err := m.environmentFiles(name, uri, namespace, inherits, extensionsLibData, k8sLibData, specData)
 	if err != nil {
 		return err
 	}
 
+	log.Infof("Creating environment '%s' with namespace '%s', pointing at cluster located at uri '%s'", name, namespace, uri)
+
+	envPath := appendToAbsPath(m.environmentsPath, name)
 	metadataPath := appendToAbsPath(envPath, metadataDirName)
-	err = m.appFS.MkdirAll(string(metadataPath), defaultFolderPermissions)
+	err = tx.mkdirAll(metadataPath)
 	if err != nil {
 		return err
 	}
 
 	log.Infof("Generating environment metadata at path '%s'", envPath)
 
-	// Generate the schema file.
-	log.Debugf("Generating '%s', length: %d", schemaFilename, len(specData))
-	schemaPath := appendToAbsPath(metadataPath, schemaFilename)
-	err = afero.WriteFile(m.appFS, string(schemaPath), specData, defaultFilePermissions)
-	if err != nil {
-		log.Debugf("Failed to write '%s'", schemaFilename)
-		return err
+	for _, f := range files {
+		fileName := path.Base(string(f.Path))
+		log.Debugf("Generating '%s', length: %d", fileName, len(f.Data))
+		if err := tx.writeFile(f.Path, f.Data); err != nil {
+			log.Debugf("Failed to write '%s'", fileName)
+			return err
+		}
 	}
+	return nil
+}
+
+func (m *manager) PreviewEnvironment(name, uri, namespace, inherits string) ([]*EnvironmentFile, error) {
+	return m.environmentFiles(name, uri, namespace, inherits, nil, nil, nil)
+}
 
-	log.Debugf("Generating '%s', length: %d", k8sLibFilename, len(k8sLibData))
-	k8sLibPath := appendToAbsPath(metadataPath, k8sLibFilename)
-	err = afero.WriteFile(m.appFS, string(k8sLibPath), k8sLibData, defaultFilePermissions)
+// environmentFiles returns the files that make up a new environment `name`,
+// in the order they are written. It fails if the environment cannot be
+// created, e.g., because it already exists.
+func (m *manager) environmentFiles(name, uri, namespace, inherits string, extensionsLibData, k8sLibData, specData []byte) ([]*EnvironmentFile, error) {
+	exists, err := m.environmentExists(name)
 	if err != nil {
-		log.Debugf("Failed to write '%s'", k8sLibFilename)
-		return err
+		log.Debug("Failed to check whether environment exists")
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("Environment '%s' already exists", name)
 	}
 
-	log.Debugf("Generating '%s', length: %d", extensionsLibFilename, len(extensionsLibData))
-	extensionsLibPath := appendToAbsPath(metadataPath, extensionsLibFilename)
-	err = afero.WriteFile(m.appFS, string(extensionsLibPath), extensionsLibData, defaultFilePermissions)
-	if err != nil {
-		log.Debugf("Failed to write '%s'", extensionsLibFilename)
-		return err
+	// ensure environment name does not contain punctuation
+	if !isValidName(name) {
+		return nil, fmt.Errorf("Environment name '%s' is not valid; must not contain punctuation, spaces, or begin or end with a slash", name)
+	}
+
+	if err := m.checkAliasAvailable(name); err != nil {
+		return nil, err
+	}
+
+	if inherits != "" {
+		if _, err := m.EnvironmentChain(inherits); err != nil {
+			return nil, fmt.Errorf("Could not inherit from environment '%s':\n%v", inherits, err)
+		}
 	}
 
-	// Generate the environment .jsonnet file
-	overrideFileName := path.Base(name) + ".jsonnet"
-	overrideData := m.generateOverrideData()
-	log.Debugf("Generating '%s', length: %d", overrideFileName, len(overrideData))
-	overrideLibPath := appendToAbsPath(envPath, overrideFileName)
-	err = afero.WriteFile(m.appFS, string(overrideLibPath), overrideData, defaultFilePermissions)
+	envSpecData, err := generateSpecData(uri, namespace, inherits, schemaVersion(specData))
 	if err != nil {
-		log.Debugf("Failed to write '%s'", overrideFileName)
-		return err
+		return nil, err
 	}
 
-	// Generate the environment spec file.
-	envSpecData, err := generateSpecData(uri, namespace)
+	overrideData, err := m.overrideData(name, inherits)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Debugf("Generating '%s', length: %d", specFilename, len(envSpecData))
-	envSpecPath := appendToAbsPath(envPath, specFilename)
-	return afero.WriteFile(m.appFS, string(envSpecPath), envSpecData, defaultFilePermissions)
+	envPath := appendToAbsPath(m.environmentsPath, name)
+	metadataPath := appendToAbsPath(envPath, metadataDirName)
+	return []*EnvironmentFile{
+		{Path: appendToAbsPath(metadataPath, schemaFilename), Data: specData},
+		{Path: appendToAbsPath(metadataPath, k8sLibFilename), Data: k8sLibData},
+		{Path: appendToAbsPath(metadataPath, extensionsLibFilename), Data: extensionsLibData},
+		// The environment .jsonnet file
+		{Path: appendToAbsPath(envPath, path.Base(name)+".jsonnet"), Data: overrideData},
+		{Path: appendToAbsPath(envPath, specFilename), Data: envSpecData},
+	}, nil
 }
 
 func (m *manager) DeleteEnvironment(name string) error {
@@ -160,37 +328,68 @@ func (m *manager) DeleteEnvironment(name string) error {
 		return fmt.Errorf("Environment '%s' does not exist", name)
 	}
 
+	children, err := m.inheritingEnvironments(name)
+	if err != nil {
+		return err
+	} else if len(children) > 0 {
+		return fmt.Errorf("Environment '%s' is inherited by %s; remove them, or change what they inherit from, first", name, quoteNames(children))
+	}
+
 	log.Infof("Deleting environment '%s' at path '%s'", name, envPath)
 
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
+	if err := m.removeEnvironmentDir(tx, name); err != nil {
+		return err
+	}
+
+	if err := tx.commit(); err != nil {
+		return err
+	}
+
+	log.Infof("Successfully removed environment '%s'", name)
+	return nil
+}
+
+// removeEnvironmentDir removes the directory of the environment `name`, as well
+// as any parent directories that are left empty as a result.
+func (m *manager) removeEnvironmentDir(tx *transaction, name string) error {
+	envPath := appendToAbsPath(m.environmentsPath, name)
+
 	// Remove the directory and all files within the environment path.
-	err = m.appFS.RemoveAll(envPath)
+	err := tx.removeAll(envPath)
 	if err != nil {
 		log.Debugf("Failed to remove environment directory at path '%s'", envPath)
 		return err
 	}
 
-	// Need to ensure empty parent directories are also removed.
+	return m.removeEmptyParents(tx, name)
+}
+
+// removeEmptyParents removes the parent directories of the environment
+// directory `name` (relative to `environments/`) that are empty.
+func (m *manager) removeEmptyParents(tx *transaction, name string) error {
 	log.Debug("Removing empty parent directories, if any")
 	parentDir := name
 	for parentDir != "." {
 		parentDir = filepath.Dir(parentDir)
-		parentPath := string(appendToAbsPath(m.environmentsPath, parentDir))
+		parentPath := appendToAbsPath(m.environmentsPath, parentDir)
 
-		isEmpty, err := afero.IsEmpty(m.appFS, parentPath)
+		isEmpty, err := afero.IsEmpty(m.appFS, string(parentPath))
 		if err != nil {
 			log.Debugf("Failed to check whether parent directory at path '%s' is empty", parentPath)
 			return err
 		}
 		if isEmpty {
-			log.Debugf("Failed to remove parent directory at path '%s'", parentPath)
-			err := m.appFS.RemoveAll(parentPath)
+			log.Debugf("Removing empty parent directory at path '%s'", parentPath)
+			err := tx.removeAll(parentPath)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	log.Infof("Successfully removed environment '%s'", name)
 	return nil
 }
 
@@ -206,6 +405,12 @@ func (m *manager) GetEnvironments() ([]*Environment, error) {
 		}
 
 		if isDir {
+			// Directories such as '.archive', '.templates', and the '.metadata'
+			// of each environment do not hold environments.
+			if path != string(m.environmentsPath) && strings.HasPrefix(filepath.Base(path), ".") {
+				return filepath.SkipDir
+			}
+
 			// Only want leaf directories containing a spec.json
 			specPath := filepath.Join(path, specFilename)
 			specFileExists, err := afero.Exists(m.appFS, specPath)
@@ -228,7 +433,7 @@ func (m *manager) GetEnvironments() ([]*Environment, error) {
 				}
 
 				log.Debugf("Found environment '%s', with uri '%s' and namespace '%s'", envName, envSpec.URI, envSpec.Namespace)
-				envs = append(envs, &Environment{Name: envName, Path: path, URI: envSpec.URI, Namespace: envSpec.Namespace})
+				envs = append(envs, newEnvironment(envName, path, &envSpec))
 			}
 		}
 
@@ -253,8 +458,89 @@ func (m *manager) GetEnvironment(name string) (*Environment, error) {
 			return env, nil
 		}
 	}
+	if env := aliasedEnvironment(envs, name); env != nil {
+		return env, nil
+	}
+
+	return nil, m.environmentNotFound(name)
+}
+
+// SelectEnvironments returns the environments whose labels match the label
+// selector `selector` (e.g., 'tier=prod'). An empty selector matches every
+// environment.
+func (m *manager) SelectEnvironments(selector string) ([]*Environment, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid environment selector '%s':\n%v", selector, err)
+	}
+
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []*Environment{}
+	for _, env := range envs {
+		if sel.Matches(labels.Set(env.Labels)) {
+			selected = append(selected, env)
+		}
+	}
+	return selected, nil
+}
+
+// IsEnvironmentPattern returns true if `name` is a glob pattern (e.g.,
+// 'dev-*' or 'us-west/*') rather than the name of a single environment.
+func IsEnvironmentPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// MatchEnvironments returns the names of the environments that `patterns`
+// refer to, in order and without duplicates. Each pattern is either the name
+// (or alias) of an environment, or a glob pattern matched against the names of
+// every environment, in which `*` does not match `/`. Patterns that match no
+// environment are an error.
+func (m *manager) MatchEnvironments(patterns []string) ([]string, error) {
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+
+	matched := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			matched = append(matched, name)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !IsEnvironmentPattern(pattern) {
+			env, err := m.GetEnvironment(pattern)
+			if err != nil {
+				return nil, err
+			}
+			add(env.Name)
+			continue
+		}
 
-	return nil, fmt.Errorf("Environment '%s' does not exist", name)
+		found := false
+		for _, env := range envs {
+			ok, err := path.Match(pattern, env.Name)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid environment pattern '%s':\n%v", pattern, err)
+			}
+			if ok {
+				found = true
+				add(env.Name)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("No environments match the pattern '%s'", pattern)
+		}
+	}
+	return matched, nil
 }
 
 func (m *manager) SetEnvironment(name string, desired *Environment) error {
@@ -262,6 +548,10 @@ func (m *manager) SetEnvironment(name string, desired *Environment) error {
 	if err != nil {
 		return err
 	}
+	name = env.Name
+
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
 
 	// If the name has changed, the directory location needs to be moved to
 	// reflect the change.
@@ -282,17 +572,40 @@ func (m *manager) SetEnvironment(name string, desired *Environment) error {
 		if desiredExists {
 			return fmt.Errorf("Can not update '%s' to '%s', it already exists", name, desired.Name)
 		}
+		if err := m.checkAliasAvailable(desired.Name); err != nil {
+			return err
+		}
 
 		// Move the directory
-		pathOld := string(appendToAbsPath(m.environmentsPath, name))
-		pathNew := string(appendToAbsPath(m.environmentsPath, desired.Name))
+		pathOld := appendToAbsPath(m.environmentsPath, name)
+		pathNew := appendToAbsPath(m.environmentsPath, desired.Name)
 		log.Debugf("Moving directory at path '%s' to '%s'", pathOld, pathNew)
-		err = m.appFS.Rename(pathOld, pathNew)
+		err = tx.move(pathOld, pathNew)
 		if err != nil {
 			log.Debugf("Failed to move path '%s' to '%s", pathOld, pathNew)
 			return err
 		}
 
+		// The overrides file is named after the environment.
+		if path.Base(name) != path.Base(desired.Name) {
+			overrideOld := appendToAbsPath(pathNew, path.Base(name)+".jsonnet")
+			exists, err := afero.Exists(m.appFS, string(overrideOld))
+			if err != nil {
+				return err
+			}
+			if exists {
+				if err := tx.move(overrideOld, m.overridePath(desired.Name)); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Environments that inherit from this one refer to it by name, and
+		// import its overrides by path.
+		if err := m.reparentEnvironments(tx, name, desired.Name); err != nil {
+			return err
+		}
+
 		name = desired.Name
 	}
 
@@ -315,7 +628,59 @@ func (m *manager) SetEnvironment(name string, desired *Environment) error {
 		namespace = env.Namespace
 	}
 
-	newSpec, err := generateSpecData(URI, namespace)
+	clusterSelector := env.ClusterSelector
+	if len(desired.ClusterSelector) != 0 {
+		log.Infof("Setting environment cluster selector to '%s'", desired.ClusterSelector)
+		clusterSelector = desired.ClusterSelector
+	}
+
+	kubeContext := env.Context
+	if len(desired.Context) != 0 {
+		log.Infof("Setting environment kubeconfig context to '%s'", desired.Context)
+		kubeContext = desired.Context
+	}
+	if clusterSelector != "" && kubeContext != "" {
+		// The selected clusters are reached at their own URIs, so a single
+		// context cannot apply to them.
+		return fmt.Errorf("Environment '%s' cannot both select its clusters with '%s' and be deployed with the kubeconfig context '%s'", name, clusterSelector, kubeContext)
+	}
+
+	libraryPins := mergeEnvironmentSettings(env.LibraryPins, desired.LibraryPins,
+		"Pinning library '%s' to '%s'", "Unpinning library '%s'")
+	componentNamespaces := mergeEnvironmentSettings(env.ComponentNamespaces, desired.ComponentNamespaces,
+		"Deploying component '%s' to namespace '%s'", "Deploying component '%s' to the environment's namespace")
+	componentServers := mergeEnvironmentSettings(env.ComponentServers, desired.ComponentServers,
+		"Deploying component '%s' to cluster at URI '%s'", "Deploying component '%s' to the environment's cluster")
+	extVars := mergeEnvironmentSettings(env.ExtVars, desired.ExtVars,
+		"Setting external variable '%s' to '%s'", "Removing external variable '%s'")
+	tlaVars := mergeEnvironmentSettings(env.TlaVars, desired.TlaVars,
+		"Setting top-level argument '%s' to '%s'", "Removing top-level argument '%s'")
+	libPaths := env.LibPaths
+	if desired.LibPaths != nil {
+		libPaths = []string{}
+		for _, p := range desired.LibPaths {
+			if p != "" {
+				libPaths = append(libPaths, p)
+			}
+		}
+		if len(libPaths) == 0 {
+			log.Infof("Removing environment library paths")
+		} else {
+			log.Infof("Setting environment library paths to %s", quoteNames(libPaths))
+		}
+	}
+	envLabels := mergeEnvironmentSettings(env.Labels, desired.Labels,
+		"Setting label '%s' to '%s'", "Removing label '%s'")
+	annotations := mergeEnvironmentSettings(env.Annotations, desired.Annotations,
+		"Setting annotation '%s' to '%s'", "Removing annotation '%s'")
+
+	updated := *env
+	updated.URI, updated.Namespace, updated.ClusterSelector, updated.Context = URI, namespace, clusterSelector, kubeContext
+	updated.LibraryPins, updated.LibPaths = libraryPins, libPaths
+	updated.ComponentNamespaces, updated.ComponentServers = componentNamespaces, componentServers
+	updated.ExtVars, updated.TlaVars = extVars, tlaVars
+	updated.Labels, updated.Annotations = envLabels, annotations
+	newSpec, err := json.MarshalIndent(environmentSpec(&updated), "", "  ")
 	if err != nil {
 		log.Debugf("Failed to generate %s with URI '%s' and namespace '%s'", specFilename, URI, namespace)
 		return err
@@ -324,23 +689,173 @@ func (m *manager) SetEnvironment(name string, desired *Environment) error {
 	envPath := appendToAbsPath(m.environmentsPath, name)
 	specPath := appendToAbsPath(envPath, specFilename)
 
-	err = afero.WriteFile(m.appFS, string(specPath), newSpec, defaultFilePermissions)
+	err = tx.writeFile(specPath, newSpec)
 	if err != nil {
 		log.Debugf("Failed to write %s at path '%s'", specFilename, specPath)
 		return err
 	}
 
+	if err := tx.commit(); err != nil {
+		return err
+	}
+
 	log.Infof("Successfully updated environment '%s'", name)
 	return nil
 }
 
-func (m *manager) generateKsonnetLibData(spec ClusterSpec) ([]byte, []byte, []byte, error) {
+// ClearEnvironmentDestination removes the namespace, the cluster selector
+// and/or the kubeconfig context of the environment `name`. Without a
+// namespace, objects are deployed to the namespace of the kubeconfig context;
+// without a cluster selector or a context, the environment is deployed to the
+// cluster at its URI.
+func (m *manager) ClearEnvironmentDestination(name string, namespace, clusterSelector, kubeContext bool) error {
+	env, err := m.GetEnvironment(name)
+	if err != nil {
+		return err
+	}
+	name = env.Name
+
+	if namespace && env.Namespace != "" {
+		log.Infof("Removing environment namespace")
+		env.Namespace = ""
+	}
+	if clusterSelector && env.ClusterSelector != "" {
+		log.Infof("Removing environment cluster selector")
+		env.ClusterSelector = ""
+	}
+	if kubeContext && env.Context != "" {
+		log.Infof("Removing environment kubeconfig context")
+		env.Context = ""
+	}
+	specData, err := json.MarshalIndent(environmentSpec(env), "", "  ")
+	if err != nil {
+		return err
+	}
+	specPath := appendToAbsPath(m.environmentsPath, name, specFilename)
+	return afero.WriteFile(m.appFS, string(specPath), specData, defaultFilePermissions)
+}
+
+// CopyEnvironment creates the environment `dstName` as a copy of the
+// environment `srcName`: its overrides, its generated ksonnet-lib, and its
+// `spec.json`. If `uri` or `namespace` is non-empty, it replaces the
+// corresponding field of the copy's spec. The copy inherits from whatever the
+// original inherits from. Environments nested under `srcName` (e.g.,
+// 'prod/canary' under 'prod') are not copied.
+func (m *manager) CopyEnvironment(srcName, dstName, uri, namespace string) error {
+	src, err := m.GetEnvironment(srcName)
+	if err != nil {
+		return err
+	}
+	srcName = src.Name
+
+	if !isValidName(dstName) {
+		return fmt.Errorf("Environment name '%s' is not valid; must not contain punctuation, spaces, or begin or end with a slash", dstName)
+	}
+	exists, err := m.environmentExists(dstName)
+	if err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("Environment '%s' already exists", dstName)
+	}
+	if err := m.checkAliasAvailable(dstName); err != nil {
+		return err
+	}
+	if strings.HasPrefix(dstName, srcName+"/") {
+		return fmt.Errorf("Could not copy environment '%s' into its own subdirectory '%s'", srcName, dstName)
+	}
+
+	log.Infof("Copying environment '%s' to '%s'", srcName, dstName)
+
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
+	srcPath := appendToAbsPath(m.environmentsPath, srcName)
+	dstPath := appendToAbsPath(m.environmentsPath, dstName)
+	srcOverride := path.Base(srcName) + ".jsonnet"
+	err = afero.Walk(m.appFS, string(srcPath), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(p, string(srcPath)+"/")
+		if info.IsDir() {
+			if p == string(srcPath) {
+				return nil
+			}
+			// A directory with its own spec is another environment.
+			nested, err := afero.Exists(m.appFS, filepath.Join(p, specFilename))
+			if err != nil {
+				return err
+			} else if nested {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch rel {
+		case specFilename:
+			// Written below, with the new URI and namespace.
+			return nil
+		case srcOverride:
+			// The override file is named after the environment.
+			rel = path.Base(dstName) + ".jsonnet"
+		}
+
+		data, err := afero.ReadFile(m.appFS, p)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Copying '%s' to '%s'", p, filepath.Join(string(dstPath), rel))
+		return tx.writeFile(appendToAbsPath(dstPath, rel), data)
+	})
+	if err != nil {
+		return err
+	}
+
+	spec := environmentSpec(src)
+	// Aliases name a single environment, so they are not copied.
+	spec.Aliases = nil
+	if uri != "" {
+		log.Infof("Setting environment URI to '%s'", uri)
+		spec.URI = uri
+	}
+	if namespace != "" {
+		log.Infof("Setting environment namespace to '%s'", namespace)
+		spec.Namespace = namespace
+	}
+	specData, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tx.writeFile(appendToAbsPath(dstPath, specFilename), specData); err != nil {
+		return err
+	}
+
+	if err := tx.commit(); err != nil {
+		return err
+	}
+
+	log.Infof("Environment '%s' pointing to namespace '%s' and cluster at URI '%s' successfully created", dstName, spec.Namespace, spec.URI)
+	return nil
+}
+
+func (m *manager) generateKsonnetLibData(p *progress, spec ClusterSpec) ([]byte, []byte, []byte, error) {
 	// Get cluster specification data, possibly from the network.
-	text, err := spec.data()
+	if err := p.phase("Retrieving cluster API specification '%s'", spec.resource()); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := m.configureClusterSpec(spec); err != nil {
+		return nil, nil, nil, err
+	}
+	text, err := spec.data(p.ctx)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
+	if err := p.phase("Generating ksonnet-lib"); err != nil {
+		return nil, nil, nil, err
+	}
+
 	ksonnetLibDir := appendToAbsPath(m.environmentsPath, defaultEnvName)
 
 	// Deserialize the API object.
@@ -358,9 +873,18 @@ func (m *manager) generateKsonnetLibData(spec ClusterSpec) ([]byte, []byte, []by
 	return extensionsLibData, k8sLibData, text, err
 }
 
-func (m *manager) generateOverrideData() []byte {
+// generateOverrideData generates the `.jsonnet` file of a new environment,
+// which applies the environment's overrides on top of the components or, if
+// the environment inherits from another environment, on top of that
+// environment's overrides.
+func (m *manager) generateOverrideData(inherits string) []byte {
+	base := m.baseLibsonnetPath
+	if inherits != "" {
+		base = m.overridePath(inherits)
+	}
+
 	var buf bytes.Buffer
-	buf.WriteString(fmt.Sprintf("local base = import \"%s\";\n", m.baseLibsonnetPath))
+	buf.WriteString(fmt.Sprintf("local base = import \"%s\";\n", base))
 	buf.WriteString(fmt.Sprintf("local k = import \"%s\";\n\n", extensionsLibFilename))
 	buf.WriteString("base + {\n")
 	buf.WriteString("  // Insert user-specified overrides here. For example if a component is named \"nginx-deployment\", you might have something like:\n")
@@ -369,9 +893,253 @@ func (m *manager) generateOverrideData() []byte {
 	return buf.Bytes()
 }
 
-func generateSpecData(uri, namespace string) ([]byte, error) {
+func generateSpecData(uri, namespace, inherits, k8sVersion string) ([]byte, error) {
 	// Format the spec json and return; preface keys with 2 space idents.
-	return json.MarshalIndent(EnvironmentSpec{URI: uri, Namespace: namespace}, "", "  ")
+	return json.MarshalIndent(EnvironmentSpec{URI: uri, Namespace: namespace, KubernetesVersion: k8sVersion, Inherits: inherits}, "", "  ")
+}
+
+// overridePath returns the path of the `.jsonnet` file holding the overrides
+// of the environment `name`.
+func (m *manager) overridePath(name string) AbsPath {
+	return appendToAbsPath(m.environmentsPath, name, path.Base(name)+".jsonnet")
+}
+
+// EnvironmentChain returns the environment `name`, followed by the
+// environments it inherits from, nearest first. For example, if 'us-east/prod'
+// inherits from 'default', the chain of 'us-east/prod' is
+// ['us-east/prod', 'default']. It fails if an environment in the chain does
+// not exist, or if the chain has a cycle.
+func (m *manager) EnvironmentChain(name string) ([]*Environment, error) {
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*Environment{}
+	for _, env := range envs {
+		byName[env.Name] = env
+	}
+	if _, ok := byName[name]; !ok {
+		if env := aliasedEnvironment(envs, name); env != nil {
+			name = env.Name
+		}
+	}
+
+	chain := []*Environment{}
+	seen := map[string]bool{}
+	for curr := name; curr != ""; {
+		if seen[curr] {
+			return nil, fmt.Errorf("Environment '%s' inherits from itself", curr)
+		}
+		seen[curr] = true
+
+		env, ok := byName[curr]
+		if !ok {
+			return nil, m.environmentNotFound(curr)
+		}
+		chain = append(chain, env)
+		curr = env.Inherits
+	}
+
+	return chain, nil
+}
+
+// mergeEnvironmentSettings applies `changes` to a copy of the environment
+// setting `current` (e.g., its library pins), and returns the result. An empty
+// value in `changes` removes the key. Each change is logged using `setFormat`
+// (with the key and value) or `unsetFormat` (with the key).
+func mergeEnvironmentSettings(current, changes map[string]string, setFormat, unsetFormat string) map[string]string {
+	if len(changes) == 0 {
+		return current
+	}
+
+	merged := map[string]string{}
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range changes {
+		if v == "" {
+			log.Infof(unsetFormat, k)
+			delete(merged, k)
+			continue
+		}
+		log.Infof(setFormat, k, v)
+		merged[k] = v
+	}
+	return merged
+}
+
+// ComponentNamespaces returns the component namespace mappings of the
+// environment `name`, including those it inherits. Mappings of nearer
+// environments take precedence.
+func (m *manager) ComponentNamespaces(name string) (map[string]string, error) {
+	chain, err := m.EnvironmentChain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := map[string]string{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for component, namespace := range chain[i].ComponentNamespaces {
+			namespaces[component] = namespace
+		}
+	}
+	return namespaces, nil
+}
+
+// ComponentServers returns the component cluster mappings of the environment
+// `name`, including those it inherits. Mappings of nearer environments take
+// precedence.
+func (m *manager) ComponentServers(name string) (map[string]string, error) {
+	chain, err := m.EnvironmentChain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := map[string]string{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for component, server := range chain[i].ComponentServers {
+			servers[component] = server
+		}
+	}
+	return servers, nil
+}
+
+// JsonnetVars returns the external variables and top-level arguments of the
+// environment `name`, including those it inherits, as `<name>=<value>` pairs
+// in order of name. Values of nearer environments take precedence.
+func (m *manager) JsonnetVars(name string) ([]string, []string, error) {
+	chain, err := m.EnvironmentChain(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	extVars, tlaVars := map[string]string{}, map[string]string{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range chain[i].ExtVars {
+			extVars[k] = v
+		}
+		for k, v := range chain[i].TlaVars {
+			tlaVars[k] = v
+		}
+	}
+	return jsonnetVarPairs(extVars), jsonnetVarPairs(tlaVars), nil
+}
+
+// jsonnetVarPairs returns the `<name>=<value>` pairs of `vars`, in order of
+// name.
+func jsonnetVarPairs(vars map[string]string) []string {
+	pairs := []string{}
+	for k, v := range vars {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// LibraryPins returns the library pins of the environment `name`, including
+// those it inherits, with each directory made absolute. Pins of nearer
+// environments take precedence.
+func (m *manager) LibraryPins(name string) (map[string]string, error) {
+	chain, err := m.EnvironmentChain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pins := map[string]string{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for lib, dir := range chain[i].LibraryPins {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(string(m.rootPath), dir)
+			}
+			pins[lib] = dir
+		}
+	}
+	return pins, nil
+}
+
+// EnvironmentLibPaths returns the absolute Jsonnet library search paths of
+// the environment `name`, including those it inherits, in the order Jsonnet
+// should search them: the paths of nearer environments come later, so that
+// they take precedence.
+func (m *manager) EnvironmentLibPaths(name string) ([]string, error) {
+	chain, err := m.EnvironmentChain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, p := range chain[i].LibPaths {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(string(m.rootPath), p)
+			}
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// inheritingEnvironments returns the names of the environments that inherit
+// directly from the environment `name`.
+func (m *manager) inheritingEnvironments(name string) ([]string, error) {
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []string{}
+	for _, env := range envs {
+		if env.Inherits == name {
+			children = append(children, env.Name)
+		}
+	}
+	return children, nil
+}
+
+// reparentEnvironments points the environments that inherit from `oldName` at
+// `newName`, after the environment has been renamed.
+func (m *manager) reparentEnvironments(tx *transaction, oldName, newName string) error {
+	children, err := m.inheritingEnvironments(oldName)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		log.Infof("Updating environment '%s' to inherit from '%s'", child, newName)
+
+		env, err := m.GetEnvironment(child)
+		if err != nil {
+			return err
+		}
+		env.Inherits = newName
+		specData, err := json.MarshalIndent(environmentSpec(env), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := tx.writeFile(appendToAbsPath(m.environmentsPath, child, specFilename), specData); err != nil {
+			return err
+		}
+
+		overridePath := m.overridePath(child)
+		data, err := afero.ReadFile(m.appFS, string(overridePath))
+		if err != nil {
+			return err
+		}
+		updated := strings.Replace(string(data), string(m.overridePath(oldName)), string(m.overridePath(newName)), -1)
+		if err := tx.writeFile(overridePath, []byte(updated)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	return strings.Join(quoted, ", ")
 }
 
 func (m *manager) environmentExists(name string) (bool, error) {
@@ -16,9 +16,12 @@
 package metadata
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -44,7 +47,7 @@ func mockEnvironments(t *testing.T, appName string) *manager {
 	}
 
 	appPath := AbsPath(appName)
-	m, err := initManager(appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
+	m, err := initManager(context.Background(), appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
 	if err != nil {
 		t.Fatalf("Failed to init cluster spec: %v", err)
 	}
@@ -54,7 +57,7 @@ func mockEnvironments(t *testing.T, appName string) *manager {
 		envPath := appendToAbsPath(m.environmentsPath, env)
 
 		specPath := appendToAbsPath(envPath, mockSpecJSON)
-		specData, err := generateSpecData(mockSpecJSONURI, mockNamespace)
+		specData, err := generateSpecData(mockSpecJSONURI, mockNamespace, "", "")
 		if err != nil {
 			t.Fatalf("Expected to marshal:\nuri: %s\nnamespace: %s\n, but failed", mockSpecJSONURI, mockNamespace)
 		}
@@ -184,6 +187,116 @@ func TestSetEnvironment(t *testing.T) {
 	if envSpec.Namespace != set.Namespace {
 		t.Fatalf("Expected set Namespace to be \"%s\", got:\n  %s", set.Namespace, envSpec.Namespace)
 	}
+
+	// Test setting a cluster selector, and ensure the URI and namespace are
+	// preserved.
+	err = m.SetEnvironment(setName, &Environment{ClusterSelector: "tier=edge"})
+	if err != nil {
+		t.Fatalf("Could not set cluster selector of \"%s\", got:\n  %s", setName, err)
+	}
+
+	env, err := m.GetEnvironment(setName)
+	if err != nil {
+		t.Fatalf("Could not get environment \"%s\", got:\n  %s", setName, err)
+	}
+	if env.ClusterSelector != "tier=edge" || env.URI != set.URI || env.Namespace != set.Namespace {
+		t.Fatalf("Expected environment with URI \"%s\", namespace \"%s\" and cluster selector \"tier=edge\", got:\n  %#v", set.URI, set.Namespace, env)
+	}
+
+	// An environment cannot have both a cluster selector and a kubeconfig
+	// context.
+	if err := m.SetEnvironment(setName, &Environment{Context: "prod-admin"}); err == nil {
+		t.Fatalf("Expected setting a kubeconfig context of \"%s\", which has a cluster selector, to fail", setName)
+	}
+
+	// Test removing the cluster selector, and setting a kubeconfig context
+	// instead.
+	if err := m.ClearEnvironmentDestination(setName, false, true, false); err != nil {
+		t.Fatalf("Could not remove cluster selector of \"%s\", got:\n  %s", setName, err)
+	}
+	if err := m.SetEnvironment(setName, &Environment{Context: "prod-admin"}); err != nil {
+		t.Fatalf("Could not set kubeconfig context of \"%s\", got:\n  %s", setName, err)
+	}
+	env, err = m.GetEnvironment(setName)
+	if err != nil {
+		t.Fatalf("Could not get environment \"%s\", got:\n  %s", setName, err)
+	}
+	if env.Context != "prod-admin" || env.ClusterSelector != "" || env.URI != set.URI {
+		t.Fatalf("Expected environment with URI \"%s\", context \"prod-admin\" and no cluster selector, got:\n  %#v", set.URI, env)
+	}
+
+	// Test removing the namespace, so that the context's is used, and then
+	// the context.
+	if err := m.ClearEnvironmentDestination(setName, true, false, false); err != nil {
+		t.Fatalf("Could not remove namespace of \"%s\", got:\n  %s", setName, err)
+	}
+	env, err = m.GetEnvironment(setName)
+	if err != nil {
+		t.Fatalf("Could not get environment \"%s\", got:\n  %s", setName, err)
+	}
+	if env.Namespace != "" || env.Context != "prod-admin" {
+		t.Fatalf("Expected environment with context \"prod-admin\" and no namespace, got:\n  %#v", env)
+	}
+	if err := m.ClearEnvironmentDestination(setName, false, false, true); err != nil {
+		t.Fatalf("Could not remove kubeconfig context of \"%s\", got:\n  %s", setName, err)
+	}
+	env, err = m.GetEnvironment(setName)
+	if err != nil {
+		t.Fatalf("Could not get environment \"%s\", got:\n  %s", setName, err)
+	}
+	if env.Context != "" || env.URI != set.URI {
+		t.Fatalf("Expected environment with URI \"%s\" and no context, got:\n  %#v", set.URI, env)
+	}
+}
+
+func TestSetEnvironmentRename(t *testing.T) {
+	m := mockEnvironments(t, "test-set-env-rename")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	ctx := context.Background()
+	if err := m.CreateEnvironment(ctx, "prod", mockAPIServerURI, mockNamespace, "", spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+	if err := m.CreateEnvironment(ctx, "canary", mockAPIServerURI, mockNamespace, "prod", spec); err != nil {
+		t.Fatalf("Failed to create inheriting environment:\n%v", err)
+	}
+
+	// The overrides file is renamed along with the environment, and the
+	// environments inheriting from it import it under its new name.
+	if err := m.SetEnvironment("prod", &Environment{Name: "us-east/production"}); err != nil {
+		t.Fatalf("Failed to rename environment:\n%v", err)
+	}
+	testDirNotExists(t, string(appendToAbsPath(m.environmentsPath, "prod")))
+	testFileNotExists(t, testFS, string(appendToAbsPath(m.environmentsPath, "us-east/production", "prod.jsonnet")))
+	if _, err := testFS.Stat(string(m.overridePath("us-east/production"))); err != nil {
+		t.Fatalf("Expected overrides of renamed environment:\n%v", err)
+	}
+	data, err := afero.ReadFile(testFS, string(m.overridePath("canary")))
+	if err != nil {
+		t.Fatalf("Failed to read overrides:\n%v", err)
+	}
+	if !strings.Contains(string(data), string(m.overridePath("us-east/production"))) {
+		t.Errorf("Expected overrides of 'canary' to import the renamed overrides, got:\n%s", data)
+	}
+
+	// A rename that fails partway through leaves the environment where it
+	// was.
+	if err := testFS.Remove(string(m.overridePath("canary"))); err != nil {
+		t.Fatalf("Failed to remove overrides:\n%v", err)
+	}
+	if err := m.SetEnvironment("us-east/production", &Environment{Name: "prod"}); err == nil {
+		t.Fatal("Expected renaming to fail when an inheriting environment cannot be updated")
+	}
+	testDirNotExists(t, string(appendToAbsPath(m.environmentsPath, "prod")))
+	if _, err := m.GetEnvironment("us-east/production"); err != nil {
+		t.Fatalf("Expected environment to keep its name after a failed rename:\n%v", err)
+	}
+	if _, err := testFS.Stat(string(m.overridePath("us-east/production"))); err != nil {
+		t.Fatalf("Expected overrides to be restored after a failed rename:\n%v", err)
+	}
 }
 
 func TestGenerateOverrideData(t *testing.T) {
@@ -197,9 +310,584 @@ base + {
   //   "nginx-deployment"+: k.deployment.mixin.metadata.labels({foo: "bar"})
 }
 `
-	result := m.generateOverrideData()
+	result := m.generateOverrideData("")
 
 	if string(result) != expected {
 		t.Fatalf("Expected to generate override file with data:\n%s\n,got:\n%s", expected, result)
 	}
 }
+
+func TestCreateEnvironmentCancelled(t *testing.T) {
+	m := mockEnvironments(t, "test-create-env-cancelled")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	envName := "us-central/cancelled"
+	err = m.CreateEnvironment(ctx, envName, mockAPIServerURI, mockNamespace, "", spec)
+	if err == nil {
+		t.Fatalf("Expected creating environment '%s' with a cancelled context to fail", envName)
+	}
+
+	testDirNotExists(t, string(appendToAbsPath(m.environmentsPath, envName)))
+	testDirNotExists(t, string(appendToAbsPath(m.environmentsPath, "us-central")))
+}
+
+func TestPreviewEnvironment(t *testing.T) {
+	m := mockEnvironments(t, "test-preview-env")
+
+	envName := "us-central/preview"
+	files, err := m.PreviewEnvironment(envName, mockAPIServerURI, mockNamespace, "")
+	if err != nil {
+		t.Fatalf("Failed to preview environment '%s':\n%v", envName, err)
+	}
+
+	envPath := appendToAbsPath(m.environmentsPath, envName)
+	expected := []AbsPath{
+		appendToAbsPath(envPath, metadataDirName, schemaFilename),
+		appendToAbsPath(envPath, metadataDirName, k8sLibFilename),
+		appendToAbsPath(envPath, metadataDirName, extensionsLibFilename),
+		appendToAbsPath(envPath, "preview.jsonnet"),
+		appendToAbsPath(envPath, specFilename),
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %d files, got %d", len(expected), len(files))
+	}
+	for i, f := range files {
+		if f.Path != expected[i] {
+			t.Errorf("Expected file %d to be '%s', got '%s'", i, expected[i], f.Path)
+		}
+	}
+	if files[0].Data != nil || files[4].Data == nil {
+		t.Errorf("Expected only files not generated from the API specification to have data")
+	}
+
+	testDirNotExists(t, string(envPath))
+
+	if _, err := m.PreviewEnvironment(mockEnvName, mockAPIServerURI, mockNamespace, ""); err == nil {
+		t.Errorf("Expected previewing existing environment '%s' to fail", mockEnvName)
+	}
+}
+
+func TestSyncEnvironments(t *testing.T) {
+	m := mockEnvironments(t, "/syncEnvironments")
+
+	const registryPath = "/registry/environments"
+	writeRegistryEnv := func(name, uri string) {
+		envPath := appendToAbsPath(AbsPath(registryPath), name)
+		specData, err := generateSpecData(uri, mockNamespace, "", "")
+		if err != nil {
+			t.Fatalf("Failed to generate spec data:\n%v", err)
+		}
+		files := map[string][]byte{
+			specFilename:                                  specData,
+			metadataDirName + "/" + schemaFilename:        []byte("{}"),
+			metadataDirName + "/" + k8sLibFilename:        []byte(uri),
+			metadataDirName + "/" + extensionsLibFilename: []byte("{}"),
+		}
+		for file, data := range files {
+			if err := afero.WriteFile(testFS, string(appendToAbsPath(envPath, file)), data, os.ModePerm); err != nil {
+				t.Fatalf("Failed to write registry file '%s':\n%v", file, err)
+			}
+		}
+	}
+	writeRegistryEnv("shared/prod", "https://prod.example.com")
+	writeRegistryEnv(mockEnvName, "https://test.example.com")
+
+	// Customize an override file; syncing must not clobber it.
+	overridePath := string(appendToAbsPath(m.environmentsPath, mockEnvName, "test.jsonnet"))
+	if err := afero.WriteFile(testFS, overridePath, []byte("custom"), os.ModePerm); err != nil {
+		t.Fatalf("Failed to write override file:\n%v", err)
+	}
+
+	if err := m.syncEnvironments(testFS, registryPath); err != nil {
+		t.Fatalf("Failed to sync environments:\n%v", err)
+	}
+
+	for name, uri := range map[string]string{
+		"shared/prod":  "https://prod.example.com",
+		mockEnvName:    "https://test.example.com",
+		mockEnvName2:   mockSpecJSONURI,
+		defaultEnvName: mockSpecJSONURI,
+	} {
+		env, err := m.GetEnvironment(name)
+		if err != nil {
+			t.Fatalf("Expected environment '%s' to exist:\n%v", name, err)
+		} else if env.URI != uri {
+			t.Errorf("Expected environment '%s' to have URI '%s', got '%s'", name, uri, env.URI)
+		}
+	}
+
+	k8sLibPath := string(appendToAbsPath(m.environmentsPath, "shared/prod", metadataDirName, k8sLibFilename))
+	if data, err := afero.ReadFile(testFS, k8sLibPath); err != nil || string(data) != "https://prod.example.com" {
+		t.Errorf("Expected '%s' to be copied from registry, got '%s' (%v)", k8sLibPath, data, err)
+	}
+	newOverridePath := string(appendToAbsPath(m.environmentsPath, "shared/prod", "prod.jsonnet"))
+	if exists, _ := afero.Exists(testFS, newOverridePath); !exists {
+		t.Errorf("Expected override file '%s' to be generated", newOverridePath)
+	}
+	if data, _ := afero.ReadFile(testFS, overridePath); string(data) != "custom" {
+		t.Errorf("Expected override file '%s' to be preserved, got '%s'", overridePath, data)
+	}
+
+	// An incomplete registry environment fails the whole sync.
+	if err := testFS.Remove(registryPath + "/shared/prod/.metadata/" + k8sLibFilename); err != nil {
+		t.Fatalf("Failed to remove registry file:\n%v", err)
+	}
+	if err := m.syncEnvironments(testFS, registryPath); err == nil {
+		t.Errorf("Expected sync of incomplete registry to fail")
+	}
+}
+
+func TestEnvironmentInheritance(t *testing.T) {
+	m := mockEnvironments(t, "test-env-inheritance")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	ctx := context.Background()
+
+	chainNames := func(name string) []string {
+		chain, err := m.EnvironmentChain(name)
+		if err != nil {
+			t.Fatalf("Failed to resolve environment chain of '%s':\n%v", name, err)
+		}
+		names := []string{}
+		for _, env := range chain {
+			names = append(names, env.Name)
+		}
+		return names
+	}
+	importsOverrides := func(child, parent string) bool {
+		data, err := afero.ReadFile(testFS, string(m.overridePath(child)))
+		if err != nil {
+			t.Fatalf("Failed to read overrides of '%s':\n%v", child, err)
+		}
+		return strings.Contains(string(data), fmt.Sprintf("import \"%s\"", m.overridePath(parent)))
+	}
+
+	if err := m.CreateEnvironment(ctx, "us-east/prod", mockAPIServerURI, mockNamespace, defaultEnvName, spec); err != nil {
+		t.Fatalf("Failed to create inheriting environment:\n%v", err)
+	}
+	if err := m.CreateEnvironment(ctx, "us-east/canary", mockAPIServerURI, mockNamespace, "us-east/prod", spec); err != nil {
+		t.Fatalf("Failed to create inheriting environment:\n%v", err)
+	}
+
+	if !importsOverrides("us-east/canary", "us-east/prod") {
+		t.Errorf("Expected 'us-east/canary' to import the overrides of 'us-east/prod'")
+	}
+	expected := []string{"us-east/canary", "us-east/prod", defaultEnvName}
+	if names := chainNames("us-east/canary"); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected chain %v, got %v", expected, names)
+	}
+
+	if err := m.CreateEnvironment(ctx, "us-east/orphan", mockAPIServerURI, mockNamespace, "us-east/missing", spec); err == nil {
+		t.Errorf("Expected inheriting from a missing environment to fail")
+	}
+	testDirNotExists(t, string(appendToAbsPath(m.environmentsPath, "us-east/orphan")))
+
+	if err := m.DeleteEnvironment("us-east/prod"); err == nil || !strings.Contains(err.Error(), "us-east/canary") {
+		t.Errorf("Expected deleting an inherited environment to fail, got: %v", err)
+	}
+
+	// Renaming a parent updates the environments that inherit from it.
+	if err := m.SetEnvironment("us-east/prod", &Environment{Name: "us-east/live"}); err != nil {
+		t.Fatalf("Failed to rename environment:\n%v", err)
+	}
+	if !importsOverrides("us-east/canary", "us-east/live") {
+		t.Errorf("Expected 'us-east/canary' to import the overrides of the renamed parent")
+	}
+	expected = []string{"us-east/canary", "us-east/live", defaultEnvName}
+	if names := chainNames("us-east/canary"); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected chain %v, got %v", expected, names)
+	}
+
+	// Cycles (which can only be introduced by hand) are reported.
+	specData, err := generateSpecData(mockSpecJSONURI, mockNamespace, "us-east/canary", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultSpecPath := appendToAbsPath(m.environmentsPath, defaultEnvName, specFilename)
+	if err := afero.WriteFile(testFS, string(defaultSpecPath), specData, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.EnvironmentChain("us-east/canary"); err == nil {
+		t.Errorf("Expected a cycle of inheritance to be reported")
+	}
+}
+
+func TestCopyEnvironment(t *testing.T) {
+	m := mockEnvironments(t, "test-copy-env")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := m.CreateEnvironment(ctx, "eu/prod", mockAPIServerURI, "prod", defaultEnvName, spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+	if err := m.CreateEnvironment(ctx, "eu/prod/canary", mockAPIServerURI, "canary", "", spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+	paramsPath := appendToAbsPath(m.environmentsPath, "eu/prod", "params.libsonnet")
+	if err := afero.WriteFile(testFS, string(paramsPath), []byte("{replicas: 5}\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.CopyEnvironment("eu/prod", "eu/stage", "", "stage"); err != nil {
+		t.Fatalf("Failed to copy environment:\n%v", err)
+	}
+
+	env, err := m.GetEnvironment("eu/stage")
+	if err != nil {
+		t.Fatalf("Failed to get copied environment:\n%v", err)
+	}
+	if env.URI != mockAPIServerURI || env.Namespace != "stage" || env.Inherits != defaultEnvName {
+		t.Errorf("Expected the copy to keep the URI and parent, with namespace 'stage', got %#v", env)
+	}
+
+	for _, pair := range [][2]AbsPath{
+		{m.overridePath("eu/prod"), m.overridePath("eu/stage")},
+		{paramsPath, appendToAbsPath(m.environmentsPath, "eu/stage", "params.libsonnet")},
+		{
+			appendToAbsPath(m.environmentsPath, "eu/prod", metadataDirName, k8sLibFilename),
+			appendToAbsPath(m.environmentsPath, "eu/stage", metadataDirName, k8sLibFilename),
+		},
+	} {
+		expected, err := afero.ReadFile(testFS, string(pair[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := afero.ReadFile(testFS, string(pair[1]))
+		if err != nil {
+			t.Errorf("Expected '%s' to be copied to '%s':\n%v", pair[0], pair[1], err)
+		} else if string(actual) != string(expected) {
+			t.Errorf("Expected '%s' to have the contents of '%s'", pair[1], pair[0])
+		}
+	}
+
+	// Nested environments are not part of the copy.
+	testDirNotExists(t, string(appendToAbsPath(m.environmentsPath, "eu/stage/canary")))
+
+	if err := m.CopyEnvironment("eu/prod", "eu/stage", "", ""); err == nil {
+		t.Errorf("Expected copying over an existing environment to fail")
+	}
+	if err := m.CopyEnvironment("eu/prod", "eu/prod/copy", "", ""); err == nil {
+		t.Errorf("Expected copying an environment into itself to fail")
+	}
+	if err := m.CopyEnvironment("eu/missing", "eu/other", "", ""); err == nil {
+		t.Errorf("Expected copying a missing environment to fail")
+	}
+}
+
+func TestLibraryPins(t *testing.T) {
+	m := mockEnvironments(t, "test-library-pins")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	if err := m.CreateEnvironment(context.Background(), "eu/canary", mockAPIServerURI, mockNamespace, defaultEnvName, spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+
+	pin := func(env string, pins map[string]string) {
+		if err := m.SetEnvironment(env, &Environment{LibraryPins: pins}); err != nil {
+			t.Fatalf("Failed to pin libraries of '%s':\n%v", env, err)
+		}
+	}
+	pin(defaultEnvName, map[string]string{"mylib": "vendor/mylib@1.2", "otherlib": "/opt/otherlib"})
+	pin("eu/canary", map[string]string{"mylib": "vendor/mylib@1.3"})
+
+	pins, err := m.LibraryPins("eu/canary")
+	if err != nil {
+		t.Fatalf("Failed to get library pins:\n%v", err)
+	}
+	expected := map[string]string{
+		"mylib":    string(appendToAbsPath(m.rootPath, "vendor/mylib@1.3")),
+		"otherlib": "/opt/otherlib",
+	}
+	if !reflect.DeepEqual(pins, expected) {
+		t.Errorf("Expected pins %v, got %v", expected, pins)
+	}
+
+	// An empty directory removes a pin, leaving the others alone.
+	pin(defaultEnvName, map[string]string{"otherlib": ""})
+	env, err := m.GetEnvironment(defaultEnvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"mylib": "vendor/mylib@1.2"}; !reflect.DeepEqual(env.LibraryPins, expected) {
+		t.Errorf("Expected pins %v, got %v", expected, env.LibraryPins)
+	}
+}
+
+func TestEnvironmentLibPaths(t *testing.T) {
+	m := mockEnvironments(t, "test-env-lib-paths")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	if err := m.CreateEnvironment(context.Background(), "eu/canary", mockAPIServerURI, mockNamespace, defaultEnvName, spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+
+	if err := m.SetEnvironment(defaultEnvName, &Environment{LibPaths: []string{"shared/lib", "/opt/jsonnet"}}); err != nil {
+		t.Fatalf("Failed to set library paths:\n%v", err)
+	}
+	if err := m.SetEnvironment("eu/canary", &Environment{LibPaths: []string{"environments/eu/canary/lib"}}); err != nil {
+		t.Fatalf("Failed to set library paths:\n%v", err)
+	}
+
+	// Other changes keep the paths.
+	if err := m.SetEnvironment("eu/canary", &Environment{Namespace: "canary"}); err != nil {
+		t.Fatalf("Failed to set namespace:\n%v", err)
+	}
+
+	paths, err := m.EnvironmentLibPaths("eu/canary")
+	if err != nil {
+		t.Fatalf("Failed to get library paths:\n%v", err)
+	}
+	expected := []string{
+		string(appendToAbsPath(m.rootPath, "shared/lib")),
+		"/opt/jsonnet",
+		string(appendToAbsPath(m.rootPath, "environments/eu/canary/lib")),
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected library paths %v, got %v", expected, paths)
+	}
+
+	// Empty paths are dropped, so that the paths can be removed.
+	if err := m.SetEnvironment(defaultEnvName, &Environment{LibPaths: []string{""}}); err != nil {
+		t.Fatalf("Failed to remove library paths:\n%v", err)
+	}
+	env, err := m.GetEnvironment(defaultEnvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env.LibPaths) != 0 {
+		t.Errorf("Expected no library paths, got %v", env.LibPaths)
+	}
+}
+
+func TestComponentNamespaces(t *testing.T) {
+	m := mockEnvironments(t, "test-component-namespaces")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	if err := m.CreateEnvironment(context.Background(), "eu/canary", mockAPIServerURI, mockNamespace, defaultEnvName, spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+
+	set := func(env string, namespaces map[string]string) {
+		if err := m.SetEnvironment(env, &Environment{ComponentNamespaces: namespaces}); err != nil {
+			t.Fatalf("Failed to set component namespaces of '%s':\n%v", env, err)
+		}
+	}
+	set(defaultEnvName, map[string]string{"redis": "cache", "prometheus": "monitoring"})
+	set("eu/canary", map[string]string{"redis": "canary-cache"})
+
+	namespaces, err := m.ComponentNamespaces("eu/canary")
+	if err != nil {
+		t.Fatalf("Failed to get component namespaces:\n%v", err)
+	}
+	expected := map[string]string{"redis": "canary-cache", "prometheus": "monitoring"}
+	if !reflect.DeepEqual(namespaces, expected) {
+		t.Errorf("Expected component namespaces %v, got %v", expected, namespaces)
+	}
+
+	// An empty namespace removes a mapping, leaving the others alone.
+	set(defaultEnvName, map[string]string{"prometheus": ""})
+	env, err := m.GetEnvironment(defaultEnvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"redis": "cache"}; !reflect.DeepEqual(env.ComponentNamespaces, expected) {
+		t.Errorf("Expected component namespaces %v, got %v", expected, env.ComponentNamespaces)
+	}
+}
+
+func TestComponentServers(t *testing.T) {
+	m := mockEnvironments(t, "test-component-servers")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	if err := m.CreateEnvironment(context.Background(), "eu/canary", mockAPIServerURI, mockNamespace, defaultEnvName, spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+
+	set := func(env string, servers map[string]string) {
+		if err := m.SetEnvironment(env, &Environment{ComponentServers: servers}); err != nil {
+			t.Fatalf("Failed to set component servers of '%s':\n%v", env, err)
+		}
+	}
+	set(defaultEnvName, map[string]string{"prometheus": "https://ops.example.com"})
+	set("eu/canary", map[string]string{"fluentd": "https://ops-eu.example.com"})
+
+	servers, err := m.ComponentServers("eu/canary")
+	if err != nil {
+		t.Fatalf("Failed to get component servers:\n%v", err)
+	}
+	expected := map[string]string{"prometheus": "https://ops.example.com", "fluentd": "https://ops-eu.example.com"}
+	if !reflect.DeepEqual(servers, expected) {
+		t.Errorf("Expected component servers %v, got %v", expected, servers)
+	}
+
+	// Setting other fields leaves the mappings alone.
+	if err := m.SetEnvironment(defaultEnvName, &Environment{Namespace: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	set(defaultEnvName, map[string]string{"prometheus": ""})
+	env, err := m.GetEnvironment(defaultEnvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env.ComponentServers) != 0 {
+		t.Errorf("Expected no component servers, got %v", env.ComponentServers)
+	}
+}
+
+func TestSelectEnvironments(t *testing.T) {
+	m := mockEnvironments(t, "test-select-environments")
+
+	labels := map[string]map[string]string{
+		mockEnvName:  {"tier": "dev", "region": "us-west"},
+		mockEnvName2: {"tier": "prod", "region": "us-west"},
+		mockEnvName3: {"tier": "dev", "region": "us-east"},
+	}
+	for name, envLabels := range labels {
+		if err := m.SetEnvironment(name, &Environment{Labels: envLabels, Annotations: map[string]string{"owner": "team-a"}}); err != nil {
+			t.Fatalf("Failed to label environment '%s':\n%v", name, err)
+		}
+	}
+
+	// Removing a label keeps the others.
+	if err := m.SetEnvironment(mockEnvName3, &Environment{Labels: map[string]string{"region": ""}}); err != nil {
+		t.Fatalf("Failed to remove label:\n%v", err)
+	}
+	env, err := m.GetEnvironment(mockEnvName3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"tier": "dev"}; !reflect.DeepEqual(env.Labels, expected) {
+		t.Errorf("Expected labels %v, got %v", expected, env.Labels)
+	}
+	if expected := map[string]string{"owner": "team-a"}; !reflect.DeepEqual(env.Annotations, expected) {
+		t.Errorf("Expected annotations %v, got %v", expected, env.Annotations)
+	}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{"tier=prod", []string{mockEnvName2}},
+		{"tier=dev", []string{mockEnvName, mockEnvName3}},
+		{"tier=dev,region=us-west", []string{mockEnvName}},
+		{"!region", []string{defaultEnvName, mockEnvName3}},
+		{"", []string{defaultEnvName, mockEnvName, mockEnvName2, mockEnvName3}},
+	}
+	for _, test := range tests {
+		envs, err := m.SelectEnvironments(test.selector)
+		if err != nil {
+			t.Fatalf("Failed to select environments with '%s':\n%v", test.selector, err)
+		}
+		names := []string{}
+		for _, env := range envs {
+			names = append(names, env.Name)
+		}
+		sort.Strings(names)
+		sort.Strings(test.expected)
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Expected selector '%s' to select %v, got %v", test.selector, test.expected, names)
+		}
+	}
+
+	if _, err := m.SelectEnvironments("tier in (prod"); err == nil {
+		t.Errorf("Expected invalid selector to fail")
+	}
+}
+
+func TestMatchEnvironments(t *testing.T) {
+	m := mockEnvironments(t, "test-match-environments")
+
+	tests := []struct {
+		patterns []string
+		expected []string
+	}{
+		{[]string{"us-west/*"}, []string{mockEnvName2, mockEnvName}},
+		{[]string{"*/test"}, []string{mockEnvName3, mockEnvName}},
+		{[]string{defaultEnvName, "us-*/test", mockEnvName}, []string{defaultEnvName, mockEnvName3, mockEnvName}},
+		// '*' does not match '/'.
+		{[]string{"*"}, []string{defaultEnvName}},
+	}
+	for _, test := range tests {
+		names, err := m.MatchEnvironments(test.patterns)
+		if err != nil {
+			t.Errorf("Failed to match %v:\n%v", test.patterns, err)
+			continue
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Expected %v to match %v, got %v", test.patterns, test.expected, names)
+		}
+	}
+
+	for _, patterns := range [][]string{{"eu/*"}, {"missing"}, {"us-west/[*"}} {
+		if _, err := m.MatchEnvironments(patterns); err == nil {
+			t.Errorf("Expected %v to fail to match", patterns)
+		}
+	}
+}
+
+func TestJsonnetVars(t *testing.T) {
+	m := mockEnvironments(t, "test-jsonnet-vars")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+	if err := m.CreateEnvironment(context.Background(), "eu/canary", mockAPIServerURI, mockNamespace, defaultEnvName, spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+
+	if err := m.SetEnvironment(defaultEnvName, &Environment{
+		ExtVars: map[string]string{"region": "us-west-2", "cluster": "main"},
+		TlaVars: map[string]string{"replicas": "3"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetEnvironment("eu/canary", &Environment{ExtVars: map[string]string{"region": "eu-west-1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	extVars, tlaVars, err := m.JsonnetVars("eu/canary")
+	if err != nil {
+		t.Fatalf("Failed to get Jsonnet variables:\n%v", err)
+	}
+	if expected := []string{"cluster=main", "region=eu-west-1"}; !reflect.DeepEqual(extVars, expected) {
+		t.Errorf("Expected external variables %v, got %v", expected, extVars)
+	}
+	if expected := []string{"replicas=3"}; !reflect.DeepEqual(tlaVars, expected) {
+		t.Errorf("Expected top-level arguments %v, got %v", expected, tlaVars)
+	}
+
+	extVars, _, err = m.JsonnetVars(mockEnvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extVars) != 0 {
+		t.Errorf("Expected no external variables, got %v", extVars)
+	}
+}
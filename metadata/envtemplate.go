@@ -0,0 +1,105 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+const (
+	envTemplatesDir      = ".templates"
+	overrideTemplateFile = "override.jsonnet"
+)
+
+// overrideTemplateData is what templates of environment `.jsonnet` files are
+// executed with.
+type overrideTemplateData struct {
+	// Name is the name of the new environment, e.g., `us-west/prod`.
+	Name string
+	// Inherits is the name of the environment it inherits from, if any.
+	Inherits string
+	// Base is the path of the file whose overrides the new environment's are
+	// applied on top of: `base.libsonnet`, or the `.jsonnet` file of the
+	// environment it inherits from.
+	Base string
+}
+
+// overrideTemplatePath returns the path of the template the `.jsonnet` files
+// of new environments are generated from: the `overrideTemplate` of the
+// `environmentDefaults` in `app.yaml` if set, or else
+// `environments/.templates/override.jsonnet` if it exists. It returns an empty
+// path if there is no template.
+func (m *manager) overrideTemplatePath() (AbsPath, error) {
+	appSpec, err := m.AppSpec()
+	if err != nil {
+		return "", err
+	}
+	if defaults := appSpec.EnvironmentDefaults; defaults != nil && defaults.OverrideTemplate != "" {
+		p := defaults.OverrideTemplate
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(string(m.rootPath), p)
+		}
+		return AbsPath(p), nil
+	}
+
+	p := appendToAbsPath(m.environmentsPath, envTemplatesDir, overrideTemplateFile)
+	exists, err := afero.Exists(m.appFS, string(p))
+	if err != nil || !exists {
+		return "", err
+	}
+	return p, nil
+}
+
+// overrideData generates the `.jsonnet` file of the new environment `name`
+// from the application's template, if it has one (see
+// `overrideTemplatePath`), so that org-wide conventions (e.g., extra imports,
+// or standard mixins) are followed by every environment. Otherwise, the file
+// is generated by `generateOverrideData`.
+func (m *manager) overrideData(name, inherits string) ([]byte, error) {
+	templatePath, err := m.overrideTemplatePath()
+	if err != nil {
+		return nil, err
+	} else if templatePath == "" {
+		return m.generateOverrideData(inherits), nil
+	}
+
+	text, err := afero.ReadFile(m.appFS, string(templatePath))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read environment template '%s':\n%v", templatePath, err)
+	}
+	tmpl, err := template.New(filepath.Base(string(templatePath))).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse environment template '%s':\n%v", templatePath, err)
+	}
+
+	data := overrideTemplateData{Name: name, Inherits: inherits, Base: string(m.baseLibsonnetPath)}
+	if inherits != "" {
+		data.Base = string(m.overridePath(inherits))
+	}
+
+	log.Debugf("Generating the overrides of environment '%s' from template '%s'", name, templatePath)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("Failed to execute environment template '%s':\n%v", templatePath, err)
+	}
+	return buf.Bytes(), nil
+}
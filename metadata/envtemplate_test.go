@@ -0,0 +1,76 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestOverrideTemplate(t *testing.T) {
+	m := mockEnvironments(t, "test-override-template")
+
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+
+	template := `local base = import "{{.Base}}";
+local mixins = import "mixins.libsonnet";
+
+base + mixins.standard("{{.Name}}", "{{.Inherits}}")
+`
+	templatePath := appendToAbsPath(m.environmentsPath, envTemplatesDir, overrideTemplateFile)
+	if err := afero.WriteFile(testFS, string(templatePath), []byte(template), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write template:\n%v", err)
+	}
+
+	if err := m.CreateEnvironment(context.Background(), "us-west/canary", mockAPIServerURI, mockNamespace, mockEnvName2, spec); err != nil {
+		t.Fatalf("Failed to create environment:\n%v", err)
+	}
+	data, err := afero.ReadFile(testFS, string(m.overridePath("us-west/canary")))
+	if err != nil {
+		t.Fatalf("Failed to read overrides:\n%v", err)
+	}
+	expected := `local base = import "test-override-template/environments/us-west/prod/prod.jsonnet";
+local mixins = import "mixins.libsonnet";
+
+base + mixins.standard("us-west/canary", "us-west/prod")
+`
+	if string(data) != expected {
+		t.Errorf("Expected overrides:\n%s\ngot:\n%s", expected, data)
+	}
+
+	// The template directory is not an environment.
+	if _, err := m.GetEnvironment(envTemplatesDir); err == nil {
+		t.Errorf("Expected '%s' not to be an environment", envTemplatesDir)
+	}
+
+	// A template configured in app.yaml takes precedence.
+	appYAML := "environmentDefaults:\n  overrideTemplate: templates/env.jsonnet\n"
+	if err := afero.WriteFile(testFS, string(m.appYAMLPath), []byte(appYAML), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+	if err := afero.WriteFile(testFS, string(appendToAbsPath(m.rootPath, "templates", "env.jsonnet")), []byte("{{.Undefined}}"), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write template:\n%v", err)
+	}
+	if _, err := m.PreviewEnvironment("us-east/canary", mockAPIServerURI, mockNamespace, ""); err == nil {
+		t.Errorf("Expected a template referring to an undefined field to fail")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"sort"
+	"strings"
+)
+
+// EnvironmentNode is a node in the hierarchy formed by environment names,
+// e.g., the environments 'us-west/dev' and 'us-west/prod' are the children
+// of a node 'us-west'. A node may be an environment, a group of environments,
+// or both (e.g., when both 'us-west' and 'us-west/dev' are environments).
+type EnvironmentNode struct {
+	// Name is the last component of the node's path, e.g., 'dev'. It is
+	// empty for the root of the tree.
+	Name string
+	// Path is the full path of the node, e.g., 'us-west/dev'.
+	Path string
+	// Environment is the environment at this node, or nil if the node only
+	// groups other environments.
+	Environment *Environment
+	// Children are the nodes below this one, sorted by name.
+	Children []*EnvironmentNode
+}
+
+// NewEnvironmentTree arranges `envs` into a tree by their names, and returns
+// its (unnamed) root.
+func NewEnvironmentTree(envs []*Environment) *EnvironmentNode {
+	root := &EnvironmentNode{}
+	for _, env := range envs {
+		node := root
+		for _, name := range strings.Split(env.Name, "/") {
+			node = node.child(name)
+		}
+		node.Environment = env
+	}
+	root.sort()
+	return root
+}
+
+// EnvironmentTree returns the application's environments, arranged into a
+// tree by their names.
+func (m *manager) EnvironmentTree() (*EnvironmentNode, error) {
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	return NewEnvironmentTree(envs), nil
+}
+
+// Walk calls `f` for every node below `n`, parents before their children, with
+// the depth of the node (1 for the children of `n`). It stops at the first
+// error `f` returns.
+func (n *EnvironmentNode) Walk(f func(node *EnvironmentNode, depth int) error) error {
+	return n.walk(f, 1)
+}
+
+func (n *EnvironmentNode) walk(f func(node *EnvironmentNode, depth int) error, depth int) error {
+	for _, child := range n.Children {
+		if err := f(child, depth); err != nil {
+			return err
+		}
+		if err := child.walk(f, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// child returns the child of `n` called `name`, creating it if necessary.
+func (n *EnvironmentNode) child(name string) *EnvironmentNode {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	p := name
+	if n.Path != "" {
+		p = n.Path + "/" + name
+	}
+	c := &EnvironmentNode{Name: name, Path: p}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+func (n *EnvironmentNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
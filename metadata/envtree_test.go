@@ -0,0 +1,55 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNewEnvironmentTree(t *testing.T) {
+	envs := []*Environment{
+		{Name: "us-west/prod"},
+		{Name: "default"},
+		{Name: "us-west"},
+		{Name: "us-west/dev"},
+		{Name: "eu/central/staging"},
+	}
+	tree := NewEnvironmentTree(envs)
+
+	visited := []string{}
+	err := tree.Walk(func(node *EnvironmentNode, depth int) error {
+		visited = append(visited, fmt.Sprintf("%d %s %v", depth, node.Path, node.Environment != nil))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"1 default true",
+		"1 eu false",
+		"2 eu/central false",
+		"3 eu/central/staging true",
+		"1 us-west true",
+		"2 us-west/dev true",
+		"2 us-west/prod true",
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Expected tree:\n%v\ngot:\n%v", expected, visited)
+	}
+}
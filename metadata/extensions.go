@@ -0,0 +1,88 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// extensionPrefix starts the names of the fields of `app.yaml`, at the top
+// level or in the entry of a component, that belong to other tools (e.g.,
+// `x-argo`, or `x-costcenter`). ks does not interpret them, but keeps their
+// values as they are, so that tools can record their own metadata next to the
+// application's without a newer ks rejecting it.
+const extensionPrefix = "x-"
+
+// Extensions maps the names of extension fields (see `extensionPrefix`) to
+// their values, as JSON.
+type Extensions map[string]json.RawMessage
+
+// isExtension returns true if `name` is the name of an extension field.
+func isExtension(name string) bool {
+	return strings.HasPrefix(name, extensionPrefix)
+}
+
+// extensions returns the extension fields of `fields`, or nil if there are
+// none.
+func extensions(fields map[string]json.RawMessage) Extensions {
+	var exts Extensions
+	for name, value := range fields {
+		if !isExtension(name) {
+			continue
+		}
+		if exts == nil {
+			exts = Extensions{}
+		}
+		exts[name] = value
+	}
+	return exts
+}
+
+// componentSpecFields is `ComponentSpec` without its methods, so that they
+// can use the default encoding of its other fields.
+type componentSpecFields ComponentSpec
+
+// UnmarshalJSON decodes the entry of a component in `app.yaml`, keeping its
+// extension fields in `Extensions`.
+func (cs *ComponentSpec) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*componentSpecFields)(cs)); err != nil {
+		return err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	cs.Extensions = extensions(fields)
+	return nil
+}
+
+// MarshalJSON encodes `cs` with its extension fields, as it appears in
+// `app.yaml`.
+func (cs ComponentSpec) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(componentSpecFields(cs))
+	if err != nil || len(cs.Extensions) == 0 {
+		return data, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range cs.Extensions {
+		fields[name] = value
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExtensions(t *testing.T) {
+	appYAML := `x-costcenter: "4711"
+components:
+  redis:
+    labels:
+      tier: backend
+    x-argo:
+      syncWave: 2
+      hooks: [PreSync]
+`
+	spec, err := parseAppSpec([]byte(appYAML))
+	if err != nil {
+		t.Fatalf("Failed to parse app.yaml:\n%v", err)
+	}
+
+	if value := string(spec.Extensions["x-costcenter"]); value != `"4711"` {
+		t.Errorf("Expected top-level extension 'x-costcenter' to be '\"4711\"', got '%s'", value)
+	}
+	redis := spec.Components["redis"]
+	if redis.Labels["tier"] != "backend" {
+		t.Errorf("Expected component labels to be parsed, got %v", redis.Labels)
+	}
+	if value := string(redis.Extensions["x-argo"]); value != `{"hooks":["PreSync"],"syncWave":2}` {
+		t.Errorf("Expected component extension 'x-argo' to be kept verbatim, got '%s'", value)
+	}
+
+	// Extensions survive encoding the component's entry again.
+	data, err := json.Marshal(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"labels":{"tier":"backend"},"x-argo":{"hooks":["PreSync"],"syncWave":2}}`
+	if string(data) != expected {
+		t.Errorf("Expected component to encode as '%s', got '%s'", expected, data)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// HookPreApply hooks run before an environment is applied, e.g., to run
+	// schema migrations.
+	HookPreApply = "preApply"
+	// HookPostApply hooks run after an environment is applied, e.g., to run
+	// smoke tests.
+	HookPostApply = "postApply"
+	// HookPreDelete hooks run before the objects of an environment are
+	// deleted, e.g., to take a backup.
+	HookPreDelete = "preDelete"
+)
+
+// EnvironmentHooks are the lifecycle hooks of an environment, declared in its
+// `spec.json`, e.g.:
+//
+//	"hooks": {
+//	  "preApply": [
+//	    {"name": "migrate", "job": "hooks/migrate.jsonnet", "timeout": "15m"}
+//	  ],
+//	  "postApply": [
+//	    {"name": "smoke-test", "command": ["./scripts/smoke-test.sh"]}
+//	  ]
+//	}
+//
+// The hooks of each phase run in order, and the first that fails stops the
+// command. Hooks are not inherited.
+type EnvironmentHooks struct {
+	PreApply  []*Hook `json:"preApply,omitempty"`
+	PostApply []*Hook `json:"postApply,omitempty"`
+	PreDelete []*Hook `json:"preDelete,omitempty"`
+}
+
+// Phase returns the hooks of the phase `phase`, one of the `Hook*`
+// constants. It is safe to call on nil hooks.
+func (h *EnvironmentHooks) Phase(phase string) []*Hook {
+	if h == nil {
+		return nil
+	}
+	switch phase {
+	case HookPreApply:
+		return h.PreApply
+	case HookPostApply:
+		return h.PostApply
+	case HookPreDelete:
+		return h.PreDelete
+	}
+	return nil
+}
+
+// Hook is a single lifecycle hook. It sets exactly one of `Command` and
+// `Job`.
+type Hook struct {
+	Name string `json:"name,omitempty"`
+	// Command is run on the local machine, from the application root. The
+	// environment variables `KS_ENV` and `KS_HOOK` hold the names of the
+	// environment and of the phase.
+	Command []string `json:"command,omitempty"`
+	// Job is a file (relative to the application root) that is expanded like
+	// the files given to `ks apply <env> -f`. The objects it describes are
+	// recreated in the environment's cluster, and the hook succeeds once
+	// every Job among them completes.
+	Job string `json:"job,omitempty"`
+	// Timeout bounds how long the hook may run, e.g., "10m". Job hooks
+	// default to `DefaultHookTimeout`; commands are not bounded by default.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// DefaultHookTimeout is how long a Job hook may run if it sets no timeout.
+const DefaultHookTimeout = 10 * time.Minute
+
+// Describe returns the name of the hook, or a description of it if it has
+// none.
+func (h *Hook) Describe() string {
+	switch {
+	case h.Name != "":
+		return h.Name
+	case h.Job != "":
+		return h.Job
+	case len(h.Command) > 0:
+		return h.Command[0]
+	}
+	return "unnamed"
+}
+
+// TimeoutDuration returns the hook's timeout, or zero if it has none.
+func (h *Hook) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(h.Timeout)
+	return d
+}
+
+// Validate returns an error if the hook is malformed.
+func (h *Hook) Validate() error {
+	switch {
+	case len(h.Command) > 0 && h.Job != "":
+		return fmt.Errorf("Hook '%s' sets both a command and a job", h.Describe())
+	case len(h.Command) == 0 && h.Job == "":
+		return fmt.Errorf("Hook '%s' sets neither a command nor a job", h.Describe())
+	}
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("Hook '%s' has invalid timeout '%s'", h.Describe(), h.Timeout)
+		}
+	}
+	return nil
+}
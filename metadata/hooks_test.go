@@ -0,0 +1,57 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+)
+
+func TestHookValidate(t *testing.T) {
+	tests := []struct {
+		hook     *Hook
+		expected string
+	}{
+		{&Hook{Name: "migrate", Job: "hooks/migrate.jsonnet", Timeout: "15m"}, ""},
+		{&Hook{Command: []string{"./smoke-test.sh"}}, ""},
+		{&Hook{Name: "both", Command: []string{"true"}, Job: "job.yaml"}, "Hook 'both' sets both a command and a job"},
+		{&Hook{Name: "neither"}, "Hook 'neither' sets neither a command nor a job"},
+		{&Hook{Job: "job.yaml", Timeout: "soon"}, "Hook 'job.yaml' has invalid timeout 'soon'"},
+	}
+	for _, test := range tests {
+		err := test.hook.Validate()
+		if test.expected == "" && err != nil {
+			t.Errorf("Expected hook '%s' to be valid, got %v", test.hook.Describe(), err)
+		} else if test.expected != "" && (err == nil || err.Error() != test.expected) {
+			t.Errorf("Expected error '%s', got %v", test.expected, err)
+		}
+	}
+}
+
+func TestEnvironmentHooksPhase(t *testing.T) {
+	var none *EnvironmentHooks
+	if hooks := none.Phase(HookPreApply); hooks != nil {
+		t.Errorf("Expected no hooks, got %v", hooks)
+	}
+
+	migrate := &Hook{Name: "migrate", Job: "migrate.yaml"}
+	hooks := &EnvironmentHooks{PreApply: []*Hook{migrate}}
+	if got := hooks.Phase(HookPreApply); len(got) != 1 || got[0] != migrate {
+		t.Errorf("Expected the preApply hook, got %v", got)
+	}
+	if got := hooks.Phase(HookPostApply); len(got) != 0 {
+		t.Errorf("Expected no postApply hooks, got %v", got)
+	}
+}
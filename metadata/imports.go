@@ -0,0 +1,195 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// importRef matches the `import` and `importstr` expressions of a Jsonnet
+// program. Imports inside comments and strings match too, which only makes
+// the import graph larger than it need be.
+var importRef = regexp.MustCompile(`\bimport(?:str)?\s*(?:"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)')`)
+
+// importGraph finds the files a Jsonnet file imports, directly or not, by
+// resolving each import the way Jsonnet may: relative to the importing file,
+// in each of the library search paths `jpath`, or in the directory a library
+// is pinned to (see `LibraryPins`).
+type importGraph struct {
+	fs    afero.Fs
+	jpath []string
+	pins  map[string]string
+
+	imports map[string][]string
+}
+
+func newImportGraph(fs afero.Fs, jpath []string, pins map[string]string) *importGraph {
+	return &importGraph{fs: fs, jpath: jpath, pins: pins, imports: map[string][]string{}}
+}
+
+// closure returns the set of files `path` imports, directly or not, including
+// `path` itself.
+func (g *importGraph) closure(path string) (map[string]bool, error) {
+	seen := map[string]bool{}
+	queue := []string{filepath.Clean(path)}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+
+		imports, err := g.directImports(p)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, imports...)
+	}
+	return seen, nil
+}
+
+// directImports returns the existing files that the imports of `path` may
+// resolve to.
+func (g *importGraph) directImports(path string) ([]string, error) {
+	if imports, ok := g.imports[path]; ok {
+		return imports, nil
+	}
+
+	data, err := afero.ReadFile(g.fs, path)
+	if os.IsNotExist(err) {
+		// Rendering reports the missing file, if it matters.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	imports := []string{}
+	for _, match := range importRef.FindAllStringSubmatch(string(data), -1) {
+		ref := match[1] + match[2]
+		for _, candidate := range g.candidates(filepath.Dir(path), ref) {
+			if info, err := g.fs.Stat(candidate); err == nil && !info.IsDir() {
+				imports = append(imports, filepath.Clean(candidate))
+			}
+		}
+	}
+	g.imports[path] = imports
+	return imports, nil
+}
+
+// candidates returns the paths the import `ref` in a file in `dir` may
+// resolve to.
+func (g *importGraph) candidates(dir, ref string) []string {
+	if filepath.IsAbs(ref) {
+		return []string{ref}
+	}
+
+	candidates := []string{filepath.Join(dir, ref)}
+	for _, p := range g.jpath {
+		candidates = append(candidates, filepath.Join(p, ref))
+	}
+	parts := strings.SplitN(ref, "/", 2)
+	if pinned, ok := g.pins[parts[0]]; ok && len(parts) == 2 {
+		candidates = append(candidates, filepath.Join(pinned, parts[1]))
+	}
+	return candidates
+}
+
+// ComponentsChangedSince returns those of the components `componentPaths` of
+// the environment `envName` whose rendering may have changed since the git
+// revision `ref`: the components that were changed themselves, or that import
+// (directly or not, through the library search paths `jpath`) a file that was
+// changed. If `app.yaml` or the files of the environment (or of an
+// environment it inherits from) were changed, every component may have
+// changed.
+func (m *manager) ComponentsChangedSince(envName, ref string, componentPaths AbsPaths, jpath []string) (AbsPaths, error) {
+	rel, err := gitChanges(string(m.rootPath), ref)
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]bool{}
+	for _, p := range rel {
+		changed[filepath.Join(string(m.rootPath), p)] = true
+	}
+	if len(changed) == 0 {
+		log.Infof("Nothing has changed since '%s'", ref)
+		return AbsPaths{}, nil
+	}
+
+	chain, err := m.EnvironmentChain(envName)
+	if err != nil {
+		return nil, err
+	}
+	global := []string{string(m.appYAMLPath), string(m.baseLibsonnetPath)}
+	for p := range changed {
+		for _, g := range global {
+			if p == g {
+				log.Infof("'%s' has changed since '%s'; every component is affected", g, ref)
+				return componentPaths, nil
+			}
+		}
+		for _, env := range chain {
+			envPath := string(appendToAbsPath(m.environmentsPath, env.Name))
+			if strings.HasPrefix(p, envPath+"/") {
+				log.Infof("Environment '%s' has changed since '%s'; every component is affected", env.Name, ref)
+				return componentPaths, nil
+			}
+		}
+	}
+
+	pins, err := m.LibraryPins(envName)
+	if err != nil {
+		return nil, err
+	}
+	graph := newImportGraph(m.appFS, jpath, pins)
+
+	// The environment's overrides (and whatever they import) apply to every
+	// component.
+	_, _, overridesPath := m.LibPaths(envName)
+	imported, err := graph.closure(string(overridesPath))
+	if err != nil {
+		return nil, err
+	}
+	for p := range imported {
+		if changed[p] {
+			log.Infof("'%s', which the overrides of environment '%s' import, has changed since '%s'; every component is affected", p, envName, ref)
+			return componentPaths, nil
+		}
+	}
+
+	affected := AbsPaths{}
+	for _, componentPath := range componentPaths {
+		imported, err := graph.closure(componentPath)
+		if err != nil {
+			return nil, err
+		}
+		for p := range imported {
+			if changed[p] {
+				log.Debugf("Component '%s' is affected by the change to '%s'", componentPath, p)
+				affected = append(affected, componentPath)
+				break
+			}
+		}
+	}
+	log.Infof("%d of %d components are affected by the changes since '%s'", len(affected), len(componentPaths), ref)
+	return affected, nil
+}
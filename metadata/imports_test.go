@@ -0,0 +1,93 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestComponentsChangedSince(t *testing.T) {
+	root := "/test-components-changed-since"
+	m := mockEnvironments(t, root)
+
+	write := func(path, data string) {
+		if err := afero.WriteFile(testFS, root+"/"+path, []byte(data), defaultFilePermissions); err != nil {
+			t.Fatalf("Failed to write '%s':\n%v", path, err)
+		}
+	}
+	write("components/web.jsonnet", `local util = import "util.libsonnet"; util.service("web")`)
+	write("components/db.jsonnet", `local params = import 'params.libsonnet'; params.db`)
+	write("components/params.libsonnet", `{ db: importstr "db.conf" }`)
+	write("components/db.conf", "")
+	write("components/cache.yaml", "kind: Service")
+	write("lib/util.libsonnet", "{}")
+	write("vendor/mylib/mixins.libsonnet", "{}")
+
+	components := AbsPaths{root + "/components/cache.yaml", root + "/components/db.jsonnet", root + "/components/web.jsonnet"}
+	jpath := []string{root + "/lib", root + "/vendor"}
+
+	savedGitChanges := gitChanges
+	defer func() { gitChanges = savedGitChanges }()
+
+	for _, tc := range []struct {
+		changed  []string
+		expected AbsPaths
+	}{
+		{[]string{}, AbsPaths{}},
+		{[]string{"README.md"}, AbsPaths{}},
+		{[]string{"components/cache.yaml"}, AbsPaths{root + "/components/cache.yaml"}},
+		{[]string{"lib/util.libsonnet"}, AbsPaths{root + "/components/web.jsonnet"}},
+		// Imported through 'params.libsonnet'.
+		{[]string{"components/db.conf"}, AbsPaths{root + "/components/db.jsonnet"}},
+		{[]string{"vendor/mylib/mixins.libsonnet"}, AbsPaths{}},
+		{[]string{"app.yaml"}, components},
+		{[]string{"environments/base.libsonnet"}, components},
+		{[]string{"environments/" + mockEnvName + "/spec.json"}, components},
+		// Other environments do not affect this one.
+		{[]string{"environments/" + mockEnvName2 + "/spec.json"}, AbsPaths{}},
+	} {
+		changed := tc.changed
+		gitChanges = func(dir, ref string) ([]string, error) {
+			return changed, nil
+		}
+		affected, err := m.ComponentsChangedSince(mockEnvName, "origin/master", components, jpath)
+		if err != nil {
+			t.Fatalf("Failed to find components affected by %v:\n%v", tc.changed, err)
+		}
+		if !reflect.DeepEqual(affected, tc.expected) {
+			t.Errorf("Expected %v to affect %v, got %v", tc.changed, tc.expected, affected)
+		}
+	}
+
+	// The environment's overrides apply to every component.
+	_, _, overridesPath := m.LibPaths(mockEnvName)
+	if err := afero.WriteFile(testFS, string(overridesPath), []byte(`import "mylib/mixins.libsonnet"`), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write overrides:\n%v", err)
+	}
+	gitChanges = func(dir, ref string) ([]string, error) {
+		return []string{"vendor/mylib/mixins.libsonnet"}, nil
+	}
+	affected, err := m.ComponentsChangedSince(mockEnvName, "origin/master", components, jpath)
+	if err != nil {
+		t.Fatalf("Failed to find affected components:\n%v", err)
+	}
+	if !reflect.DeepEqual(affected, components) {
+		t.Errorf("Expected a change imported by the overrides to affect %v, got %v", components, affected)
+	}
+}
@@ -16,12 +16,15 @@
 package metadata
 
 import (
+	"context"
 	"os"
 	"regexp"
 	"strings"
 
 	"github.com/ksonnet/ksonnet/prototype"
+	"github.com/ksonnet/ksonnet/template"
 	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 var appFS afero.Fs
@@ -42,13 +45,63 @@ type AbsPaths []string
 type Manager interface {
 	Root() AbsPath
 	ComponentPaths() (AbsPaths, error)
+	SelectComponents(selector string) (AbsPaths, error)
 	CreateComponent(name string, text string, templateType prototype.TemplateType) error
+	CopyComponent(srcName, dstName string) error
+	ComponentPieces(name string) (*ComponentPieces, error)
+	SplitComponent(name, shared string, parts map[string]string) error
+	RenderComponentSource(envName, component, source string) ([]*unstructured.Unstructured, error)
+	RenderComponent(envName, component, labelSelector string) ([]*unstructured.Unstructured, error)
+	Expander(envName string, flags template.Expander, capabilities *Capabilities) (*template.Expander, error)
+	CheckBudgets(envName string, objs []*unstructured.Unstructured) error
 	LibPaths(envName string) (libPath, envLibPath, envComponentPath AbsPath)
-	CreateEnvironment(name, uri, namespace string, spec ClusterSpec) error
+	Capabilities(envName string) (*Capabilities, error)
+	CreateEnvironment(ctx context.Context, name, uri, namespace, inherits string, spec ClusterSpec) error
+	PreviewEnvironment(name, uri, namespace, inherits string) ([]*EnvironmentFile, error)
 	DeleteEnvironment(name string) error
+	ArchiveEnvironment(name string) error
+	RestoreEnvironment(name string) error
+	ArchivedEnvironments() ([]string, error)
 	GetEnvironments() ([]*Environment, error)
+	EnvironmentTree() (*EnvironmentNode, error)
 	GetEnvironment(name string) (*Environment, error)
+	EnvironmentChain(name string) ([]*Environment, error)
+	LibraryPins(name string) (map[string]string, error)
+	EnvironmentLibPaths(name string) ([]string, error)
+	ComponentNamespaces(name string) (map[string]string, error)
+	ComponentServers(name string) (map[string]string, error)
+	JsonnetVars(name string) ([]string, []string, error)
 	SetEnvironment(name string, desired *Environment) error
+	UpdateEnvironmentKubernetesVersion(ctx context.Context, name string, spec ClusterSpec) error
+	CopyEnvironment(srcName, dstName, uri, namespace string) error
+	SetEnvironmentTargets(name string, targets []string) error
+	SetEnvironmentAliases(name string, aliases []string) error
+	SetEnvironmentProtected(name string, protected bool) error
+	ClearEnvironmentDestination(name string, namespace, clusterSelector, kubeContext bool) error
+	SelectEnvironments(selector string) ([]*Environment, error)
+	MatchEnvironments(patterns []string) ([]string, error)
+	ExpandDestination(env *Environment) (uri, namespace string, err error)
+	EnvironmentCredentials(name string) (*CredentialSpec, error)
+	EnvironmentDefaults(name string) (*EnvironmentDefaultsSpec, error)
+	EnvironmentComponentPaths(name, selector string) (AbsPaths, error)
+	ComponentsChangedSince(envName, ref string, componentPaths AbsPaths, jpath []string) (AbsPaths, error)
+	SyncEnvironments(ctx context.Context) error
+	CopyAppAtRevision(dst AbsPath, ref string, paths []AbsPath) error
+	AppSpec() (*AppSpec, error)
+	CheckVersion(ksVersion string) error
+	SharedLibPaths() ([]string, error)
+	ComponentMixins() (map[string][]string, error)
+	PluginsPath() (string, error)
+	Pipeline() (*PipelineSpec, error)
+	SaveSnapshot(snapshot *Snapshot) error
+	GetSnapshots(envName string) ([]*Snapshot, error)
+	GetSnapshot(envName, id string) (*Snapshot, error)
+	WriteChecksums() error
+	VerifyChecksums() error
+	SelectClusters(selector string) ([]*Cluster, error)
+	Status(ksVersion string) ([]*StatusProblem, error)
+	Introspect() (*AppModel, error)
+	CRDPaths() (AbsPaths, error)
 	//
 	// TODO: Fill in methods as we need them.
 	//
@@ -65,11 +118,24 @@ func Find(path AbsPath) (Manager, error) {
 	return findManager(path, afero.NewOsFs())
 }
 
+// FindFs is like `Find`, but searches `fs` rather than the OS filesystem. This
+// is mostly useful for applications held in memory (see package `apptest`).
+func FindFs(path AbsPath, fs afero.Fs) (Manager, error) {
+	return findManager(path, fs)
+}
+
 // Init will retrieve a cluster API specification, generate a
 // capabilities-compliant version of ksonnet-lib, and then generate the
-// directory tree for an application.
-func Init(rootPath AbsPath, spec ClusterSpec, serverURI, namespace *string) (Manager, error) {
-	return initManager(rootPath, spec, serverURI, namespace, appFS)
+// directory tree for an application. If `ctx` is cancelled before `Init`
+// completes, the partially-initialized directory tree is removed.
+func Init(ctx context.Context, rootPath AbsPath, spec ClusterSpec, serverURI, namespace *string) (Manager, error) {
+	return initManager(ctx, rootPath, spec, serverURI, namespace, appFS)
+}
+
+// InitFs is like `Init`, but generates the application's directory tree in
+// `fs` rather than in the OS filesystem.
+func InitFs(ctx context.Context, rootPath AbsPath, spec ClusterSpec, serverURI, namespace *string, fs afero.Fs) (Manager, error) {
+	return initManager(ctx, rootPath, spec, serverURI, namespace, fs)
 }
 
 // ClusterSpec represents the API supported by some cluster. There are several
@@ -77,7 +143,7 @@ func Init(rootPath AbsPath, spec ClusterSpec, serverURI, namespace *string) (Man
 // OpenAPI spec in some file, or consulting the OpenAPI spec released in a
 // specific version of Kubernetes.
 type ClusterSpec interface {
-	data() ([]byte, error)
+	data(ctx context.Context) ([]byte, error)
 	resource() string // For testing parsing logic.
 }
 
@@ -89,6 +155,12 @@ func ParseClusterSpec(specFlag string) (ClusterSpec, error) {
 	return parseClusterSpec(specFlag, appFS)
 }
 
+// ParseClusterSpecFs is like `ParseClusterSpec`, but reads `file:` specs from
+// `fs` rather than from the OS filesystem.
+func ParseClusterSpecFs(specFlag string, fs afero.Fs) (ClusterSpec, error) {
+	return parseClusterSpec(specFlag, fs)
+}
+
 // isValidName returns true if a name (e.g., for an environment) is valid.
 // Broadly, this means it does not contain punctuation, whitespace, leading or
 // trailing slashes.
@@ -0,0 +1,267 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/prototype"
+)
+
+// IntrospectSchemaVersion is the version of the schema of `AppModel`. It is
+// incremented whenever a field is removed or changes meaning; new fields may
+// be added without changing it.
+const IntrospectSchemaVersion = 1
+
+// AppModel describes a whole ksonnet application (its environments,
+// components, vendored libraries, and the prototypes available to it) in a
+// single JSON-serializable document, for tools (e.g., web consoles) that
+// render an application without running many commands.
+type AppModel struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	Root          string              `json:"root"`
+	Environments  []*EnvironmentModel `json:"environments"`
+	Components    []*ComponentModel   `json:"components"`
+	Libraries     []*LibraryModel     `json:"libraries"`
+	Prototypes    []*PrototypeModel   `json:"prototypes"`
+	// Extensions are the fields of `app.yaml` that belong to other tools.
+	Extensions Extensions `json:"extensions,omitempty"`
+}
+
+// EnvironmentModel describes an environment, and the clusters it deploys to.
+type EnvironmentModel struct {
+	Name                string              `json:"name"`
+	URI                 string              `json:"uri"`
+	Namespace           string              `json:"namespace"`
+	KubernetesVersion   string              `json:"kubernetesVersion,omitempty"`
+	ClusterSelector     string              `json:"clusterSelector,omitempty"`
+	Context             string              `json:"context,omitempty"`
+	Inherits            string              `json:"inherits,omitempty"`
+	Targets             []string            `json:"targets,omitempty"`
+	LibraryPins         map[string]string   `json:"libraryPins,omitempty"`
+	LibPaths            []string            `json:"libPaths,omitempty"`
+	ComponentNamespaces map[string]string   `json:"componentNamespaces,omitempty"`
+	ComponentServers    map[string]string   `json:"componentServers,omitempty"`
+	ExtVars             map[string]string   `json:"extVars,omitempty"`
+	TlaVars             map[string]string   `json:"tlaVars,omitempty"`
+	Aliases             []string            `json:"aliases,omitempty"`
+	Protected           bool                `json:"protected,omitempty"`
+	Labels              map[string]string   `json:"labels,omitempty"`
+	Annotations         map[string]string   `json:"annotations,omitempty"`
+	Hooks               *EnvironmentHooks   `json:"hooks,omitempty"`
+	Destinations        []*DestinationModel `json:"destinations"`
+}
+
+// DestinationModel is a cluster (and namespace) an environment deploys to.
+type DestinationModel struct {
+	// Cluster is the name of the cluster in 'clusters.yaml', if the
+	// environment selects clusters from the inventory.
+	Cluster   string `json:"cluster,omitempty"`
+	URI       string `json:"uri"`
+	Namespace string `json:"namespace"`
+
+	// Context is the name of the kubeconfig context, if the environment is
+	// deployed with one rather than by URI.
+	Context string `json:"context,omitempty"`
+}
+
+// ComponentModel describes a component, and its settings in `app.yaml`.
+type ComponentModel struct {
+	Name   string            `json:"name"`
+	Path   string            `json:"path"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Extensions are the fields of the component's entry in `app.yaml` that
+	// belong to other tools.
+	Extensions Extensions `json:"extensions,omitempty"`
+}
+
+// LibraryModel describes a vendored library.
+type LibraryModel struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Shared is true for libraries vendored by the workspace, rather than
+	// by the application itself.
+	Shared bool `json:"shared,omitempty"`
+}
+
+// PrototypeModel describes a prototype, and the parameters it takes.
+type PrototypeModel struct {
+	Name             string                   `json:"name"`
+	ShortDescription string                   `json:"shortDescription"`
+	Description      string                   `json:"description"`
+	TemplateTypes    []prototype.TemplateType `json:"templateTypes"`
+	Params           prototype.ParamSchemas   `json:"params"`
+}
+
+// Introspect returns a model of the whole application. Paths in the model are
+// relative to the application root, except those outside it (e.g., the
+// libraries vendored by a workspace).
+func (m *manager) Introspect() (*AppModel, error) {
+	model := &AppModel{
+		SchemaVersion: IntrospectSchemaVersion,
+		Root:          string(m.rootPath),
+		Environments:  []*EnvironmentModel{},
+		Components:    []*ComponentModel{},
+		Libraries:     []*LibraryModel{},
+		Prototypes:    []*PrototypeModel{},
+	}
+
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+	for _, env := range envs {
+		em := &EnvironmentModel{
+			Name:                env.Name,
+			URI:                 env.URI,
+			Namespace:           env.Namespace,
+			KubernetesVersion:   env.KubernetesVersion,
+			ClusterSelector:     env.ClusterSelector,
+			Context:             env.Context,
+			Inherits:            env.Inherits,
+			Targets:             env.Targets,
+			LibraryPins:         env.LibraryPins,
+			LibPaths:            env.LibPaths,
+			ComponentNamespaces: env.ComponentNamespaces,
+			ComponentServers:    env.ComponentServers,
+			ExtVars:             env.ExtVars,
+			TlaVars:             env.TlaVars,
+			Aliases:             env.Aliases,
+			Protected:           env.Protected,
+			Labels:              env.Labels,
+			Annotations:         env.Annotations,
+			Hooks:               env.Hooks,
+			Destinations:        []*DestinationModel{},
+		}
+		// Destinations are where the environment is actually deployed, so
+		// their `${VAR}` references are expanded, where possible. 'ks app
+		// status' reports references that cannot be.
+		uri, namespace, err := m.ExpandDestination(env)
+		if err != nil {
+			uri, namespace = env.URI, env.Namespace
+		}
+		if env.ClusterSelector != "" {
+			clusters, err := m.SelectClusters(env.ClusterSelector)
+			if err != nil {
+				return nil, err
+			}
+			for _, cluster := range clusters {
+				em.Destinations = append(em.Destinations, &DestinationModel{Cluster: cluster.Name, URI: cluster.URI, Namespace: namespace})
+			}
+		} else {
+			em.Destinations = append(em.Destinations, &DestinationModel{Context: env.Context, URI: uri, Namespace: namespace})
+		}
+		model.Environments = append(model.Environments, em)
+	}
+
+	appSpec, err := m.AppSpec()
+	if err != nil {
+		return nil, err
+	}
+	model.Extensions = appSpec.Extensions
+	paths, err := m.ComponentPaths()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		cm := &ComponentModel{
+			Name: m.componentName(p),
+			Path: m.relPath(p),
+			Type: strings.TrimPrefix(path.Ext(p), "."),
+		}
+		if spec, ok := appSpec.Components[componentKey(p)]; ok && spec != nil {
+			cm.Labels = spec.Labels
+			cm.Extensions = spec.Extensions
+		}
+		model.Components = append(model.Components, cm)
+	}
+
+	libs, err := m.vendoredLibraries(string(m.vendorDir), false)
+	if err != nil {
+		return nil, err
+	}
+	model.Libraries = append(model.Libraries, libs...)
+	ws, err := findWorkspace(m.rootPath, m.appFS)
+	if err != nil {
+		return nil, err
+	} else if ws != nil && ws.VendorPath() != "" {
+		libs, err := m.vendoredLibraries(string(ws.VendorPath()), true)
+		if err != nil {
+			return nil, err
+		}
+		model.Libraries = append(model.Libraries, libs...)
+	}
+
+	protos, err := prototype.NewIndex([]*prototype.SpecificationSchema{}).List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(protos, func(i, j int) bool { return protos[i].Name < protos[j].Name })
+	for _, proto := range protos {
+		model.Prototypes = append(model.Prototypes, &PrototypeModel{
+			Name:             proto.Name,
+			ShortDescription: proto.Template.ShortDescription,
+			Description:      proto.Template.Description,
+			TemplateTypes:    proto.Template.AvailableTemplates(),
+			Params:           proto.Params,
+		})
+	}
+
+	return model, nil
+}
+
+// vendoredLibraries returns the libraries (i.e., the top-level directories)
+// in the vendor directory `dir`, if it exists.
+func (m *manager) vendoredLibraries(dir string, shared bool) ([]*LibraryModel, error) {
+	exists, err := afero.DirExists(m.appFS, dir)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	infos, err := afero.ReadDir(m.appFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	libs := []*LibraryModel{}
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		libs = append(libs, &LibraryModel{
+			Name:   info.Name(),
+			Path:   m.relPath(filepath.Join(dir, info.Name())),
+			Shared: shared,
+		})
+	}
+	return libs, nil
+}
+
+// relPath returns `p` relative to the application root, or unchanged if it is
+// outside the application.
+func (m *manager) relPath(p string) string {
+	if rel := strings.TrimPrefix(p, string(m.rootPath)+"/"); rel != p {
+		return rel
+	}
+	return p
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestIntrospect(t *testing.T) {
+	m := mockEnvironments(t, "test-introspect")
+
+	files := map[string]string{
+		"components/redis.jsonnet":     "{}",
+		"components/backend/api.yaml":  "{}",
+		"vendor/mylib/mylib.libsonnet": "{}",
+		appYAMLFile:                    "components:\n  redis:\n    labels:\n      tier: backend\n  api:\n    labels:\n      tier: frontend\n",
+		inventoryFile:                  "clusters:\n- name: edge-1\n  uri: https://edge-1.example.com\n  labels:\n    tier: edge\n- name: core\n  uri: https://core.example.com\n",
+	}
+	for name, text := range files {
+		if err := afero.WriteFile(testFS, string(appendToAbsPath(m.rootPath, name)), []byte(text), defaultFilePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.SetEnvironment(mockEnvName3, &Environment{ClusterSelector: "tier=edge"}); err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := m.Introspect()
+	if err != nil {
+		t.Fatalf("Failed to introspect application:\n%v", err)
+	}
+
+	if model.SchemaVersion != IntrospectSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", IntrospectSchemaVersion, model.SchemaVersion)
+	}
+
+	envs := map[string]*EnvironmentModel{}
+	for _, env := range model.Environments {
+		envs[env.Name] = env
+	}
+	if len(envs) != 4 {
+		t.Errorf("Expected 4 environments, got %d", len(envs))
+	}
+	expectedDests := []*DestinationModel{{Cluster: "edge-1", URI: "https://edge-1.example.com", Namespace: mockNamespace}}
+	if env := envs[mockEnvName3]; env == nil || !reflect.DeepEqual(env.Destinations, expectedDests) {
+		t.Errorf("Expected the destinations of '%s' to be the selected clusters, got %#v", mockEnvName3, env)
+	}
+	expectedDests = []*DestinationModel{{URI: mockSpecJSONURI, Namespace: mockNamespace}}
+	if env := envs[mockEnvName]; env == nil || !reflect.DeepEqual(env.Destinations, expectedDests) {
+		t.Errorf("Expected the destination of '%s' to be its URI, got %#v", mockEnvName, env)
+	}
+
+	expectedComponents := []*ComponentModel{
+		{Name: "backend/api", Path: "components/backend/api.yaml", Type: "yaml", Labels: map[string]string{"tier": "frontend"}},
+		{Name: "redis", Path: "components/redis.jsonnet", Type: "jsonnet", Labels: map[string]string{"tier": "backend"}},
+	}
+	if !reflect.DeepEqual(model.Components, expectedComponents) {
+		data, _ := json.Marshal(model.Components)
+		t.Errorf("Unexpected components: %s", data)
+	}
+
+	expectedLibraries := []*LibraryModel{{Name: "mylib", Path: "vendor/mylib"}}
+	if !reflect.DeepEqual(model.Libraries, expectedLibraries) {
+		data, _ := json.Marshal(model.Libraries)
+		t.Errorf("Unexpected libraries: %s", data)
+	}
+
+	if len(model.Prototypes) == 0 || len(model.Prototypes[0].Params) == 0 {
+		t.Errorf("Expected the built-in prototypes, with their parameters")
+	}
+}
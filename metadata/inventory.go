@@ -0,0 +1,79 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const inventoryFile = "clusters.yaml"
+
+// Cluster is an entry in the cluster inventory.
+type Cluster struct {
+	Name   string            `json:"name"`
+	URI    string            `json:"uri"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// inventorySpec represents the contents of `clusters.yaml`, the inventory of
+// clusters that environments can target by label. For example:
+//
+//	clusters:
+//	- name: edge-us-west
+//	  uri: https://edge-1.us-west.example.com
+//	  labels:
+//	    region: us-west
+//	    tier: edge
+type inventorySpec struct {
+	Clusters []*Cluster `json:"clusters"`
+}
+
+func (m *manager) SelectClusters(selector string) ([]*Cluster, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cluster selector '%s':\n%v", selector, err)
+	}
+
+	inventoryPath := appendToAbsPath(m.rootPath, inventoryFile)
+	exists, err := afero.Exists(m.appFS, string(inventoryPath))
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, fmt.Errorf("Could not select clusters with '%s'; there is no cluster inventory at '%s'", selector, inventoryPath)
+	}
+
+	data, err := afero.ReadFile(m.appFS, string(inventoryPath))
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory inventorySpec
+	if err := yaml.Unmarshal(data, &inventory); err != nil {
+		return nil, fmt.Errorf("Failed to parse '%s':\n%v", inventoryFile, err)
+	}
+
+	selected := []*Cluster{}
+	for _, cluster := range inventory.Clusters {
+		if sel.Matches(labels.Set(cluster.Labels)) {
+			selected = append(selected, cluster)
+		}
+	}
+	return selected, nil
+}
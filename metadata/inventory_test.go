@@ -0,0 +1,89 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestSelectClusters(t *testing.T) {
+	m := mockEnvironments(t, "test-select-clusters")
+
+	if _, err := m.SelectClusters("tier=edge"); err == nil {
+		t.Errorf("Expected selecting clusters without an inventory to fail")
+	}
+
+	inventory := `clusters:
+- name: edge-us-west
+  uri: https://edge-1.us-west.example.com
+  labels:
+    region: us-west
+    tier: edge
+- name: edge-us-east
+  uri: https://edge-1.us-east.example.com
+  labels:
+    region: us-east
+    tier: edge
+- name: core
+  uri: https://core.example.com
+  labels:
+    tier: core
+`
+	inventoryPath := appendToAbsPath(m.rootPath, inventoryFile)
+	if err := afero.WriteFile(testFS, string(inventoryPath), []byte(inventory), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write cluster inventory:\n%v", err)
+	}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{"tier=edge", []string{"edge-us-west", "edge-us-east"}},
+		{"tier=edge,region=us-east", []string{"edge-us-east"}},
+		{"tier!=edge", []string{"core"}},
+		{"region", []string{"edge-us-west", "edge-us-east"}},
+		{"tier=none", []string{}},
+	}
+
+	for _, test := range tests {
+		clusters, err := m.SelectClusters(test.selector)
+		if err != nil {
+			t.Errorf("Failed to select clusters with '%s':\n%v", test.selector, err)
+			continue
+		}
+
+		names := []string{}
+		for _, cluster := range clusters {
+			names = append(names, cluster.Name)
+		}
+		if len(names) != len(test.expected) {
+			t.Errorf("Expected selector '%s' to select %v, got %v", test.selector, test.expected, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != test.expected[i] {
+				t.Errorf("Expected selector '%s' to select %v, got %v", test.selector, test.expected, names)
+				break
+			}
+		}
+	}
+
+	if _, err := m.SelectClusters("tier in (edge"); err == nil {
+		t.Errorf("Expected invalid selector to fail")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// UpdateEnvironmentKubernetesVersion regenerates the ksonnet-lib of the
+// environment `name` from the API specification `spec` (e.g., that of a newer
+// Kubernetes release), and records the release in its `spec.json`. The
+// environment's overrides are left alone.
+func (m *manager) UpdateEnvironmentKubernetesVersion(ctx context.Context, name string, spec ClusterSpec) error {
+	env, err := m.GetEnvironment(name)
+	if err != nil {
+		return err
+	}
+	name = env.Name
+
+	p := newProgress(ctx, 3)
+
+	extensionsLibData, k8sLibData, specData, err := m.generateKsonnetLibData(p, spec)
+	if err != nil {
+		return err
+	}
+
+	if err := p.phase("Writing environment '%s'", name); err != nil {
+		return err
+	}
+
+	previous := env.KubernetesVersion
+	env.KubernetesVersion = schemaVersion(specData)
+	envSpecData, err := json.MarshalIndent(environmentSpec(env), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
+	envPath := appendToAbsPath(m.environmentsPath, name)
+	metadataPath := appendToAbsPath(envPath, metadataDirName)
+	files := []*EnvironmentFile{
+		{Path: appendToAbsPath(metadataPath, schemaFilename), Data: specData},
+		{Path: appendToAbsPath(metadataPath, k8sLibFilename), Data: k8sLibData},
+		{Path: appendToAbsPath(metadataPath, extensionsLibFilename), Data: extensionsLibData},
+		{Path: appendToAbsPath(envPath, specFilename), Data: envSpecData},
+	}
+	for _, f := range files {
+		if err := tx.writeFile(f.Path, f.Data); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.commit(); err != nil {
+		return err
+	}
+
+	log.Infof("Environment '%s' updated from Kubernetes %s to %s", name, describeVersion(previous), describeVersion(env.KubernetesVersion))
+	return nil
+}
+
+// schemaVersion returns the Kubernetes release an OpenAPI specification
+// describes (e.g., `v1.7.0`), or the empty string if it does not say.
+func schemaVersion(specData []byte) string {
+	var schema struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(specData, &schema); err != nil {
+		return ""
+	}
+	return schema.Info.Version
+}
+
+func describeVersion(version string) string {
+	if version == "" {
+		return "an unknown version"
+	}
+	return version
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestUpdateEnvironmentKubernetesVersion(t *testing.T) {
+	m := mockEnvironments(t, "test-update-k8s-version")
+
+	newSwagger := "/newSwagger.json"
+	newSwaggerData := strings.Replace(blankSwaggerData, `"paths": {`, `"paths": {"/api/": {}`, 1)
+	if err := afero.WriteFile(testFS, newSwagger, []byte(newSwaggerData), os.ModePerm); err != nil {
+		t.Fatalf("Failed to write API specification:\n%v", err)
+	}
+	spec, err := parseClusterSpec("file:"+newSwagger, testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+
+	if err := m.UpdateEnvironmentKubernetesVersion(context.Background(), mockEnvName, spec); err != nil {
+		t.Fatalf("Failed to update environment:\n%v", err)
+	}
+
+	env, err := m.GetEnvironment(mockEnvName)
+	if err != nil {
+		t.Fatalf("Failed to get environment:\n%v", err)
+	}
+	if env.KubernetesVersion != "v1.7.0" {
+		t.Errorf("Expected Kubernetes version 'v1.7.0', got '%s'", env.KubernetesVersion)
+	}
+	if env.URI != mockSpecJSONURI || env.Namespace != mockNamespace {
+		t.Errorf("Expected destination to be unchanged, got '%s' and '%s'", env.URI, env.Namespace)
+	}
+
+	schemaPath := appendToAbsPath(m.environmentsPath, mockEnvName, metadataDirName, schemaFilename)
+	data, err := afero.ReadFile(testFS, string(schemaPath))
+	if err != nil {
+		t.Fatalf("Failed to read API specification:\n%v", err)
+	}
+	if string(data) != newSwaggerData {
+		t.Errorf("Expected API specification to be replaced, got:\n%s", data)
+	}
+
+	if err := m.UpdateEnvironmentKubernetesVersion(context.Background(), "us-west/missing", spec); err == nil {
+		t.Errorf("Expected updating a missing environment to fail")
+	}
+}
@@ -16,15 +16,18 @@
 package metadata
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/ksonnet/ksonnet/prototype"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func appendToAbsPath(originalPath AbsPath, toAppend ...string) AbsPath {
@@ -56,6 +59,7 @@ type manager struct {
 	vendorDir        AbsPath
 
 	baseLibsonnetPath AbsPath
+	appYAMLPath       AbsPath
 }
 
 func findManager(abs AbsPath, appFS afero.Fs) (*manager, error) {
@@ -80,9 +84,15 @@ func findManager(abs AbsPath, appFS afero.Fs) (*manager, error) {
 	}
 }
 
-func initManager(rootPath AbsPath, spec ClusterSpec, serverURI, namespace *string, appFS afero.Fs) (*manager, error) {
+func initManager(ctx context.Context, rootPath AbsPath, spec ClusterSpec, serverURI, namespace *string, appFS afero.Fs) (*manager, error) {
 	m := newManager(rootPath, appFS)
 
+	phases := 3
+	if serverURI != nil {
+		phases++
+	}
+	p := newProgress(ctx, phases)
+
 	// Generate the program text for ksonnet-lib.
 	//
 	// IMPLEMENTATION NOTE: We get the cluster specification and generate
@@ -90,24 +100,37 @@ func initManager(rootPath AbsPath, spec ClusterSpec, serverURI, namespace *strin
 	// either (e.g., GET'ing the spec from a live cluster returns 404) does not
 	// result in a partially-initialized directory structure.
 	//
-	extensionsLibData, k8sLibData, specData, err := m.generateKsonnetLibData(spec)
+	extensionsLibData, k8sLibData, specData, err := m.generateKsonnetLibData(p, spec)
 	if err != nil {
 		return nil, err
 	}
 
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
 	// Initialize directory structure.
-	if err := m.createAppDirTree(); err != nil {
+	if err := p.phase("Creating application directory tree at '%s'", rootPath); err != nil {
+		return nil, err
+	}
+	if err := m.createAppDirTree(tx); err != nil {
 		return nil, err
 	}
 
 	// Initialize environment, and cache specification data.
 	if serverURI != nil {
-		err := m.createEnvironment(defaultEnvName, *serverURI, *namespace, extensionsLibData, k8sLibData, specData)
+		if err := p.phase("Creating environment '%s'", defaultEnvName); err != nil {
+			return nil, err
+		}
+		err := m.createEnvironment(tx, defaultEnvName, *serverURI, *namespace, "", extensionsLibData, k8sLibData, specData)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if err := tx.commit(); err != nil {
+		return nil, err
+	}
+
 	return m, nil
 }
 
@@ -123,6 +146,7 @@ func newManager(rootPath AbsPath, appFS afero.Fs) *manager {
 		vendorDir:        appendToAbsPath(rootPath, vendorDir),
 
 		baseLibsonnetPath: appendToAbsPath(rootPath, environmentsDir, baseLibsonnetFile),
+		appYAMLPath:       appendToAbsPath(rootPath, appYAMLFile),
 	}
 }
 
@@ -149,6 +173,40 @@ func (m *manager) ComponentPaths() (AbsPaths, error) {
 	return paths, nil
 }
 
+// SelectComponents returns the paths of the components whose labels in
+// `app.yaml` match `selector`. Components that `app.yaml` does not mention
+// have no labels.
+func (m *manager) SelectComponents(selector string) (AbsPaths, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid component selector '%s':\n%v", selector, err)
+	}
+
+	appSpec, err := m.AppSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := m.ComponentPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := AbsPaths{}
+	for _, p := range paths {
+		name := componentKey(p)
+
+		var componentLabels map[string]string
+		if spec, ok := appSpec.Components[name]; ok && spec != nil {
+			componentLabels = spec.Labels
+		}
+		if sel.Matches(labels.Set(componentLabels)) {
+			selected = append(selected, p)
+		}
+	}
+	return selected, nil
+}
+
 func (m *manager) CreateComponent(name string, text string, templateType prototype.TemplateType) error {
 	if !isValidName(name) || strings.Contains(name, "/") {
 		return fmt.Errorf("Component name '%s' is not valid; must not contain punctuation, spaces, or begin or end with a slash", name)
@@ -177,12 +235,128 @@ func (m *manager) CreateComponent(name string, text string, templateType prototy
 	return afero.WriteFile(m.appFS, componentPath, []byte(text), defaultFilePermissions)
 }
 
+func (m *manager) CopyComponent(srcName, dstName string) error {
+	if !isValidName(dstName) || strings.Contains(dstName, "/") {
+		return fmt.Errorf("Component name '%s' is not valid; must not contain punctuation, spaces, or begin or end with a slash", dstName)
+	}
+
+	srcPath, err := m.componentFile(srcName)
+	if err != nil {
+		return fmt.Errorf("Could not check whether component '%s' exists:\n\n%v", srcName, err)
+	} else if srcPath == "" {
+		return fmt.Errorf("Component '%s' does not exist", srcName)
+	}
+
+	// Components are keyed by name (not file name) in the base object, so the
+	// new name must be unused regardless of the file type.
+	if existing, err := m.componentFile(dstName); err != nil {
+		return fmt.Errorf("Could not check whether component '%s' exists:\n\n%v", dstName, err)
+	} else if existing != "" {
+		return fmt.Errorf("Component with name '%s' already exists", dstName)
+	}
+
+	text, err := afero.ReadFile(m.appFS, srcPath)
+	if err != nil {
+		return err
+	}
+
+	dstPath := string(appendToAbsPath(m.componentsPath, dstName)) + path.Ext(srcPath)
+	log.Infof("Copying component '%s/%s' to '%s/%s'", componentsDir, srcName, componentsDir, dstName)
+
+	return afero.WriteFile(m.appFS, dstPath, text, defaultFilePermissions)
+}
+
+func (m *manager) SplitComponent(name, shared string, parts map[string]string) error {
+	srcPath, err := m.componentFile(name)
+	if err != nil {
+		return fmt.Errorf("Could not check whether component '%s' exists:\n\n%v", name, err)
+	} else if srcPath == "" {
+		return fmt.Errorf("Component '%s' does not exist", name)
+	}
+
+	// Overrides of the component would silently stop applying to its objects.
+	refs, err := m.componentReferences(name)
+	if err != nil {
+		return err
+	} else if len(refs) > 0 {
+		return fmt.Errorf("Component '%s' is overridden or mapped by %s; move those settings into the component before splitting it", name, strings.Join(refs, ", "))
+	}
+	if spec, err := m.AppSpec(); err != nil {
+		return err
+	} else if _, ok := spec.Components[name]; ok {
+		log.Warnf("The settings of component '%s' in '%s' do not apply to the components it is split into", name, appYAMLFile)
+	}
+
+	sharedPath := appendToAbsPath(m.libPath, name+".libsonnet")
+	if shared != "" {
+		if exists, err := afero.Exists(m.appFS, string(sharedPath)); err != nil {
+			return err
+		} else if exists {
+			return fmt.Errorf("Library '%s/%s.libsonnet' already exists", libDir, name)
+		}
+	}
+
+	partNames := []string{}
+	for partName := range parts {
+		if !isValidName(partName) || strings.Contains(partName, "/") {
+			return fmt.Errorf("Component name '%s' is not valid; must not contain punctuation, spaces, or begin or end with a slash", partName)
+		}
+		if partName != name {
+			if existing, err := m.componentFile(partName); err != nil {
+				return fmt.Errorf("Could not check whether component '%s' exists:\n\n%v", partName, err)
+			} else if existing != "" {
+				return fmt.Errorf("Component with name '%s' already exists", partName)
+			}
+		}
+		partNames = append(partNames, partName)
+	}
+	sort.Strings(partNames)
+
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
+	if err := tx.removeAll(AbsPath(srcPath)); err != nil {
+		return err
+	}
+	if shared != "" {
+		log.Infof("Writing the locals shared by the new components at '%s/%s.libsonnet'", libDir, name)
+		if err := tx.writeFile(sharedPath, []byte(shared)); err != nil {
+			return err
+		}
+	}
+	for _, partName := range partNames {
+		log.Infof("Writing component at '%s/%s'", componentsDir, partName)
+		partPath := AbsPath(string(appendToAbsPath(m.componentsPath, partName)) + ".jsonnet")
+		if err := tx.writeFile(partPath, []byte(parts[partName])); err != nil {
+			return err
+		}
+	}
+
+	return tx.commit()
+}
+
+// componentFile returns the path of the file that defines the component
+// `name`, or the empty string if there is no such component.
+func (m *manager) componentFile(name string) (string, error) {
+	for _, ext := range []string{".jsonnet", ".yaml", ".json"} {
+		componentPath := string(appendToAbsPath(m.componentsPath, name)) + ext
+		exists, err := afero.Exists(m.appFS, componentPath)
+		if err != nil {
+			return "", err
+		} else if exists {
+			return componentPath, nil
+		}
+	}
+
+	return "", nil
+}
+
 func (m *manager) LibPaths(envName string) (libPath, envLibPath, envComponentPath AbsPath) {
 	envPath := appendToAbsPath(m.environmentsPath, envName)
 	return m.libPath, appendToAbsPath(envPath, metadataDirName), appendToAbsPath(envPath, path.Base(envName)+".jsonnet")
 }
 
-func (m *manager) createAppDirTree() error {
+func (m *manager) createAppDirTree(tx *transaction) error {
 	exists, err := afero.DirExists(m.appFS, string(m.rootPath))
 	if err != nil {
 		return fmt.Errorf("Could not check existance of directory '%s':\n%v", m.rootPath, err)
@@ -200,12 +374,12 @@ func (m *manager) createAppDirTree() error {
 	}
 
 	for _, p := range dirPaths {
-		if err := m.appFS.MkdirAll(string(p), defaultFolderPermissions); err != nil {
+		if err := tx.mkdirAll(p); err != nil {
 			return err
 		}
 	}
 
-	return afero.WriteFile(m.appFS, string(m.baseLibsonnetPath), genBaseLibsonnetContent(), defaultFilePermissions)
+	return tx.writeFile(m.baseLibsonnetPath, genBaseLibsonnetContent())
 }
 
 func genBaseLibsonnetContent() []byte {
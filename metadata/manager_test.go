@@ -15,12 +15,16 @@
 package metadata
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
+	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
+	"github.com/ksonnet/ksonnet/prototype"
 	"github.com/spf13/afero"
 )
 
@@ -60,7 +64,7 @@ func TestInitSuccess(t *testing.T) {
 	}
 
 	appPath := AbsPath("/fromEmptySwagger")
-	_, err = initManager(appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
+	_, err = initManager(context.Background(), appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
 	if err != nil {
 		t.Fatalf("Failed to init cluster spec: %v", err)
 	}
@@ -137,7 +141,7 @@ func TestFindSuccess(t *testing.T) {
 	}
 
 	appPath := AbsPath("/findSuccess")
-	_, err = initManager(appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
+	_, err = initManager(context.Background(), appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
 	if err != nil {
 		t.Fatalf("Failed to init cluster spec: %v", err)
 	}
@@ -165,7 +169,7 @@ func TestComponentPaths(t *testing.T) {
 	}
 
 	appPath := AbsPath("/componentPaths")
-	m, err := initManager(appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
+	m, err := initManager(context.Background(), appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
 	if err != nil {
 		t.Fatalf("Failed to init cluster spec: %v", err)
 	}
@@ -211,6 +215,73 @@ func TestComponentPaths(t *testing.T) {
 	}
 }
 
+func TestSelectComponents(t *testing.T) {
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", blankSwagger), testFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec: %v", err)
+	}
+
+	appPath := AbsPath("/selectComponents")
+	m, err := initManager(context.Background(), appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
+	if err != nil {
+		t.Fatalf("Failed to init cluster spec: %v", err)
+	}
+
+	components := appendToAbsPath(appPath, componentsDir)
+	for _, name := range []string{"ui", "redis", "batch/jobs"} {
+		p := string(appendToAbsPath(components, name+".jsonnet"))
+		if err := afero.WriteFile(testFS, p, []byte("{}"), 0644); err != nil {
+			t.Fatalf("Failed to write component '%s'\n%v", p, err)
+		}
+	}
+
+	appYAML := `components:
+  ui:
+    labels:
+      tier: frontend
+  redis:
+    labels:
+      tier: backend
+      stateful: "true"
+  jobs:
+    labels:
+      tier: batch
+`
+	if err := afero.WriteFile(testFS, string(appendToAbsPath(appPath, appYAMLFile)), []byte(appYAML), 0644); err != nil {
+		t.Fatalf("Failed to write app.yaml\n%v", err)
+	}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{selector: "tier=frontend", expected: []string{"ui"}},
+		{selector: "!stateful", expected: []string{"jobs", "ui"}},
+		{selector: "tier", expected: []string{"jobs", "redis", "ui"}},
+		{selector: "tier notin (frontend)", expected: []string{"jobs", "redis"}},
+		{selector: "tier=batch", expected: []string{"jobs"}},
+	}
+	for _, test := range tests {
+		paths, err := m.SelectComponents(test.selector)
+		if err != nil {
+			t.Fatalf("Failed to select components with '%s':\n%v", test.selector, err)
+		}
+
+		names := []string{}
+		for _, p := range paths {
+			names = append(names, strings.TrimSuffix(path.Base(p), ".jsonnet"))
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Expected selector '%s' to select %v, got %v", test.selector, test.expected, names)
+		}
+	}
+
+	if _, err := m.SelectComponents("tier in frontend"); err == nil {
+		t.Errorf("Expected invalid selector to fail")
+	}
+}
+
 func TestLibPaths(t *testing.T) {
 	appName := "test-lib-paths"
 	expectedLibPath := path.Join(appName, libDir)
@@ -251,14 +322,87 @@ func TestDoubleNewFailure(t *testing.T) {
 
 	appPath := AbsPath("/doubleNew")
 
-	_, err = initManager(appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
+	_, err = initManager(context.Background(), appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
 	if err != nil {
 		t.Fatalf("Failed to init cluster spec: %v", err)
 	}
 
 	targetErr := fmt.Sprintf("Could not create app; directory '%s' already exists", appPath)
-	_, err = initManager(appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
+	_, err = initManager(context.Background(), appPath, spec, &mockAPIServerURI, &mockNamespace, testFS)
 	if err == nil || err.Error() != targetErr {
 		t.Fatalf("Expected to fail to create app with message '%s', got '%s'", targetErr, err.Error())
 	}
 }
+
+func TestCopyComponent(t *testing.T) {
+	m := mockEnvironments(t, "/copyComponent")
+
+	const text = `{apiVersion: "v1", kind: "Namespace", metadata: {name: "foo"}}`
+	if err := m.CreateComponent("foo", text, prototype.Jsonnet); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+	if err := m.CreateComponent("bar", "kind: Namespace", prototype.YAML); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+
+	if err := m.CopyComponent("foo", "foo-canary"); err != nil {
+		t.Fatalf("Failed to copy component:\n%v", err)
+	}
+
+	copyPath := string(appendToAbsPath(m.componentsPath, "foo-canary.jsonnet"))
+	data, err := afero.ReadFile(testFS, copyPath)
+	if err != nil {
+		t.Fatalf("Failed to read copied component at '%s':\n%v", copyPath, err)
+	} else if string(data) != text {
+		t.Fatalf("Expected copied component to contain '%s', got '%s'", text, data)
+	}
+
+	failures := []struct{ src, dst string }{
+		// Source does not exist.
+		{"missing", "missing-copy"},
+		// Destination exists, albeit with a different file type.
+		{"foo", "bar"},
+		// Destination name is invalid.
+		{"foo", "foo/bar"},
+	}
+	for _, failure := range failures {
+		if err := m.CopyComponent(failure.src, failure.dst); err == nil {
+			t.Errorf("Expected copying component '%s' to '%s' to fail", failure.src, failure.dst)
+		}
+	}
+}
+
+func TestSplitComponent(t *testing.T) {
+	m := mockEnvironments(t, "/splitComponent")
+
+	if err := m.CreateComponent("big", "[]", prototype.Jsonnet); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+	if err := m.CreateComponent("other", "{}", prototype.Jsonnet); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+
+	// A part that collides with an existing component fails, and leaves the
+	// original component in place.
+	err := m.SplitComponent("big", "", map[string]string{"big-a": "{}", "other": "{}"})
+	if err == nil {
+		t.Fatalf("Expected splitting into an existing component to fail")
+	}
+	testFileContents(t, testFS, string(appendToAbsPath(m.componentsPath, "big.jsonnet")), "[]")
+
+	parts := map[string]string{"big-a": "{a: 1}", "big-b": "{b: 1}"}
+	shared := "local a = 1; {a:: a}"
+	if err := m.SplitComponent("big", shared, parts); err != nil {
+		t.Fatalf("Failed to split component:\n%v", err)
+	}
+
+	testFileNotExists(t, testFS, string(appendToAbsPath(m.componentsPath, "big.jsonnet")))
+	for name, text := range parts {
+		testFileContents(t, testFS, string(appendToAbsPath(m.componentsPath, name+".jsonnet")), text)
+	}
+	testFileContents(t, testFS, string(appendToAbsPath(m.libPath, "big.libsonnet")), shared)
+
+	if err := m.SplitComponent("missing", "", parts); err == nil {
+		t.Errorf("Expected splitting a missing component to fail")
+	}
+}
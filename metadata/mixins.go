@@ -0,0 +1,81 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// ComponentMixins returns the absolute paths of the mixins (see
+// `ComponentSpec.Mixins`) of each component that has any.
+func (m *manager) ComponentMixins() (map[string][]string, error) {
+	spec, err := m.AppSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name, component := range spec.Components {
+		if component != nil && len(component.Mixins) != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	mixins := map[string][]string{}
+	for _, name := range names {
+		for _, p := range spec.Components[name].Mixins {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(string(m.rootPath), p)
+			}
+			exists, err := afero.Exists(m.appFS, p)
+			if err != nil {
+				return nil, err
+			} else if !exists {
+				return nil, fmt.Errorf("Mixin '%s' of component '%s' in app.yaml does not exist", p, name)
+			}
+			mixins[name] = append(mixins[name], p)
+		}
+	}
+	return mixins, nil
+}
+
+// ComponentExpr returns a Jsonnet expression evaluating to the component at
+// `path`, with the objects at `mixins` merged, in order, onto each of its
+// objects: the object it evaluates to, or each element of its array, each item
+// of its `List` (as system prototypes generate), or each object of its object
+// of objects, at any depth.
+func ComponentExpr(path string, mixins []string) string {
+	if len(mixins) == 0 {
+		return fmt.Sprintf("import %q", path)
+	}
+
+	imports := []string{}
+	for _, mixin := range mixins {
+		imports = append(imports, fmt.Sprintf("(import %q)", mixin))
+	}
+	return fmt.Sprintf(`(local mix(c, m) =
+    if std.type(c) == "array" then [mix(o, m) for o in c]
+    else if !(std.objectHas(c, "kind") && std.objectHas(c, "apiVersion")) then {[k]: mix(c[k], m) for k in std.objectFields(c)}
+    else if c.kind == "List" then c + {items: [mix(o, m) for o in c.items]}
+    else c + m;
+  mix(import %q, %s))`, path, strings.Join(imports, " + "))
+}
@@ -0,0 +1,165 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/afero"
+)
+
+const pipelineFile = "pipeline.yaml"
+
+const (
+	// PipelineActionValidate validates an environment against its cluster's
+	// API specification.
+	PipelineActionValidate = "validate"
+	// PipelineActionDiff shows the differences between an environment and its
+	// cluster. Differences alone do not fail the stage.
+	PipelineActionDiff = "diff"
+	// PipelineActionApply applies an environment to its cluster.
+	PipelineActionApply = "apply"
+	// PipelineActionWait waits until the objects of an environment are ready,
+	// or, if no environment is given, for a fixed duration.
+	PipelineActionWait = "wait"
+)
+
+const (
+	// PipelineWhenSuccess runs a stage only if every stage before it
+	// succeeded. This is the default.
+	PipelineWhenSuccess = "success"
+	// PipelineWhenFailure runs a stage only if some stage before it failed,
+	// e.g., to notify someone.
+	PipelineWhenFailure = "failure"
+	// PipelineWhenAlways runs a stage regardless of the stages before it.
+	PipelineWhenAlways = "always"
+)
+
+// PipelineSpec represents the contents of the optional `pipeline.yaml` file at
+// the root of a ksonnet application, which describes the stages of promoting
+// the application through its environments. For example:
+//
+//	stages:
+//	- name: validate-staging
+//	  action: validate
+//	  env: staging
+//	- name: apply-staging
+//	  action: apply
+//	  env: staging
+//	- name: wait-staging
+//	  action: wait
+//	  env: staging
+//	  timeout: 5m
+//	- name: apply-prod
+//	  action: apply
+//	  env: prod
+type PipelineSpec struct {
+	Stages []*PipelineStage `json:"stages"`
+}
+
+// PipelineStage is a single step of a pipeline.
+type PipelineStage struct {
+	Name string `json:"name"`
+	// Action is one of the `PipelineAction*` constants.
+	Action string `json:"action"`
+	// Env is the environment the action is performed on. It is required by
+	// every action except `wait`.
+	Env string `json:"env,omitempty"`
+	// Timeout is how long a `wait` stage waits for, e.g., "5m".
+	Timeout string `json:"timeout,omitempty"`
+	// When is one of the `PipelineWhen*` constants; it defaults to
+	// `PipelineWhenSuccess`.
+	When string `json:"when,omitempty"`
+}
+
+// TimeoutDuration returns the stage's timeout, or zero if it has none.
+func (s *PipelineStage) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(s.Timeout)
+	return d
+}
+
+// Pipeline returns the contents of `pipeline.yaml`. It returns an error if the
+// application has no pipeline, or if the pipeline is malformed.
+func (m *manager) Pipeline() (*PipelineSpec, error) {
+	pipelinePath := appendToAbsPath(m.rootPath, pipelineFile)
+	exists, err := afero.Exists(m.appFS, string(pipelinePath))
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, fmt.Errorf("Application has no pipeline; expected one at '%s'", pipelinePath)
+	}
+
+	data, err := afero.ReadFile(m.appFS, string(pipelinePath))
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &PipelineSpec{}
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("Failed to parse '%s':\n%v", pipelineFile, err)
+	}
+
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid pipeline '%s':\n%v", pipelineFile, err)
+	}
+	return spec, nil
+}
+
+func (s *PipelineSpec) validate() error {
+	if len(s.Stages) == 0 {
+		return fmt.Errorf("Pipeline has no stages")
+	}
+
+	names := map[string]bool{}
+	for i, stage := range s.Stages {
+		if stage.Name == "" {
+			return fmt.Errorf("Stage %d has no name", i+1)
+		} else if names[stage.Name] {
+			return fmt.Errorf("Stage name '%s' is used more than once", stage.Name)
+		}
+		names[stage.Name] = true
+
+		switch stage.Action {
+		case PipelineActionValidate, PipelineActionDiff, PipelineActionApply:
+			if stage.Env == "" {
+				return fmt.Errorf("Stage '%s' must specify the environment to %s", stage.Name, stage.Action)
+			}
+		case PipelineActionWait:
+			if stage.Timeout == "" {
+				return fmt.Errorf("Stage '%s' must specify how long to wait, e.g., 'timeout: 5m'", stage.Name)
+			}
+			if d, err := time.ParseDuration(stage.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("Stage '%s' has invalid timeout '%s'", stage.Name, stage.Timeout)
+			}
+		default:
+			return fmt.Errorf("Stage '%s' has unknown action '%s'; must be one of '%s', '%s', '%s', or '%s'", stage.Name, stage.Action,
+				PipelineActionValidate, PipelineActionDiff, PipelineActionApply, PipelineActionWait)
+		}
+
+		switch stage.When {
+		case "":
+			stage.When = PipelineWhenSuccess
+		case PipelineWhenSuccess, PipelineWhenFailure, PipelineWhenAlways:
+		default:
+			return fmt.Errorf("Stage '%s' has unknown condition '%s'; must be one of '%s', '%s', or '%s'", stage.Name, stage.When,
+				PipelineWhenSuccess, PipelineWhenFailure, PipelineWhenAlways)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestPipeline(t *testing.T) {
+	m := mockEnvironments(t, "test-pipeline")
+
+	if _, err := m.Pipeline(); err == nil {
+		t.Errorf("Expected reading a missing pipeline to fail")
+	}
+
+	pipelinePath := string(appendToAbsPath(m.rootPath, pipelineFile))
+	pipeline := `stages:
+- name: validate-staging
+  action: validate
+  env: staging
+- name: apply-staging
+  action: apply
+  env: staging
+- name: wait-staging
+  action: wait
+  env: staging
+  timeout: 5m
+- name: rollback
+  action: apply
+  env: staging
+  when: failure
+`
+	if err := afero.WriteFile(testFS, pipelinePath, []byte(pipeline), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write pipeline:\n%v", err)
+	}
+
+	spec, err := m.Pipeline()
+	if err != nil {
+		t.Fatalf("Failed to read pipeline:\n%v", err)
+	}
+	if len(spec.Stages) != 4 {
+		t.Fatalf("Expected 4 stages, got %d", len(spec.Stages))
+	}
+	if spec.Stages[0].When != PipelineWhenSuccess || spec.Stages[3].When != PipelineWhenFailure {
+		t.Errorf("Expected stage conditions 'success' and 'failure', got '%s' and '%s'", spec.Stages[0].When, spec.Stages[3].When)
+	}
+	if d := spec.Stages[2].TimeoutDuration(); d != 5*time.Minute {
+		t.Errorf("Expected wait stage timeout of 5m, got %s", d)
+	}
+}
+
+func TestValidatePipeline(t *testing.T) {
+	invalid := []*PipelineSpec{
+		{},
+		{Stages: []*PipelineStage{{Action: PipelineActionApply, Env: "dev"}}},
+		{Stages: []*PipelineStage{{Name: "a", Action: PipelineActionApply}}},
+		{Stages: []*PipelineStage{{Name: "a", Action: "lint", Env: "dev"}}},
+		{Stages: []*PipelineStage{{Name: "a", Action: PipelineActionWait}}},
+		{Stages: []*PipelineStage{{Name: "a", Action: PipelineActionWait, Timeout: "soon"}}},
+		{Stages: []*PipelineStage{{Name: "a", Action: PipelineActionDiff, Env: "dev", When: "sometimes"}}},
+		{Stages: []*PipelineStage{
+			{Name: "a", Action: PipelineActionDiff, Env: "dev"},
+			{Name: "a", Action: PipelineActionApply, Env: "dev"},
+		}},
+	}
+
+	for i, spec := range invalid {
+		if err := spec.validate(); err == nil {
+			t.Errorf("Expected pipeline %d to be invalid", i)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const platformOpenShift = "openshift"
+
+// managedPlatforms are the managed Kubernetes platforms whose version strings
+// carry the upstream release they are based on, followed by a platform
+// suffix, e.g., `v1.27.3-gke.400` or `v1.27.3-eks-a5565ad`.
+var managedPlatforms = []string{"gke", "eks", "aks", "k3s", "rke2"}
+
+// openShiftKubernetesVersions maps OpenShift releases to the Kubernetes
+// releases they are based on.
+var openShiftKubernetesVersions = map[string]string{
+	"3.6": "1.6", "3.7": "1.7", "3.9": "1.9", "3.10": "1.10", "3.11": "1.11",
+	"4.1": "1.13", "4.2": "1.14", "4.3": "1.16", "4.4": "1.17", "4.5": "1.18",
+	"4.6": "1.19", "4.7": "1.20", "4.8": "1.21", "4.9": "1.22", "4.10": "1.23",
+	"4.11": "1.24", "4.12": "1.25", "4.13": "1.26", "4.14": "1.27", "4.15": "1.28",
+	"4.16": "1.29",
+}
+
+var (
+	kubernetesVersionPattern = regexp.MustCompile(`^v?(\d+\.\d+)(\.\d+)?([-+].*)?$`)
+	openShiftVersionPattern  = regexp.MustCompile(`^openshift-v?(\d+\.\d+)(\.\d+)?$`)
+	apiVersionPattern        = regexp.MustCompile(`^v\d+((alpha|beta)\d+)?$`)
+)
+
+// platformVersion is a Kubernetes version as named by a distribution or
+// managed platform.
+type platformVersion struct {
+	// platform is the distribution or managed platform (e.g., `openshift` or
+	// `gke`), or empty for upstream Kubernetes.
+	platform string
+	// release is the platform's own release, e.g., `4.12` for OpenShift, or
+	// `v1.27.3-gke.400` for GKE.
+	release string
+	// base is the upstream Kubernetes release, e.g., `v1.25.0`.
+	base string
+}
+
+// parsePlatformVersion maps the version `version` of Kubernetes or of a
+// platform based on it (e.g., `v1.9.7`, `1.27-gke.400`, or `openshift-4.12`)
+// to the upstream Kubernetes release. Versions without a patch release are
+// mapped to the first one (e.g., `1.27-gke.400` to `v1.27.0`), as patch
+// releases do not change the API. Versions it does not recognize are
+// returned unchanged.
+func parsePlatformVersion(version string) (*platformVersion, error) {
+	if m := openShiftVersionPattern.FindStringSubmatch(version); m != nil {
+		k8sVersion, ok := openShiftKubernetesVersions[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("Unknown OpenShift release '%s'; pass the Kubernetes version it is based on instead, e.g., 'version:v1.25.0'", m[1])
+		}
+		return &platformVersion{platform: platformOpenShift, release: m[1] + m[2], base: "v" + k8sVersion + ".0"}, nil
+	}
+
+	m := kubernetesVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return &platformVersion{base: version}, nil
+	}
+	patch := m[2]
+	if patch == "" {
+		patch = ".0"
+	}
+
+	suffix := m[3]
+	if suffix == "" {
+		return &platformVersion{base: "v" + m[1] + patch}, nil
+	}
+	fields := strings.FieldsFunc(suffix, func(r rune) bool {
+		return r == '-' || r == '+' || r == '.'
+	})
+	for _, managed := range managedPlatforms {
+		if len(fields) > 0 && strings.HasPrefix(strings.ToLower(fields[0]), managed) {
+			return &platformVersion{platform: managed, release: "v" + strings.TrimPrefix(version, "v"), base: "v" + m[1] + patch}, nil
+		}
+	}
+	// An upstream pre-release, e.g., `v1.10.0-beta.1`.
+	return &platformVersion{base: "v" + strings.TrimPrefix(version, "v")}, nil
+}
+
+// BaseKubernetesVersion returns the upstream Kubernetes release (e.g.,
+// `v1.25.0`) of the version `version` of Kubernetes or of a platform based on
+// it (e.g., `openshift-4.12`).
+func BaseKubernetesVersion(version string) (string, error) {
+	v, err := parsePlatformVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return v.base, nil
+}
+
+// KubernetesVersionSpec returns the API spec flag (see `ParseClusterSpec`) of
+// the version `version` of Kubernetes or of a platform based on it (e.g.,
+// 'version:v1.9.7' for 'v1.9.7', and 'version:openshift-4.12' for
+// 'openshift-4.12'). Versions that are already API specs (e.g.,
+// 'file:swagger.json') are returned unchanged.
+func KubernetesVersionSpec(version string) string {
+	if strings.Contains(version, ":") {
+		return version
+	}
+	return "version:" + version
+}
+
+// mergePlatformSpec adds the definitions of the OpenAPI specification `extra`
+// of the platform `platform` (e.g., the OpenShift API groups) to the
+// Kubernetes specification `base`. ksonnet-lib only understands definitions
+// named like Kubernetes', so the platform's definitions are renamed, e.g.,
+// `com.github.openshift.api.route.v1.Route` to
+// `io.k8s.openshift.pkg.apis.route.v1.Route`. Definitions that `base`
+// already has are left alone.
+func mergePlatformSpec(base, extra []byte, platform string) ([]byte, error) {
+	var baseSpec, extraSpec map[string]interface{}
+	if err := json.Unmarshal(base, &baseSpec); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(extra, &extraSpec); err != nil {
+		return nil, err
+	}
+
+	definitions, _ := baseSpec["definitions"].(map[string]interface{})
+	if definitions == nil {
+		definitions = map[string]interface{}{}
+		baseSpec["definitions"] = definitions
+	}
+	extraDefinitions, _ := extraSpec["definitions"].(map[string]interface{})
+
+	renames := map[string]string{}
+	for name := range extraDefinitions {
+		if _, ok := definitions[name]; !ok {
+			renames[name] = platformDefinitionName(platform, name)
+		}
+	}
+	for name, newName := range renames {
+		definitions[newName] = rewriteDefinitionRefs(extraDefinitions[name], renames)
+	}
+
+	return json.MarshalIndent(baseSpec, "", "  ")
+}
+
+// platformDefinitionName returns the name that the definition `name` of the
+// platform `platform` is given in ksonnet-lib. Kubernetes' own definitions
+// keep their names.
+func platformDefinitionName(platform, name string) string {
+	if strings.HasPrefix(name, "io.k8s.") {
+		return name
+	}
+	split := strings.Split(name, ".")
+	kind := split[len(split)-1]
+	if len(split) >= 3 && apiVersionPattern.MatchString(split[len(split)-2]) {
+		return fmt.Sprintf("io.k8s.%s.pkg.apis.%s.%s.%s", platform, split[len(split)-3], split[len(split)-2], kind)
+	}
+	// Definitions outside of an API version are only referred to, never
+	// generated.
+	return fmt.Sprintf("io.k8s.%s.pkg.runtime.%s", platform, kind)
+}
+
+// rewriteDefinitionRefs replaces the references in `v` to the definitions
+// renamed in `renames`.
+func rewriteDefinitionRefs(v interface{}, renames map[string]string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if ref, ok := value.(string); key == "$ref" && ok {
+				if newName, ok := renames[strings.TrimPrefix(ref, "#/definitions/")]; ok {
+					v[key] = "#/definitions/" + newName
+				}
+				continue
+			}
+			v[key] = rewriteDefinitionRefs(value, renames)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = rewriteDefinitionRefs(value, renames)
+		}
+	}
+	return v
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParsePlatformVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected platformVersion
+	}{
+		{"v1.9.7", platformVersion{base: "v1.9.7"}},
+		{"1.9.7", platformVersion{base: "v1.9.7"}},
+		{"1.9", platformVersion{base: "v1.9.0"}},
+		{"v1.10.0-beta.1", platformVersion{base: "v1.10.0-beta.1"}},
+		{"master", platformVersion{base: "master"}},
+		{"1.27-gke.400", platformVersion{platform: "gke", release: "v1.27-gke.400", base: "v1.27.0"}},
+		{"v1.27.3-gke.1200", platformVersion{platform: "gke", release: "v1.27.3-gke.1200", base: "v1.27.3"}},
+		{"v1.27.3-eks-a5565ad", platformVersion{platform: "eks", release: "v1.27.3-eks-a5565ad", base: "v1.27.3"}},
+		{"v1.26.4+k3s1", platformVersion{platform: "k3s", release: "v1.26.4+k3s1", base: "v1.26.4"}},
+		{"openshift-4.12", platformVersion{platform: "openshift", release: "4.12", base: "v1.25.0"}},
+		{"openshift-v3.11.0", platformVersion{platform: "openshift", release: "3.11.0", base: "v1.11.0"}},
+	}
+
+	for _, test := range tests {
+		v, err := parsePlatformVersion(test.version)
+		if err != nil {
+			t.Errorf("Failed to parse version '%s': %v", test.version, err)
+			continue
+		}
+		if *v != test.expected {
+			t.Errorf("Expected version '%s' to parse as %+v, got %+v", test.version, test.expected, *v)
+		}
+	}
+
+	if _, err := parsePlatformVersion("openshift-5.0"); err == nil {
+		t.Errorf("Expected unknown OpenShift release to be rejected")
+	}
+}
+
+func TestMergePlatformSpec(t *testing.T) {
+	base := []byte(`{
+		"info": {"version": "v1.25.0"},
+		"definitions": {
+			"io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {"description": "kubernetes"}
+		}
+	}`)
+	extra := []byte(`{
+		"definitions": {
+			"io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {"description": "openshift"},
+			"com.github.openshift.api.route.v1.Route": {
+				"properties": {
+					"metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+					"spec": {"$ref": "#/definitions/com.github.openshift.api.route.v1.RouteSpec"}
+				}
+			},
+			"com.github.openshift.api.route.v1.RouteSpec": {
+				"properties": {
+					"port": {"$ref": "#/definitions/com.github.openshift.api.route.RoutePort"}
+				}
+			},
+			"com.github.openshift.api.route.RoutePort": {}
+		}
+	}`)
+
+	data, err := mergePlatformSpec(base, extra, "openshift")
+	if err != nil {
+		t.Fatalf("Failed to merge specs: %v", err)
+	}
+
+	var actual, expected map[string]interface{}
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("Failed to parse merged spec: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{
+		"info": {"version": "v1.25.0"},
+		"definitions": {
+			"io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {"description": "kubernetes"},
+			"io.k8s.openshift.pkg.apis.route.v1.Route": {
+				"properties": {
+					"metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+					"spec": {"$ref": "#/definitions/io.k8s.openshift.pkg.apis.route.v1.RouteSpec"}
+				}
+			},
+			"io.k8s.openshift.pkg.apis.route.v1.RouteSpec": {
+				"properties": {
+					"port": {"$ref": "#/definitions/io.k8s.openshift.pkg.runtime.RoutePort"}
+				}
+			},
+			"io.k8s.openshift.pkg.runtime.RoutePort": {}
+		}
+	}`), &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected merged spec %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// progress reports the phases of a long-running operation (e.g., generating
+// ksonnet-lib for a new environment), so that users are not left staring at a
+// silent terminal.
+type progress struct {
+	ctx     context.Context
+	total   int
+	current int
+}
+
+func newProgress(ctx context.Context, total int) *progress {
+	return &progress{ctx: ctx, total: total}
+}
+
+// phase announces the start of the next phase of the operation. It returns an
+// error if the operation was cancelled before the phase could begin.
+func (p *progress) phase(format string, args ...interface{}) error {
+	if err := p.ctx.Err(); err != nil {
+		return fmt.Errorf("Operation cancelled: %v", err)
+	}
+
+	p.current++
+	percent := 100 * (p.current - 1) / p.total
+	log.Infof("[%d/%d] (%d%%) %s", p.current, p.total, percent, fmt.Sprintf(format, args...))
+	return nil
+}
+
+// progressReader wraps a reader of known length, and logs how much of it has
+// been consumed, in increments of 25%.
+type progressReader struct {
+	r        io.Reader
+	desc     string
+	length   int64
+	read     int64
+	reported int64
+}
+
+func newProgressReader(r io.Reader, desc string, length int64) io.Reader {
+	if length <= 0 {
+		return r
+	}
+	return &progressReader{r: r, desc: desc, length: length}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.read += int64(n)
+
+	percent := 100 * pr.read / pr.length
+	if percent >= pr.reported+25 {
+		pr.reported = percent - percent%25
+		log.Infof("Retrieved %d%% of %s (%d/%d bytes)", pr.reported, pr.desc, pr.read, pr.length)
+	}
+
+	return n, err
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// SetEnvironmentProtected marks the environment `name` as protected, or
+// removes its protection. Commands that change or delete what runs in a
+// protected environment ask for confirmation first.
+func (m *manager) SetEnvironmentProtected(name string, protected bool) error {
+	env, err := m.GetEnvironment(name)
+	if err != nil {
+		return err
+	}
+	name = env.Name
+
+	env.Protected = protected
+	specData, err := json.MarshalIndent(environmentSpec(env), "", "  ")
+	if err != nil {
+		return err
+	}
+	specPath := appendToAbsPath(m.environmentsPath, name, specFilename)
+	if err := afero.WriteFile(m.appFS, string(specPath), specData, defaultFilePermissions); err != nil {
+		return err
+	}
+
+	if protected {
+		log.Infof("Environment '%s' is now protected", name)
+	} else {
+		log.Infof("Environment '%s' is no longer protected", name)
+	}
+	return nil
+}
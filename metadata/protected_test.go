@@ -0,0 +1,63 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+)
+
+func TestSetEnvironmentProtected(t *testing.T) {
+	m := mockEnvironments(t, "test-env-protected")
+
+	if err := m.SetEnvironmentProtected(mockEnvName2, true); err != nil {
+		t.Fatalf("Failed to protect environment:\n%v", err)
+	}
+
+	// Protection survives other changes to the environment.
+	if err := m.SetEnvironment(mockEnvName2, &Environment{Namespace: "production"}); err != nil {
+		t.Fatalf("Failed to set environment:\n%v", err)
+	}
+	env, err := m.GetEnvironment(mockEnvName2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !env.Protected || env.Namespace != "production" {
+		t.Errorf("Expected protected environment with namespace 'production', got protected=%v and '%s'", env.Protected, env.Namespace)
+	}
+
+	env, err = m.GetEnvironment(mockEnvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Protected {
+		t.Errorf("Expected environment '%s' to be unprotected", mockEnvName)
+	}
+
+	if err := m.SetEnvironmentProtected(mockEnvName2, false); err != nil {
+		t.Fatalf("Failed to unprotect environment:\n%v", err)
+	}
+	env, err = m.GetEnvironment(mockEnvName2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Protected {
+		t.Errorf("Expected environment '%s' to no longer be protected", mockEnvName2)
+	}
+
+	if err := m.SetEnvironmentProtected("missing", true); err == nil {
+		t.Errorf("Expected protecting a missing environment to fail")
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// fetchEnvironmentRegistry clones the registry described by `reg` into `dir`.
+// It is a variable so that it can be replaced in tests.
+//
+// Only the latest commit is fetched. If the environments are in a
+// subdirectory of the repository (e.g., of a large monorepo), only that
+// subdirectory is checked out, and only its files are downloaded, if the
+// server and the local git support partial clones. Otherwise, the whole
+// commit is cloned.
+var fetchEnvironmentRegistry = func(ctx context.Context, reg *EnvironmentRegistrySpec, dir string) error {
+	if reg.Path != "" {
+		err := sparseCloneRegistry(ctx, reg, dir)
+		if err == nil {
+			return nil
+		}
+		log.Debugf("Failed to check out only '%s' of environment registry '%s', cloning it in full:\n%v", reg.Path, reg.URI, err)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	args := append(registryCloneArgs(reg), reg.URI, dir)
+	out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to clone environment registry '%s':\n%s", reg.URI, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// registryCloneArgs returns the arguments to 'git' that shallowly clone the
+// registry `reg`, without its URI and destination directory.
+func registryCloneArgs(reg *EnvironmentRegistrySpec) []string {
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if reg.Ref != "" {
+		args = append(args, "--branch", reg.Ref)
+	}
+	return args
+}
+
+// sparseCloneRegistry clones the registry `reg` into `dir` without
+// downloading any files, and then checks out only `reg.Path`.
+func sparseCloneRegistry(ctx context.Context, reg *EnvironmentRegistrySpec, dir string) error {
+	clone := append(registryCloneArgs(reg), "--filter=blob:none", "--no-checkout", reg.URI, dir)
+	for _, args := range [][]string{
+		clone,
+		{"-C", dir, "sparse-checkout", "init", "--cone"},
+		{"-C", dir, "sparse-checkout", "set", "--", reg.Path},
+		{"-C", dir, "checkout", "--quiet"},
+	} {
+		out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("'git %s' failed:\n%s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+func (m *manager) SyncEnvironments(ctx context.Context) error {
+	appSpec, err := m.AppSpec()
+	if err != nil {
+		return err
+	}
+	reg := appSpec.EnvironmentRegistry
+	if reg == nil || reg.URI == "" {
+		return fmt.Errorf("No environment registry is configured; add an 'environmentRegistry' to '%s'", appYAMLFile)
+	}
+
+	dir, err := ioutil.TempDir("", "ksonnet-registry")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	log.Infof("Retrieving environments from registry '%s'", reg.URI)
+	if err := fetchEnvironmentRegistry(ctx, reg, dir); err != nil {
+		return err
+	}
+
+	return m.syncEnvironments(afero.NewOsFs(), filepath.Join(dir, reg.Path))
+}
+
+// syncEnvironments copies every environment found under `registryPath` in
+// `registryFS` into the application. The spec and generated ksonnet-lib of an
+// environment come from the registry, but its override file (`<name>.jsonnet`)
+// belongs to the application, and is only created if it does not yet exist.
+// Local environments that are not in the registry are left alone.
+func (m *manager) syncEnvironments(registryFS afero.Fs, registryPath string) error {
+	tx := newTransaction(m.appFS)
+	defer tx.rollback()
+
+	synced := 0
+	err := afero.Walk(registryFS, registryPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || info.Name() == metadataDirName {
+			return nil
+		}
+
+		exists, err := afero.Exists(registryFS, filepath.Join(p, specFilename))
+		if err != nil {
+			return err
+		} else if !exists {
+			return nil
+		}
+
+		name := filepath.Clean(strings.TrimPrefix(p, registryPath+"/"))
+		if !isValidName(name) || name == "." {
+			return fmt.Errorf("Environment name '%s' in registry is not valid; must not contain punctuation, spaces, or begin or end with a slash", name)
+		}
+
+		if err := m.syncEnvironment(tx, registryFS, p, name); err != nil {
+			return err
+		}
+		synced++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.commit(); err != nil {
+		return err
+	}
+
+	log.Infof("Successfully synced %d environment(s) from registry", synced)
+	return nil
+}
+
+func (m *manager) syncEnvironment(tx *transaction, registryFS afero.Fs, registryEnvPath, name string) error {
+	log.Infof("Syncing environment '%s'", name)
+
+	envPath := appendToAbsPath(m.environmentsPath, name)
+
+	registryMetadataPath := filepath.Join(registryEnvPath, metadataDirName)
+	for _, file := range []string{schemaFilename, k8sLibFilename, extensionsLibFilename} {
+		exists, err := afero.Exists(registryFS, filepath.Join(registryMetadataPath, file))
+		if err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("Environment '%s' in registry is missing '%s/%s'", name, metadataDirName, file)
+		}
+	}
+
+	copyFile := func(src string, dst AbsPath) error {
+		data, err := afero.ReadFile(registryFS, src)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Writing '%s', length: %d", dst, len(data))
+		return tx.writeFile(dst, data)
+	}
+
+	// Replace the metadata wholesale, so that files the registry no longer
+	// has do not linger.
+	metadataPath := appendToAbsPath(envPath, metadataDirName)
+	if err := tx.removeAll(metadataPath); err != nil {
+		return err
+	}
+	err := afero.Walk(registryFS, registryMetadataPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel := strings.TrimPrefix(p, registryMetadataPath+"/")
+		return copyFile(p, appendToAbsPath(metadataPath, rel))
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := copyFile(filepath.Join(registryEnvPath, specFilename), appendToAbsPath(envPath, specFilename)); err != nil {
+		return err
+	}
+
+	overridePath := appendToAbsPath(envPath, filepath.Base(name)+".jsonnet")
+	exists, err := afero.Exists(m.appFS, string(overridePath))
+	if err != nil {
+		return err
+	} else if !exists {
+		log.Debugf("Generating '%s'", overridePath)
+		data, err := m.overrideData(name, "")
+		if err != nil {
+			return err
+		}
+		return tx.writeFile(overridePath, data)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/ksonnet/ksonnet/template"
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// RenderComponent renders the component `component` as it would be rendered
+// in the environment `envName` (i.e., with that environment's libraries,
+// capabilities and overrides), without rendering the rest of the environment.
+// Each object is labeled with the component it belongs to, as with `ks apply`.
+// The objects must be within the budgets in `app.yaml`, and, if
+// `labelSelector` is non-empty, only those whose labels match it are returned.
+//
+// Images are not resolved; `std.native("resolveImage")` returns the image
+// unchanged.
+func (m *manager) RenderComponent(envName, component, labelSelector string) ([]*unstructured.Unstructured, error) {
+	selector := labels.Everything()
+	if labelSelector != "" {
+		var err error
+		selector, err = labels.Parse(labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse label selector '%s':\n%v", labelSelector, err)
+		}
+	}
+
+	componentPath, expander, err := m.componentExpander(envName, component)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := m.EnvironmentComponentPaths(envName, "")
+	if err != nil {
+		return nil, err
+	} else if !contains(paths, componentPath) || filepath.Ext(componentPath) != ".jsonnet" {
+		return nil, fmt.Errorf("Component '%s' is not rendered by environment '%s'", component, envName)
+	}
+	mixins, err := m.ComponentMixins()
+	if err != nil {
+		return nil, err
+	}
+	componentsExtCode := fmt.Sprintf("%s=%s", ComponentsExtCodeKey, ComponentsObj(paths, mixins))
+	expander.ExtCodes = append([]string{componentsExtCode}, expander.ExtCodes...)
+
+	// The environment's file merges its overrides onto the components; only
+	// the field of this component is evaluated.
+	_, _, envComponentPath := m.LibPaths(envName)
+	name := strings.TrimSuffix(filepath.Base(componentPath), ".jsonnet")
+	objs, err := expander.ExpandSnippet(string(envComponentPath), fmt.Sprintf("(import %q)[%q]", envComponentPath, name))
+	if err != nil {
+		return nil, err
+	}
+	if err := m.finishComponent(envName, component, objs); err != nil {
+		return nil, err
+	}
+	if err := m.CheckBudgets(envName, objs); err != nil {
+		return nil, err
+	}
+	return SelectObjects(objs, selector), nil
+}
+
+// RenderComponentSource renders the Jsonnet `source` as though it were the
+// source of the component `component` (i.e., relative imports are resolved
+// against the component's file), in the environment `envName`. Neither the
+// mixins of the component in `app.yaml` nor the overrides of the environment
+// are applied.
+func (m *manager) RenderComponentSource(envName, component, source string) ([]*unstructured.Unstructured, error) {
+	componentPath, expander, err := m.componentExpander(envName, component)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := expander.ExpandSnippet(componentPath, source)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.finishComponent(envName, component, objs); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// componentExpander returns the path of the component `component`, and an
+// expander for it in the environment `envName`.
+func (m *manager) componentExpander(envName, component string) (string, *template.Expander, error) {
+	if _, err := m.GetEnvironment(envName); err != nil {
+		return "", nil, err
+	}
+
+	componentPath, err := m.componentFile(component)
+	if err != nil {
+		return "", nil, fmt.Errorf("Could not check whether component '%s' exists:\n\n%v", component, err)
+	} else if componentPath == "" {
+		return "", nil, fmt.Errorf("Component '%s' does not exist", component)
+	}
+
+	expander, err := m.Expander(envName, template.Expander{
+		EnvJPath:   append(filepath.SplitList(os.Getenv("KUBECFG_JPATH")), filepath.SplitList(os.Getenv(JPathEnvVar))...),
+		Resolver:   "noop",
+		FailAction: "warn",
+	}, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return componentPath, expander, nil
+}
+
+// finishComponent labels the objects `objs` of the component `component`
+// with it, and sets the namespace the environment `envName` gives it.
+func (m *manager) finishComponent(envName, component string, objs []*unstructured.Unstructured) error {
+	for _, obj := range objs {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[utils.ComponentLabel] = component
+		obj.SetLabels(labels)
+	}
+
+	namespaces, err := m.ComponentNamespaces(envName)
+	if err != nil {
+		return err
+	}
+	utils.SetComponentNamespaces(objs, namespaces)
+	return nil
+}
+
+// Expander returns an expander for the components of the environment
+// `envName`: it searches the app's and the environment's libraries, and sets
+// the environment's capabilities, variables and library pins, and the app's
+// Jsonnet limits. The search paths, variables, external code and limits of
+// `flags` (e.g., those given on the command line) take precedence over the
+// app's and the environment's.
+//
+// `capabilities` are those of the environment's cluster, if it could be
+// reached; if nil, they are read from the environment's cached API
+// specification instead.
+func (m *manager) Expander(envName string, flags template.Expander, capabilities *Capabilities) (*template.Expander, error) {
+	expander := flags
+
+	// Jsonnet gives precedence to later search paths, so shared libraries
+	// (those listed in `app.yaml`, and those shared by the apps of a
+	// workspace) come first, letting an app override them.
+	jpath, err := m.SharedLibPaths()
+	if err != nil {
+		return nil, err
+	}
+	ws, err := findWorkspace(m.rootPath, m.appFS)
+	if err != nil {
+		return nil, err
+	} else if ws != nil && ws.VendorPath() != "" {
+		jpath = append(jpath, string(ws.VendorPath()))
+	}
+	libPath, envLibPath, _ := m.LibPaths(envName)
+	jpath = append(jpath, string(libPath), string(envLibPath))
+	envLibPaths, err := m.EnvironmentLibPaths(envName)
+	if err != nil {
+		return nil, err
+	}
+	jpath = append(jpath, envLibPaths...)
+	expander.FlagJpath = append(jpath, flags.FlagJpath...)
+
+	spec, err := m.AppSpec()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := spec.Jsonnet.Limits()
+	if err != nil {
+		return nil, err
+	}
+	expander.Limits = limits.Override(flags.Limits)
+
+	if capabilities == nil {
+		capabilities, err = m.Capabilities(envName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	expander.ExtCodes = append([]string{capabilities.ExtCode()}, flags.ExtCodes...)
+
+	// Jsonnet keeps the last value set for a variable.
+	extVars, tlaVars, err := m.JsonnetVars(envName)
+	if err != nil {
+		return nil, err
+	}
+	expander.ExtVars = append(extVars, flags.ExtVars...)
+	expander.TlaVars = append(tlaVars, flags.TlaVars...)
+
+	expander.LibraryPins, err = m.LibraryPins(envName)
+	if err != nil {
+		return nil, err
+	}
+	return &expander, nil
+}
+
+// CheckBudgets returns an error if the objects `objs` rendered for the
+// environment `envName` exceed the budgets in `app.yaml`.
+func (m *manager) CheckBudgets(envName string, objs []*unstructured.Unstructured) error {
+	spec, err := m.AppSpec()
+	if err != nil {
+		return err
+	}
+	if err := spec.Budgets.Check(objs); err != nil {
+		return fmt.Errorf("Environment '%s' is over budget:\n%v", envName, err)
+	}
+	return nil
+}
+
+// SelectObjects returns the objects among `objs` whose labels match
+// `selector`. Budgets are checked before selecting, since they limit what the
+// environment renders as a whole.
+func SelectObjects(objs []*unstructured.Unstructured, selector labels.Selector) []*unstructured.Unstructured {
+	if selector.Empty() {
+		return objs
+	}
+
+	selected := []*unstructured.Unstructured{}
+	for _, obj := range objs {
+		if selector.Matches(labels.Set(obj.GetLabels())) {
+			selected = append(selected, obj)
+		}
+	}
+	log.Debugf("Label selector '%s' matches %d of %d objects", selector, len(selected), len(objs))
+	return selected
+}
+
+// jsonnetIdentifier matches the component names that can be used as Jsonnet
+// field names without quoting, unless they are among `jsonnetKeywords`.
+var jsonnetIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var jsonnetKeywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true,
+	"function": true, "if": true, "import": true, "importstr": true, "in": true,
+	"local": true, "null": true, "self": true, "super": true, "tailstrict": true,
+	"then": true, "true": true,
+}
+
+// JsonnetField returns the Jsonnet field name `name`, quoted if it is not an
+// identifier (e.g., 'guestbook-ui', or the keyword 'local').
+func JsonnetField(name string) string {
+	if !jsonnetIdentifier.MatchString(name) || jsonnetKeywords[name] {
+		return fmt.Sprintf("%q", name)
+	}
+	return name
+}
+
+// componentKey returns the name under which the component at `p` is labelled,
+// and keyed in the components of `app.yaml`: its file name without the
+// extension, so that 'components/backend/api.jsonnet' is 'api'.
+func componentKey(p string) string {
+	return strings.TrimSuffix(path.Base(p), path.Ext(p))
+}
+
+// ComponentsObj constructs the Jsonnet object of an environment's components
+// (i.e., the external code `ComponentsExtCodeKey`), mapping the name of each
+// Jsonnet component among `paths` to its import, with the mixins of the
+// component in `mixins` merged onto it (see `ComponentExpr`). For example,
+//
+//	{
+//	   foo: import "components/foo.jsonnet"
+//	}
+func ComponentsObj(paths []string, mixins map[string][]string) string {
+	var obj bytes.Buffer
+	obj.WriteString("{\n")
+	for _, p := range paths {
+		ext := path.Ext(p)
+		if ext != ".jsonnet" {
+			continue
+		}
+
+		name := componentKey(p)
+		fmt.Fprintf(&obj, "  %s: %s,\n", JsonnetField(name), ComponentExpr(p, mixins[name]))
+	}
+	obj.WriteString("}\n")
+	return obj.String()
+}
@@ -0,0 +1,358 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestRenderComponent(t *testing.T) {
+	// Jsonnet reads components from disk, so the app must be on the real
+	// filesystem.
+	dir, err := ioutil.TempDir("", "ks-render")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir:\n%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	osFS := afero.NewOsFs()
+	swaggerPath := filepath.Join(dir, "swagger.json")
+	if err := afero.WriteFile(osFS, swaggerPath, []byte(blankSwaggerData), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write API specification:\n%v", err)
+	}
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", swaggerPath), osFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec:\n%v", err)
+	}
+
+	m, err := initManager(context.Background(), AbsPath(filepath.Join(dir, "app")), spec, &mockAPIServerURI, &mockNamespace, osFS)
+	if err != nil {
+		t.Fatalf("Failed to init app:\n%v", err)
+	}
+
+	libText := `{name: "guestbook"}`
+	if err := afero.WriteFile(osFS, string(appendToAbsPath(m.libPath, "names.libsonnet")), []byte(libText), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write library:\n%v", err)
+	}
+
+	// Libraries listed in app.yaml are found, but do not shadow the app's own.
+	sharedDir := filepath.Join(dir, "shared")
+	if err := osFS.MkdirAll(sharedDir, defaultFolderPermissions); err != nil {
+		t.Fatalf("Failed to create shared library directory:\n%v", err)
+	}
+	sharedLibs := map[string]string{
+		"names.libsonnet": `{name: "shadowed"}`,
+		"tiers.libsonnet": `{web: "frontend"}`,
+	}
+	for name, text := range sharedLibs {
+		if err := afero.WriteFile(osFS, filepath.Join(sharedDir, name), []byte(text), defaultFilePermissions); err != nil {
+			t.Fatalf("Failed to write shared library:\n%v", err)
+		}
+	}
+	if err := afero.WriteFile(osFS, string(m.appYAMLPath), []byte("libPaths:\n- ../shared\n"), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+
+	componentText := `local names = import "names.libsonnet";
+local tiers = import "tiers.libsonnet";
+local capabilities = std.extVar("__ksonnet/capabilities");
+[
+  {apiVersion: "v1", kind: "Service", metadata: {name: names.name, labels: {tier: tiers.web}}},
+  {apiVersion: "v1", kind: "ConfigMap", metadata: {name: names.name, labels: {psp: std.toString(capabilities.hasPodSecurityPolicy), region: std.extVar("region")}}},
+]`
+	if err := m.CreateComponent("guestbook", componentText, "jsonnet"); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+	if err := m.SetEnvironment(defaultEnvName, &Environment{ExtVars: map[string]string{"region": "us-west-2"}}); err != nil {
+		t.Fatalf("Failed to set external variables:\n%v", err)
+	}
+
+	objs, err := m.RenderComponent(defaultEnvName, "guestbook", "")
+	if err != nil {
+		t.Fatalf("Failed to render component:\n%v", err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("Expected 2 objects, got %d", len(objs))
+	}
+	for _, obj := range objs {
+		if obj.GetName() != "guestbook" {
+			t.Errorf("Expected object named 'guestbook', got '%s'", obj.GetName())
+		}
+		if component := obj.GetLabels()["ksonnet.io/component"]; component != "guestbook" {
+			t.Errorf("Expected %s to be labeled with component 'guestbook', got '%s'", obj.GetKind(), component)
+		}
+	}
+	if tier := objs[0].GetLabels()["tier"]; tier != "frontend" {
+		t.Errorf("Expected shared library to be available to the component, got label tier='%s'", tier)
+	}
+	if psp := objs[1].GetLabels()["psp"]; psp != "false" {
+		t.Errorf("Expected capabilities to be available to the component, got label psp='%s'", psp)
+	}
+	if region := objs[1].GetLabels()["region"]; region != "us-west-2" {
+		t.Errorf("Expected the environment's external variables to be available to the component, got label region='%s'", region)
+	}
+
+	// Mixins are merged, in order, onto each object of the component.
+	mixins := map[string]string{
+		"ha.libsonnet":    `{metadata+: {labels+: {ha: "true", tier: "ha"}}}`,
+		"owner.libsonnet": `{metadata+: {labels+: {tier: "owned"}}}`,
+	}
+	for name, text := range mixins {
+		if err := afero.WriteFile(osFS, string(appendToAbsPath(m.libPath, name)), []byte(text), defaultFilePermissions); err != nil {
+			t.Fatalf("Failed to write mixin:\n%v", err)
+		}
+	}
+	appYAML := "libPaths:\n- ../shared\ncomponents:\n  guestbook:\n    mixins:\n    - lib/ha.libsonnet\n    - lib/owner.libsonnet\n"
+	if err := afero.WriteFile(osFS, string(m.appYAMLPath), []byte(appYAML), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+	objs, err = m.RenderComponent(defaultEnvName, "guestbook", "")
+	if err != nil {
+		t.Fatalf("Failed to render component with mixins:\n%v", err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("Expected 2 objects, got %d", len(objs))
+	}
+	for _, obj := range objs {
+		labels := obj.GetLabels()
+		if labels["ha"] != "true" || labels["tier"] != "owned" {
+			t.Errorf("Expected mixins to be merged in order onto %s, got labels %v", obj.GetKind(), labels)
+		}
+		if labels["ksonnet.io/component"] != "guestbook" {
+			t.Errorf("Expected %s to be labeled with component 'guestbook', got '%s'", obj.GetKind(), labels["ksonnet.io/component"])
+		}
+	}
+
+	// Mixins are merged onto the items of a List, and onto the objects of an
+	// object of objects, rather than onto the List or object itself.
+	listText := `{
+  apiVersion: "v1",
+  kind: "List",
+  items: [
+    {apiVersion: "v1", kind: "ServiceAccount", metadata: {name: "system"}},
+    {apiVersion: "rbac.authorization.k8s.io/v1beta1", kind: "ClusterRole", metadata: {name: "system"}},
+  ],
+}`
+	if err := m.CreateComponent("system", listText, "jsonnet"); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+	nestedText := `{
+  web: {apiVersion: "v1", kind: "Service", metadata: {name: "web"}},
+  db: {config: {apiVersion: "v1", kind: "ConfigMap", metadata: {name: "db"}}},
+}`
+	if err := m.CreateComponent("nested", nestedText, "jsonnet"); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+	appYAML = "components:\n  system:\n    mixins:\n    - lib/ha.libsonnet\n  nested:\n    mixins:\n    - lib/ha.libsonnet\n"
+	if err := afero.WriteFile(osFS, string(m.appYAMLPath), []byte(appYAML), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+	for _, component := range []string{"system", "nested"} {
+		objs, err = m.RenderComponent(defaultEnvName, component, "")
+		if err != nil {
+			t.Fatalf("Failed to render component '%s' with mixins:\n%v", component, err)
+		}
+		if len(objs) != 2 {
+			t.Fatalf("Expected 2 objects of component '%s', got %d", component, len(objs))
+		}
+		for _, obj := range objs {
+			if obj.GetLabels()["ha"] != "true" {
+				t.Errorf("Expected the mixin to be merged onto %s of component '%s', got labels %v", obj.GetKind(), component, obj.GetLabels())
+			}
+		}
+	}
+
+	if err := afero.WriteFile(osFS, string(m.appYAMLPath), []byte("components:\n  guestbook:\n    mixins:\n    - lib/missing.libsonnet\n"), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+	if _, err := m.RenderComponent(defaultEnvName, "guestbook", ""); err == nil {
+		t.Errorf("Expected rendering a component with a missing mixin to fail")
+	}
+
+	// The environment's overrides are merged onto the component, the budgets
+	// are checked, and the objects are selected by their labels.
+	if err := afero.WriteFile(osFS, string(m.appYAMLPath), []byte("libPaths:\n- ../shared\nbudgets:\n  maxObjects: 2\n"), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+	_, _, envComponentPath := m.LibPaths(defaultEnvName)
+	overrideText := `local components = std.extVar("__ksonnet/components");
+components + {
+  guestbook: [o + {metadata+: {labels+: {env: "default"}}} for o in super.guestbook],
+}
+`
+	if err := afero.WriteFile(osFS, string(envComponentPath), []byte(overrideText), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write environment overrides:\n%v", err)
+	}
+	objs, err = m.RenderComponent(defaultEnvName, "guestbook", "")
+	if err != nil {
+		t.Fatalf("Failed to render component with environment overrides:\n%v", err)
+	}
+	for _, obj := range objs {
+		if env := obj.GetLabels()["env"]; env != "default" {
+			t.Errorf("Expected the environment's overrides to be merged onto %s, got label env='%s'", obj.GetKind(), env)
+		}
+	}
+	objs, err = m.RenderComponent(defaultEnvName, "guestbook", "tier=frontend")
+	if err != nil {
+		t.Fatalf("Failed to render component with a label selector:\n%v", err)
+	}
+	if len(objs) != 1 || objs[0].GetKind() != "Service" {
+		t.Errorf("Expected the label selector to select the Service, got %d object(s)", len(objs))
+	}
+	if _, err := m.RenderComponent(defaultEnvName, "guestbook", "tier in (frontend"); err == nil {
+		t.Errorf("Expected rendering with an invalid label selector to fail")
+	}
+	if err := afero.WriteFile(osFS, string(m.appYAMLPath), []byte("libPaths:\n- ../shared\nbudgets:\n  maxObjects: 1\n"), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+	if _, err := m.RenderComponent(defaultEnvName, "guestbook", ""); err == nil || !strings.Contains(err.Error(), "over budget") {
+		t.Errorf("Expected rendering a component over budget to fail, got %v", err)
+	}
+	if err := afero.WriteFile(osFS, string(m.appYAMLPath), nil, defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write app.yaml:\n%v", err)
+	}
+
+	// Components the environment does not target are not rendered.
+	if err := m.SetEnvironmentTargets(defaultEnvName, []string{"system"}); err != nil {
+		t.Fatalf("Failed to set targets:\n%v", err)
+	}
+	if _, err := m.RenderComponent(defaultEnvName, "guestbook", ""); err == nil {
+		t.Errorf("Expected rendering a component the environment does not target to fail")
+	}
+
+	if _, err := m.RenderComponent(defaultEnvName, "missing", ""); err == nil {
+		t.Errorf("Expected rendering a missing component to fail")
+	}
+	if _, err := m.RenderComponent("missing", "guestbook", ""); err == nil {
+		t.Errorf("Expected rendering in a missing environment to fail")
+	}
+}
+
+func TestComponentsObj(t *testing.T) {
+	tests := []struct {
+		inputPaths []string
+		expected   string
+	}{
+		// test simple case with 1 .jsonnet path
+		{
+			[]string{
+				"some/fake/path/foo.jsonnet",
+			},
+			`{
+  foo: import "some/fake/path/foo.jsonnet",
+}
+`,
+		},
+		// test multiple .jsonnet path case
+		{
+			[]string{
+				"some/fake/path/foo.jsonnet",
+				"another/fake/path/bar.jsonnet",
+			},
+			`{
+  foo: import "some/fake/path/foo.jsonnet",
+  bar: import "another/fake/path/bar.jsonnet",
+}
+`,
+		},
+		// test zero path case
+		{
+			[]string{},
+			`{
+}
+`,
+		},
+		// test names that are not identifiers
+		{
+			[]string{
+				"some/fake/path/guestbook-ui.jsonnet",
+				"some/fake/path/local.jsonnet",
+			},
+			`{
+  "guestbook-ui": import "some/fake/path/guestbook-ui.jsonnet",
+  "local": import "some/fake/path/local.jsonnet",
+}
+`,
+		},
+		// test non-jsonnet extension case
+		{
+			[]string{
+				"some/fake/path/foo.libsonnet",
+				"another/fake/path/bar.jsonnet",
+			},
+			`{
+  bar: import "another/fake/path/bar.jsonnet",
+}
+`,
+		},
+	}
+
+	for _, s := range tests {
+		res := ComponentsObj(s.inputPaths, nil)
+		if res != s.expected {
+			t.Errorf("Wrong object constructed\n  expected: %v\n  got: %v", s.expected, res)
+		}
+	}
+}
+
+func TestSelectObjects(t *testing.T) {
+	newObj := func(name string, objLabels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+		obj.SetName(name)
+		obj.SetLabels(objLabels)
+		return obj
+	}
+	objs := []*unstructured.Unstructured{
+		newObj("guestbook-ui", map[string]string{"app": "guestbook", "tier": "frontend"}),
+		newObj("guestbook-db", map[string]string{"app": "guestbook"}),
+		newObj("redis", map[string]string{"app": "redis"}),
+		newObj("unlabeled", nil),
+	}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{"", []string{"guestbook-ui", "guestbook-db", "redis", "unlabeled"}},
+		{"app=guestbook", []string{"guestbook-ui", "guestbook-db"}},
+		{"app=guestbook,!tier", []string{"guestbook-db"}},
+		{"app notin (guestbook)", []string{"redis", "unlabeled"}},
+	}
+
+	for _, test := range tests {
+		selector, err := labels.Parse(test.selector)
+		if err != nil {
+			t.Fatalf("Failed to parse selector '%s': %v", test.selector, err)
+		}
+		names := []string{}
+		for _, obj := range SelectObjects(objs, selector) {
+			names = append(names, obj.GetName())
+		}
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("Expected selector '%s' to select %v, got %v", test.selector, test.expected, names)
+		}
+	}
+}
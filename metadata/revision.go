@@ -0,0 +1,171 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// gitShow returns the contents of the file at `path` (relative to `dir`) in
+// the git revision `ref` of the repository containing `dir`, and whether the
+// file exists in that revision at all. It is a variable so that it can be
+// replaced in tests.
+var gitShow = func(dir, ref, path string) ([]byte, bool, error) {
+	if err := gitVerifyRevision(dir, ref); err != nil {
+		return nil, false, err
+	}
+
+	out, err := exec.Command("git", "-C", dir, "ls-tree", "--name-only", ref, "--", path).CombinedOutput()
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to look up '%s' in git revision '%s':\n%s", path, ref, strings.TrimSpace(string(out)))
+	}
+	if strings.TrimSpace(string(out)) == "" {
+		return nil, false, nil
+	}
+
+	data, err := exec.Command("git", "-C", dir, "show", ref+":./"+filepath.ToSlash(path)).Output()
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to read '%s' from git revision '%s': %v", path, ref, err)
+	}
+	return data, true, nil
+}
+
+// gitChanges returns the paths (relative to `dir`) of the files under `dir`
+// that differ from the git revision `ref` of the repository containing `dir`,
+// whether the changes are committed or not, as well as the files git does not
+// track (and does not ignore). It is a variable so that it can be replaced in
+// tests.
+var gitChanges = func(dir, ref string) ([]string, error) {
+	if err := gitVerifyRevision(dir, ref); err != nil {
+		return nil, err
+	}
+
+	diff, err := exec.Command("git", "-C", dir, "diff", "--name-only", "--relative", ref, "--").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compare '%s' with git revision '%s':\n%s", dir, ref, strings.TrimSpace(string(diff)))
+	}
+	untracked, err := exec.Command("git", "-C", dir, "ls-files", "--others", "--exclude-standard").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list the untracked files of '%s':\n%s", dir, strings.TrimSpace(string(untracked)))
+	}
+
+	paths := []string{}
+	for _, line := range strings.Split(string(diff)+"\n"+string(untracked), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+// gitVerifyRevision returns an error if `ref` is not a commit of the git
+// repository containing `dir`.
+func gitVerifyRevision(dir, ref string) error {
+	if out, err := exec.Command("git", "-C", dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}").CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("Failed to look up git revision '%s' of '%s':\n%s", ref, dir, msg)
+		}
+		return fmt.Errorf("'%s' is not a revision of the git repository at '%s'", ref, dir)
+	}
+	return nil
+}
+
+// CopyAppAtRevision copies the application to `dst`, replacing each of the
+// files `paths` with its contents in the git revision `ref` (or removing it,
+// if it did not exist then). Rendering the copy shows how the application
+// rendered before the files were changed. The '.git' directory is not copied.
+//
+// Jsonnet files may import files of the application by absolute path (e.g.,
+// the overrides of environments import 'environments/base.libsonnet' that
+// way), so such imports are rewritten to the copy.
+func (m *manager) CopyAppAtRevision(dst AbsPath, ref string, paths []AbsPath) error {
+	root := string(m.rootPath)
+	copyFile := func(target string, data []byte, perm os.FileMode) error {
+		if ext := filepath.Ext(target); ext == ".jsonnet" || ext == ".libsonnet" {
+			data = rewriteAbsImports(data, root, string(dst))
+		}
+		return afero.WriteFile(m.appFS, target, data, perm)
+	}
+
+	for _, p := range paths {
+		rel, err := filepath.Rel(root, string(p))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("'%s' is not part of the application at '%s'", p, root)
+		}
+	}
+
+	err := afero.Walk(m.appFS, root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		target := string(dst) + strings.TrimPrefix(p, root)
+		if info.IsDir() {
+			return m.appFS.MkdirAll(target, defaultFolderPermissions)
+		}
+		data, err := afero.ReadFile(m.appFS, p)
+		if err != nil {
+			return err
+		}
+		return copyFile(target, data, info.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		rel, _ := filepath.Rel(root, string(p))
+		target := filepath.Join(string(dst), rel)
+
+		data, exists, err := gitShow(root, ref, rel)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := m.appFS.RemoveAll(target); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := m.appFS.MkdirAll(filepath.Dir(target), defaultFolderPermissions); err != nil {
+			return err
+		}
+		if err := copyFile(target, data, defaultFilePermissions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteAbsImports rewrites the imports in the Jsonnet `data` of files under
+// the directory `from` (by absolute path) to the same files under `to`.
+func rewriteAbsImports(data []byte, from, to string) []byte {
+	pattern := regexp.MustCompile(`\bimport(str)?\s*(["'])` + regexp.QuoteMeta(from) + `/`)
+	return pattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		prefix := match[:len(match)-len(from)-1]
+		return []byte(string(prefix) + to + "/")
+	})
+}
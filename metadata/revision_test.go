@@ -0,0 +1,89 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCopyAppAtRevision(t *testing.T) {
+	m := mockEnvironments(t, "/test-copy-app-at-revision")
+
+	write := func(path, data string) {
+		if err := afero.WriteFile(testFS, path, []byte(data), defaultFilePermissions); err != nil {
+			t.Fatalf("Failed to write '%s':\n%v", path, err)
+		}
+	}
+	write("/test-copy-app-at-revision/components/redis.jsonnet", "changed")
+	write("/test-copy-app-at-revision/components/new.jsonnet", "new")
+	write("/test-copy-app-at-revision/.git/HEAD", "ref: refs/heads/master")
+	write("/test-copy-app-at-revision/environments/prod/prod.jsonnet", `local base = import "/test-copy-app-at-revision/environments/base.libsonnet";
+local other = import "/test-copy-app-at-revision-other/lib.libsonnet";
+base + {notes: importstr '/test-copy-app-at-revision/README'}`)
+
+	savedGitShow := gitShow
+	defer func() { gitShow = savedGitShow }()
+	gitShow = func(dir, ref, path string) ([]byte, bool, error) {
+		if dir != "/test-copy-app-at-revision" || ref != "HEAD" {
+			return nil, false, fmt.Errorf("Unexpected repository '%s' or revision '%s'", dir, ref)
+		}
+		switch path {
+		case "components/redis.jsonnet":
+			return []byte("original"), true, nil
+		case "components/new.jsonnet":
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("Unexpected path '%s'", path)
+	}
+
+	dst := AbsPath("/test-copy-app-at-revision-baseline")
+	paths := []AbsPath{
+		"/test-copy-app-at-revision/components/redis.jsonnet",
+		"/test-copy-app-at-revision/components/new.jsonnet",
+	}
+	if err := m.CopyAppAtRevision(dst, "HEAD", paths); err != nil {
+		t.Fatalf("Failed to copy application:\n%v", err)
+	}
+
+	data, err := afero.ReadFile(testFS, "/test-copy-app-at-revision-baseline/components/redis.jsonnet")
+	if err != nil || string(data) != "original" {
+		t.Errorf("Expected the changed file to be replaced by its original, got '%s' (%v)", data, err)
+	}
+	testDirNotExists(t, "/test-copy-app-at-revision-baseline/.git")
+	if exists, _ := afero.Exists(testFS, "/test-copy-app-at-revision-baseline/components/new.jsonnet"); exists {
+		t.Errorf("Expected the file added since the revision to be left out")
+	}
+	if exists, _ := afero.Exists(testFS, "/test-copy-app-at-revision-baseline/environments/base.libsonnet"); !exists {
+		t.Errorf("Expected the rest of the application to be copied")
+	}
+
+	// Absolute imports of files of the application import those of the copy.
+	data, err = afero.ReadFile(testFS, "/test-copy-app-at-revision-baseline/environments/prod/prod.jsonnet")
+	expected := `local base = import "/test-copy-app-at-revision-baseline/environments/base.libsonnet";
+local other = import "/test-copy-app-at-revision-other/lib.libsonnet";
+base + {notes: importstr '/test-copy-app-at-revision-baseline/README'}`
+	if err != nil || string(data) != expected {
+		t.Errorf("Expected the imports of the copied overrides to be rewritten to\n%s\ngot\n%s (%v)", expected, data, err)
+	}
+
+	err = m.CopyAppAtRevision("/elsewhere", "HEAD", []AbsPath{"/outside/file.jsonnet"})
+	if err == nil {
+		t.Errorf("Expected copying with a file outside the application to fail")
+	}
+}
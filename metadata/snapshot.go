@@ -0,0 +1,141 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+const (
+	snapshotsDir = "snapshots"
+
+	// snapshotIDFormat is the time format used for snapshot IDs. It sorts
+	// chronologically, and is safe to use in file names.
+	snapshotIDFormat = "20060102T150405.000Z"
+)
+
+// Snapshot records the set of objects applied to an environment by one run of
+// `ks apply`.
+type Snapshot struct {
+	ID        string           `json:"id"`
+	Env       string           `json:"env"`
+	Timestamp time.Time        `json:"timestamp"`
+	Objects   []SnapshotObject `json:"objects"`
+}
+
+// SnapshotObject identifies an object in a snapshot, along with a hash of its
+// contents, so that snapshots can be compared without storing every object.
+type SnapshotObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Hash       string `json:"hash"`
+}
+
+// Key returns a string that uniquely identifies the object (but not its
+// contents) within a snapshot.
+func (o SnapshotObject) Key() string {
+	return strings.Join([]string{o.APIVersion, o.Kind, o.Namespace, o.Name}, "/")
+}
+
+func (m *manager) snapshotsPath(envName string) AbsPath {
+	return appendToAbsPath(m.ksonnetPath, snapshotsDir, envName)
+}
+
+func (m *manager) SaveSnapshot(snapshot *Snapshot) error {
+	if snapshot.ID == "" {
+		snapshot.ID = snapshot.Timestamp.UTC().Format(snapshotIDFormat)
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dirPath := m.snapshotsPath(snapshot.Env)
+	if err := m.appFS.MkdirAll(string(dirPath), defaultFolderPermissions); err != nil {
+		return err
+	}
+
+	snapshotPath := appendToAbsPath(dirPath, snapshot.ID+".json")
+	log.Debugf("Writing snapshot of environment '%s' to '%s'", snapshot.Env, snapshotPath)
+	return afero.WriteFile(m.appFS, string(snapshotPath), data, defaultFilePermissions)
+}
+
+func (m *manager) GetSnapshots(envName string) ([]*Snapshot, error) {
+	dirPath := string(m.snapshotsPath(envName))
+
+	exists, err := afero.DirExists(m.appFS, dirPath)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return []*Snapshot{}, nil
+	}
+
+	infos, err := afero.ReadDir(m.appFS, dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []*Snapshot{}
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".json" {
+			continue
+		}
+
+		snapshot, err := m.readSnapshot(filepath.Join(dirPath, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID < snapshots[j].ID })
+	return snapshots, nil
+}
+
+func (m *manager) GetSnapshot(envName, id string) (*Snapshot, error) {
+	snapshotPath := string(appendToAbsPath(m.snapshotsPath(envName), id+".json"))
+
+	snapshot, err := m.readSnapshot(snapshotPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Environment '%s' has no snapshot '%s'", envName, id)
+	}
+	return snapshot, err
+}
+
+func (m *manager) readSnapshot(p string) (*Snapshot, error) {
+	data, err := afero.ReadFile(m.appFS, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("Failed to parse snapshot at '%s':\n%v", p, err)
+	}
+	return &snapshot, nil
+}
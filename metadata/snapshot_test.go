@@ -0,0 +1,67 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshots(t *testing.T) {
+	m := mockEnvironments(t, "/snapshots")
+
+	t0 := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, name := range []string{"first", "second"} {
+		snapshot := &Snapshot{
+			Env:       mockEnvName,
+			Timestamp: t0.Add(time.Duration(i) * time.Minute),
+			Objects:   []SnapshotObject{{APIVersion: "v1", Kind: "Pod", Name: name, Hash: "abc"}},
+		}
+		if err := m.SaveSnapshot(snapshot); err != nil {
+			t.Fatalf("Failed to save snapshot:\n%v", err)
+		}
+	}
+
+	snapshots, err := m.GetSnapshots(mockEnvName)
+	if err != nil {
+		t.Fatalf("Failed to list snapshots:\n%v", err)
+	} else if len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %d", len(snapshots))
+	}
+
+	expectedID := "20171001T120100.000Z"
+	if snapshots[1].ID != expectedID || snapshots[1].Objects[0].Name != "second" {
+		t.Errorf("Expected latest snapshot to be '%s', got '%s'", expectedID, snapshots[1].ID)
+	}
+
+	snapshot, err := m.GetSnapshot(mockEnvName, expectedID)
+	if err != nil {
+		t.Errorf("Failed to get snapshot '%s':\n%v", expectedID, err)
+	} else if !snapshot.Timestamp.Equal(t0.Add(time.Minute)) {
+		t.Errorf("Expected snapshot timestamp '%s', got '%s'", t0.Add(time.Minute), snapshot.Timestamp)
+	}
+
+	if _, err := m.GetSnapshot(mockEnvName, "missing"); err == nil {
+		t.Errorf("Expected getting nonexistent snapshot to fail")
+	}
+
+	snapshots, err = m.GetSnapshots(mockEnvName2)
+	if err != nil {
+		t.Errorf("Failed to list snapshots:\n%v", err)
+	} else if len(snapshots) != 0 {
+		t.Errorf("Expected no snapshots for environment '%s', got %d", mockEnvName2, len(snapshots))
+	}
+}
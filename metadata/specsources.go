@@ -0,0 +1,133 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// specVersionRef is replaced by the Kubernetes version (e.g., `v1.7.0`) in
+	// the URLs of `SpecSourcesSpec.Mirrors`.
+	specVersionRef = "{version}"
+
+	defaultSpecRetries = 2
+)
+
+// SpecSourcesSpec configures where the OpenAPI specifications of Kubernetes
+// versions (e.g., for `--api-spec=version:v1.7.0`) are retrieved from, so
+// that generating ksonnet-lib works behind unreliable proxies, or without
+// access to GitHub. For example, in `app.yaml`:
+//
+//	specSources:
+//	  mirrors:
+//	  - https://artifacts.example.com/kubernetes/{version}/swagger.json
+//	  retries: 3
+//	  checksums:
+//	    v1.7.0: 4c2f6d1d0c7e...
+//	  platforms:
+//	    openshift:
+//	    - https://artifacts.example.com/openshift/{version}/openapi.json
+type SpecSourcesSpec struct {
+	// Mirrors are the URLs tried, in order, before the upstream Kubernetes
+	// repository. In each, `{version}` stands for the Kubernetes version.
+	Mirrors []string `json:"mirrors,omitempty"`
+	// Retries is the number of times a URL is retried after a network error
+	// or server error, before the next URL is tried. Defaults to 2.
+	Retries *int `json:"retries,omitempty"`
+	// Checksums maps Kubernetes versions (or the URLs of the specifications
+	// in `Platforms`) to the hex-encoded SHA-256 hashes of their
+	// specifications. A specification that does not match is rejected, and
+	// the next URL is tried.
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// Platforms maps platforms (e.g., `openshift`) to the URLs of
+	// specifications of their own API groups, which are merged into the
+	// Kubernetes specification of versions of the platform (e.g.,
+	// `openshift-4.12`). In each, `{version}` stands for the platform's
+	// release (e.g., `4.12`).
+	Platforms map[string][]string `json:"platforms,omitempty"`
+}
+
+// urls returns the URLs that the specification of the Kubernetes version
+// `k8sVersion` is retrieved from, in order.
+func (ss *SpecSourcesSpec) urls(k8sVersion string) []string {
+	urls := []string{}
+	if ss != nil {
+		for _, mirror := range ss.Mirrors {
+			urls = append(urls, strings.Replace(mirror, specVersionRef, k8sVersion, -1))
+		}
+	}
+	return append(urls, fmt.Sprintf(k8sVersionURLTemplate, k8sVersion))
+}
+
+// platformURLs returns the URLs of the specifications of the API groups of
+// the release `release` of the platform `platform`.
+func (ss *SpecSourcesSpec) platformURLs(platform, release string) []string {
+	urls := []string{}
+	if ss != nil {
+		for _, u := range ss.Platforms[platform] {
+			urls = append(urls, strings.Replace(u, specVersionRef, release, -1))
+		}
+	}
+	return urls
+}
+
+// retries returns the number of times each URL is retried.
+func (ss *SpecSourcesSpec) retries() int {
+	if ss == nil || ss.Retries == nil {
+		return defaultSpecRetries
+	}
+	return *ss.Retries
+}
+
+// verify returns an error if `data` is not the specification recorded in
+// `Checksums` for `key`, a Kubernetes version or the URL of a platform's
+// specification. Keys without a recorded checksum are not verified.
+func (ss *SpecSourcesSpec) verify(key string, data []byte) error {
+	if ss == nil {
+		return nil
+	}
+	expected, ok := ss.Checksums[key]
+	if !ok {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("OpenAPI schema for cluster version '%s' has SHA-256 hash '%s', but '%s' was expected", key, actual, expected)
+	}
+	return nil
+}
+
+// configureClusterSpec applies the `specSources` of `app.yaml` to `spec`, if
+// it is retrieved by Kubernetes version.
+func (m *manager) configureClusterSpec(spec ClusterSpec) error {
+	versionSpec, ok := spec.(*clusterSpecVersion)
+	if !ok {
+		return nil
+	}
+	appSpec, err := m.AppSpec()
+	if err != nil {
+		return err
+	}
+	if appSpec.SpecSources != nil && appSpec.SpecSources.Retries != nil && *appSpec.SpecSources.Retries < 0 {
+		return fmt.Errorf("'specSources.retries' in app.yaml must not be negative")
+	}
+	versionSpec.sources = appSpec.SpecSources
+	return nil
+}
@@ -0,0 +1,386 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/parser"
+	"github.com/spf13/afero"
+)
+
+// ComponentPieces is the Jsonnet of a component, broken up into the pieces
+// that `SplitComponent` can replace it with.
+type ComponentPieces struct {
+	// Source is the Jsonnet of the component.
+	Source string
+	// Shared is the Jsonnet of the library holding the top-level locals of the
+	// component, for the pieces to import as `<component>.libsonnet`, or the
+	// empty string if the component has no top-level locals.
+	Shared string
+	// Pieces are the elements of the array, or the fields of the object, that
+	// the component evaluates to, in order.
+	Pieces []*ComponentPiece
+}
+
+// ComponentPiece is the Jsonnet of a top-level element of a component.
+type ComponentPiece struct {
+	// Key is the name of the field the piece is the value of, or the empty
+	// string if the piece is an array element.
+	Key string
+	// Source is the Jsonnet of a component made of the piece alone, which
+	// imports the locals it may refer to from the shared library.
+	Source string
+	// Snippet is the Jsonnet of the piece with the locals it may refer to
+	// defined inline, which evaluates to the same as `Source` (relative to the
+	// original component), but without the shared library.
+	Snippet string
+}
+
+// ComponentPieces parses the Jsonnet component `name`, and breaks it up into
+// the elements of the array, or the fields of the object, it evaluates to. The
+// locals the component defines before its array or object are shared by every
+// piece, so that abstractions (e.g., an image used by several objects) survive
+// the split.
+func (m *manager) ComponentPieces(name string) (*ComponentPieces, error) {
+	componentPath, err := m.componentFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Could not check whether component '%s' exists:\n\n%v", name, err)
+	} else if componentPath == "" {
+		return nil, fmt.Errorf("Component '%s' does not exist", name)
+	} else if filepath.Ext(componentPath) == ".yaml" {
+		return nil, fmt.Errorf("Component '%s' is YAML; convert it to Jsonnet with 'ks convert' before splitting it", name)
+	}
+
+	text, err := afero.ReadFile(m.appFS, componentPath)
+	if err != nil {
+		return nil, err
+	}
+	source := string(text)
+
+	tokens, err := parser.Lex(componentPath, source)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parser.Parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each `local` of the component (and the locals of its object, if it
+	// evaluates to one) is kept as a single statement, since the binds of a
+	// statement may refer to each other.
+	statements := []ast.LocalBinds{}
+	for {
+		local, ok := root.(*ast.Local)
+		if !ok {
+			break
+		}
+		statements = append(statements, local.Binds)
+		root = local.Body
+	}
+
+	var pieces []*ComponentPiece
+	var objectLocals ast.LocalBinds
+	switch body := root.(type) {
+	case *ast.Array:
+		for _, element := range body.Elements {
+			pieces = append(pieces, &ComponentPiece{Source: jsonnetSource(source, element)})
+		}
+	case *ast.Object:
+		for _, field := range body.Fields {
+			var key string
+			switch field.Kind {
+			case ast.ObjectLocal:
+				objectLocals = append(objectLocals, ast.LocalBind{Variable: *field.Id, Body: field.Expr2, FunctionSugar: field.MethodSugar, Params: field.Ids})
+				continue
+			case ast.ObjectFieldID:
+				key = string(*field.Id)
+			case ast.ObjectFieldStr:
+				if s, ok := field.Expr1.(*ast.LiteralString); ok {
+					key = s.Value
+					break
+				}
+				fallthrough
+			default:
+				return nil, fmt.Errorf("Component '%s' has a top-level field that is not a plain name or string, at %s; it cannot be split", name, field.Expr2.Loc())
+			}
+			if field.Hide != ast.ObjectFieldInherit || field.SuperSugar || field.MethodSugar {
+				return nil, fmt.Errorf("Component '%s' has a hidden, '+:', or method field '%s'; it cannot be split", name, key)
+			}
+			pieces = append(pieces, &ComponentPiece{Key: key, Source: jsonnetSource(source, field.Expr2)})
+		}
+		if len(objectLocals) > 0 {
+			statements = append(statements, objectLocals)
+		}
+	default:
+		return nil, fmt.Errorf("Component '%s' does not evaluate to an array or object literal, after its top-level locals; it cannot be split", name)
+	}
+	if len(pieces) < 2 {
+		return nil, fmt.Errorf("Component '%s' has %d top-level element(s); there is nothing to split", name, len(pieces))
+	}
+
+	// Locals are imported relative to the library, which lives in 'lib/'
+	// rather than 'components/'.
+	for _, binds := range statements {
+		for _, bind := range binds {
+			if p := relativeImport(bind.Body, filepath.Dir(componentPath), m.appFS); p != "" {
+				return nil, fmt.Errorf("Local '%s' of component '%s' imports '%s' relative to the component; it cannot be moved to a library", bind.Variable, name, p)
+			}
+		}
+	}
+
+	locals := []string{}
+	var inline, shared bytes.Buffer
+	for _, binds := range statements {
+		defs := []string{}
+		for _, bind := range binds {
+			locals = append(locals, string(bind.Variable))
+			def := string(bind.Variable)
+			if bind.FunctionSugar {
+				params := []string{}
+				for _, param := range bind.Params {
+					params = append(params, string(param))
+				}
+				def += "(" + strings.Join(params, ", ") + ")"
+			}
+			defs = append(defs, def+" = "+jsonnetSource(source, bind.Body))
+		}
+		statement := "local " + strings.Join(defs, ",\n  ") + ";\n"
+		inline.WriteString(statement)
+		shared.WriteString(statement)
+	}
+
+	result := &ComponentPieces{Source: source, Pieces: pieces}
+	var imports string
+	if len(locals) > 0 {
+		// The library is imported under a name that no local shadows.
+		lib := "shared"
+		for contains(locals, lib) {
+			lib += "_"
+		}
+
+		shared.WriteString("\n{\n")
+		imports = fmt.Sprintf("local %s = import \"%s.libsonnet\";\n", lib, name)
+		for _, local := range locals {
+			fmt.Fprintf(&shared, "  %s:: %s,\n", local, local)
+			imports += fmt.Sprintf("local %s = %s.%s;\n", local, lib, local)
+		}
+		shared.WriteString("}\n")
+		result.Shared = fmt.Sprintf("// Locals shared by the components split from component '%s'.\n%s", name, shared.String())
+		imports += "\n"
+	}
+
+	for _, piece := range pieces {
+		piece.Snippet = inline.String() + piece.Source + "\n"
+		piece.Source = fmt.Sprintf("// Split from component '%s'.\n%s%s\n", name, imports, piece.Source)
+	}
+	return result, nil
+}
+
+// contains returns whether `s` is among `list`.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonnetSource returns the text of `node` in `source`, the Jsonnet it was
+// parsed from.
+func jsonnetSource(source string, node ast.Node) string {
+	loc := node.Loc()
+	lines := strings.SplitAfter(source, "\n")
+	begin, end := jsonnetOffset(lines, loc.Begin), jsonnetOffset(lines, loc.End)
+
+	// The parser leaves the quotes out of the location of quoted strings,
+	// including those a node starts or ends with (e.g., 'name + "-ui"').
+	if begin > 0 && (source[begin-1] == '"' || source[begin-1] == '\'') {
+		begin--
+	}
+	if end < len(source) && (source[end] == '"' || source[end] == '\'') {
+		end++
+	}
+	return source[begin:end]
+}
+
+// jsonnetOffset returns the byte offset of the (1-based) line and column
+// `location` in the source split into `lines`. Columns count characters, not
+// bytes.
+func jsonnetOffset(lines []string, location ast.Location) int {
+	offset := 0
+	for i := 0; i < location.Line-1 && i < len(lines); i++ {
+		offset += len(lines[i])
+	}
+	if location.Line < 1 || location.Line > len(lines) {
+		return offset
+	}
+
+	column := 1
+	for i := range lines[location.Line-1] {
+		if column == location.Column {
+			return offset + i
+		}
+		column++
+	}
+	return offset + len(lines[location.Line-1])
+}
+
+// relativeImport returns the path of the first import in `node` that resolves
+// to a file in `dir`, or the empty string if there is none.
+func relativeImport(node ast.Node, dir string, fs afero.Fs) string {
+	found := ""
+	walkJsonnet(node, func(n ast.Node) bool {
+		var file string
+		switch i := n.(type) {
+		case *ast.Import:
+			file = i.File
+		case *ast.ImportStr:
+			file = i.File
+		default:
+			return found == ""
+		}
+		if found == "" && !filepath.IsAbs(file) {
+			if exists, err := afero.Exists(fs, filepath.Join(dir, file)); err == nil && exists {
+				found = file
+			}
+		}
+		return false
+	})
+	return found
+}
+
+var jsonnetNodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// walkJsonnet calls `f` with `node` and, for as long as `f` returns true, with
+// the nodes below it, depth first.
+func walkJsonnet(node ast.Node, f func(ast.Node) bool) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	if f(node) {
+		walkJsonnetValue(reflect.ValueOf(node).Elem(), f)
+	}
+}
+
+func walkJsonnetValue(v reflect.Value, f func(ast.Node) bool) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() || !v.CanInterface() {
+			return
+		}
+		if node, ok := v.Interface().(ast.Node); ok {
+			walkJsonnet(node, f)
+		} else if v.Kind() == reflect.Ptr {
+			walkJsonnetValue(v.Elem(), f)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			walkJsonnetValue(v.Field(i), f)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkJsonnetValue(v.Index(i), f)
+		}
+	}
+}
+
+// componentReferences returns the files among the environments' overrides
+// (and 'environments/base.libsonnet') that refer to the component `name`,
+// e.g., to merge a mixin onto it, and the environments that map it to a
+// namespace or cluster, or target it.
+func (m *manager) componentReferences(name string) ([]string, error) {
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []string{}
+	files := []AbsPath{m.baseLibsonnetPath}
+	for _, env := range envs {
+		files = append(files, m.overridePath(env.Name))
+
+		_, namespaced := env.ComponentNamespaces[name]
+		_, served := env.ComponentServers[name]
+		if namespaced || served || contains(env.Targets, name) {
+			refs = append(refs, fmt.Sprintf("environment '%s'", env.Name))
+		}
+	}
+
+	for _, p := range files {
+		exists, err := afero.Exists(m.appFS, string(p))
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			continue
+		}
+		text, err := afero.ReadFile(m.appFS, string(p))
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := parser.Lex(string(p), string(text))
+		if err != nil {
+			return nil, err
+		}
+		root, err := parser.Parse(tokens)
+		if err != nil {
+			return nil, err
+		}
+		if refersTo(root, name) {
+			rel, err := filepath.Rel(string(m.rootPath), string(p))
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, fmt.Sprintf("'%s'", rel))
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// refersTo returns whether `node` has a field named `name`, or indexes a
+// field named `name`.
+func refersTo(node ast.Node, name string) bool {
+	found := false
+	isName := func(n ast.Node) bool {
+		s, ok := n.(*ast.LiteralString)
+		return ok && s.Value == name
+	}
+	walkJsonnet(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Index:
+			if (n.Id != nil && string(*n.Id) == name) || isName(n.Index) {
+				found = true
+			}
+		case *ast.Object:
+			for _, field := range n.Fields {
+				if (field.Kind == ast.ObjectFieldID && string(*field.Id) == name) || (field.Kind == ast.ObjectFieldStr && isName(field.Expr1)) {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,261 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/prototype"
+)
+
+func TestComponentPieces(t *testing.T) {
+	m := mockEnvironments(t, "/componentPieces")
+
+	componentText := `// The guestbook.
+local image = "gcr.io/heptio-images/ks-guestbook-demo:0.1";
+local labels(name) = {app: name},
+      port = 80;
+{
+  local replicas = 2,
+  service: {apiVersion: "v1", kind: "Service", metadata: {name: "ui", labels: labels("ui")}, spec: {ports: [{port: port}]}},
+  "deployment": {
+    apiVersion: "apps/v1beta1",
+    kind: "Deployment",
+    metadata: {name: "ui"},
+    spec: {replicas: replicas, template: {spec: {containers: [{image: image}]}}},
+  },
+}
+`
+	if err := m.CreateComponent("guestbook", componentText, prototype.Jsonnet); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+
+	pieces, err := m.ComponentPieces("guestbook")
+	if err != nil {
+		t.Fatalf("Failed to break up component:\n%v", err)
+	}
+	if pieces.Source != componentText {
+		t.Errorf("Expected the source of the component, got:\n%s", pieces.Source)
+	}
+
+	expectedShared := `// Locals shared by the components split from component 'guestbook'.
+local image = "gcr.io/heptio-images/ks-guestbook-demo:0.1";
+local labels(name) = {app: name},
+  port = 80;
+local replicas = 2;
+
+{
+  image:: image,
+  labels:: labels,
+  port:: port,
+  replicas:: replicas,
+}
+`
+	if pieces.Shared != expectedShared {
+		t.Errorf("Expected shared library:\n%s\ngot:\n%s", expectedShared, pieces.Shared)
+	}
+
+	imports := `local shared = import "guestbook.libsonnet";
+local image = shared.image;
+local labels = shared.labels;
+local port = shared.port;
+local replicas = shared.replicas;
+`
+	expected := []*ComponentPiece{
+		{
+			Key:    "service",
+			Source: "// Split from component 'guestbook'.\n" + imports + "\n" + `{apiVersion: "v1", kind: "Service", metadata: {name: "ui", labels: labels("ui")}, spec: {ports: [{port: port}]}}` + "\n",
+		},
+		{
+			Key: "deployment",
+			Source: "// Split from component 'guestbook'.\n" + imports + "\n" + `{
+    apiVersion: "apps/v1beta1",
+    kind: "Deployment",
+    metadata: {name: "ui"},
+    spec: {replicas: replicas, template: {spec: {containers: [{image: image}]}}},
+  }` + "\n",
+		},
+	}
+	if len(pieces.Pieces) != len(expected) {
+		t.Fatalf("Expected %d pieces, got %d", len(expected), len(pieces.Pieces))
+	}
+	for i, piece := range pieces.Pieces {
+		if piece.Key != expected[i].Key || piece.Source != expected[i].Source {
+			t.Errorf("Expected piece %d to be '%s':\n%s\ngot '%s':\n%s", i, expected[i].Key, expected[i].Source, piece.Key, piece.Source)
+		}
+		if !strings.HasPrefix(piece.Snippet, `local image = "gcr.io`) || !strings.HasSuffix(piece.Snippet, strings.TrimPrefix(expected[i].Source, "// Split from component 'guestbook'.\n"+imports+"\n")) {
+			t.Errorf("Expected piece %d to define the locals inline, got:\n%s", i, piece.Snippet)
+		}
+	}
+
+	// Components without locals need no library. Quoted strings at the edges
+	// of a piece are kept whole.
+	if err := m.CreateComponent("plain", `[{a: 1}, "b" + 'c']`, prototype.Jsonnet); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+	pieces, err = m.ComponentPieces("plain")
+	if err != nil {
+		t.Fatalf("Failed to break up component:\n%v", err)
+	}
+	if pieces.Shared != "" || len(pieces.Pieces) != 2 || pieces.Pieces[1].Source != "// Split from component 'plain'.\n\"b\" + 'c'\n" {
+		t.Errorf("Unexpected pieces of an array without locals: %q, %v", pieces.Shared, pieces.Pieces)
+	}
+
+	invalid := map[string]string{
+		"single":   `[{a: 1}]`,
+		"computed": `local base = {}; base + {a: {}, b: {}}`,
+		"hidden":   `{a: {}, b:: {}}`,
+		"relative": `local lib = import "plain.jsonnet"; {a: lib, b: {}}`,
+	}
+	for name, text := range invalid {
+		if err := m.CreateComponent(name, text, prototype.Jsonnet); err != nil {
+			t.Fatalf("Failed to create component:\n%v", err)
+		}
+		if _, err := m.ComponentPieces(name); err == nil {
+			t.Errorf("Expected component '%s' not to be split", name)
+		}
+	}
+	if _, err := m.ComponentPieces("missing"); err == nil {
+		t.Errorf("Expected breaking up a missing component to fail")
+	}
+}
+
+func TestComponentPiecesRender(t *testing.T) {
+	// Jsonnet reads components from disk, so the app must be on the real
+	// filesystem.
+	dir, err := ioutil.TempDir("", "ks-split")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir:\n%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	osFS := afero.NewOsFs()
+	swaggerPath := filepath.Join(dir, "swagger.json")
+	if err := afero.WriteFile(osFS, swaggerPath, []byte(blankSwaggerData), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write API specification:\n%v", err)
+	}
+	spec, err := parseClusterSpec(fmt.Sprintf("file:%s", swaggerPath), osFS)
+	if err != nil {
+		t.Fatalf("Failed to parse cluster spec:\n%v", err)
+	}
+	m, err := initManager(context.Background(), AbsPath(filepath.Join(dir, "app")), spec, &mockAPIServerURI, &mockNamespace, osFS)
+	if err != nil {
+		t.Fatalf("Failed to init app:\n%v", err)
+	}
+
+	componentText := `local name = "guestbook";
+local labels = {app: name, region: std.extVar("region")};
+[
+  {apiVersion: "v1", kind: "Service", metadata: {name: name, labels: labels}},
+  {apiVersion: "v1", kind: "ConfigMap", metadata: {name: name, labels: labels}},
+]`
+	if err := m.CreateComponent("guestbook", componentText, "jsonnet"); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+	if err := m.SetEnvironment(defaultEnvName, &Environment{ExtVars: map[string]string{"region": "us-west-2"}}); err != nil {
+		t.Fatalf("Failed to set external variables:\n%v", err)
+	}
+
+	pieces, err := m.ComponentPieces("guestbook")
+	if err != nil {
+		t.Fatalf("Failed to break up component:\n%v", err)
+	}
+	original, err := m.RenderComponent(defaultEnvName, "guestbook", "")
+	if err != nil {
+		t.Fatalf("Failed to render component:\n%v", err)
+	}
+	for i, piece := range pieces.Pieces {
+		objs, err := m.RenderComponentSource(defaultEnvName, "guestbook", piece.Snippet)
+		if err != nil {
+			t.Fatalf("Failed to render piece %d:\n%v", i, err)
+		}
+		if len(objs) != 1 || !reflect.DeepEqual(objs[0].Object, original[i].Object) {
+			t.Errorf("Expected piece %d to render %v, got %v", i, original[i].Object, objs)
+		}
+	}
+
+	// Once split, the new components render the same objects, importing the
+	// locals from the library.
+	parts := map[string]string{"guestbook-a": pieces.Pieces[0].Source, "guestbook-b": pieces.Pieces[1].Source}
+	if err := m.SplitComponent("guestbook", pieces.Shared, parts); err != nil {
+		t.Fatalf("Failed to split component:\n%v", err)
+	}
+	for i, name := range []string{"guestbook-a", "guestbook-b"} {
+		objs, err := m.RenderComponent(defaultEnvName, name, "")
+		if err != nil {
+			t.Fatalf("Failed to render component '%s':\n%v", name, err)
+		}
+		// Only the component label differs.
+		objs[0].SetLabels(original[i].GetLabels())
+		if !reflect.DeepEqual(objs[0].Object, original[i].Object) {
+			t.Errorf("Expected component '%s' to render %v, got %v", name, original[i].Object, objs[0].Object)
+		}
+	}
+}
+
+func TestComponentReferences(t *testing.T) {
+	m := mockEnvironments(t, "/componentReferences")
+
+	refs, err := m.componentReferences("guestbook")
+	if err != nil {
+		t.Fatalf("Failed to find references:\n%v", err)
+	}
+	// The generated overrides only mention components in comments.
+	if len(refs) != 0 {
+		t.Errorf("Expected no references, got %v", refs)
+	}
+
+	overrides := `local base = import "base.libsonnet";
+base + {
+  guestbook+: {replicas: 3},
+}
+`
+	if err := afero.WriteFile(testFS, string(m.overridePath(mockEnvName)), []byte(overrides), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write overrides:\n%v", err)
+	}
+	if err := m.SetEnvironment(mockEnvName2, &Environment{ComponentNamespaces: map[string]string{"guestbook": "web"}}); err != nil {
+		t.Fatalf("Failed to map component:\n%v", err)
+	}
+
+	refs, err = m.componentReferences("guestbook")
+	if err != nil {
+		t.Fatalf("Failed to find references:\n%v", err)
+	}
+	expected := []string{
+		fmt.Sprintf("'environments/%s/%s.jsonnet'", mockEnvName, path.Base(mockEnvName)),
+		fmt.Sprintf("environment '%s'", mockEnvName2),
+	}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected references %v, got %v", expected, refs)
+	}
+
+	if err := m.CreateComponent("guestbook", `[{}, {}]`, prototype.Jsonnet); err != nil {
+		t.Fatalf("Failed to create component:\n%v", err)
+	}
+	if err := m.SplitComponent("guestbook", "", map[string]string{"guestbook-a": "{}", "guestbook-b": "{}"}); err == nil {
+		t.Errorf("Expected splitting an overridden component to fail")
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// StatusProblem is a mismatch between the configuration of an application
+// (e.g., `app.yaml`) and what is actually on disk.
+type StatusProblem struct {
+	// Area is the part of the application the problem is in, e.g.,
+	// `environments/us-west/staging` or `app.yaml`.
+	Area    string `json:"area"`
+	Message string `json:"message"`
+}
+
+// Status checks the application for mismatches between its configuration
+// files and its directory structure, e.g., components configured in
+// `app.yaml` that have no file, or environments whose generated ksonnet-lib is
+// missing. `app.yaml` is also checked against version `ksVersion` of ks (see
+// `CheckVersion`). It only reads the application; problems are returned in a
+// stable order, rather than as an error.
+func (m *manager) Status(ksVersion string) ([]*StatusProblem, error) {
+	problems := []*StatusProblem{}
+	report := func(area, format string, args ...interface{}) {
+		problems = append(problems, &StatusProblem{Area: area, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if err := m.appYAMLStatus(ksVersion, report); err != nil {
+		return nil, err
+	}
+	if err := m.environmentsStatus(report); err != nil {
+		return nil, err
+	}
+	if err := m.pipelineStatus(report); err != nil {
+		return nil, err
+	}
+
+	lockExists, err := afero.Exists(m.appFS, string(appendToAbsPath(m.rootPath, lockFile)))
+	if err != nil {
+		return nil, err
+	} else if lockExists {
+		if err := m.VerifyChecksums(); err != nil {
+			report(lockFile, "%v", err)
+		}
+	}
+
+	return problems, nil
+}
+
+func (m *manager) appYAMLStatus(ksVersion string, report func(area, format string, args ...interface{})) error {
+	if err := m.CheckVersion(ksVersion); err != nil {
+		report(appYAMLFile, "%v", err)
+		return nil
+	}
+
+	spec, err := m.AppSpec()
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range spec.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		componentPath, err := m.componentFile(name)
+		if err != nil {
+			return err
+		} else if componentPath == "" {
+			report(appYAMLFile, "Component '%s' is configured, but there is no such component in '%s/'", name, componentsDir)
+		}
+	}
+
+	for _, p := range spec.LibPaths {
+		abs := p
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(string(m.rootPath), p)
+		}
+		exists, err := afero.DirExists(m.appFS, abs)
+		if err != nil {
+			return err
+		} else if !exists {
+			report(appYAMLFile, "Library path '%s' does not exist", p)
+		}
+	}
+
+	names = []string{}
+	for name := range spec.Credentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := m.GetEnvironment(name); err != nil {
+			report(appYAMLFile, "Credentials are configured for environment '%s', but there is no such environment", name)
+		} else if c := spec.Credentials[name]; c == nil || c.Provider == "" {
+			report(appYAMLFile, "Credentials of environment '%s' do not name a 'provider'", name)
+		}
+	}
+
+	if _, err := spec.Jsonnet.Limits(); err != nil {
+		report(appYAMLFile, "%v", err)
+	}
+	if err := spec.Budgets.Check(nil); err != nil {
+		report(appYAMLFile, "%v", err)
+	}
+
+	return nil
+}
+
+func (m *manager) environmentsStatus(report func(area, format string, args ...interface{})) error {
+	envs, err := m.GetEnvironments()
+	if err != nil {
+		return err
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+
+	known := map[string]bool{}
+	for _, env := range envs {
+		known[env.Name] = true
+	}
+
+	components, err := m.ComponentPaths()
+	if err != nil {
+		return err
+	}
+
+	for _, env := range envs {
+		area := path.Join(environmentsDir, env.Name)
+		envPath := appendToAbsPath(m.environmentsPath, env.Name)
+
+		required := []AbsPath{
+			m.overridePath(env.Name),
+			appendToAbsPath(envPath, metadataDirName, schemaFilename),
+			appendToAbsPath(envPath, metadataDirName, k8sLibFilename),
+			appendToAbsPath(envPath, metadataDirName, extensionsLibFilename),
+		}
+		for _, p := range required {
+			exists, err := afero.Exists(m.appFS, string(p))
+			if err != nil {
+				return err
+			} else if !exists {
+				report(area, "Missing '%s'", strings.TrimPrefix(string(p), string(envPath)+"/"))
+			}
+		}
+
+		if env.Inherits != "" {
+			if _, err := m.EnvironmentChain(env.Name); err != nil {
+				report(area, "Inherits from '%s', but its chain of parents is broken: %v", env.Inherits, err)
+			}
+		}
+
+		if _, _, err := m.ExpandDestination(env); err != nil {
+			report(area, "%v", err)
+		}
+
+		if env.ClusterSelector != "" {
+			clusters, err := m.SelectClusters(env.ClusterSelector)
+			if err != nil {
+				report(area, "%v", err)
+			} else if len(clusters) == 0 {
+				report(area, "Cluster selector '%s' matches no clusters in '%s'", env.ClusterSelector, inventoryFile)
+			}
+		}
+
+		for _, phase := range []string{HookPreApply, HookPostApply, HookPreDelete} {
+			for _, hook := range env.Hooks.Phase(phase) {
+				if err := hook.Validate(); err != nil {
+					report(area, "%v", err)
+					continue
+				}
+				if hook.Job == "" {
+					continue
+				}
+				jobPath := hook.Job
+				if !filepath.IsAbs(jobPath) {
+					jobPath = filepath.Join(string(m.rootPath), jobPath)
+				}
+				exists, err := afero.Exists(m.appFS, jobPath)
+				if err != nil {
+					return err
+				} else if !exists {
+					report(area, "Hook '%s' runs the job '%s', which does not exist", hook.Describe(), hook.Job)
+				}
+			}
+		}
+
+		for _, p := range env.LibPaths {
+			abs := p
+			if !filepath.IsAbs(abs) {
+				abs = filepath.Join(string(m.rootPath), p)
+			}
+			exists, err := afero.DirExists(m.appFS, abs)
+			if err != nil {
+				return err
+			} else if !exists {
+				report(area, "Library path '%s' does not exist", p)
+			}
+		}
+
+		libs := []string{}
+		for lib := range env.LibraryPins {
+			libs = append(libs, lib)
+		}
+		sort.Strings(libs)
+		for _, lib := range libs {
+			dir := env.LibraryPins[lib]
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(string(m.rootPath), dir)
+			}
+			exists, err := afero.DirExists(m.appFS, dir)
+			if err != nil {
+				return err
+			} else if !exists {
+				report(area, "Library '%s' is pinned to '%s', which does not exist", lib, env.LibraryPins[lib])
+			}
+		}
+
+		for _, alias := range env.Aliases {
+			if known[alias] {
+				report(area, "Alias '%s' is also the name of an environment, which takes precedence", alias)
+			} else if owner := aliasedEnvironment(envs, alias); owner != env {
+				report(area, "Alias '%s' is also an alias of environment '%s'", alias, owner.Name)
+			}
+		}
+
+		checkMapped := func(mappings map[string]string, kind string) {
+			mapped := []string{}
+			for component := range mappings {
+				mapped = append(mapped, component)
+			}
+			sort.Strings(mapped)
+			for _, component := range mapped {
+				found := false
+				for _, p := range components {
+					if strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)) == component {
+						found = true
+						break
+					}
+				}
+				if !found {
+					report(area, "Component '%s' is mapped to %s '%s', but there is no such component", component, kind, mappings[component])
+				}
+			}
+		}
+		checkMapped(env.ComponentNamespaces, "namespace")
+		checkMapped(env.ComponentServers, "cluster")
+		mappedServers := []string{}
+		for component := range env.ComponentServers {
+			mappedServers = append(mappedServers, component)
+		}
+		sort.Strings(mappedServers)
+		for _, component := range mappedServers {
+			uri := env.ComponentServers[component]
+			if u, err := url.Parse(uri); err != nil || !u.IsAbs() || u.Host == "" {
+				report(area, "Component '%s' is mapped to cluster '%s', which is not a URI", component, uri)
+			}
+		}
+		// Mappings can be inherited from environments without a selector.
+		servers, err := m.ComponentServers(env.Name)
+		if err != nil {
+			servers = env.ComponentServers
+		}
+		if len(servers) > 0 && env.ClusterSelector != "" {
+			report(area, "Components are mapped to clusters, which is not supported for environments with a cluster selector")
+		}
+
+		if len(env.Targets) > 0 {
+			if _, err := m.targetComponents(env.Targets, components); err != nil {
+				report(area, "%v", err)
+			}
+		}
+	}
+
+	// Directories that look like environments (they hold overrides or
+	// generated ksonnet-lib), but are not, because they have no spec.
+	return afero.Walk(m.appFS, string(m.environmentsPath), func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		if info.Name() == metadataDirName {
+			return filepath.SkipDir
+		}
+
+		name := strings.TrimPrefix(p, string(m.environmentsPath)+"/")
+		if p == string(m.environmentsPath) || known[name] {
+			return nil
+		}
+
+		for _, marker := range []string{metadataDirName, path.Base(name) + ".jsonnet"} {
+			exists, err := afero.Exists(m.appFS, filepath.Join(p, marker))
+			if err != nil {
+				return err
+			} else if exists {
+				report(path.Join(environmentsDir, name), "Looks like an environment, but has no '%s'", specFilename)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+func (m *manager) pipelineStatus(report func(area, format string, args ...interface{})) error {
+	exists, err := afero.Exists(m.appFS, string(appendToAbsPath(m.rootPath, pipelineFile)))
+	if err != nil || !exists {
+		return err
+	}
+
+	pipeline, err := m.Pipeline()
+	if err != nil {
+		report(pipelineFile, "%v", err)
+		return nil
+	}
+
+	for _, stage := range pipeline.Stages {
+		if stage.Env == "" {
+			continue
+		}
+		if exists, err := m.environmentExists(stage.Env); err != nil {
+			return err
+		} else if !exists {
+			report(pipelineFile, "Stage '%s' uses environment '%s', which does not exist", stage.Name, stage.Env)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestStatus(t *testing.T) {
+	m := mockEnvironments(t, "test-status")
+
+	write := func(p AbsPath, data string) {
+		if err := afero.WriteFile(testFS, string(p), []byte(data), os.ModePerm); err != nil {
+			t.Fatalf("Failed to write '%s':\n%v", p, err)
+		}
+	}
+
+	problems, err := m.Status("v0.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The mock environments have spec files, but nothing else.
+	for _, problem := range problems {
+		if problem.Area == appYAMLFile {
+			t.Errorf("Unexpected problem with '%s': %s", appYAMLFile, problem.Message)
+		}
+	}
+
+	write(appendToAbsPath(m.componentsPath, "web.jsonnet"), "{}")
+	write(m.appYAMLPath, `libPaths: [shared]
+components:
+  web:
+    labels: {tier: frontend}
+  redis:
+    labels: {tier: backend}
+`)
+	write(appendToAbsPath(m.rootPath, pipelineFile), `stages:
+- name: deploy
+  action: apply
+  env: default
+- name: promote
+  action: apply
+  env: prod
+`)
+	// A directory with overrides, but no spec.
+	write(appendToAbsPath(m.environmentsPath, "stale", "stale.jsonnet"), "{}")
+
+	problems, err = m.Status("v0.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []StatusProblem{}
+	for _, problem := range problems {
+		if problem.Area != "environments/"+mockEnvName && problem.Area != "environments/"+mockEnvName2 && problem.Area != "environments/"+mockEnvName3 {
+			got = append(got, *problem)
+		}
+	}
+	expected := []StatusProblem{
+		{Area: appYAMLFile, Message: "Component 'redis' is configured, but there is no such component in 'components/'"},
+		{Area: appYAMLFile, Message: "Library path 'shared' does not exist"},
+		{Area: "environments/stale", Message: "Looks like an environment, but has no 'spec.json'"},
+		{Area: pipelineFile, Message: "Stage 'promote' uses environment 'prod', which does not exist"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected problems:\n%v\ngot:\n%v", expected, got)
+	}
+
+	missing := map[string]bool{}
+	for _, problem := range problems {
+		if problem.Area == "environments/"+mockEnvName {
+			missing[problem.Message] = true
+		}
+	}
+	if !missing["Missing 'test.jsonnet'"] || !missing["Missing '.metadata/k.libsonnet'"] {
+		t.Errorf("Expected the missing files of '%s' to be reported, got %v", mockEnvName, missing)
+	}
+
+	write(appendToAbsPath(m.environmentsPath, mockEnvName, specFilename),
+		`{"uri": "http://example.com", "namespace": "default", "componentServers": {"web": "ops.example.com"}}`)
+	problems, err = m.Status("v0.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, problem := range problems {
+		if problem.Area == "environments/"+mockEnvName && problem.Message == "Component 'web' is mapped to cluster 'ops.example.com', which is not a URI" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the malformed cluster of 'web' to be reported, got %v", problems)
+	}
+
+	// Problems that stop other commands are reported, rather than returned.
+	write(m.appYAMLPath, "minKsVersion: 1.0.0\n")
+	problems, err = m.Status("v0.9.0")
+	if err != nil {
+		t.Fatalf("Expected an unusable app.yaml to be reported as a problem, got:\n%v", err)
+	}
+	if len(problems) == 0 || problems[0].Area != appYAMLFile {
+		t.Errorf("Expected a problem with '%s', got %v", appYAMLFile, problems)
+	}
+}
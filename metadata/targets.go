@@ -0,0 +1,221 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// SetEnvironmentTargets scopes the environment `name` to the components named
+// by `targets`. A target is either the name of a component (e.g., 'redis'),
+// or a directory under 'components/' (e.g., 'backend'), which selects every
+// component in it. An empty list of targets removes the scoping, so that the
+// environment renders every component again.
+//
+// Every target must match at least one existing component; unknown targets
+// are reported along with the closest component names.
+func (m *manager) SetEnvironmentTargets(name string, targets []string) error {
+	env, err := m.GetEnvironment(name)
+	if err != nil {
+		return err
+	}
+	name = env.Name
+
+	cleaned := []string{}
+	seen := map[string]bool{}
+	for _, target := range targets {
+		target = strings.Trim(target, "/")
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		cleaned = append(cleaned, target)
+	}
+
+	paths, err := m.ComponentPaths()
+	if err != nil {
+		return err
+	}
+	if _, err := m.targetComponents(cleaned, paths); err != nil {
+		return err
+	}
+
+	env.Targets = cleaned
+	specData, err := json.MarshalIndent(environmentSpec(env), "", "  ")
+	if err != nil {
+		return err
+	}
+	specPath := appendToAbsPath(m.environmentsPath, name, specFilename)
+	if err := afero.WriteFile(m.appFS, string(specPath), specData, defaultFilePermissions); err != nil {
+		return err
+	}
+
+	if len(cleaned) == 0 {
+		log.Infof("Environment '%s' now targets every component", name)
+	} else {
+		log.Infof("Environment '%s' now targets %s", name, quoteNames(cleaned))
+	}
+	return nil
+}
+
+// EnvironmentComponentPaths returns the paths of the components the
+// environment `name` renders: those matched by its targets (or every
+// component, if it has none) that also match the component label selector
+// `selector`, if it is non-empty. It fails if any of the environment's targets
+// matches no component, rather than silently rendering less than expected.
+func (m *manager) EnvironmentComponentPaths(name, selector string) (AbsPaths, error) {
+	env, err := m.GetEnvironment(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths AbsPaths
+	if selector != "" {
+		paths, err = m.SelectComponents(selector)
+	} else {
+		paths, err = m.ComponentPaths()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(env.Targets) == 0 {
+		return paths, nil
+	}
+
+	// Validate against every component, so that a target that the selector
+	// happens to exclude is not reported as unknown.
+	all, err := m.ComponentPaths()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.targetComponents(env.Targets, all); err != nil {
+		return nil, fmt.Errorf("Environment '%s' has invalid targets:\n%v", name, err)
+	}
+
+	matched, _ := m.matchTargets(env.Targets, paths)
+	return matched, nil
+}
+
+// targetComponents returns the paths among `paths` that are matched by one of
+// `targets`, in their original order. It fails if some target matches none of
+// `paths`.
+func (m *manager) targetComponents(targets []string, paths AbsPaths) (AbsPaths, error) {
+	matched, unknown := m.matchTargets(targets, paths)
+	if len(unknown) == 0 {
+		return matched, nil
+	}
+
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = m.componentName(p)
+	}
+	lines := []string{}
+	for _, target := range unknown {
+		line := fmt.Sprintf("  '%s' matches no component", target)
+		if suggestion := closestName(target, names); suggestion != "" {
+			line += fmt.Sprintf("; did you mean '%s'?", suggestion)
+		}
+		lines = append(lines, line)
+	}
+	return nil, fmt.Errorf("Unknown targets:\n%s", strings.Join(lines, "\n"))
+}
+
+// matchTargets returns the paths among `paths` that are matched by one of
+// `targets`, in their original order, and the targets that match none of them.
+func (m *manager) matchTargets(targets []string, paths AbsPaths) (AbsPaths, []string) {
+	matched := AbsPaths{}
+	used := map[string]bool{}
+	for _, p := range paths {
+		name := m.componentName(p)
+		for _, target := range targets {
+			if name == target || strings.HasPrefix(name, target+"/") {
+				used[target] = true
+				matched = append(matched, p)
+				break
+			}
+		}
+	}
+
+	unknown := []string{}
+	for _, target := range targets {
+		if !used[target] {
+			unknown = append(unknown, target)
+		}
+	}
+	return matched, unknown
+}
+
+// componentName returns the name of the component at `p`, i.e., its path
+// relative to the components directory, without its extension.
+func (m *manager) componentName(p string) string {
+	rel := strings.TrimPrefix(p, string(m.componentsPath)+"/")
+	return strings.TrimSuffix(rel, path.Ext(rel))
+}
+
+// closestName returns the name in `candidates` that is closest to `name`, or
+// the empty string if none is close enough to be a plausible typo.
+func closestName(name string, candidates []string) string {
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+
+	best, bestDistance := "", len(name)/2+1
+	for _, candidate := range sorted {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between `a` and `b`.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
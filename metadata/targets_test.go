@@ -0,0 +1,123 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestEnvironmentTargets(t *testing.T) {
+	m := mockEnvironments(t, "test-env-targets")
+
+	for _, name := range []string{"redis.jsonnet", "backend/api.jsonnet", "backend/worker.yaml", "frontend.jsonnet"} {
+		p := appendToAbsPath(m.componentsPath, name)
+		if err := afero.WriteFile(testFS, string(p), []byte("{}"), defaultFilePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+	componentNames := func(paths AbsPaths) []string {
+		names := []string{}
+		for _, p := range paths {
+			names = append(names, m.componentName(p))
+		}
+		return names
+	}
+
+	paths, err := m.EnvironmentComponentPaths(mockEnvName, "")
+	if err != nil {
+		t.Fatalf("Failed to get component paths:\n%v", err)
+	}
+	if len(paths) != 4 {
+		t.Errorf("Expected an environment without targets to render every component, got %v", componentNames(paths))
+	}
+
+	if err := m.SetEnvironmentTargets(mockEnvName, []string{"redis", "backend/", "redis"}); err != nil {
+		t.Fatalf("Failed to set targets:\n%v", err)
+	}
+	env, err := m.GetEnvironment(mockEnvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"redis", "backend"}; !reflect.DeepEqual(env.Targets, expected) {
+		t.Errorf("Expected targets %v, got %v", expected, env.Targets)
+	}
+
+	paths, err = m.EnvironmentComponentPaths(mockEnvName, "")
+	if err != nil {
+		t.Fatalf("Failed to get component paths:\n%v", err)
+	}
+	if expected := []string{"backend/api", "backend/worker", "redis"}; !reflect.DeepEqual(componentNames(paths), expected) {
+		t.Errorf("Expected components %v, got %v", expected, componentNames(paths))
+	}
+
+	// Other fields of the environment leave the targets alone.
+	if err := m.SetEnvironment(mockEnvName, &Environment{Namespace: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if env, err := m.GetEnvironment(mockEnvName); err != nil || len(env.Targets) != 2 {
+		t.Errorf("Expected targets to survive updating the environment, got %#v, %v", env, err)
+	}
+
+	err = m.SetEnvironmentTargets(mockEnvName, []string{"redsi", "database"})
+	if err == nil {
+		t.Fatalf("Expected unknown targets to be rejected")
+	}
+	for _, substr := range []string{"'redsi' matches no component; did you mean 'redis'?", "'database' matches no component\n"} {
+		if !strings.Contains(err.Error()+"\n", substr) {
+			t.Errorf("Expected error to contain %q, got:\n%v", substr, err)
+		}
+	}
+
+	// A component removed after targeting is reported when rendering.
+	if err := testFS.Remove(string(appendToAbsPath(m.componentsPath, "redis.jsonnet"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.EnvironmentComponentPaths(mockEnvName, ""); err == nil || !strings.Contains(err.Error(), "'redis' matches no component") {
+		t.Errorf("Expected a stale target to be reported, got: %v", err)
+	}
+
+	if err := m.SetEnvironmentTargets(mockEnvName, nil); err != nil {
+		t.Fatalf("Failed to clear targets:\n%v", err)
+	}
+	if paths, err := m.EnvironmentComponentPaths(mockEnvName, ""); err != nil || len(paths) != 3 {
+		t.Errorf("Expected clearing targets to render every component, got %v, %v", paths, err)
+	}
+
+	// Targets that a component selector excludes are not unknown.
+	for _, name := range []string{"ui.jsonnet", "redis.jsonnet"} {
+		if err := afero.WriteFile(testFS, string(appendToAbsPath(m.componentsPath, name)), []byte("{}"), defaultFilePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appYAML := "components:\n  ui:\n    labels: {tier: frontend}\n  redis:\n    labels: {tier: backend}\n"
+	if err := afero.WriteFile(testFS, string(m.appYAMLPath), []byte(appYAML), defaultFilePermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetEnvironmentTargets(mockEnvName, []string{"ui", "redis"}); err != nil {
+		t.Fatalf("Failed to set targets:\n%v", err)
+	}
+	paths, err = m.EnvironmentComponentPaths(mockEnvName, "tier=frontend")
+	if err != nil {
+		t.Fatalf("Failed to get component paths:\n%v", err)
+	}
+	if expected := []string{"ui"}; !reflect.DeepEqual(componentNames(paths), expected) {
+		t.Errorf("Expected components %v, got %v", expected, componentNames(paths))
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// transaction groups a series of filesystem mutations so that they either all
+// take effect, or none of them do. Every mutation records how to undo itself;
+// files that are overwritten or removed are first copied to a staging
+// directory, so that they can be restored if the transaction is rolled back.
+//
+// A typical use looks like:
+//
+//	tx := newTransaction(m.appFS)
+//	defer tx.rollback()
+//	...
+//	return tx.commit()
+//
+// Rolling back a committed transaction is a no-op.
+//
+// NOTE: Copying (rather than renaming) into the staging directory is slower,
+// but it works across devices, and with filesystems (e.g., afero's in-memory
+// filesystem) whose directory renames do not carry their children along.
+type transaction struct {
+	fs       afero.Fs
+	stageDir string
+	staged   int
+	undo     []func() error
+	done     bool
+}
+
+func newTransaction(fs afero.Fs) *transaction {
+	stageDir := filepath.Join(os.TempDir(), fmt.Sprintf("ksonnet-txn-%d", time.Now().UnixNano()))
+	return &transaction{fs: fs, stageDir: stageDir}
+}
+
+// mkdirAll creates `p` and any missing parents. On rollback, every directory
+// this call created is removed.
+func (t *transaction) mkdirAll(p AbsPath) error {
+	// Find the outermost directory that does not yet exist; that's what we
+	// remove on rollback.
+	var created string
+	for curr := string(p); ; curr = filepath.Dir(curr) {
+		exists, err := afero.Exists(t.fs, curr)
+		if err != nil {
+			return err
+		}
+		if exists {
+			break
+		}
+		created = curr
+		if curr == filepath.Dir(curr) {
+			break
+		}
+	}
+
+	if err := t.fs.MkdirAll(string(p), defaultFolderPermissions); err != nil {
+		return err
+	}
+
+	if created != "" {
+		t.undo = append(t.undo, func() error { return t.fs.RemoveAll(created) })
+	}
+	return nil
+}
+
+// writeFile writes `data` to `p`, creating any missing parent directories. On
+// rollback, the previous contents (if any) are restored.
+func (t *transaction) writeFile(p AbsPath, data []byte) error {
+	if err := t.mkdirAll(AbsPath(filepath.Dir(string(p)))); err != nil {
+		return err
+	}
+	if err := t.backup(string(p)); err != nil {
+		return err
+	}
+	return afero.WriteFile(t.fs, string(p), data, defaultFilePermissions)
+}
+
+// removeAll removes `p` and everything under it. On rollback, the removed
+// files are restored.
+func (t *transaction) removeAll(p AbsPath) error {
+	if err := t.backup(string(p)); err != nil {
+		return err
+	}
+	return t.fs.RemoveAll(string(p))
+}
+
+// move moves the file or directory at `oldPath` to `newPath`, which must not
+// already exist. The tree is copied, and the copy verified, before the
+// original is removed, so a failure partway through never loses data.
+func (t *transaction) move(oldPath, newPath AbsPath) error {
+	if strings.HasPrefix(string(newPath), string(oldPath)+"/") {
+		return fmt.Errorf("Could not move '%s' into its own subdirectory '%s'", oldPath, newPath)
+	}
+
+	exists, err := afero.Exists(t.fs, string(newPath))
+	if err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("Could not move '%s' to '%s'; destination already exists", oldPath, newPath)
+	}
+
+	if err := t.mkdirAll(AbsPath(filepath.Dir(string(newPath)))); err != nil {
+		return err
+	}
+
+	t.undo = append(t.undo, func() error { return t.fs.RemoveAll(string(newPath)) })
+	if err := copyTree(t.fs, string(oldPath), string(newPath)); err != nil {
+		return err
+	}
+	if err := verifyTree(t.fs, string(oldPath), string(newPath)); err != nil {
+		return fmt.Errorf("Could not move '%s' to '%s':\n%v", oldPath, newPath, err)
+	}
+
+	return t.removeAll(oldPath)
+}
+
+// commit makes the transaction's changes permanent by discarding the staged
+// backups.
+func (t *transaction) commit() error {
+	if t.done {
+		return fmt.Errorf("Transaction has already been completed")
+	}
+	t.done = true
+
+	if err := t.fs.RemoveAll(t.stageDir); err != nil {
+		// The changes themselves have been made; a leftover staging directory in
+		// the temp dir is not worth failing the operation over.
+		log.Debugf("Failed to remove transaction staging directory '%s': %v", t.stageDir, err)
+	}
+	return nil
+}
+
+// rollback undoes every change made in the transaction, most recent first. It
+// does nothing if the transaction has already been committed or rolled back.
+func (t *transaction) rollback() {
+	if t.done {
+		return
+	}
+	t.done = true
+
+	log.Debug("Rolling back changes")
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		if err := t.undo[i](); err != nil {
+			log.Warnf("Failed to roll back a change; application may be left in an inconsistent state:\n%v", err)
+		}
+	}
+
+	if err := t.fs.RemoveAll(t.stageDir); err != nil {
+		log.Debugf("Failed to remove transaction staging directory '%s': %v", t.stageDir, err)
+	}
+}
+
+// backup arranges for `p` to be restored to its current state on rollback. If
+// `p` does not currently exist, it is removed on rollback instead.
+func (t *transaction) backup(p string) error {
+	exists, err := afero.Exists(t.fs, p)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		t.undo = append(t.undo, func() error { return t.fs.RemoveAll(p) })
+		return nil
+	}
+
+	t.staged++
+	stagePath := filepath.Join(t.stageDir, fmt.Sprintf("%d", t.staged))
+	if err := copyTree(t.fs, p, stagePath); err != nil {
+		return err
+	}
+
+	t.undo = append(t.undo, func() error {
+		if err := t.fs.RemoveAll(p); err != nil {
+			return err
+		}
+		return copyTree(t.fs, stagePath, p)
+	})
+	return nil
+}
+
+// verifyTree returns an error unless every file and directory under `src`
+// has an identical counterpart under `dst`.
+func verifyTree(fs afero.Fs, src, dst string) error {
+	return afero.Walk(fs, src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := dst + strings.TrimPrefix(p, src)
+		targetInfo, err := fs.Stat(target)
+		if err != nil {
+			return fmt.Errorf("Copy of '%s' is missing", p)
+		}
+		if info.IsDir() != targetInfo.IsDir() {
+			return fmt.Errorf("Copy of '%s' is not of the same type", p)
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		data, err := afero.ReadFile(fs, p)
+		if err != nil {
+			return err
+		}
+		copied, err := afero.ReadFile(fs, target)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, copied) {
+			return fmt.Errorf("Copy of '%s' differs from the original", p)
+		}
+		return nil
+	})
+}
+
+// copyTree recursively copies the file or directory at `src` to `dst`.
+func copyTree(fs afero.Fs, src, dst string) error {
+	return afero.Walk(fs, src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := dst + strings.TrimPrefix(p, src)
+		if info.IsDir() {
+			return fs.MkdirAll(target, defaultFolderPermissions)
+		}
+
+		data, err := afero.ReadFile(fs, p)
+		if err != nil {
+			return err
+		}
+		if err := fs.MkdirAll(filepath.Dir(target), defaultFolderPermissions); err != nil {
+			return err
+		}
+		return afero.WriteFile(fs, target, data, info.Mode().Perm())
+	})
+}
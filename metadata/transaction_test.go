@@ -0,0 +1,143 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func testFileContents(t *testing.T, fs afero.Fs, path, expected string) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		t.Fatalf("Failed to read file at '%s':\n%v", path, err)
+	} else if string(data) != expected {
+		t.Fatalf("Expected file at '%s' to contain '%s', got '%s'", path, expected, data)
+	}
+}
+
+func testFileNotExists(t *testing.T, fs afero.Fs, path string) {
+	exists, err := afero.Exists(fs, path)
+	if err != nil {
+		t.Fatalf("Failed to check whether file at '%s' exists:\n%v", path, err)
+	} else if exists {
+		t.Fatalf("Expected file at '%s' to not exist, but it does", path)
+	}
+}
+
+func newTransactionTestFS(t *testing.T) afero.Fs {
+	fs := afero.NewMemMapFs()
+	for path, data := range map[string]string{
+		"/app/a/foo.txt":     "foo",
+		"/app/a/sub/bar.txt": "bar",
+	} {
+		if err := afero.WriteFile(fs, path, []byte(data), defaultFilePermissions); err != nil {
+			t.Fatalf("Failed to write file at '%s':\n%v", path, err)
+		}
+	}
+	return fs
+}
+
+func TestTransactionRollback(t *testing.T) {
+	fs := newTransactionTestFS(t)
+
+	tx := newTransaction(fs)
+	if err := tx.writeFile("/app/a/foo.txt", []byte("changed")); err != nil {
+		t.Fatalf("Failed to write file:\n%v", err)
+	}
+	if err := tx.writeFile("/app/new/dir/baz.txt", []byte("baz")); err != nil {
+		t.Fatalf("Failed to write file:\n%v", err)
+	}
+	if err := tx.move("/app/a/sub", "/app/b/sub"); err != nil {
+		t.Fatalf("Failed to move directory:\n%v", err)
+	}
+	testFileContents(t, fs, "/app/b/sub/bar.txt", "bar")
+	testFileNotExists(t, fs, "/app/a/sub/bar.txt")
+
+	tx.rollback()
+
+	testFileContents(t, fs, "/app/a/foo.txt", "foo")
+	testFileContents(t, fs, "/app/a/sub/bar.txt", "bar")
+	testFileNotExists(t, fs, "/app/new")
+	testFileNotExists(t, fs, "/app/b")
+	testFileNotExists(t, fs, tx.stageDir)
+}
+
+func TestTransactionCommit(t *testing.T) {
+	fs := newTransactionTestFS(t)
+
+	tx := newTransaction(fs)
+	if err := tx.removeAll("/app/a/sub"); err != nil {
+		t.Fatalf("Failed to remove directory:\n%v", err)
+	}
+	if err := tx.writeFile("/app/a/foo.txt", []byte("changed")); err != nil {
+		t.Fatalf("Failed to write file:\n%v", err)
+	}
+	if err := tx.commit(); err != nil {
+		t.Fatalf("Failed to commit transaction:\n%v", err)
+	}
+
+	// Rolling back a committed transaction does nothing.
+	tx.rollback()
+
+	testFileContents(t, fs, "/app/a/foo.txt", "changed")
+	testFileNotExists(t, fs, "/app/a/sub")
+	testFileNotExists(t, fs, tx.stageDir)
+
+	if err := tx.commit(); err == nil {
+		t.Fatal("Expected committing a completed transaction to fail")
+	}
+}
+
+func TestTransactionMoveFailures(t *testing.T) {
+	fs := newTransactionTestFS(t)
+
+	tx := newTransaction(fs)
+	defer tx.rollback()
+
+	if err := tx.move("/app/a/sub", "/app/a"); err == nil {
+		t.Fatal("Expected moving onto an existing path to fail")
+	}
+	if err := tx.move("/app/a", "/app/a/sub/a"); err == nil {
+		t.Fatal("Expected moving a directory into itself to fail")
+	}
+}
+
+func TestVerifyTree(t *testing.T) {
+	fs := newTransactionTestFS(t)
+
+	if err := copyTree(fs, "/app/a", "/app/b"); err != nil {
+		t.Fatalf("Failed to copy tree:\n%v", err)
+	}
+	if err := verifyTree(fs, "/app/a", "/app/b"); err != nil {
+		t.Fatalf("Expected copy to verify, got:\n%v", err)
+	}
+
+	if err := afero.WriteFile(fs, "/app/b/sub/bar.txt", []byte("baz"), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write file:\n%v", err)
+	}
+	if err := verifyTree(fs, "/app/a", "/app/b"); err == nil {
+		t.Fatal("Expected a copy with different contents to fail verification")
+	}
+
+	if err := fs.RemoveAll("/app/b/sub"); err != nil {
+		t.Fatalf("Failed to remove directory:\n%v", err)
+	}
+	if err := verifyTree(fs, "/app/a", "/app/b"); err == nil {
+		t.Fatal("Expected a copy with missing files to fail verification")
+	}
+}
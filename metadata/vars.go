@@ -0,0 +1,108 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/afero"
+)
+
+// varsFile holds application-level values for the `${VAR}` references in
+// environment URIs and namespaces, e.g.:
+//
+//	CLUSTER_HOST: k8s.staging.example.com
+//	TEAM: payments
+const varsFile = "vars.yaml"
+
+// varRef matches a `${VAR}` reference.
+var varRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandDestination returns the URI and namespace of `env`, with every
+// `${VAR}` reference replaced by the value of the variable `VAR` in the
+// process environment or, failing that, in the application's `vars.yaml`.
+// This lets the same environment definitions be used with clusters in
+// different accounts, without committing their URIs. Referring to a variable
+// that is defined in neither is an error.
+func (m *manager) ExpandDestination(env *Environment) (string, string, error) {
+	if !varRef.MatchString(env.URI) && !varRef.MatchString(env.Namespace) {
+		return env.URI, env.Namespace, nil
+	}
+
+	vars, err := m.appVars()
+	if err != nil {
+		return "", "", err
+	}
+	lookup := func(name string) (string, bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		value, ok := vars[name]
+		return value, ok
+	}
+
+	uri, err := expandVars(env.URI, lookup)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to expand URI of environment '%s': %v", env.Name, err)
+	}
+	namespace, err := expandVars(env.Namespace, lookup)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to expand namespace of environment '%s': %v", env.Name, err)
+	}
+	return uri, namespace, nil
+}
+
+// appVars reads the application's `vars.yaml`, if it has one.
+func (m *manager) appVars() (map[string]string, error) {
+	varsPath := appendToAbsPath(m.rootPath, varsFile)
+	exists, err := afero.Exists(m.appFS, string(varsPath))
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return map[string]string{}, nil
+	}
+
+	data, err := afero.ReadFile(m.appFS, string(varsPath))
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]string{}
+	if err := yaml.Unmarshal(data, &vars); err != nil {
+		return nil, fmt.Errorf("Failed to parse '%s':\n%v", varsFile, err)
+	}
+	return vars, nil
+}
+
+// expandVars replaces every `${VAR}` reference in `s` with the value `lookup`
+// returns for `VAR`.
+func expandVars(s string, lookup func(name string) (string, bool)) (string, error) {
+	var undefined string
+	expanded := varRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := varRef.FindStringSubmatch(ref)[1]
+		value, ok := lookup(name)
+		if !ok && undefined == "" {
+			undefined = name
+		}
+		return value
+	})
+	if undefined != "" {
+		return "", fmt.Errorf("variable '%s' is not defined in the environment or in '%s'", undefined, varsFile)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestExpandDestination(t *testing.T) {
+	m := mockEnvironments(t, "test-expand-destination")
+
+	env := &Environment{Name: "prod", URI: "https://${CLUSTER_HOST}:443", Namespace: "${TEAM}-prod"}
+	if _, _, err := m.ExpandDestination(env); err == nil {
+		t.Errorf("Expected expanding undefined variables to fail")
+	}
+
+	vars := "CLUSTER_HOST: k8s.example.com\nTEAM: payments\n"
+	varsPath := appendToAbsPath(m.rootPath, varsFile)
+	if err := afero.WriteFile(testFS, string(varsPath), []byte(vars), defaultFilePermissions); err != nil {
+		t.Fatalf("Failed to write vars file:\n%v", err)
+	}
+
+	uri, namespace, err := m.ExpandDestination(env)
+	if err != nil {
+		t.Fatalf("Failed to expand destination:\n%v", err)
+	}
+	if uri != "https://k8s.example.com:443" || namespace != "payments-prod" {
+		t.Errorf("Expected 'https://k8s.example.com:443' and 'payments-prod', got '%s' and '%s'", uri, namespace)
+	}
+
+	// The process environment takes precedence over the vars file.
+	os.Setenv("TEAM", "search")
+	defer os.Unsetenv("TEAM")
+	_, namespace, err = m.ExpandDestination(env)
+	if err != nil {
+		t.Fatalf("Failed to expand destination:\n%v", err)
+	}
+	if namespace != "search-prod" {
+		t.Errorf("Expected namespace 'search-prod', got '%s'", namespace)
+	}
+
+	// Destinations without references are returned as they are.
+	plain := &Environment{Name: "dev", URI: "http://localhost:8080", Namespace: "$dev"}
+	uri, namespace, err = m.ExpandDestination(plain)
+	if err != nil || uri != plain.URI || namespace != plain.Namespace {
+		t.Errorf("Expected destination to be unchanged, got '%s' and '%s' (%v)", uri, namespace, err)
+	}
+}
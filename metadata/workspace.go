@@ -0,0 +1,114 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/afero"
+)
+
+const workspaceFile = "ks-workspace.yaml"
+
+// WorkspaceSpec represents the contents of `ks-workspace.yaml`, which marks the
+// root of a repository containing several ksonnet applications. For example:
+//
+//	apps:
+//	  payments: teams/payments
+//	  search: teams/search
+//	vendor: vendor
+type WorkspaceSpec struct {
+	// Apps maps the name of each application to its directory, relative to
+	// the workspace root.
+	Apps map[string]string `json:"apps"`
+	// Vendor is a directory of libraries, relative to the workspace root,
+	// that is shared by all applications in the workspace. It is searched
+	// after each application's own libraries.
+	Vendor string `json:"vendor,omitempty"`
+}
+
+// Workspace is a repository containing several ksonnet applications.
+type Workspace struct {
+	Root AbsPath
+	Spec WorkspaceSpec
+}
+
+// FindWorkspace will recursively search the current directory and its parents
+// for a `ks-workspace.yaml` file, which marks the workspace root. Returns nil
+// if there is no workspace.
+func FindWorkspace(path AbsPath) (*Workspace, error) {
+	return findWorkspace(path, appFS)
+}
+
+func findWorkspace(abs AbsPath, fs afero.Fs) (*Workspace, error) {
+	var lastBase string
+	currBase := string(abs)
+
+	for {
+		currPath := filepath.Join(currBase, workspaceFile)
+		exists, err := afero.Exists(fs, currPath)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			data, err := afero.ReadFile(fs, currPath)
+			if err != nil {
+				return nil, err
+			}
+
+			ws := &Workspace{Root: AbsPath(currBase)}
+			if err := yaml.Unmarshal(data, &ws.Spec); err != nil {
+				return nil, fmt.Errorf("Failed to parse '%s':\n%v", currPath, err)
+			}
+			return ws, nil
+		}
+
+		lastBase = currBase
+		currBase = filepath.Dir(currBase)
+		if lastBase == currBase {
+			return nil, nil
+		}
+	}
+}
+
+// AppPath returns the root directory of the application `name`.
+func (w *Workspace) AppPath(name string) (AbsPath, error) {
+	appPath, ok := w.Spec.Apps[name]
+	if !ok {
+		names := []string{}
+		for name := range w.Spec.Apps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("Workspace at '%s' has no app named '%s'; available apps are: %s", w.Root, name, strings.Join(names, ", "))
+	}
+
+	return appendToAbsPath(w.Root, appPath), nil
+}
+
+// VendorPath returns the directory of libraries shared by all applications in
+// the workspace, or the empty string if there is none.
+func (w *Workspace) VendorPath() AbsPath {
+	if w.Spec.Vendor == "" {
+		return ""
+	}
+	return AbsPath(path.Join(string(w.Root), w.Spec.Vendor))
+}
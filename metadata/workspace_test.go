@@ -0,0 +1,70 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metadata
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFindWorkspace(t *testing.T) {
+	const spec = `apps:
+  payments: teams/payments
+  search: teams/search
+vendor: shared/vendor
+`
+	if err := afero.WriteFile(testFS, "/workspace/"+workspaceFile, []byte(spec), os.ModePerm); err != nil {
+		t.Fatalf("Failed to write workspace file:\n%v", err)
+	}
+	if err := testFS.MkdirAll("/workspace/teams/payments/components", os.ModePerm); err != nil {
+		t.Fatalf("Failed to create app directory:\n%v", err)
+	}
+
+	ws, err := findWorkspace("/workspace/teams/payments/components", testFS)
+	if err != nil {
+		t.Fatalf("Failed to find workspace:\n%v", err)
+	} else if ws == nil {
+		t.Fatalf("Expected to find workspace at '/workspace'")
+	}
+
+	if ws.Root != "/workspace" {
+		t.Errorf("Expected workspace root '/workspace', got '%s'", ws.Root)
+	}
+
+	appPath, err := ws.AppPath("payments")
+	if err != nil {
+		t.Errorf("Failed to find app 'payments':\n%v", err)
+	} else if appPath != "/workspace/teams/payments" {
+		t.Errorf("Expected app path '/workspace/teams/payments', got '%s'", appPath)
+	}
+
+	if _, err := ws.AppPath("billing"); err == nil {
+		t.Errorf("Expected finding nonexistent app 'billing' to fail")
+	}
+
+	if vendorPath := ws.VendorPath(); vendorPath != "/workspace/shared/vendor" {
+		t.Errorf("Expected vendor path '/workspace/shared/vendor', got '%s'", vendorPath)
+	}
+
+	ws, err = findWorkspace("/not/a/workspace", testFS)
+	if err != nil {
+		t.Errorf("Failed to search for workspace:\n%v", err)
+	} else if ws != nil {
+		t.Errorf("Expected no workspace at '/not/a/workspace', got '%s'", ws.Root)
+	}
+}
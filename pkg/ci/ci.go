@@ -0,0 +1,124 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package ci generates continuous integration pipelines for ksonnet
+// applications. The pipelines check every environment (with 'ks app status',
+// 'ks validate', and 'ks diff') when a change is proposed, and apply the
+// environments when the change is merged.
+package ci
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	// GitHubActions generates a GitHub Actions workflow.
+	GitHubActions = "github-actions"
+	// GitLab generates a GitLab CI/CD configuration.
+	GitLab = "gitlab"
+	// Jenkins generates a declarative Jenkins pipeline.
+	Jenkins = "jenkins"
+)
+
+// Providers are the CI providers pipelines can be generated for.
+var Providers = []string{GitHubActions, GitLab, Jenkins}
+
+// Config describes the pipeline to generate.
+type Config struct {
+	// AppDir is the path of the application, relative to the directory the
+	// pipeline definition is written to (usually the root of the repository).
+	AppDir string
+	// Branch is the branch whose changes are applied once merged.
+	Branch string
+	// CheckEnvs are the environments that are validated and diffed against
+	// their clusters for every proposed change.
+	CheckEnvs []string
+	// ApplyEnvs are the environments that are applied, in order, when a
+	// change is merged into `Branch`.
+	ApplyEnvs []string
+}
+
+// File is a generated pipeline definition.
+type File struct {
+	// Path is the path the file should be written to, relative to the
+	// directory `Config.AppDir` is relative to.
+	Path string
+	Data []byte
+}
+
+// providerFiles are the conventional locations of each provider's pipeline
+// definition.
+var providerFiles = map[string]string{
+	GitHubActions: path.Join(".github", "workflows", "ksonnet.yml"),
+	GitLab:        ".gitlab-ci.yml",
+	Jenkins:       "Jenkinsfile",
+}
+
+// Generate returns the pipeline definition for `provider` described by
+// `config`.
+func Generate(provider string, config *Config) (*File, error) {
+	text, ok := providerTemplates[provider]
+	if !ok {
+		return nil, fmt.Errorf("Unknown CI provider '%s'; supported values are: %s", provider, strings.Join(Providers, ", "))
+	}
+	if config.Branch == "" {
+		return nil, fmt.Errorf("Pipeline requires a branch to apply changes from")
+	}
+	if len(config.CheckEnvs) == 0 && len(config.ApplyEnvs) == 0 {
+		return nil, fmt.Errorf("Pipeline requires at least one environment")
+	}
+
+	appDir := path.Clean(config.AppDir)
+	if appDir == "" {
+		appDir = "."
+	}
+
+	tmpl, err := template.New(provider).Delims("[[", "]]").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]interface{}{
+		"AppDir":    appDir,
+		"Branch":    config.Branch,
+		"CheckEnvs": config.CheckEnvs,
+		"ApplyEnvs": config.ApplyEnvs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{Path: providerFiles[provider], Data: buf.Bytes()}, nil
+}
+
+var templateFuncs = template.FuncMap{
+	// quote returns `s` as a double-quoted YAML string.
+	"quote": strconv.Quote,
+	// groovy returns `s` as a double-quoted Groovy string, without
+	// interpolation.
+	"groovy": func(s string) string {
+		return strings.Replace(strconv.Quote(s), "$", `\$`, -1)
+	},
+	// shell returns `s` quoted for a POSIX shell.
+	"shell": func(s string) string {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	},
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ci
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	config := &Config{
+		AppDir:    "deploy",
+		Branch:    "main",
+		CheckEnvs: []string{"dev", "us-west/prod"},
+		ApplyEnvs: []string{"us-west/prod"},
+	}
+
+	tests := []struct {
+		provider string
+		path     string
+		contains []string
+	}{
+		{
+			provider: GitHubActions,
+			path:     ".github/workflows/ksonnet.yml",
+			contains: []string{
+				"    - \"main\"\n",
+				"    working-directory: \"deploy\"\n",
+				"        - \"us-west/prod\"\n",
+				"      run: ks diff \"$KS_ENV\" || test $? -eq 10\n",
+				"      run: \"ks apply 'us-west/prod'\"\n",
+				"${{ secrets.KUBECONFIG }}",
+			},
+		},
+		{
+			provider: GitLab,
+			path:     ".gitlab-ci.yml",
+			contains: []string{
+				"\"check:us-west/prod\":\n",
+				"  - \"cd 'deploy'\"\n",
+				"  - \"ks diff 'dev' || test $? -eq 10\"\n",
+				"  - if: $CI_COMMIT_BRANCH == \"main\"\n",
+				"  - \"ks apply 'us-west/prod'\"\n",
+			},
+		},
+		{
+			provider: Jenkins,
+			path:     "Jenkinsfile",
+			contains: []string{
+				"        dir(\"deploy\") {\n",
+				"          sh \"ks diff 'dev' || test \\$? -eq 10\"\n",
+				"      when { branch \"main\" }\n",
+				"          sh \"ks apply 'us-west/prod'\"\n",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		file, err := Generate(test.provider, config)
+		if err != nil {
+			t.Fatalf("Failed to generate %s pipeline:\n%v", test.provider, err)
+		}
+		if file.Path != test.path {
+			t.Errorf("Expected %s pipeline at '%s', got '%s'", test.provider, test.path, file.Path)
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(string(file.Data), s) {
+				t.Errorf("Expected %s pipeline to contain %q:\n%s", test.provider, s, file.Data)
+			}
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	if _, err := Generate("travis", &Config{Branch: "master", CheckEnvs: []string{"dev"}}); err == nil {
+		t.Errorf("Expected unknown provider to fail")
+	}
+	if _, err := Generate(GitLab, &Config{Branch: "master"}); err == nil {
+		t.Errorf("Expected pipeline without environments to fail")
+	}
+
+	// Applying nothing omits the apply job, and an application at the root
+	// needs no working directory.
+	file, err := Generate(GitHubActions, &Config{AppDir: ".", Branch: "master", CheckEnvs: []string{"dev"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(file.Data), "apply") || strings.Contains(string(file.Data), "working-directory") {
+		t.Errorf("Unexpected apply job or working directory:\n%s", file.Data)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ci
+
+// providerTemplates are the templates of each provider's pipeline definition.
+// They use '[[' and ']]' as delimiters, since GitHub Actions expressions use
+// '{{'.
+var providerTemplates = map[string]string{
+	GitHubActions: githubActionsTemplate,
+	GitLab:        gitlabTemplate,
+	Jenkins:       jenkinsTemplate,
+}
+
+const githubActionsTemplate = `# Generated by 'ks ci init'. Pull requests are checked against every
+# environment, and changes merged into '[[.Branch]]' are applied.
+#
+# The clusters are reached with the kubeconfig in the repository secret
+# 'KUBECONFIG', and 'ks' must be on the runner's PATH.
+name: ksonnet
+on:
+  pull_request:
+  push:
+    branches:
+    - [[quote .Branch]]
+[[- if ne .AppDir "."]]
+defaults:
+  run:
+    working-directory: [[quote .AppDir]]
+[[- end]]
+jobs:
+[[- if .CheckEnvs]]
+  check:
+    if: github.event_name == 'pull_request'
+    runs-on: ubuntu-latest
+    strategy:
+      fail-fast: false
+      matrix:
+        env:
+[[- range .CheckEnvs]]
+        - [[quote .]]
+[[- end]]
+    env:
+      KS_ENV: ${{ matrix.env }}
+    steps:
+    - uses: actions/checkout@v2
+    - name: Configure cluster access
+      run: mkdir -p "$HOME/.kube" && printf '%s' "$KUBECONFIG_DATA" > "$HOME/.kube/config"
+      env:
+        KUBECONFIG_DATA: ${{ secrets.KUBECONFIG }}
+    - name: Check the application
+      run: ks app status
+    - name: Validate
+      run: ks validate "$KS_ENV"
+    - name: Diff
+      run: ks diff "$KS_ENV" || test $? -eq 10
+[[- end]]
+[[- if .ApplyEnvs]]
+  apply:
+    if: github.event_name == 'push'
+    runs-on: ubuntu-latest
+    steps:
+    - uses: actions/checkout@v2
+    - name: Configure cluster access
+      run: mkdir -p "$HOME/.kube" && printf '%s' "$KUBECONFIG_DATA" > "$HOME/.kube/config"
+      env:
+        KUBECONFIG_DATA: ${{ secrets.KUBECONFIG }}
+[[- range .ApplyEnvs]]
+    - name: [[quote (printf "Apply %s" .)]]
+      run: [[quote (printf "ks apply %s" (shell .))]]
+[[- end]]
+[[- end]]
+`
+
+const gitlabTemplate = `# Generated by 'ks ci init'. Merge requests are checked against every
+# environment, and changes merged into '[[.Branch]]' are applied.
+#
+# The clusters are reached with the kubeconfig in the file-type CI/CD variable
+# 'KUBECONFIG', and 'ks' must be on the PATH of the job image.
+stages:
+- check
+- apply
+[[- if .CheckEnvs]]
+
+lint:
+  stage: check
+  rules:
+  - if: $CI_PIPELINE_SOURCE == "merge_request_event"
+  script:
+  - [[quote (printf "cd %s" (shell .AppDir))]]
+  - ks app status
+[[- range .CheckEnvs]]
+
+[[quote (printf "check:%s" .)]]:
+  stage: check
+  rules:
+  - if: $CI_PIPELINE_SOURCE == "merge_request_event"
+  script:
+  - [[quote (printf "cd %s" (shell $.AppDir))]]
+  - [[quote (printf "ks validate %s" (shell .))]]
+  - [[quote (printf "ks diff %s || test $? -eq 10" (shell .))]]
+[[- end]]
+[[- end]]
+[[- if .ApplyEnvs]]
+
+apply:
+  stage: apply
+  rules:
+  - if: $CI_COMMIT_BRANCH == [[quote .Branch]]
+  resource_group: ksonnet-apply
+  script:
+  - [[quote (printf "cd %s" (shell .AppDir))]]
+[[- range .ApplyEnvs]]
+  - [[quote (printf "ks apply %s" (shell .))]]
+[[- end]]
+[[- end]]
+`
+
+const jenkinsTemplate = `// Generated by 'ks ci init'. Change requests are checked against every
+// environment, and changes merged into '[[.Branch]]' are applied.
+//
+// The clusters are reached with the kubeconfig in the secret file credential
+// 'kubeconfig', and 'ks' must be on the agent's PATH.
+pipeline {
+  agent any
+  environment {
+    KUBECONFIG = credentials('kubeconfig')
+  }
+  stages {
+[[- if .CheckEnvs]]
+    stage('Check') {
+      when { changeRequest() }
+      steps {
+        dir([[groovy .AppDir]]) {
+          sh 'ks app status'
+[[- range .CheckEnvs]]
+          sh [[groovy (printf "ks validate %s" (shell .))]]
+          sh [[groovy (printf "ks diff %s || test $? -eq 10" (shell .))]]
+[[- end]]
+        }
+      }
+    }
+[[- end]]
+[[- if .ApplyEnvs]]
+    stage('Apply') {
+      when { branch [[groovy .Branch]] }
+      steps {
+        dir([[groovy .AppDir]]) {
+[[- range .ApplyEnvs]]
+          sh [[groovy (printf "ks apply %s" (shell .))]]
+[[- end]]
+        }
+      }
+    }
+[[- end]]
+  }
+}
+`
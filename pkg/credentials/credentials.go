@@ -0,0 +1,84 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package credentials resolves the credentials used to authenticate to the
+// clusters of ksonnet environments from the providers configured in
+// 'app.yaml' (see `metadata.CredentialSpec`), such as environment variables,
+// external commands, the system keychain, or cloud SDKs, so that tokens never
+// need to be stored in the application. Providers can be mixed freely across
+// environments, and new ones can be added with `Register`.
+package credentials
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+// Provider obtains a bearer token for a cluster.
+type Provider interface {
+	// Token returns the current token. Providers are asked again when the
+	// cluster rejects a token, so short-lived tokens are refreshed.
+	Token() (string, error)
+}
+
+// Factory creates a provider from its configuration, checking that the
+// fields the provider needs are set.
+type Factory func(spec *metadata.CredentialSpec) (Provider, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes the provider named `name` available to 'app.yaml'. It
+// panics if a provider of that name is already registered.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("Credential provider '%s' is already registered", name))
+	}
+	factories[name] = factory
+}
+
+// Providers returns the sorted names of the registered providers.
+func Providers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := []string{}
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the provider described by `spec`.
+func New(spec *metadata.CredentialSpec) (Provider, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[spec.Provider]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown credential provider '%s'; must be one of: %s", spec.Provider, strings.Join(Providers(), ", "))
+	}
+	return factory(spec)
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+func TestEnvProvider(t *testing.T) {
+	_, err := New(&metadata.CredentialSpec{Provider: ProviderEnv})
+	require.EqualError(t, err, "Credential provider 'env' requires 'variable'")
+
+	p, err := New(&metadata.CredentialSpec{Provider: ProviderEnv, Variable: "KS_TEST_CLUSTER_TOKEN"})
+	require.NoError(t, err)
+
+	os.Unsetenv("KS_TEST_CLUSTER_TOKEN")
+	_, err = p.Token()
+	require.Error(t, err)
+
+	os.Setenv("KS_TEST_CLUSTER_TOKEN", "s3cr3t")
+	defer os.Unsetenv("KS_TEST_CLUSTER_TOKEN")
+	token, err := p.Token()
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", token)
+}
+
+func TestCommandProviders(t *testing.T) {
+	savedRunCommand := runCommand
+	defer func() { runCommand = savedRunCommand }()
+
+	var ran []string
+	output := ""
+	runCommand = func(command []string) ([]byte, error) {
+		ran = command
+		if output == "" {
+			return nil, fmt.Errorf("exit status 1")
+		}
+		return []byte(output), nil
+	}
+
+	for _, tc := range []struct {
+		spec    metadata.CredentialSpec
+		command string
+	}{
+		{metadata.CredentialSpec{Provider: ProviderExec, Command: []string{"vault", "read", "-field=token", "secret/k8s"}}, "vault read -field=token secret/k8s"},
+		{metadata.CredentialSpec{Provider: ProviderGcloud}, "gcloud auth print-access-token"},
+		{metadata.CredentialSpec{Provider: ProviderGcloud, Account: "ci@example.com"}, "gcloud auth print-access-token ci@example.com"},
+		{metadata.CredentialSpec{Provider: ProviderAWS, Cluster: "prod", Region: "us-east-1"}, "aws eks get-token --cluster-name prod --region us-east-1"},
+	} {
+		p, err := New(&tc.spec)
+		require.NoError(t, err)
+
+		output = "token\n"
+		token, err := p.Token()
+		require.NoError(t, err)
+		require.Equal(t, "token", token)
+		require.Equal(t, tc.command, strings.Join(ran, " "))
+	}
+
+	p, err := New(&metadata.CredentialSpec{Provider: ProviderKeychain, Service: "k8s-prod"})
+	require.NoError(t, err)
+	output = ""
+	_, err = p.Token()
+	require.Error(t, err)
+
+	for _, spec := range []metadata.CredentialSpec{
+		{Provider: ProviderExec},
+		{Provider: ProviderKeychain},
+		{Provider: ProviderAWS},
+	} {
+		_, err := New(&spec)
+		require.Error(t, err, spec.Provider)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	token, err := parseToken([]byte(`{"kind": "ExecCredential", "apiVersion": "client.authentication.k8s.io/v1alpha1", "status": {"token": "k8s-aws-v1.abc"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "k8s-aws-v1.abc", token)
+
+	_, err = parseToken([]byte("  \n"))
+	require.Error(t, err)
+	_, err = parseToken([]byte(`{"status": {}}`))
+	require.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	_, err := New(&metadata.CredentialSpec{Provider: "vault"})
+	require.EqualError(t, err, "Unknown credential provider 'vault'; must be one of: aws, env, exec, gcloud, keychain")
+
+	Register("vault", func(spec *metadata.CredentialSpec) (Provider, error) {
+		return &envProvider{variable: "VAULT_TOKEN"}, nil
+	})
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "vault")
+		factoriesMu.Unlock()
+	}()
+
+	_, err = New(&metadata.CredentialSpec{Provider: "vault"})
+	require.NoError(t, err)
+	require.Panics(t, func() { Register("vault", nil) })
+}
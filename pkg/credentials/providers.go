@@ -0,0 +1,166 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+const (
+	// ProviderEnv reads the token from an environment variable.
+	ProviderEnv = "env"
+	// ProviderExec runs a command that prints the token, either alone or as
+	// a client-go `ExecCredential`.
+	ProviderExec = "exec"
+	// ProviderKeychain reads the token from the system keychain: the macOS
+	// keychain, or the Secret Service (e.g., GNOME Keyring) elsewhere.
+	ProviderKeychain = "keychain"
+	// ProviderGcloud asks the Google Cloud SDK for an access token.
+	ProviderGcloud = "gcloud"
+	// ProviderAWS asks the AWS CLI for a token for an EKS cluster.
+	ProviderAWS = "aws"
+)
+
+func init() {
+	Register(ProviderEnv, newEnvProvider)
+	Register(ProviderExec, newExecProvider)
+	Register(ProviderKeychain, newKeychainProvider)
+	Register(ProviderGcloud, newGcloudProvider)
+	Register(ProviderAWS, newAWSProvider)
+}
+
+// missingField is the error of a provider whose configuration lacks `field`.
+func missingField(provider, field string) error {
+	return fmt.Errorf("Credential provider '%s' requires '%s'", provider, field)
+}
+
+type envProvider struct {
+	variable string
+}
+
+func newEnvProvider(spec *metadata.CredentialSpec) (Provider, error) {
+	if spec.Variable == "" {
+		return nil, missingField(ProviderEnv, "variable")
+	}
+	return &envProvider{variable: spec.Variable}, nil
+}
+
+func (p *envProvider) Token() (string, error) {
+	token, ok := os.LookupEnv(p.variable)
+	if !ok || token == "" {
+		return "", fmt.Errorf("Environment variable '%s' holding the cluster token is not set", p.variable)
+	}
+	return token, nil
+}
+
+// commandProvider runs a command, and reads the token from its output.
+type commandProvider struct {
+	command []string
+}
+
+// runCommand is the function that runs credential commands, returning their
+// standard output. It is a variable so that it can be replaced in tests.
+var runCommand = func(command []string) ([]byte, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+func newExecProvider(spec *metadata.CredentialSpec) (Provider, error) {
+	if len(spec.Command) == 0 {
+		return nil, missingField(ProviderExec, "command")
+	}
+	return &commandProvider{command: spec.Command}, nil
+}
+
+func newKeychainProvider(spec *metadata.CredentialSpec) (Provider, error) {
+	if spec.Service == "" {
+		return nil, missingField(ProviderKeychain, "service")
+	}
+	if runtime.GOOS == "darwin" {
+		command := []string{"security", "find-generic-password", "-w", "-s", spec.Service}
+		if spec.Account != "" {
+			command = append(command, "-a", spec.Account)
+		}
+		return &commandProvider{command: command}, nil
+	}
+
+	command := []string{"secret-tool", "lookup", "service", spec.Service}
+	if spec.Account != "" {
+		command = append(command, "account", spec.Account)
+	}
+	return &commandProvider{command: command}, nil
+}
+
+func newGcloudProvider(spec *metadata.CredentialSpec) (Provider, error) {
+	command := []string{"gcloud", "auth", "print-access-token"}
+	if spec.Account != "" {
+		command = append(command, spec.Account)
+	}
+	return &commandProvider{command: command}, nil
+}
+
+func newAWSProvider(spec *metadata.CredentialSpec) (Provider, error) {
+	if spec.Cluster == "" {
+		return nil, missingField(ProviderAWS, "cluster")
+	}
+	command := []string{"aws", "eks", "get-token", "--cluster-name", spec.Cluster}
+	if spec.Region != "" {
+		command = append(command, "--region", spec.Region)
+	}
+	if spec.Profile != "" {
+		command = append(command, "--profile", spec.Profile)
+	}
+	return &commandProvider{command: command}, nil
+}
+
+func (p *commandProvider) Token() (string, error) {
+	out, err := runCommand(p.command)
+	if err != nil {
+		return "", fmt.Errorf("Failed to obtain cluster token with '%s': %v", strings.Join(p.command, " "), err)
+	}
+	return parseToken(out)
+}
+
+// parseToken reads the token from the output of a credential command: either
+// a client-go `ExecCredential` (as printed by, e.g., 'aws eks get-token'), or
+// the token alone.
+func parseToken(out []byte) (string, error) {
+	trimmed := strings.TrimSpace(string(out))
+	if strings.HasPrefix(trimmed, "{") {
+		var credential struct {
+			Status struct {
+				Token string `json:"token"`
+			} `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(trimmed), &credential); err != nil {
+			return "", fmt.Errorf("Failed to parse credentials:\n%v", err)
+		}
+		trimmed = credential.Status.Token
+	}
+
+	if trimmed == "" {
+		return "", fmt.Errorf("Credential command printed no token")
+	}
+	return trimmed, nil
+}
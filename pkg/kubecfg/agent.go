@@ -0,0 +1,265 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+const (
+	// DefaultAgentNamespace is the namespace the apply agent's Jobs run in,
+	// unless otherwise specified.
+	DefaultAgentNamespace = "ksonnet-agent"
+	// DefaultAgentServiceAccount is the service account whose credentials the
+	// apply agent uses, unless otherwise specified.
+	DefaultAgentServiceAccount = "ksonnet-agent"
+	// DefaultAgentImage is the image the apply agent runs, unless otherwise
+	// specified. It must contain the `ks` binary.
+	DefaultAgentImage = "ksonnet/ks:latest"
+
+	agentBundleKey  = "bundle.json"
+	agentBundlePath = "/bundle"
+
+	// maxAgentBundleSize is the largest bundle that can be submitted to the
+	// agent; ConfigMaps are limited to 1MiB in total.
+	maxAgentBundleSize = 1000 * 1024
+
+	// agentNamePrefix is the prefix of the generated names of the bundles,
+	// and of the Jobs named after them.
+	agentNamePrefix = "ks-apply-"
+
+	// agentJobTTL is how long, in seconds, a finished Job of the apply agent
+	// is kept (where the cluster's TTL controller is enabled). Jobs that
+	// succeed are deleted right away; this leaves time to read the logs of
+	// those that fail.
+	agentJobTTL = int64(7 * 24 * 60 * 60)
+)
+
+// AgentApplyCmd renders locally, but hands the rendered objects to an
+// in-cluster Job that performs the apply using its own service account's
+// credentials. The user only needs permission to create ConfigMaps and Jobs
+// in the agent namespace.
+type AgentApplyCmd struct {
+	ClientPool dynamic.ClientPool
+	Discovery  discovery.DiscoveryInterface
+
+	// Namespace is the default namespace of the objects being applied.
+	Namespace string
+
+	AgentNamespace      string
+	AgentServiceAccount string
+	AgentImage          string
+	Timeout             time.Duration
+
+	Create bool
+	GcTag  string
+	SkipGc bool
+	DryRun bool
+}
+
+func (c AgentApplyCmd) Run(apiObjects []*unstructured.Unstructured) error {
+	bundle, err := c.agentBundle(apiObjects)
+	if err != nil {
+		return err
+	}
+
+	bundleClient, err := utils.ClientForResource(c.ClientPool, c.Discovery, bundle, c.AgentNamespace)
+	if err != nil {
+		return err
+	}
+	log.Infof("Submitting bundle of %d objects to the apply agent", len(apiObjects))
+	created, err := bundleClient.Create(bundle)
+	if err != nil {
+		return fmt.Errorf("Error creating bundle ConfigMap in namespace '%s': %s", c.AgentNamespace, err)
+	}
+
+	// The Job is named after the bundle, whose name the server generated, so
+	// that concurrent applies do not collide.
+	job := c.agentJob(created.GetName())
+	jobClient, err := utils.ClientForResource(c.ClientPool, c.Discovery, job, c.AgentNamespace)
+	if err != nil {
+		return err
+	}
+	desc := fmt.Sprintf("job %s", utils.FqName(job))
+	log.Infof("Submitting %s to the apply agent", desc)
+	createdJob, err := jobClient.Create(job)
+	if err != nil {
+		c.deleteAgentObject(bundleClient, created)
+		return fmt.Errorf("Error creating %s: %s", desc, err)
+	}
+
+	// Owning the bundle by the Job lets the garbage collector delete it with
+	// the Job, e.g., once the Job's 'ttlSecondsAfterFinished' has passed.
+	created.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Name:       createdJob.GetName(),
+		UID:        createdJob.GetUID(),
+	}})
+	if _, err := bundleClient.Update(created); err != nil {
+		log.Warnf("Could not make %s the owner of its bundle: %s", desc, err)
+	}
+
+	log.Infof("Waiting for %s to complete", desc)
+	var deadline time.Time
+	if c.Timeout > 0 {
+		deadline = time.Now().Add(c.Timeout)
+	}
+	err = waitForJob(jobClient, job.GetName(), "apply agent "+desc, deadline)
+	if _, ok := err.(*jobFailedError); ok {
+		return fmt.Errorf("Apply agent %s failed; see 'kubectl logs --namespace %s job/%s' for details: %v", desc, c.AgentNamespace, job.GetName(), err)
+	} else if err != nil {
+		return err
+	}
+	log.Infof("Apply agent %s completed successfully", desc)
+
+	// Only a Job that succeeded is cleaned up; one that failed is left, so that
+	// its logs can be read, until its TTL passes.
+	c.deleteAgentObject(jobClient, createdJob)
+	c.deleteAgentObject(bundleClient, created)
+	return nil
+}
+
+// deleteAgentObject deletes `obj`, an object submitted to the apply agent,
+// along with its dependents (e.g., the Pods of a Job). Failing to delete it is
+// not fatal, since the apply itself is done.
+func (c AgentApplyCmd) deleteAgentObject(rc *dynamic.ResourceClient, obj *unstructured.Unstructured) {
+	background := metav1.DeletePropagationBackground
+	if err := rc.Delete(obj.GetName(), &metav1.DeleteOptions{PropagationPolicy: &background}); err != nil && !errors.IsNotFound(err) {
+		log.Warnf("Could not delete %s %s of the apply agent: %s", obj.GetKind(), utils.FqName(obj), err)
+	}
+}
+
+// agentBundle returns the ConfigMap holding the bundle of objects to apply.
+// Its name is generated by the server.
+func (c AgentApplyCmd) agentBundle(apiObjects []*unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	items := []interface{}{}
+	for _, obj := range apiObjects {
+		items = append(items, obj.Object)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAgentBundleSize {
+		return nil, fmt.Errorf("Rendered objects are %d bytes, which exceeds the apply agent's limit of %d bytes", len(data), maxAgentBundleSize)
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"generateName": agentNamePrefix,
+			"namespace":    c.AgentNamespace,
+			"labels": map[string]interface{}{
+				"app.kubernetes.io/managed-by": "ksonnet",
+			},
+		},
+		"data": map[string]interface{}{
+			agentBundleKey: string(data),
+		},
+	}}, nil
+}
+
+// agentJob returns the Job `name` that applies the bundle in the ConfigMap of
+// the same name.
+func (c AgentApplyCmd) agentJob(name string) *unstructured.Unstructured {
+	labels := map[string]interface{}{
+		"app.kubernetes.io/managed-by": "ksonnet",
+		"ksonnet.io/agent-apply":       name,
+	}
+
+	args := []interface{}{
+		"apply",
+		"-f", agentBundlePath + "/" + agentBundleKey,
+		fmt.Sprintf("--create=%t", c.Create),
+	}
+	if c.Namespace != "" {
+		args = append(args, "--namespace", c.Namespace)
+	}
+	if c.GcTag != "" {
+		args = append(args, "--gc-tag", c.GcTag)
+	}
+	if c.SkipGc {
+		args = append(args, "--skip-gc")
+	}
+	if c.DryRun {
+		args = append(args, "--dry-run")
+	}
+
+	// The Job is never retried: a partially-completed apply should be looked
+	// at by a human, rather than blindly re-run.
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": c.AgentNamespace,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"backoffLimit":            int64(0),
+			"ttlSecondsAfterFinished": agentJobTTL,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": labels,
+				},
+				"spec": map[string]interface{}{
+					"serviceAccountName": c.AgentServiceAccount,
+					"restartPolicy":      "Never",
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":    "ks",
+							"image":   c.AgentImage,
+							"command": []interface{}{"ks"},
+							"args":    args,
+							"volumeMounts": []interface{}{
+								map[string]interface{}{
+									"name":      "bundle",
+									"mountPath": agentBundlePath,
+									"readOnly":  true,
+								},
+							},
+						},
+					},
+					"volumes": []interface{}{
+						map[string]interface{}{
+							"name": "bundle",
+							"configMap": map[string]interface{}{
+								"name": name,
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestAgentObjects(t *testing.T) {
+	c := AgentApplyCmd{
+		Namespace:           "prod",
+		AgentNamespace:      "ksonnet-agent",
+		AgentServiceAccount: "deployer",
+		AgentImage:          "ksonnet/ks:v0.8.0",
+		Create:              true,
+		GcTag:               "my-app",
+	}
+
+	objs := []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "guestbook"},
+		}},
+	}
+
+	bundle, err := c.agentBundle(objs)
+	if err != nil {
+		t.Fatalf("Failed to create agent bundle:\n%v", err)
+	}
+
+	if bundle.GetKind() != "ConfigMap" || bundle.GetGenerateName() != "ks-apply-" || bundle.GetNamespace() != "ksonnet-agent" {
+		t.Errorf("Unexpected bundle %s/%s* in namespace '%s'", bundle.GetKind(), bundle.GetGenerateName(), bundle.GetNamespace())
+	}
+
+	data := bundle.Object["data"].(map[string]interface{})[agentBundleKey].(string)
+	var list struct {
+		Kind  string                   `json:"kind"`
+		Items []map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		t.Fatalf("Failed to parse bundle:\n%v", err)
+	}
+	if list.Kind != "List" || len(list.Items) != 1 || list.Items[0]["kind"] != "Service" {
+		t.Errorf("Unexpected bundle contents:\n%s", data)
+	}
+
+	job := c.agentJob("ks-apply-1")
+	if job.GetName() != "ks-apply-1" || job.GetNamespace() != "ksonnet-agent" {
+		t.Errorf("Unexpected job %s in namespace '%s'", job.GetName(), job.GetNamespace())
+	}
+	template := job.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})
+	podSpec := template["spec"].(map[string]interface{})
+	if podSpec["serviceAccountName"] != "deployer" {
+		t.Errorf("Expected job to run as service account 'deployer', got '%v'", podSpec["serviceAccountName"])
+	}
+
+	container := podSpec["containers"].([]interface{})[0].(map[string]interface{})
+	if container["image"] != "ksonnet/ks:v0.8.0" {
+		t.Errorf("Expected job to run image 'ksonnet/ks:v0.8.0', got '%v'", container["image"])
+	}
+	expectedArgs := []interface{}{"apply", "-f", "/bundle/bundle.json", "--create=true", "--namespace", "prod", "--gc-tag", "my-app"}
+	if !reflect.DeepEqual(container["args"], expectedArgs) {
+		t.Errorf("Expected job args %v, got %v", expectedArgs, container["args"])
+	}
+	volume := podSpec["volumes"].([]interface{})[0].(map[string]interface{})
+	if name := volume["configMap"].(map[string]interface{})["name"]; name != "ks-apply-1" {
+		t.Errorf("Expected job to mount the bundle 'ks-apply-1', got '%v'", name)
+	}
+}
+
+func TestAgentApplyCleanup(t *testing.T) {
+	defer func(interval time.Duration) { jobPollInterval = interval }(jobPollInterval)
+	jobPollInterval = time.Millisecond
+
+	objs := []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "guestbook"},
+		}},
+	}
+
+	for _, condition := range []string{"Complete", "Failed"} {
+		cluster := newFakeCluster(t)
+		// Jobs finish as soon as they are created.
+		cluster.written = func(obj map[string]interface{}) {
+			if obj["kind"] == "Job" {
+				obj["status"] = map[string]interface{}{
+					"conditions": []interface{}{map[string]interface{}{"type": condition, "status": "True"}},
+				}
+			}
+		}
+
+		c := AgentApplyCmd{
+			ClientPool:     cluster,
+			Discovery:      cluster.discovery(),
+			AgentNamespace: "ksonnet-agent",
+			Timeout:        time.Second,
+		}
+
+		// Applies do not collide, however quickly they follow each other.
+		for i := 0; i < 2; i++ {
+			err := c.Run(objs)
+			if condition == "Complete" && err != nil {
+				t.Fatalf("Unexpected error from a completed apply:\n%v", err)
+			} else if condition == "Failed" && err == nil {
+				t.Fatalf("Expected a failed apply to fail")
+			}
+		}
+
+		created := cluster.requested("POST")
+		if len(created) != 4 {
+			t.Fatalf("Expected 2 bundles and 2 jobs to be created, got %v", created)
+		}
+		names := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			bundle, job := created[2*i], created[2*i+1]
+			name := strings.TrimPrefix(cluster.requested("PUT")[i], "/api/v1/namespaces/ksonnet-agent/configmaps/")
+			if bundle != "/api/v1/namespaces/ksonnet-agent/configmaps" || job != "/apis/batch/v1/namespaces/ksonnet-agent/jobs" || !strings.HasPrefix(name, "ks-apply-") || names[name] {
+				t.Errorf("Expected a bundle and a job with a new generated name, got %s and %s named '%s'", bundle, job, name)
+			}
+			names[name] = true
+
+			bundleText := fmt.Sprintf(`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": %q, "namespace": "ksonnet-agent"}}`, name)
+			jobText := fmt.Sprintf(`{"apiVersion": "batch/v1", "kind": "Job", "metadata": {"name": %q, "namespace": "ksonnet-agent"}}`, name)
+			liveBundle, liveJob := cluster.get(bundleText), cluster.get(jobText)
+			if condition == "Complete" {
+				if liveBundle != nil || liveJob != nil {
+					t.Errorf("Expected the bundle and job '%s' of a completed apply to be deleted", name)
+				}
+				continue
+			}
+
+			if liveBundle == nil || liveJob == nil {
+				t.Fatalf("Expected the bundle and job '%s' of a failed apply to be kept", name)
+			}
+			owners, _ := liveBundle["metadata"].(map[string]interface{})["ownerReferences"].([]interface{})
+			if len(owners) != 1 || owners[0].(map[string]interface{})["uid"] != liveJob["metadata"].(map[string]interface{})["uid"] {
+				t.Errorf("Expected the bundle '%s' to be owned by its job, got owners %v", name, owners)
+			}
+			if ttl := liveJob["spec"].(map[string]interface{})["ttlSecondsAfterFinished"]; ttl != float64(agentJobTTL) {
+				t.Errorf("Expected the job '%s' to be deleted %d seconds after it finishes, got %v", name, agentJobTTL, ttl)
+			}
+		}
+		cluster.Close()
+	}
+}
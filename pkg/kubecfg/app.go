@@ -0,0 +1,92 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+const (
+	// AppStatusFormatText writes one line per problem.
+	AppStatusFormatText = "text"
+	// AppStatusFormatJSON writes the problems as a JSON array.
+	AppStatusFormatJSON = "json"
+)
+
+// AppStatusCmd reports mismatches between the configuration of an
+// application and its directory structure.
+type AppStatusCmd struct {
+	// KsVersion is the version of ks that `app.yaml` is checked against.
+	KsVersion string
+	// Format is one of `AppStatusFormatText` (the default) or
+	// `AppStatusFormatJSON`.
+	Format string
+
+	manager metadata.Manager
+}
+
+func NewAppStatusCmd(manager metadata.Manager) (*AppStatusCmd, error) {
+	return &AppStatusCmd{manager: manager}, nil
+}
+
+func (c *AppStatusCmd) Run(out io.Writer) error {
+	switch c.Format {
+	case "", AppStatusFormatText, AppStatusFormatJSON:
+	default:
+		return fmt.Errorf("Unknown status output format '%s'; supported values are: %s, %s", c.Format, AppStatusFormatText, AppStatusFormatJSON)
+	}
+
+	problems, err := c.manager.Status(c.KsVersion)
+	if err != nil {
+		return err
+	}
+
+	if c.Format == AppStatusFormatJSON {
+		return writeJSON(out, problems)
+	}
+
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "No problems found")
+		return nil
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(out, "%s: %s\n", problem.Area, problem.Message)
+	}
+	return nil
+}
+
+// ==================================================================
+
+// IntrospectCmd writes a model of the whole application as a single JSON
+// document (see `metadata.AppModel`).
+type IntrospectCmd struct {
+	manager metadata.Manager
+}
+
+func NewIntrospectCmd(manager metadata.Manager) (*IntrospectCmd, error) {
+	return &IntrospectCmd{manager: manager}, nil
+}
+
+func (c *IntrospectCmd) Run(out io.Writer) error {
+	model, err := c.manager.Introspect()
+	if err != nil {
+		return err
+	}
+	return writeJSON(out, model)
+}
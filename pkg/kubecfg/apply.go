@@ -3,7 +3,10 @@ package kubecfg
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -37,8 +40,21 @@ const (
 	GcStrategyAuto = "auto"
 	// GcStrategyIgnore means this object should be ignored by garbage collection
 	GcStrategyIgnore = "ignore"
+
+	// maxReauthAttempts is the number of times an object is retried after the
+	// server rejects the client's credentials.
+	maxReauthAttempts = 3
+
+	// DefaultWaveTimeout is how long an apply waits for the objects of one
+	// wave (see `utils.AnnotationApplyWave`) to become ready before applying
+	// the next.
+	DefaultWaveTimeout = 5 * time.Minute
 )
 
+// reauthBackoff is how long an apply waits before the first retry after the
+// server rejects the client's credentials. It doubles with each attempt.
+var reauthBackoff = time.Second
+
 // ApplyCmd represents the apply subcommand
 type ApplyCmd struct {
 	ClientPool dynamic.ClientPool
@@ -49,65 +65,142 @@ type ApplyCmd struct {
 	GcTag  string
 	SkipGc bool
 	DryRun bool
+
+	// Concurrency is the number of objects updated at once. Only objects
+	// that do not depend on each other (see `utils.ApplyClasses`) are
+	// updated together. Values below 2 update one object at a time.
+	Concurrency int
+
+	// WaveTimeout is how long to wait for the objects of each wave (see
+	// `utils.AnnotationApplyWave`) to become ready before applying the next
+	// wave. Defaults to `DefaultWaveTimeout`.
+	WaveTimeout time.Duration
+
+	// Out, if set, receives a summary of the readiness of each component once
+	// the apply has finished.
+	Out io.Writer
+	// HealthPolicies, if set, decide the readiness of objects in the summary
+	// written to Out.
+	HealthPolicies HealthPolicies
+
+	// Components holds the settings of the components of the application,
+	// which decide what happens to their existing Jobs and CronJobs (see
+	// `metadata.ComponentSpec.JobRerun`).
+	Components map[string]*metadata.ComponentSpec
+
+	// Reconnect, if set, rebuilds the clients (refreshing their credentials)
+	// after the server rejects the current ones partway through an apply.
+	Reconnect func() (dynamic.ClientPool, discovery.DiscoveryInterface, error)
+
+	// RollbackTimeout, if positive, is how long the applied objects have to
+	// become ready. If the apply fails, or they are not ready in time, the
+	// objects are rolled back to their state before the apply, and a
+	// `RollbackError` is returned.
+	RollbackTimeout time.Duration
 }
 
 func (c ApplyCmd) Run(apiObjects []*unstructured.Unstructured, wd metadata.AbsPath) error {
+	if c.RollbackTimeout <= 0 || c.DryRun {
+		return c.apply(apiObjects, wd)
+	}
+
+	r := RollbackCmd{ClientPool: c.ClientPool, Discovery: c.Discovery, Namespace: c.Namespace}
+	state, err := r.Capture(apiObjects)
+	if err != nil {
+		return fmt.Errorf("Error capturing the state to roll back to: %v", err)
+	}
+
+	err = c.apply(apiObjects, wd)
+	if err == nil {
+		return nil
+	}
+
+	rollbackErr := &RollbackError{Cause: err}
+	if notReady, ok := err.(*NotReadyError); ok {
+		rollbackErr.Components = notReady.Components()
+	}
+	log.Errorf("Rolling back %d object(s): %v", len(apiObjects), err)
+	if err := r.Run(state); err != nil {
+		return fmt.Errorf("Failed to roll back after:\n%v\nRollback failed: %v", rollbackErr.Cause, err)
+	}
+	return rollbackErr
+}
+
+func (c ApplyCmd) apply(apiObjects []*unstructured.Unstructured, wd metadata.AbsPath) error {
 	dryRunText := ""
 	if c.DryRun {
 		dryRunText = " (dry-run)"
 	}
 
+	waves, err := utils.ApplyWaves(apiObjects)
+	if err != nil {
+		return err
+	}
 	sort.Sort(utils.DependencyOrder(apiObjects))
 
+	clients := &applyClients{pool: c.ClientPool, disco: c.Discovery}
 	seenUids := sets.NewString()
+	var seenMu sync.Mutex
 
-	for _, obj := range apiObjects {
-		if c.GcTag != "" {
-			utils.SetMetaDataAnnotation(obj, AnnotationGcTag, c.GcTag)
+	for i, wave := range waves {
+		if len(waves) > 1 {
+			if i > 0 && !c.DryRun {
+				if err := c.waitForWave(clients, waves[i-1]); err != nil {
+					return err
+				}
+			}
+			num, _ := utils.ApplyWave(wave[0])
+			log.Infof("Applying wave %d (%d objects)%s", num, len(wave), dryRunText)
 		}
 
-		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
-		log.Info("Updating ", desc, dryRunText)
-
-		rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
-		if err != nil {
-			return err
-		}
+		for _, class := range utils.ApplyClasses(wave) {
+			err := forEachObject(class, c.Concurrency, func(obj *unstructured.Unstructured) error {
+				newobj, err := c.applyObject(clients, obj, dryRunText)
+				if err != nil {
+					return err
+				}
 
-		asPatch, err := json.Marshal(obj)
-		if err != nil {
-			return err
-		}
-		var newobj metav1.Object
-		if !c.DryRun {
-			newobj, err = rc.Patch(obj.GetName(), types.MergePatchType, asPatch)
-			log.Debugf("Patch(%s) returned (%v, %v)", obj.GetName(), newobj, err)
-		} else {
-			newobj, err = rc.Get(obj.GetName())
-		}
-		if c.Create && errors.IsNotFound(err) {
-			log.Info(" Creating non-existent ", desc, dryRunText)
-			if !c.DryRun {
-				newobj, err = rc.Create(obj)
-				log.Debugf("Create(%s) returned (%v, %v)", obj.GetName(), newobj, err)
-			} else {
-				newobj = obj
-				err = nil
+				// Some objects appear under multiple kinds
+				// (eg: Deployment is both extensions/v1beta1
+				// and apps/v1beta1).  UID is the only stable
+				// identifier that links these two views of
+				// the same object.
+				seenMu.Lock()
+				seenUids.Insert(string(newobj.GetUID()))
+				seenMu.Unlock()
+				return nil
+			})
+			if err != nil {
+				return err
 			}
 		}
-		if err != nil {
-			// TODO: retry
-			return fmt.Errorf("Error updating %s: %s", desc, err)
-		}
+	}
 
-		log.Debug("Updated object: ", diff.ObjectDiff(obj, newobj))
+	// Pick up any clients rebuilt after refreshing credentials.
+	c.ClientPool, c.Discovery, _ = clients.get()
+
+	var healthErr error
+	if c.RollbackTimeout > 0 && !c.DryRun {
+		log.Infof("Waiting up to %s for %d object(s) to become ready", c.RollbackTimeout, len(apiObjects))
+		w := WaitCmd{
+			ClientPool:     c.ClientPool,
+			Discovery:      c.Discovery,
+			Namespace:      c.Namespace,
+			Timeout:        c.RollbackTimeout,
+			HealthPolicies: c.HealthPolicies,
+		}
+		healthErr = w.Run(apiObjects)
+	}
 
-		// Some objects appear under multiple kinds
-		// (eg: Deployment is both extensions/v1beta1
-		// and apps/v1beta1).  UID is the only stable
-		// identifier that links these two views of
-		// the same object.
-		seenUids.Insert(string(newobj.GetUID()))
+	if c.Out != nil && !c.DryRun {
+		if err := c.summarizeReadiness(apiObjects); err != nil {
+			return err
+		}
+	}
+	if healthErr != nil {
+		// Garbage collection cannot be undone, so it waits for a healthy
+		// apply.
+		return healthErr
 	}
 
 	if c.GcTag != "" && !c.SkipGc {
@@ -143,6 +236,221 @@ func (c ApplyCmd) Run(apiObjects []*unstructured.Unstructured, wd metadata.AbsPa
 	return nil
 }
 
+// waitForWave waits for the objects of a wave to become ready, so that the
+// next wave can rely on them.
+func (c ApplyCmd) waitForWave(clients *applyClients, wave []*unstructured.Unstructured) error {
+	timeout := c.WaveTimeout
+	if timeout == 0 {
+		timeout = DefaultWaveTimeout
+	}
+
+	num, _ := utils.ApplyWave(wave[0])
+	log.Infof("Waiting for the objects of wave %d to become ready before applying the next wave", num)
+
+	pool, disco, _ := clients.get()
+	w := WaitCmd{
+		ClientPool:     pool,
+		Discovery:      disco,
+		Namespace:      c.Namespace,
+		Timeout:        timeout,
+		HealthPolicies: c.HealthPolicies,
+	}
+	if err := w.Run(wave); err != nil {
+		return fmt.Errorf("Wave %d did not become ready: %v", num, err)
+	}
+	return nil
+}
+
+// summarizeReadiness retrieves the live state of `apiObjects`, and writes the
+// readiness of each component to `c.Out`.
+func (c ApplyCmd) summarizeReadiness(apiObjects []*unstructured.Unstructured) error {
+	live := make([]*unstructured.Unstructured, 0, len(apiObjects))
+	errs := map[*unstructured.Unstructured]error{}
+	for _, obj := range apiObjects {
+		rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+		if err == nil {
+			var current *unstructured.Unstructured
+			current, err = rc.Get(obj.GetName())
+			if err == nil {
+				live = append(live, current)
+				continue
+			}
+		}
+		log.Debugf("Failed to retrieve %s for readiness summary: %v", utils.FqName(obj), err)
+		live = append(live, obj)
+		errs[obj] = err
+	}
+
+	return writeReadinessSummary(c.Out, live, errs, c.HealthPolicies)
+}
+
+// applyObject updates `obj` on the server, refreshing the credentials of
+// `clients` if the server rejects them.
+func (c ApplyCmd) applyObject(clients *applyClients, obj *unstructured.Unstructured, dryRunText string) (metav1.Object, error) {
+	if c.GcTag != "" {
+		utils.SetMetaDataAnnotation(obj, AnnotationGcTag, c.GcTag)
+	}
+
+	var generation int
+	c.ClientPool, c.Discovery, generation = clients.get()
+
+	desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+	log.Info("Updating ", desc, dryRunText)
+
+	newobj, err := c.updateObject(obj, desc, dryRunText)
+
+	// Long applies can outlive the credentials they started with (e.g.,
+	// short-lived OIDC tokens). Rebuilding the clients re-runs the
+	// kubeconfig auth provider, which refreshes the token.
+	for attempt := 1; errors.IsUnauthorized(err) && c.Reconnect != nil && attempt <= maxReauthAttempts; attempt++ {
+		backoff := time.Duration(1<<uint(attempt-1)) * reauthBackoff
+		log.Warnf("Credentials rejected while updating %s; refreshing credentials and retrying in %s (attempt %d/%d)", desc, backoff, attempt, maxReauthAttempts)
+		time.Sleep(backoff)
+
+		if err := clients.reconnect(generation, c.Reconnect); err != nil {
+			return nil, fmt.Errorf("Error refreshing credentials: %s", err)
+		}
+		c.ClientPool, c.Discovery, generation = clients.get()
+		newobj, err = c.updateObject(obj, desc, dryRunText)
+	}
+	if err != nil {
+		// TODO: retry
+		return nil, fmt.Errorf("Error updating %s: %s", desc, err)
+	}
+
+	log.Debug("Updated object: ", diff.ObjectDiff(obj, newobj))
+	return newobj, nil
+}
+
+// applyClients holds the clients shared by the workers of an apply. They are
+// replaced when the server rejects their credentials.
+type applyClients struct {
+	mu    sync.Mutex
+	pool  dynamic.ClientPool
+	disco discovery.DiscoveryInterface
+	// generation counts the replacements, so that workers whose credentials
+	// are rejected at the same time only refresh them once.
+	generation int
+}
+
+func (ac *applyClients) get() (dynamic.ClientPool, discovery.DiscoveryInterface, int) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return ac.pool, ac.disco, ac.generation
+}
+
+// reconnect rebuilds the clients with `reconnect`, unless they have been
+// rebuilt since the caller got them (i.e., since `generation`).
+func (ac *applyClients) reconnect(generation int, reconnect func() (dynamic.ClientPool, discovery.DiscoveryInterface, error)) error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.generation != generation {
+		return nil
+	}
+	pool, disco, err := reconnect()
+	if err != nil {
+		return err
+	}
+	ac.pool, ac.disco = pool, disco
+	ac.generation++
+	return nil
+}
+
+// forEachObject calls `fn` on each of `objs`, running up to `workers` calls
+// at once. After the first error, no new calls are started; the error is
+// returned once the calls already running have finished.
+func forEachObject(objs []*unstructured.Unstructured, workers int, fn func(*unstructured.Unstructured) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, workers)
+	for _, obj := range objs {
+		sem <- struct{}{}
+
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(obj *unstructured.Unstructured) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(obj); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(obj)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// updateObject patches `obj` on the server (or, in a dry run, retrieves it),
+// creating it if it does not exist and `c.Create` is set.
+func (c ApplyCmd) updateObject(obj *unstructured.Unstructured, desc, dryRunText string) (metav1.Object, error) {
+	rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := jobRerunPolicy(obj, c.Components)
+	if err != nil {
+		return nil, err
+	}
+	if policy == metadata.JobRerunSkip || policy == metadata.JobRerunRecreate {
+		existing, err := rc.Get(obj.GetName())
+		if err == nil {
+			return c.rerunJob(rc, obj, existing, policy, desc, dryRunText)
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	asPatch, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var newobj metav1.Object
+	if !c.DryRun {
+		newobj, err = rc.Patch(obj.GetName(), types.MergePatchType, asPatch)
+		log.Debugf("Patch(%s) returned (%v, %v)", obj.GetName(), newobj, err)
+		if policy == metadata.JobRerunFail && errors.IsInvalid(err) {
+			return nil, jobUpdateError(obj, err)
+		}
+	} else {
+		newobj, err = rc.Get(obj.GetName())
+	}
+	if c.Create && errors.IsNotFound(err) {
+		log.Info(" Creating non-existent ", desc, dryRunText)
+		if !c.DryRun {
+			newobj, err = rc.Create(obj)
+			log.Debugf("Create(%s) returned (%v, %v)", obj.GetName(), newobj, err)
+		} else {
+			newobj = obj
+			err = nil
+		}
+	}
+
+	return newobj, err
+}
+
 func stringListContains(list []string, value string) bool {
 	for _, item := range list {
 		if item == value {
@@ -1,11 +1,19 @@
 package kubecfg
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
 	"github.com/ksonnet/ksonnet/utils"
 )
 
@@ -79,3 +87,198 @@ func TestEligibleForGc(t *testing.T) {
 		t.Errorf("%v should not be eligible (controller ownerref)", o)
 	}
 }
+
+func TestForEachObject(t *testing.T) {
+	objs := []*unstructured.Unstructured{}
+	for i := 0; i < 20; i++ {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetName(fmt.Sprintf("obj-%d", i))
+		objs = append(objs, obj)
+	}
+
+	var mu sync.Mutex
+	running, maxRunning, calls := 0, 0, 0
+	err := forEachObject(objs, 4, func(obj *unstructured.Unstructured) error {
+		mu.Lock()
+		running++
+		calls++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls != len(objs) {
+		t.Errorf("Expected %d calls, got %d", len(objs), calls)
+	}
+	if maxRunning < 2 || maxRunning > 4 {
+		t.Errorf("Expected between 2 and 4 concurrent calls, got %d", maxRunning)
+	}
+
+	// One at a time, nothing is started after the first failure.
+	calls = 0
+	err = forEachObject(objs, 1, func(obj *unstructured.Unstructured) error {
+		calls++
+		if obj.GetName() == "obj-2" {
+			return fmt.Errorf("failed on %s", obj.GetName())
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "failed on obj-2" {
+		t.Errorf("Expected error from obj-2, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls before stopping, got %d", calls)
+	}
+}
+
+func TestApplyClientsReconnect(t *testing.T) {
+	reconnects := 0
+	reconnect := func() (dynamic.ClientPool, discovery.DiscoveryInterface, error) {
+		reconnects++
+		return nil, nil, nil
+	}
+
+	clients := &applyClients{}
+	_, _, generation := clients.get()
+
+	// Two workers rejected with the same clients only reconnect once.
+	for i := 0; i < 2; i++ {
+		if err := clients.reconnect(generation, reconnect); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if reconnects != 1 {
+		t.Errorf("Expected 1 reconnect, got %d", reconnects)
+	}
+
+	_, _, generation = clients.get()
+	if err := clients.reconnect(generation, reconnect); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reconnects != 2 {
+		t.Errorf("Expected 2 reconnects, got %d", reconnects)
+	}
+}
+
+func TestApplyWaitsForCustomResourceDefinitions(t *testing.T) {
+	defer func(interval time.Duration) { waitPollInterval = interval }(waitPollInterval)
+	waitPollInterval = time.Millisecond
+
+	crd := `{
+		"apiVersion": "apiextensions.k8s.io/v1beta1",
+		"kind": "CustomResourceDefinition",
+		"metadata": {"name": "widgets.example.com"},
+		"spec": {"group": "example.com", "version": "v1", "names": {"kind": "Widget", "plural": "widgets"}}
+	}`
+	config := `{
+		"apiVersion": "v1",
+		"kind": "ConfigMap",
+		"metadata": {"name": "widget-config", "namespace": "default", "annotations": {"ksonnet.io/apply-wave": "1"}}
+	}`
+
+	for _, established := range []bool{false, true} {
+		cluster := newFakeCluster(t)
+		if established {
+			cluster.written = func(obj map[string]interface{}) {
+				if obj["kind"] == "CustomResourceDefinition" {
+					obj["status"] = map[string]interface{}{
+						"conditions": []interface{}{map[string]interface{}{"type": "Established", "status": "True"}},
+					}
+				}
+			}
+		}
+
+		c := ApplyCmd{
+			ClientPool:  cluster,
+			Discovery:   cluster.discovery(),
+			Namespace:   "default",
+			Create:      true,
+			WaveTimeout: 20 * time.Millisecond,
+		}
+		err := c.Run([]*unstructured.Unstructured{mustUnstructured(t, crd), mustUnstructured(t, config)}, "")
+		created := len(cluster.requested("POST"))
+		cluster.Close()
+
+		if established {
+			if err != nil || created != 2 {
+				t.Errorf("Expected both waves to be applied once the definition is established, got %d object(s) created and error: %v", created, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), "Wave 0 did not become ready") || created != 1 {
+			t.Errorf("Expected the apply to stop at a definition that is not established, got %d object(s) created and error: %v", created, err)
+		}
+	}
+}
+
+func TestApplyReconnects(t *testing.T) {
+	defer func(backoff time.Duration) { reauthBackoff = backoff }(reauthBackoff)
+	reauthBackoff = time.Millisecond
+
+	config := `{
+		"apiVersion": "v1",
+		"kind": "ConfigMap",
+		"metadata": {"name": "config", "namespace": "default"}
+	}`
+
+	tests := []struct {
+		// rejected is the number of requests whose credentials are rejected.
+		rejected   int
+		reconnect  bool
+		reconnects int
+		created    bool
+	}{
+		{rejected: 1, reconnect: true, reconnects: 1, created: true},
+		{rejected: maxReauthAttempts, reconnect: true, reconnects: maxReauthAttempts, created: true},
+		{rejected: 100, reconnect: true, reconnects: maxReauthAttempts, created: false},
+		{rejected: 1, reconnect: false, reconnects: 0, created: false},
+	}
+
+	for _, test := range tests {
+		cluster := newFakeCluster(t)
+		rejected := 0
+		cluster.intercept = func(r *http.Request) int {
+			if rejected < test.rejected {
+				rejected++
+				return http.StatusUnauthorized
+			}
+			return 0
+		}
+
+		reconnects := 0
+		c := ApplyCmd{
+			ClientPool: cluster,
+			Discovery:  cluster.discovery(),
+			Namespace:  "default",
+			Create:     true,
+		}
+		if test.reconnect {
+			c.Reconnect = func() (dynamic.ClientPool, discovery.DiscoveryInterface, error) {
+				reconnects++
+				return cluster, cluster.discovery(), nil
+			}
+		}
+
+		err := c.Run([]*unstructured.Unstructured{mustUnstructured(t, config)}, "")
+		created := cluster.get(config) != nil
+		cluster.Close()
+
+		if reconnects != test.reconnects {
+			t.Errorf("Expected %d reconnect(s) after %d rejected request(s), got %d", test.reconnects, test.rejected, reconnects)
+		}
+		if created != test.created || (err == nil) != test.created {
+			t.Errorf("Expected the object to be created=%t after %d rejected request(s), got created=%t and error: %v", test.created, test.rejected, created, err)
+		}
+		if !test.created && (err == nil || !strings.Contains(err.Error(), "Unauthorized")) {
+			t.Errorf("Expected the rejected credentials to be reported, got %v", err)
+		}
+	}
+}
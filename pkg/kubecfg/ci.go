@@ -0,0 +1,134 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/pkg/ci"
+)
+
+// CIInitCmd generates a CI pipeline definition for an application.
+type CIInitCmd struct {
+	// Provider is one of `ci.Providers`.
+	Provider string
+	// Branch is the branch whose changes are applied once merged.
+	Branch string
+	// OutputDir is the directory the pipeline definition is written under,
+	// usually the root of the repository. It defaults to the application's
+	// root.
+	OutputDir string
+	// Envs are the environments that proposed changes are checked against.
+	// They default to every environment of the application.
+	Envs []string
+	// ApplyEnvs are the environments applied, in order, when changes are
+	// merged. They default to `Envs`.
+	ApplyEnvs []string
+	// Force overwrites an existing pipeline definition.
+	Force bool
+
+	manager metadata.Manager
+}
+
+func NewCIInitCmd(provider, branch string, manager metadata.Manager) (*CIInitCmd, error) {
+	return &CIInitCmd{Provider: provider, Branch: branch, manager: manager}, nil
+}
+
+func (c *CIInitCmd) Run() error {
+	envs, err := c.resolveEnvs(c.Envs)
+	if err != nil {
+		return err
+	}
+	if len(envs) == 0 {
+		all, err := c.manager.GetEnvironments()
+		if err != nil {
+			return err
+		}
+		for _, env := range all {
+			envs = append(envs, env.Name)
+		}
+		sort.Strings(envs)
+	}
+
+	applyEnvs, err := c.resolveEnvs(c.ApplyEnvs)
+	if err != nil {
+		return err
+	}
+	if len(applyEnvs) == 0 {
+		applyEnvs = envs
+	}
+
+	outputDir := c.OutputDir
+	if outputDir == "" {
+		outputDir = string(c.manager.Root())
+	}
+	outputDir, err = filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+	appDir, err := filepath.Rel(outputDir, string(c.manager.Root()))
+	if err != nil {
+		return err
+	}
+
+	file, err := ci.Generate(c.Provider, &ci.Config{
+		AppDir:    filepath.ToSlash(appDir),
+		Branch:    c.Branch,
+		CheckEnvs: envs,
+		ApplyEnvs: applyEnvs,
+	})
+	if err != nil {
+		return err
+	}
+
+	p := filepath.Join(outputDir, filepath.FromSlash(file.Path))
+	if _, err := os.Stat(p); err == nil && !c.Force {
+		return fmt.Errorf("Pipeline definition '%s' already exists; use --force to overwrite it", p)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p, file.Data, 0644); err != nil {
+		return err
+	}
+
+	log.Infof("Wrote %s pipeline to '%s', checking %d and applying %d environments", c.Provider, p, len(envs), len(applyEnvs))
+	return nil
+}
+
+// resolveEnvs returns the names of the environments `names` refer to (which
+// may be aliases), failing if any does not exist.
+func (c *CIInitCmd) resolveEnvs(names []string) ([]string, error) {
+	resolved := []string{}
+	for _, name := range names {
+		env, err := c.manager.GetEnvironment(name)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, env.Name)
+	}
+	return resolved, nil
+}
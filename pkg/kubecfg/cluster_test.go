@@ -0,0 +1,369 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	ktesting "k8s.io/client-go/testing"
+)
+
+// fakeCluster is an in-memory API server for the tests of commands that talk
+// to a cluster. It stores the objects written to it (applying merge patches
+// as the API server does), and serves them back.
+type fakeCluster struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]map[string]interface{}
+	version int
+	// requests records each request served, as "<METHOD> <path>".
+	requests []string
+	// intercept, if set, is called before each request is served. A non-zero
+	// status fails the request with that status.
+	intercept func(r *http.Request) int
+	// written, if set, is called with each object written, e.g., to simulate
+	// a controller updating its status.
+	written func(obj map[string]interface{})
+}
+
+// fakeResources are the resources served by `fakeCluster`.
+var fakeResources = []*metav1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+			{Name: "namespaces", Kind: "Namespace"},
+			{Name: "pods", Kind: "Pod", Namespaced: true},
+			{Name: "services", Kind: "Service", Namespaced: true},
+		},
+	},
+	{
+		GroupVersion: "apps/v1beta1",
+		APIResources: []metav1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Namespaced: true},
+		},
+	},
+	{
+		GroupVersion: "batch/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "jobs", Kind: "Job", Namespaced: true},
+		},
+	},
+	{
+		GroupVersion: "apiextensions.k8s.io/v1beta1",
+		APIResources: []metav1.APIResource{
+			{Name: "customresourcedefinitions", Kind: "CustomResourceDefinition"},
+		},
+	},
+}
+
+func newFakeCluster(t *testing.T) *fakeCluster {
+	c := &fakeCluster{t: t, objects: map[string]map[string]interface{}{}}
+	c.server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+func (c *fakeCluster) Close() {
+	c.server.Close()
+}
+
+// discovery returns a discovery client for the resources of the cluster.
+func (c *fakeCluster) discovery() *fakeClusterDiscovery {
+	return &fakeClusterDiscovery{&fakediscovery.FakeDiscovery{Fake: &ktesting.Fake{Resources: fakeResources}}}
+}
+
+type fakeClusterDiscovery struct {
+	*fakediscovery.FakeDiscovery
+}
+
+func (d *fakeClusterDiscovery) ServerVersion() (*version.Info, error) {
+	return &version.Info{Major: "1", Minor: "7", GitVersion: "v1.7.0"}, nil
+}
+
+func (c *fakeCluster) ClientForGroupVersionKind(gvk schema.GroupVersionKind) (*dynamic.Client, error) {
+	return c.ClientForGroupVersionResource(gvk.GroupVersion().WithResource(""))
+}
+
+func (c *fakeCluster) ClientForGroupVersionResource(gvr schema.GroupVersionResource) (*dynamic.Client, error) {
+	gv := gvr.GroupVersion()
+	apiPath := "/apis"
+	if gv.Group == "" {
+		apiPath = "/api"
+	}
+	return dynamic.NewClient(&rest.Config{
+		Host:          c.server.URL,
+		APIPath:       apiPath,
+		ContentConfig: rest.ContentConfig{GroupVersion: &gv},
+	})
+}
+
+// objectPath returns the path `obj` is served at.
+func (c *fakeCluster) objectPath(obj map[string]interface{}) string {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+
+	for _, list := range fakeResources {
+		if list.GroupVersion != apiVersion {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if r.Kind != kind {
+				continue
+			}
+			path := "/apis/" + apiVersion
+			if !strings.Contains(apiVersion, "/") {
+				path = "/api/" + apiVersion
+			}
+			if r.Namespaced {
+				path += "/namespaces/" + namespace
+			}
+			return path + "/" + r.Name + "/" + name
+		}
+	}
+	c.t.Fatalf("No resource serves %s %s", apiVersion, kind)
+	return ""
+}
+
+// add stores the object `text` in the cluster.
+func (c *fakeCluster) add(text string) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(text), &obj); err != nil {
+		c.t.Fatalf("Failed to parse '%s':\n%v", text, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[c.objectPath(obj)] = obj
+}
+
+// get returns the stored object `text` identifies (by its API version, kind,
+// name and namespace), or nil if there is none.
+func (c *fakeCluster) get(text string) map[string]interface{} {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(text), &obj); err != nil {
+		c.t.Fatalf("Failed to parse '%s':\n%v", text, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.objects[c.objectPath(obj)]
+}
+
+// requested returns the requests served whose method is `method`.
+func (c *fakeCluster) requested(method string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths := []string{}
+	for _, r := range c.requests {
+		if strings.HasPrefix(r, method+" ") {
+			paths = append(paths, strings.TrimPrefix(r, method+" "))
+		}
+	}
+	return paths
+}
+
+func (c *fakeCluster) serve(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.Path)
+
+	if c.intercept != nil {
+		if code := c.intercept(r); code != 0 {
+			writeStatus(w, code, http.StatusText(code))
+			return
+		}
+	}
+
+	var body map[string]interface{}
+	if data, err := ioutil.ReadAll(r.Body); err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			writeStatus(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	path := r.URL.Path
+	existing, exists := c.objects[path]
+	switch r.Method {
+	case "GET":
+		if exists {
+			writeObject(w, http.StatusOK, existing)
+			return
+		}
+		if items := c.list(path); items != nil {
+			writeObject(w, http.StatusOK, map[string]interface{}{"kind": "List", "apiVersion": "v1", "metadata": map[string]interface{}{}, "items": items})
+			return
+		}
+	case "POST":
+		metadata, _ := body["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if name == "" {
+			if prefix, _ := metadata["generateName"].(string); prefix != "" {
+				c.version++
+				name = fmt.Sprintf("%s%05d", prefix, c.version)
+				metadata["name"] = name
+			}
+		}
+		path += "/" + name
+		if _, ok := c.objects[path]; ok {
+			writeStatus(w, http.StatusConflict, "AlreadyExists")
+			return
+		}
+		c.write(path, nil, body)
+		writeObject(w, http.StatusCreated, c.objects[path])
+		return
+	case "PUT":
+		if exists {
+			c.write(path, existing, body)
+			writeObject(w, http.StatusOK, c.objects[path])
+			return
+		}
+	case "PATCH":
+		if exists {
+			patched := mergePatch(deepCopyJSON(existing), body)
+			c.write(path, existing, patched)
+			writeObject(w, http.StatusOK, c.objects[path])
+			return
+		}
+	case "DELETE":
+		if exists {
+			delete(c.objects, path)
+			writeObject(w, http.StatusOK, map[string]interface{}{"kind": "Status", "apiVersion": "v1", "status": "Success"})
+			return
+		}
+	}
+	writeStatus(w, http.StatusNotFound, "NotFound")
+}
+
+// write stores `obj` at `path`, replacing `old`, and sets the fields the
+// server maintains: the UID, resource version, and (when the spec changes)
+// generation.
+func (c *fakeCluster) write(path string, old, obj map[string]interface{}) {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		obj["metadata"] = metadata
+	}
+	c.version++
+	metadata["resourceVersion"] = fmt.Sprintf("%d", c.version)
+
+	generation := float64(1)
+	if old != nil {
+		oldMetadata, _ := old["metadata"].(map[string]interface{})
+		metadata["uid"] = oldMetadata["uid"]
+		generation, _ = oldMetadata["generation"].(float64)
+		if !reflect.DeepEqual(old["spec"], obj["spec"]) {
+			generation++
+		}
+		if _, ok := obj["status"]; !ok {
+			obj["status"] = old["status"]
+		}
+	} else {
+		metadata["uid"] = fmt.Sprintf("uid-%d", c.version)
+	}
+	metadata["generation"] = generation
+
+	if c.written != nil {
+		c.written(obj)
+	}
+	c.objects[path] = obj
+}
+
+// list returns the objects in the collection at `path`, or nil if `path` is
+// not that of a collection.
+func (c *fakeCluster) list(path string) []interface{} {
+	for _, list := range fakeResources {
+		for _, r := range list.APIResources {
+			if strings.HasSuffix(path, "/"+r.Name) {
+				keys := []string{}
+				for key := range c.objects {
+					if strings.HasPrefix(key, path+"/") && !strings.Contains(strings.TrimPrefix(key, path+"/"), "/") {
+						keys = append(keys, key)
+					}
+				}
+				sort.Strings(keys)
+				items := []interface{}{}
+				for _, key := range keys {
+					items = append(items, c.objects[key])
+				}
+				return items
+			}
+		}
+	}
+	return nil
+}
+
+// mergePatch applies the JSON merge patch `patch` to `obj`.
+func mergePatch(obj, patch map[string]interface{}) map[string]interface{} {
+	for key, value := range patch {
+		if value == nil {
+			delete(obj, key)
+			continue
+		}
+		if patchMap, ok := value.(map[string]interface{}); ok {
+			objMap, ok := obj[key].(map[string]interface{})
+			if !ok {
+				objMap = map[string]interface{}{}
+			}
+			obj[key] = mergePatch(objMap, patchMap)
+			continue
+		}
+		obj[key] = value
+	}
+	return obj
+}
+
+func deepCopyJSON(obj map[string]interface{}) map[string]interface{} {
+	data, _ := json.Marshal(obj)
+	copied := map[string]interface{}{}
+	json.Unmarshal(data, &copied)
+	return copied
+}
+
+func writeObject(w http.ResponseWriter, code int, obj map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(obj)
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason string) {
+	writeObject(w, code, map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"status":     "Failure",
+		"reason":     reason,
+		"message":    reason,
+		"code":       code,
+	})
+}
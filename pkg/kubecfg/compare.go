@@ -0,0 +1,214 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+const (
+	// compareUnset is shown for fields an object does not set.
+	compareUnset = "<none>"
+	// compareAbsent is shown for objects an environment does not render.
+	compareAbsent = "<absent>"
+)
+
+// CompareCmd prints a matrix of the values of selected fields of the objects
+// rendered for several environments, with a row per object and field, and a
+// column per environment.
+type CompareCmd struct {
+	// Envs are the names of the environments, in the order of their columns.
+	Envs []string
+	// Fields are the paths of the fields to compare, e.g., 'spec.replicas',
+	// or 'spec.template.spec.containers[0].image'.
+	Fields []string
+	// Kind, if set, restricts the comparison to objects of this kind.
+	Kind string
+}
+
+// compareRow identifies the object a row of the matrix describes.
+type compareRow struct {
+	component, kind, name string
+}
+
+// Run prints the matrix for `rendered`, which holds the objects rendered for
+// each of `c.Envs`, in the same order.
+func (c CompareCmd) Run(rendered [][]*unstructured.Unstructured, out io.Writer) error {
+	if len(c.Fields) == 0 {
+		return fmt.Errorf("At least one field to compare is required")
+	}
+	paths := [][]string{}
+	for _, field := range c.Fields {
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+
+	byEnv := []map[compareRow]*unstructured.Unstructured{}
+	rows := []compareRow{}
+	seen := map[compareRow]bool{}
+	for _, objs := range rendered {
+		byRow := map[compareRow]*unstructured.Unstructured{}
+		for _, obj := range objs {
+			if c.Kind != "" && !strings.EqualFold(obj.GetKind(), c.Kind) {
+				continue
+			}
+			row := compareRow{component: obj.GetLabels()[utils.ComponentLabel], kind: obj.GetKind(), name: obj.GetName()}
+			byRow[row] = obj
+			if !seen[row] {
+				seen[row] = true
+				rows = append(rows, row)
+			}
+		}
+		byEnv = append(byEnv, byRow)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.component != b.component {
+			return a.component < b.component
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.name < b.name
+	})
+
+	table := [][]string{append([]string{"COMPONENT", "OBJECT", "FIELD"}, c.Envs...)}
+	for _, row := range rows {
+		for i, path := range paths {
+			line := []string{row.component, strings.ToLower(row.kind) + "/" + row.name, c.Fields[i]}
+			for _, byRow := range byEnv {
+				obj, ok := byRow[row]
+				if !ok {
+					line = append(line, compareAbsent)
+					continue
+				}
+				value, err := fieldValue(obj.Object, path)
+				if err != nil {
+					return err
+				}
+				line = append(line, value)
+			}
+			table = append(table, line)
+		}
+	}
+
+	return writeTable(out, table)
+}
+
+// fieldPathSegment matches a segment of a field path: a name, optionally
+// followed by list indices, e.g., 'containers[0]'.
+var fieldPathSegment = regexp.MustCompile(`^([^\[\]]+)((?:\[\d+\])*)$`)
+
+// parseFieldPath splits a field path such as
+// 'spec.template.spec.containers[0].image' into its map keys and list
+// indices.
+func parseFieldPath(field string) ([]string, error) {
+	path := []string{}
+	for _, segment := range strings.Split(field, ".") {
+		match := fieldPathSegment.FindStringSubmatch(segment)
+		if match == nil {
+			return nil, fmt.Errorf("Invalid field path '%s'", field)
+		}
+		path = append(path, match[1])
+		if match[2] != "" {
+			for _, index := range strings.Split(strings.Trim(match[2], "[]"), "][") {
+				path = append(path, "["+index+"]")
+			}
+		}
+	}
+	return path, nil
+}
+
+// fieldValue returns the value at `path` in `obj`, formatted for display:
+// strings and numbers as they are, and lists and maps as JSON.
+func fieldValue(obj map[string]interface{}, path []string) (string, error) {
+	var curr interface{} = obj
+	for _, segment := range path {
+		if strings.HasPrefix(segment, "[") {
+			list, ok := curr.([]interface{})
+			index, _ := strconv.Atoi(strings.Trim(segment, "[]"))
+			if !ok || index >= len(list) {
+				return compareUnset, nil
+			}
+			curr = list[index]
+			continue
+		}
+		m, ok := curr.(map[string]interface{})
+		if !ok {
+			return compareUnset, nil
+		}
+		if curr, ok = m[segment]; !ok {
+			return compareUnset, nil
+		}
+	}
+
+	switch v := curr.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return compareUnset, nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return fmt.Sprint(curr), nil
+}
+
+// writeTable writes `table` to `out`, padding each column to its widest cell.
+func writeTable(out io.Writer, table [][]string) error {
+	widths := []int{}
+	for _, row := range table {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	for _, row := range table {
+		line := ""
+		for i, cell := range row {
+			if i == len(row)-1 {
+				line += cell
+			} else {
+				line += cell + strings.Repeat(" ", widths[i]-len(cell)+1)
+			}
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
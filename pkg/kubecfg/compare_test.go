@@ -0,0 +1,80 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+func TestCompare(t *testing.T) {
+	deployment := func(component, name string, spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1beta1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":   name,
+				"labels": map[string]interface{}{utils.ComponentLabel: component},
+			},
+			"spec": spec,
+		}}
+	}
+	containers := func(image string) map[string]interface{} {
+		return map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"image": image}},
+		}}
+	}
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "web"},
+	}}
+
+	rendered := [][]*unstructured.Unstructured{
+		{
+			deployment("web", "web", map[string]interface{}{"replicas": int64(3), "template": containers("web:1.2")}),
+			deployment("api", "api", map[string]interface{}{"replicas": float64(2)}),
+			service,
+		},
+		{
+			deployment("web", "web", map[string]interface{}{"replicas": int64(1), "template": containers("web:1.3")}),
+		},
+	}
+
+	var out bytes.Buffer
+	c := CompareCmd{
+		Envs:   []string{"prod", "dev"},
+		Fields: []string{"spec.replicas", "spec.template.spec.containers[0].image"},
+		Kind:   "deployment",
+	}
+	require.NoError(t, c.Run(rendered, &out))
+
+	expected := `COMPONENT OBJECT         FIELD                                  prod    dev
+api       deployment/api spec.replicas                          2       <absent>
+api       deployment/api spec.template.spec.containers[0].image <none>  <absent>
+web       deployment/web spec.replicas                          3       1
+web       deployment/web spec.template.spec.containers[0].image web:1.2 web:1.3
+`
+	require.Equal(t, expected, out.String())
+
+	c = CompareCmd{Envs: []string{"prod"}, Fields: []string{"spec..replicas"}}
+	require.EqualError(t, c.Run(rendered[:1], &out), "Invalid field path 'spec..replicas'")
+}
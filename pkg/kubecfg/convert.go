@@ -0,0 +1,307 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/prototype"
+)
+
+// ksonnetLibConstructors maps the API version and kind of well-known objects to
+// the ksonnet-lib type whose mixins set their metadata.
+var ksonnetLibConstructors = map[string]string{
+	"v1/ConfigMap":                                         "k.core.v1.configMap",
+	"v1/Namespace":                                         "k.core.v1.namespace",
+	"v1/PersistentVolume":                                  "k.core.v1.persistentVolume",
+	"v1/PersistentVolumeClaim":                             "k.core.v1.persistentVolumeClaim",
+	"v1/Pod":                                               "k.core.v1.pod",
+	"v1/Secret":                                            "k.core.v1.secret",
+	"v1/Service":                                           "k.core.v1.service",
+	"v1/ServiceAccount":                                    "k.core.v1.serviceAccount",
+	"apps/v1beta1/Deployment":                              "k.apps.v1beta1.deployment",
+	"apps/v1beta1/StatefulSet":                             "k.apps.v1beta1.statefulSet",
+	"autoscaling/v1/HorizontalPodAutoscaler":               "k.autoscaling.v1.horizontalPodAutoscaler",
+	"batch/v1/Job":                                         "k.batch.v1.job",
+	"extensions/v1beta1/DaemonSet":                         "k.extensions.v1beta1.daemonSet",
+	"extensions/v1beta1/Deployment":                        "k.extensions.v1beta1.deployment",
+	"extensions/v1beta1/Ingress":                           "k.extensions.v1beta1.ingress",
+	"extensions/v1beta1/ReplicaSet":                        "k.extensions.v1beta1.replicaSet",
+	"policy/v1beta1/PodDisruptionBudget":                   "k.policy.v1beta1.podDisruptionBudget",
+	"rbac.authorization.k8s.io/v1beta1/ClusterRole":        "k.rbac.v1beta1.clusterRole",
+	"rbac.authorization.k8s.io/v1beta1/ClusterRoleBinding": "k.rbac.v1beta1.clusterRoleBinding",
+	"rbac.authorization.k8s.io/v1beta1/Role":               "k.rbac.v1beta1.role",
+	"rbac.authorization.k8s.io/v1beta1/RoleBinding":        "k.rbac.v1beta1.roleBinding",
+}
+
+// ConvertCmd represents the convert subcommand
+type ConvertCmd struct {
+	// Component, if set, is the name of the component to write the converted
+	// Jsonnet to. Otherwise the Jsonnet is written to the output.
+	Component string
+	Manager   metadata.Manager
+}
+
+func (c ConvertCmd) Run(data []byte, out io.Writer) error {
+	text, err := convertToJsonnet(data)
+	if err != nil {
+		return err
+	}
+
+	if c.Component == "" {
+		_, err = io.WriteString(out, text)
+		return err
+	}
+	return c.Manager.CreateComponent(c.Component, text, prototype.Jsonnet)
+}
+
+// documentSeparator matches the lines that separate documents in a YAML
+// stream.
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*(#.*)?$`)
+
+// convertToJsonnet converts a stream of YAML (or JSON) documents describing
+// Kubernetes objects to Jsonnet. Objects whose kind is known have their
+// metadata set with the corresponding ksonnet-lib type's mixins; all others
+// are emitted as plain object literals. A stream of several objects is emitted
+// as an array.
+func convertToJsonnet(data []byte) (string, error) {
+	objs := []yaml.MapSlice{}
+	for _, doc := range documentSeparator.Split(string(data), -1) {
+		var obj yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return "", fmt.Errorf("Failed to parse manifest:\n%v", err)
+		}
+		if len(obj) > 0 {
+			objs = append(objs, obj)
+		}
+	}
+
+	if len(objs) == 0 {
+		return "", fmt.Errorf("Manifest contains no objects")
+	}
+
+	// Declare a local for each constructor used, in a stable order.
+	types := map[string]string{}
+	exprs := []string{}
+	for _, obj := range objs {
+		expr, constructor, err := convertObject(obj)
+		if err != nil {
+			return "", err
+		}
+		if constructor != "" {
+			types[constructorLocal(constructor)] = constructor
+		}
+		exprs = append(exprs, expr)
+	}
+
+	var buf bytes.Buffer
+	if len(types) > 0 {
+		locals := []string{}
+		for local := range types {
+			locals = append(locals, local)
+		}
+		sort.Strings(locals)
+
+		buf.WriteString("local k = import \"k.libsonnet\";\n")
+		for _, local := range locals {
+			fmt.Fprintf(&buf, "local %s = %s;\n", local, types[local])
+		}
+		buf.WriteString("\n")
+	}
+
+	if len(exprs) == 1 {
+		buf.WriteString(exprs[0])
+		buf.WriteString("\n")
+		return buf.String(), nil
+	}
+
+	buf.WriteString("[\n")
+	for _, expr := range exprs {
+		buf.WriteString(indentJsonnet(expr, 1))
+		buf.WriteString(",\n")
+	}
+	buf.WriteString("]\n")
+	return buf.String(), nil
+}
+
+// constructorLocal returns the name of the local variable that holds the
+// ksonnet-lib type `constructor`, e.g., `deployment` for
+// `k.apps.v1beta1.deployment`. Where the same kind exists in several groups,
+// the group version is prepended (e.g., `extensionsV1beta1Deployment`).
+func constructorLocal(constructor string) string {
+	parts := strings.Split(constructor, ".")
+	kind := parts[len(parts)-1]
+	for other, otherConstructor := range ksonnetLibConstructors {
+		if otherConstructor != constructor && strings.HasSuffix(other, "/"+strings.ToUpper(kind[:1])+kind[1:]) {
+			version := parts[len(parts)-2]
+			return parts[len(parts)-3] + strings.ToUpper(version[:1]) + version[1:] + strings.ToUpper(kind[:1]) + kind[1:]
+		}
+	}
+	return kind
+}
+
+// convertObject converts a single object to a Jsonnet expression, returning
+// the ksonnet-lib type used, if any.
+func convertObject(obj yaml.MapSlice) (string, string, error) {
+	var apiVersion, kind string
+	for _, item := range obj {
+		switch item.Key {
+		case "apiVersion":
+			apiVersion, _ = item.Value.(string)
+		case "kind":
+			kind, _ = item.Value.(string)
+		}
+	}
+
+	constructor, ok := ksonnetLibConstructors[apiVersion+"/"+kind]
+	if !ok {
+		expr, err := jsonnetValue(obj, 0)
+		return expr, "", err
+	}
+
+	// The name, namespace, and labels are set with mixins, onto an object
+	// literal with everything else. The ksonnet-lib constructors are not used,
+	// as some of them (e.g., `service.new(name, selector, ports)`) take
+	// arguments that differ between versions of ksonnet-lib.
+	local := constructorLocal(constructor)
+	mixins := []string{}
+	rest := yaml.MapSlice{}
+	for _, item := range obj {
+		switch item.Key {
+		case "metadata":
+			md, ok := item.Value.(yaml.MapSlice)
+			if !ok {
+				return "", "", fmt.Errorf("Object '%s' has malformed metadata", kind)
+			}
+			mdRest := yaml.MapSlice{}
+			for _, mdItem := range md {
+				switch mdItem.Key {
+				case "name", "namespace", "labels":
+					value, err := jsonnetValue(mdItem.Value, 0)
+					if err != nil {
+						return "", "", err
+					}
+					mixins = append(mixins, fmt.Sprintf("%s.mixin.metadata.%s(%s)", local, mdItem.Key, value))
+				default:
+					mdRest = append(mdRest, mdItem)
+				}
+			}
+			if len(mdRest) > 0 {
+				rest = append(rest, yaml.MapItem{Key: "metadata", Value: mdRest})
+			}
+		default:
+			rest = append(rest, item)
+		}
+	}
+
+	value, err := jsonnetValue(rest, 0)
+	if err != nil {
+		return "", "", err
+	}
+
+	return strings.Join(append([]string{value}, mixins...), " +\n"), constructor, nil
+}
+
+var jsonnetIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+var jsonnetKeywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true,
+	"function": true, "if": true, "import": true, "importstr": true, "in": true,
+	"local": true, "null": true, "self": true, "super": true, "tailstrict": true,
+	"then": true, "true": true,
+}
+
+// jsonnetField renders an object key as a Jsonnet field name, quoting it only
+// if necessary.
+func jsonnetField(key string) string {
+	if jsonnetIdentifier.MatchString(key) && !jsonnetKeywords[key] {
+		return key + ":"
+	}
+	quoted, _ := json.Marshal(key)
+	return string(quoted) + ":"
+}
+
+// jsonnetValue renders a value decoded from YAML as Jsonnet, indented to
+// `depth` levels.
+func jsonnetValue(v interface{}, depth int) (string, error) {
+	indent := strings.Repeat("  ", depth)
+
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		if len(v) == 0 {
+			return "{}", nil
+		}
+		var buf bytes.Buffer
+		buf.WriteString("{\n")
+		for _, item := range v {
+			key, ok := item.Key.(string)
+			if !ok {
+				key = fmt.Sprintf("%v", item.Key)
+			}
+			value, err := jsonnetValue(item.Value, depth+1)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&buf, "%s  %s %s,\n", indent, jsonnetField(key), value)
+		}
+		buf.WriteString(indent + "}")
+		return buf.String(), nil
+	case []interface{}:
+		if len(v) == 0 {
+			return "[]", nil
+		}
+		var buf bytes.Buffer
+		buf.WriteString("[\n")
+		for _, elem := range v {
+			value, err := jsonnetValue(elem, depth+1)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&buf, "%s  %s,\n", indent, value)
+		}
+		buf.WriteString(indent + "]")
+		return buf.String(), nil
+	case nil:
+		return "null", nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("Could not convert value '%v' to Jsonnet: %v", v, err)
+		}
+		return string(data), nil
+	}
+}
+
+// indentJsonnet indents every line of `text` by `depth` levels.
+func indentJsonnet(text string, depth int) string {
+	indent := strings.Repeat("  ", depth)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
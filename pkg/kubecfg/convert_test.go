@@ -0,0 +1,266 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ksonnet/ksonnet-lib/ksonnet-gen/ksonnet"
+	"github.com/ksonnet/ksonnet-lib/ksonnet-gen/kubespec"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/template"
+)
+
+func TestConvertToJsonnet(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "known kind",
+			input: `apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+  labels:
+    app: nginx
+  annotations:
+    team: web
+spec:
+  ports:
+  - port: 80
+    targetPort: 8080
+  selector:
+    app: nginx
+`,
+			expected: `local k = import "k.libsonnet";
+local service = k.core.v1.service;
+
+{
+  apiVersion: "v1",
+  kind: "Service",
+  metadata: {
+    annotations: {
+      team: "web",
+    },
+  },
+  spec: {
+    ports: [
+      {
+        port: 80,
+        targetPort: 8080,
+      },
+    ],
+    selector: {
+      app: "nginx",
+    },
+  },
+} +
+service.mixin.metadata.name("nginx") +
+service.mixin.metadata.labels({
+  app: "nginx",
+})
+`,
+		},
+		{
+			name: "unknown kind, with quoted keys",
+			input: `{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "w"},
+ "spec": {"local": true, "foo-bar": null, "items": []}}`,
+			expected: `{
+  apiVersion: "example.com/v1",
+  kind: "Widget",
+  metadata: {
+    name: "w",
+  },
+  spec: {
+    "local": true,
+    "foo-bar": null,
+    items: [],
+  },
+}
+`,
+		},
+		{
+			name: "multiple documents",
+			input: `---
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: a
+--- # second
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: b
+`,
+			expected: `local k = import "k.libsonnet";
+local appsV1beta1Deployment = k.apps.v1beta1.deployment;
+local namespace = k.core.v1.namespace;
+
+[
+  {
+    apiVersion: "apps/v1beta1",
+    kind: "Deployment",
+  } +
+  appsV1beta1Deployment.mixin.metadata.name("a"),
+  {
+    apiVersion: "v1",
+    kind: "Namespace",
+  } +
+  namespace.mixin.metadata.name("b"),
+]
+`,
+		},
+	} {
+		res, err := convertToJsonnet([]byte(tc.input))
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.expected, res, tc.name)
+	}
+
+	_, err := convertToJsonnet([]byte("# nothing here\n"))
+	require.Error(t, err)
+}
+
+// convertTestSwagger describes the objects used by `TestConvertEvaluates`, in
+// the format ksonnet-lib is generated from.
+const convertTestSwagger = `{
+  "swagger": "2.0",
+  "info": {"title": "Kubernetes", "version": "v1.7.0"},
+  "definitions": {
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "properties": {
+        "annotations": {"type": "object"},
+        "labels": {"type": "object"},
+        "name": {"type": "string"},
+        "namespace": {"type": "string"}
+      }
+    },
+    "io.k8s.kubernetes.pkg.api.v1.Service": {
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.kubernetes.pkg.api.v1.ServiceSpec"}
+      },
+      "x-kubernetes-group-version-kind": [{"Group": "", "Version": "v1", "Kind": "Service"}]
+    },
+    "io.k8s.kubernetes.pkg.api.v1.ServiceSpec": {
+      "properties": {
+        "selector": {"type": "object"}
+      }
+    },
+    "io.k8s.kubernetes.pkg.api.v1.Namespace": {
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}
+      },
+      "x-kubernetes-group-version-kind": [{"Group": "", "Version": "v1", "Kind": "Namespace"}]
+    },
+    "io.k8s.kubernetes.pkg.apis.apps.v1beta1.Deployment": {
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.kubernetes.pkg.apis.apps.v1beta1.DeploymentSpec"}
+      },
+      "x-kubernetes-group-version-kind": [{"Group": "apps", "Version": "v1beta1", "Kind": "Deployment"}]
+    },
+    "io.k8s.kubernetes.pkg.apis.apps.v1beta1.DeploymentSpec": {
+      "properties": {
+        "replicas": {"type": "integer"}
+      }
+    }
+  }
+}`
+
+// evaluateConverted evaluates the converted Jsonnet `text` against a
+// ksonnet-lib generated from `convertTestSwagger`.
+func evaluateConverted(t *testing.T, text string) []*unstructured.Unstructured {
+	dir, err := ioutil.TempDir("", "ks-convert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var spec kubespec.APISpec
+	require.NoError(t, json.Unmarshal([]byte(convertTestSwagger), &spec))
+	kLib, k8sLib, err := ksonnet.Emit(&spec, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "k.libsonnet"), kLib, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "k8s.libsonnet"), k8sLib, 0644))
+
+	path := filepath.Join(dir, "converted.jsonnet")
+	require.NoError(t, ioutil.WriteFile(path, []byte(text), 0644))
+
+	expander := template.Expander{FlagJpath: []string{dir}, Resolver: "noop", FailAction: "warn"}
+	objs, err := expander.Expand([]string{path})
+	require.NoError(t, err, text)
+	return objs
+}
+
+func TestConvertEvaluates(t *testing.T) {
+	input := `apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+  namespace: web
+  labels:
+    app: nginx
+  annotations:
+    team: web
+spec:
+  selector:
+    app: nginx
+---
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  replicas: 2
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: web
+`
+	text, err := convertToJsonnet([]byte(input))
+	require.NoError(t, err)
+
+	objs := evaluateConverted(t, text)
+	require.Len(t, objs, 3)
+
+	require.Equal(t, "Service", objs[0].GetKind())
+	require.Equal(t, "v1", objs[0].GetAPIVersion())
+	require.Equal(t, "nginx", objs[0].GetName())
+	require.Equal(t, "web", objs[0].GetNamespace())
+	require.Equal(t, map[string]string{"app": "nginx"}, objs[0].GetLabels())
+	require.Equal(t, map[string]string{"team": "web"}, objs[0].GetAnnotations())
+	require.Equal(t, map[string]interface{}{"app": "nginx"}, objs[0].Object["spec"].(map[string]interface{})["selector"])
+
+	require.Equal(t, "Deployment", objs[1].GetKind())
+	require.Equal(t, "apps/v1beta1", objs[1].GetAPIVersion())
+	require.Equal(t, "nginx", objs[1].GetName())
+
+	require.Equal(t, "Namespace", objs[2].GetKind())
+	require.Equal(t, "web", objs[2].GetName())
+}
@@ -17,7 +17,10 @@ package kubecfg
 
 import (
 	"fmt"
+	"io"
 	"sort"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -36,6 +39,14 @@ type DeleteCmd struct {
 	Namespace  string
 
 	GracePeriod int64
+
+	// Confirm, if set, is given the live objects that are about to be
+	// deleted, and asked before any of them is. If it returns false, nothing
+	// is deleted.
+	Confirm func(live []*unstructured.Unstructured) (bool, error)
+	// BeforeDelete, if set, is run once the deletion is confirmed, before any
+	// object is deleted, e.g., to run the environment's hooks.
+	BeforeDelete func() error
 }
 
 func (c DeleteCmd) Run(apiObjects []*unstructured.Unstructured) error {
@@ -46,6 +57,29 @@ func (c DeleteCmd) Run(apiObjects []*unstructured.Unstructured) error {
 
 	sort.Sort(sort.Reverse(utils.DependencyOrder(apiObjects)))
 
+	// Only the objects that exist, and that ksonnet created, are deleted.
+	apiObjects, err = c.liveObjects(apiObjects)
+	if err != nil {
+		return err
+	}
+	if len(apiObjects) == 0 {
+		log.Info("None of the objects exist on the server; nothing to delete")
+		return nil
+	}
+	if c.Confirm != nil {
+		ok, err := c.Confirm(apiObjects)
+		if err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("Aborted; no objects were deleted")
+		}
+	}
+	if c.BeforeDelete != nil {
+		if err := c.BeforeDelete(); err != nil {
+			return err
+		}
+	}
+
 	deleteOpts := metav1.DeleteOptions{}
 	if version.Compare(1, 6) < 0 {
 		// 1.5.x option
@@ -79,3 +113,103 @@ func (c DeleteCmd) Run(apiObjects []*unstructured.Unstructured) error {
 
 	return nil
 }
+
+// liveObjects returns the live versions of `objs`, in the same order. Objects
+// that do not exist on the server are left out, as are objects that belong to
+// a component (see `utils.ComponentLabel`) whose live version does not: those
+// were created by something other than ksonnet.
+func (c DeleteCmd) liveObjects(objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	live := []*unstructured.Unstructured{}
+	for _, obj := range objs {
+		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+
+		client, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		liveObj, err := client.Get(obj.GetName())
+		if errors.IsNotFound(err) {
+			log.Debugf("%s doesn't exist on the server", desc)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Error fetching %s: %v", desc, err)
+		}
+
+		if !ownedBy(liveObj, obj) {
+			log.Warnf("Skipping %s, which exists on the server but was not created by component '%s'", desc, obj.GetLabels()[utils.ComponentLabel])
+			continue
+		}
+		live = append(live, liveObj)
+	}
+	return live, nil
+}
+
+// ownedBy returns true if the live object `live` was created from the rendered
+// object `rendered`, as far as its component label tells. Objects that were
+// not rendered from a component (e.g., given by file) own whatever has their
+// name.
+func ownedBy(live, rendered *unstructured.Unstructured) bool {
+	component, ok := rendered.GetLabels()[utils.ComponentLabel]
+	if !ok {
+		return true
+	}
+	return live.GetLabels()[utils.ComponentLabel] == component
+}
+
+// WriteDeletePreview writes a table of the objects `objs` that are about to be
+// deleted to `out`, with the age of each as of `now`, e.g.:
+//
+//	NAME  KIND       NAMESPACE AGE
+//	redis Deployment cache     3d
+//	redis Service    cache     3d
+func WriteDeletePreview(out io.Writer, objs []*unstructured.Unstructured, now time.Time) error {
+	rows := [][]string{{"NAME", "KIND", "NAMESPACE", "AGE"}}
+	for _, obj := range objs {
+		age := "<unknown>"
+		if created := obj.GetCreationTimestamp(); !created.IsZero() {
+			age = shortDuration(now.Sub(created.Time))
+		}
+		rows = append(rows, []string{obj.GetName(), obj.GetKind(), obj.GetNamespace(), age})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if i < len(row)-1 {
+				cell += strings.Repeat(" ", widths[i]-len(cell))
+			}
+			cells[i] = cell
+		}
+		if _, err := fmt.Fprintln(out, strings.Join(cells, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shortDuration formats `d` in its largest whole unit, as kubectl does for
+// ages, e.g., '45s', '12m', '5h', or '3d'.
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		if d < 0 {
+			d = 0
+		}
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+func TestOwnedBy(t *testing.T) {
+	obj := func(component string) *unstructured.Unstructured {
+		o := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+		}}
+		o.SetName("redis")
+		if component != "" {
+			o.SetLabels(map[string]string{utils.ComponentLabel: component})
+		}
+		return o
+	}
+
+	require.True(t, ownedBy(obj("redis"), obj("redis")))
+	require.False(t, ownedBy(obj("cache"), obj("redis")))
+	require.False(t, ownedBy(obj(""), obj("redis")))
+	// Objects given by file own whatever has their name.
+	require.True(t, ownedBy(obj(""), obj("")))
+	require.True(t, ownedBy(obj("redis"), obj("")))
+}
+
+func TestWriteDeletePreview(t *testing.T) {
+	now := time.Date(2018, 3, 10, 12, 0, 0, 0, time.UTC)
+	obj := func(kind, name, namespace string, age time.Duration) *unstructured.Unstructured {
+		o := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       kind,
+		}}
+		o.SetName(name)
+		o.SetNamespace(namespace)
+		if age > 0 {
+			o.SetCreationTimestamp(metav1.NewTime(now.Add(-age)))
+		}
+		return o
+	}
+
+	objs := []*unstructured.Unstructured{
+		obj("Deployment", "redis", "cache", 74*time.Hour),
+		obj("Service", "redis", "cache", 5*time.Hour),
+		obj("Namespace", "cache", "", 90*time.Second),
+		obj("ConfigMap", "settings", "web", 0),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDeletePreview(&buf, objs, now))
+	require.Equal(t, `NAME     KIND       NAMESPACE AGE
+redis    Deployment cache     3d
+redis    Service    cache     5h
+cache    Namespace            1m
+settings ConfigMap  web       <unknown>
+`, buf.String())
+}
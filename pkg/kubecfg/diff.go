@@ -18,10 +18,9 @@ package kubecfg
 import (
 	"fmt"
 	"io"
-	"os"
 	"sort"
+	"strings"
 
-	isatty "github.com/mattn/go-isatty"
 	log "github.com/sirupsen/logrus"
 	"github.com/yudai/gojsondiff"
 	"github.com/yudai/gojsondiff/formatter"
@@ -30,6 +29,7 @@ import (
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 
+	"github.com/ksonnet/ksonnet/metadata"
 	"github.com/ksonnet/ksonnet/utils"
 )
 
@@ -42,58 +42,145 @@ type DiffCmd struct {
 	Namespace  string
 
 	DiffStrategy string
+
+	// Theme colors the diff. If it is nil, the diff is not colored.
+	Theme *DiffTheme
+
+	// Components are the settings of the application's components; objects
+	// of components with `SkipDiff` set are not compared.
+	Components map[string]*metadata.ComponentSpec
 }
 
 func (c DiffCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) error {
 	sort.Sort(utils.AlphabeticalOrder(apiObjects))
 
 	diffFound := false
+	skipped := []skippedObject{}
 	for _, obj := range apiObjects {
 		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+		if reason := skipReason(obj, utils.AnnotationSkipDiff, c.Components, skipsDiff); reason != "" {
+			skipped = append(skipped, skippedObject{desc: desc, reason: reason})
+			continue
+		}
 		log.Debugf("Fetching ", desc)
 
-		client, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+		liveObjObject, diff, err := compareLive(c.ClientPool, c.Discovery, c.Namespace, c.DiffStrategy, obj)
 		if err != nil {
-			return err
-		}
-
-		liveObj, err := client.Get(obj.GetName())
-		if err != nil && errors.IsNotFound(err) {
-			log.Debugf("%s doesn't exist on the server", desc)
-			liveObj = nil
-		} else if err != nil {
 			return fmt.Errorf("Error fetching %s: %v", desc, err)
 		}
 
-		fmt.Fprintln(out, "---")
-		fmt.Fprintf(out, "- live %s\n+ config %s\n", desc, desc)
-		if liveObj == nil {
+		fmt.Fprintln(out, c.Theme.header("---"))
+		fmt.Fprintln(out, c.Theme.header("- live "+desc))
+		fmt.Fprintln(out, c.Theme.header("+ config "+desc))
+		if liveObjObject == nil {
 			fmt.Fprintf(out, "%s doesn't exist on server\n", desc)
 			diffFound = true
 			continue
 		}
 
-		liveObjObject := liveObj.Object
-		if c.DiffStrategy == "subset" {
-			liveObjObject = removeMapFields(obj.Object, liveObjObject)
+		if diff.Modified() {
+			diffFound = true
+			// The formatter's own coloring is not themeable, so the theme is
+			// applied to its plain output instead.
+			formatter := formatter.NewAsciiFormatter(liveObjObject, formatter.AsciiFormatterConfig{})
+			text, err := formatter.Format(diff)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s", c.Theme.body(text))
+		} else {
+			fmt.Fprintf(out, "%s unchanged\n", desc)
+		}
+	}
+	logSkipped("diff", skipped)
+
+	if diffFound {
+		return ErrDiffFound
+	}
+	return nil
+}
+
+// DiffEnvsCmd compares the objects rendered for two environments, without
+// contacting a cluster.
+type DiffEnvsCmd struct {
+	// From and To are the names of the environments being compared; the diff
+	// shows how the objects of `To` differ from those of `From`.
+	From, To string
+
+	// Theme colors the diff. If it is nil, the diff is not colored.
+	Theme *DiffTheme
+
+	// Components are the settings of the application's components; objects
+	// of components with `SkipDiff` set are not compared.
+	Components map[string]*metadata.ComponentSpec
+}
+
+func (c DiffEnvsCmd) Run(fromObjs, toObjs []*unstructured.Unstructured, out io.Writer) error {
+	from := objectsByKey(fromObjs)
+	to := objectsByKey(toObjs)
+
+	keys := []string{}
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diffFound := false
+	skipped := []skippedObject{}
+	for _, key := range keys {
+		fromObj, toObj := from[key], to[key]
+		obj := fromObj
+		if obj == nil {
+			obj = toObj
+		}
+		desc := fmt.Sprintf("%s %s", strings.ToLower(obj.GetKind()), utils.FqName(obj))
+
+		// An object opted out in either environment is skipped.
+		reason := ""
+		if fromObj != nil {
+			reason = skipReason(fromObj, utils.AnnotationSkipDiff, c.Components, skipsDiff)
+		}
+		if reason == "" && toObj != nil {
+			reason = skipReason(toObj, utils.AnnotationSkipDiff, c.Components, skipsDiff)
+		}
+		if reason != "" {
+			skipped = append(skipped, skippedObject{desc: desc, reason: reason})
+			continue
+		}
+
+		fmt.Fprintln(out, c.Theme.header("---"))
+		fmt.Fprintln(out, c.Theme.header(fmt.Sprintf("- %s %s", c.From, desc)))
+		fmt.Fprintln(out, c.Theme.header(fmt.Sprintf("+ %s %s", c.To, desc)))
+		switch {
+		case toObj == nil:
+			fmt.Fprintf(out, "%s only exists in '%s'\n", desc, c.From)
+			diffFound = true
+			continue
+		case fromObj == nil:
+			fmt.Fprintf(out, "%s only exists in '%s'\n", desc, c.To)
+			diffFound = true
+			continue
 		}
-		diff := gojsondiff.New().CompareObjects(liveObjObject, obj.Object)
 
+		diff := gojsondiff.New().CompareObjects(fromObj.Object, toObj.Object)
 		if diff.Modified() {
 			diffFound = true
-			fcfg := formatter.AsciiFormatterConfig{
-				Coloring: istty(out),
-			}
-			formatter := formatter.NewAsciiFormatter(liveObjObject, fcfg)
+			formatter := formatter.NewAsciiFormatter(fromObj.Object, formatter.AsciiFormatterConfig{})
 			text, err := formatter.Format(diff)
 			if err != nil {
 				return err
 			}
-			fmt.Fprintf(out, "%s", text)
+			fmt.Fprintf(out, "%s", c.Theme.body(text))
 		} else {
 			fmt.Fprintf(out, "%s unchanged\n", desc)
 		}
 	}
+	logSkipped("diff", skipped)
 
 	if diffFound {
 		return ErrDiffFound
@@ -101,6 +188,44 @@ func (c DiffCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) err
 	return nil
 }
 
+// objectsByKey indexes `objs` by API group, kind, namespace, and name, which
+// identify an object regardless of the environment it was rendered for.
+// Objects that do not set a namespace are matched with each other, even
+// though the environments may place them in different default namespaces.
+func objectsByKey(objs []*unstructured.Unstructured) map[string]*unstructured.Unstructured {
+	byKey := map[string]*unstructured.Unstructured{}
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		key := strings.Join([]string{gvk.Group, gvk.Kind, obj.GetNamespace(), obj.GetName()}, "/")
+		byKey[key] = obj
+	}
+	return byKey
+}
+
+// compareLive fetches the live version of `obj`, and compares it to `obj`. If
+// `strategy` is "subset", fields that are not in `obj` are ignored. If the
+// object does not exist on the server, the returned live object is nil.
+func compareLive(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, namespace, strategy string, obj *unstructured.Unstructured) (map[string]interface{}, gojsondiff.Diff, error) {
+	client, err := utils.ClientForResource(pool, disco, obj, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	liveObj, err := client.Get(obj.GetName())
+	if err != nil && errors.IsNotFound(err) {
+		log.Debugf("%s doesn't exist on the server", utils.FqName(obj))
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	liveObjObject := liveObj.Object
+	if strategy == "subset" {
+		liveObjObject = removeMapFields(obj.Object, liveObjObject)
+	}
+	return liveObjObject, gojsondiff.New().CompareObjects(liveObjObject, obj.Object), nil
+}
+
 func removeFields(config, live interface{}) interface{} {
 	switch c := config.(type) {
 	case map[string]interface{}:
@@ -137,10 +262,3 @@ func removeListFields(config, live []interface{}) []interface{} {
 	}
 	return result
 }
-
-func istty(w io.Writer) bool {
-	if f, ok := w.(*os.File); ok {
-		return isatty.IsTerminal(f.Fd())
-	}
-	return false
-}
@@ -16,9 +16,12 @@
 package kubecfg
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestRemoveListFields(t *testing.T) {
@@ -166,3 +169,46 @@ func TestRemoveFields(t *testing.T) {
 		require.Equal(t, tc.expected, removeFields(tc.config, tc.live))
 	}
 }
+
+func TestDiffEnvs(t *testing.T) {
+	obj := func(kind, name string, replicas int64) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1beta1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": name},
+			"spec":       map[string]interface{}{"replicas": replicas},
+		}}
+	}
+
+	from := []*unstructured.Unstructured{
+		obj("Deployment", "web", 1),
+		obj("Deployment", "api", 1),
+		obj("Service", "old", 1),
+	}
+	to := []*unstructured.Unstructured{
+		obj("Service", "new", 1),
+		obj("Deployment", "web", 3),
+		obj("Deployment", "api", 1),
+	}
+
+	var out bytes.Buffer
+	c := DiffEnvsCmd{From: "dev", To: "staging"}
+	err := c.Run(from, to, &out)
+	require.Equal(t, ErrDiffFound, err)
+
+	text := out.String()
+	apiIdx := strings.Index(text, "deployment api unchanged")
+	webIdx := strings.Index(text, "+ staging deployment web")
+	newIdx := strings.Index(text, "service new only exists in 'staging'")
+	oldIdx := strings.Index(text, "service old only exists in 'dev'")
+	for _, idx := range []int{apiIdx, webIdx, newIdx, oldIdx} {
+		require.NotEqual(t, -1, idx, text)
+	}
+	require.True(t, apiIdx < webIdx && webIdx < newIdx && newIdx < oldIdx, text)
+	require.Contains(t, text, "-    \"replicas\": 1\n")
+	require.Contains(t, text, "+    \"replicas\": 3\n")
+
+	out.Reset()
+	err = c.Run(from[1:2], to[2:], &out)
+	require.NoError(t, err)
+}
@@ -0,0 +1,254 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+const (
+	// DriftMissing means an object in the config does not exist on the server.
+	DriftMissing = "missing"
+	// DriftModified means the live version of an object differs from the
+	// config.
+	DriftModified = "modified"
+	// DriftResolved means an object that had drifted once again matches the
+	// config.
+	DriftResolved = "resolved"
+)
+
+// DriftEvent reports a change in whether an object's live state matches the
+// config.
+type DriftEvent struct {
+	Time   time.Time `json:"time"`
+	Env    string    `json:"env,omitempty"`
+	Object string    `json:"object"`
+	Status string    `json:"status"`
+}
+
+// DriftCmd represents the drift subcommand
+type DriftCmd struct {
+	ClientPool dynamic.ClientPool
+	Discovery  discovery.DiscoveryInterface
+	Namespace  string
+
+	DiffStrategy string
+	Env          string
+
+	// Interval is the time between checks. If zero, the config is checked
+	// once.
+	Interval time.Duration
+	// Webhook, if set, is a URL to which each batch of events is POSTed as a
+	// JSON array.
+	Webhook string
+	// MetricsAddr, if set, is the address at which to serve Prometheus
+	// metrics describing the drift.
+	MetricsAddr string
+
+	// Render expands the config. It is called before every check, so that
+	// changes to the config are picked up while watching.
+	Render func() ([]*unstructured.Unstructured, error)
+}
+
+func (c DriftCmd) Run(ctx context.Context, out io.Writer) error {
+	metrics := &driftMetrics{env: c.Env}
+	if c.MetricsAddr != "" {
+		server := &http.Server{Addr: c.MetricsAddr, Handler: metrics}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("Failed to serve metrics at '%s': %v", c.MetricsAddr, err)
+			}
+		}()
+		defer server.Close()
+		log.Infof("Serving drift metrics at 'http://%s/metrics'", c.MetricsAddr)
+	}
+
+	drifted := map[string]string{}
+	for {
+		events, err := c.check(drifted)
+		if err != nil {
+			if c.Interval == 0 {
+				return err
+			}
+			// A transient failure (e.g., the API server restarting) should not
+			// stop the watch.
+			log.Errorf("Failed to check for drift: %v", err)
+		} else {
+			metrics.update(len(drifted))
+			if err := c.emit(out, events); err != nil {
+				log.Errorf("Failed to report drift: %v", err)
+			}
+		}
+
+		if c.Interval == 0 {
+			if len(drifted) > 0 {
+				return ErrDiffFound
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.Interval):
+		}
+	}
+}
+
+// check renders the config and compares it to the cluster, updating
+// `drifted` (a map of object description to drift status) and returning an
+// event for every object whose status changed.
+func (c DriftCmd) check(drifted map[string]string) ([]DriftEvent, error) {
+	apiObjects, err := c.Render()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(utils.AlphabeticalOrder(apiObjects))
+
+	now := time.Now().UTC()
+	events := []DriftEvent{}
+	current := map[string]string{}
+	for _, obj := range apiObjects {
+		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+		log.Debugf("Checking %s for drift", desc)
+
+		liveObjObject, diff, err := compareLive(c.ClientPool, c.Discovery, c.Namespace, c.DiffStrategy, obj)
+		if err != nil {
+			return nil, fmt.Errorf("Error fetching %s: %v", desc, err)
+		}
+
+		if liveObjObject == nil {
+			current[desc] = DriftMissing
+		} else if diff.Modified() {
+			current[desc] = DriftModified
+		} else {
+			continue
+		}
+
+		if drifted[desc] != current[desc] {
+			events = append(events, DriftEvent{Time: now, Env: c.Env, Object: desc, Status: current[desc]})
+		}
+	}
+
+	// Objects that are in sync again, or that were removed from the config,
+	// are no longer drifting.
+	for desc := range drifted {
+		if _, ok := current[desc]; !ok {
+			events = append(events, DriftEvent{Time: now, Env: c.Env, Object: desc, Status: DriftResolved})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Object < events[j].Object })
+
+	for desc := range drifted {
+		delete(drifted, desc)
+	}
+	for desc, status := range current {
+		drifted[desc] = status
+	}
+
+	return events, nil
+}
+
+// emit writes each event to `out` as a line of JSON, and POSTs the batch to
+// the webhook, if there is one.
+func (c DriftCmd) emit(out io.Writer, events []DriftEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	enc := json.NewEncoder(out)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	if c.Webhook == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(c.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Webhook '%s' responded with status '%s'", c.Webhook, resp.Status)
+	}
+	return nil
+}
+
+// driftMetrics serves the state of the drift watch in the Prometheus text
+// exposition format.
+type driftMetrics struct {
+	env string
+
+	mu        sync.Mutex
+	drifted   int
+	checks    int
+	lastCheck time.Time
+}
+
+func (m *driftMetrics) update(drifted int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drifted = drifted
+	m.checks++
+	m.lastCheck = time.Now()
+}
+
+func (m *driftMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP ksonnet_drift_objects Number of objects whose live state differs from the config.\n")
+	fmt.Fprintf(w, "# TYPE ksonnet_drift_objects gauge\n")
+	fmt.Fprintf(w, "ksonnet_drift_objects{env=%q} %d\n", m.env, m.drifted)
+	fmt.Fprintf(w, "# HELP ksonnet_drift_checks_total Number of completed drift checks.\n")
+	fmt.Fprintf(w, "# TYPE ksonnet_drift_checks_total counter\n")
+	fmt.Fprintf(w, "ksonnet_drift_checks_total{env=%q} %d\n", m.env, m.checks)
+	if !m.lastCheck.IsZero() {
+		fmt.Fprintf(w, "# HELP ksonnet_drift_last_check_timestamp_seconds Time of the last completed drift check.\n")
+		fmt.Fprintf(w, "# TYPE ksonnet_drift_last_check_timestamp_seconds gauge\n")
+		fmt.Fprintf(w, "ksonnet_drift_last_check_timestamp_seconds{env=%q} %d\n", m.env, m.lastCheck.Unix())
+	}
+}
@@ -16,37 +16,262 @@
 package kubecfg
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 
 	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/utils"
 )
 
 type EnvAddCmd struct {
 	name      string
 	uri       string
 	namespace string
-
-	spec    metadata.ClusterSpec
-	manager metadata.Manager
+	inherits  string
+	dryRun    bool
+
+	specFlag string
+	spec     metadata.ClusterSpec
+	manager  metadata.Manager
+
+	// ClientPool and Discovery, if set, reach the environment's cluster,
+	// which is probed before the environment is created (see
+	// `validateDestination`).
+	ClientPool dynamic.ClientPool
+	Discovery  discovery.DiscoveryInterface
+	// Context, if set, deploys the environment with the named kubeconfig
+	// context, rather than by its URI.
+	Context string
 }
 
-func NewEnvAddCmd(name, uri, namespace, specFlag string, manager metadata.Manager) (*EnvAddCmd, error) {
+func NewEnvAddCmd(name, uri, namespace, inherits, specFlag string, dryRun bool, manager metadata.Manager) (*EnvAddCmd, error) {
 	spec, err := metadata.ParseClusterSpec(specFlag)
 	if err != nil {
 		return nil, err
 	}
 	log.Debugf("Generating ksonnetLib data with spec: %s", specFlag)
 
-	return &EnvAddCmd{name: name, uri: uri, namespace: namespace, spec: spec, manager: manager}, nil
+	return &EnvAddCmd{name: name, uri: uri, namespace: namespace, inherits: inherits, dryRun: dryRun, specFlag: specFlag, spec: spec, manager: manager}, nil
+}
+
+// Run creates the environment or, for a dry run, writes the files that would
+// be created to `out` instead.
+func (c *EnvAddCmd) Run(ctx context.Context, out io.Writer) error {
+	if c.Discovery != nil {
+		if err := c.validateDestination(); err != nil {
+			return err
+		}
+	}
+
+	if !c.dryRun {
+		if err := c.manager.CreateEnvironment(ctx, c.name, c.uri, c.namespace, c.inherits, c.spec); err != nil {
+			return err
+		}
+		if c.Context == "" {
+			return nil
+		}
+		return c.manager.SetEnvironment(c.name, &metadata.Environment{Context: c.Context})
+	}
+
+	files, err := c.manager.PreviewEnvironment(c.name, c.uri, c.namespace, c.inherits)
+	if err != nil {
+		return err
+	}
+
+	if c.Context != "" {
+		fmt.Fprintf(out, "Environment '%s' would be created with namespace '%s', deployed with kubeconfig context '%s'\n", c.name, c.namespace, c.Context)
+	} else {
+		fmt.Fprintf(out, "Environment '%s' would be created with namespace '%s', pointing at cluster at URI '%s'\n", c.name, c.namespace, c.uri)
+	}
+	root := string(c.manager.Root())
+	for _, f := range files {
+		fmt.Fprintf(out, "\n--- %s\n", strings.TrimPrefix(string(f.Path), root+"/"))
+		if f.Data == nil {
+			fmt.Fprintf(out, "(generated from the API specification '%s')\n", c.specFlag)
+			continue
+		}
+		if _, err := out.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDestination checks that the environment's cluster can be reached
+// with the current credentials, and that it runs the Kubernetes release of
+// the environment's API spec, so that mistakes surface now rather than at the
+// first apply.
+func (c *EnvAddCmd) validateDestination() error {
+	info, err := c.Discovery.ServerVersion()
+	if errors.IsUnauthorized(err) {
+		return fmt.Errorf("The cluster at URI '%s' rejected the credentials in kubeconfig: %v", c.uri, err)
+	} else if err != nil {
+		return fmt.Errorf("Could not reach the cluster at URI '%s': %v", c.uri, err)
+	}
+
+	if c.ClientPool != nil {
+		namespace := c.namespace
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		ns := &unstructured.Unstructured{}
+		ns.SetAPIVersion("v1")
+		ns.SetKind("Namespace")
+		ns.SetName(namespace)
+
+		rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, ns, "")
+		if err != nil {
+			return err
+		}
+		_, err = rc.Get(namespace)
+		switch {
+		case err == nil:
+		case errors.IsUnauthorized(err):
+			return fmt.Errorf("The cluster at URI '%s' rejected the credentials in kubeconfig: %v", c.uri, err)
+		case errors.IsForbidden(err):
+			log.Debugf("Not allowed to check that namespace '%s' exists: %v", namespace, err)
+		case errors.IsNotFound(err):
+			log.Warnf("Namespace '%s' does not exist in the cluster at URI '%s' yet", namespace, c.uri)
+		default:
+			return fmt.Errorf("Could not reach the cluster at URI '%s': %v", c.uri, err)
+		}
+	}
+
+	if err := checkServerVersion(c.specFlag, info.GitVersion); err != nil {
+		return fmt.Errorf("Environment '%s' does not match the cluster at URI '%s': %v", c.name, c.uri, err)
+	}
+	log.Infof("Cluster at URI '%s' is reachable, and runs Kubernetes %s", c.uri, info.GitVersion)
+	return nil
+}
+
+// checkServerVersion returns an error if the API spec flag `specFlag` names a
+// Kubernetes release (e.g., 'version:v1.7.0', or 'version:openshift-4.12' for
+// the release it is based on) whose minor version differs from the server's
+// git version `gitVersion` (e.g., 'v1.9.7-gke.1'). Other kinds of API specs
+// cannot be checked.
+func checkServerVersion(specFlag, gitVersion string) error {
+	if !strings.HasPrefix(specFlag, "version:") {
+		return nil
+	}
+	base, err := metadata.BaseKubernetesVersion(strings.TrimPrefix(specFlag, "version:"))
+	if err != nil {
+		return nil
+	}
+	specVersion := gitVersionPattern.FindStringSubmatch(base)
+	serverVersion := gitVersionPattern.FindStringSubmatch(gitVersion)
+	if specVersion == nil || serverVersion == nil {
+		return nil
+	}
+
+	if minorVersion(specVersion[1]) != minorVersion(serverVersion[1]) {
+		return fmt.Errorf("the cluster runs Kubernetes %s, but the API spec is '%s'; pass '--api-spec=version:v%s' to match it",
+			gitVersion, specFlag, serverVersion[1])
+	}
+	return nil
 }
 
-func (c *EnvAddCmd) Run() error {
-	return c.manager.CreateEnvironment(c.name, c.uri, c.namespace, c.spec)
+// minorVersion drops the patch version from a release, e.g., '1.9.7' becomes
+// '1.9'.
+func minorVersion(release string) string {
+	return release[:strings.LastIndex(release, ".")]
+}
+
+// ==================================================================
+
+type EnvUpdateCmd struct {
+	name     string
+	specFlag string
+	spec     metadata.ClusterSpec
+	manager  metadata.Manager
+
+	// Render, if set, renders the environment once it has been updated, so
+	// that the objects using APIs that the new version deprecates, or no
+	// longer serves, can be reported.
+	Render func() ([]*unstructured.Unstructured, error)
+}
+
+func NewEnvUpdateCmd(name, specFlag string, manager metadata.Manager) (*EnvUpdateCmd, error) {
+	spec, err := metadata.ParseClusterSpec(specFlag)
+	if err != nil {
+		return nil, err
+	}
+	return &EnvUpdateCmd{name: name, specFlag: specFlag, spec: spec, manager: manager}, nil
+}
+
+// Run regenerates the environment's ksonnet-lib from the new API spec, and
+// writes the objects that use deprecated or unserved APIs to `out`.
+func (c *EnvUpdateCmd) Run(ctx context.Context, out io.Writer) error {
+	if err := c.manager.UpdateEnvironmentKubernetesVersion(ctx, c.name, c.spec); err != nil {
+		return err
+	}
+	if c.Render == nil {
+		return nil
+	}
+
+	capabilities, err := c.manager.Capabilities(c.name)
+	if err != nil {
+		return err
+	}
+	objs, err := c.Render()
+	if err != nil {
+		return fmt.Errorf("Environment '%s' was updated, but could not be rendered to check the APIs it uses:\n%v", c.name, err)
+	}
+
+	problems := apiProblems(objs, capabilities, c.specFlag)
+	if len(problems) == 0 {
+		fmt.Fprintf(out, "No objects of environment '%s' use deprecated or unserved APIs\n", c.name)
+		return nil
+	}
+	fmt.Fprintf(out, "Objects of environment '%s' that use deprecated or unserved APIs:\n", c.name)
+	for _, problem := range problems {
+		fmt.Fprintf(out, "  %s\n", problem)
+	}
+	return nil
+}
+
+// apiProblems describes the objects among `objs` whose APIs the cluster
+// described by `capabilities` deprecates or does not serve. Objects of API
+// groups the cluster knows nothing about (e.g., custom resources) are not
+// reported, since their definitions are not in its API specification.
+func apiProblems(objs []*unstructured.Unstructured, capabilities *metadata.Capabilities, specFlag string) []string {
+	groups := map[string]bool{}
+	for _, api := range capabilities.APIs {
+		groups[apiGroup(api)] = true
+	}
+
+	problems := []string{}
+	for _, obj := range objs {
+		api := obj.GetAPIVersion() + "/" + obj.GetKind()
+		desc := fmt.Sprintf("%s %s (%s)", obj.GetKind(), utils.FqName(obj), obj.GetAPIVersion())
+		if notice, ok := capabilities.Deprecated[api]; ok {
+			problems = append(problems, fmt.Sprintf("%s: %s", desc, notice))
+		} else if !capabilities.HasAPI(api) && groups[apiGroup(api)] {
+			problems = append(problems, fmt.Sprintf("%s: not served by the API spec '%s'", desc, specFlag))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// apiGroup returns the group of an API of the form `<group>/<version>/<kind>`,
+// or the empty string for the core group, whose APIs are of the form
+// `<version>/<kind>`.
+func apiGroup(api string) string {
+	parts := strings.Split(api, "/")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[0]
 }
 
 // ==================================================================
@@ -55,6 +280,14 @@ type EnvRmCmd struct {
 	name string
 
 	manager metadata.Manager
+
+	// Delete, if set, is used to delete the objects last applied to the
+	// environment (according to its most recent snapshot) from the cluster,
+	// before the environment itself is removed.
+	Delete *DeleteCmd
+	// Confirm, if set, is asked before any objects are deleted. If it returns
+	// false, nothing is deleted, and the environment is kept.
+	Confirm func(objs []*unstructured.Unstructured) (bool, error)
 }
 
 func NewEnvRmCmd(name string, manager metadata.Manager) (*EnvRmCmd, error) {
@@ -62,19 +295,214 @@ func NewEnvRmCmd(name string, manager metadata.Manager) (*EnvRmCmd, error) {
 }
 
 func (c *EnvRmCmd) Run() error {
+	if c.Delete != nil {
+		if err := c.deleteObjects(); err != nil {
+			return err
+		}
+	}
+
 	return c.manager.DeleteEnvironment(c.name)
 }
 
+func (c *EnvRmCmd) deleteObjects() error {
+	snapshots, err := c.manager.GetSnapshots(c.name)
+	if err != nil {
+		return err
+	} else if len(snapshots) == 0 {
+		log.Warnf("Environment '%s' has no snapshots, so there are no known objects to delete", c.name)
+		return nil
+	}
+
+	latest := snapshots[len(snapshots)-1]
+	objs := SnapshotObjects(latest)
+	if len(objs) == 0 {
+		log.Infof("Snapshot '%s' of environment '%s' has no objects to delete", latest.ID, c.name)
+		return nil
+	}
+
+	if c.Confirm != nil {
+		ok, err := c.Confirm(objs)
+		if err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("Aborted; environment '%s' was not removed", c.name)
+		}
+	}
+
+	log.Infof("Deleting %d objects applied to environment '%s' in snapshot '%s'", len(objs), c.name, latest.ID)
+	return c.Delete.Run(objs)
+}
+
+// ==================================================================
+
+type EnvCpCmd struct {
+	srcName string
+	dstName string
+
+	uri       string
+	namespace string
+
+	manager metadata.Manager
+}
+
+func NewEnvCpCmd(srcName, dstName, uri, namespace string, manager metadata.Manager) (*EnvCpCmd, error) {
+	return &EnvCpCmd{srcName: srcName, dstName: dstName, uri: uri, namespace: namespace, manager: manager}, nil
+}
+
+func (c *EnvCpCmd) Run() error {
+	return c.manager.CopyEnvironment(c.srcName, c.dstName, c.uri, c.namespace)
+}
+
+// ==================================================================
+
+type EnvTargetsCmd struct {
+	name    string
+	targets []string
+	clear   bool
+
+	manager metadata.Manager
+}
+
+// NewEnvTargetsCmd returns a command that sets the targets of the environment
+// `name` to `targets`, or removes them if `clear` is set. If neither is
+// given, the command lists the environment's current targets.
+func NewEnvTargetsCmd(name string, targets []string, clear bool, manager metadata.Manager) (*EnvTargetsCmd, error) {
+	if clear && len(targets) > 0 {
+		return nil, fmt.Errorf("Targets cannot be both set and cleared")
+	}
+	return &EnvTargetsCmd{name: name, targets: targets, clear: clear, manager: manager}, nil
+}
+
+func (c *EnvTargetsCmd) Run(out io.Writer) error {
+	if c.clear || len(c.targets) > 0 {
+		return c.manager.SetEnvironmentTargets(c.name, c.targets)
+	}
+
+	env, err := c.manager.GetEnvironment(c.name)
+	if err != nil {
+		return err
+	}
+	if len(env.Targets) == 0 {
+		log.Infof("Environment '%s' has no targets, and renders every component", c.name)
+		return nil
+	}
+	for _, target := range env.Targets {
+		if _, err := fmt.Fprintln(out, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ==================================================================
+
+type EnvAliasCmd struct {
+	name    string
+	aliases []string
+	clear   bool
+
+	manager metadata.Manager
+}
+
+// NewEnvAliasCmd returns a command that sets the aliases of the environment
+// `name` to `aliases`, or removes them if `clear` is set. If neither is given,
+// the command lists the environment's current aliases.
+func NewEnvAliasCmd(name string, aliases []string, clear bool, manager metadata.Manager) (*EnvAliasCmd, error) {
+	if clear && len(aliases) > 0 {
+		return nil, fmt.Errorf("Aliases cannot be both set and cleared")
+	}
+	return &EnvAliasCmd{name: name, aliases: aliases, clear: clear, manager: manager}, nil
+}
+
+func (c *EnvAliasCmd) Run(out io.Writer) error {
+	if c.clear || len(c.aliases) > 0 {
+		return c.manager.SetEnvironmentAliases(c.name, c.aliases)
+	}
+
+	env, err := c.manager.GetEnvironment(c.name)
+	if err != nil {
+		return err
+	}
+	if len(env.Aliases) == 0 {
+		log.Infof("Environment '%s' has no aliases", env.Name)
+		return nil
+	}
+	for _, alias := range env.Aliases {
+		if _, err := fmt.Fprintln(out, alias); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ==================================================================
+
+type EnvProtectCmd struct {
+	name      string
+	protected bool
+
+	manager metadata.Manager
+}
+
+// NewEnvProtectCmd returns a command that protects the environment `name`, or
+// removes its protection if `protected` is false.
+func NewEnvProtectCmd(name string, protected bool, manager metadata.Manager) (*EnvProtectCmd, error) {
+	return &EnvProtectCmd{name: name, protected: protected, manager: manager}, nil
+}
+
+func (c *EnvProtectCmd) Run() error {
+	return c.manager.SetEnvironmentProtected(c.name, c.protected)
+}
+
+// ==================================================================
+
+type EnvArchiveCmd struct {
+	name    string
+	restore bool
+
+	manager metadata.Manager
+}
+
+// NewEnvArchiveCmd returns a command that archives the environment `name`, or
+// restores it from the archive if `restore` is true.
+func NewEnvArchiveCmd(name string, restore bool, manager metadata.Manager) (*EnvArchiveCmd, error) {
+	return &EnvArchiveCmd{name: name, restore: restore, manager: manager}, nil
+}
+
+func (c *EnvArchiveCmd) Run() error {
+	if c.restore {
+		return c.manager.RestoreEnvironment(c.name)
+	}
+	return c.manager.ArchiveEnvironment(c.name)
+}
+
 // ==================================================================
 
 type EnvListCmd struct {
 	manager metadata.Manager
+
+	// Tree, if set, groups nested environments (e.g., 'us-west/dev' and
+	// 'us-west/prod') under their common path, rather than listing every
+	// environment by its full name.
+	Tree bool
+	// Selector, if set, is a label selector (e.g., 'tier=prod'); only the
+	// environments whose labels match it are listed.
+	Selector string
+	// Archived, if set, lists the names of the archived environments instead.
+	Archived bool
 }
 
 func NewEnvListCmd(manager metadata.Manager) (*EnvListCmd, error) {
 	return &EnvListCmd{manager: manager}, nil
 }
 
+// envListRow is a row of the table printed by `EnvListCmd`.
+type envListRow struct {
+	name, namespace, uri string
+	// group is set for rows that only name a group of environments.
+	group bool
+}
+
 func (c *EnvListCmd) Run(out io.Writer) error {
 	const (
 		nameHeader      = "NAME"
@@ -82,13 +510,61 @@ func (c *EnvListCmd) Run(out io.Writer) error {
 		uriHeader       = "URI"
 	)
 
-	envs, err := c.manager.GetEnvironments()
+	if c.Archived {
+		names, err := c.manager.ArchivedEnvironments()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(out, nameHeader+"\n"+strings.Join(append(names, ""), "\n"))
+		return err
+	}
+
+	selected, err := c.manager.SelectEnvironments(c.Selector)
 	if err != nil {
 		return err
 	}
+	isSelected := map[string]bool{}
+	for _, env := range selected {
+		isSelected[env.Name] = true
+	}
 
-	// Sort environments by ascending alphabetical name
-	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+	rows := []envListRow{}
+	if c.Tree {
+		tree, err := c.manager.EnvironmentTree()
+		if err != nil {
+			return err
+		}
+
+		// Each group is listed with a trailing slash, and the nodes in it are
+		// indented below it:
+		//
+		//   NAME     NAMESPACE URI
+		//   minikube dev       localhost:8080
+		//   us-west/
+		//     dev    dev       http://dev.example.com
+		//     prod   prod      http://example.com
+		err = tree.Walk(func(node *metadata.EnvironmentNode, depth int) error {
+			indent := strings.Repeat("  ", depth-1)
+			if node.Environment != nil && isSelected[node.Environment.Name] {
+				rows = append(rows, envListRow{name: indent + node.Name, namespace: node.Environment.Namespace, uri: node.Environment.URI})
+			}
+			if hasSelectedChild(node, isSelected) {
+				rows = append(rows, envListRow{name: indent + node.Name + "/", group: true})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		envs := selected
+
+		// Sort environments by ascending alphabetical name
+		sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+		for _, env := range envs {
+			rows = append(rows, envListRow{name: env.Name, namespace: env.Namespace, uri: env.URI})
+		}
+	}
 
 	// Format each environment information for pretty printing.
 	// Each environment should be outputted like the following:
@@ -101,15 +577,15 @@ func (c *EnvListCmd) Run(out io.Writer) error {
 	// env namespace for proper padding.
 
 	maxNameLen := len(nameHeader)
-	for _, env := range envs {
-		if l := len(env.Name); l > maxNameLen {
+	for _, row := range rows {
+		if l := len(row.name); l > maxNameLen {
 			maxNameLen = l
 		}
 	}
 
 	maxNamespaceLen := len(namespaceHeader) + maxNameLen + 1
-	for _, env := range envs {
-		if l := len(env.Namespace) + maxNameLen + 1; l > maxNamespaceLen {
+	for _, row := range rows {
+		if l := len(row.namespace) + maxNameLen + 1; l > maxNamespaceLen {
 			maxNamespaceLen = l
 		}
 	}
@@ -120,10 +596,15 @@ func (c *EnvListCmd) Run(out io.Writer) error {
 	headerNamespaceSpacing := strings.Repeat(" ", maxNamespaceLen-maxNameLen-len(namespaceHeader))
 	lines = append(lines, nameHeader+headerNameSpacing+namespaceHeader+headerNamespaceSpacing+uriHeader+"\n")
 
-	for _, env := range envs {
-		nameSpacing := strings.Repeat(" ", maxNameLen-len(env.Name)+1)
-		namespaceSpacing := strings.Repeat(" ", maxNamespaceLen-maxNameLen-len(env.Namespace))
-		lines = append(lines, env.Name+nameSpacing+env.Namespace+namespaceSpacing+env.URI+"\n")
+	for _, row := range rows {
+		if row.group {
+			// Groups have no other columns; don't pad them with trailing spaces.
+			lines = append(lines, row.name+"\n")
+			continue
+		}
+		nameSpacing := strings.Repeat(" ", maxNameLen-len(row.name)+1)
+		namespaceSpacing := strings.Repeat(" ", maxNamespaceLen-maxNameLen-len(row.namespace))
+		lines = append(lines, row.name+nameSpacing+row.namespace+namespaceSpacing+row.uri+"\n")
 	}
 
 	formattedEnvsList := strings.Join(lines, "")
@@ -132,24 +613,101 @@ func (c *EnvListCmd) Run(out io.Writer) error {
 	return err
 }
 
+// hasSelectedEnvironment returns true if `node`, or any node below it, is a
+// selected environment.
+func hasSelectedEnvironment(node *metadata.EnvironmentNode, isSelected map[string]bool) bool {
+	if node.Environment != nil && isSelected[node.Environment.Name] {
+		return true
+	}
+	return hasSelectedChild(node, isSelected)
+}
+
+// hasSelectedChild returns true if any node below `node` is a selected
+// environment.
+func hasSelectedChild(node *metadata.EnvironmentNode, isSelected map[string]bool) bool {
+	for _, child := range node.Children {
+		if hasSelectedEnvironment(child, isSelected) {
+			return true
+		}
+	}
+	return false
+}
+
 // ==================================================================
 
 type EnvSetCmd struct {
 	name string
 
-	desiredName      string
-	desiredURI       string
-	desiredNamespace string
+	desiredName            string
+	desiredURI             string
+	desiredNamespace       string
+	desiredClusterSelector string
 
 	manager metadata.Manager
+
+	// LibraryPins, if set, pins the named libraries to the given
+	// directories. An empty directory removes the library's pin.
+	LibraryPins map[string]string
+	// LibPaths, if non-nil, replaces the environment's Jsonnet library search
+	// paths. Empty paths are dropped, so `[]string{""}` removes them all.
+	LibPaths []string
+	// ComponentNamespaces, if set, deploys the named components to the given
+	// namespaces. An empty namespace removes the component's mapping.
+	ComponentNamespaces map[string]string
+	// ComponentServers, if set, deploys the named components to the clusters
+	// at the given URIs. An empty URI removes the component's mapping.
+	ComponentServers map[string]string
+	// ExtVars and TlaVars, if set, set the named external variables and
+	// top-level arguments of the environment. An empty value removes one.
+	ExtVars map[string]string
+	TlaVars map[string]string
+	// Labels and Annotations, if set, set the named labels and annotations of
+	// the environment. An empty value removes the label or annotation.
+	Labels      map[string]string
+	Annotations map[string]string
+	// Context, if set, deploys the environment with the named kubeconfig
+	// context, rather than by its URI.
+	Context string
+	// ClearNamespace, ClearClusterSelector and ClearContext remove the
+	// environment's namespace, cluster selector and kubeconfig context,
+	// respectively (see `metadata.Manager.ClearEnvironmentDestination`).
+	ClearNamespace       bool
+	ClearClusterSelector bool
+	ClearContext         bool
 }
 
-func NewEnvSetCmd(name, desiredName, desiredURI, desiredNamespace string, manager metadata.Manager) (*EnvSetCmd, error) {
+func NewEnvSetCmd(name, desiredName, desiredURI, desiredNamespace, desiredClusterSelector string, manager metadata.Manager) (*EnvSetCmd, error) {
 	return &EnvSetCmd{name: name, desiredName: desiredName, desiredURI: desiredURI, desiredNamespace: desiredNamespace,
-		manager: manager}, nil
+		desiredClusterSelector: desiredClusterSelector, manager: manager}, nil
 }
 
 func (c *EnvSetCmd) Run() error {
-	desired := metadata.Environment{Name: c.desiredName, URI: c.desiredURI, Namespace: c.desiredNamespace}
+	desired := metadata.Environment{Name: c.desiredName, URI: c.desiredURI, Namespace: c.desiredNamespace, ClusterSelector: c.desiredClusterSelector, LibraryPins: c.LibraryPins, LibPaths: c.LibPaths, ComponentNamespaces: c.ComponentNamespaces,
+		ComponentServers: c.ComponentServers, ExtVars: c.ExtVars, TlaVars: c.TlaVars, Labels: c.Labels, Annotations: c.Annotations, Context: c.Context}
+	if c.ClearNamespace || c.ClearClusterSelector || c.ClearContext {
+		// Settings are removed first, so that (e.g.) a cluster selector can be
+		// replaced by a context in one go.
+		env, err := c.manager.GetEnvironment(c.name)
+		if err != nil {
+			return err
+		}
+		uri, clusterSelector, kubeContext := c.desiredURI, c.desiredClusterSelector, c.Context
+		if uri == "" {
+			uri = env.URI
+		}
+		if clusterSelector == "" && !c.ClearClusterSelector {
+			clusterSelector = env.ClusterSelector
+		}
+		if kubeContext == "" && !c.ClearContext {
+			kubeContext = env.Context
+		}
+		if uri == "" && clusterSelector == "" && kubeContext == "" {
+			return fmt.Errorf("Environment '%s' would have no cluster to deploy to; set its URI with '--uri'", env.Name)
+		}
+
+		if err := c.manager.ClearEnvironmentDestination(c.name, c.ClearNamespace, c.ClearClusterSelector, c.ClearContext); err != nil {
+			return err
+		}
+	}
 	return c.manager.SetEnvironment(c.name, &desired)
 }
@@ -0,0 +1,81 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+func TestCheckServerVersion(t *testing.T) {
+	for _, tc := range []struct {
+		specFlag, gitVersion string
+		ok                   bool
+	}{
+		{"version:v1.7.0", "v1.7.12", true},
+		{"version:v1.9.7", "v1.9.7-gke.1", true},
+		{"version:v1.7.0", "v1.9.7-gke.1", false},
+		{"version:v1.10.0", "v1.1.0", false},
+		{"file:swagger.json", "v1.9.7", true},
+		{"version:v1.7.0", "unknown", true},
+		{"version:1.27-gke.400", "v1.27.3-gke.1200", true},
+		{"version:1.27-gke.400", "v1.26.5-gke.1200", false},
+		{"version:openshift-4.12", "v1.25.4+77bec7a", true},
+		{"version:openshift-4.12", "v1.27.6+f67aeb3", false},
+	} {
+		err := checkServerVersion(tc.specFlag, tc.gitVersion)
+		if tc.ok {
+			require.NoError(t, err, tc.specFlag+" "+tc.gitVersion)
+		} else {
+			require.Error(t, err, tc.specFlag+" "+tc.gitVersion)
+		}
+	}
+
+	err := checkServerVersion("version:v1.7.0", "v1.9.7-gke.1")
+	require.EqualError(t, err, "the cluster runs Kubernetes v1.9.7-gke.1, but the API spec is 'version:v1.7.0'; pass '--api-spec=version:v1.9.7' to match it")
+}
+
+func TestAPIProblems(t *testing.T) {
+	obj := func(apiVersion, kind, name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": name, "namespace": "prod"},
+		}}
+	}
+	capabilities := &metadata.Capabilities{
+		APIs: []string{"apps/v1beta2/Deployment", "extensions/v1beta1/Deployment", "v1/Service"},
+		Deprecated: map[string]string{
+			"extensions/v1beta1/Deployment": "DEPRECATED - This group version of Deployment is deprecated by apps/v1beta2/Deployment.",
+		},
+	}
+
+	problems := apiProblems([]*unstructured.Unstructured{
+		obj("v1", "Service", "web"),
+		obj("apps/v1beta2", "Deployment", "web"),
+		obj("extensions/v1beta1", "Deployment", "legacy"),
+		obj("extensions/v1beta1", "PodSecurityPolicy", "restricted"),
+		obj("example.com/v1", "Widget", "custom"),
+	}, capabilities, "version:v1.9.7")
+	require.Equal(t, []string{
+		"Deployment prod.legacy (extensions/v1beta1): DEPRECATED - This group version of Deployment is deprecated by apps/v1beta2/Deployment.",
+		"PodSecurityPolicy prod.restricted (extensions/v1beta1): not served by the API spec 'version:v1.9.7'",
+	}, problems)
+}
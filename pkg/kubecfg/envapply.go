@@ -0,0 +1,312 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+// defaultKubernetesVersion is the Kubernetes version whose API spec new
+// environments are generated from, if neither the manifest nor `app.yaml`
+// give one.
+const defaultKubernetesVersion = "v1.7.0"
+
+// EnvManifest declares the environments of an application, so that many
+// environments can be created (or brought up to date) in one pass. For
+// example:
+//
+//	environments:
+//	- name: us-west/prod
+//	  server: https://prod.us-west.example.com
+//	  namespace: web
+//	  kubernetesVersion: v1.7.0
+//	  targets: [frontend, redis]
+type EnvManifest struct {
+	Environments []*EnvManifestEntry `json:"environments"`
+}
+
+// EnvManifestEntry declares one environment. Fields that are not set are left
+// as they are, or for a new environment, are taken from the
+// `environmentDefaults` of `app.yaml`.
+type EnvManifestEntry struct {
+	Name              string   `json:"name"`
+	Server            string   `json:"server,omitempty"`
+	Namespace         string   `json:"namespace,omitempty"`
+	KubernetesVersion string   `json:"kubernetesVersion,omitempty"`
+	Inherits          string   `json:"inherits,omitempty"`
+	Targets           []string `json:"targets,omitempty"`
+}
+
+// ReadEnvManifest reads the environment manifest (YAML or JSON) at `path`.
+func ReadEnvManifest(path string) (*EnvManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest EnvManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("Failed to parse environment manifest '%s':\n%v", path, err)
+	}
+	return &manifest, nil
+}
+
+// envChange is what applying one entry of an environment manifest does.
+type envChange struct {
+	name   string
+	create bool
+
+	uri, namespace, inherits string
+	// specFlag, if set, is the API spec the environment's ksonnet-lib is
+	// (re)generated from.
+	specFlag string
+	// targets, if non-nil, replace the environment's targets.
+	targets []string
+
+	// changes describe the change, for the plan.
+	changes []string
+}
+
+func (c *envChange) String() string {
+	switch {
+	case c.create:
+		return fmt.Sprintf("+ %s: create (%s)", c.name, strings.Join(c.changes, ", "))
+	case len(c.changes) == 0:
+		return fmt.Sprintf("  %s: unchanged", c.name)
+	default:
+		return fmt.Sprintf("~ %s: %s", c.name, strings.Join(c.changes, ", "))
+	}
+}
+
+type EnvApplyCmd struct {
+	manifest *EnvManifest
+	dryRun   bool
+	manager  metadata.Manager
+
+	// Confirm, if set, is called with the name of each existing environment
+	// the manifest changes, before any change is made. An error aborts the
+	// apply.
+	Confirm func(envName string) error
+}
+
+func NewEnvApplyCmd(manifest *EnvManifest, dryRun bool, manager metadata.Manager) (*EnvApplyCmd, error) {
+	return &EnvApplyCmd{manifest: manifest, dryRun: dryRun, manager: manager}, nil
+}
+
+// Run writes the plan of the changes the manifest makes to `out` and then,
+// unless this is a dry run, makes them: environments that do not exist are
+// created, and those that do are updated. Environments are created in the
+// order of the manifest, so an environment must come after the one it
+// inherits from.
+func (c *EnvApplyCmd) Run(ctx context.Context, out io.Writer) error {
+	plan, err := c.plan()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Plan for %d environment(s):\n", len(plan))
+	for _, change := range plan {
+		fmt.Fprintf(out, "  %s\n", change)
+	}
+	if c.dryRun {
+		return nil
+	}
+
+	if c.Confirm != nil {
+		for _, change := range plan {
+			if change.create || len(change.changes) == 0 {
+				continue
+			}
+			if err := c.Confirm(change.name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, change := range plan {
+		if err := c.apply(ctx, change); err != nil {
+			return fmt.Errorf("Failed to apply environment '%s':\n%v", change.name, err)
+		}
+	}
+	return nil
+}
+
+// plan works out the changes the manifest makes, without making any.
+func (c *EnvApplyCmd) plan() ([]*envChange, error) {
+	seen := map[string]bool{}
+	plan := []*envChange{}
+	for _, entry := range c.manifest.Environments {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("Every environment in the manifest must have a name")
+		}
+		if seen[entry.Name] {
+			return nil, fmt.Errorf("Environment '%s' is declared more than once", entry.Name)
+		}
+		seen[entry.Name] = true
+
+		var change *envChange
+		env, err := c.manager.GetEnvironment(entry.Name)
+		if metadata.IsEnvironmentNotFound(err) {
+			change, err = c.planCreate(entry)
+		} else if err == nil {
+			change, err = planUpdate(entry, env)
+		}
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, change)
+	}
+	return plan, nil
+}
+
+func (c *EnvApplyCmd) planCreate(entry *EnvManifestEntry) (*envChange, error) {
+	defaults, err := c.manager.EnvironmentDefaults(entry.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &envChange{name: entry.Name, create: true, uri: entry.Server, namespace: entry.Namespace, inherits: entry.Inherits, targets: entry.Targets}
+	if change.uri == "" {
+		change.uri = defaults.Server
+	}
+	if change.uri == "" {
+		return nil, fmt.Errorf("Environment '%s' does not exist, and the manifest does not give its server", entry.Name)
+	}
+	if change.namespace == "" {
+		change.namespace = defaults.Namespace
+	}
+	version := entry.KubernetesVersion
+	if version == "" {
+		version = defaults.KubernetesVersion
+	}
+	if version == "" {
+		version = defaultKubernetesVersion
+	}
+	change.specFlag = metadata.KubernetesVersionSpec(version)
+
+	change.changes = append(change.changes, fmt.Sprintf("server '%s'", change.uri))
+	if change.namespace != "" {
+		change.changes = append(change.changes, fmt.Sprintf("namespace '%s'", change.namespace))
+	}
+	if version := strings.TrimPrefix(change.specFlag, "version:"); version != change.specFlag {
+		base, err := metadata.BaseKubernetesVersion(version)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Kubernetes version of environment '%s': %v", entry.Name, err)
+		}
+		change.changes = append(change.changes, fmt.Sprintf("Kubernetes %s", describeVersion(version, base)))
+	} else {
+		change.changes = append(change.changes, fmt.Sprintf("API spec '%s'", change.specFlag))
+	}
+	if change.inherits != "" {
+		change.changes = append(change.changes, fmt.Sprintf("inherits from '%s'", change.inherits))
+	}
+	if len(change.targets) > 0 {
+		change.changes = append(change.changes, fmt.Sprintf("targets %s", strings.Join(change.targets, ", ")))
+	}
+	return change, nil
+}
+
+func planUpdate(entry *EnvManifestEntry, env *metadata.Environment) (*envChange, error) {
+	change := &envChange{name: env.Name}
+
+	if entry.Inherits != "" && entry.Inherits != env.Inherits {
+		return nil, fmt.Errorf("Environment '%s' inherits from '%s'; the manifest cannot change it to '%s'", env.Name, env.Inherits, entry.Inherits)
+	}
+	if entry.Server != "" && entry.Server != env.URI {
+		change.uri = entry.Server
+		change.changes = append(change.changes, fmt.Sprintf("server '%s' -> '%s'", env.URI, entry.Server))
+	}
+	if entry.Namespace != "" && entry.Namespace != env.Namespace {
+		change.namespace = entry.Namespace
+		change.changes = append(change.changes, fmt.Sprintf("namespace '%s' -> '%s'", env.Namespace, entry.Namespace))
+	}
+	if entry.KubernetesVersion != "" {
+		// Versions are compared by their upstream release, which is what the
+		// environment records (e.g., 'v1.7.0' for '1.7.0'). Other API specs
+		// cannot be compared, so the ksonnet-lib is regenerated.
+		specFlag := metadata.KubernetesVersionSpec(entry.KubernetesVersion)
+		if version := strings.TrimPrefix(specFlag, "version:"); version != specFlag {
+			base, err := metadata.BaseKubernetesVersion(version)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid Kubernetes version of environment '%s': %v", env.Name, err)
+			}
+			if base != env.KubernetesVersion {
+				change.specFlag = specFlag
+				change.changes = append(change.changes, fmt.Sprintf("Kubernetes '%s' -> '%s'", env.KubernetesVersion, describeVersion(version, base)))
+			}
+		} else {
+			change.specFlag = specFlag
+			change.changes = append(change.changes, fmt.Sprintf("API spec '%s'", specFlag))
+		}
+	}
+	if entry.Targets != nil && !reflect.DeepEqual(entry.Targets, env.Targets) && (len(entry.Targets) > 0 || len(env.Targets) > 0) {
+		change.targets = entry.Targets
+		change.changes = append(change.changes, fmt.Sprintf("targets [%s] -> [%s]", strings.Join(env.Targets, ", "), strings.Join(entry.Targets, ", ")))
+	}
+	return change, nil
+}
+
+func (c *EnvApplyCmd) apply(ctx context.Context, change *envChange) error {
+	var spec metadata.ClusterSpec
+	if change.specFlag != "" {
+		var err error
+		if spec, err = metadata.ParseClusterSpec(change.specFlag); err != nil {
+			return err
+		}
+	}
+
+	if change.create {
+		log.Infof("Creating environment '%s'", change.name)
+		if err := c.manager.CreateEnvironment(ctx, change.name, change.uri, change.namespace, change.inherits, spec); err != nil {
+			return err
+		}
+	} else {
+		if change.uri != "" || change.namespace != "" {
+			if err := c.manager.SetEnvironment(change.name, &metadata.Environment{URI: change.uri, Namespace: change.namespace}); err != nil {
+				return err
+			}
+		}
+		if spec != nil {
+			if err := c.manager.UpdateEnvironmentKubernetesVersion(ctx, change.name, spec); err != nil {
+				return err
+			}
+		}
+	}
+
+	if change.targets != nil {
+		return c.manager.SetEnvironmentTargets(change.name, change.targets)
+	}
+	return nil
+}
+
+// describeVersion describes the Kubernetes version `version`, whose upstream
+// release is `base`, for the plan, e.g., 'v1.8.0' for '1.8.0', and
+// 'openshift-4.12 (v1.25.0)' for 'openshift-4.12'.
+func describeVersion(version, base string) string {
+	if strings.TrimPrefix(version, "v") == strings.TrimPrefix(base, "v") {
+		return base
+	}
+	return fmt.Sprintf("%s (%s)", version, base)
+}
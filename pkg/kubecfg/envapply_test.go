@@ -0,0 +1,126 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/metadata/apptest"
+)
+
+func TestEnvApplyPlan(t *testing.T) {
+	manager, err := apptest.New().
+		WithAppYAML("environmentDefaults:\n  server: https://{env}.example.com\n  kubernetesVersion: 1.8.0\n").
+		WithEnv("prod", metadata.EnvironmentSpec{URI: "https://prod", Namespace: "web", KubernetesVersion: "v1.7.0", Targets: []string{"redis"}}).
+		WithEnv("staging", metadata.EnvironmentSpec{URI: "https://staging", Namespace: "web"}).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to build app: %v", err)
+	}
+
+	manifest := &EnvManifest{Environments: []*EnvManifestEntry{
+		{Name: "prod", Namespace: "web2", KubernetesVersion: "1.7.0", Targets: []string{"redis", "web"}},
+		{Name: "staging", Server: "https://staging"},
+		{Name: "qa", Namespace: "qa", Inherits: "staging"},
+		{Name: "dev", Server: "https://dev", KubernetesVersion: "openshift-4.12"},
+	}}
+	c, err := NewEnvApplyCmd(manifest, true, manager)
+	if err != nil {
+		t.Fatalf("Failed to create command: %v", err)
+	}
+	plan, err := c.plan()
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+
+	expected := []string{
+		"~ prod: namespace 'web' -> 'web2', targets [redis] -> [redis, web]",
+		"  staging: unchanged",
+		"+ qa: create (server 'https://qa.example.com', namespace 'qa', Kubernetes v1.8.0, inherits from 'staging')",
+		"+ dev: create (server 'https://dev', Kubernetes openshift-4.12 (v1.25.0))",
+	}
+	actual := []string{}
+	for _, change := range plan {
+		actual = append(actual, change.String())
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected plan:\n%v\ngot:\n%v", expected, actual)
+	}
+	if plan[0].specFlag != "" || plan[2].specFlag != "version:1.8.0" || plan[3].specFlag != "version:openshift-4.12" {
+		t.Errorf("Unexpected API specs '%s', '%s' and '%s'", plan[0].specFlag, plan[2].specFlag, plan[3].specFlag)
+	}
+
+	// Versions are compared by their upstream release.
+	prod, err := manager.GetEnvironment("prod")
+	if err != nil {
+		t.Fatalf("Failed to get environment: %v", err)
+	}
+	for version, changed := range map[string]bool{"v1.7.0": false, "1.7": false, "v1.8.0": true, "openshift-3.7": false, "openshift-4.12": true} {
+		change, err := planUpdate(&EnvManifestEntry{Name: "prod", KubernetesVersion: version}, prod)
+		if err != nil {
+			t.Fatalf("Failed to plan Kubernetes version '%s': %v", version, err)
+		}
+		if (change.specFlag != "") != changed {
+			t.Errorf("Expected Kubernetes version '%s' to change=%t the environment, got %s", version, changed, change)
+		}
+	}
+	if _, err := planUpdate(&EnvManifestEntry{Name: "prod", KubernetesVersion: "openshift-9.9"}, prod); err == nil {
+		t.Errorf("Expected planning an unknown OpenShift release to fail")
+	}
+
+	for _, tc := range []*EnvManifest{
+		{Environments: []*EnvManifestEntry{{Name: "prod"}, {Name: "prod"}}},
+		{Environments: []*EnvManifestEntry{{Server: "https://nameless"}}},
+		{Environments: []*EnvManifestEntry{{Name: "prod", Inherits: "staging"}}},
+	} {
+		c, err := NewEnvApplyCmd(tc, true, manager)
+		if err != nil {
+			t.Fatalf("Failed to create command: %v", err)
+		}
+		if _, err := c.plan(); err == nil {
+			t.Errorf("Expected planning %#v to fail", tc.Environments)
+		}
+	}
+
+	// Only the environments that are updated are confirmed, and a refusal
+	// aborts the apply before anything is changed.
+	c, err = NewEnvApplyCmd(manifest, false, manager)
+	if err != nil {
+		t.Fatalf("Failed to create command: %v", err)
+	}
+	confirmed := []string{}
+	c.Confirm = func(envName string) error {
+		confirmed = append(confirmed, envName)
+		return fmt.Errorf("Environment '%s' is protected", envName)
+	}
+	if err := c.Run(context.Background(), ioutil.Discard); err == nil {
+		t.Errorf("Expected a refused confirmation to fail the apply")
+	}
+	if !reflect.DeepEqual(confirmed, []string{"prod"}) {
+		t.Errorf("Expected only 'prod' to be confirmed, got %v", confirmed)
+	}
+	if env, err := manager.GetEnvironment("prod"); err != nil || env.Namespace != "web" {
+		t.Errorf("Expected 'prod' to be left alone, got %#v (%v)", env, err)
+	}
+	if _, err := manager.GetEnvironment("qa"); err == nil {
+		t.Errorf("Expected 'qa' not to be created")
+	}
+}
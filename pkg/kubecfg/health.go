@@ -0,0 +1,131 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	jsonnet "github.com/strickyak/jsonnet_cgo"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// HealthPolicies maps the names of components to the custom readiness
+// criteria of their objects. Objects with no matching policy fall back to the
+// built-in readiness rules; a nil HealthPolicies uses only those.
+type HealthPolicies map[string][]*metadata.HealthPolicy
+
+// NewHealthPolicies collects the health policies declared by `components`.
+func NewHealthPolicies(components map[string]*metadata.ComponentSpec) HealthPolicies {
+	policies := HealthPolicies{}
+	for name, spec := range components {
+		if spec != nil && len(spec.Health) != 0 {
+			policies[name] = spec.Health
+		}
+	}
+	return policies
+}
+
+// readiness reports whether the live object `obj` is ready, along with a short
+// human-readable description of its state, using the health policy of its
+// component if there is one.
+func (p HealthPolicies) readiness(obj *unstructured.Unstructured) (bool, string) {
+	policy := p.policyFor(obj)
+	if policy == nil {
+		return objectReadiness(obj)
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return false, fmt.Sprintf("health policy failed (%v)", err)
+	}
+
+	ready, err := evaluateHealthExpr(policy.Ready, data)
+	if err != nil {
+		return false, fmt.Sprintf("health policy failed (%v)", err)
+	}
+	isReady, ok := ready.(bool)
+	if !ok {
+		return false, fmt.Sprintf("health policy failed ('ready' evaluated to %s, not a boolean)", jsonString(ready))
+	}
+
+	detail := "ready"
+	if !isReady {
+		detail = "not ready"
+	}
+	if policy.Message != "" {
+		message, err := evaluateHealthExpr(policy.Message, data)
+		if err != nil {
+			return isReady, fmt.Sprintf("%s (health policy message failed: %v)", detail, err)
+		}
+		if s, ok := message.(string); ok {
+			detail = s
+		} else {
+			detail = jsonString(message)
+		}
+	}
+	return isReady, detail
+}
+
+// policyFor returns the health policy of the component `obj` belongs to that
+// matches its kind, or nil if there is none.
+func (p HealthPolicies) policyFor(obj *unstructured.Unstructured) *metadata.HealthPolicy {
+	component := obj.GetLabels()[utils.ComponentLabel]
+	for _, policy := range p[component] {
+		if policy.Kind != obj.GetKind() {
+			continue
+		}
+		if policy.APIVersion != "" && policy.APIVersion != obj.GetAPIVersion() {
+			continue
+		}
+		return policy
+	}
+	return nil
+}
+
+// evaluateHealthExpr evaluates the Jsonnet expression `expr`, with the
+// JSON-encoded object `data` bound to `object`.
+func evaluateHealthExpr(expr string, data []byte) (interface{}, error) {
+	vm := jsonnet.Make()
+	defer vm.Destroy()
+
+	vm.ExtCode("object", string(data))
+	snippet := fmt.Sprintf("local object = std.extVar(\"object\");\n%s\n", expr)
+	out, err := vm.EvaluateSnippet("health policy", snippet)
+	if err != nil {
+		// The first line holds the message; the rest is a stack trace through
+		// the snippet, which is of no use in a one-line summary.
+		return nil, fmt.Errorf("%s", strings.SplitN(strings.TrimSpace(err.Error()), "\n", 2)[0])
+	}
+
+	var result interface{}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func jsonString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
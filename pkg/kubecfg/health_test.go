@@ -0,0 +1,103 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+func TestHealthPolicies(t *testing.T) {
+	policies := NewHealthPolicies(map[string]*metadata.ComponentSpec{
+		"redis": {
+			Health: []*metadata.HealthPolicy{
+				{
+					APIVersion: "example.com/v1",
+					Kind:       "RedisCluster",
+					Ready:      `object.status.phase == "Running"`,
+					Message:    `"phase " + object.status.phase`,
+				},
+				{Kind: "Backup", Ready: `object.status.done`},
+				{Kind: "Broken", Ready: `object.status.missing`},
+				{Kind: "NotBool", Ready: `object.status`},
+			},
+		},
+		"ui": {},
+	})
+
+	tests := []struct {
+		obj    string
+		ready  bool
+		detail string
+	}{
+		{
+			obj:    `{"apiVersion": "example.com/v1", "kind": "RedisCluster", "metadata": {"name": "r", "labels": {"ksonnet.io/component": "redis"}}, "status": {"phase": "Running"}}`,
+			ready:  true,
+			detail: "phase Running",
+		},
+		{
+			obj:    `{"apiVersion": "example.com/v1", "kind": "RedisCluster", "metadata": {"name": "r", "labels": {"ksonnet.io/component": "redis"}}, "status": {"phase": "Creating"}}`,
+			ready:  false,
+			detail: "phase Creating",
+		},
+		{
+			obj:    `{"apiVersion": "example.com/v1", "kind": "Backup", "metadata": {"name": "b", "labels": {"ksonnet.io/component": "redis"}}, "status": {"done": false}}`,
+			ready:  false,
+			detail: "not ready",
+		},
+		{
+			obj:    `{"apiVersion": "example.com/v1", "kind": "Broken", "metadata": {"name": "b", "labels": {"ksonnet.io/component": "redis"}}, "status": {}}`,
+			ready:  false,
+			detail: "health policy failed (RUNTIME ERROR: Field does not exist: missing)",
+		},
+		{
+			obj:    `{"apiVersion": "example.com/v1", "kind": "NotBool", "metadata": {"name": "b", "labels": {"ksonnet.io/component": "redis"}}, "status": {"a": 1}}`,
+			ready:  false,
+			detail: `health policy failed ('ready' evaluated to {"a":1}, not a boolean)`,
+		},
+		// Policies only apply to objects of their component, kind, and API
+		// version; others use the built-in rules.
+		{
+			obj:    `{"apiVersion": "example.com/v2", "kind": "RedisCluster", "metadata": {"name": "r", "labels": {"ksonnet.io/component": "redis"}}, "status": {"phase": "Creating"}}`,
+			ready:  true,
+			detail: "ready",
+		},
+		{
+			obj:    `{"apiVersion": "example.com/v1", "kind": "Backup", "metadata": {"name": "b", "labels": {"ksonnet.io/component": "ui"}}, "status": {"done": false}}`,
+			ready:  true,
+			detail: "ready",
+		},
+		{
+			obj:    `{"apiVersion": "v1", "kind": "PersistentVolumeClaim", "metadata": {"name": "data", "labels": {"ksonnet.io/component": "redis"}}, "status": {"phase": "Pending"}}`,
+			ready:  false,
+			detail: "pending",
+		},
+	}
+
+	for _, test := range tests {
+		ready, detail := policies.readiness(mustUnstructured(t, test.obj))
+		if ready != test.ready || detail != test.detail {
+			t.Errorf("Expected (%t, %q) for %s, got (%t, %q)", test.ready, test.detail, test.obj, ready, detail)
+		}
+	}
+
+	var none HealthPolicies
+	if ready, detail := none.readiness(mustUnstructured(t, tests[0].obj)); !ready || !strings.Contains(detail, "ready") {
+		t.Errorf("Expected object with no policy to use the built-in rules, got (%t, %q)", ready, detail)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/prototype"
+)
+
+// DefaultTillerNamespace is the namespace in which Tiller records releases,
+// unless it was installed elsewhere.
+const DefaultTillerNamespace = "kube-system"
+
+// helmReleaseManifestField is the number of the `manifest` field in Tiller's
+// `hapi.release.Release` protobuf message.
+const helmReleaseManifestField = 5
+
+// HelmImportCmd represents the `import helm-release` subcommand
+type HelmImportCmd struct {
+	ClientPool dynamic.ClientPool
+	Manager    metadata.Manager
+
+	// Release is the name of the Helm release to import.
+	Release string
+	// TillerNamespace is the namespace in which Tiller stores its releases.
+	TillerNamespace string
+	// Component is the name of the component to write. It defaults to the
+	// name of the release.
+	Component string
+}
+
+// Run fetches the manifest of the most recently deployed revision of the
+// release, and writes it to a component.
+func (c HelmImportCmd) Run() error {
+	manifest, err := c.fetchManifest()
+	if err != nil {
+		return err
+	}
+
+	text, err := convertToJsonnet([]byte(manifest))
+	if err != nil {
+		return fmt.Errorf("Could not convert manifest of Helm release '%s':\n%v", c.Release, err)
+	}
+
+	component := c.Component
+	if component == "" {
+		component = c.Release
+	}
+
+	log.Infof("Importing Helm release '%s' as component '%s'", c.Release, component)
+	return c.Manager.CreateComponent(component, text, prototype.Jsonnet)
+}
+
+// fetchManifest looks for the release in both of Tiller's storage drivers
+// (ConfigMaps, the default, and Secrets), and returns the rendered manifest
+// of its deployed revision.
+func (c HelmImportCmd) fetchManifest() (string, error) {
+	listopts := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("OWNER=TILLER,NAME=%s", c.Release),
+	}
+
+	storage := []metav1.APIResource{
+		{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+		{Name: "secrets", Kind: "Secret", Namespaced: true},
+	}
+	for _, rsrc := range storage {
+		client, err := c.ClientPool.ClientForGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: rsrc.Kind})
+		if err != nil {
+			return "", err
+		}
+
+		log.Debugf("Looking for Helm release '%s' in %s in namespace '%s'", c.Release, rsrc.Name, c.TillerNamespace)
+		obj, err := client.Resource(&rsrc, c.TillerNamespace).List(listopts)
+		if err != nil {
+			return "", fmt.Errorf("Could not list %s in namespace '%s':\n%v", rsrc.Name, c.TillerNamespace, err)
+		}
+		list, ok := obj.(*unstructured.UnstructuredList)
+		if !ok || len(list.Items) == 0 {
+			continue
+		}
+
+		item, err := latestDeployedRelease(c.Release, list.Items)
+		if err != nil {
+			return "", err
+		}
+		return releaseManifest(item)
+	}
+
+	return "", fmt.Errorf("Could not find Helm release '%s' in namespace '%s'", c.Release, c.TillerNamespace)
+}
+
+// latestDeployedRelease returns the record of the highest revision of a
+// release whose status is DEPLOYED.
+func latestDeployedRelease(release string, items []*unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	var latest *unstructured.Unstructured
+	latestVersion := -1
+	for _, item := range items {
+		labels := item.GetLabels()
+		if labels["STATUS"] != "DEPLOYED" {
+			continue
+		}
+		version, err := strconv.Atoi(labels["VERSION"])
+		if err != nil {
+			return nil, fmt.Errorf("Helm release record '%s' has invalid VERSION label '%s'", item.GetName(), labels["VERSION"])
+		}
+		if version > latestVersion {
+			latest, latestVersion = item, version
+		}
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("Helm release '%s' has no deployed revision", release)
+	}
+	return latest, nil
+}
+
+// releaseManifest extracts the rendered manifest from a Tiller release
+// record. ConfigMaps hold the encoded release directly; Secrets hold it
+// base64-encoded once more, as with all Secret data.
+func releaseManifest(item *unstructured.Unstructured) (string, error) {
+	data, ok := item.Object["data"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("Helm release record '%s' has no data", item.GetName())
+	}
+	encoded, ok := data["release"].(string)
+	if !ok {
+		return "", fmt.Errorf("Helm release record '%s' has no 'release' data", item.GetName())
+	}
+
+	if item.GetKind() == "Secret" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("Could not decode Helm release record '%s':\n%v", item.GetName(), err)
+		}
+		encoded = string(decoded)
+	}
+
+	manifest, err := decodeTillerRelease(encoded)
+	if err != nil {
+		return "", fmt.Errorf("Could not decode Helm release record '%s':\n%v", item.GetName(), err)
+	}
+	return manifest, nil
+}
+
+// decodeTillerRelease decodes a release as stored by Tiller (a base64-encoded,
+// and usually gzipped, `hapi.release.Release` protobuf message), and returns
+// its manifest.
+func decodeTillerRelease(encoded string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	// Releases written by older versions of Tiller are not compressed.
+	if len(b) > 2 && b[0] == 0x1f && b[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		if b, err = ioutil.ReadAll(r); err != nil {
+			return "", err
+		}
+	}
+
+	return protoStringField(b, helmReleaseManifestField)
+}
+
+// protoStringField returns the value of the (last occurrence of the)
+// length-delimited field numbered `field` in the protobuf-encoded message
+// `msg`. Only the wire format is interpreted, which spares us a dependency on
+// Helm's generated types for the one field we need.
+func protoStringField(msg []byte, field uint64) (string, error) {
+	var value string
+	for len(msg) > 0 {
+		key, n := protoVarint(msg)
+		if n == 0 {
+			return "", fmt.Errorf("Malformed protobuf message")
+		}
+		msg = msg[n:]
+
+		var size uint64
+		switch wireType := key & 0x7; wireType {
+		case 0: // varint
+			_, n = protoVarint(msg)
+			if n == 0 {
+				return "", fmt.Errorf("Malformed protobuf message")
+			}
+			size = uint64(n)
+		case 1: // 64-bit
+			size = 8
+		case 2: // length-delimited
+			length, n := protoVarint(msg)
+			if n == 0 || uint64(len(msg)-n) < length {
+				return "", fmt.Errorf("Malformed protobuf message")
+			}
+			msg = msg[n:]
+			if key>>3 == field {
+				value = string(msg[:length])
+			}
+			size = length
+		case 5: // 32-bit
+			size = 4
+		default:
+			return "", fmt.Errorf("Unsupported protobuf wire type %d", wireType)
+		}
+
+		if uint64(len(msg)) < size {
+			return "", fmt.Errorf("Malformed protobuf message")
+		}
+		msg = msg[size:]
+	}
+	return value, nil
+}
+
+// protoVarint decodes a varint from the start of `b`, returning its value and
+// the number of bytes it occupied, or 0 bytes if `b` does not start with a
+// valid varint.
+func protoVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// encodeTillerRelease encodes a minimal `hapi.release.Release` message the
+// way Tiller stores it.
+func encodeTillerRelease(t *testing.T, name, manifest string, compress bool) string {
+	var msg []byte
+	msg = append(msg, 0x0a, byte(len(name))) // name = 1
+	msg = append(msg, name...)
+	msg = append(msg, 0x38, 0x03) // version = 7
+	msg = append(msg, 0x2a)       // manifest = 5
+	for n := len(manifest); ; n >>= 7 {
+		if n < 0x80 {
+			msg = append(msg, byte(n))
+			break
+		}
+		msg = append(msg, byte(n&0x7f|0x80))
+	}
+	msg = append(msg, manifest...)
+
+	if compress {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		msg = buf.Bytes()
+	}
+	return base64.StdEncoding.EncodeToString(msg)
+}
+
+func TestDecodeTillerRelease(t *testing.T) {
+	manifest := "---\n# Source: redis/templates/svc.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: redis\n" +
+		string(bytes.Repeat([]byte("# padding\n"), 20))
+
+	for _, compress := range []bool{true, false} {
+		got, err := decodeTillerRelease(encodeTillerRelease(t, "redis", manifest, compress))
+		if err != nil {
+			t.Errorf("Failed to decode release (compressed: %t):\n%v", compress, err)
+			continue
+		}
+		if got != manifest {
+			t.Errorf("Expected manifest (compressed: %t):\n%s\ngot:\n%s", compress, manifest, got)
+		}
+	}
+
+	if _, err := protoStringField([]byte{0x2a, 0x10, 'a'}, helmReleaseManifestField); err == nil {
+		t.Errorf("Expected decoding a truncated message to fail")
+	}
+}
+
+func TestLatestDeployedRelease(t *testing.T) {
+	items := []*unstructured.Unstructured{
+		mustUnstructured(t, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "redis.v1", "labels": {"STATUS": "SUPERSEDED", "VERSION": "1"}}}`),
+		mustUnstructured(t, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "redis.v10", "labels": {"STATUS": "DEPLOYED", "VERSION": "10"}}}`),
+		mustUnstructured(t, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "redis.v11", "labels": {"STATUS": "FAILED", "VERSION": "11"}}}`),
+		mustUnstructured(t, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "redis.v9", "labels": {"STATUS": "DEPLOYED", "VERSION": "9"}}}`),
+	}
+
+	latest, err := latestDeployedRelease("redis", items)
+	if err != nil {
+		t.Fatalf("Failed to find deployed release:\n%v", err)
+	}
+	if latest.GetName() != "redis.v10" {
+		t.Errorf("Expected release record 'redis.v10', got '%s'", latest.GetName())
+	}
+
+	if _, err := latestDeployedRelease("redis", items[2:3]); err == nil {
+		t.Errorf("Expected release with no deployed revision to fail")
+	}
+}
+
+func TestReleaseManifestFromSecret(t *testing.T) {
+	encoded := encodeTillerRelease(t, "redis", "kind: Service\n", true)
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "redis.v1"},
+		"data": map[string]interface{}{
+			"release": base64.StdEncoding.EncodeToString([]byte(encoded)),
+		},
+	}}
+
+	manifest, err := releaseManifest(secret)
+	if err != nil {
+		t.Fatalf("Failed to read release manifest:\n%v", err)
+	}
+	if manifest != "kind: Service\n" {
+		t.Errorf("Unexpected manifest:\n%s", manifest)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// HookCmd runs the lifecycle hooks of an environment.
+type HookCmd struct {
+	// ClientPool, Discovery, and Namespace locate the environment's cluster.
+	// They are only needed by Job hooks.
+	ClientPool dynamic.ClientPool
+	Discovery  discovery.DiscoveryInterface
+	Namespace  string
+
+	// Env is the name of the environment.
+	Env string
+	// AppDir is the root of the application. Commands run in it, and the
+	// files of Job hooks are relative to it.
+	AppDir string
+	// Out receives the output of commands.
+	Out io.Writer
+	// RenderJob expands the file of a Job hook into the objects it describes.
+	RenderJob func(path string) ([]*unstructured.Unstructured, error)
+}
+
+// Run runs `hooks`, the hooks of the phase `phase`, in order, stopping at the
+// first that fails.
+func (c HookCmd) Run(phase string, hooks []*metadata.Hook) error {
+	for _, hook := range hooks {
+		if err := hook.Validate(); err != nil {
+			return err
+		}
+
+		log.Infof("Running %s hook '%s' of environment '%s'", phase, hook.Describe(), c.Env)
+		var err error
+		if len(hook.Command) > 0 {
+			err = c.runCommand(phase, hook)
+		} else {
+			err = c.runJob(hook)
+		}
+		if err != nil {
+			return fmt.Errorf("The %s hook '%s' of environment '%s' failed: %v", phase, hook.Describe(), c.Env, err)
+		}
+	}
+	return nil
+}
+
+func (c HookCmd) runCommand(phase string, hook *metadata.Hook) error {
+	ctx := context.Background()
+	if timeout := hook.TimeoutDuration(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	command := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	command.Dir = c.AppDir
+	command.Env = append(os.Environ(), "KS_ENV="+c.Env, "KS_HOOK="+phase)
+	command.Stdout = c.Out
+	command.Stderr = c.Out
+	if err := command.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("Timed out after %s", hook.Timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// runJob recreates the objects described by the hook's file, and waits for
+// the Jobs among them to complete. Jobs cannot be run again once they have
+// completed, so any existing objects are deleted first.
+func (c HookCmd) runJob(hook *metadata.Hook) error {
+	if c.ClientPool == nil {
+		return fmt.Errorf("Job hooks need a single cluster, and cannot be used with environments that select clusters from the cluster inventory")
+	}
+
+	timeout := hook.TimeoutDuration()
+	if timeout == 0 {
+		timeout = metadata.DefaultHookTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	path := hook.Job
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.AppDir, path)
+	}
+	objs, err := c.RenderJob(path)
+	if err != nil {
+		return err
+	}
+
+	clients := []*dynamic.ResourceClient{}
+	for _, obj := range objs {
+		client, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+		if err != nil {
+			return err
+		}
+		clients = append(clients, client)
+
+		desc := fmt.Sprintf("%s %s", obj.GetKind(), utils.FqName(obj))
+		if err := deleteAndWait(client, obj, desc, deadline); err != nil {
+			return err
+		}
+
+		log.Infof("Creating %s", desc)
+		if _, err := client.Create(obj); err != nil {
+			return fmt.Errorf("Error creating %s: %v", desc, err)
+		}
+	}
+
+	for i, obj := range objs {
+		if obj.GetKind() != "Job" {
+			continue
+		}
+		desc := fmt.Sprintf("%s %s", obj.GetKind(), utils.FqName(obj))
+		err := waitForJob(clients[i], obj.GetName(), desc, deadline)
+		if _, ok := err.(*jobFailedError); ok {
+			return fmt.Errorf("%s failed: %v", desc, err)
+		} else if err != nil {
+			return err
+		}
+		log.Infof("%s completed", desc)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+func TestHookCmdCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ks-hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	c := HookCmd{Env: "prod", AppDir: dir, Out: &out}
+
+	err = c.Run(metadata.HookPostApply, []*metadata.Hook{
+		{Name: "first", Command: []string{"sh", "-c", `echo "$KS_HOOK $KS_ENV $(basename "$PWD")"`}},
+		{Name: "second", Command: []string{"echo", "done"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "postApply prod "+filepath.Base(dir)+"\ndone\n", out.String())
+
+	// The first failing hook stops the others.
+	out.Reset()
+	err = c.Run(metadata.HookPreApply, []*metadata.Hook{
+		{Name: "fail", Command: []string{"false"}},
+		{Name: "never", Command: []string{"echo", "never"}},
+	})
+	require.EqualError(t, err, "The preApply hook 'fail' of environment 'prod' failed: exit status 1")
+	require.Equal(t, "", out.String())
+
+	err = c.Run(metadata.HookPreApply, []*metadata.Hook{
+		{Name: "slow", Command: []string{"sleep", "5"}, Timeout: "100ms"},
+	})
+	require.EqualError(t, err, "The preApply hook 'slow' of environment 'prod' failed: Timed out after 100ms")
+
+	// Job hooks need a cluster.
+	err = c.Run(metadata.HookPreApply, []*metadata.Hook{{Name: "migrate", Job: "migrate.yaml"}})
+	require.Error(t, err)
+}
+
+func TestHookCmdJobs(t *testing.T) {
+	defer func(interval time.Duration) { jobPollInterval = interval }(jobPollInterval)
+	jobPollInterval = time.Millisecond
+
+	text := `{"apiVersion": "batch/v1", "kind": "Job", "metadata": {"name": "migrate", "namespace": "default"}, "spec": {"run": 2}}`
+	render := func(path string) ([]*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(text), &obj.Object); err != nil {
+			return nil, err
+		}
+		return []*unstructured.Unstructured{obj}, nil
+	}
+
+	for _, condition := range []string{"Complete", "Failed"} {
+		cluster := newFakeCluster(t)
+		// The Job of the previous run is replaced.
+		cluster.add(`{"apiVersion": "batch/v1", "kind": "Job", "metadata": {"name": "migrate", "namespace": "default"}, "spec": {"run": 1}}`)
+		// Jobs finish as soon as they are created.
+		cluster.written = func(obj map[string]interface{}) {
+			obj["status"] = map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"type": condition, "status": "True", "message": "BackoffLimitExceeded"}},
+			}
+		}
+
+		c := HookCmd{ClientPool: cluster, Discovery: cluster.discovery(), Namespace: "default", Env: "prod", RenderJob: render}
+		err := c.Run(metadata.HookPreApply, []*metadata.Hook{{Name: "migrate", Job: "migrate.yaml"}})
+		if condition == "Complete" {
+			require.NoError(t, err)
+		} else {
+			require.EqualError(t, err, "The preApply hook 'migrate' of environment 'prod' failed: Job default.migrate failed: BackoffLimitExceeded")
+		}
+
+		live := cluster.get(text)
+		require.NotNil(t, live)
+		require.Equal(t, map[string]interface{}{"run": float64(2)}, live["spec"])
+		cluster.Close()
+	}
+}
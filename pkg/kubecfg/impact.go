@@ -0,0 +1,117 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// ImpactCmd reports which components of which environments render
+// differently with and without a change.
+type ImpactCmd struct {
+	// Envs are the names of the environments compared.
+	Envs []string
+}
+
+// Run compares the objects each environment of `c.Envs` renders with the
+// change (`current`) and without it (`baseline`), each in the same order as
+// `c.Envs`, and writes a table of the components that differ to `out`.
+func (c ImpactCmd) Run(current, baseline [][]*unstructured.Unstructured, out io.Writer) error {
+	if len(current) != len(c.Envs) || len(baseline) != len(c.Envs) {
+		return fmt.Errorf("Expected the objects of %d environments", len(c.Envs))
+	}
+
+	table := [][]string{{"ENVIRONMENT", "COMPONENT", "CHANGE"}}
+	for i, env := range c.Envs {
+		after, err := componentHashes(current[i])
+		if err != nil {
+			return err
+		}
+		before, err := componentHashes(baseline[i])
+		if err != nil {
+			return err
+		}
+
+		for _, component := range impactedComponents(before, after) {
+			change := "changed"
+			if _, ok := before[component]; !ok {
+				change = "added"
+			} else if _, ok := after[component]; !ok {
+				change = "removed"
+			}
+			table = append(table, []string{env, component, change})
+		}
+	}
+
+	if len(table) == 1 {
+		_, err := fmt.Fprintln(out, "No component of the environments renders differently")
+		return err
+	}
+	return writeTable(out, table)
+}
+
+// componentHashes maps the components of `objs` (by their
+// `utils.ComponentLabel` label) to a hash of the objects they render, which is
+// independent of the order the objects are rendered in.
+func componentHashes(objs []*unstructured.Unstructured) (map[string]string, error) {
+	rendered := map[string][]string{}
+	for _, obj := range objs {
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		component := obj.GetLabels()[utils.ComponentLabel]
+		rendered[component] = append(rendered[component], string(data))
+	}
+
+	hashes := map[string]string{}
+	for component, objs := range rendered {
+		sort.Strings(objs)
+		h := sha256.New()
+		for _, obj := range objs {
+			fmt.Fprintln(h, obj)
+		}
+		hashes[component] = hex.EncodeToString(h.Sum(nil))
+	}
+	return hashes, nil
+}
+
+// impactedComponents returns the sorted names of the components whose hashes
+// differ between `before` and `after`, including those in only one of them.
+func impactedComponents(before, after map[string]string) []string {
+	impacted := []string{}
+	for component, hash := range after {
+		if before[component] != hash {
+			impacted = append(impacted, component)
+		}
+	}
+	for component := range before {
+		if _, ok := after[component]; !ok {
+			impacted = append(impacted, component)
+		}
+	}
+	sort.Strings(impacted)
+	return impacted
+}
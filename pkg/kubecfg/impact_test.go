@@ -0,0 +1,65 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+func TestImpact(t *testing.T) {
+	obj := func(component, name, value string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":   name,
+				"labels": map[string]interface{}{utils.ComponentLabel: component},
+			},
+			"data": map[string]interface{}{"value": value},
+		}}
+	}
+
+	c := ImpactCmd{Envs: []string{"dev", "prod"}}
+	current := [][]*unstructured.Unstructured{
+		{obj("redis", "a", "1"), obj("redis", "b", "1"), obj("web", "w", "2")},
+		{obj("redis", "a", "1"), obj("cache", "c", "1")},
+	}
+	baseline := [][]*unstructured.Unstructured{
+		// The order objects are rendered in does not matter.
+		{obj("redis", "b", "1"), obj("redis", "a", "1"), obj("web", "w", "1")},
+		{obj("redis", "a", "1"), obj("legacy", "l", "1")},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, c.Run(current, baseline, &out))
+	require.Equal(t, `ENVIRONMENT COMPONENT CHANGE
+dev         web       changed
+prod        cache     added
+prod        legacy    removed
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, c.Run(baseline, baseline, &out))
+	require.Equal(t, "No component of the environments renders differently\n", out.String())
+
+	require.Error(t, c.Run(current[:1], baseline, &out))
+}
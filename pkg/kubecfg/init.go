@@ -1,6 +1,10 @@
 package kubecfg
 
-import "github.com/ksonnet/ksonnet/metadata"
+import (
+	"context"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
 
 type InitCmd struct {
 	rootPath  metadata.AbsPath
@@ -21,7 +25,7 @@ func NewInitCmd(rootPath metadata.AbsPath, specFlag string, serverURI, namespace
 	return &InitCmd{rootPath: rootPath, spec: spec, serverURI: serverURI, namespace: namespace}, nil
 }
 
-func (c *InitCmd) Run() error {
-	_, err := metadata.Init(c.rootPath, c.spec, c.serverURI, c.namespace)
+func (c *InitCmd) Run(ctx context.Context) error {
+	_, err := metadata.Init(ctx, c.rootPath, c.spec, c.serverURI, c.namespace)
 	return err
 }
@@ -0,0 +1,198 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// jobDeleteTimeout is how long a recreated CronJob waits for its previous
+// incarnation to be deleted.
+var jobDeleteTimeout = 2 * time.Minute
+
+// jobPollInterval is how often Jobs (and the objects run along with them) are
+// checked, while waiting for them to finish or to be deleted.
+var jobPollInterval = time.Second
+
+// jobFailedError is returned by `waitForJob` for a Job that failed.
+type jobFailedError struct {
+	// message is that of the Job's 'Failed' condition, e.g.,
+	// 'Job has reached the specified backoff limit'.
+	message string
+}
+
+func (e *jobFailedError) Error() string {
+	if e.message == "" {
+		return "no reason given"
+	}
+	return e.message
+}
+
+// jobFinished reports whether `job` has finished and, if so, returns a
+// `*jobFailedError` if it failed.
+func jobFinished(job *unstructured.Unstructured) (bool, error) {
+	if conditionTrue(job, "Complete") {
+		return true, nil
+	}
+	if conditionTrue(job, "Failed") {
+		message, _ := condition(job, "Failed")["message"].(string)
+		return true, &jobFailedError{message: message}
+	}
+	return false, nil
+}
+
+// waitForJob polls the Job named `name` until it finishes, returning a
+// `*jobFailedError` if it failed. A Job that cannot be found yet is waited for.
+// It gives up at `deadline`, unless that is zero.
+func waitForJob(rc *dynamic.ResourceClient, name, desc string, deadline time.Time) error {
+	for {
+		job, err := rc.Get(name)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("Error retrieving %s: %v", desc, err)
+		} else if err == nil {
+			if done, err := jobFinished(job); done {
+				return err
+			}
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %s to complete", desc)
+		}
+		time.Sleep(jobPollInterval)
+	}
+}
+
+// deleteAndWait deletes `obj` along with its dependents (e.g., the Pods of a
+// Job), and waits until it is gone, so that it can be created again. It gives
+// up at `deadline`.
+func deleteAndWait(rc *dynamic.ResourceClient, obj *unstructured.Unstructured, desc string, deadline time.Time) error {
+	background := metav1.DeletePropagationBackground
+	if err := rc.Delete(obj.GetName(), &metav1.DeleteOptions{PropagationPolicy: &background}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("Error deleting the previous %s: %v", desc, err)
+	}
+
+	for {
+		if _, err := rc.Get(obj.GetName()); errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for the previous %s to be deleted", desc)
+		}
+		time.Sleep(jobPollInterval)
+	}
+}
+
+// isJobKind returns true for the kinds whose fields mostly cannot be changed
+// once created, and which `metadata.ComponentSpec.JobRerun` applies to.
+func isJobKind(obj *unstructured.Unstructured) bool {
+	kind := obj.GetKind()
+	return kind == "Job" || kind == "CronJob"
+}
+
+// jobRerunPolicy returns how to update `obj` if it already exists: the
+// `utils.AnnotationJobRerun` annotation of the object, or else the `jobRerun`
+// setting of its component in `components`. It returns the empty string for
+// objects other than Jobs and CronJobs.
+func jobRerunPolicy(obj *unstructured.Unstructured, components map[string]*metadata.ComponentSpec) (string, error) {
+	if !isJobKind(obj) {
+		return "", nil
+	}
+
+	policy, source := obj.GetAnnotations()[utils.AnnotationJobRerun], fmt.Sprintf("annotation '%s'", utils.AnnotationJobRerun)
+	if policy == "" {
+		component := obj.GetLabels()[utils.ComponentLabel]
+		if spec, ok := components[component]; ok && spec != nil {
+			policy, source = spec.JobRerun, fmt.Sprintf("'jobRerun' of component '%s'", component)
+		}
+	}
+
+	switch policy {
+	case "":
+		return metadata.JobRerunFail, nil
+	case metadata.JobRerunFail, metadata.JobRerunSkip, metadata.JobRerunRecreate:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Invalid %s '%s': must be one of '%s', '%s' or '%s'", source, policy,
+			metadata.JobRerunFail, metadata.JobRerunSkip, metadata.JobRerunRecreate)
+	}
+}
+
+// newJobRun returns a copy of the Job `obj` named after it by the server,
+// so that it can run again alongside its completed predecessors.
+func newJobRun(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	run := &unstructured.Unstructured{}
+	if err := run.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	run.SetGenerateName(obj.GetName() + "-")
+	run.SetName("")
+	return run, nil
+}
+
+// rerunJob updates `obj`, an existing Job or CronJob, according to `policy`
+// (see `jobRerunPolicy`).
+func (c ApplyCmd) rerunJob(rc *dynamic.ResourceClient, obj, existing *unstructured.Unstructured, policy, desc, dryRunText string) (metav1.Object, error) {
+	switch policy {
+	case metadata.JobRerunSkip:
+		log.Info(" Leaving existing ", desc, " unchanged", dryRunText)
+		return existing, nil
+
+	case metadata.JobRerunRecreate:
+		if obj.GetKind() == "Job" {
+			log.Infof(" Creating a new run of %s as %s-*%s", desc, obj.GetName(), dryRunText)
+			if c.DryRun {
+				return obj, nil
+			}
+			run, err := newJobRun(obj)
+			if err != nil {
+				return nil, err
+			}
+			return rc.Create(run)
+		}
+
+		log.Info(" Recreating ", desc, dryRunText)
+		if c.DryRun {
+			return obj, nil
+		}
+		if err := deleteAndWait(rc, obj, desc, time.Now().Add(jobDeleteTimeout)); err != nil {
+			return nil, err
+		}
+		return rc.Create(obj)
+	}
+	return nil, fmt.Errorf("Unknown Job rerun policy '%s'", policy)
+}
+
+// jobUpdateError explains the rejected update of an existing Job or CronJob.
+func jobUpdateError(obj *unstructured.Unstructured, err error) error {
+	return fmt.Errorf("%s '%s' already exists and cannot be changed (%v); to run it again, set 'jobRerun' of its component in 'app.yaml' (or its annotation '%s') to '%s', or to '%s' to leave it unchanged",
+		obj.GetKind(), obj.GetName(), err, utils.AnnotationJobRerun, metadata.JobRerunRecreate, metadata.JobRerunSkip)
+}
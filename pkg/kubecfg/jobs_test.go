@@ -0,0 +1,177 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+func TestJobRerunPolicy(t *testing.T) {
+	obj := func(kind, component string, annotations map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "batch/v1",
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":        "migrate",
+				"labels":      map[string]interface{}{utils.ComponentLabel: component},
+				"annotations": annotations,
+			},
+		}}
+	}
+	components := map[string]*metadata.ComponentSpec{
+		"migrate": {JobRerun: metadata.JobRerunRecreate},
+		"report":  {JobRerun: metadata.JobRerunSkip},
+		"broken":  {JobRerun: "sometimes"},
+		"empty":   nil,
+	}
+
+	for _, tc := range []struct {
+		obj      *unstructured.Unstructured
+		expected string
+	}{
+		{obj("Deployment", "migrate", nil), ""},
+		{obj("Job", "other", nil), metadata.JobRerunFail},
+		{obj("Job", "empty", nil), metadata.JobRerunFail},
+		{obj("Job", "migrate", nil), metadata.JobRerunRecreate},
+		{obj("CronJob", "report", nil), metadata.JobRerunSkip},
+		{obj("Job", "migrate", map[string]interface{}{utils.AnnotationJobRerun: "fail"}), metadata.JobRerunFail},
+	} {
+		policy, err := jobRerunPolicy(tc.obj, components)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, policy)
+	}
+
+	_, err := jobRerunPolicy(obj("Job", "broken", nil), components)
+	require.EqualError(t, err, "Invalid 'jobRerun' of component 'broken' 'sometimes': must be one of 'fail', 'skip-if-exists' or 'recreate'")
+	_, err = jobRerunPolicy(obj("Job", "other", map[string]interface{}{utils.AnnotationJobRerun: "always"}), components)
+	require.Error(t, err)
+
+	job := obj("Job", "migrate", nil)
+	run, err := newJobRun(job)
+	require.NoError(t, err)
+	require.Equal(t, "", run.GetName())
+	require.Equal(t, "migrate-", run.GetGenerateName())
+	require.Equal(t, "migrate", job.GetName())
+}
+func TestJobFinished(t *testing.T) {
+	tests := []struct {
+		status string
+		done   bool
+		failed bool
+	}{
+		{`{}`, false, false},
+		{`{"status": {"active": 1}}`, false, false},
+		{`{"status": {"conditions": [{"type": "Complete", "status": "True"}]}}`, true, false},
+		{`{"status": {"conditions": [{"type": "Failed", "status": "True", "message": "BackoffLimitExceeded"}]}}`, true, true},
+		{`{"status": {"conditions": [{"type": "Failed", "status": "False"}]}}`, false, false},
+	}
+
+	for _, test := range tests {
+		job := &unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(test.status), &job.Object); err != nil {
+			t.Fatalf("Failed to parse '%s':\n%v", test.status, err)
+		}
+
+		done, err := jobFinished(job)
+		if done != test.done || (err != nil) != test.failed {
+			t.Errorf("Expected job '%s' to be done=%t failed=%t, got done=%t err=%v", test.status, test.done, test.failed, done, err)
+		}
+		if _, ok := err.(*jobFailedError); test.failed && !ok {
+			t.Errorf("Expected job '%s' to fail with a *jobFailedError, got %T", test.status, err)
+		}
+	}
+}
+
+func TestWaitForJob(t *testing.T) {
+	defer func(interval time.Duration) { jobPollInterval = interval }(jobPollInterval)
+	jobPollInterval = time.Millisecond
+
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": "migrate", "namespace": "default"},
+	}}
+
+	tests := []struct {
+		status string
+		failed bool
+		err    bool
+	}{
+		{`{"conditions": [{"type": "Complete", "status": "True"}]}`, false, false},
+		{`{"conditions": [{"type": "Failed", "status": "True", "message": "BackoffLimitExceeded"}]}`, true, true},
+		// Never finishes, so times out.
+		{`{"active": 1}`, false, true},
+	}
+	for _, test := range tests {
+		cluster := newFakeCluster(t)
+		text := `{"apiVersion": "batch/v1", "kind": "Job", "metadata": {"name": "migrate", "namespace": "default"}, "status": ` + test.status + `}`
+		cluster.add(text)
+
+		rc, err := utils.ClientForResource(cluster, cluster.discovery(), job, "default")
+		require.NoError(t, err)
+		err = waitForJob(rc, "migrate", "job default.migrate", time.Now().Add(20*time.Millisecond))
+		cluster.Close()
+
+		if _, ok := err.(*jobFailedError); ok != test.failed || (err != nil) != test.err {
+			t.Errorf("Unexpected result of waiting for job with status '%s': %v", test.status, err)
+		}
+	}
+}
+
+func TestDeleteAndWait(t *testing.T) {
+	defer func(interval time.Duration) { jobPollInterval = interval }(jobPollInterval)
+	jobPollInterval = time.Millisecond
+
+	text := `{"apiVersion": "batch/v1", "kind": "Job", "metadata": {"name": "migrate", "namespace": "default"}}`
+	job := &unstructured.Unstructured{}
+	require.NoError(t, json.Unmarshal([]byte(text), &job.Object))
+
+	cluster := newFakeCluster(t)
+	defer cluster.Close()
+	rc, err := utils.ClientForResource(cluster, cluster.discovery(), job, "default")
+	require.NoError(t, err)
+
+	// Deleting a Job that does not exist is not an error.
+	require.NoError(t, deleteAndWait(rc, job, "job default.migrate", time.Now().Add(time.Second)))
+
+	cluster.add(text)
+	require.NoError(t, deleteAndWait(rc, job, "job default.migrate", time.Now().Add(time.Second)))
+	if cluster.get(text) != nil {
+		t.Errorf("Expected the job to be deleted")
+	}
+
+	// A Job whose deletion is accepted, but which lingers (e.g., while its
+	// Pods terminate), is waited for until the deadline.
+	cluster.add(text)
+	cluster.intercept = func(r *http.Request) int {
+		if r.Method == "DELETE" {
+			return http.StatusOK
+		}
+		return 0
+	}
+	if err := deleteAndWait(rc, job, "job default.migrate", time.Now().Add(20*time.Millisecond)); err == nil {
+		t.Errorf("Expected waiting for a lingering job to time out")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+// KubeconfigEnvironment describes an environment to be created from a
+// kubeconfig context.
+type KubeconfigEnvironment struct {
+	Context   string
+	Name      string
+	URI       string
+	Namespace string
+}
+
+// invalidEnvNameChars matches the characters that kubeconfig context names
+// commonly contain (e.g., EKS ARNs, such as
+// 'arn:aws:eks:us-west-2:123:cluster/prod'), but environment names may not.
+var invalidEnvNameChars = regexp.MustCompile(`[\\,;':!()?"{}\[\]*&%@$\s]+`)
+
+// KubeconfigEnvironments returns the environments to create from the contexts
+// of `config`. Each selection is either the name of a context, or
+// `<context>=<env-name>`, to give the environment a different name. If `all`
+// is set, every context is selected. Environments are named after their
+// context, with characters that are not allowed in environment names replaced
+// by '-'.
+func KubeconfigEnvironments(config *clientcmdapi.Config, selections []string, all bool) ([]*KubeconfigEnvironment, error) {
+	if all && len(selections) > 0 {
+		return nil, fmt.Errorf("Contexts cannot be both listed and selected with 'all'")
+	}
+	if all {
+		for name := range config.Contexts {
+			selections = append(selections, name)
+		}
+		sort.Strings(selections)
+	}
+	if len(selections) == 0 {
+		names := []string{}
+		for name := range config.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("No contexts selected; choose from: %s", strings.Join(names, ", "))
+	}
+
+	envs := []*KubeconfigEnvironment{}
+	for _, selection := range selections {
+		contextName, envName := selection, ""
+		if i := strings.LastIndex(selection, "="); i >= 0 {
+			contextName, envName = selection[:i], selection[i+1:]
+		}
+
+		kubeContext, ok := config.Contexts[contextName]
+		if !ok {
+			return nil, fmt.Errorf("Context '%s' does not exist in kubeconfig", contextName)
+		}
+		cluster, ok := config.Clusters[kubeContext.Cluster]
+		if !ok {
+			return nil, fmt.Errorf("Context '%s' refers to cluster '%s', which does not exist in kubeconfig", contextName, kubeContext.Cluster)
+		}
+
+		if envName == "" {
+			envName = strings.Trim(invalidEnvNameChars.ReplaceAllString(contextName, "-"), "-/")
+		}
+
+		envs = append(envs, &KubeconfigEnvironment{
+			Context:   contextName,
+			Name:      envName,
+			URI:       cluster.Server,
+			Namespace: kubeContext.Namespace,
+		})
+	}
+	return envs, nil
+}
+
+// gitVersionPattern matches the Kubernetes release in a server's git
+// version, e.g., 'v1.9.7' in 'v1.9.7-gke.1'.
+var gitVersionPattern = regexp.MustCompile(`^v?(\d+\.\d+\.\d+)`)
+
+// ServerAPISpec returns the API spec flag (e.g., 'version:v1.9.7') matching
+// the Kubernetes release that the cluster of the kubeconfig context
+// `contextName` runs.
+func ServerAPISpec(config *clientcmdapi.Config, contextName string) (string, error) {
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*config, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return "", err
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return "", err
+	}
+	info, err := disco.ServerVersion()
+	if err != nil {
+		return "", err
+	}
+
+	m := gitVersionPattern.FindStringSubmatch(info.GitVersion)
+	if m == nil {
+		return "", fmt.Errorf("Could not parse server version '%s'", info.GitVersion)
+	}
+	return "version:v" + m[1], nil
+}
+
+// EnvImportCmd creates environments from kubeconfig contexts.
+type EnvImportCmd struct {
+	envs []*KubeconfigEnvironment
+
+	// DiscoverSpec returns the API spec flag of the cluster of a context. If
+	// it fails, `DefaultSpec` is used instead.
+	DiscoverSpec func(contextName string) (string, error)
+	DefaultSpec  string
+
+	manager metadata.Manager
+}
+
+func NewEnvImportCmd(envs []*KubeconfigEnvironment, manager metadata.Manager) (*EnvImportCmd, error) {
+	return &EnvImportCmd{envs: envs, manager: manager}, nil
+}
+
+func (c *EnvImportCmd) Run(ctx context.Context) error {
+	for _, env := range c.envs {
+		specFlag := c.DefaultSpec
+		if c.DiscoverSpec != nil {
+			discovered, err := c.DiscoverSpec(env.Context)
+			if err != nil {
+				log.Warnf("Could not discover the Kubernetes version of context '%s'; using API spec '%s':\n%v", env.Context, c.DefaultSpec, err)
+			} else {
+				specFlag = discovered
+			}
+		}
+
+		spec, err := metadata.ParseClusterSpec(specFlag)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Importing context '%s' as environment '%s', with API spec '%s'", env.Context, env.Name, specFlag)
+		if err := c.manager.CreateEnvironment(ctx, env.Name, env.URI, env.Namespace, "", spec); err != nil {
+			return fmt.Errorf("Failed to import context '%s':\n%v", env.Context, err)
+		}
+	}
+	return nil
+}
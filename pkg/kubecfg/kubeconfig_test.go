@@ -0,0 +1,74 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestKubeconfigEnvironments(t *testing.T) {
+	config := &clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"gke":  {Server: "https://gke.example.com"},
+			"eks":  {Server: "https://eks.example.com"},
+			"kind": {Server: "https://127.0.0.1:6443"},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			"staging": {Cluster: "gke", Namespace: "staging"},
+			"arn:aws:eks:us-west-2:123456789012:cluster/prod": {Cluster: "eks", Namespace: "prod"},
+			"local":  {Cluster: "kind"},
+			"broken": {Cluster: "missing"},
+		},
+	}
+
+	envs, err := KubeconfigEnvironments(config, []string{"staging", "arn:aws:eks:us-west-2:123456789012:cluster/prod", "local=dev"}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error:\n%v", err)
+	}
+	expected := []*KubeconfigEnvironment{
+		{Context: "staging", Name: "staging", URI: "https://gke.example.com", Namespace: "staging"},
+		{Context: "arn:aws:eks:us-west-2:123456789012:cluster/prod", Name: "arn-aws-eks-us-west-2-123456789012-cluster/prod", URI: "https://eks.example.com", Namespace: "prod"},
+		{Context: "local", Name: "dev", URI: "https://127.0.0.1:6443"},
+	}
+	if !reflect.DeepEqual(envs, expected) {
+		for _, env := range envs {
+			t.Logf("%#v", env)
+		}
+		t.Errorf("Unexpected environments")
+	}
+
+	tests := []struct {
+		selections []string
+		all        bool
+		errSubstr  string
+	}{
+		{nil, false, "choose from: arn:aws:eks:us-west-2:123456789012:cluster/prod, broken, local, staging"},
+		{[]string{"missing"}, false, "Context 'missing' does not exist"},
+		{[]string{"broken"}, false, "cluster 'missing', which does not exist"},
+		{[]string{"staging"}, true, "cannot be both"},
+		{nil, true, "cluster 'missing'"},
+	}
+	for _, test := range tests {
+		_, err := KubeconfigEnvironments(config, test.selections, test.all)
+		if err == nil || !strings.Contains(err.Error(), test.errSubstr) {
+			t.Errorf("Expected selecting %v (all: %t) to fail with '%s', got: %v", test.selections, test.all, test.errSubstr, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+// ErrPipelineFailed is returned when some stage of a pipeline fails.
+var ErrPipelineFailed = fmt.Errorf("Pipeline failed.")
+
+const (
+	// PipelineFormatText reports the result of each stage as a line of text.
+	PipelineFormatText = "text"
+	// PipelineFormatJSON reports the results of all stages as a JSON object.
+	PipelineFormatJSON = "json"
+
+	pipelineStatusSucceeded = "succeeded"
+	pipelineStatusFailed    = "failed"
+	pipelineStatusSkipped   = "skipped"
+)
+
+// PipelineStageResult is the outcome of a single stage of a pipeline.
+type PipelineStageResult struct {
+	Name     string  `json:"name"`
+	Action   string  `json:"action"`
+	Env      string  `json:"env,omitempty"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"durationSeconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// PipelineResult is the outcome of a pipeline run.
+type PipelineResult struct {
+	Status string                 `json:"status"`
+	Stages []*PipelineStageResult `json:"stages"`
+}
+
+// PipelineRunCmd represents the `pipeline run` subcommand
+type PipelineRunCmd struct {
+	Pipeline *metadata.PipelineSpec
+
+	// Format is one of `PipelineFormatText` (the default) or
+	// `PipelineFormatJSON`.
+	Format string
+
+	// RunStage performs the action of a single stage.
+	RunStage func(stage *metadata.PipelineStage) error
+}
+
+func (c PipelineRunCmd) Run(out io.Writer) error {
+	switch c.Format {
+	case "", PipelineFormatText, PipelineFormatJSON:
+	default:
+		return fmt.Errorf("Unknown pipeline output format '%s'; must be one of '%s' or '%s'", c.Format, PipelineFormatText, PipelineFormatJSON)
+	}
+
+	result := c.run()
+
+	if c.Format == PipelineFormatJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "%s\n", data); err != nil {
+			return err
+		}
+	} else {
+		for _, stage := range result.Stages {
+			line := fmt.Sprintf("%-9s %s (%.1fs)", stage.Status, stage.Name, stage.Duration)
+			if stage.Error != "" {
+				line += ": " + stage.Error
+			}
+			if _, err := fmt.Fprintln(out, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	if result.Status != pipelineStatusSucceeded {
+		return ErrPipelineFailed
+	}
+	return nil
+}
+
+// run runs each stage whose condition is met, in order.
+func (c PipelineRunCmd) run() *PipelineResult {
+	result := &PipelineResult{Status: pipelineStatusSucceeded}
+
+	for i, stage := range c.Pipeline.Stages {
+		stageResult := &PipelineStageResult{Name: stage.Name, Action: stage.Action, Env: stage.Env}
+		result.Stages = append(result.Stages, stageResult)
+
+		failed := result.Status == pipelineStatusFailed
+		if (stage.When == metadata.PipelineWhenFailure && !failed) ||
+			(stage.When != metadata.PipelineWhenFailure && stage.When != metadata.PipelineWhenAlways && failed) {
+			log.Infof("[%d/%d] Skipping stage '%s'", i+1, len(c.Pipeline.Stages), stage.Name)
+			stageResult.Status = pipelineStatusSkipped
+			continue
+		}
+
+		log.Infof("[%d/%d] Running stage '%s' (%s)", i+1, len(c.Pipeline.Stages), stage.Name, stage.Action)
+		start := time.Now()
+		err := c.RunStage(stage)
+		stageResult.Duration = time.Since(start).Seconds()
+
+		if err != nil {
+			log.Errorf("Stage '%s' failed: %v", stage.Name, err)
+			stageResult.Status = pipelineStatusFailed
+			stageResult.Error = err.Error()
+			result.Status = pipelineStatusFailed
+			continue
+		}
+		stageResult.Status = pipelineStatusSucceeded
+	}
+
+	return result
+}
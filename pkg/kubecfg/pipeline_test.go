@@ -0,0 +1,77 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+func TestPipelineRun(t *testing.T) {
+	pipeline := &metadata.PipelineSpec{Stages: []*metadata.PipelineStage{
+		{Name: "validate", Action: metadata.PipelineActionValidate, Env: "staging", When: metadata.PipelineWhenSuccess},
+		{Name: "notify-ok", Action: metadata.PipelineActionWait, Timeout: "1s", When: metadata.PipelineWhenFailure},
+		{Name: "apply", Action: metadata.PipelineActionApply, Env: "staging", When: metadata.PipelineWhenSuccess},
+		{Name: "apply-prod", Action: metadata.PipelineActionApply, Env: "prod", When: metadata.PipelineWhenSuccess},
+		{Name: "notify-failed", Action: metadata.PipelineActionWait, Timeout: "1s", When: metadata.PipelineWhenFailure},
+		{Name: "cleanup", Action: metadata.PipelineActionDiff, Env: "staging", When: metadata.PipelineWhenAlways},
+	}}
+
+	ran := []string{}
+	c := PipelineRunCmd{
+		Pipeline: pipeline,
+		Format:   PipelineFormatJSON,
+		RunStage: func(stage *metadata.PipelineStage) error {
+			ran = append(ran, stage.Name)
+			if stage.Name == "apply" {
+				return fmt.Errorf("apply failed")
+			}
+			return nil
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := c.Run(&buf); err != ErrPipelineFailed {
+		t.Fatalf("Expected pipeline to fail with '%v', got '%v'", ErrPipelineFailed, err)
+	}
+
+	expectedRan := []string{"validate", "apply", "notify-failed", "cleanup"}
+	if !reflect.DeepEqual(ran, expectedRan) {
+		t.Errorf("Expected stages %v to run, got %v", expectedRan, ran)
+	}
+
+	var result PipelineResult
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse pipeline result:\n%v\n%s", err, buf.String())
+	}
+
+	expectedStatuses := []string{"succeeded", "skipped", "failed", "skipped", "succeeded", "succeeded"}
+	statuses := []string{}
+	for _, stage := range result.Stages {
+		statuses = append(statuses, stage.Status)
+	}
+	if result.Status != "failed" || !reflect.DeepEqual(statuses, expectedStatuses) {
+		t.Errorf("Expected pipeline status 'failed' with stage statuses %v, got '%s' with %v", expectedStatuses, result.Status, statuses)
+	}
+	if result.Stages[2].Error != "apply failed" {
+		t.Errorf("Expected failed stage to report its error, got '%s'", result.Stages[2].Error)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// PluginPrefix is the prefix of the names of plugin executables, e.g.,
+	// 'ks-cost' for the plugin 'cost'.
+	PluginPrefix = "ks-"
+
+	// Environment variables describing the application to plugins.
+	pluginAppRootEnvVar = "KS_APP_ROOT"
+	pluginEnvEnvVar     = "KS_ENV"
+	pluginBinaryEnvVar  = "KS_BINARY"
+)
+
+// Plugin is an executable that extends ks with a subcommand.
+type Plugin struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// FindPlugins returns the plugins in `dirs`, ordered by name. Where several
+// directories hold a plugin of the same name, the first one wins.
+func FindPlugins(dirs []string) ([]*Plugin, error) {
+	found := map[string]*Plugin{}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		infos, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			name := strings.TrimPrefix(info.Name(), PluginPrefix)
+			if name == info.Name() || name == "" || found[name] != nil || !isExecutable(info) {
+				continue
+			}
+			found[name] = &Plugin{Name: name, Path: filepath.Join(dir, info.Name())}
+		}
+	}
+
+	plugins := []*Plugin{}
+	for _, plugin := range found {
+		plugins = append(plugins, plugin)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins, nil
+}
+
+// FindPlugin returns the plugin `name` in `dirs`, or nil if there is none.
+func FindPlugin(name string, dirs []string) (*Plugin, error) {
+	plugins, err := FindPlugins(dirs)
+	if err != nil {
+		return nil, err
+	}
+	for _, plugin := range plugins {
+		if plugin.Name == name {
+			return plugin, nil
+		}
+	}
+	return nil, nil
+}
+
+func isExecutable(info os.FileInfo) bool {
+	return !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// PluginListCmd lists the available plugins.
+type PluginListCmd struct {
+	Dirs []string
+}
+
+func (c PluginListCmd) Run(out io.Writer) error {
+	plugins, err := FindPlugins(c.Dirs)
+	if err != nil {
+		return err
+	}
+	if len(plugins) == 0 {
+		_, err := fmt.Fprintln(out, "No plugins found")
+		return err
+	}
+
+	rows := [][]string{{"NAME", "PATH"}}
+	for _, plugin := range plugins {
+		rows = append(rows, []string{plugin.Name, plugin.Path})
+	}
+	return writeTable(out, rows)
+}
+
+// PluginCmd runs a plugin, in the context of an application.
+type PluginCmd struct {
+	Plugin *Plugin
+
+	// AppRoot is the root of the application, if any.
+	AppRoot string
+	// Env is the selected environment, if any. Its objects, rendered by
+	// Render, are written to the plugin's standard input as a YAML stream.
+	Env    string
+	Render func() ([]*unstructured.Unstructured, error)
+
+	In          io.Reader
+	Out, ErrOut io.Writer
+}
+
+func (c PluginCmd) Run(args []string) error {
+	cmd := exec.Command(c.Plugin.Path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.In, c.Out, c.ErrOut
+
+	cmd.Env = os.Environ()
+	if c.AppRoot != "" {
+		cmd.Env = append(cmd.Env, pluginAppRootEnvVar+"="+c.AppRoot)
+	}
+	if self, err := os.Executable(); err == nil {
+		cmd.Env = append(cmd.Env, pluginBinaryEnvVar+"="+self)
+	}
+
+	if c.Env != "" {
+		cmd.Env = append(cmd.Env, pluginEnvEnvVar+"="+c.Env)
+
+		objs, err := c.Render()
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := (ShowCmd{Format: "yaml"}).Run(objs, &buf); err != nil {
+			return err
+		}
+		cmd.Stdin = &buf
+	}
+
+	log.Debugf("Running plugin '%s' (%s) with arguments %v", c.Plugin.Name, c.Plugin.Path, args)
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code := 1
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			code = status.ExitStatus()
+		}
+		return &PluginExitError{Plugin: c.Plugin.Name, Code: code}
+	} else if err != nil {
+		return fmt.Errorf("Failed to run plugin '%s': %v", c.Plugin.Name, err)
+	}
+	return nil
+}
+
+// PluginExitError reports a plugin that exited with a non-zero status. The
+// plugin is expected to have explained why itself.
+type PluginExitError struct {
+	Plugin string
+	Code   int
+}
+
+func (e *PluginExitError) Error() string {
+	return fmt.Sprintf("Plugin '%s' exited with status %d", e.Plugin, e.Code)
+}
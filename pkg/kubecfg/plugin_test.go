@@ -0,0 +1,109 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func writePlugin(t *testing.T, dir, name, script string, mode os.FileMode) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindPlugins(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(appDir)
+	pathDir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pathDir)
+
+	writePlugin(t, appDir, "ks-cost", "", 0755)
+	writePlugin(t, pathDir, "ks-cost", "", 0755)
+	writePlugin(t, pathDir, "ks-audit", "", 0755)
+	writePlugin(t, pathDir, "ks-notes", "", 0644)
+	writePlugin(t, pathDir, "kubectl-foo", "", 0755)
+
+	plugins, err := FindPlugins([]string{appDir, filepath.Join(appDir, "missing"), pathDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Plugin{
+		{Name: "audit", Path: filepath.Join(pathDir, "ks-audit")},
+		{Name: "cost", Path: filepath.Join(appDir, "ks-cost")},
+	}
+	if !reflect.DeepEqual(plugins, expected) {
+		t.Errorf("Expected plugins %v, got %v", expected, plugins)
+	}
+
+	if plugin, err := FindPlugin("notes", []string{pathDir}); err != nil || plugin != nil {
+		t.Errorf("Expected non-executable plugin to be ignored, got %v (%v)", plugin, err)
+	}
+}
+
+func TestPluginCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writePlugin(t, dir, "ks-report", `echo "$KS_APP_ROOT $KS_ENV $*"; cat; exit 4`, 0755)
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "config"},
+	}}
+
+	var out bytes.Buffer
+	c := PluginCmd{
+		Plugin:  &Plugin{Name: "report", Path: filepath.Join(dir, "ks-report")},
+		AppRoot: "/apps/guestbook",
+		Env:     "prod",
+		Render: func() ([]*unstructured.Unstructured, error) {
+			return []*unstructured.Unstructured{obj}, nil
+		},
+		Out:    &out,
+		ErrOut: &out,
+	}
+
+	err = c.Run([]string{"--verbose"})
+	if exitErr, ok := err.(*PluginExitError); !ok || exitErr.Code != 4 {
+		t.Errorf("Expected plugin to exit with status 4, got %v", err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	if lines[0] != "/apps/guestbook prod --verbose" {
+		t.Errorf("Unexpected plugin context '%s'", lines[0])
+	}
+	if rendered := strings.Join(lines[1:], "\n"); !strings.Contains(rendered, "kind: ConfigMap") {
+		t.Errorf("Expected the rendered objects on the plugin's standard input, got:\n%s", rendered)
+	}
+}
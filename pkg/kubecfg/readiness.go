@@ -0,0 +1,308 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// noComponent is how objects that do not belong to a component (e.g., those
+// applied with `-f`) are grouped in the readiness summary.
+const noComponent = "(no component)"
+
+// objectStatus is the readiness of a single object.
+type objectStatus struct {
+	desc   string
+	ready  bool
+	detail string
+}
+
+// writeReadinessSummary writes the readiness of each component to `out`, given
+// the current (live) state of the objects that were applied. Objects are
+// grouped into components by their `utils.ComponentLabel` label, and a
+// component is ready if all of its objects are. Components' health policies
+// take precedence over the built-in readiness rules.
+func writeReadinessSummary(out io.Writer, objs []*unstructured.Unstructured, errs map[*unstructured.Unstructured]error, policies HealthPolicies) error {
+	components := map[string][]objectStatus{}
+	for _, obj := range objs {
+		component := obj.GetLabels()[utils.ComponentLabel]
+		if component == "" {
+			component = noComponent
+		}
+
+		status := objectStatus{desc: fmt.Sprintf("%s %s", obj.GetKind(), utils.FqName(obj))}
+		if err, ok := errs[obj]; ok {
+			status.detail = fmt.Sprintf("unknown (%v)", err)
+		} else {
+			status.ready, status.detail = policies.readiness(obj)
+		}
+		components[component] = append(components[component], status)
+	}
+
+	names := []string{}
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if _, err := fmt.Fprintln(out, "Component readiness:"); err != nil {
+		return err
+	}
+	for _, name := range names {
+		statuses := components[name]
+
+		ready := 0
+		for _, status := range statuses {
+			if status.ready {
+				ready++
+			}
+		}
+		summary := "ready"
+		if ready != len(statuses) {
+			summary = fmt.Sprintf("not ready (%d/%d objects ready)", ready, len(statuses))
+		}
+
+		if _, err := fmt.Fprintf(out, "  %s: %s\n", name, summary); err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if _, err := fmt.Fprintf(out, "    %s: %s\n", status.desc, status.detail); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// objectReadiness reports whether the live object `obj` is ready, along with a
+// short human-readable description of its state, e.g. "3/3 replicas ready".
+// Kinds with no notion of readiness are always ready.
+func objectReadiness(obj *unstructured.Unstructured) (bool, string) {
+	switch obj.GetKind() {
+	case "Deployment", "ReplicaSet", "ReplicationController", "StatefulSet":
+		return replicatedReadiness(obj)
+	case "DaemonSet":
+		return daemonSetReadiness(obj)
+	case "Job":
+		if conditionTrue(obj, "Complete") {
+			return true, "complete"
+		}
+		if conditionTrue(obj, "Failed") {
+			return false, "failed"
+		}
+		active, _ := nestedInt(obj.Object, "status", "active")
+		return false, fmt.Sprintf("running (%d active)", active)
+	case "Pod":
+		phase := nestedString(obj.Object, "status", "phase")
+		switch {
+		case phase == "Succeeded":
+			return true, "succeeded"
+		case phase == "Running" && conditionTrue(obj, "Ready"):
+			return true, "running and ready"
+		case phase == "":
+			return false, "pending"
+		}
+		return false, phaseDetail(phase)
+	case "PersistentVolumeClaim":
+		phase := nestedString(obj.Object, "status", "phase")
+		return phase == "Bound", phaseDetail(phase)
+	case "Service":
+		if nestedString(obj.Object, "spec", "type") != "LoadBalancer" {
+			return true, "ready"
+		}
+		return loadBalancerReadiness(obj)
+	case "Ingress":
+		return loadBalancerReadiness(obj)
+	case "CustomResourceDefinition":
+		// Custom resources of the new kind are rejected until the API server
+		// serves it, so later waves must wait for that.
+		if conditionTrue(obj, "Established") {
+			return true, "established"
+		}
+		if names := condition(obj, "NamesAccepted"); names != nil && names["status"] == "False" {
+			return false, fmt.Sprintf("names not accepted: %v", names["message"])
+		}
+		return false, "not yet established"
+	}
+
+	return true, "ready"
+}
+
+// replicatedReadiness reports whether a workload that runs `spec.replicas`
+// pods is ready: its controller has observed its latest spec, every replica
+// has been updated to that spec, and every replica is ready and available.
+// Counting ready replicas alone would report a rollout to an image that never
+// becomes ready as ready, on the strength of the pods it is replacing.
+func replicatedReadiness(obj *unstructured.Unstructured) (bool, string) {
+	desired, ok := nestedInt(obj.Object, "spec", "replicas")
+	if !ok {
+		desired = 1
+	}
+
+	if !generationObserved(obj) {
+		return false, "update not yet observed"
+	}
+
+	switch obj.GetKind() {
+	case "Deployment":
+		updated, _ := nestedInt(obj.Object, "status", "updatedReplicas")
+		if updated < desired {
+			return false, fmt.Sprintf("%d/%d replicas updated", updated, desired)
+		}
+		if total, _ := nestedInt(obj.Object, "status", "replicas"); total > updated {
+			return false, fmt.Sprintf("%d old replicas pending termination", total-updated)
+		}
+	case "StatefulSet":
+		// Pods of StatefulSets that are updated `OnDelete` are only updated
+		// once they are deleted, and those below the partition never are.
+		if nestedString(obj.Object, "spec", "updateStrategy", "type") != "OnDelete" {
+			partition, _ := nestedInt(obj.Object, "spec", "updateStrategy", "rollingUpdate", "partition")
+			updated, _ := nestedInt(obj.Object, "status", "updatedReplicas")
+			if updated < desired-partition {
+				return false, fmt.Sprintf("%d/%d replicas updated", updated, desired-partition)
+			}
+		}
+	}
+
+	ready, _ := nestedInt(obj.Object, "status", "readyReplicas")
+	if ready < desired {
+		return false, fmt.Sprintf("%d/%d replicas ready", ready, desired)
+	}
+
+	// StatefulSets do not report the replicas that are available.
+	if obj.GetKind() != "StatefulSet" {
+		if available, _ := nestedInt(obj.Object, "status", "availableReplicas"); available < desired {
+			return false, fmt.Sprintf("%d/%d replicas available", available, desired)
+		}
+	}
+
+	return true, fmt.Sprintf("%d/%d replicas ready", ready, desired)
+}
+
+// daemonSetReadiness reports whether a DaemonSet is ready, in the same terms as
+// `replicatedReadiness`, for the pods it should schedule.
+func daemonSetReadiness(obj *unstructured.Unstructured) (bool, string) {
+	if !generationObserved(obj) {
+		return false, "update not yet observed"
+	}
+
+	desired, _ := nestedInt(obj.Object, "status", "desiredNumberScheduled")
+	if nestedString(obj.Object, "spec", "updateStrategy", "type") != "OnDelete" {
+		if updated, _ := nestedInt(obj.Object, "status", "updatedNumberScheduled"); updated < desired {
+			return false, fmt.Sprintf("%d/%d pods updated", updated, desired)
+		}
+	}
+
+	ready, _ := nestedInt(obj.Object, "status", "numberReady")
+	if ready < desired {
+		return false, fmt.Sprintf("%d/%d pods ready", ready, desired)
+	}
+	if available, _ := nestedInt(obj.Object, "status", "numberAvailable"); available < desired {
+		return false, fmt.Sprintf("%d/%d pods available", available, desired)
+	}
+	return true, fmt.Sprintf("%d/%d pods ready", ready, desired)
+}
+
+// generationObserved reports whether the controller of `obj` has observed its
+// latest spec.
+func generationObserved(obj *unstructured.Unstructured) bool {
+	generation, _ := nestedInt(obj.Object, "metadata", "generation")
+	observed, _ := nestedInt(obj.Object, "status", "observedGeneration")
+	return observed >= generation
+}
+
+// loadBalancerReadiness reports whether a Service or Ingress has been
+// assigned an address.
+func loadBalancerReadiness(obj *unstructured.Unstructured) (bool, string) {
+	status, _ := obj.Object["status"].(map[string]interface{})
+	lb, _ := status["loadBalancer"].(map[string]interface{})
+	ingresses, _ := lb["ingress"].([]interface{})
+	for _, i := range ingresses {
+		ingress, _ := i.(map[string]interface{})
+		if ip, _ := ingress["ip"].(string); ip != "" {
+			return true, fmt.Sprintf("address %s assigned", ip)
+		}
+		if hostname, _ := ingress["hostname"].(string); hostname != "" {
+			return true, fmt.Sprintf("address %s assigned", hostname)
+		}
+	}
+	return false, "no address assigned"
+}
+
+// conditionTrue reports whether `obj` has a status condition of type
+// `conditionType` whose status is "True".
+func conditionTrue(obj *unstructured.Unstructured, conditionType string) bool {
+	c := condition(obj, conditionType)
+	return c != nil && c["status"] == "True"
+}
+
+// condition returns the status condition of `obj` of type `conditionType`, or
+// nil if it has none.
+func condition(obj *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	status, _ := obj.Object["status"].(map[string]interface{})
+	conditions, _ := status["conditions"].([]interface{})
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == conditionType {
+			return condition
+		}
+	}
+	return nil
+}
+
+func nestedField(obj map[string]interface{}, fields ...string) interface{} {
+	var curr interface{} = obj
+	for _, field := range fields {
+		m, ok := curr.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		curr = m[field]
+	}
+	return curr
+}
+
+func nestedString(obj map[string]interface{}, fields ...string) string {
+	s, _ := nestedField(obj, fields...).(string)
+	return s
+}
+
+// nestedInt returns the integer at `fields` in `obj`, which may have been
+// decoded as either an int64 or a float64.
+func nestedInt(obj map[string]interface{}, fields ...string) (int64, bool) {
+	switch v := nestedField(obj, fields...).(type) {
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func phaseDetail(phase string) string {
+	if phase == "" {
+		return "unknown"
+	}
+	return strings.ToLower(phase)
+}
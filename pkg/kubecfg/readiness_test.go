@@ -0,0 +1,106 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func mustUnstructured(t *testing.T, text string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal([]byte(text), &obj.Object); err != nil {
+		t.Fatalf("Failed to parse '%s':\n%v", text, err)
+	}
+	return obj
+}
+
+func TestObjectReadiness(t *testing.T) {
+	tests := []struct {
+		obj    string
+		ready  bool
+		detail string
+	}{
+		{`{"kind": "Deployment", "metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 2, "replicas": 3, "updatedReplicas": 3, "readyReplicas": 3, "availableReplicas": 3}}`, true, "3/3 replicas ready"},
+		{`{"kind": "Deployment", "spec": {"replicas": 3}, "status": {"replicas": 3, "updatedReplicas": 3, "readyReplicas": 1, "availableReplicas": 1}}`, false, "1/3 replicas ready"},
+		{`{"kind": "Deployment", "spec": {"replicas": 1}, "status": {"replicas": 1, "updatedReplicas": 1, "readyReplicas": 1}}`, false, "0/1 replicas available"},
+		// A rollout to a new template is not ready while the pods of the old
+		// one are.
+		{`{"kind": "Deployment", "metadata": {"generation": 2}, "spec": {"replicas": 1}, "status": {"observedGeneration": 1, "replicas": 1, "updatedReplicas": 1, "readyReplicas": 1, "availableReplicas": 1}}`, false, "update not yet observed"},
+		{`{"kind": "Deployment", "metadata": {"generation": 2}, "spec": {"replicas": 1}, "status": {"observedGeneration": 2, "replicas": 1, "readyReplicas": 1, "availableReplicas": 1}}`, false, "0/1 replicas updated"},
+		{`{"kind": "Deployment", "metadata": {"generation": 2}, "spec": {"replicas": 1}, "status": {"observedGeneration": 2, "replicas": 2, "updatedReplicas": 1, "readyReplicas": 1, "availableReplicas": 1}}`, false, "1 old replicas pending termination"},
+		{`{"kind": "ReplicaSet", "spec": {"replicas": 2}, "status": {"readyReplicas": 2, "availableReplicas": 2}}`, true, "2/2 replicas ready"},
+		{`{"kind": "StatefulSet", "spec": {}, "status": {}}`, false, "0/1 replicas updated"},
+		{`{"kind": "StatefulSet", "spec": {"replicas": 2, "updateStrategy": {"type": "OnDelete"}}, "status": {"readyReplicas": 2}}`, true, "2/2 replicas ready"},
+		{`{"kind": "StatefulSet", "spec": {"replicas": 3, "updateStrategy": {"type": "RollingUpdate", "rollingUpdate": {"partition": 2}}}, "status": {"updatedReplicas": 1, "readyReplicas": 3}}`, true, "3/3 replicas ready"},
+		{`{"kind": "DaemonSet", "status": {"desiredNumberScheduled": 2, "updatedNumberScheduled": 2, "numberReady": 2, "numberAvailable": 2}}`, true, "2/2 pods ready"},
+		{`{"kind": "DaemonSet", "status": {"desiredNumberScheduled": 2, "updatedNumberScheduled": 1, "numberReady": 2, "numberAvailable": 2}}`, false, "1/2 pods updated"},
+		{`{"kind": "Job", "status": {"conditions": [{"type": "Complete", "status": "True"}]}}`, true, "complete"},
+		{`{"kind": "Job", "status": {"conditions": [{"type": "Failed", "status": "True"}]}}`, false, "failed"},
+		{`{"kind": "Job", "status": {"active": 1}}`, false, "running (1 active)"},
+		{`{"kind": "Pod", "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "True"}]}}`, true, "running and ready"},
+		{`{"kind": "Pod", "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "False"}]}}`, false, "running"},
+		{`{"kind": "PersistentVolumeClaim", "status": {"phase": "Bound"}}`, true, "bound"},
+		{`{"kind": "Ingress", "status": {"loadBalancer": {"ingress": [{"ip": "10.0.0.1"}]}}}`, true, "address 10.0.0.1 assigned"},
+		{`{"kind": "Ingress", "status": {"loadBalancer": {}}}`, false, "no address assigned"},
+		{`{"kind": "Service", "spec": {"type": "LoadBalancer"}, "status": {"loadBalancer": {"ingress": [{"hostname": "lb.example.com"}]}}}`, true, "address lb.example.com assigned"},
+		{`{"kind": "Service", "spec": {"type": "ClusterIP"}}`, true, "ready"},
+		{`{"kind": "CustomResourceDefinition", "status": {"conditions": [{"type": "NamesAccepted", "status": "True"}, {"type": "Established", "status": "True"}]}}`, true, "established"},
+		{`{"kind": "CustomResourceDefinition", "status": {"conditions": [{"type": "NamesAccepted", "status": "True"}, {"type": "Established", "status": "False"}]}}`, false, "not yet established"},
+		{`{"kind": "CustomResourceDefinition", "status": {"conditions": [{"type": "NamesAccepted", "status": "False", "message": "\"widgets\" is already in use"}]}}`, false, "names not accepted: \"widgets\" is already in use"},
+		{`{"kind": "CustomResourceDefinition"}`, false, "not yet established"},
+		{`{"kind": "ConfigMap"}`, true, "ready"},
+	}
+
+	for _, test := range tests {
+		ready, detail := objectReadiness(mustUnstructured(t, test.obj))
+		if ready != test.ready || detail != test.detail {
+			t.Errorf("Expected '%s' to be ready=%t (%s), got ready=%t (%s)", test.obj, test.ready, test.detail, ready, detail)
+		}
+	}
+}
+
+func TestWriteReadinessSummary(t *testing.T) {
+	objs := []*unstructured.Unstructured{
+		mustUnstructured(t, `{"kind": "Deployment", "metadata": {"name": "redis", "namespace": "default", "labels": {"ksonnet.io/component": "redis"}}, "spec": {"replicas": 1}, "status": {}}`),
+		mustUnstructured(t, `{"kind": "Deployment", "metadata": {"name": "ui", "namespace": "default", "labels": {"ksonnet.io/component": "guestbook"}}, "spec": {"replicas": 3}, "status": {"replicas": 3, "updatedReplicas": 3, "readyReplicas": 3, "availableReplicas": 3}}`),
+		mustUnstructured(t, `{"kind": "Service", "metadata": {"name": "ui", "namespace": "default", "labels": {"ksonnet.io/component": "guestbook"}}, "spec": {}}`),
+		mustUnstructured(t, `{"kind": "ConfigMap", "metadata": {"name": "extra", "namespace": "default"}}`),
+	}
+	errs := map[*unstructured.Unstructured]error{objs[3]: fmt.Errorf("forbidden")}
+
+	var buf bytes.Buffer
+	if err := writeReadinessSummary(&buf, objs, errs, nil); err != nil {
+		t.Fatalf("Failed to write readiness summary:\n%v", err)
+	}
+
+	expected := `Component readiness:
+  (no component): not ready (0/1 objects ready)
+    ConfigMap default.extra: unknown (forbidden)
+  guestbook: ready
+    Deployment default.ui: 3/3 replicas ready
+    Service default.ui: ready
+  redis: not ready (0/1 objects ready)
+    Deployment default.redis: 0/1 replicas updated
+`
+	if buf.String() != expected {
+		t.Errorf("Expected readiness summary:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// RollbackState is the state of a set of objects before they were applied,
+// from which a failed apply can be undone.
+type RollbackState struct {
+	// Existing holds the live versions of the objects that already existed.
+	Existing []*unstructured.Unstructured
+	// Created holds the objects that did not exist, and so are created by the
+	// apply.
+	Created []*unstructured.Unstructured
+}
+
+// RollbackCmd captures the state of objects before an apply, and restores it
+// afterwards.
+type RollbackCmd struct {
+	ClientPool dynamic.ClientPool
+	Discovery  discovery.DiscoveryInterface
+	Namespace  string
+}
+
+// Capture retrieves the current state of `apiObjects`.
+func (c RollbackCmd) Capture(apiObjects []*unstructured.Unstructured) (*RollbackState, error) {
+	state := &RollbackState{}
+	for _, obj := range apiObjects {
+		rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		live, err := rc.Get(obj.GetName())
+		if errors.IsNotFound(err) {
+			state.Created = append(state.Created, obj)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Error retrieving %s %s: %v", obj.GetKind(), utils.FqName(obj), err)
+		}
+		state.Existing = append(state.Existing, restorable(live))
+	}
+
+	log.Debugf("Captured %d existing object(s) to roll back to; %d will be created", len(state.Existing), len(state.Created))
+	return state, nil
+}
+
+// Run restores the objects in `state`: the objects that already existed are
+// replaced with their previous versions, and the objects that were created
+// are deleted.
+func (c RollbackCmd) Run(state *RollbackState) error {
+	existing := append([]*unstructured.Unstructured{}, state.Existing...)
+	sort.Sort(utils.DependencyOrder(existing))
+	for _, obj := range existing {
+		if err := c.restoreObject(obj); err != nil {
+			return err
+		}
+	}
+
+	if len(state.Created) == 0 {
+		return nil
+	}
+	version, err := utils.FetchVersion(c.Discovery)
+	if err != nil {
+		return err
+	}
+	created := append([]*unstructured.Unstructured{}, state.Created...)
+	sort.Sort(sort.Reverse(utils.DependencyOrder(created)))
+	for _, obj := range created {
+		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+		rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+		if err != nil {
+			return err
+		}
+		live, err := rc.Get(obj.GetName())
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Error retrieving %s: %v", desc, err)
+		}
+
+		log.Info("Rolling back: deleting ", desc)
+		if err := gcDelete(c.ClientPool, c.Discovery, &version, live); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreObject replaces the live version of `obj` with `obj`, or recreates
+// it if it has since been deleted. Unlike the merge patches of `ApplyCmd`, a
+// replacement also removes the fields that the apply added.
+func (c RollbackCmd) restoreObject(obj *unstructured.Unstructured) error {
+	desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+	log.Info("Rolling back: restoring ", desc)
+
+	rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+	if err != nil {
+		return err
+	}
+
+	live, err := rc.Get(obj.GetName())
+	if errors.IsNotFound(err) {
+		_, err = rc.Create(obj)
+	} else if err == nil {
+		obj.SetResourceVersion(live.GetResourceVersion())
+		_, err = rc.Update(obj)
+	}
+	if err != nil {
+		return fmt.Errorf("Error restoring %s: %v", desc, err)
+	}
+	return nil
+}
+
+// restorable strips the live object `obj` of the fields that the server sets,
+// so that it can be written back later.
+func restorable(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	delete(obj.Object, "status")
+	if m, ok := obj.Object["metadata"].(map[string]interface{}); ok {
+		for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "selfLink"} {
+			delete(m, field)
+		}
+	}
+	return obj
+}
+
+// RollbackError reports an apply that was undone by an automatic rollback
+// (see `ApplyCmd.RollbackTimeout`).
+type RollbackError struct {
+	// Cause is why the apply was rolled back.
+	Cause error
+	// Components are the components (see `utils.ComponentLabel`) that did
+	// not become ready, if that is why.
+	Components []string
+}
+
+func (e *RollbackError) Error() string {
+	if len(e.Components) != 0 {
+		return fmt.Sprintf("Rolled back, as component(s) %s did not become ready:\n%v", strings.Join(e.Components, ", "), e.Cause)
+	}
+	return fmt.Sprintf("Rolled back, as the apply failed:\n%v", e.Cause)
+}
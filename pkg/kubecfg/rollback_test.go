@@ -0,0 +1,150 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRestorable(t *testing.T) {
+	live := mustUnstructured(t, `{
+		"apiVersion": "v1",
+		"kind": "ConfigMap",
+		"metadata": {
+			"name": "config",
+			"namespace": "prod",
+			"labels": {"ksonnet.io/component": "config"},
+			"uid": "1234",
+			"resourceVersion": "42",
+			"generation": 3,
+			"creationTimestamp": "2017-01-01T00:00:00Z",
+			"selfLink": "/api/v1/namespaces/prod/configmaps/config"
+		},
+		"data": {"key": "value"},
+		"status": {}
+	}`)
+	expected := mustUnstructured(t, `{
+		"apiVersion": "v1",
+		"kind": "ConfigMap",
+		"metadata": {
+			"name": "config",
+			"namespace": "prod",
+			"labels": {"ksonnet.io/component": "config"}
+		},
+		"data": {"key": "value"}
+	}`)
+
+	if obj := restorable(live); !reflect.DeepEqual(obj.Object, expected.Object) {
+		t.Errorf("Expected %v, got %v", expected.Object, obj.Object)
+	}
+}
+
+func TestNotReadyErrorComponents(t *testing.T) {
+	objs := []*unstructured.Unstructured{
+		mustUnstructured(t, `{"kind": "Deployment", "metadata": {"name": "web", "labels": {"ksonnet.io/component": "web"}}}`),
+		mustUnstructured(t, `{"kind": "Job", "metadata": {"name": "migrate", "labels": {"ksonnet.io/component": "db"}}}`),
+		mustUnstructured(t, `{"kind": "Service", "metadata": {"name": "web", "labels": {"ksonnet.io/component": "web"}}}`),
+		mustUnstructured(t, `{"kind": "Pod", "metadata": {"name": "debug"}}`),
+	}
+	err := &NotReadyError{Timeout: time.Minute, Objects: objs, Details: []string{"a", "b", "c", "d"}}
+
+	expected := []string{noComponent, "db", "web"}
+	if components := err.Components(); !reflect.DeepEqual(components, expected) {
+		t.Errorf("Expected components %v, got %v", expected, components)
+	}
+	if msg := err.Error(); msg != "Timed out after 1m0s waiting for 4 object(s) to become ready: a, b, c, d" {
+		t.Errorf("Unexpected error message '%s'", msg)
+	}
+}
+
+func TestRollbackError(t *testing.T) {
+	tests := []struct {
+		err      *RollbackError
+		expected string
+	}{
+		{
+			&RollbackError{Cause: fmt.Errorf("not ready"), Components: []string{"db", "web"}},
+			"Rolled back, as component(s) db, web did not become ready:\nnot ready",
+		},
+		{
+			&RollbackError{Cause: fmt.Errorf("forbidden")},
+			"Rolled back, as the apply failed:\nforbidden",
+		},
+	}
+
+	for _, test := range tests {
+		if msg := test.err.Error(); msg != test.expected {
+			t.Errorf("Expected '%s', got '%s'", test.expected, msg)
+		}
+	}
+}
+
+func TestApplyRollsBackRolloutThatIsNotReady(t *testing.T) {
+	defer func(interval time.Duration) { waitPollInterval = interval }(waitPollInterval)
+	waitPollInterval = time.Millisecond
+
+	cluster := newFakeCluster(t)
+	defer cluster.Close()
+
+	// The pod of the previous image is ready, but the controller never gets
+	// to report the rollout to the new image: its observed generation and
+	// updated replicas lag behind.
+	cluster.add(`{
+		"apiVersion": "apps/v1beta1",
+		"kind": "Deployment",
+		"metadata": {"name": "web", "namespace": "default", "uid": "web-uid", "generation": 1, "labels": {"ksonnet.io/component": "web"}},
+		"spec": {"replicas": 1, "template": {"spec": {"containers": [{"name": "web", "image": "web:1"}]}}},
+		"status": {"observedGeneration": 1, "replicas": 1, "updatedReplicas": 1, "readyReplicas": 1, "availableReplicas": 1}
+	}`)
+
+	obj := mustUnstructured(t, `{
+		"apiVersion": "apps/v1beta1",
+		"kind": "Deployment",
+		"metadata": {"name": "web", "namespace": "default", "labels": {"ksonnet.io/component": "web"}},
+		"spec": {"replicas": 1, "template": {"spec": {"containers": [{"name": "web", "image": "web:2"}]}}}
+	}`)
+
+	var out bytes.Buffer
+	c := ApplyCmd{
+		ClientPool:      cluster,
+		Discovery:       cluster.discovery(),
+		Namespace:       "default",
+		Create:          true,
+		Out:             &out,
+		RollbackTimeout: 10 * time.Millisecond,
+	}
+	err := c.Run([]*unstructured.Unstructured{obj}, "")
+
+	rollbackErr, ok := err.(*RollbackError)
+	if !ok {
+		t.Fatalf("Expected the apply to be rolled back, got error: %v", err)
+	}
+	if !reflect.DeepEqual(rollbackErr.Components, []string{"web"}) {
+		t.Errorf("Expected component 'web' not to become ready, got %v", rollbackErr.Components)
+	}
+
+	live := cluster.get(`{"apiVersion": "apps/v1beta1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "default"}}`)
+	image := nestedField(live, "spec", "template", "spec", "containers").([]interface{})[0].(map[string]interface{})["image"]
+	if image != "web:1" {
+		t.Errorf("Expected the Deployment to be rolled back to image 'web:1', got '%v'", image)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	ruleSchemaViolation   = "schema-violation"
+	ruleSchemaUnavailable = "schema-unavailable"
+)
+
+// validationFinding is a single problem found by `ValidateCmd`.
+type validationFinding struct {
+	rule   string
+	object string
+	// source is the file that produced the object, if known.
+	source string
+	err    error
+}
+
+// The types below are the subset of the SARIF 2.1.0 format that `ks validate`
+// emits. See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// writeSARIF writes `findings` to `out` as a SARIF log. Findings whose source
+// is known are located in that file, as well as in the object.
+func writeSARIF(out io.Writer, findings []validationFinding) error {
+	results := []sarifResult{}
+	for _, finding := range findings {
+		location := sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{
+				{FullyQualifiedName: finding.object, Kind: "object"},
+			},
+		}
+		if finding.source != "" {
+			location.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: finding.source},
+			}
+		}
+
+		level := "error"
+		if finding.rule == ruleSchemaUnavailable {
+			level = "warning"
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    finding.rule,
+			Level:     level,
+			Message:   sarifMessage{Text: finding.object + ": " + finding.err.Error()},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name:           "ksonnet",
+						InformationURI: "https://github.com/ksonnet/ksonnet",
+						Rules: []sarifRule{
+							{ID: ruleSchemaViolation, ShortDescription: sarifMessage{Text: "Object does not conform to the cluster's API schema"}},
+							{ID: ruleSchemaUnavailable, ShortDescription: sarifMessage{Text: "Could not retrieve the API schema of an object"}},
+						},
+					},
+				},
+				Results: results,
+			},
+		},
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
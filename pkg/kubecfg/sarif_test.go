@@ -0,0 +1,53 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	findings := []validationFinding{
+		{rule: ruleSchemaViolation, object: "pods default.foo", source: "components/foo.jsonnet", err: fmt.Errorf("unknown field \"bar\"")},
+		{rule: ruleSchemaUnavailable, object: "widgets default.baz", source: "environments/dev/main.jsonnet", err: fmt.Errorf("Unable to fetch schema")},
+		{rule: ruleSchemaViolation, object: "pods default.qux", err: fmt.Errorf("unknown field \"bar\"")},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeSARIF(&buf, findings))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	require.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+
+	results := log.Runs[0].Results
+	require.Len(t, results, 3)
+	require.Equal(t, ruleSchemaViolation, results[0].RuleID)
+	require.Equal(t, "error", results[0].Level)
+	require.Equal(t, "components/foo.jsonnet", results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	require.Equal(t, "pods default.foo", results[0].Locations[0].LogicalLocations[0].FullyQualifiedName)
+	require.Equal(t, "warning", results[1].Level)
+	require.Equal(t, "environments/dev/main.jsonnet", results[1].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+
+	// Without a source file, only logical locations are reported.
+	require.Nil(t, results[2].Locations[0].PhysicalLocation)
+}
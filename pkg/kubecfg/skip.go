@@ -0,0 +1,61 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// skipReason returns why `obj` is excluded from a command: either it has the
+// annotation `annotation` set to "true", or it belongs to a component for
+// which `componentSkips` is true. If the object is not excluded, it returns
+// the empty string.
+func skipReason(obj *unstructured.Unstructured, annotation string, components map[string]*metadata.ComponentSpec, componentSkips func(spec *metadata.ComponentSpec) bool) string {
+	if utils.HasTrueAnnotation(obj, annotation) {
+		return fmt.Sprintf("annotation '%s'", annotation)
+	}
+	component := obj.GetLabels()[utils.ComponentLabel]
+	if spec, ok := components[component]; ok && spec != nil && componentSkips(spec) {
+		return fmt.Sprintf("component '%s'", component)
+	}
+	return ""
+}
+
+// skippedObject is an object a command excluded, and why.
+type skippedObject struct {
+	desc, reason string
+}
+
+// logSkipped summarizes the objects that `action` (e.g., "validation")
+// skipped.
+func logSkipped(action string, skipped []skippedObject) {
+	if len(skipped) == 0 {
+		return
+	}
+	log.Infof("Skipped %s of %d object(s):", action, len(skipped))
+	for _, s := range skipped {
+		log.Infof("  %s (opted out by %s)", s.desc, s.reason)
+	}
+}
+
+func skipsValidate(spec *metadata.ComponentSpec) bool { return spec.SkipValidate }
+func skipsDiff(spec *metadata.ComponentSpec) bool     { return spec.SkipDiff }
@@ -0,0 +1,69 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+func TestSkipReason(t *testing.T) {
+	obj := func(component string, annotations map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":        "cm",
+				"labels":      map[string]interface{}{utils.ComponentLabel: component},
+				"annotations": annotations,
+			},
+		}}
+	}
+	components := map[string]*metadata.ComponentSpec{
+		"legacy":   {SkipDiff: true},
+		"frontend": {},
+		"empty":    nil,
+	}
+
+	for _, tc := range []struct {
+		obj      *unstructured.Unstructured
+		expected string
+	}{
+		{obj("frontend", nil), ""},
+		{obj("empty", nil), ""},
+		{obj("other", map[string]interface{}{utils.AnnotationSkipDiff: "false"}), ""},
+		{obj("other", map[string]interface{}{utils.AnnotationSkipDiff: "true"}), "annotation 'ksonnet.io/skip-diff'"},
+		{obj("legacy", nil), "component 'legacy'"},
+	} {
+		require.Equal(t, tc.expected, skipReason(tc.obj, utils.AnnotationSkipDiff, components, skipsDiff))
+	}
+
+	// Neither opts out of validation.
+	require.Equal(t, "", skipReason(obj("legacy", nil), utils.AnnotationSkipValidate, components, skipsValidate))
+
+	// Skipped objects are left out of the diff of two environments.
+	var out bytes.Buffer
+	c := DiffEnvsCmd{From: "dev", To: "prod", Components: components}
+	err := c.Run([]*unstructured.Unstructured{obj("legacy", nil)}, nil, &out)
+	require.NoError(t, err)
+	require.Equal(t, "", out.String())
+}
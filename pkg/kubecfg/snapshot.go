@@ -0,0 +1,226 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+// NewSnapshot records the objects applied to the environment `env` at time
+// `t`.
+func NewSnapshot(env string, apiObjects []*unstructured.Unstructured, t time.Time) (*metadata.Snapshot, error) {
+	snapshot := &metadata.Snapshot{Env: env, Timestamp: t.UTC(), Objects: []metadata.SnapshotObject{}}
+	for _, obj := range apiObjects {
+		// Map keys are marshalled in sorted order, so equal objects always hash
+		// equally.
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+
+		snapshot.Objects = append(snapshot.Objects, metadata.SnapshotObject{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+			Hash:       hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(snapshot.Objects, func(i, j int) bool {
+		return snapshot.Objects[i].Key() < snapshot.Objects[j].Key()
+	})
+	return snapshot, nil
+}
+
+// SnapshotObjects returns stubs of the objects recorded in `snapshot`, with
+// just enough of each object (its API version, kind, namespace, and name) to
+// identify it to the cluster, e.g., to delete it.
+func SnapshotObjects(snapshot *metadata.Snapshot) []*unstructured.Unstructured {
+	objs := []*unstructured.Unstructured{}
+	for _, o := range snapshot.Objects {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetAPIVersion(o.APIVersion)
+		obj.SetKind(o.Kind)
+		obj.SetNamespace(o.Namespace)
+		obj.SetName(o.Name)
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+// SnapshotDiff describes how the objects applied to an environment changed
+// between two snapshots.
+type SnapshotDiff struct {
+	Env       string                    `json:"env"`
+	From      string                    `json:"from"`
+	To        string                    `json:"to"`
+	Elapsed   string                    `json:"elapsed"`
+	Added     []metadata.SnapshotObject `json:"added"`
+	Removed   []metadata.SnapshotObject `json:"removed"`
+	Changed   []metadata.SnapshotObject `json:"changed"`
+	Unchanged int                       `json:"unchanged"`
+}
+
+func diffSnapshots(from, to *metadata.Snapshot) *SnapshotDiff {
+	diff := &SnapshotDiff{
+		Env:     to.Env,
+		From:    from.ID,
+		To:      to.ID,
+		Elapsed: to.Timestamp.Sub(from.Timestamp).String(),
+		Added:   []metadata.SnapshotObject{},
+		Removed: []metadata.SnapshotObject{},
+		Changed: []metadata.SnapshotObject{},
+	}
+
+	fromObjs := map[string]metadata.SnapshotObject{}
+	for _, obj := range from.Objects {
+		fromObjs[obj.Key()] = obj
+	}
+
+	for _, obj := range to.Objects {
+		prev, ok := fromObjs[obj.Key()]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, obj)
+		case prev.Hash != obj.Hash:
+			diff.Changed = append(diff.Changed, obj)
+		default:
+			diff.Unchanged++
+		}
+		delete(fromObjs, obj.Key())
+	}
+
+	for _, obj := range from.Objects {
+		if _, ok := fromObjs[obj.Key()]; ok {
+			diff.Removed = append(diff.Removed, obj)
+		}
+	}
+
+	return diff
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ==================================================================
+
+// SnapshotListCmd lists the snapshots of an environment, oldest first.
+type SnapshotListCmd struct {
+	env string
+
+	manager metadata.Manager
+}
+
+func NewSnapshotListCmd(env string, manager metadata.Manager) (*SnapshotListCmd, error) {
+	return &SnapshotListCmd{env: env, manager: manager}, nil
+}
+
+func (c *SnapshotListCmd) Run(out io.Writer) error {
+	type summary struct {
+		ID        string    `json:"id"`
+		Timestamp time.Time `json:"timestamp"`
+		Objects   int       `json:"objects"`
+	}
+
+	snapshots, err := c.manager.GetSnapshots(c.env)
+	if err != nil {
+		return err
+	}
+
+	summaries := []summary{}
+	for _, snapshot := range snapshots {
+		summaries = append(summaries, summary{ID: snapshot.ID, Timestamp: snapshot.Timestamp, Objects: len(snapshot.Objects)})
+	}
+
+	return writeJSON(out, summaries)
+}
+
+// ==================================================================
+
+// SnapshotShowCmd displays a snapshot of an environment.
+type SnapshotShowCmd struct {
+	env string
+	id  string
+
+	manager metadata.Manager
+}
+
+func NewSnapshotShowCmd(env, id string, manager metadata.Manager) (*SnapshotShowCmd, error) {
+	return &SnapshotShowCmd{env: env, id: id, manager: manager}, nil
+}
+
+func (c *SnapshotShowCmd) Run(out io.Writer) error {
+	snapshot, err := c.manager.GetSnapshot(c.env, c.id)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(out, snapshot)
+}
+
+// ==================================================================
+
+// SnapshotDiffCmd compares two snapshots of an environment. If the IDs are
+// omitted, the two most recent snapshots are compared.
+type SnapshotDiffCmd struct {
+	env    string
+	fromID string
+	toID   string
+
+	manager metadata.Manager
+}
+
+func NewSnapshotDiffCmd(env, fromID, toID string, manager metadata.Manager) (*SnapshotDiffCmd, error) {
+	return &SnapshotDiffCmd{env: env, fromID: fromID, toID: toID, manager: manager}, nil
+}
+
+func (c *SnapshotDiffCmd) Run(out io.Writer) error {
+	var from, to *metadata.Snapshot
+	if c.fromID == "" && c.toID == "" {
+		snapshots, err := c.manager.GetSnapshots(c.env)
+		if err != nil {
+			return err
+		} else if len(snapshots) < 2 {
+			return fmt.Errorf("Environment '%s' has fewer than two snapshots to compare", c.env)
+		}
+		from, to = snapshots[len(snapshots)-2], snapshots[len(snapshots)-1]
+	} else {
+		var err error
+		if from, err = c.manager.GetSnapshot(c.env, c.fromID); err != nil {
+			return err
+		}
+		if to, err = c.manager.GetSnapshot(c.env, c.toID); err != nil {
+			return err
+		}
+	}
+
+	return writeJSON(out, diffSnapshots(from, to))
+}
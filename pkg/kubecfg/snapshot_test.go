@@ -0,0 +1,96 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+func newSnapshotTestObj(name, image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"spec":       map[string]interface{}{"image": image},
+	}}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	t0 := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	from, err := NewSnapshot("dev", []*unstructured.Unstructured{
+		newSnapshotTestObj("a", "nginx:1"),
+		newSnapshotTestObj("b", "nginx:1"),
+		newSnapshotTestObj("c", "nginx:1"),
+	}, t0)
+	require.NoError(t, err)
+	from.ID = "from"
+
+	to, err := NewSnapshot("dev", []*unstructured.Unstructured{
+		newSnapshotTestObj("b", "nginx:2"),
+		newSnapshotTestObj("c", "nginx:1"),
+		newSnapshotTestObj("d", "nginx:1"),
+	}, t0.Add(time.Hour))
+	require.NoError(t, err)
+	to.ID = "to"
+
+	diff := diffSnapshots(from, to)
+
+	names := func(objs []metadata.SnapshotObject) []string {
+		res := []string{}
+		for _, obj := range objs {
+			res = append(res, obj.Name)
+		}
+		return res
+	}
+	require.Equal(t, []string{"d"}, names(diff.Added))
+	require.Equal(t, []string{"a"}, names(diff.Removed))
+	require.Equal(t, []string{"b"}, names(diff.Changed))
+	require.Equal(t, 1, diff.Unchanged)
+	require.Equal(t, "1h0m0s", diff.Elapsed)
+}
+
+func TestSnapshotObjects(t *testing.T) {
+	snapshot, err := NewSnapshot("dev", []*unstructured.Unstructured{
+		newSnapshotTestObj("web", "nginx:1.13"),
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "dev"},
+		}},
+	}, time.Now())
+	require.NoError(t, err)
+
+	objs := SnapshotObjects(snapshot)
+	require.Len(t, objs, 2)
+
+	require.Equal(t, "Namespace", objs[0].GetKind())
+	require.Equal(t, "dev", objs[0].GetName())
+	require.Equal(t, "", objs[0].GetNamespace())
+
+	require.Equal(t, "v1", objs[1].GetAPIVersion())
+	require.Equal(t, "Pod", objs[1].GetKind())
+	require.Equal(t, "default", objs[1].GetNamespace())
+	require.Equal(t, "web", objs[1].GetName())
+	_, hasSpec := objs[1].Object["spec"]
+	require.False(t, hasSpec, "Expected snapshot objects to identify, not describe, objects")
+}
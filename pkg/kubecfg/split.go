@@ -0,0 +1,138 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+// ComponentSplitCmd represents the `component split` subcommand
+type ComponentSplitCmd struct {
+	Component string
+	// Env is the environment the component and its pieces are rendered in, to
+	// name the new components and check that they render the same objects.
+	Env     string
+	Manager metadata.Manager
+}
+
+// Run replaces the component with one component for each top-level element of
+// its array or object, and a library holding the locals they share.
+func (c ComponentSplitCmd) Run() error {
+	pieces, err := c.Manager.ComponentPieces(c.Component)
+	if err != nil {
+		return err
+	}
+
+	original, err := c.Manager.RenderComponentSource(c.Env, c.Component, pieces.Source)
+	if err != nil {
+		return err
+	}
+
+	parts := map[string]string{}
+	split := []*unstructured.Unstructured{}
+	for i, piece := range pieces.Pieces {
+		objs, err := c.Manager.RenderComponentSource(c.Env, c.Component, piece.Snippet)
+		if err != nil {
+			return fmt.Errorf("Could not render %s of component '%s' on its own (does it refer to 'self' or '$'?):\n%v", describePiece(piece, i), c.Component, err)
+		}
+		parts[splitName(c.Component, piece, i, objs, parts)] = piece.Source
+		split = append(split, objs...)
+	}
+
+	same, err := sameObjects(original, split)
+	if err != nil {
+		return err
+	} else if !same {
+		return fmt.Errorf("The pieces of component '%s' do not render the same objects as the component does in environment '%s'; it cannot be split", c.Component, c.Env)
+	}
+
+	return c.Manager.SplitComponent(c.Component, pieces.Shared, parts)
+}
+
+// describePiece describes the `i`th piece of a component, for errors.
+func describePiece(piece *metadata.ComponentPiece, i int) string {
+	if piece.Key != "" {
+		return fmt.Sprintf("field '%s'", piece.Key)
+	}
+	return fmt.Sprintf("element %d", i+1)
+}
+
+// invalidComponentNameChars matches the characters that may appear in object
+// names, but not in component names.
+var invalidComponentNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// splitName returns the name of the component made of the `i`th piece of
+// `component`, which renders to `objs`: `<component>-<kind>-<object-name>` if
+// it renders to a single object, or else `<component>-<key>` (or
+// `<component>-<i+1>`, for array elements). Names already in `parts` are not
+// reused.
+func splitName(component string, piece *metadata.ComponentPiece, i int, objs []*unstructured.Unstructured, parts map[string]string) string {
+	var name string
+	switch {
+	case len(objs) == 1:
+		name = fmt.Sprintf("%s-%s-%s", component, objs[0].GetKind(), objs[0].GetName())
+	case piece.Key != "":
+		name = fmt.Sprintf("%s-%s", component, piece.Key)
+	default:
+		name = fmt.Sprintf("%s-%d", component, i+1)
+	}
+	name = strings.Trim(invalidComponentNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+
+	if _, ok := parts[name]; ok {
+		// e.g., objects of the same kind and name in different namespaces.
+		for j := 2; ; j++ {
+			if _, ok := parts[fmt.Sprintf("%s-%d", name, j)]; !ok {
+				return fmt.Sprintf("%s-%d", name, j)
+			}
+		}
+	}
+	return name
+}
+
+// sameObjects returns whether `a` and `b` hold the same objects, in any order.
+func sameObjects(a, b []*unstructured.Unstructured) (bool, error) {
+	encode := func(objs []*unstructured.Unstructured) ([]string, error) {
+		encoded := []string{}
+		for _, obj := range objs {
+			data, err := json.Marshal(obj.Object)
+			if err != nil {
+				return nil, err
+			}
+			encoded = append(encoded, string(data))
+		}
+		sort.Strings(encoded)
+		return encoded, nil
+	}
+
+	encodedA, err := encode(a)
+	if err != nil {
+		return false, err
+	}
+	encodedB, err := encode(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(encodedA, encodedB), nil
+}
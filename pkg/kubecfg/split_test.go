@@ -0,0 +1,73 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/ksonnet/metadata"
+)
+
+func TestSplitName(t *testing.T) {
+	service := mustUnstructured(t, `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "ui"}}`)
+	role := mustUnstructured(t, `{"apiVersion": "rbac.authorization.k8s.io/v1beta1", "kind": "ClusterRole", "metadata": {"name": "system:ui"}}`)
+
+	parts := map[string]string{}
+	tests := []struct {
+		piece    *metadata.ComponentPiece
+		objs     []*unstructured.Unstructured
+		expected string
+	}{
+		{&metadata.ComponentPiece{Key: "service"}, []*unstructured.Unstructured{service}, "guestbook-service-ui"},
+		{&metadata.ComponentPiece{}, []*unstructured.Unstructured{role}, "guestbook-clusterrole-system-ui"},
+		// e.g., objects of the same kind and name in different namespaces.
+		{&metadata.ComponentPiece{}, []*unstructured.Unstructured{service}, "guestbook-service-ui-2"},
+		{&metadata.ComponentPiece{Key: "Backend_Tier"}, []*unstructured.Unstructured{service, role}, "guestbook-backend-tier"},
+		{&metadata.ComponentPiece{}, nil, "guestbook-5"},
+	}
+	for i, test := range tests {
+		name := splitName("guestbook", test.piece, i, test.objs, parts)
+		if name != test.expected {
+			t.Errorf("Expected piece %d to be named '%s', got '%s'", i, test.expected, name)
+		}
+		parts[name] = ""
+	}
+}
+
+func TestSameObjects(t *testing.T) {
+	a := mustUnstructured(t, `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "a"}}`)
+	b := mustUnstructured(t, `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "b"}}`)
+
+	tests := []struct {
+		x, y     []*unstructured.Unstructured
+		expected bool
+	}{
+		{[]*unstructured.Unstructured{a, b}, []*unstructured.Unstructured{b, a}, true},
+		{[]*unstructured.Unstructured{a, b}, []*unstructured.Unstructured{a}, false},
+		{[]*unstructured.Unstructured{a, a}, []*unstructured.Unstructured{a, b}, false},
+	}
+	for i, test := range tests {
+		same, err := sameObjects(test.x, test.y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same != test.expected {
+			t.Errorf("Test %d: expected %v, got %v", i, test.expected, same)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// ReadTerraformOutputs reads the root module outputs from a Terraform state
+// file (format version 3 or 4), or from the output of `terraform output
+// -json`. It returns a map of output name to value.
+func ReadTerraformOutputs(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := parseTerraformOutputs(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read Terraform outputs from '%s':\n%v", path, err)
+	}
+	return outputs, nil
+}
+
+type terraformOutput struct {
+	Value interface{} `json:"value"`
+}
+
+func parseTerraformOutputs(data []byte) (map[string]interface{}, error) {
+	var state struct {
+		Version *int                       `json:"version"`
+		Outputs map[string]terraformOutput `json:"outputs"`
+		Modules []struct {
+			Path    []string                   `json:"path"`
+			Outputs map[string]terraformOutput `json:"outputs"`
+		} `json:"modules"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]terraformOutput
+	switch {
+	case state.Version == nil:
+		// Not a state file; assume the output of `terraform output -json`,
+		// which maps each output name to an object holding its value.
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	case *state.Version >= 4:
+		raw = state.Outputs
+	default:
+		for _, module := range state.Modules {
+			if len(module.Path) == 1 && module.Path[0] == "root" {
+				raw = module.Outputs
+				break
+			}
+		}
+	}
+
+	outputs := map[string]interface{}{}
+	for name, output := range raw {
+		outputs[name] = output.Value
+	}
+	return outputs, nil
+}
+
+// TerraformOutputString returns the output `name` from `outputs`, which must
+// be a string.
+func TerraformOutputString(outputs map[string]interface{}, name string) (string, error) {
+	value, ok := outputs[name]
+	if !ok {
+		return "", fmt.Errorf("Terraform output '%s' does not exist", name)
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("Terraform output '%s' must be a string, but is '%v'", name, value)
+	}
+	return str, nil
+}
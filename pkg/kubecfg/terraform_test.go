@@ -0,0 +1,60 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTerraformOutputs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{
+			name: "terraform output -json",
+			data: `{"cluster_endpoint": {"sensitive": false, "type": "string", "value": "https://1.2.3.4"}}`,
+		},
+		{
+			name: "state version 3",
+			data: `{"version": 3, "modules": [
+				{"path": ["root", "gke"], "outputs": {"cluster_endpoint": {"value": "https://wrong"}}},
+				{"path": ["root"], "outputs": {"cluster_endpoint": {"type": "string", "value": "https://1.2.3.4"}}}
+			]}`,
+		},
+		{
+			name: "state version 4",
+			data: `{"version": 4, "outputs": {"cluster_endpoint": {"type": "string", "value": "https://1.2.3.4"}}}`,
+		},
+	} {
+		outputs, err := parseTerraformOutputs([]byte(tc.data))
+		require.NoError(t, err, tc.name)
+
+		endpoint, err := TerraformOutputString(outputs, "cluster_endpoint")
+		require.NoError(t, err, tc.name)
+		require.Equal(t, "https://1.2.3.4", endpoint, tc.name)
+
+		_, err = TerraformOutputString(outputs, "missing")
+		require.Error(t, err, tc.name)
+	}
+
+	outputs, err := parseTerraformOutputs([]byte(`{"version": 4, "outputs": {"ports": {"value": [80, 443]}}}`))
+	require.NoError(t, err)
+	_, err = TerraformOutputString(outputs, "ports")
+	require.Error(t, err)
+}
@@ -0,0 +1,284 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	isatty "github.com/mattn/go-isatty"
+)
+
+const (
+	// ColorAuto colors output only if it is written to a terminal, and the
+	// `NO_COLOR` environment variable is not set.
+	ColorAuto = "auto"
+	// ColorAlways always colors output.
+	ColorAlways = "always"
+	// ColorNever never colors output.
+	ColorNever = "never"
+
+	// DefaultDiffTheme is the theme used unless another is requested.
+	DefaultDiffTheme = "dark"
+)
+
+// DiffTheme is the palette used to color diffs. Each entry is the parameter
+// of an ANSI SGR escape sequence, e.g., "32" for green text, or "1;97;41" for
+// bold white text on a red background. Empty entries are not colored.
+type DiffTheme struct {
+	Header  string
+	Added   string
+	Deleted string
+	// AddedWord and DeletedWord highlight the words that changed within a
+	// modified line.
+	AddedWord   string
+	DeletedWord string
+}
+
+// diffThemes are the built-in themes.
+var diffThemes = map[string]DiffTheme{
+	"dark": {
+		Header:      "1",
+		Added:       "32",
+		Deleted:     "31",
+		AddedWord:   "1;97;42",
+		DeletedWord: "1;97;41",
+	},
+	// Bright colors wash out on a light background, so the light theme
+	// uses darker foregrounds and pale backgrounds for changed words.
+	"light": {
+		Header:      "1",
+		Added:       "38;5;22",
+		Deleted:     "38;5;124",
+		AddedWord:   "1;38;5;22;48;5;194",
+		DeletedWord: "1;38;5;124;48;5;224",
+	},
+}
+
+// sgrParams matches a valid SGR parameter list.
+var sgrParams = regexp.MustCompile(`^[0-9]+(;[0-9]+)*$`)
+
+// ParseDiffTheme returns the theme named `spec` ("dark" or "light"), or, if
+// `spec` is a comma-separated list of `<role>=<sgr>` pairs (e.g.,
+// "added=34,deleted=33"), the default theme with those roles overridden. The
+// roles are `header`, `added`, `deleted`, `added-word`, and `deleted-word`.
+func ParseDiffTheme(spec string) (*DiffTheme, error) {
+	if theme, ok := diffThemes[spec]; ok {
+		return &theme, nil
+	}
+	if !strings.Contains(spec, "=") {
+		return nil, fmt.Errorf("Unknown diff theme '%s'; must be 'dark', 'light', or a list of '<role>=<color>' pairs", spec)
+	}
+
+	theme := diffThemes[DefaultDiffTheme]
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || (kv[1] != "" && !sgrParams.MatchString(kv[1])) {
+			return nil, fmt.Errorf("Invalid diff theme entry '%s'; must be of the form '<role>=<color>', e.g., 'added=32'", pair)
+		}
+
+		switch strings.TrimSpace(kv[0]) {
+		case "header":
+			theme.Header = kv[1]
+		case "added":
+			theme.Added = kv[1]
+		case "deleted":
+			theme.Deleted = kv[1]
+		case "added-word":
+			theme.AddedWord = kv[1]
+		case "deleted-word":
+			theme.DeletedWord = kv[1]
+		default:
+			return nil, fmt.Errorf("Unknown diff theme role '%s'; must be one of header, added, deleted, added-word, or deleted-word", kv[0])
+		}
+	}
+	return &theme, nil
+}
+
+// UseColor decides whether output written to `out` should be colored, given
+// one of `ColorAuto`, `ColorAlways`, or `ColorNever`. Following
+// https://no-color.org, `auto` never colors when `NO_COLOR` is set.
+func UseColor(mode string, out io.Writer) (bool, error) {
+	switch mode {
+	case ColorAlways:
+		return true, nil
+	case ColorNever:
+		return false, nil
+	case ColorAuto, "":
+		if _, ok := os.LookupEnv("NO_COLOR"); ok {
+			return false, nil
+		}
+		if os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		return istty(out), nil
+	}
+	return false, fmt.Errorf("Unknown color mode '%s'; must be one of '%s', '%s', or '%s'", mode, ColorAuto, ColorAlways, ColorNever)
+}
+
+func istty(w io.Writer) bool {
+	if f, ok := w.(*os.File); ok {
+		return isatty.IsTerminal(f.Fd())
+	}
+	return false
+}
+
+// colorize wraps `text` in the SGR sequence `style`, unless it is empty.
+func colorize(style, text string) string {
+	if style == "" || text == "" {
+		return text
+	}
+	return "\x1b[" + style + "m" + text + "\x1b[0m"
+}
+
+// header renders a diff header line. A nil theme renders it as-is.
+func (t *DiffTheme) header(line string) string {
+	if t == nil {
+		return line
+	}
+	return colorize(t.Header, line)
+}
+
+// body colors the (uncolored) lines of a diff, whose first character is the
+// marker `+`, `-`, or ` `. Where a run of deleted lines is immediately
+// followed by a run of as many added lines, each pair is taken to be one
+// modified line, and the words that differ between them are highlighted.
+func (t *DiffTheme) body(text string) string {
+	if t == nil {
+		return text
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	out := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); {
+		if !strings.HasPrefix(lines[i], "-") {
+			if strings.HasPrefix(lines[i], "+") {
+				out = append(out, t.line(t.Added, lines[i]))
+			} else {
+				out = append(out, lines[i])
+			}
+			i++
+			continue
+		}
+
+		deleted := i
+		for i < len(lines) && strings.HasPrefix(lines[i], "-") {
+			i++
+		}
+		added := i
+		for i < len(lines) && strings.HasPrefix(lines[i], "+") {
+			i++
+		}
+
+		nDeleted, nAdded := added-deleted, i-added
+		if nDeleted != nAdded {
+			for _, line := range lines[deleted:added] {
+				out = append(out, t.line(t.Deleted, line))
+			}
+			for _, line := range lines[added:i] {
+				out = append(out, t.line(t.Added, line))
+			}
+			continue
+		}
+
+		oldLines, newLines := []string{}, []string{}
+		for j := 0; j < nDeleted; j++ {
+			oldLine, newLine := t.wordDiff(lines[deleted+j], lines[added+j])
+			oldLines = append(oldLines, oldLine)
+			newLines = append(newLines, newLine)
+		}
+		out = append(out, oldLines...)
+		out = append(out, newLines...)
+	}
+
+	return strings.Join(out, "")
+}
+
+// line colors `line` (excluding its trailing newline) with `style`.
+func (t *DiffTheme) line(style, line string) string {
+	trimmed := strings.TrimSuffix(line, "\n")
+	return colorize(style, trimmed) + line[len(trimmed):]
+}
+
+// diffTokens splits a line into words, runs of whitespace, and individual
+// punctuation characters.
+var diffTokens = regexp.MustCompile(`\w+|\s+|[^\w\s]`)
+
+// wordDiff colors the deleted line `oldLine` and the added line `newLine`,
+// highlighting the tokens that are not common to both. The markers are not
+// compared.
+func (t *DiffTheme) wordDiff(oldLine, newLine string) (string, string) {
+	oldTrimmed := strings.TrimSuffix(oldLine, "\n")
+	newTrimmed := strings.TrimSuffix(newLine, "\n")
+	oldTokens := diffTokens.FindAllString(oldTrimmed[1:], -1)
+	newTokens := diffTokens.FindAllString(newTrimmed[1:], -1)
+
+	oldCommon, newCommon := commonTokens(oldTokens, newTokens)
+	render := func(marker string, tokens []string, common []bool, style, wordStyle string) string {
+		var buf bytes.Buffer
+		buf.WriteString(colorize(style, marker))
+		for i, token := range tokens {
+			if common[i] {
+				buf.WriteString(colorize(style, token))
+			} else {
+				buf.WriteString(colorize(wordStyle, token))
+			}
+		}
+		return buf.String()
+	}
+
+	return render("-", oldTokens, oldCommon, t.Deleted, t.DeletedWord) + oldLine[len(oldTrimmed):],
+		render("+", newTokens, newCommon, t.Added, t.AddedWord) + newLine[len(newTrimmed):]
+}
+
+// commonTokens computes the longest common subsequence of `a` and `b`,
+// reporting for each token whether it is part of it.
+func commonTokens(a, b []string) ([]bool, []bool) {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	inA, inB := make([]bool, len(a)), make([]bool, len(b))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			inA[i], inB[j] = true, true
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return inA, inB
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestParseDiffTheme(t *testing.T) {
+	theme, err := ParseDiffTheme("light")
+	if err != nil || *theme != diffThemes["light"] {
+		t.Errorf("Expected the built-in light theme, got %v (%v)", theme, err)
+	}
+
+	theme, err = ParseDiffTheme("added=34,deleted=33,header=")
+	if err != nil {
+		t.Fatalf("Failed to parse custom theme:\n%v", err)
+	}
+	expected := diffThemes[DefaultDiffTheme]
+	expected.Added, expected.Deleted, expected.Header = "34", "33", ""
+	if *theme != expected {
+		t.Errorf("Expected theme %v, got %v", expected, *theme)
+	}
+
+	for _, spec := range []string{"solarized", "added=green", "sparkles=32", "added"} {
+		if _, err := ParseDiffTheme(spec); err == nil {
+			t.Errorf("Expected diff theme '%s' to be invalid", spec)
+		}
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	var buf bytes.Buffer
+
+	if color, err := UseColor(ColorAlways, &buf); err != nil || !color {
+		t.Errorf("Expected '%s' to color output", ColorAlways)
+	}
+	if color, err := UseColor(ColorNever, &buf); err != nil || color {
+		t.Errorf("Expected '%s' not to color output", ColorNever)
+	}
+	if color, err := UseColor(ColorAuto, &buf); err != nil || color {
+		t.Errorf("Expected '%s' not to color output that is not a terminal", ColorAuto)
+	}
+	if _, err := UseColor("sometimes", &buf); err == nil {
+		t.Errorf("Expected unknown color mode to fail")
+	}
+
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	if color, err := UseColor(ColorAuto, os.Stdout); err != nil || color {
+		t.Errorf("Expected '%s' not to color output when NO_COLOR is set", ColorAuto)
+	}
+}
+
+func TestDiffThemeBody(t *testing.T) {
+	theme := &DiffTheme{Added: "32", Deleted: "31", AddedWord: "42", DeletedWord: "41"}
+
+	// One deleted line followed by two added lines is not a modified line, so
+	// the lines are colored as a whole.
+	text := " {\n-  \"replicas\": 2,\n+  \"replicas\": 3,\n+  \"paused\": true\n }\n"
+	expected := " {\n" +
+		"\x1b[31m-  \"replicas\": 2,\x1b[0m\n" +
+		"\x1b[32m+  \"replicas\": 3,\x1b[0m\n" +
+		"\x1b[32m+  \"paused\": true\x1b[0m\n" +
+		" }\n"
+	if body := theme.body(text); body != expected {
+		t.Errorf("Expected body %q, got %q", expected, body)
+	}
+
+	text = "-  \"replicas\": 2,\n+  \"replicas\": 3,\n"
+	body := theme.body(text)
+	if !bytes.Contains([]byte(body), []byte("\x1b[41m2\x1b[0m")) || !bytes.Contains([]byte(body), []byte("\x1b[42m3\x1b[0m")) {
+		t.Errorf("Expected changed words to be highlighted, got %q", body)
+	}
+	if bytes.Contains([]byte(body), []byte("\x1b[41mreplicas")) {
+		t.Errorf("Expected unchanged words not to be highlighted, got %q", body)
+	}
+
+	var nilTheme *DiffTheme
+	if body := nilTheme.body(text); body != text {
+		t.Errorf("Expected a nil theme to leave the diff uncolored, got %q", body)
+	}
+}
@@ -23,40 +23,116 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/discovery"
 
+	"github.com/ksonnet/ksonnet/metadata"
 	"github.com/ksonnet/ksonnet/utils"
 )
 
+var (
+	// ErrValidationFailed is returned by `ValidateCmd` when some object does
+	// not conform to the cluster's schema.
+	ErrValidationFailed = fmt.Errorf("Validation failed")
+
+	// ErrSchemaUnavailable is returned by `ValidateCmd` when every object that
+	// could be checked is valid, but the schema of some other object could not
+	// be retrieved from the cluster.
+	ErrSchemaUnavailable = fmt.Errorf("Validation incomplete; could not retrieve the schema of some objects")
+)
+
+const (
+	// ValidateFormatText logs validation errors as they are found.
+	ValidateFormatText = "text"
+	// ValidateFormatSARIF additionally writes the validation errors to the
+	// output as a SARIF log, for consumption by code scanning tools.
+	ValidateFormatSARIF = "sarif"
+)
+
 // ValidateCmd represents the validate subcommand
 type ValidateCmd struct {
 	Discovery discovery.DiscoveryInterface
+
+	// Format is one of `ValidateFormatText` (the default) or
+	// `ValidateFormatSARIF`.
+	Format string
+	// Source is the file the objects were expanded from, if known. It is
+	// reported as the location of findings in SARIF output, unless the object
+	// belongs to a component in `ComponentSources`.
+	Source string
+	// ComponentSources are the files of the application's components, by
+	// component name. Findings in an object labeled with one of these
+	// components are located in its file in SARIF output.
+	ComponentSources map[string]string
+	// CRDs are the schemas of custom resources bundled with vendored
+	// libraries. Objects whose kind is described here are validated against
+	// these schemas, rather than against the cluster's.
+	CRDs *utils.CRDSchemas
+	// Components are the settings of the application's components; objects
+	// of components with `SkipValidate` set are not validated.
+	Components map[string]*metadata.ComponentSpec
 }
 
 func (c ValidateCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) error {
-	hasError := false
+	switch c.Format {
+	case "", ValidateFormatText, ValidateFormatSARIF:
+	default:
+		return fmt.Errorf("Unknown validation output format '%s'; supported values are: %s, %s", c.Format, ValidateFormatText, ValidateFormatSARIF)
+	}
+
+	findings := []validationFinding{}
+	skipped := []skippedObject{}
 
 	for _, obj := range apiObjects {
 		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+		source := c.Source
+		if componentSource, ok := c.ComponentSources[obj.GetLabels()[utils.ComponentLabel]]; ok {
+			source = componentSource
+		}
+		if reason := skipReason(obj, utils.AnnotationSkipValidate, c.Components, skipsValidate); reason != "" {
+			skipped = append(skipped, skippedObject{desc: desc, reason: reason})
+			continue
+		}
 		log.Info("Validating ", desc)
 
-		var allErrs []error
+		if c.CRDs.Has(obj.GroupVersionKind()) {
+			for _, err := range c.CRDs.Validate(obj) {
+				log.Errorf("Error in %s: %v", desc, err)
+				findings = append(findings, validationFinding{rule: ruleSchemaViolation, object: desc, source: source, err: err})
+			}
+			continue
+		}
 
 		schema, err := utils.NewSwaggerSchemaFor(c.Discovery, obj.GroupVersionKind().GroupVersion())
 		if err != nil {
-			allErrs = append(allErrs, fmt.Errorf("Unable to fetch schema: %v", err))
-		} else {
-			// Validate obj
-			allErrs = append(allErrs, schema.Validate(obj)...)
+			err = fmt.Errorf("Unable to fetch schema: %v", err)
+			log.Errorf("Error in %s: %v", desc, err)
+			findings = append(findings, validationFinding{rule: ruleSchemaUnavailable, object: desc, source: source, err: err})
+			continue
 		}
 
-		for _, err := range allErrs {
+		// Validate obj
+		for _, err := range schema.Validate(obj) {
 			log.Errorf("Error in %s: %v", desc, err)
-			hasError = true
+			findings = append(findings, validationFinding{rule: ruleSchemaViolation, object: desc, source: source, err: err})
+		}
+	}
+
+	logSkipped("validation", skipped)
+
+	if c.Format == ValidateFormatSARIF {
+		if err := writeSARIF(out, findings); err != nil {
+			return err
 		}
 	}
 
-	if hasError {
-		return fmt.Errorf("Validation failed")
+	// Invalid objects take precedence over objects that could not be checked.
+	result := error(nil)
+	for _, finding := range findings {
+		switch finding.rule {
+		case ruleSchemaViolation:
+			return ErrValidationFailed
+		case ruleSchemaUnavailable:
+			result = ErrSchemaUnavailable
+		}
 	}
 
-	return nil
+	return result
 }
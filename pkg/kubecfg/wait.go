@@ -0,0 +1,117 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/ksonnet/utils"
+)
+
+// waitPollInterval is how often the objects are checked while waiting.
+var waitPollInterval = 5 * time.Second
+
+// WaitCmd waits for objects to become ready, in the sense of the readiness
+// summary written after `apply`.
+type WaitCmd struct {
+	ClientPool dynamic.ClientPool
+	Discovery  discovery.DiscoveryInterface
+	Namespace  string
+
+	Timeout time.Duration
+	// HealthPolicies, if set, decide the readiness of objects of the kinds
+	// they apply to.
+	HealthPolicies HealthPolicies
+}
+
+// NotReadyError reports the objects that did not become ready in time.
+type NotReadyError struct {
+	Timeout time.Duration
+	// Objects are the objects that were not ready, and Details describe why,
+	// in the same order.
+	Objects []*unstructured.Unstructured
+	Details []string
+}
+
+func (e *NotReadyError) Error() string {
+	return fmt.Sprintf("Timed out after %s waiting for %d object(s) to become ready: %s", e.Timeout, len(e.Objects), strings.Join(e.Details, ", "))
+}
+
+// Components returns the components (see `utils.ComponentLabel`) of the
+// objects that were not ready, in order.
+func (e *NotReadyError) Components() []string {
+	seen := map[string]bool{}
+	components := []string{}
+	for _, obj := range e.Objects {
+		component := obj.GetLabels()[utils.ComponentLabel]
+		if component == "" {
+			component = noComponent
+		}
+		if !seen[component] {
+			seen[component] = true
+			components = append(components, component)
+		}
+	}
+	sort.Strings(components)
+	return components
+}
+
+func (c WaitCmd) Run(apiObjects []*unstructured.Unstructured) error {
+	deadline := time.Now().Add(c.Timeout)
+	for {
+		unready := []string{}
+		unreadyObjs := []*unstructured.Unstructured{}
+		for _, obj := range apiObjects {
+			desc := fmt.Sprintf("%s %s", obj.GetKind(), utils.FqName(obj))
+
+			rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.Namespace)
+			if err != nil {
+				return err
+			}
+			live, err := rc.Get(obj.GetName())
+			if err != nil {
+				unready = append(unready, fmt.Sprintf("%s (%v)", desc, err))
+				unreadyObjs = append(unreadyObjs, obj)
+				continue
+			}
+			if ready, detail := c.HealthPolicies.readiness(live); !ready {
+				unready = append(unready, fmt.Sprintf("%s (%s)", desc, detail))
+				unreadyObjs = append(unreadyObjs, obj)
+			}
+		}
+
+		if len(unready) == 0 {
+			log.Infof("All %d object(s) are ready", len(apiObjects))
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return &NotReadyError{Timeout: c.Timeout, Objects: unreadyObjs, Details: unready}
+		}
+
+		log.Infof("Waiting for %d object(s) to become ready", len(unready))
+		log.Debugf("Not yet ready: %s", strings.Join(unready, ", "))
+		time.Sleep(waitPollInterval)
+	}
+}
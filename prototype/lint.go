@@ -0,0 +1,206 @@
+package prototype
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/parser"
+
+	"github.com/ksonnet/ksonnet/prototype/snippet"
+)
+
+// LintSeverity is the severity of a problem found by `Lint`.
+type LintSeverity string
+
+const (
+	// LintError is a problem that will cause the prototype to fail (or to
+	// generate broken code) when it is used.
+	LintError LintSeverity = "error"
+
+	// LintWarning is a problem that makes the prototype harder to use, but that
+	// does not stop it from working.
+	LintWarning LintSeverity = "warning"
+)
+
+// LintIssue is a single problem found in a prototype specification. It is
+// JSON-serializable, so that (e.g.) a registry's CI can consume it.
+type LintIssue struct {
+	Prototype string       `json:"prototype"`
+	Severity  LintSeverity `json:"severity"`
+	Rule      string       `json:"rule"`
+	Message   string       `json:"message"`
+}
+
+func (li *LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s [%s]", li.Prototype, li.Severity, li.Message, li.Rule)
+}
+
+// LintIssues is a slice of pointer to `LintIssue`.
+type LintIssues []*LintIssue
+
+// Errors returns the number of issues with severity `LintError`.
+func (lis LintIssues) Errors() int {
+	n := 0
+	for _, li := range lis {
+		if li.Severity == LintError {
+			n++
+		}
+	}
+	return n
+}
+
+// lintSampleValues are the values substituted for parameters that have no
+// default when checking that a template body is syntactically valid. Each is a
+// value that `ParamSchema.Quote` accepts for its type.
+var lintSampleValues = map[ParamType]string{
+	Number:         "0",
+	String:         "value",
+	NumberOrString: "value",
+	Object:         "{}",
+	Array:          "[]",
+	Quantity:       "1",
+	Duration:       "1s",
+	SecretRef:      "name/key",
+	ConfigRef:      "name/key",
+	ImageRef:       "image",
+}
+
+// Lint checks a prototype specification for problems that its author should
+// fix before publishing it, e.g.:
+//
+//   - parameters used in a template body that are not declared,
+//   - parameters that are declared, but never used,
+//   - missing descriptions, invalid default values, and invalid allowed
+//     values (see `ParamSchema.Enum`), and
+//   - template bodies that are not syntactically valid Jsonnet (or JSON), once
+//     their parameters are filled in.
+func Lint(spec *SpecificationSchema) LintIssues {
+	issues := LintIssues{}
+	report := func(severity LintSeverity, rule, format string, args ...interface{}) {
+		issues = append(issues, &LintIssue{
+			Prototype: spec.Name,
+			Severity:  severity,
+			Rule:      rule,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	if spec.Name == "" {
+		report(LintError, "missing-name", "Prototype has no name")
+	}
+	if spec.Template.ShortDescription == "" {
+		report(LintWarning, "missing-description", "Prototype has no short description")
+	}
+	if spec.Template.Description == "" {
+		report(LintWarning, "missing-description", "Prototype has no description")
+	}
+
+	declared := map[string]*ParamSchema{}
+	values := map[string]string{}
+	for _, param := range spec.Params {
+		if _, ok := declared[param.Name]; ok {
+			report(LintError, "duplicate-param", "Parameter '%s' is declared more than once", param.Name)
+			continue
+		}
+		declared[param.Name] = param
+
+		if param.Description == "" {
+			report(LintWarning, "missing-description", "Parameter '%s' has no description", param.Name)
+		}
+		if param.Type.String() == "unknown" {
+			report(LintError, "unknown-param-type", "Parameter '%s' has unknown type '%s'", param.Name, param.Type)
+			continue
+		}
+
+		sample := lintSampleValues[param.Type]
+		for _, allowed := range param.Enum {
+			if _, err := param.Quote(allowed); err != nil {
+				report(LintError, "invalid-enum", "Allowed value '%s' of parameter '%s' is invalid: %v", allowed, param.Name, err)
+			} else {
+				sample = allowed
+			}
+		}
+
+		value := sample
+		if param.Default != nil {
+			value = *param.Default
+		}
+		quoted, err := param.Quote(value)
+		if err != nil {
+			report(LintError, "invalid-default", "Default value '%s' of parameter '%s' is invalid: %v", value, param.Name, err)
+			quoted, _ = param.Quote(sample)
+		}
+		values[param.Name] = quoted
+	}
+
+	templateTypes := spec.Template.AvailableTemplates()
+	if len(templateTypes) == 0 {
+		report(LintError, "missing-body", "Prototype has no template body")
+	}
+
+	used := map[string]bool{}
+	for _, t := range templateTypes {
+		body, err := spec.Template.Body(t)
+		if err != nil {
+			report(LintError, "missing-body", "%v", err)
+			continue
+		}
+		source := strings.Join(body, "\n")
+
+		names := snippet.Parse(source).Variables()
+		for _, name := range names {
+			used[name] = true
+			if _, ok := declared[name]; !ok {
+				report(LintError, "undeclared-param", "Parameter '%s' is used in the %s template, but is not declared", name, t)
+				// Substitute something syntactically neutral, so that the
+				// syntax check below doesn't report the same problem again.
+				values[name] = "null"
+			}
+		}
+
+		text, err := snippet.Parse(source).Evaluate(values)
+		if err != nil {
+			report(LintError, "invalid-body", "Could not expand the %s template: %v", t, err)
+			continue
+		}
+
+		switch t {
+		case Jsonnet:
+			if err := lintJsonnet(spec.Name, text); err != nil {
+				report(LintError, "invalid-jsonnet", "The %s template is not valid Jsonnet: %v", t, err)
+			}
+		case JSON:
+			var v interface{}
+			if err := json.Unmarshal([]byte(text), &v); err != nil {
+				report(LintError, "invalid-json", "The %s template is not valid JSON: %v", t, err)
+			}
+		}
+	}
+
+	unused := []string{}
+	for name := range declared {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	for _, name := range unused {
+		report(LintWarning, "unused-param", "Parameter '%s' is declared, but not used in any template", name)
+	}
+
+	return issues
+}
+
+// lintJsonnet checks that `text` is syntactically valid Jsonnet. It does not
+// evaluate the code, since prototypes typically import libraries (e.g.,
+// `k.libsonnet`) that are only available inside an application.
+func lintJsonnet(name, text string) error {
+	tokens, err := parser.Lex(name, text)
+	if err != nil {
+		return err
+	}
+	_, err = parser.Parse(tokens)
+	return err
+}
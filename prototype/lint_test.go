@@ -0,0 +1,95 @@
+package prototype
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLintSystemPrototypes(t *testing.T) {
+	for _, proto := range defaultPrototypes {
+		for _, issue := range Lint(proto) {
+			if issue.Severity == LintError {
+				t.Errorf("Unexpected lint error in system prototype: %s", issue)
+			}
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	spec := `{
+  "apiVersion": "0.1",
+  "name": "io.some-vendor.pkg.broken",
+  "params": [
+    {"name": "name", "description": "Name of the service", "type": "string"},
+    {"name": "port", "description": "", "default": "eighty", "type": "number"},
+    {"name": "replicas", "description": "Replicas", "default": "3", "type": "number", "enum": ["1", "two"]},
+    {"name": "unused", "description": "Never used", "type": "string"}
+  ],
+  "template": {
+    "shortDescription": "A broken prototype",
+    "jsonnetBody": [
+      "{",
+      "  name: ${name},",
+      "  port: ${port},",
+      "  replicas: ${replicas},",
+      "  image: ${image}",
+      "  bad: 1,",
+      "}"
+    ]
+  }
+}`
+
+	proto := &SpecificationSchema{}
+	if err := json.Unmarshal([]byte(spec), proto); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, issue := range Lint(proto) {
+		if issue.Prototype != proto.Name {
+			t.Errorf("Expected issue for prototype '%s', got '%s'", proto.Name, issue.Prototype)
+		}
+		got = append(got, string(issue.Severity)+" "+issue.Rule)
+	}
+
+	expected := []string{
+		"warning missing-description",
+		"warning missing-description",
+		"error invalid-default",
+		"error invalid-enum",
+		"error invalid-default",
+		"error undeclared-param",
+		"error invalid-jsonnet",
+		"warning unused-param",
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected lint issues:\n%v\ngot:\n%v", expected, got)
+	}
+
+	if n := Lint(proto).Errors(); n != 5 {
+		t.Errorf("Expected 5 errors, got %d", n)
+	}
+}
+
+func TestLintValidJsonnet(t *testing.T) {
+	proto := &SpecificationSchema{
+		Name: "io.some-vendor.pkg.valid",
+		Params: ParamSchemas{
+			RequiredParam("name", "name", "Name of the service", String),
+			OptionalParam("replicas", "replicas", "Number of replicas", "1", Number),
+		},
+		Template: SnippetSchema{
+			Description:      "A valid prototype",
+			ShortDescription: "A valid prototype",
+			JsonnetBody: []string{
+				`local k = import "k.libsonnet";`,
+				`{name: ${name}, replicas: ${replicas}}`,
+			},
+		},
+	}
+
+	if issues := Lint(proto); len(issues) != 0 {
+		t.Errorf("Expected no lint issues, got %v", issues)
+	}
+}
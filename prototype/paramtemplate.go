@@ -0,0 +1,59 @@
+package prototype
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// paramTemplateFuncs is the (deliberately small) set of functions available to
+// parameter value templates. The names and argument orders follow the Sprig
+// library used by Helm, so that e.g. `{{ .name | upper | trunc 7 }}` behaves
+// the same in both.
+var paramTemplateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trunc": func(n int, s string) string {
+		if n < 0 || len(s) <= n {
+			return s
+		}
+		return s[:n]
+	},
+	"sha256": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"b64enc": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+}
+
+// EvaluateParamTemplate evaluates the parameter value `value` as a Go template
+// over `data`, with access to a small set of safe string functions (`upper`,
+// `lower`, `trunc`, `sha256`, and `b64enc`). For example, with
+// `data = {"git": {"sha": "abc123..."}}`, the value
+// `svc-{{ sha256 .git.sha | trunc 7 }}` evaluates to `svc-` followed by the
+// first 7 characters of the hash of the commit SHA.
+//
+// Values that contain no template actions are returned unchanged.
+func EvaluateParamTemplate(value string, data map[string]interface{}) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	tmpl, err := template.New("param").Funcs(paramTemplateFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse parameter template '%s':\n%v", value, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Could not evaluate parameter template '%s':\n%v", value, err)
+	}
+
+	return buf.String(), nil
+}
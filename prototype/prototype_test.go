@@ -147,3 +147,104 @@ func TestSearch(t *testing.T) {
 	})
 	assertSearch(t, idx, Substring, "foo", []string{})
 }
+
+func TestQuoteTypedParams(t *testing.T) {
+	tests := []struct {
+		t        ParamType
+		value    string
+		expected string
+		errs     bool
+	}{
+		{Quantity, "10Gi", `"10Gi"`, false},
+		{Quantity, "500m", `"500m"`, false},
+		{Quantity, "ten gigs", "", true},
+		{Duration, "1h30m", `"1h30m"`, false},
+		{Duration, "30", "", true},
+		{SecretRef, "db-creds/password", `{"name": "db-creds", "key": "password"}`, false},
+		{SecretRef, "db-creds", "", true},
+		{ConfigRef, "settings/", "", true},
+		{ConfigRef, "settings/log-level", `{"name": "settings", "key": "log-level"}`, false},
+		{ImageRef, "nginx", `"nginx"`, false},
+		{ImageRef, "myregistryhost:5000/fedora/httpd:version1.0", `"myregistryhost:5000/fedora/httpd:version1.0"`, false},
+		{ImageRef, "gcr.io/project/app@sha256:12345", `"gcr.io/project/app@sha256:12345"`, false},
+		{ImageRef, "not an image", "", true},
+	}
+
+	for _, test := range tests {
+		p := RequiredParam("param", "param", "", test.t)
+		quoted, err := p.Quote(test.value)
+		if test.errs {
+			if err == nil {
+				t.Errorf("Expected quoting '%s' as %s to fail, but got '%s'", test.value, test.t, quoted)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Failed to quote '%s' as %s:\n%v", test.value, test.t, err)
+			continue
+		}
+
+		if quoted != test.expected {
+			t.Errorf("Expected '%s' to be quoted as '%s', got '%s'", test.value, test.expected, quoted)
+		}
+	}
+}
+
+func TestParamEnum(t *testing.T) {
+	p := OptionalParam("tier", "tier", "Tier", "frontend", String)
+	p.Enum = []string{"frontend", "backend"}
+
+	if quoted, err := p.Quote("backend"); err != nil {
+		t.Errorf("Failed to quote allowed value:\n%v", err)
+	} else if quoted != `"backend"` {
+		t.Errorf("Expected 'backend' to be quoted as '\"backend\"', got '%s'", quoted)
+	}
+
+	_, err := p.Quote("cache")
+	if err == nil || err.Error() != "Parameter 'tier' must be one of [frontend, backend], but is 'cache'" {
+		t.Errorf("Expected value outside of enum to be rejected, got %v", err)
+	}
+
+	expected := "  --tier=<tier> Tier [default: frontend, type: string, one of: frontend|backend]"
+	if pretty := (ParamSchemas{p}).PrettyString("  "); pretty != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, pretty)
+	}
+}
+
+func TestEvaluateParamTemplate(t *testing.T) {
+	data := map[string]interface{}{
+		"git": map[string]string{"sha": "8d2c1ec5a4c0c1b0f6f2a3e9d1b7c3e5f9a0b2c4"},
+		"env": map[string]string{"REGION": "us-west"},
+	}
+
+	tests := []struct {
+		value    string
+		expected string
+		errs     bool
+	}{
+		{"nginx", "nginx", false},
+		{"svc-{{ .git.sha | trunc 7 }}", "svc-8d2c1ec", false},
+		{"{{ .env.REGION | upper }}", "US-WEST", false},
+		{"{{ sha256 \"foo\" | trunc 12 }}", "2c26b46b68ff", false},
+		{"{{ b64enc \"foo\" }}", "Zm9v", false},
+		{"{{ .env.MISSING }}", "", true},
+		{"{{ exec \"rm\" }}", "", true},
+		{"{{ .git.sha", "", true},
+	}
+
+	for _, test := range tests {
+		actual, err := EvaluateParamTemplate(test.value, data)
+		if test.errs {
+			if err == nil {
+				t.Errorf("Expected evaluating '%s' to fail, but got '%s'", test.value, actual)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Failed to evaluate '%s':\n%v", test.value, err)
+			continue
+		}
+
+		if actual != test.expected {
+			t.Errorf("Expected '%s' to evaluate to '%s', got '%s'", test.value, test.expected, actual)
+		}
+	}
+}
@@ -55,4 +55,8 @@ func Parse(template string) Template {
 // (with respect to some set of variables) using `Evaluate`.
 type Template interface {
 	Evaluate(values map[string]string) (string, error)
+
+	// Variables returns the names of the variables used in the template,
+	// sorted and without duplicates.
+	Variables() []string
 }
@@ -415,3 +415,14 @@ func TestSnippetOrderPlaceholders(t *testing.T) {
 func TestMaxCallStackExceeded(t *testing.T) {
 	newSnippetParser().parse("${1:${foo:${1}}}", false, false)
 }
+
+func TestSnippetVariables(t *testing.T) {
+	expected := []string{"defaultPort", "name", "port"}
+	if vars := Parse("${name}: ${port:${defaultPort}} ${1:foo} ${name}").Variables(); !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Expected variables %v, got %v", expected, vars)
+	}
+
+	if vars := Parse("no variables here").Variables(); len(vars) != 0 {
+		t.Errorf("Expected no variables, got %v", vars)
+	}
+}
@@ -1,5 +1,7 @@
 package snippet
 
+import "sort"
+
 type textmateSnippet struct {
 	markerImpl
 	_placeholders *[]*placeholder
@@ -102,6 +104,21 @@ func (tms *textmateSnippet) Evaluate(values map[string]string) (string, error) {
 	return tms.text(), nil
 }
 
+func (tms *textmateSnippet) Variables() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	walk(tms.children(), func(candidate marker) bool {
+		if v, ok := candidate.(*variable); ok && !seen[v.name] {
+			seen[v.name] = true
+			names = append(names, v.name)
+		}
+		return true
+	})
+
+	sort.Strings(names)
+	return names
+}
+
 func (tms *textmateSnippet) ReplacePlaceholder(idx index, replaceWith *markers) {
 	newChildren := make(markers, len(*replaceWith))
 	copy(newChildren, *replaceWith)
@@ -2,9 +2,13 @@ package prototype
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 //
@@ -205,8 +209,33 @@ const (
 
 	// Array represents a prototype parameter that must be a array.
 	Array ParamType = "array"
+
+	// Quantity represents a prototype parameter that must be a Kubernetes
+	// resource quantity (e.g., `10Gi` or `500m`).
+	Quantity ParamType = "quantity"
+
+	// Duration represents a prototype parameter that must be a duration (e.g.,
+	// `30s` or `1h30m`).
+	Duration ParamType = "duration"
+
+	// SecretRef represents a prototype parameter that refers to a key in a
+	// Secret, written as `<secret-name>/<key>`.
+	SecretRef ParamType = "secretRef"
+
+	// ConfigRef represents a prototype parameter that refers to a key in a
+	// ConfigMap, written as `<configmap-name>/<key>`.
+	ConfigRef ParamType = "configRef"
+
+	// ImageRef represents a prototype parameter that must be a container image
+	// reference (e.g., `nginx:1.13` or `gcr.io/project/app@sha256:...`).
+	ImageRef ParamType = "imageRef"
 )
 
+// imageRefPattern is a loose approximation of the Docker image reference
+// grammar: an optional registry host, a slash-separated repository path, and
+// an optional tag and/or digest.
+var imageRefPattern = regexp.MustCompile(`^([a-zA-Z0-9.-]+(:[0-9]+)?/)?[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*(:[\w][\w.-]{0,127})?(@[a-z0-9]+:[a-fA-F0-9]+)?$`)
+
 func (pt ParamType) String() string {
 	switch pt {
 	case Number:
@@ -219,6 +248,16 @@ func (pt ParamType) String() string {
 		return "object"
 	case Array:
 		return "array"
+	case Quantity:
+		return "quantity"
+	case Duration:
+		return "duration"
+	case SecretRef:
+		return "secret-ref"
+	case ConfigRef:
+		return "config-ref"
+	case ImageRef:
+		return "image-ref"
 	default:
 		return "unknown"
 	}
@@ -232,12 +271,31 @@ type ParamSchema struct {
 	Description string    `json:"description"`
 	Default     *string   `json:"default"` // `nil` only if the parameter is optional.
 	Type        ParamType `json:"type"`
+	Enum        []string  `json:"enum,omitempty"` // Optional; the values the parameter may take.
+}
+
+// checkEnum returns an error if the parameter has a set of allowed values,
+// and `value` is not one of them.
+func (ps *ParamSchema) checkEnum(value string) error {
+	if len(ps.Enum) == 0 {
+		return nil
+	}
+	for _, allowed := range ps.Enum {
+		if value == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("Parameter '%s' must be one of [%s], but is '%s'", ps.Name, strings.Join(ps.Enum, ", "), value)
 }
 
 // Quote will parse a prototype parameter and quote it appropriately, so that it
 // shows up correctly in Jsonnet source code. For example, `--image nginx` would
 // likely need to show up as `"nginx"` in Jsonnet source.
 func (ps *ParamSchema) Quote(value string) (string, error) {
+	if err := ps.checkEnum(value); err != nil {
+		return "", err
+	}
+
 	switch ps.Type {
 	case Number:
 		_, err := strconv.ParseFloat(value, 64)
@@ -255,6 +313,29 @@ func (ps *ParamSchema) Quote(value string) (string, error) {
 		return fmt.Sprintf("\"%s\"", value), nil
 	case Array, Object:
 		return value, nil
+	case Quantity:
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return "", fmt.Errorf("Could not convert parameter '%s' to a resource quantity (e.g., '10Gi' or '500m')", ps.Name)
+		}
+		return fmt.Sprintf("\"%s\"", value), nil
+	case Duration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return "", fmt.Errorf("Could not convert parameter '%s' to a duration (e.g., '30s' or '1h30m')", ps.Name)
+		}
+		return fmt.Sprintf("\"%s\"", value), nil
+	case SecretRef, ConfigRef:
+		// Emit an object that is valid Jsonnet, JSON, and YAML alike, so that the
+		// reference can be spliced into any of the template bodies.
+		split := strings.SplitN(value, "/", 2)
+		if len(split) != 2 || split[0] == "" || split[1] == "" {
+			return "", fmt.Errorf("Could not convert parameter '%s' to a %s; must have the form '<name>/<key>'", ps.Name, ps.Type)
+		}
+		return fmt.Sprintf("{\"name\": \"%s\", \"key\": \"%s\"}", split[0], split[1]), nil
+	case ImageRef:
+		if !imageRefPattern.MatchString(value) {
+			return "", fmt.Errorf("Could not convert parameter '%s' to a container image reference (e.g., 'nginx:1.13')", ps.Name)
+		}
+		return fmt.Sprintf("\"%s\"", value), nil
 	default:
 		return "", fmt.Errorf("Unknown param type for param '%s'", ps.Name)
 	}
@@ -317,10 +398,14 @@ func (ps ParamSchemas) PrettyString(prefix string) string {
 
 		var info string
 		if p.Default != nil {
-			info = fmt.Sprintf(" [default: %s, type: %s]", *p.Default, p.Type.String())
+			info = fmt.Sprintf("default: %s, type: %s", *p.Default, p.Type.String())
 		} else {
-			info = fmt.Sprintf(" [type: %s]", p.Type.String())
+			info = fmt.Sprintf("type: %s", p.Type.String())
+		}
+		if len(p.Enum) != 0 {
+			info += fmt.Sprintf(", one of: %s", strings.Join(p.Enum, "|"))
 		}
+		info = " [" + info + "]"
 
 		// NOTE: If we don't add 1 here, the longest line will look like:
 		// `--flag=<flag>Description is here.`
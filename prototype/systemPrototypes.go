@@ -113,7 +113,7 @@ will typically look something like:
 		Name:       "io.ksonnet.pkg.deployment-exposed-with-service",
 		Params: ParamSchemas{
 			RequiredParam("name", "name", "Name of the service and deployment", String),
-			RequiredParam("image", "containerImage", "Container image to deploy", String),
+			RequiredParam("image", "containerImage", "Container image to deploy", ImageRef),
 			OptionalParam("servicePort", "port", "Port for the service to expose.", "80", NumberOrString),
 			OptionalParam("containerPort", "port", "Container port for service to target.", "80", NumberOrString),
 			OptionalParam("replicas", "replicas", "Number of replicas", "1", Number),
@@ -272,8 +272,8 @@ to 'targetLabelSelector', at 'targetPort'.`,
 				`local configMap = k.core.v1.configMap;`,
 				``,
 				`configMap.new() +`,
-				`configMap.mixin.metadata.name("${name}") +`,
-				`configMap.data("${data}")`,
+				`configMap.mixin.metadata.name(${name}) +`,
+				`configMap.data(${data})`,
 			},
 		},
 	},
@@ -282,7 +282,7 @@ to 'targetLabelSelector', at 'targetPort'.`,
 		Name:       "io.ksonnet.pkg.single-port-deployment",
 		Params: ParamSchemas{
 			RequiredParam("name", "deploymentName", "Name of the deployment", String),
-			RequiredParam("image", "containerImage", "Container image to deploy", String),
+			RequiredParam("image", "containerImage", "Container image to deploy", ImageRef),
 			OptionalParam("replicas", "replicas", "Number of replicas", "1", Number),
 			OptionalParam("port", "containerPort", "Port to expose", "80", NumberOrString),
 		},
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
@@ -24,31 +25,156 @@ type Expander struct {
 
 	Resolver   string
 	FailAction string
+
+	Limits Limits
+
+	// LibraryPins maps the names of libraries (i.e., the first element of
+	// an import path, such as `mylib` in `mylib/deploy.libsonnet`) to the
+	// directories their imports are resolved in, ahead of the search paths.
+	// This lets an environment use a different version of a vendored library
+	// than the rest of the application.
+	LibraryPins map[string]string
+}
+
+// Limits bound the resources a single Jsonnet evaluation may use, so that a
+// runaway component (e.g., one that recurses forever) fails fast with a useful
+// error, rather than exhausting the machine it runs on. Zero values leave
+// Jsonnet's defaults in place.
+type Limits struct {
+	// MaxStack is the maximum number of stack frames, i.e., roughly, the
+	// maximum depth of recursion. Jsonnet's default is 500.
+	MaxStack uint
+	// Timeout is the longest an evaluation may run before it is abandoned.
+	Timeout time.Duration
+}
+
+// Override returns a copy of `l`, with each limit that is set in `other`
+// replaced by the value in `other`.
+func (l Limits) Override(other Limits) Limits {
+	if other.MaxStack != 0 {
+		l.MaxStack = other.MaxStack
+	}
+	if other.Timeout != 0 {
+		l.Timeout = other.Timeout
+	}
+	return l
 }
 
 func (spec *Expander) Expand(paths []string) ([]*unstructured.Unstructured, error) {
-	vm, err := spec.jsonnetVM()
+	res := []*unstructured.Unstructured{}
+	err := spec.evaluate(func(vm *jsonnet.VM) error {
+		for _, path := range paths {
+			objs, err := utils.Read(vm, path)
+			if err != nil {
+				return fmt.Errorf("Error reading %s: %v", path, err)
+			}
+			res = append(res, utils.FlattenToV1(objs)...)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer vm.Destroy()
+	return res, nil
+}
 
-	res := []*unstructured.Unstructured{}
-	for _, path := range paths {
-		objs, err := utils.Read(vm, path)
+// ExpandComponents expands the Jsonnet file at `path`, which evaluates to an
+// object of component names -> the objects of each component, labeling each
+// object with the component it belongs to.
+func (spec *Expander) ExpandComponents(path string) ([]*unstructured.Unstructured, error) {
+	var res []*unstructured.Unstructured
+	err := spec.evaluate(func(vm *jsonnet.VM) error {
+		objs, err := utils.ReadComponents(vm, path)
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %v", path, err)
+		}
+		res = utils.FlattenToV1(objs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExpandSnippet expands the Jsonnet code `snippet`, evaluated as though it
+// were the contents of the file at `filename`.
+func (spec *Expander) ExpandSnippet(filename, snippet string) ([]*unstructured.Unstructured, error) {
+	var res []*unstructured.Unstructured
+	err := spec.evaluate(func(vm *jsonnet.VM) error {
+		objs, err := utils.ReadSnippet(vm, filename, snippet)
 		if err != nil {
-			return nil, fmt.Errorf("Error reading %s: %v", path, err)
+			return fmt.Errorf("Error reading %s: %v", filename, err)
 		}
-		res = append(res, utils.FlattenToV1(objs)...)
+		res = utils.FlattenToV1(objs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return res, nil
 }
 
+// evaluate calls `f` with a new jsonnet.VM, giving up if it does not return
+// within `spec.Limits.Timeout`.
+//
+// NOTE: A Jsonnet evaluation cannot be interrupted, so one that times out
+// keeps running (and its VM is not destroyed) until it finishes, or the
+// process exits. This is fine for the command line, which exits with the
+// error, but long-lived callers should not rely on timeouts to reclaim
+// resources.
+func (spec *Expander) evaluate(f func(vm *jsonnet.VM) error) error {
+	pinsPath, err := linkLibraryPins(spec.LibraryPins)
+	if err != nil {
+		return err
+	}
+
+	vm, err := spec.jsonnetVM()
+	if err != nil {
+		os.RemoveAll(pinsPath)
+		return err
+	}
+	if pinsPath != "" {
+		log.Debugln("Adding jsonnet search path for pinned libraries", pinsPath)
+		vm.JpathAdd(pinsPath)
+	}
+
+	cleanup := func() {
+		vm.Destroy()
+		if pinsPath != "" {
+			os.RemoveAll(pinsPath)
+		}
+	}
+
+	timeout := spec.Limits.Timeout
+	if timeout <= 0 {
+		defer cleanup()
+		return f(vm)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer cleanup()
+		done <- f(vm)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("Jsonnet evaluation did not finish within %s; check for unbounded recursion, or raise the limit with '--eval-timeout' or 'jsonnet.timeout' in app.yaml", timeout)
+	}
+}
+
 // JsonnetVM constructs a new jsonnet.VM, according to command line
 // flags
 func (spec *Expander) jsonnetVM() (*jsonnet.VM, error) {
 	vm := jsonnet.Make()
 
+	if spec.Limits.MaxStack > 0 {
+		vm.MaxStack(spec.Limits.MaxStack)
+	}
+
 	for _, p := range spec.EnvJPath {
 		log.Debugln("Adding jsonnet search path", p)
 		vm.JpathAdd(p)
@@ -0,0 +1,122 @@
+package template
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeJsonnet(t *testing.T, text string) string {
+	dir, err := ioutil.TempDir("", "expander")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.jsonnet")
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExpandLimits(t *testing.T) {
+	// Recursing 100 deep is fine by default, but not with a stack of 50.
+	path := writeJsonnet(t, `local f(n) = if n == 0 then {apiVersion: "v1", kind: "ConfigMap", metadata: {name: "test"}} else f(n - 1); f(100)`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	spec := Expander{Resolver: "noop", FailAction: "warn"}
+	if _, err := spec.Expand([]string{path}); err != nil {
+		t.Fatalf("Unexpected error with default limits: %v", err)
+	}
+
+	spec.Limits.MaxStack = 50
+	_, err := spec.Expand([]string{path})
+	if err == nil || !strings.Contains(err.Error(), "Max stack frames exceeded") {
+		t.Errorf("Expected the stack limit to be exceeded, got %v", err)
+	}
+
+	// An exponential computation that would take far longer than the
+	// timeout, but that uses little memory while it runs.
+	path = writeJsonnet(t, `local f(n) = if n == 0 then 0 else f(n - 1) + f(n - 1); {apiVersion: "v1", kind: "ConfigMap", metadata: {name: "test"}, data: {n: std.toString(f(40))}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	spec.Limits = Limits{Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err = spec.Expand([]string{path})
+	if err == nil || !strings.Contains(err.Error(), "did not finish within 100ms") {
+		t.Errorf("Expected the evaluation to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the evaluation to be abandoned promptly, but it took %s", elapsed)
+	}
+}
+
+func TestLimitsOverride(t *testing.T) {
+	app := Limits{MaxStack: 200, Timeout: time.Minute}
+
+	if got := app.Override(Limits{}); got != app {
+		t.Errorf("Expected unset limits to be left alone, got %#v", got)
+	}
+
+	got := app.Override(Limits{Timeout: time.Second})
+	if expected := (Limits{MaxStack: 200, Timeout: time.Second}); got != expected {
+		t.Errorf("Expected %#v, got %#v", expected, got)
+	}
+}
+
+func TestExpandLibraryPins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expander")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"vendor/mylib/version.libsonnet":    `"1.3"`,
+		"pins/mylib-1.2/version.libsonnet":  `(import "release.libsonnet").version`,
+		"pins/mylib-1.2/release.libsonnet":  `{version: "1.2"}`,
+		"vendor/otherlib/version.libsonnet": `"2.0"`,
+		"components/test.jsonnet":           `{apiVersion: "v1", kind: "ConfigMap", metadata: {name: "test"}, data: {mylib: import "mylib/version.libsonnet", otherlib: import "otherlib/version.libsonnet"}}`,
+		"components/missing.jsonnet":        `import "mylib/missing.libsonnet"`,
+	}
+	for name, text := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions := func(spec *Expander) map[string]interface{} {
+		objs, err := spec.Expand([]string{filepath.Join(dir, "components/test.jsonnet")})
+		if err != nil {
+			t.Fatalf("Unexpected error:\n%v", err)
+		}
+		return objs[0].Object["data"].(map[string]interface{})
+	}
+
+	spec := Expander{FlagJpath: []string{filepath.Join(dir, "vendor")}, Resolver: "noop", FailAction: "warn"}
+	if data := versions(&spec); data["mylib"] != "1.3" || data["otherlib"] != "2.0" {
+		t.Errorf("Expected the libraries in the search paths to be used, got %v", data)
+	}
+
+	spec.LibraryPins = map[string]string{"mylib": filepath.Join(dir, "pins/mylib-1.2")}
+	if data := versions(&spec); data["mylib"] != "1.2" || data["otherlib"] != "2.0" {
+		t.Errorf("Expected only the pinned library to be read from its pinned directory, got %v", data)
+	}
+
+	// A file missing from the pinned copy is not read from the search paths.
+	_, err = spec.Expand([]string{filepath.Join(dir, "components/missing.jsonnet")})
+	if err == nil || !strings.Contains(err.Error(), "mylib/missing.libsonnet") {
+		t.Errorf("Expected a missing file in a pinned library to be reported, got %v", err)
+	}
+
+	spec.LibraryPins = map[string]string{"mylib": filepath.Join(dir, "pins/mylib-9.9")}
+	if _, err := spec.Expand([]string{filepath.Join(dir, "components/test.jsonnet")}); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("Expected a pin to a missing directory to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package template
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// linkLibraryPins creates a temporary directory holding a symlink, named
+// after each pinned library, to the library's pinned directory. Added as the
+// last (i.e., highest-precedence) Jsonnet search path, it makes an import of
+// e.g. `mylib/deploy.libsonnet` read the pinned copy of `mylib`, while imports
+// within the library, which are relative to the importing file, stay within
+// the pinned copy.
+//
+// It returns the empty string if there are no pins. Otherwise, the caller
+// must remove the directory when done.
+func linkLibraryPins(pins map[string]string) (string, error) {
+	if len(pins) == 0 {
+		return "", nil
+	}
+
+	dir, err := ioutil.TempDir("", "ksonnet-pins")
+	if err != nil {
+		return "", err
+	}
+
+	for lib, target := range pins {
+		if lib == "" || strings.ContainsAny(lib, `/\`) || lib == "." || lib == ".." {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("Invalid pinned library name '%s'; must be a single path element, such as 'mylib'", lib)
+		}
+		if info, err := os.Stat(target); err != nil || !info.IsDir() {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("Library '%s' is pinned to '%s', which is not a directory", lib, target)
+		}
+		if err := os.Symlink(target, filepath.Join(dir, lib)); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 
 	log "github.com/sirupsen/logrus"
 	jsonnet "github.com/strickyak/jsonnet_cgo"
@@ -126,11 +127,28 @@ func jsonWalk(obj interface{}) ([]interface{}, error) {
 }
 
 func jsonnetReader(vm *jsonnet.VM, path string) ([]runtime.Object, error) {
-	jsonstr, err := vm.EvaluateFile(path)
+	top, err := evaluateJsonnet(vm, path)
 	if err != nil {
 		return nil, err
 	}
 
+	objs, err := jsonWalk(top)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeObjects(objs)
+}
+
+// ReadSnippet fetches and decodes K8s objects from the Jsonnet code
+// `snippet`, evaluated as though it were the contents of the file at
+// `filename` (which relative imports are resolved against).
+func ReadSnippet(vm *jsonnet.VM, filename, snippet string) ([]runtime.Object, error) {
+	jsonstr, err := vm.EvaluateSnippet(filename, snippet)
+	if err != nil {
+		return nil, NewJsonnetError(err)
+	}
+
 	log.Debugf("jsonnet result is: %s", jsonstr)
 
 	var top interface{}
@@ -143,6 +161,102 @@ func jsonnetReader(vm *jsonnet.VM, path string) ([]runtime.Object, error) {
 		return nil, err
 	}
 
+	return decodeObjects(objs)
+}
+
+// ReadComponents fetches and decodes K8s objects from the Jsonnet file at
+// `path`, which evaluates to an object of component names -> the objects of
+// that component (as an environment's `main.jsonnet` does). Each object is
+// labeled with the name of the component it belongs to, using
+// `ComponentLabel`. Files that evaluate to anything else are read as with
+// `Read`.
+func ReadComponents(vm *jsonnet.VM, path string) ([]runtime.Object, error) {
+	top, err := evaluateJsonnet(vm, path)
+	if err != nil {
+		return nil, err
+	}
+
+	components, ok := top.(map[string]interface{})
+	if !ok || (components["kind"] != nil && components["apiVersion"] != nil) {
+		// Not an object of components, so there is nothing to label with.
+		log.Debugf("'%s' did not evaluate to an object of components; not labeling objects with their components", path)
+		objs, err := jsonWalk(top)
+		if err != nil {
+			return nil, err
+		}
+		return decodeObjects(objs)
+	}
+
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	objs := []interface{}{}
+	for _, name := range names {
+		children, err := jsonWalk(components[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if err := setComponentLabel(child, name); err != nil {
+				return nil, err
+			}
+		}
+		objs = append(objs, children...)
+	}
+
+	return decodeObjects(objs)
+}
+
+// setComponentLabel sets the `ComponentLabel` label of the decoded JSON
+// object `obj` (and, if it is a List, of each of its items) to `component`.
+func setComponentLabel(obj interface{}, component string) error {
+	o, ok := obj.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Unexpected object structure: %T", obj)
+	}
+
+	if items, ok := o["items"].([]interface{}); ok {
+		for _, item := range items {
+			if err := setComponentLabel(item, component); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	metadata, ok := o["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		o["metadata"] = metadata
+	}
+	labels, ok := metadata["labels"].(map[string]interface{})
+	if !ok {
+		labels = map[string]interface{}{}
+		metadata["labels"] = labels
+	}
+	labels[ComponentLabel] = component
+	return nil
+}
+
+func evaluateJsonnet(vm *jsonnet.VM, path string) (interface{}, error) {
+	jsonstr, err := vm.EvaluateFile(path)
+	if err != nil {
+		return nil, NewJsonnetError(err)
+	}
+
+	log.Debugf("jsonnet result is: %s", jsonstr)
+
+	var top interface{}
+	if err = json.Unmarshal([]byte(jsonstr), &top); err != nil {
+		return nil, err
+	}
+	return top, nil
+}
+
+func decodeObjects(objs []interface{}) ([]runtime.Object, error) {
 	ret := make([]runtime.Object, 0, len(objs))
 	for _, v := range objs {
 		// TODO: Going to json and back is a bit horrible
@@ -0,0 +1,330 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// CRDSchemas holds the OpenAPI v3 schemas of custom resources, as declared by
+// CustomResourceDefinitions bundled with vendored packages. It lets custom
+// resources be validated without a cluster, or before their CRDs have been
+// installed in it.
+type CRDSchemas struct {
+	schemas map[schema.GroupVersionKind]*spec.Schema
+}
+
+// NewCRDSchemas returns an empty set of CRD schemas.
+func NewCRDSchemas() *CRDSchemas {
+	return &CRDSchemas{schemas: map[schema.GroupVersionKind]*spec.Schema{}}
+}
+
+// LoadCRDSchemas reads the CustomResourceDefinitions in the YAML or JSON
+// files at `paths`. Files may contain several documents; documents that are
+// not CRDs, and CRDs that declare no validation schema, are ignored.
+func LoadCRDSchemas(paths []string) (*CRDSchemas, error) {
+	crds := NewCRDSchemas()
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		err = crds.Add(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read CustomResourceDefinitions from '%s':\n%v", p, err)
+		}
+	}
+	return crds, nil
+}
+
+// Add reads the CustomResourceDefinitions in the (possibly multi-document)
+// YAML or JSON stream `r`.
+func (c *CRDSchemas) Add(r io.Reader) error {
+	decoder := yaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		data, err := decoder.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		jsondata, err := yaml.ToJSON(data)
+		if err != nil {
+			return err
+		}
+		crd := crdDocument{}
+		if err := json.Unmarshal(jsondata, &crd); err != nil {
+			return err
+		}
+		if crd.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		c.addDocument(&crd)
+	}
+}
+
+// Len returns the number of kinds with a known schema.
+func (c *CRDSchemas) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.schemas)
+}
+
+// Has returns true if the schema of kind `gvk` is known.
+func (c *CRDSchemas) Has(gvk schema.GroupVersionKind) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.schemas[gvk]
+	return ok
+}
+
+// Validate checks `obj` against the schema of its kind. The schema must be
+// known; see `Has`.
+func (c *CRDSchemas) Validate(obj *unstructured.Unstructured) []error {
+	s, ok := c.schemas[obj.GroupVersionKind()]
+	if !ok {
+		return []error{TypeNotFoundError(obj.GroupVersionKind().String())}
+	}
+
+	// CRD schemas usually describe only the resource's own fields, and leave
+	// the standard ones to the API server.
+	content := map[string]interface{}{}
+	for k, v := range obj.UnstructuredContent() {
+		if _, described := s.Properties[k]; !described && (k == "apiVersion" || k == "kind" || k == "metadata") {
+			continue
+		}
+		content[k] = v
+	}
+
+	return validateOpenAPIValue(s, content, "")
+}
+
+// crdDocument is the subset of the apiextensions.k8s.io v1beta1 and v1
+// CustomResourceDefinition types that describes the resources' schemas.
+type crdDocument struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Group string `json:"group"`
+		Names struct {
+			Kind string `json:"kind"`
+		} `json:"names"`
+		Version    string                 `json:"version"`
+		Validation *crdValidationDocument `json:"validation"`
+		Versions   []struct {
+			Name   string                 `json:"name"`
+			Schema *crdValidationDocument `json:"schema"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+type crdValidationDocument struct {
+	OpenAPIV3Schema *spec.Schema `json:"openAPIV3Schema"`
+}
+
+func (c *CRDSchemas) addDocument(crd *crdDocument) {
+	add := func(version string, v *crdValidationDocument) {
+		if version == "" || v == nil || v.OpenAPIV3Schema == nil {
+			return
+		}
+		gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: version, Kind: crd.Spec.Names.Kind}
+		log.Debugf("Found schema for custom resource %s", gvk)
+		c.schemas[gvk] = v.OpenAPIV3Schema
+	}
+
+	// In v1beta1, a top-level schema applies to every version that doesn't
+	// declare its own.
+	add(crd.Spec.Version, crd.Spec.Validation)
+	for _, v := range crd.Spec.Versions {
+		add(v.Name, crd.Spec.Validation)
+		add(v.Name, v.Schema)
+	}
+}
+
+// validateOpenAPIValue checks `value` against the OpenAPI v3 schema `s`, and
+// returns a description of every violation found. `fieldName` is the path of
+// `value` in the enclosing object, used in error messages.
+func validateOpenAPIValue(s *spec.Schema, value interface{}, fieldName string) []error {
+	errs := []error{}
+	field := fieldName
+	if field == "" {
+		field = "<root>"
+	}
+	if value == nil {
+		return errs
+	}
+
+	if len(s.Type) > 0 && !openAPITypeMatches(s.Type, value) {
+		return append(errs, fmt.Errorf("field %s: expected %s, got %s", field, strings.Join(s.Type, " or "), openAPITypeOf(value)))
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			allowed := []string{}
+			for _, e := range s.Enum {
+				allowed = append(allowed, fmt.Sprint(e))
+			}
+			errs = append(errs, fmt.Errorf("field %s: value '%v' is not one of: %s", field, value, strings.Join(allowed, ", ")))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		prefix := ""
+		if fieldName != "" {
+			prefix = fieldName + "."
+		}
+		for _, required := range s.Required {
+			if _, ok := v[required]; !ok {
+				errs = append(errs, fmt.Errorf("field %s%s is required", prefix, required))
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := s.Properties[k]; ok {
+				errs = append(errs, validateOpenAPIValue(&prop, v[k], prefix+k)...)
+				continue
+			}
+			if ap := s.AdditionalProperties; ap != nil {
+				if ap.Schema != nil {
+					errs = append(errs, validateOpenAPIValue(ap.Schema, v[k], prefix+k)...)
+				} else if !ap.Allows {
+					errs = append(errs, fmt.Errorf("field %s%s is not allowed", prefix, k))
+				}
+			}
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && int64(len(v)) < *s.MinItems {
+			errs = append(errs, fmt.Errorf("field %s: expected at least %d items, got %d", field, *s.MinItems, len(v)))
+		}
+		if s.MaxItems != nil && int64(len(v)) > *s.MaxItems {
+			errs = append(errs, fmt.Errorf("field %s: expected at most %d items, got %d", field, *s.MaxItems, len(v)))
+		}
+		if s.Items != nil && s.Items.Schema != nil {
+			for i, item := range v {
+				errs = append(errs, validateOpenAPIValue(s.Items.Schema, item, fmt.Sprintf("%s[%d]", fieldName, i))...)
+			}
+		}
+
+	case string:
+		if s.MinLength != nil && int64(len(v)) < *s.MinLength {
+			errs = append(errs, fmt.Errorf("field %s: expected at least %d characters, got %d", field, *s.MinLength, len(v)))
+		}
+		if s.MaxLength != nil && int64(len(v)) > *s.MaxLength {
+			errs = append(errs, fmt.Errorf("field %s: expected at most %d characters, got %d", field, *s.MaxLength, len(v)))
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				log.Debugf("Ignoring invalid pattern '%s' for field %s: %v", s.Pattern, field, err)
+			} else if !re.MatchString(v) {
+				errs = append(errs, fmt.Errorf("field %s: value '%s' does not match pattern '%s'", field, v, s.Pattern))
+			}
+		}
+
+	default:
+		if n, ok := openAPINumber(value); ok {
+			if s.Minimum != nil && (n < *s.Minimum || (s.ExclusiveMinimum && n == *s.Minimum)) {
+				errs = append(errs, fmt.Errorf("field %s: value %v is less than the minimum %v", field, value, *s.Minimum))
+			}
+			if s.Maximum != nil && (n > *s.Maximum || (s.ExclusiveMaximum && n == *s.Maximum)) {
+				errs = append(errs, fmt.Errorf("field %s: value %v is greater than the maximum %v", field, value, *s.Maximum))
+			}
+		}
+	}
+
+	return errs
+}
+
+func openAPINumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func openAPITypeMatches(types spec.StringOrArray, value interface{}) bool {
+	actual := openAPITypeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// openAPITypeOf returns the OpenAPI type name of a decoded JSON value.
+func openAPITypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	default:
+		if n, ok := openAPINumber(v); ok {
+			if n == float64(int64(n)) {
+				return "integer"
+			}
+			return "number"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const testCRDs = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: not-a-crd
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.stable.example.com
+spec:
+  group: stable.example.com
+  version: v1
+  names:
+    kind: CronTab
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required: [cronSpec]
+          properties:
+            cronSpec:
+              type: string
+              pattern: '^(\S+ ){4}\S+$'
+            replicas:
+              type: integer
+              minimum: 1
+              maximum: 10
+            policy:
+              type: string
+              enum: [Allow, Forbid]
+            tags:
+              type: array
+              items:
+                type: string
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+  - name: v1alpha1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            additionalProperties: false
+            properties:
+              size:
+                type: string
+                maxLength: 5
+`
+
+func TestCRDSchemas(t *testing.T) {
+	crds := NewCRDSchemas()
+	if err := crds.Add(strings.NewReader(testCRDs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if crds.Len() != 2 {
+		t.Fatalf("Expected 2 schemas, got %d", crds.Len())
+	}
+	if !crds.Has(schema.GroupVersionKind{Group: "stable.example.com", Version: "v1", Kind: "CronTab"}) {
+		t.Errorf("Expected schema for v1beta1 CRD")
+	}
+	if !crds.Has(schema.GroupVersionKind{Group: "example.com", Version: "v1alpha1", Kind: "Widget"}) {
+		t.Errorf("Expected schema for v1 CRD")
+	}
+	if crds.Has(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}) {
+		t.Errorf("Expected documents that aren't CRDs to be ignored")
+	}
+
+	var nilCRDs *CRDSchemas
+	if nilCRDs.Has(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}) {
+		t.Errorf("Expected nil schemas to know no kinds")
+	}
+
+	tests := []struct {
+		obj    map[string]interface{}
+		errors []string
+	}{
+		{
+			obj: map[string]interface{}{
+				"apiVersion": "stable.example.com/v1",
+				"kind":       "CronTab",
+				"metadata":   map[string]interface{}{"name": "ok"},
+				"spec": map[string]interface{}{
+					"cronSpec": "* * * * */5",
+					"replicas": int64(3),
+					"policy":   "Allow",
+					"tags":     []interface{}{"a", "b"},
+				},
+			},
+			errors: []string{},
+		},
+		{
+			obj: map[string]interface{}{
+				"apiVersion": "stable.example.com/v1",
+				"kind":       "CronTab",
+				"metadata":   map[string]interface{}{"name": "bad"},
+				"spec": map[string]interface{}{
+					"replicas": int64(11),
+					"policy":   "Sometimes",
+					"tags":     []interface{}{"a", int64(1)},
+				},
+			},
+			errors: []string{
+				"field spec.cronSpec is required",
+				"field spec.policy: value 'Sometimes' is not one of: Allow, Forbid",
+				"field spec.replicas: value 11 is greater than the maximum 10",
+				"field spec.tags[1]: expected string, got integer",
+			},
+		},
+		{
+			obj: map[string]interface{}{
+				"apiVersion": "stable.example.com/v1",
+				"kind":       "CronTab",
+				"metadata":   map[string]interface{}{"name": "pattern"},
+				"spec": map[string]interface{}{
+					"cronSpec": "daily",
+					"replicas": 1.5,
+				},
+			},
+			errors: []string{
+				`field spec.cronSpec: value 'daily' does not match pattern '^(\S+ ){4}\S+$'`,
+				"field spec.replicas: expected integer, got number",
+			},
+		},
+		{
+			obj: map[string]interface{}{
+				"apiVersion": "example.com/v1alpha1",
+				"kind":       "Widget",
+				"metadata":   map[string]interface{}{"name": "widget"},
+				"spec": map[string]interface{}{
+					"size":  "enormous",
+					"color": "red",
+				},
+			},
+			errors: []string{
+				"field spec.color is not allowed",
+				"field spec.size: expected at most 5 characters, got 8",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		obj := &unstructured.Unstructured{Object: test.obj}
+		errs := crds.Validate(obj)
+
+		actual := []string{}
+		for _, err := range errs {
+			actual = append(actual, err.Error())
+		}
+		if strings.Join(actual, "\n") != strings.Join(test.errors, "\n") {
+			t.Errorf("Validating '%s': expected errors:\n%s\ngot:\n%s", obj.GetName(), strings.Join(test.errors, "\n"), strings.Join(actual, "\n"))
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// excerptContext is the number of lines shown either side of the line an
+// error refers to.
+const excerptContext = 2
+
+// JsonnetError is a Jsonnet evaluation error, annotated with an excerpt of
+// the file it refers to and, for common mistakes, a hint on how to fix it.
+type JsonnetError struct {
+	// Kind is either "STATIC ERROR" (e.g., a syntax error) or "RUNTIME ERROR".
+	Kind    string
+	Message string
+
+	// File, Line, and Column locate the error. For runtime errors, this is the
+	// innermost frame of the stack trace that refers to a readable file.
+	File   string
+	Line   int
+	Column int
+	// EndColumn is the (inclusive) column the error ends on, if it is on a
+	// single line; otherwise it is 0.
+	EndColumn int
+
+	// Trace is the stack trace of a runtime error, as reported by Jsonnet.
+	Trace []string
+
+	Excerpt string
+	Hint    string
+}
+
+func (e *JsonnetError) Error() string {
+	var buf bytes.Buffer
+	if e.File != "" {
+		fmt.Fprintf(&buf, "%s in %s:%d:%d: %s\n", e.Kind, e.File, e.Line, e.Column, e.Message)
+	} else {
+		fmt.Fprintf(&buf, "%s: %s\n", e.Kind, e.Message)
+	}
+	if e.Excerpt != "" {
+		fmt.Fprintf(&buf, "\n%s", e.Excerpt)
+	}
+	if e.Hint != "" {
+		fmt.Fprintf(&buf, "\nHint: %s\n", e.Hint)
+	}
+	if len(e.Trace) > 1 {
+		fmt.Fprintf(&buf, "\nStack trace:\n")
+		for _, frame := range e.Trace {
+			fmt.Fprintf(&buf, "\t%s\n", frame)
+		}
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+var (
+	jsonnetErrorHeader = regexp.MustCompile(`^(STATIC ERROR|RUNTIME ERROR): (.*)$`)
+	// jsonnetLocation matches the locations Jsonnet reports, which take the
+	// forms 'file:line:col', 'file:line:col-endcol', and
+	// 'file:(line:col)-(endline:endcol)'.
+	jsonnetLocation = regexp.MustCompile(`^(.+?):(?:(\d+):(\d+)(?:-(\d+))?|\((\d+):(\d+)\)-\(\d+:\d+\))(?::\s|\s|$)`)
+)
+
+// NewJsonnetError parses an error returned by the Jsonnet VM into a
+// *JsonnetError. Errors that are not in the format Jsonnet uses (e.g., a
+// failure to open the file being evaluated) are returned unchanged.
+func NewJsonnetError(err error) error {
+	lines := strings.Split(strings.TrimRight(err.Error(), "\n"), "\n")
+	header := jsonnetErrorHeader.FindStringSubmatch(lines[0])
+	if header == nil {
+		return err
+	}
+
+	e := &JsonnetError{Kind: header[1], Message: header[2]}
+	if e.Kind == "STATIC ERROR" {
+		// Static errors put the location before the message.
+		if loc := jsonnetLocation.FindStringSubmatch(e.Message); loc != nil {
+			e.setLocation(loc)
+			e.Message = strings.TrimPrefix(e.Message, loc[0])
+		}
+	} else {
+		for _, frame := range lines[1:] {
+			frame = strings.TrimSpace(frame)
+			e.Trace = append(e.Trace, frame)
+			if e.Excerpt != "" {
+				continue
+			}
+			if loc := jsonnetLocation.FindStringSubmatch(frame); loc != nil {
+				e.setLocation(loc)
+			}
+		}
+	}
+
+	e.Hint = jsonnetHint(e.Message)
+	return e
+}
+
+// setLocation records the location matched by `jsonnetLocation`, along with
+// an excerpt of the file around it. A location in a file that cannot be read
+// (e.g., the standard library) is only recorded if no other has been.
+func (e *JsonnetError) setLocation(loc []string) {
+	var line, column, endColumn int
+	if loc[2] != "" {
+		line, _ = strconv.Atoi(loc[2])
+		column, _ = strconv.Atoi(loc[3])
+		endColumn, _ = strconv.Atoi(loc[4])
+	} else {
+		line, _ = strconv.Atoi(loc[5])
+		column, _ = strconv.Atoi(loc[6])
+	}
+
+	data, err := ioutil.ReadFile(loc[1])
+	if err != nil && e.File != "" {
+		return
+	}
+
+	e.File, e.Line, e.Column, e.EndColumn = loc[1], line, column, endColumn
+	if err == nil {
+		e.Excerpt = excerpt(string(data), line, column, endColumn)
+	}
+}
+
+// excerpt returns the lines of `text` around `line`, numbered, with a marker
+// under the columns `column` through `endColumn` of `line`.
+func excerpt(text string, line, column, endColumn int) string {
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	first, last := line-excerptContext, line+excerptContext
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	width := len(strconv.Itoa(last))
+
+	var buf bytes.Buffer
+	for i := first; i <= last; i++ {
+		fmt.Fprintf(&buf, "  %*d | %s\n", width, i, lines[i-1])
+		if i != line || column < 1 {
+			continue
+		}
+
+		length := 1
+		if endColumn > column {
+			length = endColumn - column + 1
+		}
+		// Keep tabs in the marker line, so that it lines up with the source.
+		prefix := []rune(lines[i-1])
+		if column-1 < len(prefix) {
+			prefix = prefix[:column-1]
+		}
+		padding := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, string(prefix))
+		fmt.Fprintf(&buf, "  %*s | %s%s\n", width, "", padding, strings.Repeat("^", length))
+	}
+	return buf.String()
+}
+
+// jsonnetHints maps patterns matching the messages of common Jsonnet errors to
+// a suggestion on how to fix them. The first submatch of a pattern, if any, is
+// substituted into the hint.
+var jsonnetHints = []struct {
+	pattern *regexp.Regexp
+	hint    string
+}{
+	{
+		regexp.MustCompile(`^Expected a comma before next field`),
+		"Fields of an object must be separated by commas; is one missing at the end of the previous field?",
+	},
+	{
+		regexp.MustCompile(`^Expected a comma before next array element`),
+		"Elements of an array must be separated by commas; is one missing after the previous element, or is a closing ']' missing?",
+	},
+	{
+		regexp.MustCompile(`^Expected one of :, ::, :::, \+:, \+::, \+:::, got: (\S+)`),
+		"Field names that are not identifiers (e.g., names containing '-', '.', or '/') must be quoted, as in \"my-field\": ...; found '%s' in a field name.",
+	},
+	{
+		regexp.MustCompile(`^Unknown variable: (\S+)`),
+		"Check the spelling of '%s', and that it is declared (with 'local', or as a function parameter) before it is used.",
+	},
+	{
+		regexp.MustCompile(`^Field does not exist: (\S+)`),
+		"The object has no field '%s'; check its spelling, or use 'std.objectHas' to test for optional fields.",
+	},
+	{
+		regexp.MustCompile(`^[Cc]ouldn't open import "([^"]+)"`),
+		"Imports are resolved relative to the importing file, and then to the Jsonnet search paths (e.g., the application's 'lib/' and 'vendor/' directories); check that '%s' exists in one of them.",
+	},
+	{
+		regexp.MustCompile(`^Max stack frames exceeded`),
+		"The evaluation recursed too deeply; check for a function or field that (indirectly) refers to itself without a base case. Legitimately deep recursion can raise the limit with '--max-stack', or 'jsonnet.maxStack' in app.yaml.",
+	},
+	{
+		regexp.MustCompile(`^Unexpected end of file`),
+		"An object, array, or string is not closed; check for a missing '}', ']', or quote.",
+	},
+}
+
+// jsonnetHint returns a hint on how to fix the error with message `msg`, or
+// the empty string if there is none.
+func jsonnetHint(msg string) string {
+	for _, h := range jsonnetHints {
+		m := h.pattern.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		if len(m) > 1 {
+			return fmt.Sprintf(h.hint, m[1])
+		}
+		return h.hint
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jsonnet "github.com/strickyak/jsonnet_cgo"
+)
+
+func evaluateError(t *testing.T, dir, name, text string) *JsonnetError {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vm := jsonnet.Make()
+	defer vm.Destroy()
+
+	_, err := evaluateJsonnet(vm, path)
+	jerr, ok := err.(*JsonnetError)
+	if !ok {
+		t.Fatalf("Expected evaluating '%s' to fail with a *JsonnetError, got %#v", name, err)
+	}
+	return jerr
+}
+
+func TestJsonnetError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ksonnet-errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name         string
+		text         string
+		kind         string
+		line, column int
+		marker       string
+		hint         string
+	}{
+		{
+			name:   "comma.jsonnet",
+			text:   "{\n  a: 1\n  b: 2,\n}\n",
+			kind:   "STATIC ERROR",
+			line:   3,
+			column: 3,
+			marker: "  3 |   b: 2,\n    |   ^\n",
+			hint:   "is one missing at the end of the previous field",
+		},
+		{
+			name:   "key.jsonnet",
+			text:   "{\n  app-name: 'guestbook',\n}\n",
+			kind:   "STATIC ERROR",
+			line:   2,
+			column: 3,
+			marker: "  2 |   app-name: 'guestbook',\n    |   ^^^\n",
+			hint:   "must be quoted",
+		},
+		{
+			name:   "field.jsonnet",
+			text:   "local params = {};\n{\n  replicas: params.replicas,\n}\n",
+			kind:   "RUNTIME ERROR",
+			line:   3,
+			column: 13,
+			marker: "  3 |   replicas: params.replicas,\n    |             ^^^^^^^^^^^^^^^\n",
+			hint:   "no field 'replicas'",
+		},
+		{
+			name:   "recursion.jsonnet",
+			text:   "local f(n) = f(n + 1);\nf(0)\n",
+			kind:   "RUNTIME ERROR",
+			line:   1,
+			column: 14,
+			hint:   "recursed too deeply",
+		},
+		{
+			name:   "error.jsonnet",
+			text:   "{\n  a: error 'boom',\n}\n",
+			kind:   "RUNTIME ERROR",
+			line:   2,
+			column: 6,
+		},
+	}
+
+	for _, test := range tests {
+		e := evaluateError(t, dir, test.name, test.text)
+		if e.Kind != test.kind || e.File != filepath.Join(dir, test.name) || e.Line != test.line || e.Column != test.column {
+			t.Errorf("%s: unexpected error location: %#v", test.name, e)
+		}
+		if test.marker != "" && !strings.Contains(e.Excerpt, test.marker) {
+			t.Errorf("%s: expected excerpt to contain:\n%s\ngot:\n%s", test.name, test.marker, e.Excerpt)
+		}
+		if !strings.Contains(e.Hint, test.hint) || (test.hint == "" && e.Hint != "") {
+			t.Errorf("%s: expected hint containing '%s', got '%s'", test.name, test.hint, e.Hint)
+		}
+		if !strings.Contains(e.Error(), e.Excerpt) {
+			t.Errorf("%s: expected error to include excerpt, got:\n%s", test.name, e.Error())
+		}
+	}
+}
+
+func TestNewJsonnetErrorPassthrough(t *testing.T) {
+	err := errors.New("Opening input file: missing.jsonnet: No such file or directory")
+	if NewJsonnetError(err) != err {
+		t.Errorf("Expected non-Jsonnet error to be returned unchanged")
+	}
+}
@@ -7,7 +7,9 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/discovery"
 )
@@ -65,6 +67,27 @@ func (v ServerVersion) String() string {
 	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
 }
 
+// ComponentLabel is the label recording which component of a ksonnet
+// application an object belongs to.
+const ComponentLabel = "ksonnet.io/component"
+
+const (
+	// AnnotationSkipValidate, set to "true", excludes an object from 'ks
+	// validate', e.g., because it relies on server-side defaulting that local
+	// validation does not know about.
+	AnnotationSkipValidate = "ksonnet.io/skip-validate"
+	// AnnotationSkipDiff, set to "true", excludes an object from 'ks diff'.
+	AnnotationSkipDiff = "ksonnet.io/skip-diff"
+	// AnnotationJobRerun overrides, for a single Job or CronJob, the
+	// `jobRerun` setting of its component in 'app.yaml'.
+	AnnotationJobRerun = "ksonnet.io/job-rerun"
+)
+
+// HasTrueAnnotation returns true if the annotation `key` of `obj` is "true".
+func HasTrueAnnotation(obj metav1.Object, key string) bool {
+	return obj.GetAnnotations()[key] == "true"
+}
+
 // SetMetaDataAnnotation sets an annotation value
 func SetMetaDataAnnotation(obj metav1.Object, key, value string) {
 	a := obj.GetAnnotations()
@@ -102,3 +125,87 @@ func FqName(o metav1.Object) string {
 	}
 	return fmt.Sprintf("%s.%s", o.GetNamespace(), o.GetName())
 }
+
+// clusterScopedKinds are the built-in kinds whose objects are not namespaced.
+// Objects are rendered without talking to the cluster, so its discovery
+// information cannot be used.
+var clusterScopedKinds = []schema.GroupKind{
+	gkNamespace,
+	gkStorageClass,
+	gkCrd,
+	gkTpr,
+	{Group: "", Kind: "Node"},
+	{Group: "", Kind: "PersistentVolume"},
+	{Group: "", Kind: "ComponentStatus"},
+	{Group: groupRbac, Kind: "ClusterRole"},
+	{Group: groupRbac, Kind: "ClusterRoleBinding"},
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"},
+	{Group: "storage.k8s.io", Kind: "CSIDriver"},
+	{Group: "storage.k8s.io", Kind: "CSINode"},
+	{Group: "apiregistration.k8s.io", Kind: "APIService"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+	{Group: "admissionregistration.k8s.io", Kind: "InitializerConfiguration"},
+	{Group: "policy", Kind: "PodSecurityPolicy"},
+	{Group: "extensions", Kind: "PodSecurityPolicy"},
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"},
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"},
+	{Group: "node.k8s.io", Kind: "RuntimeClass"},
+	{Group: "networking.k8s.io", Kind: "IngressClass"},
+}
+
+// clusterScoped returns the kinds of the objects among `objs` that are not
+// namespaced: the built-in `clusterScopedKinds`, and the custom resources
+// that the CustomResourceDefinitions among `objs` define with the scope
+// 'Cluster'.
+func clusterScoped(objs []*unstructured.Unstructured) map[schema.GroupKind]bool {
+	kinds := map[schema.GroupKind]bool{}
+	for _, gk := range clusterScopedKinds {
+		kinds[gk] = true
+	}
+	for _, obj := range objs {
+		if obj.GroupVersionKind().GroupKind() != gkCrd {
+			continue
+		}
+		spec, _ := obj.Object["spec"].(map[string]interface{})
+		names, _ := spec["names"].(map[string]interface{})
+		group, _ := spec["group"].(string)
+		kind, _ := names["kind"].(string)
+		if spec["scope"] == "Cluster" && kind != "" {
+			kinds[schema.GroupKind{Group: group, Kind: kind}] = true
+		}
+	}
+	return kinds
+}
+
+// SetComponentNamespaces sets the namespace of each object in `objs` that
+// belongs to a component (see `ComponentLabel`) named in `namespaces`, to
+// the namespace it maps to. Objects that already specify a namespace, and
+// objects of cluster-scoped kinds (e.g., ClusterRoles, or custom resources
+// defined among `objs` with the scope 'Cluster'), are left alone.
+func SetComponentNamespaces(objs []*unstructured.Unstructured, namespaces map[string]string) {
+	if len(namespaces) == 0 {
+		return
+	}
+	kinds := clusterScoped(objs)
+	for _, obj := range objs {
+		if obj.GetNamespace() != "" || kinds[obj.GroupVersionKind().GroupKind()] {
+			continue
+		}
+		if namespace, ok := namespaces[obj.GetLabels()[ComponentLabel]]; ok {
+			obj.SetNamespace(namespace)
+		}
+	}
+}
+
+// GroupByComponentServer splits `objs` by the server that the component of
+// each object (see `ComponentLabel`) maps to in `servers`. Objects of
+// components that are not mapped are grouped under the empty string.
+func GroupByComponentServer(objs []*unstructured.Unstructured, servers map[string]string) map[string][]*unstructured.Unstructured {
+	groups := map[string][]*unstructured.Unstructured{}
+	for _, obj := range objs {
+		server := servers[obj.GetLabels()[ComponentLabel]]
+		groups[server] = append(groups[server], obj)
+	}
+	return groups
+}
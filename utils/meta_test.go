@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -131,3 +133,112 @@ func TestFqName(t *testing.T) {
 		t.Errorf("Got %q for %v", n, obj)
 	}
 }
+
+func TestSetComponentNamespaces(t *testing.T) {
+	newObj := func(name, component, namespace string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+		}}
+		obj.SetName(name)
+		obj.SetNamespace(namespace)
+		if component != "" {
+			obj.SetLabels(map[string]string{ComponentLabel: component})
+		}
+		return obj
+	}
+
+	objs := []*unstructured.Unstructured{
+		newObj("mapped", "redis", ""),
+		newObj("explicit", "redis", "other"),
+		newObj("unmapped", "web", ""),
+		newObj("unlabeled", "", ""),
+	}
+	SetComponentNamespaces(objs, map[string]string{"redis": "cache"})
+
+	expected := []string{"cache", "other", "", ""}
+	for i, obj := range objs {
+		if obj.GetNamespace() != expected[i] {
+			t.Errorf("Expected '%s' to be in namespace '%s', got '%s'", obj.GetName(), expected[i], obj.GetNamespace())
+		}
+	}
+
+	// Objects of cluster-scoped kinds, including custom resources defined
+	// with the scope 'Cluster', are not namespaced.
+	newKind := func(apiVersion, kind string) *unstructured.Unstructured {
+		obj := newObj(strings.ToLower(kind), "redis", "")
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		return obj
+	}
+	crd := newKind("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition")
+	crd.Object["spec"] = map[string]interface{}{
+		"group": "example.com",
+		"scope": "Cluster",
+		"names": map[string]interface{}{"kind": "Tenant"},
+	}
+	namespacedCrd := newKind("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition")
+	namespacedCrd.Object["spec"] = map[string]interface{}{
+		"group": "example.com",
+		"scope": "Namespaced",
+		"names": map[string]interface{}{"kind": "Widget"},
+	}
+	objs = []*unstructured.Unstructured{
+		newKind("rbac.authorization.k8s.io/v1", "ClusterRole"),
+		newKind("rbac.authorization.k8s.io/v1", "Role"),
+		newKind("v1", "Namespace"),
+		newKind("v1", "PersistentVolume"),
+		newKind("storage.k8s.io/v1", "StorageClass"),
+		crd,
+		namespacedCrd,
+		newKind("example.com/v1", "Tenant"),
+		newKind("example.com/v1", "Widget"),
+	}
+	SetComponentNamespaces(objs, map[string]string{"redis": "cache"})
+
+	expected = []string{"", "cache", "", "", "", "", "", "", "cache"}
+	for i, obj := range objs {
+		if obj.GetNamespace() != expected[i] {
+			t.Errorf("Expected %s '%s' to be in namespace '%s', got '%s'", obj.GetKind(), obj.GetName(), expected[i], obj.GetNamespace())
+		}
+	}
+}
+
+func TestGroupByComponentServer(t *testing.T) {
+	newObj := func(name, component string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+		}}
+		obj.SetName(name)
+		if component != "" {
+			obj.SetLabels(map[string]string{ComponentLabel: component})
+		}
+		return obj
+	}
+
+	objs := []*unstructured.Unstructured{
+		newObj("agent", "prometheus"),
+		newObj("web", "web"),
+		newObj("unlabeled", ""),
+		newObj("rules", "prometheus"),
+	}
+	groups := GroupByComponentServer(objs, map[string]string{"prometheus": "https://ops.example.com"})
+
+	names := func(objs []*unstructured.Unstructured) []string {
+		names := []string{}
+		for _, obj := range objs {
+			names = append(names, obj.GetName())
+		}
+		return names
+	}
+	if len(groups) != 2 {
+		t.Errorf("Expected 2 groups, got %d", len(groups))
+	}
+	if got := names(groups[""]); !reflect.DeepEqual(got, []string{"web", "unlabeled"}) {
+		t.Errorf("Expected the environment's cluster to get [web unlabeled], got %v", got)
+	}
+	if got := names(groups["https://ops.example.com"]); !reflect.DeepEqual(got, []string{"agent", "rules"}) {
+		t.Errorf("Expected the operations cluster to get [agent rules], got %v", got)
+	}
+}
@@ -16,6 +16,10 @@
 package utils
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
@@ -24,6 +28,10 @@ var (
 	gkNamespace    = schema.GroupKind{Group: "", Kind: "Namespace"}
 	gkTpr          = schema.GroupKind{Group: "extensions", Kind: "ThirdPartyResource"}
 	gkStorageClass = schema.GroupKind{Group: "storage.k8s.io", Kind: "StorageClass"}
+	gkCrd          = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+
+	gkServiceAccount = schema.GroupKind{Group: "", Kind: "ServiceAccount"}
+	groupRbac        = "rbac.authorization.k8s.io"
 
 	gkPod         = schema.GroupKind{Group: "", Kind: "Pod"}
 	gkJob         = schema.GroupKind{Group: "batch", Kind: "Job"}
@@ -42,31 +50,124 @@ func isPodOrSimilar(gk schema.GroupKind) bool {
 		gk == gkStatefulSet
 }
 
+// Tiers used to do a simple topological sort of resources.
+const (
+	// tierSetup holds kinds that change what other objects can be created
+	// (e.g., namespaces, and the definitions of custom resources).
+	tierSetup = 10
+	// tierRbac holds the identities and permissions that workloads run with.
+	tierRbac    = 30
+	tierDefault = 50
+	tierPods    = 100
+)
+
 // Arbitrary numbers used to do a simple topological sort of resources.
 // TODO: expand this list.
 func depTier(o schema.ObjectKind) int {
 	gk := o.GroupVersionKind().GroupKind()
-	if gk == gkNamespace || gk == gkTpr || gk == gkStorageClass {
-		return 10
+	if gk == gkNamespace || gk == gkTpr || gk == gkStorageClass || gk == gkCrd {
+		return tierSetup
+	} else if gk.Group == groupRbac || gk == gkServiceAccount {
+		return tierRbac
 	} else if isPodOrSimilar(gk) {
-		return 100
+		return tierPods
 	} else {
-		return 50
+		return tierDefault
 	}
 }
 
+// AnnotationApplyWave orders objects explicitly, for dependencies the
+// built-in heuristics can't see (e.g., a custom resource that can only be
+// created once the operator that serves it is running). Objects are applied
+// in waves, in ascending order of the (integer) annotation value; objects
+// without it are in wave 0.
+const AnnotationApplyWave = "ksonnet.io/apply-wave"
+
+// ApplyWave returns the wave `obj` is applied in (see `AnnotationApplyWave`).
+func ApplyWave(obj *unstructured.Unstructured) (int, error) {
+	value, ok := obj.GetAnnotations()[AnnotationApplyWave]
+	if !ok {
+		return 0, nil
+	}
+
+	wave, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value '%s' for annotation '%s' on %s; must be an integer", value, AnnotationApplyWave, FqName(obj))
+	}
+	return wave, nil
+}
+
+// applyWave is `ApplyWave`, treating invalid values as wave 0. Callers that
+// care about invalid values validate them with `ApplyWaves` first.
+func applyWave(obj *unstructured.Unstructured) int {
+	wave, _ := ApplyWave(obj)
+	return wave
+}
+
 // DependencyOrder is a `sort.Interface` that *best-effort* sorts the
 // objects so that known dependencies appear earlier in the list.  The
 // idea is to prevent *some* of the "crash-restart" loops when
-// creating inter-dependent resources.
+// creating inter-dependent resources. Explicit waves (see
+// `AnnotationApplyWave`) take precedence over the built-in heuristics.
 type DependencyOrder []*unstructured.Unstructured
 
 func (l DependencyOrder) Len() int      { return len(l) }
 func (l DependencyOrder) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
 func (l DependencyOrder) Less(i, j int) bool {
+	if wi, wj := applyWave(l[i]), applyWave(l[j]); wi != wj {
+		return wi < wj
+	}
 	return depTier(l[i].GetObjectKind()) < depTier(l[j].GetObjectKind())
 }
 
+// ApplyWaves groups `objs` by their wave (see `AnnotationApplyWave`), in the
+// order the waves are applied. It fails if any object has an invalid wave.
+func ApplyWaves(objs []*unstructured.Unstructured) ([][]*unstructured.Unstructured, error) {
+	byWave := map[int][]*unstructured.Unstructured{}
+	waves := []int{}
+	for _, obj := range objs {
+		wave, err := ApplyWave(obj)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := byWave[wave]; !ok {
+			waves = append(waves, wave)
+		}
+		byWave[wave] = append(byWave[wave], obj)
+	}
+
+	sort.Ints(waves)
+	grouped := make([][]*unstructured.Unstructured, 0, len(waves))
+	for _, wave := range waves {
+		grouped = append(grouped, byWave[wave])
+	}
+	return grouped, nil
+}
+
+// ApplyClasses groups `objs` into batches that can each be applied
+// concurrently, in the order the batches must be applied: within each wave
+// (see `AnnotationApplyWave`), RBAC objects, then everything else, then
+// workloads. Objects that change what other objects can be created (e.g.,
+// namespaces and CRDs) come first, each in a batch of its own, so that they
+// are applied one at a time.
+func ApplyClasses(objs []*unstructured.Unstructured) [][]*unstructured.Unstructured {
+	sorted := make([]*unstructured.Unstructured, len(objs))
+	copy(sorted, objs)
+	sort.Stable(DependencyOrder(sorted))
+
+	classes := [][]*unstructured.Unstructured{}
+	prevTier, prevWave := -1, 0
+	for i, obj := range sorted {
+		tier, wave := depTier(obj.GetObjectKind()), applyWave(obj)
+		if i == 0 || tier == tierSetup || tier != prevTier || wave != prevWave {
+			classes = append(classes, []*unstructured.Unstructured{})
+		}
+		classes[len(classes)-1] = append(classes[len(classes)-1], obj)
+		prevTier, prevWave = tier, wave
+	}
+	return classes
+}
+
 // AlphabeticalOrder is a `sort.Interface` that sorts the
 // objects by namespace/name/kind alphabetical order
 type AlphabeticalOrder []*unstructured.Unstructured
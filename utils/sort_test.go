@@ -52,6 +52,129 @@ func TestDepSort(t *testing.T) {
 	}
 }
 
+func TestApplyClasses(t *testing.T) {
+	newObj := func(apiVersion, kind, name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": apiVersion,
+				"kind":       kind,
+				"metadata":   map[string]interface{}{"name": name},
+			},
+		}
+	}
+
+	objs := []*unstructured.Unstructured{
+		newObj("extensions/v1beta1", "Deployment", "web"),
+		newObj("v1", "ConfigMap", "config"),
+		newObj("rbac.authorization.k8s.io/v1beta1", "Role", "reader"),
+		newObj("v1", "Namespace", "prod"),
+		newObj("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "crons"),
+		newObj("v1", "Service", "web"),
+		newObj("v1", "ServiceAccount", "web"),
+		newObj("batch/v1", "Job", "migrate"),
+	}
+
+	classes := ApplyClasses(objs)
+
+	names := [][]string{}
+	for _, class := range classes {
+		classNames := []string{}
+		for _, obj := range class {
+			classNames = append(classNames, obj.GetKind()+"/"+obj.GetName())
+		}
+		names = append(names, classNames)
+	}
+
+	expected := [][]string{
+		{"Namespace/prod"},
+		{"CustomResourceDefinition/crons"},
+		{"Role/reader", "ServiceAccount/web"},
+		{"ConfigMap/config", "Service/web"},
+		{"Deployment/web", "Job/migrate"},
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected classes %v, got %v", expected, names)
+	}
+
+	if objs[0].GetKind() != "Deployment" {
+		t.Errorf("Expected ApplyClasses not to reorder its argument")
+	}
+}
+
+func TestApplyWaves(t *testing.T) {
+	newObj := func(kind, name, wave string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       kind,
+				"metadata":   map[string]interface{}{"name": name},
+			},
+		}
+		if wave != "" {
+			obj.SetAnnotations(map[string]string{AnnotationApplyWave: wave})
+		}
+		return obj
+	}
+
+	objs := []*unstructured.Unstructured{
+		newObj("ConfigMap", "cr", "2"),
+		newObj("Pod", "operator", "1"),
+		newObj("Namespace", "prod", ""),
+		newObj("Service", "operator", "1"),
+		newObj("ConfigMap", "setup", "-1"),
+	}
+
+	names := func(groups [][]*unstructured.Unstructured) [][]string {
+		all := [][]string{}
+		for _, group := range groups {
+			groupNames := []string{}
+			for _, obj := range group {
+				groupNames = append(groupNames, obj.GetKind()+"/"+obj.GetName())
+			}
+			all = append(all, groupNames)
+		}
+		return all
+	}
+
+	waves, err := ApplyWaves(objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"ConfigMap/setup"},
+		{"Namespace/prod"},
+		{"Pod/operator", "Service/operator"},
+		{"ConfigMap/cr"},
+	}
+	if got := names(waves); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected waves %v, got %v", expected, got)
+	}
+
+	// Classes never span waves, and waves override the built-in ordering.
+	expected = [][]string{
+		{"ConfigMap/setup"},
+		{"Namespace/prod"},
+		{"Service/operator"},
+		{"Pod/operator"},
+		{"ConfigMap/cr"},
+	}
+	if got := names(ApplyClasses(objs)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected classes %v, got %v", expected, got)
+	}
+
+	// Deletion happens in reverse dependency order, so later waves go first.
+	sorted := make([]*unstructured.Unstructured, len(objs))
+	copy(sorted, objs)
+	sort.Stable(sort.Reverse(DependencyOrder(sorted)))
+	if first := sorted[0]; first.GetName() != "cr" {
+		t.Errorf("Expected the last wave to be deleted first, got %s/%s", first.GetKind(), first.GetName())
+	}
+
+	if _, err := ApplyWaves([]*unstructured.Unstructured{newObj("Pod", "bad", "first")}); err == nil {
+		t.Errorf("Expected a non-integer wave to be rejected")
+	}
+}
+
 func TestAlphaSort(t *testing.T) {
 	newObj := func(ns, name, kind string) *unstructured.Unstructured {
 		o := unstructured.Unstructured{}